@@ -0,0 +1,231 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// authPatternsFlag collects -auth_pattern flags of the form host=pattern.
+// Patterns are formatted like the auth_patterns attribute of http_archive:
+// <login> and <password> are replaced with the credentials for the host in
+// the netrc file.
+type authPatternsFlag map[string]string
+
+func (f authPatternsFlag) String() string {
+	hosts := make([]string, 0, len(f))
+	for host := range f {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for i, host := range hosts {
+		hosts[i] = host + "=" + f[host]
+	}
+	return strings.Join(hosts, ",")
+}
+
+func (f authPatternsFlag) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 {
+		return fmt.Errorf("auth pattern %q: want host=pattern", value)
+	}
+	f[value[:i]] = value[i+1:]
+	return nil
+}
+
+// netrcEntry holds the credentials for one machine in a netrc file.
+type netrcEntry struct {
+	login, password string
+}
+
+// parseNetrc parses the contents of a netrc file. Credentials in a
+// "default" entry are stored under the empty machine name. Macro definitions
+// are skipped.
+func parseNetrc(data []byte) map[string]netrcEntry {
+	entries := make(map[string]netrcEntry)
+	var machine string
+	var entry netrcEntry
+	inEntry := false
+	flush := func() {
+		if inEntry {
+			if _, ok := entries[machine]; !ok {
+				entries[machine] = entry
+			}
+		}
+	}
+	lines := strings.Split(string(data), "\n")
+	for l := 0; l < len(lines); l++ {
+		fields := strings.Fields(lines[l])
+		for i := 0; i < len(fields); i++ {
+			switch fields[i] {
+			case "machine":
+				flush()
+				machine, entry, inEntry = "", netrcEntry{}, true
+				if i+1 < len(fields) {
+					i++
+					machine = fields[i]
+				}
+			case "default":
+				flush()
+				machine, entry, inEntry = "", netrcEntry{}, true
+			case "login":
+				if i+1 < len(fields) {
+					i++
+					entry.login = fields[i]
+				}
+			case "password":
+				if i+1 < len(fields) {
+					i++
+					entry.password = fields[i]
+				}
+			case "account":
+				i++
+			case "macdef":
+				// A macro definition continues until a blank line.
+				for l+1 < len(lines) && strings.TrimSpace(lines[l+1]) != "" {
+					l++
+				}
+				i = len(fields)
+			}
+		}
+	}
+	flush()
+	return entries
+}
+
+// goAuthResponse returns the output of a GOAUTH command that attaches an
+// Authorization header to requests to each host in patterns with
+// credentials in netrc. Hosts without credentials are skipped.
+func goAuthResponse(netrc map[string]netrcEntry, patterns map[string]string) []byte {
+	hosts := make([]string, 0, len(patterns))
+	for host := range patterns {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	buf := &bytes.Buffer{}
+	for _, host := range hosts {
+		entry, ok := netrc[host]
+		if !ok {
+			continue
+		}
+		header := strings.NewReplacer("<login>", entry.login, "<password>", entry.password).Replace(patterns[host])
+		fmt.Fprintf(buf, "https://%s\n\nAuthorization: %s\n\n", host, header)
+	}
+	return buf.Bytes()
+}
+
+// moduleAuthEnv returns environment variables that let "go mod download"
+// authenticate to private module proxies. If netrcPath is set, the go
+// command reads credentials from that file instead of ~/.netrc. If patterns
+// is not empty, a file with the formatted Authorization headers is written
+// and fetch_repo is installed as a GOAUTH command that prints it; this
+// requires Go 1.24 or later. The returned function deletes the file.
+func moduleAuthEnv(netrcPath string, patterns map[string]string) (env []string, cleanup func(), err error) {
+	cleanup = func() {}
+	if netrcPath != "" {
+		env = append(env, "NETRC="+netrcPath)
+	}
+	if len(patterns) == 0 {
+		return env, cleanup, nil
+	}
+
+	if netrcPath == "" {
+		if netrcPath = os.Getenv("NETRC"); netrcPath == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, nil, fmt.Errorf("locating netrc file: %w", err)
+			}
+			netrcPath = filepath.Join(home, ".netrc")
+		}
+	}
+	data, err := os.ReadFile(netrcPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading netrc file: %w", err)
+	}
+	response := goAuthResponse(parseNetrc(data), patterns)
+	if len(response) == 0 {
+		return env, cleanup, nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, nil, fmt.Errorf("locating fetch_repo for GOAUTH: %w", err)
+	}
+	f, err := os.CreateTemp("", "fetch_repo_goauth")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup = func() { os.Remove(f.Name()) }
+	if _, err := f.Write(response); err != nil {
+		f.Close()
+		cleanup()
+		return nil, nil, err
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	// Keep the user's authentication methods, so hosts without patterns
+	// still use netrc or git credentials.
+	goAuth := os.Getenv("GOAUTH")
+	if goAuth == "" {
+		goAuth = "netrc"
+	}
+	args, err := joinGoAuthArgs([]string{exe, "-goauth_response=" + f.Name()})
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	command := "command " + args
+	if goAuth == "off" {
+		goAuth = command
+	} else {
+		goAuth += "; " + command
+	}
+	env = append(env, "GOAUTH="+goAuth)
+	return env, cleanup, nil
+}
+
+// joinGoAuthArgs joins args into a GOAUTH command line. The go command
+// splits the line on spaces, honoring single and double quotes, and
+// separates GOAUTH entries with semicolons, so arguments are quoted as
+// needed and arguments that can't be represented are rejected.
+func joinGoAuthArgs(args []string) (string, error) {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		switch {
+		case arg == "":
+			return "", fmt.Errorf("GOAUTH command argument %d is empty", i)
+		case strings.Contains(arg, ";"):
+			return "", fmt.Errorf("GOAUTH command argument %q contains a semicolon", arg)
+		case strings.Contains(arg, "'") && strings.Contains(arg, `"`):
+			return "", fmt.Errorf("GOAUTH command argument %q contains both single and double quotes", arg)
+		case strings.Contains(arg, "'"):
+			quoted[i] = `"` + arg + `"`
+		case strings.ContainsAny(arg, " \t\n\r\""):
+			quoted[i] = "'" + arg + "'"
+		default:
+			quoted[i] = arg
+		}
+	}
+	return strings.Join(quoted, " "), nil
+}
@@ -0,0 +1,107 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	data := []byte(`machine proxy.example.com
+	login alice
+	password s3cret
+
+macdef init
+machine ignored.example.com login x password y
+
+machine gitlab.example.com login bob password token account acct
+default login anon password anon
+`)
+	got := parseNetrc(data)
+	want := map[string]netrcEntry{
+		"proxy.example.com":  {login: "alice", password: "s3cret"},
+		"gitlab.example.com": {login: "bob", password: "token"},
+		"":                   {login: "anon", password: "anon"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v; want %#v", got, want)
+	}
+}
+
+func TestModuleAuthEnv(t *testing.T) {
+	dir := t.TempDir()
+	netrcPath := filepath.Join(dir, "netrc")
+	if err := os.WriteFile(netrcPath, []byte("machine proxy.example.com login alice password s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOAUTH", "")
+
+	env, cleanup, err := moduleAuthEnv(netrcPath, map[string]string{
+		"proxy.example.com": "Bearer <password>",
+		"other.example.com": "Basic <login>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	if len(env) != 2 || env[0] != "NETRC="+netrcPath || !strings.HasPrefix(env[1], "GOAUTH=netrc; command ") {
+		t.Fatalf("got env %q", env)
+	}
+	i := strings.Index(env[1], "-goauth_response=")
+	if i < 0 {
+		t.Fatalf("GOAUTH command has no response file: %q", env[1])
+	}
+	got, err := os.ReadFile(env[1][i+len("-goauth_response="):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "https://proxy.example.com\n\nAuthorization: Bearer s3cret\n\n"
+	if string(got) != want {
+		t.Errorf("got GOAUTH response %q; want %q", got, want)
+	}
+}
+
+func TestJoinGoAuthArgs(t *testing.T) {
+	for _, tc := range []struct {
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{args: []string{"/bin/fetch_repo", "-goauth_response=/tmp/r"}, want: "/bin/fetch_repo -goauth_response=/tmp/r"},
+		{args: []string{"/my dir/fetch_repo", "-goauth_response=/tmp/r"}, want: "'/my dir/fetch_repo' -goauth_response=/tmp/r"},
+		{args: []string{"/it's/fetch_repo"}, want: `"/it's/fetch_repo"`},
+		{args: []string{"/a;b/fetch_repo"}, wantErr: true},
+		{args: []string{`/a'"/fetch_repo`}, wantErr: true},
+	} {
+		got, err := joinGoAuthArgs(tc.args)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("joinGoAuthArgs(%q): got %q; want error", tc.args, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("joinGoAuthArgs(%q): %v", tc.args, err)
+		} else if got != tc.want {
+			t.Errorf("joinGoAuthArgs(%q): got %q; want %q", tc.args, got, tc.want)
+		}
+	}
+}
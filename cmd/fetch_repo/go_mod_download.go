@@ -31,11 +31,16 @@ func findGoPath() string {
 	return goPath
 }
 
-func runGoModDownload(dl *GoModDownloadResult, dest string, importpath string, version string) error {
+// runGoModDownload runs "go mod download" for importpath at version. env
+// holds additional environment variables for the go command.
+func runGoModDownload(dl *GoModDownloadResult, dest string, importpath string, version string, env []string) error {
 	buf := bytes.NewBuffer(nil)
 	bufErr := bytes.NewBuffer(nil)
 	cmd := exec.Command(findGoPath(), "mod", "download", "-json", "-modcacherw")
 	cmd.Dir = dest
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 
 	if version != "" && importpath != "" {
 		cmd.Args = append(cmd.Args, importpath+"@"+version)
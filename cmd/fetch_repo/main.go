@@ -27,6 +27,7 @@ package main
 import (
 	"flag"
 	"log"
+	"os"
 
 	"golang.org/x/tools/go/vcs"
 )
@@ -47,8 +48,24 @@ var (
 	// Module flags
 	version = flag.String("version", "", "module version. Must be semantic version or pseudo-version.")
 	sum     = flag.String("sum", "", "hash of module contents")
+	netrc   = flag.String("netrc", "", "netrc file with credentials for module proxies. Defaults to $NETRC or ~/.netrc.")
+
+	// Set by go_repository from GAZELLE_REPO_RECORD and GAZELLE_REPO_REPLAY.
+	recordDir = flag.String("record_dir", "", "directory where fetched modules and repositories are recorded, so they can be replayed with -replay_dir")
+	replayDir = flag.String("replay_dir", "", "directory with modules and repositories recorded with -record_dir. Recorded contents are copied instead of being fetched")
+
+	// Set by go_repository to print Authorization headers when fetch_repo is
+	// run as a GOAUTH command. See moduleAuthEnv.
+	goAuthResponseFile = flag.String("goauth_response", "", "file to print as a GOAUTH command response")
 )
 
+// authPatterns maps module proxy host names to Authorization header patterns.
+var authPatterns = authPatternsFlag{}
+
+func init() {
+	flag.Var(authPatterns, "auth_pattern", "host=pattern; sets the Authorization header for requests to a module proxy on host. <login> and <password> in the pattern are replaced with credentials from the netrc file. May be repeated. Requires Go 1.24 or later.")
+}
+
 // Override in tests to disable network calls.
 var repoRootForImportPath = vcs.RepoRootForImportPath
 
@@ -58,6 +75,17 @@ func main() {
 
 	flag.Parse()
 
+	if *goAuthResponseFile != "" {
+		// The go command passes a URL and response as positional arguments
+		// when a request fails. The response doesn't depend on them.
+		data, err := os.ReadFile(*goAuthResponseFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Stdout.Write(data)
+		return
+	}
+
 	if *importpath == "" && *path == "" && !*no_fetch {
 		log.Fatal("-importpath, -path, or -no-fetch must be set")
 	}
@@ -109,9 +137,23 @@ func main() {
 		if *sum == "" {
 			log.Fatal("-sum must be set in module mode")
 		}
-		if err := fetchModule(*dest, *importpath, *version, *sum); err != nil {
+		env, cleanup, err := moduleAuthEnv(*netrc, authPatterns)
+		if err != nil {
 			log.Fatal(err)
 		}
+		err = fetchOrReplay(*dest, *importpath, *version, "", func() error {
+			return fetchModule(*dest, *importpath, *version, *sum, env)
+		})
+		cleanup()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *replayDir != "" {
+			// Recorded modules are verified like fetched modules.
+			if err := checkModuleSum(*dest, *importpath, *version, *sum); err != nil {
+				log.Fatal(err)
+			}
+		}
 	} else {
 		if *version != "" {
 			log.Fatal("-version must not be set in repository mode")
@@ -122,7 +164,10 @@ func main() {
 		if *rev == "" {
 			log.Fatal("-rev must be set in repository mode")
 		}
-		if err := fetchRepo(*dest, *remote, *cmd, *importpath, *rev); err != nil {
+		err := fetchOrReplay(*dest, *importpath, "", *rev, func() error {
+			return fetchRepo(*dest, *remote, *cmd, *importpath, *rev)
+		})
+		if err != nil {
 			log.Fatal(err)
 		}
 	}
@@ -22,7 +22,7 @@ import (
 	"golang.org/x/mod/sumdb/dirhash"
 )
 
-func fetchModule(dest, importpath, version, sum string) error {
+func fetchModule(dest, importpath, version, sum string, env []string) error {
 	// Check that version is a complete semantic version or pseudo-version.
 	if _, ok := parse(version); !ok {
 		return fmt.Errorf("%q is not a valid semantic version", version)
@@ -47,7 +47,7 @@ func fetchModule(dest, importpath, version, sum string) error {
 	}
 
 	dl := GoModDownloadResult{}
-	err = runGoModDownload(&dl, dest, importpath, version)
+	err = runGoModDownload(&dl, dest, importpath, version, env)
 	os.Remove("go.mod")
 	if err != nil {
 		return err
@@ -59,18 +59,22 @@ func fetchModule(dest, importpath, version, sum string) error {
 	}
 
 	// Verify sum of the directory itself against the go.sum.
+	err = checkModuleSum(dest, importpath, version, sum)
+	if goModCache := os.Getenv("GOMODCACHE"); err != nil && goModCache != "" {
+		return fmt.Errorf("%w, Please try clearing your module cache directory %q", err, goModCache)
+	}
+	return err
+}
+
+// checkModuleSum verifies the sum of the module in dest.
+func checkModuleSum(dest, importpath, version, sum string) error {
 	repoSum, err := dirhash.HashDir(dest, importpath+"@"+version, dirhash.Hash1)
 	if err != nil {
 		return fmt.Errorf("failed computing sum: %w", err)
 	}
-
 	if repoSum != sum {
-		if goModCache := os.Getenv("GOMODCACHE"); goModCache != "" {
-			return fmt.Errorf("resulting module with sum %s; expected sum %s, Please try clearing your module cache directory %q", repoSum, sum, goModCache)
-		}
 		return fmt.Errorf("resulting module with sum %s; expected sum %s", repoSum, sum)
 	}
-
 	return nil
 }
 
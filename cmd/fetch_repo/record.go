@@ -0,0 +1,101 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/mod/module"
+)
+
+// recordedFetchDir returns the directory within a record directory where the
+// fetched contents of a module or repository are stored. Modules are stored
+// in <escaped path>/@v/<escaped version>, and repositories fetched with a
+// version control tool are stored in <escaped path>/@rev/<rev>.
+func recordedFetchDir(recordDir, importpath, version, rev string) (string, error) {
+	escPath, err := module.EscapePath(importpath)
+	if err != nil {
+		return "", err
+	}
+	var sub string
+	if version != "" {
+		escVersion, err := module.EscapeVersion(version)
+		if err != nil {
+			return "", err
+		}
+		sub = filepath.Join("@v", escVersion)
+	} else {
+		sub = filepath.Join("@rev", filepath.FromSlash(rev))
+	}
+	return filepath.Join(recordDir, filepath.FromSlash(escPath), sub), nil
+}
+
+// fetchOrReplay calls fetch to fetch a module or repository into dest. With
+// -record_dir, the fetched contents are recorded afterward. With -replay_dir,
+// recorded contents are copied into dest instead, and fetch isn't called.
+// version is set for modules, and rev is set for repositories.
+func fetchOrReplay(dest, importpath, version, rev string, fetch func() error) error {
+	if *recordDir != "" && *replayDir != "" {
+		return fmt.Errorf("-record_dir and -replay_dir can't both be set")
+	}
+	dir := *recordDir
+	if *replayDir != "" {
+		dir = *replayDir
+	}
+	if dir == "" {
+		return fetch()
+	}
+	recorded, err := recordedFetchDir(dir, importpath, version, rev)
+	if err != nil {
+		return err
+	}
+	if *replayDir != "" {
+		return replayFetch(recorded, dest)
+	}
+	if err := fetch(); err != nil {
+		return err
+	}
+	return recordFetch(recorded, dest)
+}
+
+// recordFetch copies the fetched contents of dest into dir, replacing
+// anything recorded there before.
+func recordFetch(dir, dest string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return err
+	}
+	if err := copyTree(dir, dest); err != nil {
+		return fmt.Errorf("failed recording fetch: %w", err)
+	}
+	return nil
+}
+
+// replayFetch copies contents recorded by recordFetch in dir into dest. It
+// fails if nothing was recorded, rather than fetching from the network.
+func replayFetch(dir, dest string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("no recorded fetch to replay: %w", err)
+	}
+	if err := copyTree(dest, dir); err != nil {
+		return fmt.Errorf("failed replaying fetch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordedFetchDir(t *testing.T) {
+	for _, tc := range []struct {
+		desc, importpath, version, rev, want string
+	}{
+		{
+			desc:       "module",
+			importpath: "github.com/Example/mod",
+			version:    "v1.2.3-RC",
+			want:       "github.com/!example/mod/@v/v1.2.3-!r!c",
+		}, {
+			desc:       "repository",
+			importpath: "example.com/repo",
+			rev:        "0123abcd",
+			want:       "example.com/repo/@rev/0123abcd",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := recordedFetchDir("rec", tc.importpath, tc.version, tc.rev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join("rec", filepath.FromSlash(tc.want)); got != want {
+				t.Errorf("got %q; want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	recDir := t.TempDir()
+	fetch := func(dest string) func() error {
+		return func() error {
+			if err := os.MkdirAll(filepath.Join(dest, "sub"), 0o777); err != nil {
+				return err
+			}
+			return os.WriteFile(filepath.Join(dest, "sub", "a.go"), []byte("package sub"), 0o666)
+		}
+	}
+	errFetch := func() error { return errors.New("fetched while replaying") }
+
+	*recordDir = recDir
+	defer func() { *recordDir = "" }()
+	dest := t.TempDir()
+	if err := fetchOrReplay(dest, "example.com/repo", "", "abc", fetch(dest)); err != nil {
+		t.Fatal(err)
+	}
+	*recordDir = ""
+
+	*replayDir = recDir
+	defer func() { *replayDir = "" }()
+	dest = t.TempDir()
+	if err := fetchOrReplay(dest, "example.com/repo", "", "abc", errFetch); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "sub", "a.go")); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "package sub" {
+		t.Errorf("replayed file has content %q; want %q", data, "package sub")
+	}
+
+	// Fetches that weren't recorded fail instead of going to the network.
+	if err := fetchOrReplay(t.TempDir(), "example.com/repo", "", "def", errFetch); err == nil {
+		t.Error("replaying a fetch that wasn't recorded succeeded; want error")
+	}
+}
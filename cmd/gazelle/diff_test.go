@@ -17,7 +17,9 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/bazelbuild/bazel-gazelle/testtools"
@@ -175,3 +177,70 @@ func TestDiffReadWriteDir(t *testing.T) {
 	want := append(files, testtools.FileSpec{Path: "p", Content: wantPatch})
 	testtools.CheckFiles(t, dir, want)
 }
+
+func TestDiffPatchFileSorted(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix example.com/hello",
+		}, {
+			Path:    "hello.go",
+			Content: "package hello",
+		}, {
+			Path:    "sub/sub.go",
+			Content: "package sub",
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	wantError := "encountered changes while running diff"
+	if err := runGazelle(dir, []string{"-mode=diff", "-patch_file=p"}); err.Error() != wantError {
+		t.Fatalf("got %q; want %q", err, wantError)
+	}
+
+	// Subdirectories are visited before their parents, but the patch is
+	// sorted by path.
+	want := append(files, testtools.FileSpec{
+		Path: "p",
+		Content: `
+--- BUILD.bazel	1970-01-01 00:00:00.000000001 +0000
++++ BUILD.bazel	1970-01-01 00:00:00.000000001 +0000
+@@ -1 +1,10 @@
++load("@io_bazel_rules_go//go:def.bzl", "go_library")
++
+ # gazelle:prefix example.com/hello
++
++go_library(
++    name = "hello",
++    srcs = ["hello.go"],
++    importpath = "example.com/hello",
++    visibility = ["//visibility:public"],
++)
+--- /dev/null	1970-01-01 00:00:00.000000001 +0000
++++ sub/BUILD.bazel	1970-01-01 00:00:00.000000001 +0000
+@@ -0,0 +1,8 @@
++load("@io_bazel_rules_go//go:def.bzl", "go_library")
++
++go_library(
++    name = "sub",
++    srcs = ["sub.go"],
++    importpath = "example.com/hello/sub",
++    visibility = ["//visibility:public"],
++)
+`,
+	})
+	testtools.CheckFiles(t, dir, want)
+
+	// The patch is written to a temporary file first, which must be gone.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".p.") {
+			t.Errorf("temporary file %s was not removed", e.Name())
+		}
+	}
+}
@@ -0,0 +1,441 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/bazelbuild/bazel-gazelle/internal/version"
+	"github.com/bazelbuild/bazel-gazelle/internal/wspace"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"golang.org/x/mod/modfile"
+)
+
+// problem is an environment problem found by the doctor command, along with
+// a suggested fix.
+type problem struct {
+	// where is the file the problem was found in, optionally followed by a
+	// line number. It's empty for problems that aren't in a file.
+	where string
+
+	msg, fix string
+}
+
+func (p problem) String() string {
+	var sb strings.Builder
+	if p.where != "" {
+		fmt.Fprintf(&sb, "%s: ", p.where)
+	}
+	fmt.Fprintf(&sb, "%s\n  fix: %s", p.msg, p.fix)
+	return sb.String()
+}
+
+// doctorEnv is the environment checked by the doctor command.
+type doctorEnv struct {
+	repoRoot string
+
+	// goTool is the path of the go command.
+	goTool string
+
+	// offline is whether network checks are skipped.
+	offline bool
+}
+
+// doctor checks the environment Gazelle runs in for common setup problems
+// and prints each one with a suggested fix. It checks the go command, the
+// module proxies it uses, the WORKSPACE and MODULE.bazel files, and the
+// .bazelignore file. An error is returned if any problems are found.
+func doctor(wd string, args []string) error {
+	fs := flag.NewFlagSet("gazelle", flag.ContinueOnError)
+	// Flag will call this on any parse error. Don't print usage unless
+	// -h or -help were passed explicitly.
+	fs.Usage = func() {}
+	var repoRoot, reportPath string
+	env := doctorEnv{}
+	fs.StringVar(&repoRoot, "repo_root", "", "path to the repository root directory. If unset, Gazelle searches for it from the working directory.")
+	fs.StringVar(&env.goTool, "go", "", "path to the go command. If unset, the go command in GOROOT or PATH is checked.")
+	fs.BoolVar(&env.offline, "offline", false, "when true, checks that need network access, like GOPROXY reachability, are skipped")
+	fs.StringVar(&reportPath, "report", "", "file to write the problems found to. If unset, they're printed to stdout.")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			doctorUsage(fs)
+			return err
+		}
+		// flag already prints the error; don't print it again.
+		return errors.New("Try -help for more information")
+	}
+	if len(fs.Args()) != 0 {
+		return fmt.Errorf("got %d positional arguments; wanted 0.\nTry -help for more information.", len(fs.Args()))
+	}
+
+	var problems []problem
+	if repoRoot == "" {
+		var err error
+		if repoRoot, err = wspace.FindRepoRoot(wd); err != nil {
+			repoRoot = wd
+			problems = append(problems, problem{
+				msg: "no WORKSPACE, WORKSPACE.bazel, or REPO.bazel file found in the working directory or its parents",
+				fix: "create an empty REPO.bazel file in the repository root, or run Gazelle with -repo_root",
+			})
+		}
+	} else if !filepath.IsAbs(repoRoot) {
+		repoRoot = filepath.Join(wd, repoRoot)
+	}
+	env.repoRoot = repoRoot
+	if env.goTool == "" {
+		env.goTool = findGoTool()
+	}
+
+	problems = append(problems, checkGo(env)...)
+	problems = append(problems, checkRepoFiles(env)...)
+	problems = append(problems, checkBazelIgnore(env)...)
+
+	var w io.Writer = os.Stdout
+	if reportPath != "" {
+		if !filepath.IsAbs(reportPath) {
+			reportPath = filepath.Join(wd, reportPath)
+		}
+		reportFile, err := os.Create(reportPath)
+		if err != nil {
+			return err
+		}
+		defer reportFile.Close()
+		w = reportFile
+	}
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "no problems found")
+		return nil
+	}
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+	if len(problems) == 1 {
+		return errors.New("found 1 problem")
+	}
+	return fmt.Errorf("found %d problems", len(problems))
+}
+
+// checkGo checks that the go command can be run, that it's new enough for
+// the go directive in the repository's go.mod file, and that the module
+// proxies it's configured with can be reached.
+func checkGo(env doctorEnv) []problem {
+	var problems []problem
+	goEnv := struct{ GOVERSION, GOPROXY string }{}
+	out, err := exec.Command(env.goTool, "env", "-json", "GOVERSION", "GOPROXY").Output()
+	if err == nil {
+		err = json.Unmarshal(out, &goEnv)
+	}
+	if err != nil {
+		problems = append(problems, problem{
+			msg: fmt.Sprintf("could not run %s: %v", env.goTool, err),
+			fix: "install Go from https://go.dev/dl, or set GOROOT to the Go installation to use. update-repos needs the go command to read go.mod files and look up modules.",
+		})
+		goEnv.GOPROXY = os.Getenv("GOPROXY")
+	} else if goVersion, ok := parseDoctorGoVersion(goEnv.GOVERSION); ok {
+		if p, ok := checkGoModVersion(env, goVersion); !ok {
+			problems = append(problems, p)
+		}
+	}
+	return append(problems, checkGoProxy(env, goEnv.GOPROXY)...)
+}
+
+// checkGoModVersion checks that goVersion is at least the version in the go
+// directive of the go.mod file in the repository root, if there is one.
+func checkGoModVersion(env doctorEnv, goVersion version.Version) (problem, bool) {
+	goModPath := filepath.Join(env.repoRoot, "go.mod")
+	data, err := os.ReadFile(goModPath)
+	if err != nil {
+		return problem{}, true
+	}
+	goMod, err := modfile.ParseLax(goModPath, data, nil)
+	if err != nil || goMod.Go == nil {
+		return problem{}, true
+	}
+	required, ok := parseDoctorGoVersion(goMod.Go.Version)
+	if !ok || required.Compare(goVersion) <= 0 {
+		return problem{}, true
+	}
+	return problem{
+		where: fmt.Sprintf("go.mod:%d", goMod.Go.Syntax.Start.Line),
+		msg:   fmt.Sprintf("go %s is required, but %s is go%s", required, env.goTool, goVersion),
+		fix:   fmt.Sprintf("install go%s or newer, or set GOTOOLCHAIN=auto so the go command downloads it", required),
+	}, false
+}
+
+// parseDoctorGoVersion parses a Go version like "go1.21.3" or "1.22rc1".
+// Pre-release suffixes are ignored, and missing components are 0.
+func parseDoctorGoVersion(s string) (version.Version, bool) {
+	s = strings.TrimPrefix(s, "go")
+	if i := strings.IndexFunc(s, func(r rune) bool { return r != '.' && (r < '0' || r > '9') }); i >= 0 {
+		s = s[:i]
+	}
+	v, err := version.ParseVersion(s)
+	if err != nil || len(v) < 2 {
+		return nil, false
+	}
+	for len(v) < 3 {
+		v = append(v, 0)
+	}
+	return v, true
+}
+
+// checkGoProxy checks that the module proxies in goproxy, a GOPROXY value,
+// can be reached. If goproxy is empty, the default proxy is checked.
+func checkGoProxy(env doctorEnv, goproxy string) []problem {
+	if goproxy == "" {
+		goproxy = "https://proxy.golang.org,direct"
+	}
+	var problems []problem
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, proxy := range strings.FieldsFunc(goproxy, func(r rune) bool { return r == ',' || r == '|' }) {
+		switch proxy {
+		case "direct":
+			continue
+		case "off":
+			problems = append(problems, problem{
+				msg: "GOPROXY is off, so modules can't be downloaded",
+				fix: "unset GOPROXY, or set it to a module proxy like https://proxy.golang.org",
+			})
+			continue
+		}
+		if env.offline || strings.HasPrefix(proxy, "file://") {
+			continue
+		}
+		resp, err := client.Head(strings.TrimSuffix(proxy, "/") + "/")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < http.StatusInternalServerError {
+				continue
+			}
+			err = errors.New(resp.Status)
+		}
+		problems = append(problems, problem{
+			msg: fmt.Sprintf("module proxy %s in GOPROXY can't be reached: %v", proxy, err),
+			fix: "check your network and proxy settings (HTTPS_PROXY), or set GOPROXY to a proxy you can reach",
+		})
+	}
+	return problems
+}
+
+// checkRepoFiles checks the WORKSPACE and MODULE.bazel files in the
+// repository root for inconsistencies: Go dependencies and Gazelle itself
+// declared in both, and Gazelle used in WORKSPACE without
+// gazelle_dependencies.
+func checkRepoFiles(env doctorEnv) []problem {
+	var problems []problem
+
+	var module *rule.File
+	modulePath := filepath.Join(env.repoRoot, "MODULE.bazel")
+	if data, err := os.ReadFile(modulePath); err == nil {
+		if module, err = loadModuleData(modulePath, data); err != nil {
+			problems = append(problems, problem{
+				where: "MODULE.bazel",
+				msg:   fmt.Sprintf("could not parse: %v", err),
+				fix:   "fix the syntax error",
+			})
+		}
+	}
+	var workspace *rule.File
+	workspacePath := wspace.FindWORKSPACEFile(env.repoRoot)
+	workspaceName := filepath.Base(workspacePath)
+	if _, err := os.Stat(workspacePath); err == nil {
+		if workspace, err = rule.LoadWorkspaceFile(workspacePath, ""); err != nil {
+			problems = append(problems, problem{
+				where: workspaceName,
+				msg:   fmt.Sprintf("could not parse: %v", err),
+				fix:   "fix the syntax error",
+			})
+		}
+	}
+	if workspace == nil {
+		return problems
+	}
+
+	hasGazelleDep, hasGoDeps := false, false
+	if module != nil {
+		for _, r := range module.Rules {
+			if r.Kind() == "bazel_dep" && r.Name() == "gazelle" {
+				hasGazelleDep = true
+			}
+			if strings.HasPrefix(r.Kind(), "go_deps.") {
+				hasGoDeps = true
+			}
+		}
+	}
+
+	if hasGoDeps {
+		repos, _, err := repo.ListRepositories(workspace)
+		if err == nil {
+			var names []string
+			for _, r := range repos {
+				if r.Kind() == "go_repository" && !repo.IsFromDirective(r) {
+					names = append(names, r.Name())
+				}
+			}
+			if len(names) > 0 {
+				problems = append(problems, problem{
+					where: workspaceName,
+					msg:   fmt.Sprintf("MODULE.bazel uses go_deps, but go_repository rules are also declared here: %s", strings.Join(names, ", ")),
+					fix:   "run gazelle migrate-workspace to move them to go_deps, so each module is only declared once",
+				})
+			}
+		}
+	}
+
+	usesGazelle, callsDeps := false, false
+	for _, l := range workspace.Loads {
+		if strings.HasPrefix(l.Name(), "@bazel_gazelle//") {
+			usesGazelle = true
+		}
+	}
+	for _, r := range workspace.Rules {
+		switch {
+		case r.Name() == "bazel_gazelle":
+			usesGazelle = true
+			if hasGazelleDep {
+				problems = append(problems, problem{
+					where: workspaceName,
+					msg:   "bazel_gazelle is declared here, and gazelle is also a bazel_dep in MODULE.bazel; the versions may differ",
+					fix:   "remove bazel_gazelle and gazelle_dependencies from " + workspaceName,
+				})
+			}
+		case r.Kind() == "gazelle_dependencies":
+			callsDeps = true
+		}
+	}
+	if usesGazelle && !callsDeps && !hasGazelleDep {
+		problems = append(problems, problem{
+			where: workspaceName,
+			msg:   "Gazelle is used, but gazelle_dependencies is not called, so repositories Gazelle needs are missing",
+			fix:   `add load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies") and call gazelle_dependencies() after go_register_toolchains()`,
+		})
+	}
+	return problems
+}
+
+// checkBazelIgnore checks the .bazelignore file in the repository root for
+// entries that have no effect: paths that don't exist, and glob patterns,
+// which Bazel doesn't support. Gazelle skips paths in .bazelignore, so
+// exclude directives in the root build file for the same paths are reported
+// as redundant.
+func checkBazelIgnore(env doctorEnv) []problem {
+	file, err := os.Open(filepath.Join(env.repoRoot, ".bazelignore"))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var problems []problem
+	ignored := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		ignore := strings.TrimSpace(scanner.Text())
+		if ignore == "" || strings.HasPrefix(ignore, "#") {
+			continue
+		}
+		where := fmt.Sprintf(".bazelignore:%d", line)
+		if strings.ContainsAny(ignore, "*?[") {
+			problems = append(problems, problem{
+				where: where,
+				msg:   fmt.Sprintf("%s is a glob pattern, which .bazelignore doesn't support", ignore),
+				fix:   "list each path separately, or use # gazelle:exclude in the root build file",
+			})
+			continue
+		}
+		ignore = path.Clean(ignore)
+		ignored[ignore] = true
+		if _, err := os.Lstat(filepath.Join(env.repoRoot, filepath.FromSlash(ignore))); os.IsNotExist(err) {
+			problems = append(problems, problem{
+				where: where,
+				msg:   fmt.Sprintf("%s does not exist", ignore),
+				fix:   "remove the stale entry",
+			})
+		}
+	}
+
+	for _, name := range []string{"BUILD.bazel", "BUILD"} {
+		buildPath := filepath.Join(env.repoRoot, name)
+		if _, err := os.Stat(buildPath); err != nil {
+			continue
+		}
+		f, err := rule.LoadFile(buildPath, "")
+		if err != nil {
+			break
+		}
+		for _, d := range f.Directives {
+			if d.Key == "exclude" && ignored[path.Clean(d.Value)] {
+				problems = append(problems, problem{
+					where: name,
+					msg:   fmt.Sprintf("# gazelle:exclude %s is redundant; %s is listed in .bazelignore, which Gazelle already skips", d.Value, d.Value),
+					fix:   "remove the directive",
+				})
+			}
+		}
+		break
+	}
+	return problems
+}
+
+// findGoTool returns the path of the go command. If GOROOT is set, the go
+// command there is preferred, since the wrapper script generated by the
+// gazelle rule sets it to the configured SDK. Otherwise, PATH is searched.
+func findGoTool() string {
+	p := "go"
+	if goroot, ok := os.LookupEnv("GOROOT"); ok {
+		p = filepath.Join(goroot, "bin", "go")
+	}
+	if runtime.GOOS == "windows" {
+		p += ".exe"
+	}
+	return p
+}
+
+func doctorUsage(fs *flag.FlagSet) {
+	fmt.Fprint(os.Stderr, `usage: gazelle doctor [flags...]
+
+The doctor command checks for common problems in the environment Gazelle
+runs in and prints each one with a suggested fix. It checks that:
+
+  * the go command can be run and is new enough for the go directive in
+    go.mod;
+  * the module proxies in GOPROXY can be reached;
+  * Go dependencies and Gazelle itself aren't declared in both WORKSPACE and
+    MODULE.bazel;
+  * gazelle_dependencies is called when Gazelle is used in WORKSPACE;
+  * entries in .bazelignore exist, aren't glob patterns, and aren't repeated
+    with # gazelle:exclude directives in the root build file.
+
+The command fails if any problems are found.
+
+FLAGS:
+
+`)
+	fs.PrintDefaults()
+}
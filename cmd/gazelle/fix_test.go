@@ -654,3 +654,120 @@ go_library(
 		})
 	}
 }
+
+func TestFix_PruneUnknownAttrs(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("//my:custom.bzl", "custom_library")
+
+go_library(
+    name = "repo",
+    srcs = ["lib.go"],
+    importpath = "example.com/repo",
+    # keep
+    legacy_mode = "a",
+    legacy_tags = ["b"],  # keep
+    macro_only = True,
+    tags = ["manual"],
+    visibility = ["//visibility:public"],
+)
+
+custom_library(
+    name = "custom",
+    macro_only = True,
+)
+`,
+		},
+		{
+			Path:    "lib.go",
+			Content: `package repo`,
+		},
+	})
+	defer cleanup()
+
+	if err := run(dir, []string{
+		"fix",
+		"-repo_root", dir,
+		"-go_prefix", "example.com/repo",
+		"-prune_unknown_attrs",
+		dir,
+	}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "BUILD.bazel",
+		Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("//my:custom.bzl", "custom_library")
+
+go_library(
+    name = "repo",
+    srcs = ["lib.go"],
+    importpath = "example.com/repo",
+    # keep
+    legacy_mode = "a",
+    legacy_tags = ["b"],  # keep
+    tags = ["manual"],
+    visibility = ["//visibility:public"],
+)
+
+custom_library(
+    name = "custom",
+    macro_only = True,
+)
+`,
+	}})
+}
+
+func TestFix_EmitBuildozerScript(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:map_kind go_library my_library //my:lib.bzl
+# gazelle:map_kind go_test my_test //my:lib.bzl
+
+go_library(
+    name = "repo",
+    srcs = ["lib.go"],
+    importpath = "example.com/repo",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+		{
+			Path:    "lib.go",
+			Content: `package repo`,
+		},
+		{
+			Path:    "lib_test.go",
+			Content: `package repo`,
+		},
+	})
+	defer cleanup()
+
+	scriptPath := filepath.Join(dir, "buildozer.txt")
+	if err := run(dir, []string{
+		"-repo_root", dir,
+		"-go_prefix", "example.com/repo",
+		"-emit_buildozer_script", scriptPath,
+		dir,
+	}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	// Only the existing go_library is changed; the go_test is new.
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "buildozer.txt",
+		Content: `new_load //my:lib.bzl my_library|//:__pkg__
+set kind my_library|//:repo
+fix unusedLoads|//:__pkg__
+`,
+	}})
+}
@@ -21,15 +21,22 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/internal/wspace"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/pkg/gazelle"
+	"github.com/bazelbuild/bazel-gazelle/rule"
 	"github.com/bazelbuild/bazel-gazelle/testtools"
 	"github.com/google/go-cmp/cmp"
 )
@@ -56,6 +63,11 @@ func TestHelp(t *testing.T) {
 		{"fix", "-h"},
 		{"update", "-h"},
 		{"update-repos", "-h"},
+		{"migrate-workspace", "-h"},
+		{"doctor", "-h"},
+		{"list-deps", "-h"},
+		{"kinds", "-h"},
+		{"explain", "-h"},
 	} {
 		t.Run(args[0], func(t *testing.T) {
 			if err := runGazelle(".", args); err == nil {
@@ -1457,1018 +1469,1074 @@ alias(
 	})
 }
 
-func TestUpdateReposWithQueryToWorkspace(t *testing.T) {
-	files := []testtools.FileSpec{
+func TestGoAliasDeprecationAndSunset(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path: "WORKSPACE",
-			Content: `
-load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+			Path: "BUILD.bazel",
+			Content: `# gazelle:prefix example.com/repo
+# gazelle:go_naming_convention import_alias
+# gazelle:go_alias_deprecation Use //foo instead.
+`,
+		},
+		{Path: "foo/foo.go", Content: "package foo\n"},
+		{
+			Path: "bar/BUILD.bazel",
+			Content: `sh_library(
+    name = "uses_old",
+    deps = ["//foo:go_default_library"],
+)
+`,
+		},
+	})
+	defer cleanup()
 
-http_archive(
-    name = "io_bazel_rules_go",
-    sha256 = "8df59f11fb697743cbb3f26cfb8750395f30471e9eabde0d174c3aebc7a1cd39",
-    urls = [
-        "https://storage.googleapis.com/bazel-mirror/github.com/bazelbuild/rules_go/releases/download/0.19.1/rules_go-0.19.1.tar.gz",
-        "https://github.com/bazelbuild/rules_go/releases/download/0.19.1/rules_go-0.19.1.tar.gz",
-    ],
+	withAlias := testtools.FileSpec{
+		Path: "foo/BUILD.bazel",
+		Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "foo",
+    srcs = ["foo.go"],
+    importpath = "example.com/repo/foo",
+    visibility = ["//visibility:public"],
 )
 
-http_archive(
-    name = "bazel_gazelle",
-    sha256 = "be9296bfd64882e3c08e3283c58fcb461fa6dd3c171764fcc4cf322f60615a9b",
-    urls = [
-        "https://storage.googleapis.com/bazel-mirror/github.com/bazelbuild/bazel-gazelle/releases/download/0.18.1/bazel-gazelle-0.18.1.tar.gz",
-        "https://github.com/bazelbuild/bazel-gazelle/releases/download/0.18.1/bazel-gazelle-0.18.1.tar.gz",
-    ],
+alias(
+    name = "go_default_library",
+    actual = ":foo",
+    deprecation = "Use //foo instead.",
+    visibility = ["//visibility:public"],
 )
+`,
+	}
+	if err := runGazelle(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{withAlias})
 
-load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
+	// With go_alias_sunset, the alias is kept while bar refers to it. The
+	// deprecation message already written isn't removed.
+	root := `# gazelle:prefix example.com/repo
+# gazelle:go_naming_convention import_alias
+# gazelle:go_alias_sunset true
+`
+	if err := os.WriteFile(filepath.Join(dir, "BUILD.bazel"), []byte(root), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGazelle(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{withAlias})
 
-go_rules_dependencies()
+	// Once nothing refers to it, the alias is deleted.
+	if err := os.Remove(filepath.Join(dir, "bar", "BUILD.bazel")); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGazelle(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "foo/BUILD.bazel",
+		Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-go_register_toolchains(nogo = "@bazel_gazelle//:nogo")
+go_library(
+    name = "foo",
+    srcs = ["foo.go"],
+    importpath = "example.com/repo/foo",
+    visibility = ["//visibility:public"],
+)
+`,
+	}})
+}
 
-load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
+func TestGoSelect(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path: "BUILD.bazel",
+			Content: `# gazelle:prefix example.com/sel
+# gazelle:go_select deps=off,srcs=on
+`,
+		},
+		{
+			Path: "sel.go",
+			Content: `package sel
 
-gazelle_dependencies()
+import _ "example.com/sel/common"
 `,
 		},
-	}
+		{
+			Path: "sel_linux.go",
+			Content: `package sel
 
-	dir, cleanup := testtools.CreateFiles(t, files)
+import _ "example.com/sel/linuxonly"
+`,
+		},
+		{Path: "common/common.go", Content: "package common\n"},
+		{Path: "linuxonly/linuxonly.go", Content: "package linuxonly\n"},
+	})
 	defer cleanup()
 
-	args := []string{"update-repos", "github.com/sirupsen/logrus@v1.3.0"}
-	if err := runGazelle(dir, args); err != nil {
+	if err := runGazelle(dir, nil); err != nil {
 		t.Fatal(err)
 	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "BUILD.bazel",
+		Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-	testtools.CheckFiles(t, dir, []testtools.FileSpec{
-		{
-			Path: "WORKSPACE",
-			Content: `
-load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
-
-http_archive(
-    name = "io_bazel_rules_go",
-    sha256 = "8df59f11fb697743cbb3f26cfb8750395f30471e9eabde0d174c3aebc7a1cd39",
-    urls = [
-        "https://storage.googleapis.com/bazel-mirror/github.com/bazelbuild/rules_go/releases/download/0.19.1/rules_go-0.19.1.tar.gz",
-        "https://github.com/bazelbuild/rules_go/releases/download/0.19.1/rules_go-0.19.1.tar.gz",
-    ],
-)
+# gazelle:prefix example.com/sel
+# gazelle:go_select deps=off,srcs=on
 
-http_archive(
-    name = "bazel_gazelle",
-    sha256 = "be9296bfd64882e3c08e3283c58fcb461fa6dd3c171764fcc4cf322f60615a9b",
-    urls = [
-        "https://storage.googleapis.com/bazel-mirror/github.com/bazelbuild/bazel-gazelle/releases/download/0.18.1/bazel-gazelle-0.18.1.tar.gz",
-        "https://github.com/bazelbuild/bazel-gazelle/releases/download/0.18.1/bazel-gazelle-0.18.1.tar.gz",
+go_library(
+    name = "sel",
+    srcs = [
+        "sel.go",
+    ] + select({
+        "@io_bazel_rules_go//go/platform:android": [
+            "sel_linux.go",
+        ],
+        "@io_bazel_rules_go//go/platform:linux": [
+            "sel_linux.go",
+        ],
+        "//conditions:default": [],
+    }),
+    importpath = "example.com/sel",
+    visibility = ["//visibility:public"],
+    deps = [
+        "//common",
+        "//linuxonly",
     ],
 )
-
-load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
-
-go_rules_dependencies()
-
-go_register_toolchains(nogo = "@bazel_gazelle//:nogo")
-
-load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies", "go_repository")
-
-go_repository(
-    name = "com_github_sirupsen_logrus",
-    importpath = "github.com/sirupsen/logrus",
-    sum = "h1:hI/7Q+DtNZ2kINb6qt/lS+IyXnHQe9e90POfeewL/ME=",
-    version = "v1.3.0",
-)
-
-gazelle_dependencies()
 `,
-		},
-	})
+	}})
 }
 
-func TestDeleteRulesInEmptyDir(t *testing.T) {
+func TestGoBuildTag(t *testing.T) {
 	files := []testtools.FileSpec{
 		{Path: "WORKSPACE"},
 		{
 			Path: "BUILD.bazel",
-			Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_binary")
+			Content: `# gazelle:prefix example.com/m
+# gazelle:go_build_tag enterprise=//build:enterprise
+`,
+		},
+		{Path: "lib.go", Content: "package m\n"},
+		{
+			Path: "ee.go",
+			Content: `//go:build enterprise
 
-go_library(
-    name = "go_default_library",
-    srcs = [
-        "bar.go",
-        "foo.go",
-    ],
-    importpath = "example.com/repo",
-    visibility = ["//visibility:private"],
-)
+package m
 
-go_binary(
-    name = "cmd",
-    embed = [":go_default_library"],
-    visibility = ["//visibility:public"],
-)
+import _ "example.com/m/ee"
 `,
 		},
+		{
+			Path: "oss.go",
+			Content: `//go:build !enterprise
+
+package m
+`,
+		},
+		{Path: "ee/ee.go", Content: "package ee\n"},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{"-go_prefix=example.com/repo"}
-	if err := runGazelle(dir, args); err != nil {
-		t.Fatal(err)
-	}
-
-	testtools.CheckFiles(t, dir, []testtools.FileSpec{
-		{
-			Path:    "BUILD.bazel",
-			Content: "",
-		},
-	})
-}
+	want := []testtools.FileSpec{{
+		Path: "BUILD.bazel",
+		Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-func TestFixWorkspaceWithoutGazelle(t *testing.T) {
-	files := []testtools.FileSpec{
-		{
-			Path: "WORKSPACE",
-			Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_repository")
+# gazelle:prefix example.com/m
+# gazelle:go_build_tag enterprise=//build:enterprise
 
-go_repository(
-    name = "com_example_repo",
-    importpath = "example.com/repo",
-    tag = "1.2.3",
+go_library(
+    name = "m",
+    srcs = [
+        "lib.go",
+    ] + select({
+        "//build:enterprise": [
+            "ee.go",
+        ],
+        "//conditions:default": [
+            "oss.go",
+        ],
+    }),
+    importpath = "example.com/m",
+    visibility = ["//visibility:public"],
+    deps = select({
+        "//build:enterprise": [
+            "//ee",
+        ],
+        "//conditions:default": [],
+    }),
 )
 `,
-		},
+	}}
+	if err := runGazelle(dir, nil); err != nil {
+		t.Fatal(err)
 	}
-	dir, cleanup := testtools.CreateFiles(t, files)
-	defer cleanup()
+	testtools.CheckFiles(t, dir, want)
 
-	if err := runGazelle(dir, []string{"fix", "-go_prefix="}); err == nil {
-		t.Error("got success; want error")
-	} else if want := "bazel_gazelle is not declared"; !strings.Contains(err.Error(), want) {
-		t.Errorf("got error %v; want error containing %q", err, want)
+	// The selects are merged with the existing rule on later runs.
+	if err := runGazelle(dir, nil); err != nil {
+		t.Fatal(err)
 	}
+	testtools.CheckFiles(t, dir, want)
 }
 
-// TestFixGazelle checks that loads of the gazelle macro from the old location
-// in rules_go are replaced with the new location in @bazel_gazelle.
-func TestFixGazelle(t *testing.T) {
+func TestGoTestNameAndSuite(t *testing.T) {
 	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path: "WORKSPACE",
-		}, {
 			Path: "BUILD.bazel",
-			Content: `
-load("@io_bazel_rules_go//go:def.bzl", "gazelle", "go_library")
-
-gazelle(name = "gazelle")
+			Content: `# gazelle:prefix example.com/m
+# gazelle:go_test_name {dirname}_unit_test
+# gazelle:go_test_suite {dirname}_tests
+# gazelle:go_test_tag_targets integration
+`,
+		},
+		{Path: "foo/foo.go", Content: "package foo\n"},
+		{Path: "foo/foo_test.go", Content: "package foo\n"},
+		{
+			Path: "foo/it_test.go",
+			Content: `//go:build integration
 
-# keep
-go_library(name = "go_default_library")
+package foo
 `,
 		},
+		{Path: "bar/bar.go", Content: "package bar\n"},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	if err := runGazelle(dir, nil); err != nil {
+	if err := runGazelle(dir, []string{"-go_naming_convention=import"}); err != nil {
 		t.Fatal(err)
 	}
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "BUILD.bazel",
-			Content: `
-load("@bazel_gazelle//:def.bzl", "gazelle")
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
+			Path: "foo/BUILD.bazel",
+			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
-gazelle(name = "gazelle")
+go_library(
+    name = "foo",
+    srcs = ["foo.go"],
+    importpath = "example.com/m/foo",
+    visibility = ["//visibility:public"],
+)
 
-# keep
-go_library(name = "go_default_library")
-`,
-		},
-	})
-}
+go_test(
+    name = "foo_unit_test",
+    srcs = ["foo_test.go"],
+    embed = [":foo"],
+)
 
-// TestKeepDeps checks rules with keep comments on the rule or on the deps
-// attribute will not be modified during dependency resolution. Verifies #212.
-func TestKeepDeps(t *testing.T) {
-	files := []testtools.FileSpec{
-		{
-			Path: "WORKSPACE",
-		}, {
-			Path: "BUILD.bazel",
-			Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
-
-# gazelle:prefix example.com/repo
+go_test(
+    name = "foo_unit_integration_test",
+    srcs = ["it_test.go"],
+    embed = [":foo"],
+    gotags = ["integration"],
+    tags = [
+        "integration",
+        "manual",
+    ],
+)
 
-# keep
-go_library(
-    name = "go_default_library",
-    srcs = ["lib.go"],
-    importpath = "example.com/repo",
-    deps = [":dont_remove"],
+test_suite(
+    name = "foo_tests",
+    tests = [
+        ":foo_unit_integration_test",
+        ":foo_unit_test",
+    ],
 )
+`,
+		},
+		{
+			Path: "bar/BUILD.bazel",
+			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-go_test(
-    name = "go_default_test",
-    # keep
-    srcs = ["lib_test.go"],
-    # keep
-    embed = [":go_default_library"],
-    # keep
-    deps = [":dont_remove"],
+go_library(
+    name = "bar",
+    srcs = ["bar.go"],
+    importpath = "example.com/m/bar",
+    visibility = ["//visibility:public"],
 )
 `,
 		},
-	}
-	dir, cleanup := testtools.CreateFiles(t, files)
-	defer cleanup()
+	})
 
-	if err := runGazelle(dir, nil); err != nil {
-		t.Fatal(err)
+	// The test_suite is deleted when the package has no more tests.
+	for _, name := range []string{"foo_test.go", "it_test.go"} {
+		if err := os.Remove(filepath.Join(dir, "foo", name)); err != nil {
+			t.Fatal(err)
+		}
 	}
-
-	testtools.CheckFiles(t, dir, files)
-}
-
-func TestDontCreateBuildFileInEmptyDir(t *testing.T) {
-	files := []testtools.FileSpec{
-		{Path: "WORKSPACE"},
-		{Path: "sub/"},
+	if err := runGazelle(dir, []string{"-go_naming_convention=import"}); err != nil {
+		t.Fatal(err)
 	}
-	dir, cleanup := testtools.CreateFiles(t, files)
-	defer cleanup()
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "foo/BUILD.bazel",
+		Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-	if err := runGazelle(dir, nil); err != nil {
-		t.Error(err)
-	}
-	for _, f := range []string{"BUILD.bazel", "sub/BUILD.bazel"} {
-		path := filepath.Join(dir, filepath.FromSlash(f))
-		_, err := os.Stat(path)
-		if err == nil {
-			t.Errorf("%s: build file was created", f)
-		}
-	}
+go_library(
+    name = "foo",
+    srcs = ["foo.go"],
+    importpath = "example.com/m/foo",
+    visibility = ["//visibility:public"],
+)
+`,
+	}})
 }
 
-// TestNoIndex checks that gazelle does not index existing or generated
-// library rules with the flag -index=false. Verifies #384.
-func TestNoIndex(t *testing.T) {
+func TestGoTestNameAddedToExistingPackage(t *testing.T) {
 	files := []testtools.FileSpec{
 		{Path: "WORKSPACE"},
 		{
-			Path: "foo/foo.go",
-			Content: `
-package foo
-
-import _ "example.com/bar"
+			Path: "BUILD.bazel",
+			Content: `# gazelle:prefix example.com/m
+# gazelle:go_test_name {dirname}_unit_test
+# gazelle:go_test_suite {dirname}_tests
 `,
 		},
 		{
-			Path:    "third_party/example.com/bar/bar.go",
-			Content: "package bar",
-		},
-		{
-			Path:    "third_party/BUILD.bazel",
-			Content: "# gazelle:prefix",
-		},
-		{
-			Path: "third_party/example.com/bar/BUILD.bazel",
-			Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
+			Path: "foo/BUILD.bazel",
+			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
 go_library(
-    name = "bar",
-    srcs = ["bar.go"],
-    importpath = "example.com/bar",
+    name = "foo",
+    srcs = ["foo.go"],
+    importpath = "example.com/m/foo",
     visibility = ["//visibility:public"],
 )
+
+go_test(
+    name = "foo_test",
+    srcs = [
+        "bar_test.go",
+        "foo_test.go",
+    ],
+    embed = [":foo"],
+)
+
+test_suite(
+    name = "foo_tests",
+    tests = [":foo_test"],
+)
 `,
 		},
+		{Path: "foo/foo.go", Content: "package foo\n"},
+		{Path: "foo/foo_test.go", Content: "package foo\n"},
+		{Path: "foo/bar_test.go", Content: "package foo\n"},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{
-		"-go_prefix=example.com/repo",
-		"-external=vendored",
-		"-index=false",
-	}
-	if err := runGazelle(dir, args); err != nil {
+	if err := runGazelle(dir, []string{"-go_naming_convention=import"}); err != nil {
 		t.Fatal(err)
 	}
-
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
 		Path: "foo/BUILD.bazel",
-		Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
+		Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
 go_library(
     name = "foo",
     srcs = ["foo.go"],
-    importpath = "example.com/repo/foo",
+    importpath = "example.com/m/foo",
     visibility = ["//visibility:public"],
-    deps = ["//vendor/example.com/bar"],
+)
+
+test_suite(
+    name = "foo_tests",
+    tests = [":foo_unit_test"],
+)
+
+go_test(
+    name = "foo_unit_test",
+    srcs = [
+        "bar_test.go",
+        "foo_test.go",
+    ],
+    embed = [":foo"],
 )
 `,
 	}})
 }
 
-// TestNoIndexNoRecurse checks that gazelle behaves correctly with the flags
-// -r=false -index=false. Gazelle should not generate build files in
-// subdirectories and should not resolve dependencies to local libraries.
-func TestNoIndexNoRecurse(t *testing.T) {
-	barBuildFile := testtools.FileSpec{
-		Path:    "foo/bar/BUILD.bazel",
-		Content: "# this should not be updated because -r=false",
-	}
+func TestGoFuzzTargetsDeleted(t *testing.T) {
 	files := []testtools.FileSpec{
 		{Path: "WORKSPACE"},
 		{
-			Path: "foo/foo.go",
-			Content: `package foo
-
-import (
-	_ "example.com/dep/baz"
-)
+			Path: "BUILD.bazel",
+			Content: `# gazelle:prefix example.com/m
+# gazelle:go_generate_fuzz_targets true
+# gazelle:map_kind go_test my_go_test //tools:go.bzl
 `,
 		},
-		barBuildFile,
-		{
-			Path:    "foo/bar/bar.go",
-			Content: "package bar",
-		},
+		{Path: "foo/foo.go", Content: "package foo\n"},
 		{
-			Path: "third_party/baz/BUILD.bazel",
-			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+			Path: "foo/foo_test.go",
+			Content: `package foo
 
-# this should be ignored because -index=false
-go_library(
-    name = "baz",
-    srcs = ["baz.go"],
-    importpath = "example.com/dep/baz",
-    visibility = ["//visibility:public"],
-)
+import "testing"
+
+func FuzzParse(f *testing.F) { helper(f) }
 `,
 		},
 		{
-			Path:    "third_party/baz/baz.go",
-			Content: "package baz",
+			Path: "foo/helper_test.go",
+			Content: `package foo
+
+import "testing"
+
+func helper(tb testing.TB) {}
+`,
 		},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{
-		"-go_prefix=example.com/repo",
-		"-external=vendored",
-		"-r=false",
-		"-index=false",
-		"foo",
-	}
+	args := []string{"-go_naming_convention=import"}
 	if err := runGazelle(dir, args); err != nil {
 		t.Fatal(err)
 	}
-
-	testtools.CheckFiles(t, dir, []testtools.FileSpec{
-		{
-			Path: "foo/BUILD.bazel",
-			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+	// The fuzz test is built from all the test files, so it may use helpers.
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "foo/BUILD.bazel",
+		Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("//tools:go.bzl", "my_go_test")
 
 go_library(
     name = "foo",
     srcs = ["foo.go"],
-    importpath = "example.com/repo/foo",
+    importpath = "example.com/m/foo",
     visibility = ["//visibility:public"],
-    deps = ["//vendor/example.com/dep/baz"],
 )
-`,
-		},
-		barBuildFile,
-	})
-}
-
-// TestNoIndexRecurse checks that gazelle behaves correctly with the flags
-// -r=true -index=false. Gazelle should generate build files in directories
-// and subdirectories, but should not resolve dependencies to local libraries.
-func TestNoIndexRecurse(t *testing.T) {
-	files := []testtools.FileSpec{
-		{Path: "WORKSPACE"}, {
-			Path: "foo/foo.go",
-			Content: `package foo
 
-import (
-	_ "example.com/dep/baz"
+my_go_test(
+    name = "foo_test",
+    srcs = [
+        "foo_test.go",
+        "helper_test.go",
+    ],
+    embed = [":foo"],
 )
-`,
-		}, {
-			Path:    "foo/bar/bar.go",
-			Content: "package bar",
-		}, {
-			Path: "third_party/baz/BUILD.bazel",
-			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-# this should be ignored because -index=false
-go_library(
-    name = "baz",
-    srcs = ["baz.go"],
-    importpath = "example.com/dep/baz",
-    visibility = ["//visibility:public"],
+my_go_test(
+    name = "fuzz_parse_test",
+    srcs = [
+        "foo_test.go",
+        "helper_test.go",
+    ],
+    args = ["-test.run=^FuzzParse$"],
+    embed = [":foo"],
 )
 `,
-		}, {
-			Path:    "third_party/baz/baz.go",
-			Content: "package baz",
-		},
-	}
-	dir, cleanup := testtools.CreateFiles(t, files)
-	defer cleanup()
+	}})
 
-	args := []string{
-		"-go_prefix=example.com/repo",
-		"-external=vendored",
-		"-r=true",
-		"-index=false",
-		"foo",
+	// The target for a fuzz function is deleted when the function is, even
+	// though its kind is mapped.
+	if err := os.WriteFile(filepath.Join(dir, "foo", "foo_test.go"), []byte("package foo\n"), 0o666); err != nil {
+		t.Fatal(err)
 	}
 	if err := runGazelle(dir, args); err != nil {
 		t.Fatal(err)
 	}
-
-	testtools.CheckFiles(t, dir, []testtools.FileSpec{
-		{
-			Path: "foo/BUILD.bazel",
-			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "foo/BUILD.bazel",
+		Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("//tools:go.bzl", "my_go_test")
 
 go_library(
     name = "foo",
     srcs = ["foo.go"],
-    importpath = "example.com/repo/foo",
+    importpath = "example.com/m/foo",
     visibility = ["//visibility:public"],
-    deps = ["//vendor/example.com/dep/baz"],
 )
-`,
-		}, {
-			Path: "foo/bar/BUILD.bazel",
-			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-go_library(
-    name = "bar",
-    srcs = ["bar.go"],
-    importpath = "example.com/repo/foo/bar",
-    visibility = ["//visibility:public"],
+my_go_test(
+    name = "foo_test",
+    srcs = [
+        "foo_test.go",
+        "helper_test.go",
+    ],
+    embed = [":foo"],
 )
+`,
+	}})
+}
+
+func TestGoFuzzTargetsKeptWithoutDirective(t *testing.T) {
+	// Without go_generate_fuzz_targets, a test that looks like a generated
+	// fuzz test was written by hand, so it's not deleted.
+	buildFile := `load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+
+go_library(
+    name = "foo",
+    srcs = ["foo.go"],
+    importpath = "example.com/m/foo",
+    visibility = ["//visibility:public"],
+)
+
+go_test(
+    name = "foo_test",
+    srcs = ["foo_test.go"],
+    embed = [":foo"],
+)
+
+go_test(
+    name = "fuzz_parse_test",
+    srcs = ["foo_test.go"],
+    args = ["-test.run=^FuzzParse$"],
+    embed = [":foo"],
+)
+`
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{Path: "BUILD.bazel", Content: "# gazelle:prefix example.com/m\n"},
+		{Path: "foo/BUILD.bazel", Content: buildFile},
+		{Path: "foo/foo.go", Content: "package foo\n"},
+		{
+			Path: "foo/foo_test.go",
+			Content: `package foo
+
+import "testing"
+
+func FuzzParse(f *testing.F) {}
 `,
 		},
-	})
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, []string{"-go_naming_convention=import"}); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{Path: "foo/BUILD.bazel", Content: buildFile}})
 }
 
-// TestSubdirectoryPrefixExternal checks that directives set in subdirectories
-// may be used in dependency resolution. Verifies #412.
-func TestSubdirectoryPrefixExternal(t *testing.T) {
+func TestUpdateReposWithQueryToWorkspace(t *testing.T) {
 	files := []testtools.FileSpec{
 		{
 			Path: "WORKSPACE",
-		}, {
-			Path:    "BUILD.bazel",
-			Content: "# gazelle:prefix",
-		}, {
-			Path:    "sub/BUILD.bazel",
-			Content: "# gazelle:prefix example.com/sub",
-		}, {
-			Path: "sub/sub.go",
 			Content: `
-package sub
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
 
-import (
-	_ "example.com/sub/missing"
-	_ "example.com/external"
+http_archive(
+    name = "io_bazel_rules_go",
+    sha256 = "8df59f11fb697743cbb3f26cfb8750395f30471e9eabde0d174c3aebc7a1cd39",
+    urls = [
+        "https://storage.googleapis.com/bazel-mirror/github.com/bazelbuild/rules_go/releases/download/0.19.1/rules_go-0.19.1.tar.gz",
+        "https://github.com/bazelbuild/rules_go/releases/download/0.19.1/rules_go-0.19.1.tar.gz",
+    ],
+)
+
+http_archive(
+    name = "bazel_gazelle",
+    sha256 = "be9296bfd64882e3c08e3283c58fcb461fa6dd3c171764fcc4cf322f60615a9b",
+    urls = [
+        "https://storage.googleapis.com/bazel-mirror/github.com/bazelbuild/bazel-gazelle/releases/download/0.18.1/bazel-gazelle-0.18.1.tar.gz",
+        "https://github.com/bazelbuild/bazel-gazelle/releases/download/0.18.1/bazel-gazelle-0.18.1.tar.gz",
+    ],
 )
+
+load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
+
+go_rules_dependencies()
+
+go_register_toolchains(nogo = "@bazel_gazelle//:nogo")
+
+load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
+
+gazelle_dependencies()
 `,
 		},
 	}
+
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	if err := runGazelle(dir, []string{"-external=vendored", "-index=false"}); err != nil {
+	args := []string{"update-repos", "github.com/sirupsen/logrus@v1.3.0"}
+	if err := runGazelle(dir, args); err != nil {
 		t.Fatal(err)
 	}
 
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "sub/BUILD.bazel",
+			Path: "WORKSPACE",
 			Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
 
-# gazelle:prefix example.com/sub
+http_archive(
+    name = "io_bazel_rules_go",
+    sha256 = "8df59f11fb697743cbb3f26cfb8750395f30471e9eabde0d174c3aebc7a1cd39",
+    urls = [
+        "https://storage.googleapis.com/bazel-mirror/github.com/bazelbuild/rules_go/releases/download/0.19.1/rules_go-0.19.1.tar.gz",
+        "https://github.com/bazelbuild/rules_go/releases/download/0.19.1/rules_go-0.19.1.tar.gz",
+    ],
+)
 
-go_library(
-    name = "sub",
-    srcs = ["sub.go"],
-    importpath = "example.com/sub",
-    visibility = ["//visibility:public"],
-    deps = [
-        "//sub/missing",
-        "//vendor/example.com/external",
+http_archive(
+    name = "bazel_gazelle",
+    sha256 = "be9296bfd64882e3c08e3283c58fcb461fa6dd3c171764fcc4cf322f60615a9b",
+    urls = [
+        "https://storage.googleapis.com/bazel-mirror/github.com/bazelbuild/bazel-gazelle/releases/download/0.18.1/bazel-gazelle-0.18.1.tar.gz",
+        "https://github.com/bazelbuild/bazel-gazelle/releases/download/0.18.1/bazel-gazelle-0.18.1.tar.gz",
     ],
 )
+
+load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
+
+go_rules_dependencies()
+
+go_register_toolchains(nogo = "@bazel_gazelle//:nogo")
+
+load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies", "go_repository")
+
+go_repository(
+    name = "com_github_sirupsen_logrus",
+    importpath = "github.com/sirupsen/logrus",
+    sum = "h1:hI/7Q+DtNZ2kINb6qt/lS+IyXnHQe9e90POfeewL/ME=",
+    version = "v1.3.0",
+)
+
+gazelle_dependencies()
 `,
 		},
 	})
 }
 
-func TestGoGrpcProtoFlag(t *testing.T) {
+func TestDeleteRulesInEmptyDir(t *testing.T) {
 	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path: "WORKSPACE",
-		}, {
 			Path: "BUILD.bazel",
 			Content: `
-load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
-load("@rules_proto//proto:defs.bzl", "proto_library")
-
-go_proto_library(
-    name = "foo_go_proto",
-    importpath = "example.com/repo/foo",
-    proto = ":foo_proto",
-    visibility = ["//visibility:public"],
-)
-
-proto_library(
-    name = "foo_proto",
-    srcs = ["foo.proto"],
-    visibility = ["//visibility:public"],
-)
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_binary")
 
 go_library(
     name = "go_default_library",
-    embed = [":foo_go_proto"],
-    importpath = "example.com/repo/foo",
+    srcs = [
+        "bar.go",
+        "foo.go",
+    ],
+    importpath = "example.com/repo",
+    visibility = ["//visibility:private"],
+)
+
+go_binary(
+    name = "cmd",
+    embed = [":go_default_library"],
     visibility = ["//visibility:public"],
 )
 `,
-		}, {
-			Path: "foo.proto",
-			Content: `
-syntax = "proto3";
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
 
-option go_package = "example.com/repo/foo";
+	args := []string{"-go_prefix=example.com/repo"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
 
-message Bar {};
-`,
-		}, {
-			Path: "service/BUILD.bazel",
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path:    "BUILD.bazel",
+			Content: "",
+		},
+	})
+}
+
+func TestFixWorkspaceWithoutGazelle(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
 			Content: `
-load("@rules_proto//proto:defs.bzl", "proto_library")
-load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("@io_bazel_rules_go//go:def.bzl", "go_repository")
 
-go_proto_library(
-    name = "service_go_proto",
-    compilers = ["@io_bazel_rules_go//proto:go_grpc"],
-    importpath = "example.com/repo/service",
-    proto = ":service_proto",
-    visibility = ["//visibility:public"],
+go_repository(
+    name = "com_example_repo",
+    importpath = "example.com/repo",
+    tag = "1.2.3",
 )
+`,
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
 
-proto_library(
-    name = "service_proto",
-    srcs = ["service.proto"],
-    visibility = ["//visibility:public"],
-)
+	if err := runGazelle(dir, []string{"fix", "-go_prefix="}); err == nil {
+		t.Error("got success; want error")
+	} else if want := "bazel_gazelle is not declared"; !strings.Contains(err.Error(), want) {
+		t.Errorf("got error %v; want error containing %q", err, want)
+	}
+}
 
-go_library(
-    name = "go_default_library",
-    embed = [":service_go_proto"],
-    importpath = "example.com/repo/service",
-    visibility = ["//visibility:public"],
-)
-`,
+// TestFixGazelle checks that loads of the gazelle macro from the old location
+// in rules_go are replaced with the new location in @bazel_gazelle.
+func TestFixGazelle(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
 		}, {
-			Path: "service/service.proto",
+			Path: "BUILD.bazel",
 			Content: `
-syntax = "proto3";
+load("@io_bazel_rules_go//go:def.bzl", "gazelle", "go_library")
 
-option go_package = "example.com/repo/service";
+gazelle(name = "gazelle")
 
-service TestService {}
+# keep
+go_library(name = "go_default_library")
 `,
 		},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{"update", "-go_grpc_compiler", "//foo", "-go_proto_compiler", "//bar"}
-	if err := runGazelle(dir, args); err != nil {
+	if err := runGazelle(dir, nil); err != nil {
 		t.Fatal(err)
 	}
-
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
 			Path: "BUILD.bazel",
 			Content: `
+load("@bazel_gazelle//:def.bzl", "gazelle")
 load("@io_bazel_rules_go//go:def.bzl", "go_library")
-load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
-load("@rules_proto//proto:defs.bzl", "proto_library")
 
-go_proto_library(
-    name = "foo_go_proto",
-    compilers = ["//bar"],
-    importpath = "example.com/repo/foo",
-    proto = ":foo_proto",
-    visibility = ["//visibility:public"],
-)
-
-proto_library(
-    name = "foo_proto",
-    srcs = ["foo.proto"],
-    visibility = ["//visibility:public"],
-)
+gazelle(name = "gazelle")
 
-go_library(
-    name = "go_default_library",
-    embed = [":foo_go_proto"],
-    importpath = "example.com/repo/foo",
-    visibility = ["//visibility:public"],
-)
+# keep
+go_library(name = "go_default_library")
 `,
 		},
+	})
+}
+
+// TestKeepDeps checks rules with keep comments on the rule or on the deps
+// attribute will not be modified during dependency resolution. Verifies #212.
+func TestKeepDeps(t *testing.T) {
+	files := []testtools.FileSpec{
 		{
-			Path: "service/BUILD.bazel",
+			Path: "WORKSPACE",
+		}, {
+			Path: "BUILD.bazel",
 			Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
-load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
-load("@rules_proto//proto:defs.bzl", "proto_library")
-
-go_proto_library(
-    name = "service_go_proto",
-    compilers = ["//foo"],
-    importpath = "example.com/repo/service",
-    proto = ":service_proto",
-    visibility = ["//visibility:public"],
-)
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
-proto_library(
-    name = "service_proto",
-    srcs = ["service.proto"],
-    visibility = ["//visibility:public"],
-)
+# gazelle:prefix example.com/repo
 
+# keep
 go_library(
     name = "go_default_library",
-    embed = [":service_go_proto"],
-    importpath = "example.com/repo/service",
-    visibility = ["//visibility:public"],
+    srcs = ["lib.go"],
+    importpath = "example.com/repo",
+    deps = [":dont_remove"],
+)
+
+go_test(
+    name = "go_default_test",
+    # keep
+    srcs = ["lib_test.go"],
+    # keep
+    embed = [":go_default_library"],
+    # keep
+    deps = [":dont_remove"],
 )
 `,
 		},
-	})
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, files)
 }
 
-// TestMapKind tests the gazelle:map_kind directive.
-// Verifies #448
-func TestMapKind(t *testing.T) {
+func TestDontCreateBuildFileInEmptyDir(t *testing.T) {
 	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{Path: "sub/"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, nil); err != nil {
+		t.Error(err)
+	}
+	for _, f := range []string{"BUILD.bazel", "sub/BUILD.bazel"} {
+		path := filepath.Join(dir, filepath.FromSlash(f))
+		_, err := os.Stat(path)
+		if err == nil {
+			t.Errorf("%s: build file was created", f)
+		}
+	}
+}
+
+// TestNoIndex checks that gazelle does not index existing or generated
+// library rules with the flag -index=false. Verifies #384.
+func TestNoIndex(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path: "WORKSPACE",
-		},
-		{
-			Path: "BUILD.bazel",
+			Path: "foo/foo.go",
 			Content: `
-# gazelle:prefix example.com/mapkind
-# gazelle:go_naming_convention go_default_library
+package foo
+
+import _ "example.com/bar"
 `,
 		},
 		{
-			Path:    "root_lib.go",
-			Content: `package mapkind`,
-		},
-		{
-			Path:    "enabled/BUILD.bazel",
-			Content: "# gazelle:map_kind go_library my_library //tools/go:def.bzl",
-		},
-		{
-			Path:    "enabled/enabled_lib.go",
-			Content: `package enabled`,
-		},
-		{
-			Path: "enabled/inherited/BUILD.bazel",
+			Path:    "third_party/example.com/bar/bar.go",
+			Content: "package bar",
 		},
 		{
-			Path:    "enabled/inherited/inherited_lib.go",
-			Content: `package inherited`,
+			Path:    "third_party/BUILD.bazel",
+			Content: "# gazelle:prefix",
 		},
 		{
-			Path: "enabled/existing_rules/mapped/BUILD.bazel",
+			Path: "third_party/example.com/bar/BUILD.bazel",
 			Content: `
-load("//tools/go:def.bzl", "my_library")
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-# An existing rule with a mapped type is updated
-my_library(
-    name = "go_default_library",
-    srcs = ["deleted_file.go", "mapped_lib.go"],
-    importpath = "example.com/mapkind/enabled/existing_rules/mapped",
+go_library(
+    name = "bar",
+    srcs = ["bar.go"],
+    importpath = "example.com/bar",
     visibility = ["//visibility:public"],
 )
 `,
 		},
-		{
-			Path:    "enabled/existing_rules/mapped/mapped_lib.go",
-			Content: `package mapped`,
-		},
-		{
-			Path:    "enabled/existing_rules/mapped/mapped_lib2.go",
-			Content: `package mapped`,
-		},
-		{
-			Path: "enabled/existing_rules/unmapped/BUILD.bazel",
-			Content: `
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{
+		"-go_prefix=example.com/repo",
+		"-external=vendored",
+		"-index=false",
+	}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "foo/BUILD.bazel",
+		Content: `
 load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-# An existing rule with an unmapped type is updated
 go_library(
-    name = "go_default_library",
-    srcs = ["unmapped_lib.go"],
-    importpath = "example.com/mapkind/enabled/existing_rules/unmapped",
+    name = "foo",
+    srcs = ["foo.go"],
+    importpath = "example.com/repo/foo",
     visibility = ["//visibility:public"],
+    deps = ["//vendor/example.com/bar"],
 )
 `,
-		},
-		{
-			Path:    "enabled/existing_rules/unmapped/unmapped_lib.go",
-			Content: `package unmapped`,
-		},
-		{
-			Path: "enabled/existing_rules/clean/BUILD.bazel",
-			Content: `load("//tools/go:def.bzl", "my_go_library")
+	}})
+}
 
-# gazelle:go_naming_convention import
-# gazelle:map_kind go_library my_go_library //tools/go:def.bzl
+// TestNoIndexNoRecurse checks that gazelle behaves correctly with the flags
+// -r=false -index=false. Gazelle should not generate build files in
+// subdirectories and should not resolve dependencies to local libraries.
+func TestNoIndexNoRecurse(t *testing.T) {
+	barBuildFile := testtools.FileSpec{
+		Path:    "foo/bar/BUILD.bazel",
+		Content: "# this should not be updated because -r=false",
+	}
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path: "foo/foo.go",
+			Content: `package foo
 
-my_go_library(
-    name = "clean",
-    srcs = [
-        "foo.go",
-        "bar.go",
-        "buz.go",
-    ],
-    importpath = "example.com/mapkind/enabled/existing_rules/clean",
-    visibility = ["//visibility:private"],
+import (
+	_ "example.com/dep/baz"
 )
 `,
 		},
+		barBuildFile,
 		{
-			Path: "enabled/existing_rules/clean_binary/BUILD.bazel",
-			Content: `load("//tools/go:def.bzl", "my_go_binary", "my_go_library")
-
-# gazelle:go_naming_convention import
-# gazelle:map_kind go_binary my_go_binary //tools/go:def.bzl
-# gazelle:map_kind go_library my_go_library //tools/go:def.bzl
-
-my_go_library(
-    name = "clean_binary_lib",
-    srcs = ["main.go"],
-    importpath = "example.com/mapkind/enabled/existing_rules/clean_binary",
-    visibility = ["//visibility:private"],
-)
+			Path:    "foo/bar/bar.go",
+			Content: "package bar",
+		},
+		{
+			Path: "third_party/baz/BUILD.bazel",
+			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-my_go_binary(
-    name = "clean_binary",
-    embed = [":clean_binary_lib"],
+# this should be ignored because -index=false
+go_library(
+    name = "baz",
+    srcs = ["baz.go"],
+    importpath = "example.com/dep/baz",
     visibility = ["//visibility:public"],
 )
 `,
 		},
 		{
-			Path:    "enabled/existing_rules/nobuild/nobuild_lib.go",
-			Content: `package nobuild`,
-		},
-		{
-			Path:    "enabled/overridden/BUILD.bazel",
-			Content: "# gazelle:map_kind go_library overridden_library //tools/overridden:def.bzl",
-		},
-		{
-			Path:    "enabled/overridden/overridden_lib.go",
-			Content: `package overridden`,
-		},
-		{
-			Path: "disabled/BUILD.bazel",
-		},
-		{
-			Path:    "disabled/disabled_lib.go",
-			Content: `package disabled`,
-		},
-		{
-			Path: "enabled/multiple_mappings/BUILD.bazel",
-			Content: `
-# gazelle:map_kind go_binary go_binary //tools/go:def.bzl
-# gazelle:map_kind go_library go_library //tools/go:def.bzl
-`,
-		},
-		{
-			Path: "enabled/multiple_mappings/multiple_mappings.go",
-			Content: `
-package main
-
-func main() {}`,
-		},
-		{
-			Path: "depend_on_mapped_kind/lib.go",
-			Content: `package depend_on_mapped_kind
-import (
-	_ "example.com/mapkind/disabled"
-	_ "example.com/mapkind/enabled"
-	_ "example.com/mapkind/enabled/existing_rules/mapped"
-	_ "example.com/mapkind/enabled/existing_rules/unmapped"
-	_ "example.com/mapkind/enabled/overridden"
-)`,
+			Path:    "third_party/baz/baz.go",
+			Content: "package baz",
 		},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	if err := runGazelle(dir, []string{"-external=vendored"}); err != nil {
+	args := []string{
+		"-go_prefix=example.com/repo",
+		"-external=vendored",
+		"-r=false",
+		"-index=false",
+		"foo",
+	}
+	if err := runGazelle(dir, args); err != nil {
 		t.Fatal(err)
 	}
 
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "BUILD.bazel",
-			Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
-
-# gazelle:prefix example.com/mapkind
-# gazelle:go_naming_convention go_default_library
+			Path: "foo/BUILD.bazel",
+			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
 go_library(
-    name = "go_default_library",
-    srcs = ["root_lib.go"],
-    importpath = "example.com/mapkind",
+    name = "foo",
+    srcs = ["foo.go"],
+    importpath = "example.com/repo/foo",
     visibility = ["//visibility:public"],
+    deps = ["//vendor/example.com/dep/baz"],
 )
 `,
 		},
-		{
-			Path: "enabled/BUILD.bazel",
-			Content: `
-load("//tools/go:def.bzl", "my_library")
+		barBuildFile,
+	})
+}
 
-# gazelle:map_kind go_library my_library //tools/go:def.bzl
+// TestNoIndexRecurse checks that gazelle behaves correctly with the flags
+// -r=true -index=false. Gazelle should generate build files in directories
+// and subdirectories, but should not resolve dependencies to local libraries.
+func TestNoIndexRecurse(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"}, {
+			Path: "foo/foo.go",
+			Content: `package foo
 
-my_library(
-    name = "go_default_library",
-    srcs = ["enabled_lib.go"],
-    importpath = "example.com/mapkind/enabled",
-    visibility = ["//visibility:public"],
+import (
+	_ "example.com/dep/baz"
 )
 `,
-		},
-		{
-			Path: "enabled/inherited/BUILD.bazel",
-			Content: `
-load("//tools/go:def.bzl", "my_library")
+		}, {
+			Path:    "foo/bar/bar.go",
+			Content: "package bar",
+		}, {
+			Path: "third_party/baz/BUILD.bazel",
+			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-my_library(
-    name = "go_default_library",
-    srcs = ["inherited_lib.go"],
-    importpath = "example.com/mapkind/enabled/inherited",
+# this should be ignored because -index=false
+go_library(
+    name = "baz",
+    srcs = ["baz.go"],
+    importpath = "example.com/dep/baz",
     visibility = ["//visibility:public"],
 )
 `,
+		}, {
+			Path:    "third_party/baz/baz.go",
+			Content: "package baz",
 		},
-		{
-			Path: "enabled/overridden/BUILD.bazel",
-			Content: `
-load("//tools/overridden:def.bzl", "overridden_library")
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
 
-# gazelle:map_kind go_library overridden_library //tools/overridden:def.bzl
+	args := []string{
+		"-go_prefix=example.com/repo",
+		"-external=vendored",
+		"-r=true",
+		"-index=false",
+		"foo",
+	}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
 
-overridden_library(
-    name = "go_default_library",
-    srcs = ["overridden_lib.go"],
-    importpath = "example.com/mapkind/enabled/overridden",
-    visibility = ["//visibility:public"],
-)
-`,
-		},
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "disabled/BUILD.bazel",
-			Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
+			Path: "foo/BUILD.bazel",
+			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
 go_library(
-    name = "go_default_library",
-    srcs = ["disabled_lib.go"],
-    importpath = "example.com/mapkind/disabled",
+    name = "foo",
+    srcs = ["foo.go"],
+    importpath = "example.com/repo/foo",
     visibility = ["//visibility:public"],
+    deps = ["//vendor/example.com/dep/baz"],
 )
 `,
-		},
-		{
-			Path: "enabled/existing_rules/mapped/BUILD.bazel",
-			Content: `
-load("//tools/go:def.bzl", "my_library")
+		}, {
+			Path: "foo/bar/BUILD.bazel",
+			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-# An existing rule with a mapped type is updated
-my_library(
-    name = "go_default_library",
-    srcs = [
-        "mapped_lib.go",
-        "mapped_lib2.go",
-    ],
-    importpath = "example.com/mapkind/enabled/existing_rules/mapped",
+go_library(
+    name = "bar",
+    srcs = ["bar.go"],
+    importpath = "example.com/repo/foo/bar",
     visibility = ["//visibility:public"],
 )
 `,
 		},
-		{
-			Path: "enabled/existing_rules/unmapped/BUILD.bazel",
-			Content: `
-load("//tools/go:def.bzl", "my_library")
+	})
+}
 
-# An existing rule with an unmapped type is updated
-my_library(
-    name = "go_default_library",
-    srcs = ["unmapped_lib.go"],
-    importpath = "example.com/mapkind/enabled/existing_rules/unmapped",
-    visibility = ["//visibility:public"],
-)
-`,
-		},
-		{
-			Path: "enabled/existing_rules/clean/BUILD.bazel",
-			Content: `
-# gazelle:go_naming_convention import
-# gazelle:map_kind go_library my_go_library //tools/go:def.bzl
-`,
-		},
-		{
-			Path: "enabled/existing_rules/clean_binary/BUILD.bazel",
-			Content: `
-# gazelle:go_naming_convention import
-# gazelle:map_kind go_binary my_go_binary //tools/go:def.bzl
-# gazelle:map_kind go_library my_go_library //tools/go:def.bzl
-`,
-		},
+// TestSubdirectoryPrefixExternal checks that directives set in subdirectories
+// may be used in dependency resolution. Verifies #412.
+func TestSubdirectoryPrefixExternal(t *testing.T) {
+	files := []testtools.FileSpec{
 		{
-			Path: "enabled/existing_rules/nobuild/BUILD.bazel",
+			Path: "WORKSPACE",
+		}, {
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix",
+		}, {
+			Path:    "sub/BUILD.bazel",
+			Content: "# gazelle:prefix example.com/sub",
+		}, {
+			Path: "sub/sub.go",
 			Content: `
-load("//tools/go:def.bzl", "my_library")
+package sub
 
-my_library(
-    name = "go_default_library",
-    srcs = ["nobuild_lib.go"],
-    importpath = "example.com/mapkind/enabled/existing_rules/nobuild",
-    visibility = ["//visibility:public"],
+import (
+	_ "example.com/sub/missing"
+	_ "example.com/external"
 )
 `,
 		},
-		{
-			Path: "enabled/multiple_mappings/BUILD.bazel",
-			Content: `
-load("//tools/go:def.bzl", "go_binary", "go_library")
-
-# gazelle:map_kind go_binary go_binary //tools/go:def.bzl
-# gazelle:map_kind go_library go_library //tools/go:def.bzl
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
 
-go_library(
-    name = "go_default_library",
-    srcs = ["multiple_mappings.go"],
-    importpath = "example.com/mapkind/enabled/multiple_mappings",
-    visibility = ["//visibility:private"],
-)
+	if err := runGazelle(dir, []string{"-external=vendored", "-index=false"}); err != nil {
+		t.Fatal(err)
+	}
 
-go_binary(
-    name = "multiple_mappings",
-    embed = [":go_default_library"],
-    visibility = ["//visibility:public"],
-)
-`,
-		},
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "depend_on_mapped_kind/BUILD.bazel",
+			Path: "sub/BUILD.bazel",
 			Content: `
 load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
+# gazelle:prefix example.com/sub
+
 go_library(
-    name = "go_default_library",
-    srcs = ["lib.go"],
-    importpath = "example.com/mapkind/depend_on_mapped_kind",
+    name = "sub",
+    srcs = ["sub.go"],
+    importpath = "example.com/sub",
     visibility = ["//visibility:public"],
     deps = [
-        "//disabled:go_default_library",
-        "//enabled:go_default_library",
-        "//enabled/existing_rules/mapped:go_default_library",
-        "//enabled/existing_rules/unmapped:go_default_library",
-        "//enabled/overridden:go_default_library",
+        "//sub/missing",
+        "//vendor/example.com/external",
     ],
 )
 `,
@@ -2476,650 +2544,4531 @@ go_library(
 	})
 }
 
-func TestMapKindEdgeCases(t *testing.T) {
-	for name, tc := range map[string]struct {
-		before []testtools.FileSpec
-		after  []testtools.FileSpec
-	}{
-		"new generated rule applies map_kind": {
-			before: []testtools.FileSpec{
-				{
-					Path: "WORKSPACE",
-				},
-				{
-					Path: "BUILD.bazel",
-					Content: `# gazelle:prefix example.com/mapkind
-# gazelle:go_naming_convention go_default_library
-# gazelle:map_kind go_library go_library //custom:def.bzl
-`,
-				},
-				{
-					Path:    "dir/file.go",
-					Content: "package dir",
-				},
-			},
-			after: []testtools.FileSpec{
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("//custom:def.bzl", "go_library")
+func TestGoGrpcProtoFlag(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+		}, {
+			Path: "BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("@rules_proto//proto:defs.bzl", "proto_library")
+
+go_proto_library(
+    name = "foo_go_proto",
+    importpath = "example.com/repo/foo",
+    proto = ":foo_proto",
+    visibility = ["//visibility:public"],
+)
+
+proto_library(
+    name = "foo_proto",
+    srcs = ["foo.proto"],
+    visibility = ["//visibility:public"],
+)
 
 go_library(
     name = "go_default_library",
-    srcs = ["file.go"],
-    importpath = "example.com/mapkind/dir",
+    embed = [":foo_go_proto"],
+    importpath = "example.com/repo/foo",
     visibility = ["//visibility:public"],
 )
 `,
-				},
-			},
-		},
-		"existing generated rule with non-renaming mapping applied applies map_kind": {
-			before: []testtools.FileSpec{
-				{
-					Path: "WORKSPACE",
-				},
-				{
-					Path: "BUILD.bazel",
-					Content: `# gazelle:prefix example.com/mapkind
-# gazelle:go_naming_convention go_default_library
-# gazelle:map_kind go_library go_library //custom:def.bzl
+		}, {
+			Path: "foo.proto",
+			Content: `
+syntax = "proto3";
+
+option go_package = "example.com/repo/foo";
+
+message Bar {};
 `,
-				},
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("//custom:def.bzl", "go_library")
+		}, {
+			Path: "service/BUILD.bazel",
+			Content: `
+load("@rules_proto//proto:defs.bzl", "proto_library")
+load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-go_library(
-    name = "go_default_library",
-    srcs = ["file.go"],
-    importpath = "example.com/mapkind/dir",
+go_proto_library(
+    name = "service_go_proto",
+    compilers = ["@io_bazel_rules_go//proto:go_grpc"],
+    importpath = "example.com/repo/service",
+    proto = ":service_proto",
+    visibility = ["//visibility:public"],
+)
+
+proto_library(
+    name = "service_proto",
+    srcs = ["service.proto"],
     visibility = ["//visibility:public"],
 )
-`,
-				},
-				{
-					Path:    "dir/file.go",
-					Content: "package dir",
-				},
-			},
-			after: []testtools.FileSpec{
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("//custom:def.bzl", "go_library")
 
 go_library(
     name = "go_default_library",
-    srcs = ["file.go"],
-    importpath = "example.com/mapkind/dir",
+    embed = [":service_go_proto"],
+    importpath = "example.com/repo/service",
     visibility = ["//visibility:public"],
 )
 `,
-				},
-			},
-		},
-		"existing generated rule without non-renaming mapping applied applies map_kind": {
-			before: []testtools.FileSpec{
-				{
-					Path: "WORKSPACE",
-				},
-				{
-					Path: "BUILD.bazel",
-					Content: `# gazelle:prefix example.com/mapkind
-# gazelle:go_naming_convention go_default_library
-# gazelle:map_kind go_library go_library //custom:def.bzl
+		}, {
+			Path: "service/service.proto",
+			Content: `
+syntax = "proto3";
+
+option go_package = "example.com/repo/service";
+
+service TestService {}
 `,
-				},
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update", "-go_grpc_compiler", "//foo", "-go_proto_compiler", "//bar"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
+load("@rules_proto//proto:defs.bzl", "proto_library")
+
+go_proto_library(
+    name = "foo_go_proto",
+    compilers = ["//bar"],
+    importpath = "example.com/repo/foo",
+    proto = ":foo_proto",
+    visibility = ["//visibility:public"],
+)
+
+proto_library(
+    name = "foo_proto",
+    srcs = ["foo.proto"],
+    visibility = ["//visibility:public"],
+)
 
 go_library(
     name = "go_default_library",
-    srcs = ["file.go"],
-    importpath = "example.com/mapkind/dir",
+    embed = [":foo_go_proto"],
+    importpath = "example.com/repo/foo",
     visibility = ["//visibility:public"],
 )
 `,
-				},
-				{
-					Path:    "dir/file.go",
-					Content: "package dir",
-				},
-			},
-			after: []testtools.FileSpec{
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("//custom:def.bzl", "go_library")
+		},
+		{
+			Path: "service/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
+load("@rules_proto//proto:defs.bzl", "proto_library")
+
+go_proto_library(
+    name = "service_go_proto",
+    compilers = ["//foo"],
+    importpath = "example.com/repo/service",
+    proto = ":service_proto",
+    visibility = ["//visibility:public"],
+)
+
+proto_library(
+    name = "service_proto",
+    srcs = ["service.proto"],
+    visibility = ["//visibility:public"],
+)
 
 go_library(
     name = "go_default_library",
-    srcs = ["file.go"],
-    importpath = "example.com/mapkind/dir",
+    embed = [":service_go_proto"],
+    importpath = "example.com/repo/service",
     visibility = ["//visibility:public"],
 )
 `,
-				},
-			},
 		},
-		"existing generated rule without renaming mapping applied applies map_kind": {
-			before: []testtools.FileSpec{
-				{
-					Path: "WORKSPACE",
-				},
-				{
-					Path: "BUILD.bazel",
-					Content: `# gazelle:prefix example.com/mapkind
+	})
+}
+
+// TestMapKind tests the gazelle:map_kind directive.
+// Verifies #448
+func TestMapKind(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+		},
+		{
+			Path: "BUILD.bazel",
+			Content: `
+# gazelle:prefix example.com/mapkind
 # gazelle:go_naming_convention go_default_library
-# gazelle:map_kind go_library custom_go_library //custom:def.bzl
 `,
-				},
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+		},
+		{
+			Path:    "root_lib.go",
+			Content: `package mapkind`,
+		},
+		{
+			Path:    "enabled/BUILD.bazel",
+			Content: "# gazelle:map_kind go_library my_library //tools/go:def.bzl",
+		},
+		{
+			Path:    "enabled/enabled_lib.go",
+			Content: `package enabled`,
+		},
+		{
+			Path: "enabled/inherited/BUILD.bazel",
+		},
+		{
+			Path:    "enabled/inherited/inherited_lib.go",
+			Content: `package inherited`,
+		},
+		{
+			Path: "enabled/existing_rules/mapped/BUILD.bazel",
+			Content: `
+load("//tools/go:def.bzl", "my_library")
+
+# An existing rule with a mapped type is updated
+my_library(
+    name = "go_default_library",
+    srcs = ["deleted_file.go", "mapped_lib.go"],
+    importpath = "example.com/mapkind/enabled/existing_rules/mapped",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+		{
+			Path:    "enabled/existing_rules/mapped/mapped_lib.go",
+			Content: `package mapped`,
+		},
+		{
+			Path:    "enabled/existing_rules/mapped/mapped_lib2.go",
+			Content: `package mapped`,
+		},
+		{
+			Path: "enabled/existing_rules/unmapped/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# An existing rule with an unmapped type is updated
+go_library(
+    name = "go_default_library",
+    srcs = ["unmapped_lib.go"],
+    importpath = "example.com/mapkind/enabled/existing_rules/unmapped",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+		{
+			Path:    "enabled/existing_rules/unmapped/unmapped_lib.go",
+			Content: `package unmapped`,
+		},
+		{
+			Path: "enabled/existing_rules/clean/BUILD.bazel",
+			Content: `load("//tools/go:def.bzl", "my_go_library")
+
+# gazelle:go_naming_convention import
+# gazelle:map_kind go_library my_go_library //tools/go:def.bzl
+
+my_go_library(
+    name = "clean",
+    srcs = [
+        "foo.go",
+        "bar.go",
+        "buz.go",
+    ],
+    importpath = "example.com/mapkind/enabled/existing_rules/clean",
+    visibility = ["//visibility:private"],
+)
+`,
+		},
+		{
+			Path: "enabled/existing_rules/clean_binary/BUILD.bazel",
+			Content: `load("//tools/go:def.bzl", "my_go_binary", "my_go_library")
+
+# gazelle:go_naming_convention import
+# gazelle:map_kind go_binary my_go_binary //tools/go:def.bzl
+# gazelle:map_kind go_library my_go_library //tools/go:def.bzl
+
+my_go_library(
+    name = "clean_binary_lib",
+    srcs = ["main.go"],
+    importpath = "example.com/mapkind/enabled/existing_rules/clean_binary",
+    visibility = ["//visibility:private"],
+)
+
+my_go_binary(
+    name = "clean_binary",
+    embed = [":clean_binary_lib"],
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+		{
+			Path:    "enabled/existing_rules/nobuild/nobuild_lib.go",
+			Content: `package nobuild`,
+		},
+		{
+			Path:    "enabled/overridden/BUILD.bazel",
+			Content: "# gazelle:map_kind go_library overridden_library //tools/overridden:def.bzl",
+		},
+		{
+			Path:    "enabled/overridden/overridden_lib.go",
+			Content: `package overridden`,
+		},
+		{
+			Path: "disabled/BUILD.bazel",
+		},
+		{
+			Path:    "disabled/disabled_lib.go",
+			Content: `package disabled`,
+		},
+		{
+			Path: "enabled/multiple_mappings/BUILD.bazel",
+			Content: `
+# gazelle:map_kind go_binary go_binary //tools/go:def.bzl
+# gazelle:map_kind go_library go_library //tools/go:def.bzl
+`,
+		},
+		{
+			Path: "enabled/multiple_mappings/multiple_mappings.go",
+			Content: `
+package main
+
+func main() {}`,
+		},
+		{
+			Path: "depend_on_mapped_kind/lib.go",
+			Content: `package depend_on_mapped_kind
+import (
+	_ "example.com/mapkind/disabled"
+	_ "example.com/mapkind/enabled"
+	_ "example.com/mapkind/enabled/existing_rules/mapped"
+	_ "example.com/mapkind/enabled/existing_rules/unmapped"
+	_ "example.com/mapkind/enabled/overridden"
+)`,
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, []string{"-external=vendored"}); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:prefix example.com/mapkind
+# gazelle:go_naming_convention go_default_library
+
+go_library(
+    name = "go_default_library",
+    srcs = ["root_lib.go"],
+    importpath = "example.com/mapkind",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+		{
+			Path: "enabled/BUILD.bazel",
+			Content: `
+load("//tools/go:def.bzl", "my_library")
+
+# gazelle:map_kind go_library my_library //tools/go:def.bzl
+
+my_library(
+    name = "go_default_library",
+    srcs = ["enabled_lib.go"],
+    importpath = "example.com/mapkind/enabled",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+		{
+			Path: "enabled/inherited/BUILD.bazel",
+			Content: `
+load("//tools/go:def.bzl", "my_library")
+
+my_library(
+    name = "go_default_library",
+    srcs = ["inherited_lib.go"],
+    importpath = "example.com/mapkind/enabled/inherited",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+		{
+			Path: "enabled/overridden/BUILD.bazel",
+			Content: `
+load("//tools/overridden:def.bzl", "overridden_library")
+
+# gazelle:map_kind go_library overridden_library //tools/overridden:def.bzl
+
+overridden_library(
+    name = "go_default_library",
+    srcs = ["overridden_lib.go"],
+    importpath = "example.com/mapkind/enabled/overridden",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+		{
+			Path: "disabled/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["disabled_lib.go"],
+    importpath = "example.com/mapkind/disabled",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+		{
+			Path: "enabled/existing_rules/mapped/BUILD.bazel",
+			Content: `
+load("//tools/go:def.bzl", "my_library")
+
+# An existing rule with a mapped type is updated
+my_library(
+    name = "go_default_library",
+    srcs = [
+        "mapped_lib.go",
+        "mapped_lib2.go",
+    ],
+    importpath = "example.com/mapkind/enabled/existing_rules/mapped",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+		{
+			Path: "enabled/existing_rules/unmapped/BUILD.bazel",
+			Content: `
+load("//tools/go:def.bzl", "my_library")
+
+# An existing rule with an unmapped type is updated
+my_library(
+    name = "go_default_library",
+    srcs = ["unmapped_lib.go"],
+    importpath = "example.com/mapkind/enabled/existing_rules/unmapped",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+		{
+			Path: "enabled/existing_rules/clean/BUILD.bazel",
+			Content: `
+# gazelle:go_naming_convention import
+# gazelle:map_kind go_library my_go_library //tools/go:def.bzl
+`,
+		},
+		{
+			Path: "enabled/existing_rules/clean_binary/BUILD.bazel",
+			Content: `
+# gazelle:go_naming_convention import
+# gazelle:map_kind go_binary my_go_binary //tools/go:def.bzl
+# gazelle:map_kind go_library my_go_library //tools/go:def.bzl
+`,
+		},
+		{
+			Path: "enabled/existing_rules/nobuild/BUILD.bazel",
+			Content: `
+load("//tools/go:def.bzl", "my_library")
+
+my_library(
+    name = "go_default_library",
+    srcs = ["nobuild_lib.go"],
+    importpath = "example.com/mapkind/enabled/existing_rules/nobuild",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+		{
+			Path: "enabled/multiple_mappings/BUILD.bazel",
+			Content: `
+load("//tools/go:def.bzl", "go_binary", "go_library")
+
+# gazelle:map_kind go_binary go_binary //tools/go:def.bzl
+# gazelle:map_kind go_library go_library //tools/go:def.bzl
+
+go_library(
+    name = "go_default_library",
+    srcs = ["multiple_mappings.go"],
+    importpath = "example.com/mapkind/enabled/multiple_mappings",
+    visibility = ["//visibility:private"],
+)
+
+go_binary(
+    name = "multiple_mappings",
+    embed = [":go_default_library"],
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+		{
+			Path: "depend_on_mapped_kind/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["lib.go"],
+    importpath = "example.com/mapkind/depend_on_mapped_kind",
+    visibility = ["//visibility:public"],
+    deps = [
+        "//disabled:go_default_library",
+        "//enabled:go_default_library",
+        "//enabled/existing_rules/mapped:go_default_library",
+        "//enabled/existing_rules/unmapped:go_default_library",
+        "//enabled/overridden:go_default_library",
+    ],
+)
+`,
+		},
+	})
+}
+
+func TestMapKindEdgeCases(t *testing.T) {
+	for name, tc := range map[string]struct {
+		before []testtools.FileSpec
+		after  []testtools.FileSpec
+	}{
+		"new generated rule applies map_kind": {
+			before: []testtools.FileSpec{
+				{
+					Path: "WORKSPACE",
+				},
+				{
+					Path: "BUILD.bazel",
+					Content: `# gazelle:prefix example.com/mapkind
+# gazelle:go_naming_convention go_default_library
+# gazelle:map_kind go_library go_library //custom:def.bzl
+`,
+				},
+				{
+					Path:    "dir/file.go",
+					Content: "package dir",
+				},
+			},
+			after: []testtools.FileSpec{
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("//custom:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["file.go"],
+    importpath = "example.com/mapkind/dir",
+    visibility = ["//visibility:public"],
+)
+`,
+				},
+			},
+		},
+		"existing generated rule with non-renaming mapping applied applies map_kind": {
+			before: []testtools.FileSpec{
+				{
+					Path: "WORKSPACE",
+				},
+				{
+					Path: "BUILD.bazel",
+					Content: `# gazelle:prefix example.com/mapkind
+# gazelle:go_naming_convention go_default_library
+# gazelle:map_kind go_library go_library //custom:def.bzl
+`,
+				},
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("//custom:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["file.go"],
+    importpath = "example.com/mapkind/dir",
+    visibility = ["//visibility:public"],
+)
+`,
+				},
+				{
+					Path:    "dir/file.go",
+					Content: "package dir",
+				},
+			},
+			after: []testtools.FileSpec{
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("//custom:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["file.go"],
+    importpath = "example.com/mapkind/dir",
+    visibility = ["//visibility:public"],
+)
+`,
+				},
+			},
+		},
+		"existing generated rule without non-renaming mapping applied applies map_kind": {
+			before: []testtools.FileSpec{
+				{
+					Path: "WORKSPACE",
+				},
+				{
+					Path: "BUILD.bazel",
+					Content: `# gazelle:prefix example.com/mapkind
+# gazelle:go_naming_convention go_default_library
+# gazelle:map_kind go_library go_library //custom:def.bzl
+`,
+				},
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["file.go"],
+    importpath = "example.com/mapkind/dir",
+    visibility = ["//visibility:public"],
+)
+`,
+				},
+				{
+					Path:    "dir/file.go",
+					Content: "package dir",
+				},
+			},
+			after: []testtools.FileSpec{
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("//custom:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["file.go"],
+    importpath = "example.com/mapkind/dir",
+    visibility = ["//visibility:public"],
+)
+`,
+				},
+			},
+		},
+		"existing generated rule without renaming mapping applied applies map_kind": {
+			before: []testtools.FileSpec{
+				{
+					Path: "WORKSPACE",
+				},
+				{
+					Path: "BUILD.bazel",
+					Content: `# gazelle:prefix example.com/mapkind
+# gazelle:go_naming_convention go_default_library
+# gazelle:map_kind go_library custom_go_library //custom:def.bzl
+`,
+				},
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["file.go"],
+    importpath = "example.com/mapkind/dir",
+    visibility = ["//visibility:public"],
+)
+`,
+				},
+				{
+					Path:    "dir/file.go",
+					Content: "package dir",
+				},
+			},
+			after: []testtools.FileSpec{
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("//custom:def.bzl", "custom_go_library")
+
+custom_go_library(
+    name = "go_default_library",
+    srcs = ["file.go"],
+    importpath = "example.com/mapkind/dir",
+    visibility = ["//visibility:public"],
+)
+`,
+				},
+			},
+		},
+		"existing generated rule with renaming mapping applied preserves map_kind": {
+			before: []testtools.FileSpec{
+				{
+					Path: "WORKSPACE",
+				},
+				{
+					Path: "BUILD.bazel",
+					Content: `# gazelle:prefix example.com/mapkind
+# gazelle:go_naming_convention go_default_library
+# gazelle:map_kind go_library custom_go_library //custom:def.bzl
+`,
+				},
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("//custom:def.bzl", "custom_go_library")
+
+custom_go_library(
+    name = "go_default_library",
+    srcs = ["file.go"],
+    importpath = "example.com/mapkind/dir",
+    visibility = ["//visibility:public"],
+)
+`,
+				},
+				{
+					Path:    "dir/file.go",
+					Content: "package dir",
+				},
+			},
+			after: []testtools.FileSpec{
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("//custom:def.bzl", "custom_go_library")
+
+custom_go_library(
+    name = "go_default_library",
+    srcs = ["file.go"],
+    importpath = "example.com/mapkind/dir",
+    visibility = ["//visibility:public"],
+)
+`,
+				},
+			},
+		},
+		"unrelated non-generated non-map_kind'd rule of same kind applies map_kind if other rule is generated": {
+			before: []testtools.FileSpec{
+				{
+					Path: "WORKSPACE",
+				},
+				{
+					Path: "BUILD.bazel",
+					Content: `# gazelle:prefix example.com/mapkind
+# gazelle:go_naming_convention go_default_library
+# gazelle:map_kind go_library go_library //custom:def.bzl
+		`,
+				},
+				{
+					Path:    "dir/file.go",
+					Content: "package dir",
+				},
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "custom_lib",
+    srcs = ["custom_lib.go"],
+)
+`,
+				},
+			},
+			after: []testtools.FileSpec{
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("//custom:def.bzl", "go_library")
+
+go_library(
+    name = "custom_lib",
+    srcs = ["custom_lib.go"],
+)
+
+go_library(
+    name = "go_default_library",
+    srcs = ["file.go"],
+    importpath = "example.com/mapkind/dir",
+    visibility = ["//visibility:public"],
+)
+`,
+				},
+			},
+		},
+		"unrelated non-generated non-renaming map_kind'd rule of same kind keeps map_kind if other rule is generated": {
+			before: []testtools.FileSpec{
+				{
+					Path: "WORKSPACE",
+				},
+				{
+					Path: "BUILD.bazel",
+					Content: `# gazelle:prefix example.com/mapkind
+# gazelle:go_naming_convention go_default_library
+# gazelle:map_kind go_library go_library //custom:def.bzl
+		`,
+				},
+				{
+					Path:    "dir/file.go",
+					Content: "package dir",
+				},
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("//custom:def.bzl", "go_library")
+
+go_library(
+    name = "custom_lib",
+    srcs = ["custom_lib.go"],
+)
+`,
+				},
+			},
+			after: []testtools.FileSpec{
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("//custom:def.bzl", "go_library")
+
+go_library(
+    name = "custom_lib",
+    srcs = ["custom_lib.go"],
+)
+
+go_library(
+    name = "go_default_library",
+    srcs = ["file.go"],
+    importpath = "example.com/mapkind/dir",
+    visibility = ["//visibility:public"],
+)
+`,
+				},
+			},
+		},
+		"unrelated non-generated non-renaming map_kind'd rule keeps map_kind if other generated rule is newly generated": {
+			before: []testtools.FileSpec{
+				{
+					Path: "WORKSPACE",
+				},
+				{
+					Path: "BUILD.bazel",
+					Content: `# gazelle:prefix example.com/mapkind
+# gazelle:go_naming_convention go_default_library
+# gazelle:map_kind go_library go_library //custom:def.bzl
+# gazelle:map_kind go_test go_test //custom:def.bzl
+		`,
+				},
+				{
+					Path:    "dir/file.go",
+					Content: "package dir",
+				},
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("//custom:def.bzl", "go_test")
+
+go_test(
+    name = "custom_test",
+    srcs = ["custom_test.java"],
+)
+`,
+				},
+			},
+			after: []testtools.FileSpec{
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("//custom:def.bzl", "go_library", "go_test")
+
+go_test(
+    name = "custom_test",
+    srcs = ["custom_test.java"],
+)
+
+go_library(
+    name = "go_default_library",
+    srcs = ["file.go"],
+    importpath = "example.com/mapkind/dir",
+    visibility = ["//visibility:public"],
+)
+`,
+				},
+			},
+		},
+		"unrelated non-generated non-renaming map_kind'd rule keeps map_kind if other generated rule already existed": {
+			before: []testtools.FileSpec{
+				{
+					Path: "WORKSPACE",
+				},
+				{
+					Path: "BUILD.bazel",
+					Content: `# gazelle:prefix example.com/mapkind
+# gazelle:go_naming_convention go_default_library
+# gazelle:map_kind go_library go_library //custom:def.bzl
+# gazelle:map_kind go_test go_test //custom:def.bzl
+`,
+				},
+				{
+					Path:    "dir/file.go",
+					Content: "package dir",
+				},
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("//custom:def.bzl", "go_library", "go_test")
+
+go_test(
+    name = "custom_test",
+    srcs = ["custom_test.java"],
+)
+
+go_library(
+    name = "go_default_library",
+    srcs = ["file.go"],
+    importpath = "example.com/mapkind/dir",
+    visibility = ["//visibility:public"],
+)
+`,
+				},
+			},
+			after: []testtools.FileSpec{
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("//custom:def.bzl", "go_library", "go_test")
+
+go_test(
+    name = "custom_test",
+    srcs = ["custom_test.java"],
+)
+
+go_library(
+    name = "go_default_library",
+    srcs = ["file.go"],
+    importpath = "example.com/mapkind/dir",
+    visibility = ["//visibility:public"],
+)
+`,
+				},
+			},
+		},
+		"transitive remappings are applied": {
+			before: []testtools.FileSpec{
+				{
+					Path: "WORKSPACE",
+				},
+				{
+					Path: "BUILD.bazel",
+					Content: `# gazelle:prefix example.com/mapkind
+# gazelle:go_naming_convention go_default_library
+# gazelle:map_kind go_library custom_go_library //custom:def.bzl
+		`,
+				},
+				{
+					Path:    "dir/file.go",
+					Content: "package dir",
+				},
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `# gazelle:map_kind custom_go_library other_custom_go_library //another/custom:def.bzl
+`,
+				},
+			},
+			after: []testtools.FileSpec{
+				{
+					Path: "dir/BUILD.bazel",
+					Content: `load("//another/custom:def.bzl", "other_custom_go_library")
+
+# gazelle:map_kind custom_go_library other_custom_go_library //another/custom:def.bzl
+
+other_custom_go_library(
+    name = "go_default_library",
+    srcs = ["file.go"],
+    importpath = "example.com/mapkind/dir",
+    visibility = ["//visibility:public"],
+)
+`,
+				},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir, cleanup := testtools.CreateFiles(t, tc.before)
+			t.Cleanup(cleanup)
+			if err := runGazelle(dir, []string{"-external=vendored"}); err != nil {
+				t.Fatal(err)
+			}
+			testtools.CheckFiles(t, dir, tc.after)
+		})
+	}
+}
+
+func TestMapKindLoop(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+		},
+		{
+			Path: "BUILD.bazel",
+			Content: `# gazelle:prefix example.com/mapkind
+# gazelle:go_naming_convention go_default_library
+# gazelle:map_kind go_library custom_go_library //custom:def.bzl
+		`,
+		},
+		{
+			Path:    "dir/file.go",
+			Content: "package dir",
+		},
+		{
+			Path: "dir/BUILD.bazel",
+			Content: `# gazelle:map_kind custom_go_library go_library @io_bazel_rules_go//go:def.bzl
+`,
+		},
+	})
+	t.Cleanup(cleanup)
+	err := runGazelle(dir, []string{"-external=vendored"})
+	if err == nil {
+		t.Fatal("Expected error running gazelle with map_kind loop")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "looking up mapped kind: found loop of map_kind replacements: go_library -> custom_go_library -> go_library") {
+		t.Fatalf("Expected error to contain useful descriptors but was %q", msg)
+	}
+}
+
+// TestMapKindEmbeddedResolve tests the gazelle:map_kind properly resolves
+// dependencies for embedded rules (see #1162).
+func TestMapKindEmbeddedResolve(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+		}, {
+			Path: "BUILD.bazel",
+			Content: `
+# gazelle:prefix example.com/mapkind
+# gazelle:map_kind go_library my_go_library //:my.bzl
+`,
+		}, {
+			Path: "a/a.proto",
+			Content: `
+syntax = "proto3";
+
+package test;
+option go_package = "example.com/mapkind/a";
+`,
+		}, {
+			Path: "b/b.proto",
+			Content: `
+syntax = "proto3";
+
+package test;
+option go_package = "example.com/mapkind/b";
+
+import "a/a.proto";
+`,
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, []string{"-external=vendored"}); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "a/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
+load("@rules_proto//proto:defs.bzl", "proto_library")
+load("//:my.bzl", "my_go_library")
+
+proto_library(
+    name = "a_proto",
+    srcs = ["a.proto"],
+    visibility = ["//visibility:public"],
+)
+
+go_proto_library(
+    name = "a_go_proto",
+    importpath = "example.com/mapkind/a",
+    proto = ":a_proto",
+    visibility = ["//visibility:public"],
+)
+
+my_go_library(
+    name = "a",
+    embed = [":a_go_proto"],
+    importpath = "example.com/mapkind/a",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+		{
+			Path: "b/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
+load("@rules_proto//proto:defs.bzl", "proto_library")
+load("//:my.bzl", "my_go_library")
+
+proto_library(
+    name = "b_proto",
+    srcs = ["b.proto"],
+    visibility = ["//visibility:public"],
+    deps = ["//a:a_proto"],
+)
+
+go_proto_library(
+    name = "b_go_proto",
+    importpath = "example.com/mapkind/b",
+    proto = ":b_proto",
+    visibility = ["//visibility:public"],
+    deps = ["//a"],
+)
+
+my_go_library(
+    name = "b",
+    embed = [":b_go_proto"],
+    importpath = "example.com/mapkind/b",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+	})
+}
+
+// TestMinimalModuleCompatibilityAliases checks that importpath_aliases
+// are emitted for go_libraries when needed. This can't easily be checked
+// in language/go because the generator tests don't support running at
+// the repository root or with additional flags, both of which are required.
+func TestMinimalModuleCompatibilityAliases(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path:    "go.mod",
+			Content: "module example.com/foo/v2",
+		}, {
+			Path:    "foo.go",
+			Content: "package foo",
+		}, {
+			Path:    "bar/bar.go",
+			Content: "package bar",
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update", "-repo_root", dir, "-go_prefix", "example.com/foo/v2", "-go_repository_mode", "-go_repository_module_mode"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "foo",
+    srcs = ["foo.go"],
+    importpath = "example.com/foo/v2",
+    importpath_aliases = ["example.com/foo"],
+    visibility = ["//visibility:public"],
+)
+`,
+		}, {
+			Path: "bar/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "bar",
+    srcs = ["bar.go"],
+    importpath = "example.com/foo/v2/bar",
+    importpath_aliases = ["example.com/foo/bar"],
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+	})
+}
+
+// TestPbSuffixAliasInGoRepository checks that go_repository generates an
+// alias without the "_pb" suffix for libraries generated from protos with
+// the pb_suffix naming convention, since other repositories resolve imports
+// to the name without the suffix.
+func TestPbSuffixAliasInGoRepository(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "foo/foo.proto",
+			Content: `syntax = "proto3";
+
+option go_package = "example.com/m/foo";
+
+package foo;
+`,
+		}, {
+			Path:    "foo/extra.go",
+			Content: "package foo",
+		}, {
+			Path:    "bar/bar.go",
+			Content: "package bar",
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update", "-repo_root", dir, "-go_prefix", "example.com/m", "-go_repository_mode", "-go_naming_convention", "pb_suffix"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "foo/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
+load("@rules_proto//proto:defs.bzl", "proto_library")
+
+proto_library(
+    name = "foo_proto",
+    srcs = ["foo.proto"],
+    visibility = ["//visibility:public"],
+)
+
+go_proto_library(
+    name = "foo_go_proto",
+    importpath = "example.com/m/foo",
+    proto = ":foo_proto",
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "foo_pb",
+    srcs = ["extra.go"],
+    embed = [":foo_go_proto"],
+    importpath = "example.com/m/foo",
+    visibility = ["//visibility:public"],
+)
+
+alias(
+    name = "foo",
+    actual = ":foo_pb",
+    visibility = ["//visibility:public"],
+)
+`,
+		}, {
+			Path: "bar/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "bar",
+    srcs = ["bar.go"],
+    importpath = "example.com/m/bar",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+	})
+}
+
+// TestGoImportVisibility checks that submodules implicitly declared with
+// go_repository rules in the repo config file (WORKSPACE) have visibility
+// for rules generated in internal directories where appropriate.
+// Verifies #619.
+func TestGoImportVisibility(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+go_repository(
+		name = "com_example_m_logging",
+    importpath = "example.com/m/logging",
+)
+`,
+		}, {
+			Path:    "internal/version/version.go",
+			Content: "package version",
+		}, {
+			Path:    "internal/version/version_test.go",
+			Content: "package version",
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update", "-go_prefix", "example.com/m"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "internal/version/BUILD.bazel",
+		Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+
+go_library(
+    name = "version",
+    srcs = ["version.go"],
+    importpath = "example.com/m/internal/version",
+    visibility = [
+        "//:__subpackages__",
+        "@com_example_m_logging//:__subpackages__",
+    ],
+)
+
+go_test(
+    name = "version_test",
+    srcs = ["version_test.go"],
+    embed = [":version"],
+)
+`,
+	}})
+}
+
+// TestGoInternalVisibility_TopLevel checks that modules that are
+// named internal/ expand visibility to repos that have a sibling
+// importpath.
+//
+// Verifies #960
+func TestGoInternalVisibility_TopLevel(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path:    "WORKSPACE",
+			Content: `go_repository(name="org_modernc_ccgo", importpath="modernc.org/ccgo")`,
+		}, {
+			Path:    "BUILD.bazel",
+			Content: `# gazelle:prefix modernc.org/internal`,
+		}, {
+			Path:    "internal.go",
+			Content: "package internal",
+		}, {
+			Path:    "buffer/buffer.go",
+			Content: "package buffer",
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:prefix modernc.org/internal
+
+go_library(
+    name = "internal",
+    srcs = ["internal.go"],
+    importpath = "modernc.org/internal",
+    visibility = [
+        "//:__subpackages__",
+        "@org_modernc_ccgo//:__subpackages__",
+    ],
+)
+`,
+		},
+		{
+			Path: "buffer/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "buffer",
+    srcs = ["buffer.go"],
+    importpath = "modernc.org/internal/buffer",
+    visibility = [
+        "//:__subpackages__",
+        "@org_modernc_ccgo//:__subpackages__",
+    ],
+)
+`,
+		},
+	})
+}
+
+// TestGoInternalFriends checks that go_internal_friends replaces the repos
+// found by import path prefix and applies to packages under internal/.
+func TestGoInternalFriends(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+go_repository(name="org_modernc_ccgo", importpath="modernc.org/ccgo")
+go_repository(name="org_modernc_cc", importpath="modernc.org/cc")
+`,
+		}, {
+			Path: "BUILD.bazel",
+			Content: `
+# gazelle:prefix modernc.org/internal
+# gazelle:go_internal_friends @org_modernc_cc,com_example_tools
+`,
+		}, {
+			Path:    "internal.go",
+			Content: "package internal",
+		}, {
+			Path:    "sub/internal/x/x.go",
+			Content: "package x",
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:prefix modernc.org/internal
+# gazelle:go_internal_friends @org_modernc_cc,com_example_tools
+
+go_library(
+    name = "internal",
+    srcs = ["internal.go"],
+    importpath = "modernc.org/internal",
+    visibility = [
+        "//:__subpackages__",
+        "@com_example_tools//:__subpackages__",
+        "@org_modernc_cc//:__subpackages__",
+    ],
+)
+`,
+		},
+		{
+			Path: "sub/internal/x/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "x",
+    srcs = ["x.go"],
+    importpath = "modernc.org/internal/sub/internal/x",
+    visibility = [
+        "//sub:__subpackages__",
+        "@com_example_tools//:__subpackages__",
+        "@org_modernc_cc//:__subpackages__",
+    ],
+)
+`,
+		},
+	})
+}
+
+func TestImportCollision(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+		},
+		{
+			Path: "go.mod",
+			Content: `
+module example.com/importcases
+
+go 1.13
+
+require (
+	github.com/Selvatico/go-mocket v1.0.7
+	github.com/selvatico/go-mocket v1.0.7
+)
+`,
+		},
+		{
+			Path: "go.sum",
+			Content: `
+github.com/Selvatico/go-mocket v1.0.7/go.mod h1:4gO2v+uQmsL+jzQgLANy3tyEFzaEzHlymVbZ3GP2Oes=
+github.com/selvatico/go-mocket v1.0.7/go.mod h1:7bSWzuNieCdUlanCVu3w0ppS0LvDtPAZmKBIlhoTcp8=
+`,
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update-repos", "--from_file=go.mod"}
+	errMsg := "imports github.com/Selvatico/go-mocket and github.com/selvatico/go-mocket resolve to the same repository rule name com_github_selvatico_go_mocket"
+	if err := runGazelle(dir, args); err == nil {
+		t.Fatal("expected error, got nil")
+	} else if err.Error() != errMsg {
+		t.Errorf("want %s, got %s", errMsg, err.Error())
+	}
+}
+
+func TestImportCollisionPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy, want string
+	}{
+		{
+			policy: "suffix",
+			want: `
+load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+# gazelle:repo bazel_gazelle
+
+go_repository(
+    name = "com_github_selvatico_go_mocket_2",
+    importpath = "github.com/Selvatico/go-mocket",
+    sum = "h1:sXuFMnMfVL9b/Os8rGXPgbOFbr4HJm8aHsulD/uMTUk=",
+    version = "v1.0.7",
+)
+
+go_repository(
+    name = "com_github_selvatico_go_mocket",
+    importpath = "github.com/selvatico/go-mocket",
+    sum = "h1:jbVa7RkoOCzBanQYiYF+VWgySHZogg25fOIKkM38q5k=",
+    version = "v1.0.7",
+)
+`,
+		}, {
+			policy: "lowercase_wins",
+			want: `
+load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+# gazelle:repo bazel_gazelle
+
+go_repository(
+    name = "com_github_selvatico_go_mocket",
+    importpath = "github.com/selvatico/go-mocket",
+    sum = "h1:jbVa7RkoOCzBanQYiYF+VWgySHZogg25fOIKkM38q5k=",
+    version = "v1.0.7",
+)
+`,
+		},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			files := []testtools.FileSpec{
+				{
+					Path:    "WORKSPACE",
+					Content: "# gazelle:repo bazel_gazelle",
+				},
+				{
+					Path: "go.mod",
+					Content: `
+module example.com/importcases
+
+go 1.13
+
+require (
+	github.com/Selvatico/go-mocket v1.0.7
+	github.com/selvatico/go-mocket v1.0.7
+)
+`,
+				},
+				{
+					Path: "go.sum",
+					Content: `
+github.com/Selvatico/go-mocket v1.0.7 h1:sXuFMnMfVL9b/Os8rGXPgbOFbr4HJm8aHsulD/uMTUk=
+github.com/Selvatico/go-mocket v1.0.7/go.mod h1:4gO2v+uQmsL+jzQgLANy3tyEFzaEzHlymVbZ3GP2Oes=
+github.com/selvatico/go-mocket v1.0.7 h1:jbVa7RkoOCzBanQYiYF+VWgySHZogg25fOIKkM38q5k=
+github.com/selvatico/go-mocket v1.0.7/go.mod h1:7bSWzuNieCdUlanCVu3w0ppS0LvDtPAZmKBIlhoTcp8=
+`,
+				},
+			}
+			dir, cleanup := testtools.CreateFiles(t, files)
+			defer cleanup()
+
+			args := []string{"update-repos", "--from_file=go.mod", "--case_collision=" + tc.policy}
+			if err := runGazelle(dir, args); err != nil {
+				t.Fatal(err)
+			}
+			testtools.CheckFiles(t, dir, []testtools.FileSpec{{Path: "WORKSPACE", Content: tc.want}})
+		})
+	}
+}
+
+func TestUpdateReposPrune(t *testing.T) {
+	goMod := testtools.FileSpec{
+		Path: "go.mod",
+		Content: `
+module example.com/prune
+
+go 1.13
+
+require github.com/selvatico/go-mocket v1.0.7
+`,
+	}
+	goSum := testtools.FileSpec{
+		Path: "go.sum",
+		Content: `
+github.com/selvatico/go-mocket v1.0.7 h1:jbVa7RkoOCzBanQYiYF+VWgySHZogg25fOIKkM38q5k=
+github.com/selvatico/go-mocket v1.0.7/go.mod h1:7bSWzuNieCdUlanCVu3w0ppS0LvDtPAZmKBIlhoTcp8=
+`,
+	}
+	mocket := `
+    go_repository(
+        name = "com_github_selvatico_go_mocket",
+        importpath = "github.com/selvatico/go-mocket",
+        sum = "h1:jbVa7RkoOCzBanQYiYF+VWgySHZogg25fOIKkM38q5k=",
+        version = "v1.0.7",
+    )
+`
+
+	t.Run("workspace", func(t *testing.T) {
+		dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+			{
+				Path: "WORKSPACE",
+				Content: `
+load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+# gazelle:repo bazel_gazelle
+# gazelle:repository go_repository name=com_example_directive importpath=example.com/directive
+
+go_repository(
+    name = "com_example_stale",
+    importpath = "example.com/stale",
+    sum = "h1:stale",
+    version = "v1.0.0",
+)
+
+# keep
+go_repository(
+    name = "com_example_kept",
+    importpath = "example.com/kept",
+    sum = "h1:kept",
+    version = "v1.0.0",
+)
+
+http_archive(
+    name = "not_go",
+    urls = ["https://example.com/not_go.tar.gz"],
+)
+`,
+			},
+			goMod,
+			goSum,
+		})
+		defer cleanup()
+
+		args := []string{"update-repos", "-from_file=go.mod", "-prune"}
+		if err := runGazelle(dir, args); err != nil {
+			t.Fatal(err)
+		}
+		testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+			Path: "WORKSPACE",
+			Content: `
+load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+# gazelle:repo bazel_gazelle
+# gazelle:repository go_repository name=com_example_directive importpath=example.com/directive
+
+# keep
+go_repository(
+    name = "com_example_kept",
+    importpath = "example.com/kept",
+    sum = "h1:kept",
+    version = "v1.0.0",
+)
+
+http_archive(
+    name = "not_go",
+    urls = ["https://example.com/not_go.tar.gz"],
+)
+` + strings.ReplaceAll(mocket, "\n    ", "\n"),
+		}})
+	})
+
+	t.Run("to_macro", func(t *testing.T) {
+		// In bzlmod mode, WORKSPACE doesn't declare the macro, so repositories
+		// in it are only found through -to_macro.
+		dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+			{Path: "WORKSPACE"},
+			{
+				Path: "deps.bzl",
+				Content: `
+load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+def go_deps():
+    go_repository(
+        name = "com_example_stale",
+        importpath = "example.com/stale",
+        sum = "h1:stale",
+        version = "v1.0.0",
+    )
+`,
+			},
+			goMod,
+			goSum,
+		})
+		defer cleanup()
+
+		args := []string{"update-repos", "-from_file=go.mod", "-to_macro=deps.bzl%go_deps", "-prune", "-bzlmod"}
+		if err := runGazelle(dir, args); err != nil {
+			t.Fatal(err)
+		}
+		testtools.CheckFiles(t, dir, []testtools.FileSpec{
+			{Path: "WORKSPACE", Content: ""},
+			{
+				Path: "deps.bzl",
+				Content: `
+load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+def go_deps():` + mocket,
+			},
+		})
+	})
+}
+
+func TestUpdateReposKeepAttrs(t *testing.T) {
+	goMod := testtools.FileSpec{
+		Path: "go.mod",
+		Content: `
+module example.com/keep
+
+go 1.13
+
+require github.com/selvatico/go-mocket v1.0.7
+`,
+	}
+	goSum := testtools.FileSpec{
+		Path: "go.sum",
+		Content: `
+github.com/selvatico/go-mocket v1.0.7 h1:jbVa7RkoOCzBanQYiYF+VWgySHZogg25fOIKkM38q5k=
+github.com/selvatico/go-mocket v1.0.7/go.mod h1:7bSWzuNieCdUlanCVu3w0ppS0LvDtPAZmKBIlhoTcp8=
+`,
+	}
+	for _, tc := range []struct {
+		desc, old, want string
+	}{
+		{
+			desc: "version bump",
+			old: `
+go_repository(
+    name = "com_github_selvatico_go_mocket",
+    build_directives = ["gazelle:proto disable"],
+    build_tags = ["integration"],  # keep
+    importpath = "github.com/selvatico/go-mocket",
+    patch_args = ["-p1"],
+    patches = ["//third_party:mocket.patch"],
+    sum = "h1:old",
+    version = "v1.0.6",
+)
+`,
+			want: `
+go_repository(
+    name = "com_github_selvatico_go_mocket",
+    build_directives = ["gazelle:proto disable"],
+    build_tags = ["integration"],  # keep
+    importpath = "github.com/selvatico/go-mocket",
+    patch_args = ["-p1"],
+    patches = ["//third_party:mocket.patch"],
+    sum = "h1:jbVa7RkoOCzBanQYiYF+VWgySHZogg25fOIKkM38q5k=",
+    version = "v1.0.7",
+)
+`,
+		}, {
+			desc: "pinned source",
+			old: `
+go_repository(
+    name = "com_github_selvatico_go_mocket",
+    importpath = "github.com/selvatico/go-mocket",
+    patches = ["//third_party:mocket.patch"],
+    sha256 = "0000000000000000000000000000000000000000000000000000000000000000",
+    strip_prefix = "go-mocket-fork-1.0.6",
+    # keep
+    urls = ["https://example.com/go-mocket-fork-1.0.6.zip"],
+)
+`,
+			want: `
+go_repository(
+    name = "com_github_selvatico_go_mocket",
+    importpath = "github.com/selvatico/go-mocket",
+    patches = ["//third_party:mocket.patch"],
+    sha256 = "0000000000000000000000000000000000000000000000000000000000000000",
+    strip_prefix = "go-mocket-fork-1.0.6",
+    # keep
+    urls = ["https://example.com/go-mocket-fork-1.0.6.zip"],
+)
+`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			header := `load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+# gazelle:repo bazel_gazelle
+`
+			dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+				{Path: "WORKSPACE", Content: header + tc.old},
+				goMod,
+				goSum,
+			})
+			defer cleanup()
+
+			args := []string{"update-repos", "-from_file=go.mod"}
+			if err := runGazelle(dir, args); err != nil {
+				t.Fatal(err)
+			}
+			testtools.CheckFiles(t, dir, []testtools.FileSpec{{Path: "WORKSPACE", Content: header + tc.want}})
+		})
+	}
+}
+
+func TestUpdateReposLockfile(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{
+			Path:    "WORKSPACE",
+			Content: "# gazelle:repo bazel_gazelle\n",
+		},
+		{
+			Path: "go.mod",
+			Content: `
+module example.com/lock
+
+go 1.13
+
+require github.com/selvatico/go-mocket v1.0.7
+`,
+		},
+		{
+			Path: "go.sum",
+			Content: `
+github.com/selvatico/go-mocket v1.0.7 h1:jbVa7RkoOCzBanQYiYF+VWgySHZogg25fOIKkM38q5k=
+github.com/selvatico/go-mocket v1.0.7/go.mod h1:7bSWzuNieCdUlanCVu3w0ppS0LvDtPAZmKBIlhoTcp8=
+`,
+		},
+	})
+	defer cleanup()
+
+	workspace := `
+load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+# gazelle:repo bazel_gazelle
+
+go_repository(
+    name = "com_github_selvatico_go_mocket",
+    importpath = "github.com/selvatico/go-mocket",
+    sum = "h1:jbVa7RkoOCzBanQYiYF+VWgySHZogg25fOIKkM38q5k=",
+    version = "v1.0.7",
+)
+`
+	args := []string{"update-repos", "-from_file=go.mod", "-lockfile=repos.lock.json"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{Path: "WORKSPACE", Content: workspace}})
+	lockPath := filepath.Join(dir, "repos.lock.json")
+	lockData, err := os.ReadFile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lock struct {
+		Version      int
+		Repositories []struct{ Name, Kind, Hash string }
+	}
+	if err := json.Unmarshal(lockData, &lock); err != nil {
+		t.Fatal(err)
+	}
+	if lock.Version != 1 || len(lock.Repositories) != 1 ||
+		lock.Repositories[0].Name != "com_github_selvatico_go_mocket" ||
+		lock.Repositories[0].Kind != "go_repository" ||
+		!strings.HasPrefix(lock.Repositories[0].Hash, "sha256:") {
+		t.Fatalf("unexpected lockfile:\n%s", lockData)
+	}
+
+	// With the lockfile up to date, WORKSPACE isn't rewritten, even though
+	// Gazelle would format it differently.
+	handEdited := `load("@bazel_gazelle//:deps.bzl", "go_repository")
+# gazelle:repo bazel_gazelle
+go_repository(name = "com_github_selvatico_go_mocket", importpath = "github.com/selvatico/go-mocket", sum = "h1:jbVa7RkoOCzBanQYiYF+VWgySHZogg25fOIKkM38q5k=", version = "v1.0.7")
+`
+	if err := os.WriteFile(filepath.Join(dir, "WORKSPACE"), []byte(handEdited), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{Path: "WORKSPACE", Content: handEdited},
+		{Path: "repos.lock.json", Content: string(lockData)},
+	})
+
+	// If a locked rule is edited by hand, it's updated again.
+	edited := strings.Replace(workspace, `version = "v1.0.7"`, `version = "v1.0.6"`, 1)
+	if err := os.WriteFile(filepath.Join(dir, "WORKSPACE"), []byte(edited), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{Path: "WORKSPACE", Content: workspace}})
+
+	// If a locked rule is deleted, it's added again.
+	if err := os.WriteFile(filepath.Join(dir, "WORKSPACE"), []byte("# gazelle:repo bazel_gazelle\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{Path: "WORKSPACE", Content: workspace}})
+}
+
+func TestImportCollisionWithReplace(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path:    "WORKSPACE",
+			Content: "# gazelle:repo bazel_gazelle",
+		},
+		{
+			Path: "go.mod",
+			Content: `
+module github.com/linzhp/go_examples/importcases
+
+go 1.13
+
+require (
+	github.com/Selvatico/go-mocket v1.0.7
+	github.com/selvatico/go-mocket v0.0.0-00010101000000-000000000000
+)
+
+replace github.com/selvatico/go-mocket => github.com/Selvatico/go-mocket v1.0.7
+`,
+		},
+		{
+			Path: "go.sum",
+			Content: `
+github.com/Selvatico/go-mocket v1.0.7/go.mod h1:4gO2v+uQmsL+jzQgLANy3tyEFzaEzHlymVbZ3GP2Oes=
+`,
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update-repos", "--from_file=go.mod"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+# gazelle:repo bazel_gazelle
+
+go_repository(
+    name = "com_github_selvatico_go_mocket",
+    importpath = "github.com/selvatico/go-mocket",
+    replace = "github.com/Selvatico/go-mocket",
+    sum = "h1:sXuFMnMfVL9b/Os8rGXPgbOFbr4HJm8aHsulD/uMTUk=",
+    version = "v1.0.7",
+)
+`,
+		},
+	})
+}
+
+// TestUpdateReposWithGlobalBuildTags is a regresion test for issue #711.
+// It also ensures that existings build_tags get merged with requested build_tags.
+func TestUpdateReposWithGlobalBuildTags(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+# gazelle:repo bazel_gazelle
+
+go_repository(
+    name = "com_github_selvatico_go_mocket",
+    build_tags = [
+        "bar",
+    ],
+    importpath = "github.com/selvatico/go-mocket",
+    replace = "github.com/Selvatico/go-mocket",
+    sum = "h1:sXuFMnMfVL9b/Os8rGXPgbOFbr4HJm8aHsulD/uMTUk=",
+    version = "v1.0.7",
+)
+`,
+		},
+		{
+			Path: "go.mod",
+			Content: `
+module github.com/linzhp/go_examples/importcases
+
+go 1.13
+
+require (
+	github.com/Selvatico/go-mocket v1.0.7
+	github.com/selvatico/go-mocket v0.0.0-00010101000000-000000000000
+)
+
+replace github.com/selvatico/go-mocket => github.com/Selvatico/go-mocket v1.0.7
+`,
+		},
+		{
+			Path: "go.sum",
+			Content: `
+github.com/Selvatico/go-mocket v1.0.7/go.mod h1:4gO2v+uQmsL+jzQgLANy3tyEFzaEzHlymVbZ3GP2Oes=
+`,
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update-repos", "--from_file=go.mod", "--build_tags=bar,foo"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+# gazelle:repo bazel_gazelle
+
+go_repository(
+    name = "com_github_selvatico_go_mocket",
+    build_tags = [
+        "bar",
+        "foo",
+    ],
+    importpath = "github.com/selvatico/go-mocket",
+    replace = "github.com/Selvatico/go-mocket",
+    sum = "h1:sXuFMnMfVL9b/Os8rGXPgbOFbr4HJm8aHsulD/uMTUk=",
+    version = "v1.0.7",
+)
+`,
+		},
+	})
+}
+
+func TestMatchProtoLibrary(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+		},
+		{
+			Path: "proto/BUILD.bazel",
+			Content: `
+load("@rules_proto//proto:defs.bzl", "proto_library")
+# gazelle:prefix example.com/foo
+
+proto_library(
+	name = "existing_proto",
+	srcs = ["foo.proto"],
+)
+`,
+		},
+		{
+			Path:    "proto/foo.proto",
+			Content: `syntax = "proto3";`,
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "proto/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
+load("@rules_proto//proto:defs.bzl", "proto_library")
+# gazelle:prefix example.com/foo
+
+proto_library(
+    name = "existing_proto",
+    srcs = ["foo.proto"],
+    visibility = ["//visibility:public"],
+)
+
+go_proto_library(
+    name = "foo_go_proto",
+    importpath = "example.com/foo",
+    proto = ":existing_proto",
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "foo",
+    embed = [":foo_go_proto"],
+    importpath = "example.com/foo",
+    visibility = ["//visibility:public"],
+)`,
+		},
+	})
+}
+
+func TestConfigLang(t *testing.T) {
+	// Gazelle is run with "-lang=proto".
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+
+		// Verify that Gazelle does not create a BUILD file.
+		{Path: "foo/foo.go", Content: "package foo"},
+
+		// Verify that Gazelle only creates the proto rule.
+		{Path: "pb/pb.go", Content: "package pb"},
+		{Path: "pb/pb.proto", Content: `syntax = "proto3";`},
+
+		// Verify that Gazelle does create a BUILD file, because of the override.
+		{Path: "bar/BUILD.bazel", Content: "# gazelle:lang"},
+		{Path: "bar/bar.go", Content: "package bar"},
+		{Path: "baz/BUILD.bazel", Content: "# gazelle:lang go,proto"},
+		{Path: "baz/baz.go", Content: "package baz"},
+
+		// Verify that Gazelle does not index go_library rules in // or //baz/protos.
+		// In those directories, lang is set to proto by flag and directive, respectively.
+		// Confirm it does index and resolve a rule in a directory where go is activated.
+		{Path: "invisible1.go", Content: "package invisible1"},
+		{Path: "BUILD.bazel", Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:prefix root
+
+go_library(
+    name = "go_default_library",
+    srcs = ["invisible1.go"],
+    importpath = "root",
+    visibility = ["//visibility:public"],
+)
+`},
+		{Path: "baz/protos/invisible2.go", Content: "package invisible2"},
+		{Path: "baz/protos/BUILD.bazel", Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:lang proto
+# gazelle:prefix github.com/rule_indexing/invisible2
+
+go_library(
+    name = "go_default_library",
+    srcs = ["invisible2.go"],
+    importpath = "github.com/rule_indexing/invisible2",
+    visibility = ["//visibility:public"],
+)
+`},
+		{Path: "visible/visible.go", Content: "package visible"},
+		{Path: "visible/BUILD.bazel", Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:lang go,proto
+# gazelle:prefix github.com/rule_indexing/visible
+
+go_library(
+    name = "go_default_library",
+    srcs = ["visible.go"],
+    importpath = "github.com/rule_indexing/visible",
+    visibility = ["//visibility:public"],
+)
+`},
+		{Path: "baz/test_no_index/test_no_index.go", Content: `
+package test_no_index
+
+import (
+	_ "github.com/rule_indexing/invisible1"
+	_ "github.com/rule_indexing/invisible2"
+	_ "github.com/rule_indexing/visible"
+)
+`},
+	}
+
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"-lang", "proto"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path:     filepath.Join("foo", "BUILD.bazel"),
+			NotExist: true,
+		},
+		{
+			Path: filepath.Join("pb", "BUILD.bazel"),
+			Content: `
+load("@rules_proto//proto:defs.bzl", "proto_library")
+
+proto_library(
+    name = "pb_proto",
+    srcs = ["pb.proto"],
+    visibility = ["//visibility:public"],
+)`,
+		},
+		{
+			Path: filepath.Join("bar", "BUILD.bazel"),
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:lang
+
+go_library(
+    name = "go_default_library",
+    srcs = ["bar.go"],
+    importpath = "root/bar",
+    visibility = ["//visibility:public"],
+)`,
+		},
+		{
+			Path: filepath.Join("baz", "BUILD.bazel"),
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:lang go,proto
+
+go_library(
+    name = "go_default_library",
+    srcs = ["baz.go"],
+    importpath = "root/baz",
+    visibility = ["//visibility:public"],
+)`,
+		},
+
+		{Path: "baz/test_no_index/BUILD.bazel", Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["test_no_index.go"],
+    importpath = "root/baz/test_no_index",
+    visibility = ["//visibility:public"],
+    deps = [
+        "//visible:go_default_library",
+        "@com_github_rule_indexing_invisible1//:go_default_library",
+        "@com_github_rule_indexing_invisible2//:go_default_library",
+    ],
+)
+`},
+	})
+}
+
+func TestUpdateRepos_LangFilter(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+	})
+	defer cleanup()
+
+	args := []string{"update-repos", "-lang=proto", "github.com/sirupsen/logrus@v1.3.0"}
+	err := runGazelle(dir, args)
+	if err == nil {
+		t.Fatal("expected an error, got none")
+	}
+	if !strings.Contains(err.Error(), "no languages can update repositories") {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+}
+
+func TestGoGenerateProto(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+		},
+		{
+			Path: "proto/BUILD.bazel",
+			Content: `# gazelle:go_generate_proto false
+# gazelle:prefix example.com/proto
+`,
+		},
+		{
+			Path:    "proto/foo.proto",
+			Content: `syntax = "proto3";`,
+		},
+		{
+			Path:    "proto/foo.pb.go",
+			Content: "package proto",
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "proto/BUILD.bazel",
+			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("@rules_proto//proto:defs.bzl", "proto_library")
+
+# gazelle:go_generate_proto false
+# gazelle:prefix example.com/proto
+
+proto_library(
+    name = "foo_proto",
+    srcs = ["foo.proto"],
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "proto",
+    srcs = ["foo.pb.go"],
+    importpath = "example.com/proto",
+    visibility = ["//visibility:public"],
+)`,
+		},
+	})
+}
+
+func TestGoMainLibraryRemoved(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+		},
+		{
+			Path: "BUILD.bazel",
+			Content: `
+# gazelle:prefix example.com
+# gazelle:go_naming_convention import
+`,
+		},
+		{
+			Path: "cmd/foo/BUILD.bazel",
+			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library")
+
+go_library(
+		name = "foo_lib",
+		srcs = ["foo.go"],
+		importpath = "example.com/cmd/foo",
+		visibility = ["//visibility:private"],
+)
+
+go_binary(
+		name = "foo",
+		embed = [":foo_lib"],
+		visibility = ["//visibility:public"],
+)
+`,
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path:    "cmd/foo/BUILD.bazel",
+			Content: "",
+		},
+	})
+}
+
+func TestUpdateReposOldBoilerplateNewRepo(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+
+http_archive(
+    name = "io_bazel_rules_go",
+    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+    ],
+)
+
+http_archive(
+    name = "bazel_gazelle",
+    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+    ],
+)
+
+load("@io_bazel_rules_go//go:deps.bzl", "go_rules_dependencies", "go_register_toolchains")
+
+go_rules_dependencies()
+
+go_register_toolchains()
+
+load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
+
+gazelle_dependencies()
+`,
+		},
+	}
+
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update-repos", "golang.org/x/mod@v0.3.0"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+
+http_archive(
+    name = "io_bazel_rules_go",
+    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+    ],
+)
+
+http_archive(
+    name = "bazel_gazelle",
+    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+    ],
+)
+
+load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
+
+go_rules_dependencies()
+
+go_register_toolchains()
+
+load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies", "go_repository")
+
+go_repository(
+    name = "org_golang_x_mod",
+    importpath = "golang.org/x/mod",
+    sum = "h1:RM4zey1++hCTbCVQfnWeKs9/IEsaBLA8vTkd0WVtmH4=",
+    version = "v0.3.0",
+)
+
+gazelle_dependencies()
+`,
+		},
+	})
+}
+
+func TestUpdateReposSkipsDirectiveRepo(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+
+http_archive(
+    name = "io_bazel_rules_go",
+    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+    ],
+)
+
+http_archive(
+    name = "bazel_gazelle",
+    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+    ],
+)
+
+load("@io_bazel_rules_go//go:deps.bzl", "go_rules_dependencies", "go_register_toolchains")
+
+go_rules_dependencies()
+
+go_register_toolchains()
+
+load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
+
+gazelle_dependencies()
+
+# gazelle:repository go_repository name=org_golang_x_mod importpath=golang.org/x/mod
+`,
+		},
+	}
+
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update-repos", "golang.org/x/mod@v0.3.0"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+
+http_archive(
+    name = "io_bazel_rules_go",
+    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+    ],
+)
+
+http_archive(
+    name = "bazel_gazelle",
+    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+    ],
+)
+
+load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
+
+go_rules_dependencies()
+
+go_register_toolchains()
+
+load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
+
+gazelle_dependencies()
+
+# gazelle:repository go_repository name=org_golang_x_mod importpath=golang.org/x/mod
+`,
+		},
+	})
+}
+
+func TestUpdateReposOldBoilerplateNewMacro(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+
+http_archive(
+    name = "io_bazel_rules_go",
+    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+    ],
+)
+
+http_archive(
+    name = "bazel_gazelle",
+    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+    ],
+)
+
+load("@io_bazel_rules_go//go:deps.bzl", "go_rules_dependencies", "go_register_toolchains")
+
+go_rules_dependencies()
+
+go_register_toolchains()
+
+load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
+
+gazelle_dependencies()
+`,
+		},
+	}
+
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update-repos", "-to_macro=deps.bzl%deps", "golang.org/x/mod@v0.3.0"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+
+http_archive(
+    name = "io_bazel_rules_go",
+    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+    ],
+)
+
+http_archive(
+    name = "bazel_gazelle",
+    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+    ],
+)
+
+load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
+
+go_rules_dependencies()
+
+go_register_toolchains()
+
+load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
+load("//:deps.bzl", "deps")
+
+# gazelle:repository_macro deps.bzl%deps
+deps()
+
+gazelle_dependencies()
+`,
+		},
+	})
+}
+
+func TestUpdateReposNewBoilerplateNewRepo(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+
+http_archive(
+    name = "io_bazel_rules_go",
+    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+    ],
+)
+
+http_archive(
+    name = "bazel_gazelle",
+    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+    ],
+)
+
+load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
+load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
+
+go_rules_dependencies()
+
+go_register_toolchains()
+
+gazelle_dependencies()
+`,
+		},
+	}
+
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update-repos", "golang.org/x/mod@v0.3.0"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+
+http_archive(
+    name = "io_bazel_rules_go",
+    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+    ],
+)
+
+http_archive(
+    name = "bazel_gazelle",
+    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+    ],
+)
+
+load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies", "go_repository")
+load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
+
+go_repository(
+    name = "org_golang_x_mod",
+    importpath = "golang.org/x/mod",
+    sum = "h1:RM4zey1++hCTbCVQfnWeKs9/IEsaBLA8vTkd0WVtmH4=",
+    version = "v0.3.0",
+)
+
+go_rules_dependencies()
+
+go_register_toolchains()
+
+gazelle_dependencies()
+`,
+		},
+	})
+}
+
+func TestUpdateReposNewBoilerplateNewMacro(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+
+http_archive(
+    name = "io_bazel_rules_go",
+    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+    ],
+)
+
+http_archive(
+    name = "bazel_gazelle",
+    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+    ],
+)
+
+load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
+load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
+
+go_rules_dependencies()
+
+go_register_toolchains()
+
+gazelle_dependencies()
+`,
+		},
+	}
+
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update-repos", "-to_macro=deps.bzl%deps", "golang.org/x/mod@v0.3.0"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+
+http_archive(
+    name = "io_bazel_rules_go",
+    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+    ],
+)
+
+http_archive(
+    name = "bazel_gazelle",
+    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
+    urls = [
+        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+    ],
+)
+
+load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
+load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
+load("//:deps.bzl", "deps")
+
+# gazelle:repository_macro deps.bzl%deps
+deps()
+
+go_rules_dependencies()
+
+go_register_toolchains()
+
+gazelle_dependencies()
+`,
+		},
+	})
+}
+
+func TestExternalOnly(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+		},
+		{
+			Path: "foo/foo.go",
+			Content: `package foo
+import _ "golang.org/x/baz"
+`,
+		},
+		{
+			Path: "foo/foo_test.go",
+			Content: `package foo_test
+import _ "golang.org/x/baz"
+import _ "example.com/foo"
+`,
+		},
+		{
+			Path: "foo/BUILD.bazel",
+			Content: `# gazelle:prefix example.com/foo
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+
+go_library(
+    name = "foo",
+    srcs = ["foo.go"],
+    importpath = "example.com/foo",
+    visibility = ["//visibility:public"],
+    deps = ["@org_golang_x_baz//:go_default_library"],
+)
+
+go_test(
+    name = "foo_test",
+    srcs = ["foo_test.go"],
+    embed = [":foo"],
+)`,
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	var args []string
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "foo/BUILD.bazel",
+			Content: `# gazelle:prefix example.com/foo
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+
+go_library(
+    name = "foo",
+    srcs = ["foo.go"],
+    importpath = "example.com/foo",
+    visibility = ["//visibility:public"],
+    deps = ["@org_golang_x_baz//:go_default_library"],
+)
+
+go_test(
+    name = "foo_test",
+    srcs = ["foo_test.go"],
+    deps = [
+        ":foo",
+        "@org_golang_x_baz//:go_default_library",
+    ],
+)`,
+		},
+	})
+}
+
+func TestFindRulesGoVersionWithWORKSPACE(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+			Content: `
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+
+http_archive(
+    name = "io_bazel_rules_go",
+    sha256 = "7b9bbe3ea1fccb46dcfa6c3f3e29ba7ec740d8733370e21cdc8937467b4a4349",
+    urls = [
+        "https://storage.googleapis.com/bazel-mirror/github.com/bazelbuild/rules_go/releases/download/v0.22.4/rules_go-v0.22.4.tar.gz",
+        "https://github.com/bazelbuild/rules_go/releases/download/v0.22.4/rules_go-v0.22.4.tar.gz",
+    ],
+)
+`,
+		},
+		{
+			Path: "foo_illumos.go",
+			Content: `
+// illumos not supported in rules_go v0.22.4
+package foo
+`,
+		},
+		{
+			Path: "BUILD.bazel",
+			Content: `
+# gazelle:prefix example.com/foo
+`,
+		},
+	}
+
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, []string{"update"}); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+			Content: `
+# gazelle:prefix example.com/foo
+`,
+		},
+	})
+}
+
+func TestPlatformSpecificEmbedsrcs(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+		},
+		{
+			Path: "BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:prefix example.com/foo
+
+go_library(
+    name = "foo",
+    embedsrcs = ["deleted.txt"],
+    importpath = "example.com/foo",
+    srcs = ["foo.go"],
+)
+`,
+		},
+		{
+			Path: "foo.go",
+			Content: `
+// +build windows
+
+package foo
+
+import _ "embed"
+
+//go:embed windows.txt
+var s string
+`,
+		},
+		{
+			Path: "windows.txt",
+		},
+	}
+
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, []string{"update"}); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:prefix example.com/foo
+
+go_library(
+    name = "foo",
+    srcs = ["foo.go"],
+    embedsrcs = select({
+        "@io_bazel_rules_go//go/platform:windows": [
+            "windows.txt",
+        ],
+        "//conditions:default": [],
+    }),
+    importpath = "example.com/foo",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+	})
+}
+
+// Checks that go:embed directives with spaces and quotes are parsed correctly.
+// This probably belongs in //language/go:go_test, but we need file names with
+// spaces, and Bazel doesn't allow those in runfiles, which that test depends
+// on.
+func TestQuotedEmbedsrcs(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path: "WORKSPACE",
+		},
+		{
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix example.com/foo",
+		},
+		{
+			Path: "foo.go",
+			Content: strings.Join([]string{
+				"package foo",
+				"import \"embed\"",
+				"//go:embed q1.txt q2.txt \"q 3.txt\" `q 4.txt`",
+				"var fs embed.FS",
+			}, "\n"),
+		},
+		{
+			Path: "q1.txt",
+		},
+		{
+			Path: "q2.txt",
+		},
+		{
+			Path: "q 3.txt",
+		},
+		{
+			Path: "q 4.txt",
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, []string{"update"}); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "BUILD.bazel",
+		Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:prefix example.com/foo
+
+go_library(
+    name = "foo",
+    srcs = ["foo.go"],
+    embedsrcs = [
+        "q 3.txt",
+        "q 4.txt",
+        "q1.txt",
+        "q2.txt",
+    ],
+    importpath = "example.com/foo",
+    visibility = ["//visibility:public"],
+)
+`,
+	}})
+}
+
+// TestUpdateReposDoesNotModifyGoSum verifies that commands executed by
+// update-repos do not modify go.sum, particularly 'go mod download' when
+// a sum is missing. Verifies #990.
+//
+// This could also be tested in language/go/update_import_test.go, but that
+// test relies on stubs for speed, and it's important to run the real
+// go command here.
+func TestUpdateReposDoesNotModifyGoSum(t *testing.T) {
+	if testing.Short() {
+		// Test may download small files over network.
+		t.Skip()
+	}
+	goSumFile := testtools.FileSpec{
+		// go.sum only contains the sum for the mod file, not the content.
+		// This is common for transitive dependencies not needed by the main module.
+		Path:    "go.sum",
+		Content: "golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1/go.mod h1:I/5z698sn9Ka8TeJc9MKroUUfqBBauWjQqLJ2OPfmY0=\n",
+	}
+	files := []testtools.FileSpec{
+		{
+			Path:    "WORKSPACE",
+			Content: "# gazelle:repo bazel_gazelle",
+		},
+		{
+			Path: "go.mod",
+			Content: `
+module test
+
+go 1.16
+
+require golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
+`,
+		},
+		goSumFile,
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, []string{"update-repos", "-from_file=go.mod"}); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{goSumFile})
+}
+
+func TestImportReposFromMultipleFiles(t *testing.T) {
+	if testing.Short() {
+		// Test may download small files over network.
+		t.Skip()
+	}
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{
+			Path:    "WORKSPACE",
+			Content: "# gazelle:repo bazel_gazelle",
+		},
+		{
+			Path: "go.mod",
+			Content: `
+module example.com/app
+
+go 1.16
+
+require (
+	github.com/selvatico/go-mocket v1.0.7
+	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543
+)
+`,
+		},
+		{
+			Path: "go.sum",
+			Content: `
+github.com/selvatico/go-mocket v1.0.7 h1:jbVa7RkoOCzBanQYiYF+VWgySHZogg25fOIKkM38q5k=
+github.com/selvatico/go-mocket v1.0.7/go.mod h1:7bSWzuNieCdUlanCVu3w0ppS0LvDtPAZmKBIlhoTcp8=
+golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543 h1:E7g+9GITq07hpfrRu66IVDexMakfv52eLZ2CXBWiKr4=
+golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543/go.mod h1:I/5z698sn9Ka8TeJc9MKroUUfqBBauWjQqLJ2OPfmY0=
+`,
+		},
+		{
+			Path: "tools/go.mod",
+			Content: `
+module example.com/app/tools
+
+go 1.16
+
+require golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
+`,
+		},
+		{
+			Path: "tools/go.sum",
+			Content: `
+golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 h1:go1bK/D/BFZV2I8cIQd1NKEZ+0owSTG1fDTci4IqFcE=
+golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1/go.mod h1:I/5z698sn9Ka8TeJc9MKroUUfqBBauWjQqLJ2OPfmY0=
+`,
+		},
+	})
+	defer cleanup()
+
+	// The glob matches tools/go.mod. The higher version of xerrors is chosen.
+	args := []string{"update-repos", "-from_file=go.mod", "-from_file=*/go.mod"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "WORKSPACE",
+		Content: `
+load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+# gazelle:repo bazel_gazelle
+
+go_repository(
+    name = "com_github_selvatico_go_mocket",
+    importpath = "github.com/selvatico/go-mocket",
+    sum = "h1:jbVa7RkoOCzBanQYiYF+VWgySHZogg25fOIKkM38q5k=",
+    version = "v1.0.7",
+)
+
+go_repository(
+    name = "org_golang_x_xerrors",
+    importpath = "golang.org/x/xerrors",
+    sum = "h1:go1bK/D/BFZV2I8cIQd1NKEZ+0owSTG1fDTci4IqFcE=",
+    version = "v0.0.0-20200804184101-5ec99f83aff1",
+)
+`,
+	}})
+
+	if err := runGazelle(dir, []string{"update-repos", "-from_file=*/go.work"}); err == nil {
+		t.Error("-from_file with a pattern that matches no files: got success; want error")
+	}
+}
+
+func TestResolveGoStaticFromGoMod(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path: "go.mod",
+			Content: `
+module example.com/use
+
+go 1.19
+
+require example.com/dep v1.0.0
+`,
+		},
+		{
+			Path: "use.go",
+			Content: `
+package use
+
+import _ "example.com/dep/pkg"
+`,
+		},
+	})
+	defer cleanup()
+
+	args := []string{
+		"-go_prefix=example.com/use",
+		"-external=static",
+		"-go_naming_convention_external=import",
+	}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "use",
+    srcs = ["use.go"],
+    importpath = "example.com/use",
+    visibility = ["//visibility:public"],
+    deps = ["@com_example_dep//pkg"],
+)
+`,
+		},
+	})
+}
+
+func TestStrictDeps(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path: "go.mod",
+			Content: `
+module example.com/use
+
+go 1.19
+
+require example.com/dep v1.0.0
+`,
+		},
+		{
+			Path: "use.go",
+			Content: `
+package use
+
+import (
+	_ "example.com/dep/pkg"
+	_ "example.com/unknown/pkg"
+	_ "fmt"
+)
+`,
+		},
+		{
+			Path: "sub/sub.go",
+			Content: `
+package sub
+
+import _ "example.com/other"
+`,
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"-go_prefix=example.com/use", "-go_naming_convention_external=import", "-strict_deps"}
+	err := runGazelle(dir, args)
+	if err == nil {
+		t.Fatal("got success; want error for unresolved imports")
+	}
+	for _, want := range []string{
+		`//:use: import "example.com/unknown/pkg"`,
+		`//sub: import "example.com/other"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %q; want it to contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "example.com/dep") {
+		t.Errorf("got error %q; want no error for the repository in go.mod", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "BUILD.bazel")); !os.IsNotExist(err) {
+		t.Errorf("BUILD.bazel was written; want no build files written")
+	}
+
+	// The directive works like the flag, and it can turn strict_deps off in
+	// a subdirectory.
+	for _, f := range []testtools.FileSpec{
+		{Path: "BUILD.bazel", Content: "# gazelle:strict_deps true\n"},
+		{Path: "sub/BUILD.bazel", Content: "# gazelle:strict_deps false\n"},
+		{Path: "use.go", Content: "package use\n\nimport _ \"example.com/dep/pkg\"\n"},
+	} {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(f.Path)), []byte(f.Content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	args = []string{"-go_prefix=example.com/use", "-go_naming_convention_external=import", "-external=static"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:strict_deps true
+
+go_library(
+    name = "use",
+    srcs = ["use.go"],
+    importpath = "example.com/use",
+    visibility = ["//visibility:public"],
+    deps = ["@com_example_dep//pkg"],
+)
+`,
+		},
+		{
+			Path: "sub/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:strict_deps false
+
+go_library(
+    name = "sub",
+    srcs = ["sub.go"],
+    importpath = "example.com/use/sub",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+	})
+}
+
+func TestStaleKeepComments(t *testing.T) {
+	buildFile := `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:prefix example.com/m
+
+genrule(
+    name = "gen",
+    outs = ["gen.go"],
+    cmd = "echo package m >$@",
+)
+
+go_library(
+    name = "m",
+    srcs = [
+        "gen.go",  # keep
+        "gone.go",  # keep
+        "m.go",
+    ],
+    copts = [
+        "-DFOO",  # keep
+    ],
+    importpath = "example.com/m",
+    tags = [
+        "manual",  # keep
+    ],
+    visibility = ["//visibility:public"],
+    deps = [
+        "//b",  # keep
+        "//b:gone",  # keep
+        "//c:x_lib",  # keep
+        "//missing:x",  # keep
+        "@ext//:x",  # keep
+    ],
+)
+`
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{Path: "BUILD.bazel", Content: buildFile},
+		{Path: "m.go", Content: "package m"},
+		{Path: "b/b.go", Content: "package b"},
+		// The macro may declare targets that aren't in the build file, like
+		// :x_lib, so they're never reported or removed.
+		{Path: "c/BUILD.bazel", Content: `load("//tools:defs.bzl", "my_macro")
+
+my_macro(name = "x")
+`},
+		{Path: "b/BUILD.bazel", Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "b",
+    srcs = ["b.go"],
+    importpath = "example.com/m/b",
+    visibility = ["//visibility:public"],
+)
+`},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	// With -strict, stale # keep comments are errors, and nothing is written.
+	err := runGazelle(dir, []string{"-strict"})
+	if err == nil {
+		t.Fatal("got success; want error for stale # keep comments")
+	}
+	for _, want := range []string{`"gone.go" in srcs`, `"//b:gone" in deps`, `"//missing:x" in deps`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %q; want it to contain %q", err, want)
+		}
+	}
+	for _, notWant := range []string{`"gen.go"`, `"//b" in`, `"//c:x_lib"`, `"@ext//:x"`, `"-DFOO"`, `"manual"`} {
+		if strings.Contains(err.Error(), notWant) {
+			t.Errorf("got error %q; want no error about %s", err, notWant)
+		}
+	}
+
+	// Without -strict, they're only reported.
+	if err := runGazelle(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{Path: "BUILD.bazel", Content: buildFile}})
+
+	// The fix command removes them.
+	if err := runGazelle(dir, []string{"fix"}); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "BUILD.bazel",
+		Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:prefix example.com/m
+
+genrule(
+    name = "gen",
+    outs = ["gen.go"],
+    cmd = "echo package m >$@",
+)
+
+go_library(
+    name = "m",
+    srcs = [
+        "gen.go",  # keep
+        "m.go",
+    ],
+    copts = [
+        "-DFOO",  # keep
+    ],
+    importpath = "example.com/m",
+    tags = [
+        "manual",  # keep
+    ],
+    visibility = ["//visibility:public"],
+    deps = [
+        "//b",  # keep
+        "//c:x_lib",  # keep
+        "@ext//:x",  # keep
+    ],
+)
+`,
+	}})
+}
+
+func TestMigrateSelectFromWorkspaceToBzlmod(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path:    "MODULE.bazel",
+			Content: `bazel_dep(name = "rules_go", version = "0.39.1", repo_name = "my_rules_go")`,
+		},
+		{
+			Path: "BUILD",
+			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "foo",
+    srcs = [
+        "bar.go",
+        "foo.go",
+        "foo_android.go",
+        "foo_android_build_tag.go",
+    ],
+    importpath = "example.com/foo",
+    visibility = ["//visibility:public"],
+    deps = select({
+        "@io_bazel_rules_go//go/platform:android": [
+            "//outer",
+            "//outer/inner",
+            "//outer_android_build_tag",
+            "//outer_android_suffix",
+            "@com_github_jr_hacker_tools//:go_default_library",
+        ],
+        "@io_bazel_rules_go//go/platform:linux": [
+            "//outer",
+            "//outer/inner",
+            "@com_github_jr_hacker_tools//:go_default_library",
+        ],
+        "//conditions:default": [],
+    }),
+)
+`,
+		},
+		{
+			Path: "foo.go",
+			Content: `
+// +build linux
+
+package foo
+
+import (
+    _ "example.com/foo/outer"
+    _ "example.com/foo/outer/inner"
+    _ "github.com/jr_hacker/tools"
+)
+`,
+		},
+		{
+			Path: "foo_android_build_tag.go",
+			Content: `
+// +build android
+
+package foo
+
+import (
+    _ "example.com/foo/outer_android_build_tag"
+)
+`,
+		},
+		{
+			Path: "foo_android.go",
+			Content: `
+package foo
+
+import (
+    _ "example.com/foo/outer_android_suffix"
+)
+`,
+		},
+		{
+			Path: "bar.go",
+			Content: `// +build linux
+
+package foo
+`,
+		},
+		{Path: "outer/outer.go", Content: "package outer"},
+		{Path: "outer_android_build_tag/outer.go", Content: "package outer_android_build_tag"},
+		{Path: "outer_android_suffix/outer.go", Content: "package outer_android_suffix"},
+		{Path: "outer/inner/inner.go", Content: "package inner"},
+	})
+	want := `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "foo",
+    srcs = [
+        "bar.go",
+        "foo.go",
+        "foo_android.go",
+        "foo_android_build_tag.go",
+    ],
+    importpath = "example.com/foo",
+    visibility = ["//visibility:public"],
+    deps = select({
+        "@my_rules_go//go/platform:android": [
+            "//outer",
+            "//outer/inner",
+            "//outer_android_build_tag",
+            "//outer_android_suffix",
+            "@com_github_jr_hacker_tools//:go_default_library",
+        ],
+        "@my_rules_go//go/platform:linux": [
+            "//outer",
+            "//outer/inner",
+            "@com_github_jr_hacker_tools//:go_default_library",
+        ],
+        "//conditions:default": [],
+    }),
+)
+`
+	defer cleanup()
+
+	if err := runGazelle(dir, []string{"-go_prefix", "example.com/foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "BUILD")); err != nil {
+		t.Fatal(err)
+	} else if string(got) != want {
+		t.Fatalf("got %s ; want %s; diff %s", string(got), want, cmp.Diff(string(got), want))
+	}
+}
+
+func TestUpdateReposWithBzlmodWithToMacro(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path: "go.mod",
+			Content: `
+module example.com/foo/v2
+
+go 1.19
+
+require (
+	github.com/stretchr/testify v1.8.4
+)
+`,
+		},
+	})
+
+	t.Cleanup(cleanup)
+
+	args := []string{
+		"update-repos",
+		"-from_file=go.mod",
+		"-to_macro=go_deps.bzl%my_go_deps",
+		"-bzlmod",
+	}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	// Confirm that the WORKSPACE is still empty
+	want := ""
+	if got, err := os.ReadFile(filepath.Join(dir, "WORKSPACE")); err != nil {
+		t.Fatal(err)
+	} else if string(got) != want {
+		t.Fatalf("got %s ; want %s; diff %s", string(got), want, cmp.Diff(string(got), want))
+	}
+
+	// Confirm that the macro file was written
+	want = `load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+def my_go_deps():
+    go_repository(
+        name = "com_github_stretchr_testify",
+        importpath = "github.com/stretchr/testify",
+        sum = "h1:CcVxjf3Q8PM0mHUKJCdn+eZZtm5yQwehR5yeSVQQcUk=",
+        version = "v1.8.4",
+    )
+`
+	if got, err := os.ReadFile(filepath.Join(dir, "go_deps.bzl")); err != nil {
+		t.Fatal(err)
+	} else if string(got) != want {
+		t.Fatalf("got %s ; want %s; diff %s", string(got), want, cmp.Diff(string(got), want))
+	}
+}
+
+func TestUpdateReposWithBzlmodWithoutToMacro(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path: "go.mod",
+			Content: `
+module example.com/foo/v2
+
+go 1.19
+
+require (
+	github.com/stretchr/testify v1.8.4
+)
+`,
+		},
+	})
+
+	t.Cleanup(cleanup)
+
+	args := []string{
+		"update-repos",
+		"-from_file=go.mod",
+		"-bzlmod",
+	}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	// Confirm that the WORKSPACE is still empty
+	want := ""
+	if got, err := os.ReadFile(filepath.Join(dir, "WORKSPACE")); err != nil {
+		t.Fatal(err)
+	} else if string(got) != want {
+		t.Fatalf("got %s ; want %s; diff %s", string(got), want, cmp.Diff(string(got), want))
+	}
+}
+
+func TestUpdateReposToBzlmod(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "REPO.bazel"},
+		{
+			Path: "MODULE.bazel",
+			Content: `
+bazel_dep(name = "gazelle", version = "0.40.0")
+
+go_deps = use_extension("@gazelle//:extensions.bzl", "go_deps")
+go_deps.from_file(go_mod = "//:go.mod")
+use_repo(go_deps, "org_golang_x_tools", mod = "com_example_mod")
+`,
+		},
+		{
+			Path: "go.mod",
+			Content: `module example.com/m
+
+go 1.21
+
+require (
+	golang.org/x/tools v0.1.0
+	golang.org/x/xerrors v0.0.0-20190717185122-a985d3407aa7
+)
+`,
+		},
+		{Path: "go.sum", Content: "golang.org/x/tools v0.1.0 h1:tools\n"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update-repos", "-to_bzlmod", "golang.org/x/mod@v0.3.0"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "MODULE.bazel",
+			Content: `
+bazel_dep(name = "gazelle", version = "0.40.0")
+
+go_deps = use_extension("@gazelle//:extensions.bzl", "go_deps")
+go_deps.from_file(go_mod = "//:go.mod")
+use_repo(go_deps, "org_golang_x_mod", "org_golang_x_tools", mod = "com_example_mod")
+`,
+		}, {
+			Path: "go.mod",
+			Content: `module example.com/m
+
+go 1.21
+
+require (
+	golang.org/x/tools v0.1.0
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
+)
+
+require golang.org/x/mod v0.3.0 // indirect
+`,
+		},
+	})
+
+	// go_deps checks the sums of go.mod files of every module in the build
+	// list, not only the modules that are downloaded.
+	goSum, err := os.ReadFile(filepath.Join(dir, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"golang.org/x/mod v0.3.0 h1:RM4zey1++hCTbCVQfnWeKs9/IEsaBLA8vTkd0WVtmH4=",
+		"golang.org/x/mod v0.3.0/go.mod h1:s0Qsj1ACt9ePp/hMypM3fl4fZqREWJwdYDEqhRiZZUA=",
+		"golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1/go.mod h1:I/5z698sn9Ka8TeJc9MKroUUfqBBauWjQqLJ2OPfmY0=",
+	} {
+		if !strings.Contains(string(goSum), want+"\n") {
+			t.Errorf("go.sum doesn't contain %q:\n%s", want, goSum)
+		}
+	}
+
+	if err := runGazelle(dir, []string{"update-repos", "-to_bzlmod", "-from_file=go.mod"}); err == nil {
+		t.Error("-to_bzlmod with -from_file: got success; want error")
+	}
+}
+
+func TestCgoFlagsHaveExternalPrefix(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path:    "external/com_example_foo_v2/go.mod",
+			Content: "module example.com/foo/v2",
+		}, {
+			Path: "external/com_example_foo_v2/cgo_static.go",
+			Content: `
+package duckdb
+
+/*
+#cgo LDFLAGS: -lstdc++ -lm -ldl -L${SRCDIR}/deps
+*/
+import "C"
+`,
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	repoRoot := filepath.Join(dir, "external", "com_example_foo_v2")
+
+	args := []string{"update", "-repo_root", repoRoot, "-go_prefix", "example.com/foo/v2", "-go_repository_mode", "-go_repository_module_mode"}
+	if err := runGazelle(repoRoot, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, repoRoot, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "foo",
+    srcs = ["cgo_static.go"],
+    cgo = True,
+    clinkopts = ["-lstdc++ -lm -ldl -Lexternal/com_example_foo_v2/deps"],
+    importpath = "example.com/foo/v2",
+    importpath_aliases = ["example.com/foo"],
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+	})
+}
+
+func TestCgoFlagsHaveDotDotPrefixWithSiblingRepositoryLayout(t *testing.T) {
+	files := []testtools.FileSpec{
+		{
+			Path:    "execroot/com_example_foo_v2/go.mod",
+			Content: "module example.com/foo/v2",
+		}, {
+			Path: "execroot/com_example_foo_v2/cgo_static.go",
+			Content: `
+package duckdb
+
+/*
+#cgo LDFLAGS: -lstdc++ -lm -ldl -L${SRCDIR}/deps
+*/
+import "C"
+`,
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	repoRoot := filepath.Join(dir, "execroot", "com_example_foo_v2")
+
+	args := []string{"update", "-repo_root", repoRoot, "-go_prefix", "example.com/foo/v2", "-go_repository_mode", "-go_repository_module_mode"}
+	if err := runGazelle(repoRoot, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, repoRoot, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "foo",
+    srcs = ["cgo_static.go"],
+    cgo = True,
+    clinkopts = ["-lstdc++ -lm -ldl -L../com_example_foo_v2/deps"],
+    importpath = "example.com/foo/v2",
+    importpath_aliases = ["example.com/foo"],
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+	})
+}
+
+func TestStamp(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix example.com/hello",
+		}, {
+			Path:    "hello.go",
+			Content: "package hello",
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	readStamp := func() (stamp string, content []byte) {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(dir, "BUILD.bazel"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, rest, _ := strings.Cut(string(content), "\n")
+		stamp, ok := strings.CutPrefix(line, "# gazelle:stamp ")
+		if !ok {
+			t.Fatalf("got first line %q; want a stamp", line)
+		}
+		if !strings.HasPrefix(rest, "\n") {
+			t.Errorf("stamp not followed by a blank line:\n%s", content)
+		}
+		return stamp, content
+	}
+
+	args := []string{"update", "-stamp"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+	stamp1, content1 := readStamp()
+	if strings.Count(string(content1), "gazelle:stamp") != 1 {
+		t.Errorf("got multiple stamps:\n%s", content1)
+	}
+
+	// Running again without changes should keep the file and stamp as they are.
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+	if _, content2 := readStamp(); string(content2) != string(content1) {
+		t.Errorf("got content:\n%s\nwant:\n%s", content2, content1)
+	}
+
+	// Changing a source file changes the stamp, even though the generated
+	// rules stay the same.
+	if err := os.WriteFile(filepath.Join(dir, "hello.go"), []byte("package hello\n\nconst X = 1\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+	if stamp3, content3 := readStamp(); stamp3 == stamp1 {
+		t.Errorf("stamp did not change after editing a source file:\n%s", content3)
+	} else if strings.Count(string(content3), "gazelle:stamp") != 1 {
+		t.Errorf("got multiple stamps:\n%s", content3)
+	}
+}
+
+func TestStampAfterLicenseHeader(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path: "BUILD.bazel",
+			Content: `# Copyright 2026 The Example Authors. All rights reserved.
+# Use of this source code is governed by a BSD-style license.
+
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:prefix example.com/hello
+`,
+		}, {
+			Path:    "hello.go",
+			Content: "package hello",
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update", "-stamp"}
+	for i := 0; i < 2; i++ {
+		if err := runGazelle(dir, args); err != nil {
+			t.Fatal(err)
+		}
+		content, err := os.ReadFile(filepath.Join(dir, "BUILD.bazel"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(string(content), "\n")
+		want := []string{
+			"# Copyright 2026 The Example Authors. All rights reserved.",
+			"# Use of this source code is governed by a BSD-style license.",
+			"",
+		}
+		if len(lines) < 5 || !cmp.Equal(lines[:3], want) || !strings.HasPrefix(lines[3], "# gazelle:stamp ") || lines[4] != "" {
+			t.Errorf("run %d: want license header, then stamp, then a blank line; got:\n%s", i+1, content)
+		}
+		if strings.Count(string(content), "gazelle:stamp") != 1 {
+			t.Errorf("run %d: got multiple stamps:\n%s", i+1, content)
+		}
+	}
+}
+
+func TestPreserveFormatting(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path: "BUILD.bazel",
+			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+# gazelle:prefix example.com/m
+genrule(name="gen", outs=["gen.txt"],
+        cmd="touch $@")
+go_library(
+    name = "m",
+    srcs = ["a.go"],
+    importpath = "example.com/m",
+    visibility = ["//visibility:public"],
+)
+filegroup(name="all",srcs=glob(["**"]))
+`,
+		},
+		{Path: "a.go", Content: "package m"},
+		{Path: "b.go", Content: "package m"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, []string{"-preserve_formatting"}); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "BUILD.bazel",
+		Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+# gazelle:prefix example.com/m
+genrule(name="gen", outs=["gen.txt"],
+        cmd="touch $@")
+go_library(
+    name = "m",
+    srcs = [
+        "a.go",
+        "b.go",
+    ],
+    importpath = "example.com/m",
+    visibility = ["//visibility:public"],
+)
+filegroup(name="all",srcs=glob(["**"]))
+`,
+	}})
+}
+
+func TestRestrictToArgs(t *testing.T) {
+	// c depends on a, but its dependency on a/sub is missing.
+	cBuild := `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "c",
+    srcs = ["c.go"],
+    importpath = "example.com/m/c",
+    visibility = ["//visibility:public"],
+    deps = ["//a"],
+)
+`
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix example.com/m",
+		},
+		{Path: "a/a.go", Content: "package a"},
+		{Path: "a/sub/sub.go", Content: "package sub"},
+		{Path: "b/b.go", Content: "package b"},
+		{Path: "c/BUILD.bazel", Content: cBuild},
+		{
+			Path: "c/c.go",
+			Content: `package c
+
+import (
+	_ "example.com/m/a"
+	_ "example.com/m/a/sub"
+)
+`,
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update", "-restrict_to_args", "a"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"a/BUILD.bazel", "a/sub/BUILD.bazel"} {
+		if _, err := os.Stat(filepath.Join(dir, path)); err != nil {
+			t.Errorf("%s was not generated: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b/BUILD.bazel")); err == nil {
+		t.Errorf("b/BUILD.bazel was generated outside the requested directories")
+	}
+
+	// With -changed_files, directories with rules that depend on changed
+	// packages are updated too, so c/BUILD.bazel would change.
+	args = []string{"update", "-restrict_to_args", "-changed_files=a/a.go"}
+	if err := runGazelle(dir, args); err == nil || !strings.Contains(err.Error(), filepath.Join("c", "BUILD.bazel")) {
+		t.Fatalf("got error %v; want error about c/BUILD.bazel", err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{Path: "c/BUILD.bazel", Content: cBuild}})
+}
+
+func TestMaxFileChanges(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{Path: "BUILD.bazel", Content: "# gazelle:prefix example.com/m\n"},
+		{Path: "a/a.go", Content: "package a"},
+		{Path: "b/b.go", Content: "package b"},
+		{Path: "c/c.go", Content: "package c"},
+	})
+	defer cleanup()
+
+	err := runGazelle(dir, []string{"-max_file_changes=2"})
+	if err == nil || !strings.Contains(err.Error(), "3 build files would change") {
+		t.Fatalf("got error %v; want error about 3 changed build files", err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := os.Stat(filepath.Join(dir, name, "BUILD.bazel")); !os.IsNotExist(err) {
+			t.Errorf("%s/BUILD.bazel was written; want no build files written", name)
+		}
+	}
+
+	if err := runGazelle(dir, []string{"-max_file_changes=2", "-force"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := os.Stat(filepath.Join(dir, name, "BUILD.bazel")); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Runs that change no more files than the limit succeed.
+	if err := os.WriteFile(filepath.Join(dir, "a", "x.go"), []byte("package a"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGazelle(dir, []string{"-max_file_changes=1"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeableAttrDirective(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path: "BUILD.bazel",
+			Content: `
+# gazelle:prefix example.com/m
+`,
+		}, {
+			Path: "a/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:mergeable_attr go_library visibility
+
+go_library(
+    name = "a",
+    srcs = ["a.go"],
+    importpath = "example.com/m/a",
+    visibility = ["//b:__pkg__"],
+)
+`,
+		},
+		{Path: "a/a.go", Content: "package a"},
+		{
+			Path: "b/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "b",
+    srcs = ["b.go"],
+    importpath = "example.com/m/b",
+    visibility = ["//a:__pkg__"],
+)
+`,
+		},
+		{Path: "b/b.go", Content: "package b"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, []string{"update"}); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "a/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:mergeable_attr go_library visibility
 
 go_library(
-    name = "go_default_library",
-    srcs = ["file.go"],
-    importpath = "example.com/mapkind/dir",
+    name = "a",
+    srcs = ["a.go"],
+    importpath = "example.com/m/a",
     visibility = ["//visibility:public"],
 )
 `,
-				},
-				{
-					Path:    "dir/file.go",
-					Content: "package dir",
-				},
-			},
-			after: []testtools.FileSpec{
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("//custom:def.bzl", "custom_go_library")
+		}, {
+			Path: "b/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-custom_go_library(
-    name = "go_default_library",
-    srcs = ["file.go"],
-    importpath = "example.com/mapkind/dir",
-    visibility = ["//visibility:public"],
+go_library(
+    name = "b",
+    srcs = ["b.go"],
+    importpath = "example.com/m/b",
+    visibility = ["//a:__pkg__"],
 )
 `,
-				},
-			},
 		},
-		"existing generated rule with renaming mapping applied preserves map_kind": {
-			before: []testtools.FileSpec{
-				{
-					Path: "WORKSPACE",
-				},
-				{
-					Path: "BUILD.bazel",
-					Content: `# gazelle:prefix example.com/mapkind
-# gazelle:go_naming_convention go_default_library
-# gazelle:map_kind go_library custom_go_library //custom:def.bzl
-`,
-				},
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("//custom:def.bzl", "custom_go_library")
+	})
+}
 
-custom_go_library(
-    name = "go_default_library",
-    srcs = ["file.go"],
-    importpath = "example.com/mapkind/dir",
-    visibility = ["//visibility:public"],
-)
+func TestMergeableAttrDirectiveMappedKind(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path: "BUILD.bazel",
+			Content: `
+# gazelle:prefix example.com/m
+# gazelle:map_kind go_library my_go_library //tools:def.bzl
+# gazelle:mergeable_attr my_go_library lint_config
 `,
-				},
-				{
-					Path:    "dir/file.go",
-					Content: "package dir",
-				},
-			},
-			after: []testtools.FileSpec{
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("//custom:def.bzl", "custom_go_library")
+		}, {
+			Path: "a/BUILD.bazel",
+			Content: `
+load("//tools:def.bzl", "my_go_library")
 
-custom_go_library(
-    name = "go_default_library",
-    srcs = ["file.go"],
-    importpath = "example.com/mapkind/dir",
+my_go_library(
+    name = "a",
+    srcs = [
+        "a.go",
+        "old.go",
+    ],
+    importpath = "example.com/m/a",
+    lint_config = "//lint:strict",
     visibility = ["//visibility:public"],
 )
 `,
-				},
-			},
 		},
-		"unrelated non-generated non-map_kind'd rule of same kind applies map_kind if other rule is generated": {
-			before: []testtools.FileSpec{
-				{
-					Path: "WORKSPACE",
-				},
-				{
-					Path: "BUILD.bazel",
-					Content: `# gazelle:prefix example.com/mapkind
-# gazelle:go_naming_convention go_default_library
-# gazelle:map_kind go_library go_library //custom:def.bzl
-		`,
-				},
-				{
-					Path:    "dir/file.go",
-					Content: "package dir",
-				},
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+		{Path: "a/a.go", Content: "package a"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
 
-go_library(
-    name = "custom_lib",
-    srcs = ["custom_lib.go"],
-)
-`,
-				},
-			},
-			after: []testtools.FileSpec{
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("//custom:def.bzl", "go_library")
+	if err := runGazelle(dir, []string{"update"}); err != nil {
+		t.Fatal(err)
+	}
 
-go_library(
-    name = "custom_lib",
-    srcs = ["custom_lib.go"],
-)
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "a/BUILD.bazel",
+		Content: `
+load("//tools:def.bzl", "my_go_library")
 
-go_library(
-    name = "go_default_library",
-    srcs = ["file.go"],
-    importpath = "example.com/mapkind/dir",
+my_go_library(
+    name = "a",
+    srcs = ["a.go"],
+    importpath = "example.com/m/a",
+    lint_config = "//lint:strict",
     visibility = ["//visibility:public"],
 )
 `,
-				},
-			},
-		},
-		"unrelated non-generated non-renaming map_kind'd rule of same kind keeps map_kind if other rule is generated": {
-			before: []testtools.FileSpec{
-				{
-					Path: "WORKSPACE",
-				},
-				{
-					Path: "BUILD.bazel",
-					Content: `# gazelle:prefix example.com/mapkind
-# gazelle:go_naming_convention go_default_library
-# gazelle:map_kind go_library go_library //custom:def.bzl
-		`,
-				},
-				{
-					Path:    "dir/file.go",
-					Content: "package dir",
-				},
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("//custom:def.bzl", "go_library")
+	}})
+}
 
-go_library(
-    name = "custom_lib",
-    srcs = ["custom_lib.go"],
-)
+func TestGoLibraryNameDirective(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path: "BUILD.bazel",
+			Content: `
+# gazelle:prefix example.com/m
 `,
-				},
-			},
-			after: []testtools.FileSpec{
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("//custom:def.bzl", "go_library")
+		}, {
+			Path: "a/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
-go_library(
-    name = "custom_lib",
-    srcs = ["custom_lib.go"],
-)
+# gazelle:go_library_name mylib
 
 go_library(
-    name = "go_default_library",
-    srcs = ["file.go"],
-    importpath = "example.com/mapkind/dir",
+    name = "a",
+    srcs = ["a.go"],
+    importpath = "example.com/m/a",
     visibility = ["//visibility:public"],
 )
-`,
-				},
-			},
-		},
-		"unrelated non-generated non-renaming map_kind'd rule keeps map_kind if other generated rule is newly generated": {
-			before: []testtools.FileSpec{
-				{
-					Path: "WORKSPACE",
-				},
-				{
-					Path: "BUILD.bazel",
-					Content: `# gazelle:prefix example.com/mapkind
-# gazelle:go_naming_convention go_default_library
-# gazelle:map_kind go_library go_library //custom:def.bzl
-# gazelle:map_kind go_test go_test //custom:def.bzl
-		`,
-				},
-				{
-					Path:    "dir/file.go",
-					Content: "package dir",
-				},
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("//custom:def.bzl", "go_test")
 
 go_test(
-    name = "custom_test",
-    srcs = ["custom_test.java"],
+    name = "a_test",
+    srcs = ["a_test.go"],
+    embed = [":a"],
 )
 `,
-				},
-			},
-			after: []testtools.FileSpec{
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("//custom:def.bzl", "go_library", "go_test")
-
-go_test(
-    name = "custom_test",
-    srcs = ["custom_test.java"],
-)
+		},
+		{Path: "a/a.go", Content: "package a"},
+		{Path: "a/a_test.go", Content: "package a"},
+		{Path: "a/sub/sub.go", Content: "package sub"},
+		{
+			Path: "b/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
 go_library(
-    name = "go_default_library",
-    srcs = ["file.go"],
-    importpath = "example.com/mapkind/dir",
+    name = "b",
+    srcs = ["b.go"],
+    importpath = "example.com/m/b",
     visibility = ["//visibility:public"],
+    deps = ["//a"],
 )
 `,
-				},
-			},
 		},
-		"unrelated non-generated non-renaming map_kind'd rule keeps map_kind if other generated rule already existed": {
-			before: []testtools.FileSpec{
-				{
-					Path: "WORKSPACE",
-				},
-				{
-					Path: "BUILD.bazel",
-					Content: `# gazelle:prefix example.com/mapkind
-# gazelle:go_naming_convention go_default_library
-# gazelle:map_kind go_library go_library //custom:def.bzl
-# gazelle:map_kind go_test go_test //custom:def.bzl
+		{
+			Path: "b/b.go",
+			Content: `
+package b
+
+import _ "example.com/m/a"
 `,
-				},
-				{
-					Path:    "dir/file.go",
-					Content: "package dir",
-				},
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("//custom:def.bzl", "go_library", "go_test")
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
 
-go_test(
-    name = "custom_test",
-    srcs = ["custom_test.java"],
-)
+	if err := runGazelle(dir, []string{"update"}); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "a/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+
+# gazelle:go_library_name mylib
 
 go_library(
-    name = "go_default_library",
-    srcs = ["file.go"],
-    importpath = "example.com/mapkind/dir",
+    name = "mylib",
+    srcs = ["a.go"],
+    importpath = "example.com/m/a",
     visibility = ["//visibility:public"],
 )
-`,
-				},
-			},
-			after: []testtools.FileSpec{
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("//custom:def.bzl", "go_library", "go_test")
 
 go_test(
-    name = "custom_test",
-    srcs = ["custom_test.java"],
+    name = "a_test",
+    srcs = ["a_test.go"],
+    embed = [":mylib"],
 )
+`,
+		}, {
+			Path: "a/sub/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
 go_library(
-    name = "go_default_library",
-    srcs = ["file.go"],
-    importpath = "example.com/mapkind/dir",
+    name = "sub",
+    srcs = ["sub.go"],
+    importpath = "example.com/m/a/sub",
     visibility = ["//visibility:public"],
 )
 `,
-				},
-			},
-		},
-		"transitive remappings are applied": {
-			before: []testtools.FileSpec{
-				{
-					Path: "WORKSPACE",
-				},
-				{
-					Path: "BUILD.bazel",
-					Content: `# gazelle:prefix example.com/mapkind
-# gazelle:go_naming_convention go_default_library
-# gazelle:map_kind go_library custom_go_library //custom:def.bzl
-		`,
-				},
-				{
-					Path:    "dir/file.go",
-					Content: "package dir",
-				},
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `# gazelle:map_kind custom_go_library other_custom_go_library //another/custom:def.bzl
-`,
-				},
-			},
-			after: []testtools.FileSpec{
-				{
-					Path: "dir/BUILD.bazel",
-					Content: `load("//another/custom:def.bzl", "other_custom_go_library")
-
-# gazelle:map_kind custom_go_library other_custom_go_library //another/custom:def.bzl
+		}, {
+			Path: "b/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-other_custom_go_library(
-    name = "go_default_library",
-    srcs = ["file.go"],
-    importpath = "example.com/mapkind/dir",
+go_library(
+    name = "b",
+    srcs = ["b.go"],
+    importpath = "example.com/m/b",
     visibility = ["//visibility:public"],
+    deps = ["//a:mylib"],
 )
 `,
-				},
-			},
 		},
-	} {
-		t.Run(name, func(t *testing.T) {
-			dir, cleanup := testtools.CreateFiles(t, tc.before)
-			t.Cleanup(cleanup)
-			if err := runGazelle(dir, []string{"-external=vendored"}); err != nil {
-				t.Fatal(err)
-			}
-			testtools.CheckFiles(t, dir, tc.after)
-		})
-	}
+	})
 }
 
-func TestMapKindLoop(t *testing.T) {
-	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
-		{
-			Path: "WORKSPACE",
-		},
+func TestGoLibraryNameDirectiveNoIndex(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
 			Path: "BUILD.bazel",
-			Content: `# gazelle:prefix example.com/mapkind
-# gazelle:go_naming_convention go_default_library
-# gazelle:map_kind go_library custom_go_library //custom:def.bzl
-		`,
-		},
-		{
-			Path:    "dir/file.go",
-			Content: "package dir",
+			Content: `
+# gazelle:prefix example.com/m
+`,
+		}, {
+			Path: "a/BUILD.bazel",
+			Content: `
+# gazelle:go_library_name mylib
+`,
 		},
+		{Path: "a/a.go", Content: "package a"},
 		{
-			Path: "dir/BUILD.bazel",
-			Content: `# gazelle:map_kind custom_go_library go_library @io_bazel_rules_go//go:def.bzl
+			Path: "b/b.go",
+			Content: `
+package b
+
+import _ "example.com/m/a"
 `,
 		},
-	})
-	t.Cleanup(cleanup)
-	err := runGazelle(dir, []string{"-external=vendored"})
-	if err == nil {
-		t.Fatal("Expected error running gazelle with map_kind loop")
 	}
-	msg := err.Error()
-	if !strings.Contains(msg, "looking up mapped kind: found loop of map_kind replacements: go_library -> custom_go_library -> go_library") {
-		t.Fatalf("Expected error to contain useful descriptors but was %q", msg)
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, []string{"update", "-index=false"}); err != nil {
+		t.Fatal(err)
 	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "b/BUILD.bazel",
+		Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "b",
+    srcs = ["b.go"],
+    importpath = "example.com/m/b",
+    visibility = ["//visibility:public"],
+    deps = ["//a:mylib"],
+)
+`,
+	}})
 }
 
-// TestMapKindEmbeddedResolve tests the gazelle:map_kind properly resolves
-// dependencies for embedded rules (see #1162).
-func TestMapKindEmbeddedResolve(t *testing.T) {
+func TestGoLibraryNameDirectiveAfterReset(t *testing.T) {
 	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path: "WORKSPACE",
-		}, {
 			Path: "BUILD.bazel",
 			Content: `
-# gazelle:prefix example.com/mapkind
-# gazelle:map_kind go_library my_go_library //:my.bzl
+# gazelle:prefix example.com/m
+# gazelle:map_kind go_test my_test //:my.bzl
 `,
 		}, {
-			Path: "a/a.proto",
+			Path: "a/BUILD.bazel",
 			Content: `
-syntax = "proto3";
-
-package test;
-option go_package = "example.com/mapkind/a";
+# gazelle:reset map_kind
+# gazelle:go_library_name pinned
 `,
-		}, {
-			Path: "b/b.proto",
+		},
+		{Path: "a/a.go", Content: "package a"},
+		{
+			Path: "c/c.go",
 			Content: `
-syntax = "proto3";
-
-package test;
-option go_package = "example.com/mapkind/b";
+package c
 
-import "a/a.proto";
+import _ "example.com/m/a"
 `,
 		},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	if err := runGazelle(dir, []string{"-external=vendored"}); err != nil {
+	if err := runGazelle(dir, []string{"update", "-index=false"}); err != nil {
 		t.Fatal(err)
 	}
 
-	testtools.CheckFiles(t, dir, []testtools.FileSpec{
-		{
-			Path: "a/BUILD.bazel",
-			Content: `
-load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
-load("@rules_proto//proto:defs.bzl", "proto_library")
-load("//:my.bzl", "my_go_library")
-
-proto_library(
-    name = "a_proto",
-    srcs = ["a.proto"],
-    visibility = ["//visibility:public"],
-)
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "c/BUILD.bazel",
+		Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-go_proto_library(
-    name = "a_go_proto",
-    importpath = "example.com/mapkind/a",
-    proto = ":a_proto",
+go_library(
+    name = "c",
+    srcs = ["c.go"],
+    importpath = "example.com/m/c",
     visibility = ["//visibility:public"],
+    deps = ["//a:pinned"],
 )
+`,
+	}})
+}
 
-my_go_library(
-    name = "a",
-    embed = [":a_go_proto"],
-    importpath = "example.com/mapkind/a",
-    visibility = ["//visibility:public"],
-)
+// TestInvalidGoDirectiveReportedOnce checks that an invalid value of a
+// declared Go directive is reported once by walk, even when a reset in a
+// subdirectory configures the root directory again.
+func TestInvalidGoDirectiveReportedOnce(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path: "BUILD.bazel",
+			Content: `
+# gazelle:prefix example.com/m
+# gazelle:go_group_deps maybe
+# gazelle:map_kind go_test my_test //:my.bzl
 `,
+		}, {
+			Path:    "a/BUILD.bazel",
+			Content: "# gazelle:reset map_kind\n",
 		},
+		{Path: "a/a.go", Content: "package a"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+	if err := runGazelle(dir, []string{"update", "-index=false"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `directive gazelle:go_group_deps: invalid bool value "maybe"`
+	if n := strings.Count(buf.String(), want); n != 1 {
+		t.Errorf("log contains %q %d times; want 1\n--begin--\n%s--end--\n", want, n, buf.String())
+	}
+}
+
+func TestGoWork(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path: "b/BUILD.bazel",
+			Path: "go.work",
 			Content: `
-load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
-load("@rules_proto//proto:defs.bzl", "proto_library")
-load("//:my.bzl", "my_go_library")
-
-proto_library(
-    name = "b_proto",
-    srcs = ["b.proto"],
-    visibility = ["//visibility:public"],
-    deps = ["//a:a_proto"],
-)
+go 1.21
 
-go_proto_library(
-    name = "b_go_proto",
-    importpath = "example.com/mapkind/b",
-    proto = ":b_proto",
-    visibility = ["//visibility:public"],
-    deps = ["//a"],
+use (
+	./lib
+	./tools
 )
+`,
+		},
+		{Path: "lib/go.mod", Content: "module example.com/lib\n\ngo 1.21\n"},
+		{Path: "lib/lib.go", Content: "package lib"},
+		{Path: "lib/sub/sub.go", Content: "package sub"},
+		{Path: "tools/go.mod", Content: "module example.com/tools\n\ngo 1.21\n"},
+		{
+			Path: "tools/cmd/tool/main.go",
+			Content: `
+package main
 
-my_go_library(
-    name = "b",
-    embed = [":b_go_proto"],
-    importpath = "example.com/mapkind/b",
-    visibility = ["//visibility:public"],
+import (
+	_ "example.com/lib"
+	_ "example.com/lib/notyet"
+	_ "example.com/lib/sub"
 )
-`,
-		},
-	})
-}
 
-// TestMinimalModuleCompatibilityAliases checks that importpath_aliases
-// are emitted for go_libraries when needed. This can't easily be checked
-// in language/go because the generator tests don't support running at
-// the repository root or with additional flags, both of which are required.
-func TestMinimalModuleCompatibilityAliases(t *testing.T) {
-	files := []testtools.FileSpec{
-		{
-			Path:    "go.mod",
-			Content: "module example.com/foo/v2",
-		}, {
-			Path:    "foo.go",
-			Content: "package foo",
-		}, {
-			Path:    "bar/bar.go",
-			Content: "package bar",
+func main() {}
+`,
 		},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{"update", "-repo_root", dir, "-go_prefix", "example.com/foo/v2", "-go_repository_mode", "-go_repository_module_mode"}
-	if err := runGazelle(dir, args); err != nil {
+	if err := runGazelle(dir, []string{"update"}); err != nil {
 		t.Fatal(err)
 	}
 
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "BUILD.bazel",
+			Path: "lib/BUILD.bazel",
 			Content: `
 load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
 go_library(
-    name = "foo",
-    srcs = ["foo.go"],
-    importpath = "example.com/foo/v2",
-    importpath_aliases = ["example.com/foo"],
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
     visibility = ["//visibility:public"],
 )
 `,
 		}, {
-			Path: "bar/BUILD.bazel",
+			Path: "lib/sub/BUILD.bazel",
 			Content: `
 load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
 go_library(
-    name = "bar",
-    srcs = ["bar.go"],
-    importpath = "example.com/foo/v2/bar",
-    importpath_aliases = ["example.com/foo/bar"],
+    name = "sub",
+    srcs = ["sub.go"],
+    importpath = "example.com/lib/sub",
+    visibility = ["//visibility:public"],
+)
+`,
+		}, {
+			Path: "tools/cmd/tool/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library")
+
+go_library(
+    name = "tool_lib",
+    srcs = ["main.go"],
+    importpath = "example.com/tools/cmd/tool",
+    visibility = ["//visibility:private"],
+    deps = [
+        "//lib",
+        "//lib/notyet",
+        "//lib/sub",
+    ],
+)
+
+go_binary(
+    name = "tool",
+    embed = [":tool_lib"],
     visibility = ["//visibility:public"],
 )
 `,
@@ -3127,598 +7076,850 @@ go_library(
 	})
 }
 
-// TestGoImportVisibility checks that submodules implicitly declared with
-// go_repository rules in the repo config file (WORKSPACE) have visibility
-// for rules generated in internal directories where appropriate.
-// Verifies #619.
-func TestGoImportVisibility(t *testing.T) {
+func TestNestedGoModules(t *testing.T) {
 	files := []testtools.FileSpec{
 		{
 			Path: "WORKSPACE",
 			Content: `
 go_repository(
-		name = "com_example_m_logging",
-    importpath = "example.com/m/logging",
+    name = "com_example_repo_lib",
+    importpath = "example.com/repo/lib",
 )
 `,
-		}, {
-			Path:    "internal/version/version.go",
-			Content: "package version",
-		}, {
-			Path:    "internal/version/version_test.go",
-			Content: "package version",
 		},
+		{
+			Path: "BUILD.bazel",
+			Content: `# gazelle:go_module_boundaries true
+# gazelle:resolve go example.com/tools/y //tools/y
+`,
+		},
+		{Path: "go.mod", Content: "module example.com/repo\n\ngo 1.21\n"},
+		{
+			Path: "app/app.go",
+			Content: `
+package app
+
+import (
+	_ "example.com/repo/lib"
+	_ "example.com/repo/util"
+	_ "example.com/tools/y"
+)
+`,
+		},
+		{Path: "util/util.go", Content: "package util"},
+		{Path: "lib/go.mod", Content: "module example.com/repo/lib\n\ngo 1.21\n"},
+		{Path: "lib/lib.go", Content: "package lib"},
+		{Path: "tools/go.mod", Content: "module example.com/tools\n\ngo 1.21\n"},
+		{Path: "tools/y/y.go", Content: "package y"},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{"update", "-go_prefix", "example.com/m"}
-	if err := runGazelle(dir, args); err != nil {
+	if err := runGazelle(dir, []string{"update"}); err != nil {
 		t.Fatal(err)
 	}
 
-	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
-		Path: "internal/version/BUILD.bazel",
-		Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "app/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
 go_library(
-    name = "version",
-    srcs = ["version.go"],
-    importpath = "example.com/m/internal/version",
-    visibility = [
-        "//:__subpackages__",
-        "@com_example_m_logging//:__subpackages__",
+    name = "app",
+    srcs = ["app.go"],
+    importpath = "example.com/repo/app",
+    visibility = ["//visibility:public"],
+    deps = [
+        "//tools/y",
+        "//util",
+        "@com_example_repo_lib//:lib",
     ],
 )
+`,
+		}, {
+			Path: "lib/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/repo/lib",
+    visibility = ["//visibility:public"],
+)
+`,
+		}, {
+			Path: "tools/y/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-go_test(
-    name = "version_test",
-    srcs = ["version_test.go"],
-    embed = [":version"],
+go_library(
+    name = "y",
+    srcs = ["y.go"],
+    importpath = "example.com/tools/y",
+    visibility = ["//visibility:public"],
 )
 `,
-	}})
+		},
+	})
 }
 
-// TestGoInternalVisibility_TopLevel checks that modules that are
-// named internal/ expand visibility to repos that have a sibling
-// importpath.
-//
-// Verifies #960
-func TestGoInternalVisibility_TopLevel(t *testing.T) {
+func TestGoMinimumRulesGo(t *testing.T) {
 	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{Path: "BUILD.bazel", Content: "# gazelle:prefix example.com/m\n"},
 		{
-			Path:    "WORKSPACE",
-			Content: `go_repository(name="org_modernc_ccgo", importpath="modernc.org/ccgo")`,
-		}, {
-			Path:    "BUILD.bazel",
-			Content: `# gazelle:prefix modernc.org/internal`,
-		}, {
-			Path:    "internal.go",
-			Content: "package internal",
-		}, {
-			Path:    "buffer/buffer.go",
-			Content: "package buffer",
-		},
-	}
-	dir, cleanup := testtools.CreateFiles(t, files)
-	defer cleanup()
+			Path: "a/a.go",
+			Content: `
+package a
 
-	args := []string{"update"}
-	if err := runGazelle(dir, args); err != nil {
-		t.Fatal(err)
+import _ "embed"
+
+//go:embed a.txt
+var s string
+`,
+		},
+		{Path: "a/a.txt"},
 	}
 
-	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+	for _, tc := range []struct {
+		desc, want string
+		args       []string
+	}{
 		{
-			Path: "BUILD.bazel",
-			Content: `
+			desc: "old",
+			args: []string{"-go_minimum_rules_go=0.26.0"},
+			want: `
 load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-# gazelle:prefix modernc.org/internal
-
 go_library(
-    name = "internal",
-    srcs = ["internal.go"],
-    importpath = "modernc.org/internal",
-    visibility = [
-        "//:__subpackages__",
-        "@org_modernc_ccgo//:__subpackages__",
-    ],
+    name = "a",
+    srcs = ["a.go"],
+    importpath = "example.com/m/a",
+    visibility = ["//visibility:public"],
 )
 `,
-		},
-		{
-			Path: "buffer/BUILD.bazel",
-			Content: `
+		}, {
+			desc: "flag",
+			args: []string{"-go_minimum_rules_go=0.26.0", "-go_feature_flags=embedsrcs"},
+			want: `
 load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
 go_library(
-    name = "buffer",
-    srcs = ["buffer.go"],
-    importpath = "modernc.org/internal/buffer",
-    visibility = [
-        "//:__subpackages__",
-        "@org_modernc_ccgo//:__subpackages__",
-    ],
+    name = "a",
+    srcs = ["a.go"],
+    embedsrcs = ["a.txt"],
+    importpath = "example.com/m/a",
+    visibility = ["//visibility:public"],
 )
 `,
 		},
-	})
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			dir, cleanup := testtools.CreateFiles(t, files)
+			defer cleanup()
+
+			if err := runGazelle(dir, append([]string{"update"}, tc.args...)); err != nil {
+				t.Fatal(err)
+			}
+			testtools.CheckFiles(t, dir, []testtools.FileSpec{{Path: "a/BUILD.bazel", Content: tc.want}})
+		})
+	}
 }
 
-func TestImportCollision(t *testing.T) {
+func TestMigrateWorkspace(t *testing.T) {
 	files := []testtools.FileSpec{
 		{
 			Path: "WORKSPACE",
-		},
-		{
-			Path: "go.mod",
 			Content: `
-module example.com/importcases
+load("@bazel_gazelle//:deps.bzl", "go_repository")
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+load("//:deps.bzl", "go_deps")
 
-go 1.13
+# gazelle:repository_macro deps.bzl%go_deps
+go_deps()
 
-require (
-	github.com/Selvatico/go-mocket v1.0.7
-	github.com/selvatico/go-mocket v1.0.7
+http_archive(
+    name = "io_bazel_rules_go",
+    urls = ["https://example.com/rules_go.zip"],
+)
+
+go_repository(
+    name = "com_example_unused",
+    importpath = "example.com/unused",
+    sum = "h1:unused",
+    version = "v1.0.0",
+)
+
+go_repository(
+    name = "com_example_vcs",
+    commit = "abc123",
+    importpath = "example.com/vcs",
+    remote = "https://example.com/vcs.git",
+    vcs = "git",
+)
+
+go_repository(
+    name = "com_github_a_b",
+    importpath = "github.com/a/b",
+    sum = "h1:ab",
+    version = "v1.0.0",
+)
+
+go_repository(
+    name = "custom",
+    build_file_proto_mode = "disable",
+    importpath = "github.com/c/d",
+    sum = "h1:cd",
+    version = "v1.0.0",
 )
 `,
 		},
 		{
-			Path: "go.sum",
+			Path: "deps.bzl",
 			Content: `
-github.com/Selvatico/go-mocket v1.0.7/go.mod h1:4gO2v+uQmsL+jzQgLANy3tyEFzaEzHlymVbZ3GP2Oes=
-github.com/selvatico/go-mocket v1.0.7/go.mod h1:7bSWzuNieCdUlanCVu3w0ppS0LvDtPAZmKBIlhoTcp8=
-`,
-		},
-	}
-	dir, cleanup := testtools.CreateFiles(t, files)
-	defer cleanup()
-
-	args := []string{"update-repos", "--from_file=go.mod"}
-	errMsg := "imports github.com/Selvatico/go-mocket and github.com/selvatico/go-mocket resolve to the same repository rule name com_github_selvatico_go_mocket"
-	if err := runGazelle(dir, args); err == nil {
-		t.Fatal("expected error, got nil")
-	} else if err.Error() != errMsg {
-		t.Errorf("want %s, got %s", errMsg, err.Error())
-	}
-}
+load("@bazel_gazelle//:deps.bzl", "go_repository")
 
-func TestImportCollisionWithReplace(t *testing.T) {
-	files := []testtools.FileSpec{
-		{
-			Path:    "WORKSPACE",
-			Content: "# gazelle:repo bazel_gazelle",
+def go_deps():
+    go_repository(
+        name = "org_golang_x_mod",
+        build_directives = ["gazelle:exclude testdata"],
+        importpath = "golang.org/x/mod",
+        sum = "h1:mod",
+        version = "v0.1.0",
+    )
+`,
 		},
 		{
 			Path: "go.mod",
 			Content: `
-module github.com/linzhp/go_examples/importcases
+module example.com/m
 
-go 1.13
+go 1.21
 
 require (
-	github.com/Selvatico/go-mocket v1.0.7
-	github.com/selvatico/go-mocket v0.0.0-00010101000000-000000000000
+	example.com/vcs v1.0.0
+	github.com/a/b v1.0.0
+	github.com/c/d v1.0.0
+	golang.org/x/mod v0.2.0
 )
-
-replace github.com/selvatico/go-mocket => github.com/Selvatico/go-mocket v1.0.7
 `,
 		},
 		{
 			Path: "go.sum",
-			Content: `
-github.com/Selvatico/go-mocket v1.0.7/go.mod h1:4gO2v+uQmsL+jzQgLANy3tyEFzaEzHlymVbZ3GP2Oes=
+			Content: `github.com/a/b v1.0.0 h1:other
+github.com/a/b v1.0.0/go.mod h1:abmod
+github.com/c/d v1.0.0 h1:cd
 `,
 		},
+		{
+			Path:    "MODULE.bazel",
+			Content: `bazel_dep(name = "gazelle", version = "0.40.0", repo_name = "bazel_gazelle")`,
+		},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{"update-repos", "--from_file=go.mod"}
-	if err := runGazelle(dir, args); err != nil {
+	if err := runGazelle(dir, []string{"migrate-workspace", "-report=report.txt"}); err != nil {
 		t.Fatal(err)
 	}
+
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
+			Path: "MODULE.bazel",
+			Content: `
+bazel_dep(name = "gazelle", version = "0.40.0", repo_name = "bazel_gazelle")
+
+go_deps = use_extension("@bazel_gazelle//:extensions.bzl", "go_deps")
+go_deps.from_file(go_mod = "//:go.mod")
+go_deps.gazelle_override(
+    build_file_generation = "auto",
+    directives = ["gazelle:proto disable"],
+    path = "github.com/c/d",
+)
+go_deps.gazelle_override(
+    build_file_generation = "auto",
+    directives = [
+        "gazelle:exclude testdata",
+        "gazelle:proto default",
+    ],
+    path = "golang.org/x/mod",
+)
+use_repo(go_deps, "com_github_a_b", "org_golang_x_mod", custom = "com_github_c_d")
+`,
+		}, {
 			Path: "WORKSPACE",
 			Content: `
 load("@bazel_gazelle//:deps.bzl", "go_repository")
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+load("//:deps.bzl", "go_deps")
 
-# gazelle:repo bazel_gazelle
+# gazelle:repository_macro deps.bzl%go_deps
+go_deps()
+
+http_archive(
+    name = "io_bazel_rules_go",
+    urls = ["https://example.com/rules_go.zip"],
+)
 
 go_repository(
-    name = "com_github_selvatico_go_mocket",
-    importpath = "github.com/selvatico/go-mocket",
-    replace = "github.com/Selvatico/go-mocket",
-    sum = "h1:sXuFMnMfVL9b/Os8rGXPgbOFbr4HJm8aHsulD/uMTUk=",
-    version = "v1.0.7",
+    name = "com_example_unused",
+    importpath = "example.com/unused",
+    sum = "h1:unused",
+    version = "v1.0.0",
+)
+
+go_repository(
+    name = "com_example_vcs",
+    commit = "abc123",
+    importpath = "example.com/vcs",
+    remote = "https://example.com/vcs.git",
+    vcs = "git",
 )
+`,
+		}, {
+			Path: "deps.bzl",
+			Content: `
+def go_deps():
+    pass
+`,
+		}, {
+			Path: "report.txt",
+			Content: `migrated 3 go_repository rules to MODULE.bazel
+migrated, but go_deps will use the version from go.mod and go.sum:
+  go_repository "com_github_a_b": sum h1:ab differs from h1:other in go.sum
+  go_repository "org_golang_x_mod": version v0.1.0 differs from v0.2.0 in go.mod
+not migrated:
+  go_repository "com_example_unused": example.com/unused is not required in go.mod; add it with go get
+  go_repository "com_example_vcs": no go_deps equivalent for commit, remote, vcs
+  http_archive "io_bazel_rules_go": only go_repository rules are migrated; use bazel_dep or a module extension
 `,
 		},
 	})
 }
 
-// TestUpdateReposWithGlobalBuildTags is a regresion test for issue #711.
-// It also ensures that existings build_tags get merged with requested build_tags.
-func TestUpdateReposWithGlobalBuildTags(t *testing.T) {
+func TestMigrateWorkspaceExistingGoDeps(t *testing.T) {
 	files := []testtools.FileSpec{
 		{
 			Path: "WORKSPACE",
 			Content: `
 load("@bazel_gazelle//:deps.bzl", "go_repository")
 
-# gazelle:repo bazel_gazelle
+go_repository(
+    name = "com_github_a_b",
+    importpath = "github.com/a/b",
+    sum = "h1:ab",
+    version = "v1.0.0",
+)
 
 go_repository(
-    name = "com_github_selvatico_go_mocket",
-    build_tags = [
-        "bar",
-    ],
-    importpath = "github.com/selvatico/go-mocket",
-    replace = "github.com/Selvatico/go-mocket",
-    sum = "h1:sXuFMnMfVL9b/Os8rGXPgbOFbr4HJm8aHsulD/uMTUk=",
-    version = "v1.0.7",
+    name = "com_github_c_d",
+    importpath = "github.com/c/d",
+    sum = "h1:cd",
+    version = "v1.0.0",
 )
 `,
 		},
 		{
 			Path: "go.mod",
 			Content: `
-module github.com/linzhp/go_examples/importcases
+module example.com/m
 
-go 1.13
+go 1.21
 
 require (
-	github.com/Selvatico/go-mocket v1.0.7
-	github.com/selvatico/go-mocket v0.0.0-00010101000000-000000000000
+	github.com/a/b v1.0.0
+	github.com/c/d v1.0.0
 )
-
-replace github.com/selvatico/go-mocket => github.com/Selvatico/go-mocket v1.0.7
 `,
 		},
 		{
-			Path: "go.sum",
+			Path: "MODULE.bazel",
 			Content: `
-github.com/Selvatico/go-mocket v1.0.7/go.mod h1:4gO2v+uQmsL+jzQgLANy3tyEFzaEzHlymVbZ3GP2Oes=
+bazel_dep(name = "gazelle", version = "0.40.0")
+
+go_deps = use_extension("@gazelle//:extensions.bzl", "go_deps")
+go_deps.from_file(go_mod = "//:go.mod")
+use_repo(go_deps, "com_github_a_b")
 `,
 		},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{"update-repos", "--from_file=go.mod", "--build_tags=bar,foo"}
-	if err := runGazelle(dir, args); err != nil {
+	if err := runGazelle(dir, []string{"migrate-workspace", "-report=report.txt"}); err != nil {
 		t.Fatal(err)
 	}
+
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "WORKSPACE",
+			Path: "MODULE.bazel",
 			Content: `
-load("@bazel_gazelle//:deps.bzl", "go_repository")
-
-# gazelle:repo bazel_gazelle
+bazel_dep(name = "gazelle", version = "0.40.0")
 
-go_repository(
-    name = "com_github_selvatico_go_mocket",
-    build_tags = [
-        "bar",
-        "foo",
-    ],
-    importpath = "github.com/selvatico/go-mocket",
-    replace = "github.com/Selvatico/go-mocket",
-    sum = "h1:sXuFMnMfVL9b/Os8rGXPgbOFbr4HJm8aHsulD/uMTUk=",
-    version = "v1.0.7",
-)
+go_deps = use_extension("@gazelle//:extensions.bzl", "go_deps")
+go_deps.from_file(go_mod = "//:go.mod")
+use_repo(go_deps, "com_github_a_b", "com_github_c_d")
 `,
 		},
 	})
 }
 
-func TestMatchProtoLibrary(t *testing.T) {
+func TestDoctor(t *testing.T) {
+	t.Setenv("GOPROXY", "off")
 	files := []testtools.FileSpec{
 		{
 			Path: "WORKSPACE",
+			Content: `
+load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+
+http_archive(
+    name = "bazel_gazelle",
+    urls = ["https://example.com/gazelle.zip"],
+)
+
+load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+go_repository(
+    name = "org_golang_x_mod",
+    importpath = "golang.org/x/mod",
+    sum = "h1:mod",
+    version = "v0.1.0",
+)
+`,
 		},
 		{
-			Path: "proto/BUILD.bazel",
+			Path: "MODULE.bazel",
 			Content: `
-load("@rules_proto//proto:defs.bzl", "proto_library")
-# gazelle:prefix example.com/foo
+bazel_dep(name = "gazelle", version = "0.40.0")
 
-proto_library(
-	name = "existing_proto",
-	srcs = ["foo.proto"],
-)
+go_deps = use_extension("@gazelle//:extensions.bzl", "go_deps")
+go_deps.from_file(go_mod = "//:go.mod")
 `,
 		},
 		{
-			Path:    "proto/foo.proto",
-			Content: `syntax = "proto3";`,
+			Path: "BUILD.bazel",
+			Content: `
+# gazelle:exclude node_modules
+# gazelle:exclude third_party
+`,
+		},
+		{
+			Path: ".bazelignore",
+			Content: `# Generated by npm.
+node_modules
+gone
+bazel-*
+`,
 		},
+		{Path: "node_modules/x/x.go", Content: "package x"},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{"update"}
-	if err := runGazelle(dir, args); err != nil {
+	err := runGazelle(dir, []string{"doctor", "-go=" + filepath.Join(dir, "missing-go"), "-report=report.txt"})
+	if err == nil || err.Error() != "found 7 problems" {
+		t.Errorf("got error %v; want found 7 problems", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "report.txt"))
+	if err != nil {
 		t.Fatal(err)
 	}
+	got := strings.ReplaceAll(string(data), dir, "$DIR")
+	if i := strings.Index(got, "missing-go: "); i >= 0 {
+		// The error from exec differs between platforms.
+		j := strings.IndexByte(got[i:], '\n')
+		got = got[:i] + "missing-go: ..." + got[i+j:]
+	}
+	want := `could not run $DIR/missing-go: ...
+  fix: install Go from https://go.dev/dl, or set GOROOT to the Go installation to use. update-repos needs the go command to read go.mod files and look up modules.
+GOPROXY is off, so modules can't be downloaded
+  fix: unset GOPROXY, or set it to a module proxy like https://proxy.golang.org
+WORKSPACE: MODULE.bazel uses go_deps, but go_repository rules are also declared here: org_golang_x_mod
+  fix: run gazelle migrate-workspace to move them to go_deps, so each module is only declared once
+WORKSPACE: bazel_gazelle is declared here, and gazelle is also a bazel_dep in MODULE.bazel; the versions may differ
+  fix: remove bazel_gazelle and gazelle_dependencies from WORKSPACE
+.bazelignore:3: gone does not exist
+  fix: remove the stale entry
+.bazelignore:4: bazel-* is a glob pattern, which .bazelignore doesn't support
+  fix: list each path separately, or use # gazelle:exclude in the root build file
+BUILD.bazel: # gazelle:exclude node_modules is redundant; node_modules is listed in .bazelignore, which Gazelle already skips
+  fix: remove the directive
+`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("report (-want,+got):\n%s", diff)
+	}
+}
 
-	testtools.CheckFiles(t, dir, []testtools.FileSpec{
-		{
-			Path: "proto/BUILD.bazel",
-			Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
-load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
-load("@rules_proto//proto:defs.bzl", "proto_library")
-# gazelle:prefix example.com/foo
+func TestKinds(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{Path: "BUILD.bazel", Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+load("//tools:defs.bzl", "my_macro")
 
-proto_library(
-    name = "existing_proto",
-    srcs = ["foo.proto"],
-    visibility = ["//visibility:public"],
-)
+go_library(name = "a")
 
-go_proto_library(
-    name = "foo_go_proto",
-    importpath = "example.com/foo",
-    proto = ":existing_proto",
-    visibility = ["//visibility:public"],
-)
+go_test(name = "a_test")
 
-go_library(
-    name = "foo",
-    embed = [":foo_go_proto"],
-    importpath = "example.com/foo",
-    visibility = ["//visibility:public"],
-)`,
-		},
-	})
-}
+genrule(name = "gen")
 
-func TestConfigLang(t *testing.T) {
-	// Gazelle is run with "-lang=proto".
-	files := []testtools.FileSpec{
-		{Path: "WORKSPACE"},
+my_macro(name = "m")
+`},
+		{Path: "sub/BUILD.bazel", Content: `load("//tools:go.bzl", "my_go_library")
 
-		// Verify that Gazelle does not create a BUILD file.
-		{Path: "foo/foo.go", Content: "package foo"},
+# gazelle:map_kind go_library my_go_library //tools:go.bzl
 
-		// Verify that Gazelle only creates the proto rule.
-		{Path: "pb/pb.go", Content: "package pb"},
-		{Path: "pb/pb.proto", Content: `syntax = "proto3";`},
+my_go_library(name = "sub")
 
-		// Verify that Gazelle does create a BUILD file, because of the override.
-		{Path: "bar/BUILD.bazel", Content: "# gazelle:lang"},
-		{Path: "bar/bar.go", Content: "package bar"},
-		{Path: "baz/BUILD.bazel", Content: "# gazelle:lang go,proto"},
-		{Path: "baz/baz.go", Content: "package baz"},
+genrule(name = "gen")
+`},
+	})
+	defer cleanup()
 
-		// Verify that Gazelle does not index go_library rules in // or //baz/protos.
-		// In those directories, lang is set to proto by flag and directive, respectively.
-		// Confirm it does index and resolve a rule in a directory where go is activated.
-		{Path: "invisible1.go", Content: "package invisible1"},
-		{Path: "BUILD.bazel", Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
+	if err := runGazelle(dir, []string{"kinds", "-json", "-out=kinds.json"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "kinds.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []kindStats
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []kindStats{
+		{Kind: "genrule", Count: 2},
+		{Kind: "go_library", Count: 1, Language: "go", Loads: []string{"@io_bazel_rules_go//go:def.bzl"}},
+		{Kind: "go_test", Count: 1, Language: "go", Loads: []string{"@io_bazel_rules_go//go:def.bzl"}},
+		{Kind: "my_go_library", Count: 1, Language: "go", MappedFrom: []string{"go_library"}, Loads: []string{"//tools:go.bzl"}},
+		{Kind: "my_macro", Count: 1, Loads: []string{"//tools:defs.bzl"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("kinds (-want,+got):\n%s", diff)
+	}
 
-# gazelle:prefix root
+	// With -unknown, only kinds no language claims are listed.
+	if err := runGazelle(dir, []string{"kinds", "-unknown", "-out=kinds.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "kinds.txt",
+		Content: `KIND      COUNT  LANGUAGE  LOADED FROM
+genrule   2      -         native
+my_macro  1      -         //tools:defs.bzl
+`,
+	}})
+}
+
+func TestGoTestShardCount(t *testing.T) {
+	var bigTest strings.Builder
+	bigTest.WriteString("package big\n\nimport \"testing\"\n")
+	for i := 0; i < 25; i++ {
+		fmt.Fprintf(&bigTest, "\nfunc Test%d(t *testing.T) {}\n", i)
+	}
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path: "BUILD.bazel",
+			Content: `
+# gazelle:prefix example.com/m
+# gazelle:go_test_shard_count auto
+`,
+		},
+		{Path: "big/big.go", Content: "package big"},
+		{Path: "big/big_test.go", Content: bigTest.String()},
+		{
+			Path: "big/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
 go_library(
-    name = "go_default_library",
-    srcs = ["invisible1.go"],
-    importpath = "root",
+    name = "big",
+    srcs = ["big.go"],
+    importpath = "example.com/m/big",
     visibility = ["//visibility:public"],
 )
-`},
-		{Path: "baz/protos/invisible2.go", Content: "package invisible2"},
-		{Path: "baz/protos/BUILD.bazel", Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-# gazelle:lang proto
-# gazelle:prefix github.com/rule_indexing/invisible2
+go_test(
+    name = "big_test",
+    srcs = ["big_test.go"],
+    embed = [":big"],
+    shard_count = 7,
+)
+`,
+		},
+		{Path: "small/small_test.go", Content: "package small\n\nimport \"testing\"\n\nfunc TestSmall(t *testing.T) {}\n"},
+		{
+			Path:    "fixed/BUILD.bazel",
+			Content: "# gazelle:go_test_shard_count 4\n",
+		},
+		{Path: "fixed/fixed_test.go", Content: "package fixed\n\nimport \"testing\"\n\nfunc TestFixed(t *testing.T) {}\n"},
+		{
+			Path: "unmanaged/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
 
-go_library(
-    name = "go_default_library",
-    srcs = ["invisible2.go"],
-    importpath = "github.com/rule_indexing/invisible2",
-    visibility = ["//visibility:public"],
+# gazelle:go_test_shard_count
+
+go_test(
+    name = "unmanaged_test",
+    srcs = ["unmanaged_test.go"],
+    shard_count = 3,
 )
-`},
-		{Path: "visible/visible.go", Content: "package visible"},
-		{Path: "visible/BUILD.bazel", Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
+`,
+		},
+		{Path: "unmanaged/unmanaged_test.go", Content: "package unmanaged\n\nimport \"testing\"\n\nfunc TestUnmanaged(t *testing.T) {}\n"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
 
-# gazelle:lang go,proto
-# gazelle:prefix github.com/rule_indexing/visible
+	if err := runGazelle(dir, []string{"update"}); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "big/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
 go_library(
-    name = "go_default_library",
-    srcs = ["visible.go"],
-    importpath = "github.com/rule_indexing/visible",
+    name = "big",
+    srcs = ["big.go"],
+    importpath = "example.com/m/big",
     visibility = ["//visibility:public"],
 )
-`},
-		{Path: "baz/test_no_index/test_no_index.go", Content: `
-package test_no_index
 
-import (
-	_ "github.com/rule_indexing/invisible1"
-	_ "github.com/rule_indexing/invisible2"
-	_ "github.com/rule_indexing/visible"
+go_test(
+    name = "big_test",
+    srcs = ["big_test.go"],
+    embed = [":big"],
+    shard_count = 3,
 )
-`},
-	}
+`,
+		}, {
+			Path: "small/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
 
-	dir, cleanup := testtools.CreateFiles(t, files)
-	defer cleanup()
+go_test(
+    name = "small_test",
+    srcs = ["small_test.go"],
+)
+`,
+		}, {
+			Path: "fixed/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
 
-	args := []string{"-lang", "proto"}
-	if err := runGazelle(dir, args); err != nil {
-		t.Fatal(err)
-	}
+# gazelle:go_test_shard_count 4
+
+go_test(
+    name = "fixed_test",
+    srcs = ["fixed_test.go"],
+    shard_count = 4,
+)
+`,
+		}, {
+			Path: "unmanaged/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
 
-	testtools.CheckFiles(t, dir, []testtools.FileSpec{
-		{
-			Path:     filepath.Join("foo", "BUILD.bazel"),
-			NotExist: true,
+# gazelle:go_test_shard_count
+
+go_test(
+    name = "unmanaged_test",
+    srcs = ["unmanaged_test.go"],
+    shard_count = 3,
+)
+`,
 		},
+	})
+}
+
+func TestGoTestonlyPaths(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path: filepath.Join("pb", "BUILD.bazel"),
+			Path: "BUILD.bazel",
 			Content: `
-load("@rules_proto//proto:defs.bzl", "proto_library")
-
-proto_library(
-    name = "pb_proto",
-    srcs = ["pb.proto"],
-    visibility = ["//visibility:public"],
-)`,
+# gazelle:prefix example.com/m
+# gazelle:go_testonly_paths (^|/)testutil(/|$)
+`,
 		},
+		{Path: "lib/lib.go", Content: "package lib"},
+		{Path: "lib/testutil/testutil.go", Content: "package testutil"},
+		{Path: "lib/testutil/testutil_test.go", Content: "package testutil"},
 		{
-			Path: filepath.Join("bar", "BUILD.bazel"),
+			Path: "fake/BUILD.bazel",
 			Content: `
 load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-# gazelle:lang
+# gazelle:go_testonly_paths ^fake$
 
 go_library(
-    name = "go_default_library",
-    srcs = ["bar.go"],
-    importpath = "root/bar",
+    name = "fake",
+    srcs = ["fake.go"],
+    importpath = "example.com/m/fake",
     visibility = ["//visibility:public"],
-)`,
+)
+`,
 		},
+		{Path: "fake/fake.go", Content: "package fake"},
 		{
-			Path: filepath.Join("baz", "BUILD.bazel"),
+			Path: "unmanaged/testutil/BUILD.bazel",
 			Content: `
 load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-# gazelle:lang go,proto
+# gazelle:go_testonly_paths
 
 go_library(
-    name = "go_default_library",
-    srcs = ["baz.go"],
-    importpath = "root/baz",
+    name = "testutil",
+    srcs = ["testutil.go"],
+    importpath = "example.com/m/unmanaged/testutil",
+    testonly = False,
     visibility = ["//visibility:public"],
-)`,
+)
+`,
 		},
-
-		{Path: "baz/test_no_index/BUILD.bazel", Content: `
+		{Path: "unmanaged/testutil/testutil.go", Content: "package testutil"},
+		{
+			Path: "helpers/BUILD.bazel",
+			Content: `
 load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
 go_library(
-    name = "go_default_library",
-    srcs = ["test_no_index.go"],
-    importpath = "root/baz/test_no_index",
+    name = "helpers",
+    testonly = True,
+    srcs = ["helpers.go"],
+    importpath = "example.com/m/helpers",
     visibility = ["//visibility:public"],
-    deps = [
-        "//visible:go_default_library",
-        "@com_github_rule_indexing_invisible1//:go_default_library",
-        "@com_github_rule_indexing_invisible2//:go_default_library",
-    ],
 )
-`},
-	})
-}
-
-func TestUpdateRepos_LangFilter(t *testing.T) {
-	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
-		{Path: "WORKSPACE"},
-	})
-	defer cleanup()
-
-	args := []string{"update-repos", "-lang=proto", "github.com/sirupsen/logrus@v1.3.0"}
-	err := runGazelle(dir, args)
-	if err == nil {
-		t.Fatal("expected an error, got none")
-	}
-	if !strings.Contains(err.Error(), "no languages can update repositories") {
-		t.Fatalf("unexpected error: %+v", err)
-	}
-}
-
-func TestGoGenerateProto(t *testing.T) {
-	files := []testtools.FileSpec{
-		{
-			Path: "WORKSPACE",
-		},
-		{
-			Path: "proto/BUILD.bazel",
-			Content: `# gazelle:go_generate_proto false
-# gazelle:prefix example.com/proto
 `,
 		},
-		{
-			Path:    "proto/foo.proto",
-			Content: `syntax = "proto3";`,
-		},
-		{
-			Path:    "proto/foo.pb.go",
-			Content: "package proto",
-		},
+		{Path: "helpers/helpers.go", Content: "package helpers"},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{"update"}
-	if err := runGazelle(dir, args); err != nil {
+	if err := runGazelle(dir, []string{"update"}); err != nil {
 		t.Fatal(err)
 	}
 
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "proto/BUILD.bazel",
-			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
-load("@rules_proto//proto:defs.bzl", "proto_library")
+			Path: "lib/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-# gazelle:go_generate_proto false
-# gazelle:prefix example.com/proto
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/m/lib",
+    visibility = ["//visibility:public"],
+)
+`,
+		}, {
+			Path: "lib/testutil/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
-proto_library(
-    name = "foo_proto",
-    srcs = ["foo.proto"],
+go_library(
+    name = "testutil",
+    testonly = True,
+    srcs = ["testutil.go"],
+    importpath = "example.com/m/lib/testutil",
     visibility = ["//visibility:public"],
 )
 
+go_test(
+    name = "testutil_test",
+    testonly = True,
+    srcs = ["testutil_test.go"],
+    embed = [":testutil"],
+)
+`,
+		}, {
+			Path: "fake/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:go_testonly_paths ^fake$
+
 go_library(
-    name = "proto",
-    srcs = ["foo.pb.go"],
-    importpath = "example.com/proto",
+    name = "fake",
+    testonly = True,
+    srcs = ["fake.go"],
+    importpath = "example.com/m/fake",
     visibility = ["//visibility:public"],
-)`,
+)
+`,
+		}, {
+			Path: "unmanaged/testutil/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+# gazelle:go_testonly_paths
+
+go_library(
+    name = "testutil",
+    testonly = False,
+    srcs = ["testutil.go"],
+    importpath = "example.com/m/unmanaged/testutil",
+    visibility = ["//visibility:public"],
+)
+`,
+		}, {
+			Path: "helpers/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "helpers",
+    testonly = True,
+    srcs = ["helpers.go"],
+    importpath = "example.com/m/helpers",
+    visibility = ["//visibility:public"],
+)
+`,
 		},
 	})
 }
 
-func TestGoMainLibraryRemoved(t *testing.T) {
+func TestGoExternalRepos(t *testing.T) {
 	files := []testtools.FileSpec{
+		{Path: "main/WORKSPACE"},
 		{
-			Path: "WORKSPACE",
+			Path: "main/BUILD.bazel",
+			Content: `
+# gazelle:prefix example.com/m
+`,
 		},
 		{
-			Path: "BUILD.bazel",
+			Path: "main/app/app.go",
 			Content: `
-# gazelle:prefix example.com
-# gazelle:go_naming_convention import
+package app
+
+import (
+	_ "example.com/kept/sub"
+	_ "example.com/pruned"
+	_ "golang.org/x/sys/unix"
+)
 `,
 		},
 		{
-			Path: "cmd/foo/BUILD.bazel",
-			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library")
-
-go_library(
-		name = "foo_lib",
-		srcs = ["foo.go"],
-		importpath = "example.com/cmd/foo",
-		visibility = ["//visibility:private"],
+			Path: "external/gazelle++go_deps+bazel_gazelle_go_repository_config/WORKSPACE",
+			Content: `
+go_repository(
+    name = "com_example_kept",
+    importpath = "example.com/kept",
 )
 
-go_binary(
-		name = "foo",
-		embed = [":foo_lib"],
-		visibility = ["//visibility:public"],
+go_repository(
+    name = "org_golang_x_sys",
+    build_naming_convention = "go_default_library",
+    importpath = "golang.org/x/sys",
 )
 `,
 		},
@@ -3726,686 +7927,1052 @@ go_binary(
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{"update"}
-	if err := runGazelle(dir, args); err != nil {
+	args := []string{"update", "-go_external_repos=" + filepath.Join(dir, "external")}
+	if err := runGazelle(filepath.Join(dir, "main"), args); err != nil {
 		t.Fatal(err)
 	}
 
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path:    "cmd/foo/BUILD.bazel",
-			Content: "",
+			Path: "main/app/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "app",
+    srcs = ["app.go"],
+    importpath = "example.com/m/app",
+    visibility = ["//visibility:public"],
+    deps = [
+        "@com_example_kept//sub",
+        "@org_golang_x_sys//unix:go_default_library",
+    ],
+)
+`,
 		},
 	})
 }
 
-func TestUpdateReposOldBoilerplateNewRepo(t *testing.T) {
+func TestNoResolve(t *testing.T) {
 	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path: "WORKSPACE",
+			Path: "BUILD.bazel",
 			Content: `
-load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+# gazelle:prefix example.com/m
+`,
+		},
+		{Path: "dep/dep.go", Content: "package dep"},
+		{
+			Path: "lib/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
-http_archive(
-    name = "io_bazel_rules_go",
-    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-    ],
+# gazelle:no_resolve
+go_library(
+    name = "lib",
+    srcs = ["a.go"],
+    importpath = "example.com/m/lib",
+    visibility = ["//visibility:public"],
 )
 
-http_archive(
-    name = "bazel_gazelle",
-    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-    ],
+# Dependencies are computed by a macro.
+# gazelle:no_resolve
+go_test(
+    name = "lib_test",
+    srcs = ["a_test.go"],
+    embed = [":lib"],
+    deps = ["//other"],
 )
-
-load("@io_bazel_rules_go//go:deps.bzl", "go_rules_dependencies", "go_register_toolchains")
-
-go_rules_dependencies()
-
-go_register_toolchains()
-
-load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
-
-gazelle_dependencies()
 `,
 		},
+		{Path: "lib/a.go", Content: "package lib"},
+		{Path: "lib/b.go", Content: "package lib\n\nimport _ \"example.com/m/dep\"\n"},
+		{Path: "lib/a_test.go", Content: "package lib\n\nimport _ \"example.com/m/dep\"\n"},
 	}
-
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{"update-repos", "golang.org/x/mod@v0.3.0"}
-	if err := runGazelle(dir, args); err != nil {
+	if err := runGazelle(dir, []string{"update"}); err != nil {
 		t.Fatal(err)
 	}
 
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "WORKSPACE",
+			Path: "lib/BUILD.bazel",
 			Content: `
-load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
-http_archive(
-    name = "io_bazel_rules_go",
-    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+# gazelle:no_resolve
+go_library(
+    name = "lib",
+    srcs = [
+        "a.go",
+        "b.go",
     ],
+    importpath = "example.com/m/lib",
+    visibility = ["//visibility:public"],
 )
 
-http_archive(
-    name = "bazel_gazelle",
-    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-    ],
+# Dependencies are computed by a macro.
+# gazelle:no_resolve
+go_test(
+    name = "lib_test",
+    srcs = ["a_test.go"],
+    embed = [":lib"],
+    deps = ["//other"],
 )
+`,
+		},
+	})
+}
+
+func TestGoProtoCompilerOverrides(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path: "BUILD.bazel",
+			Content: `
+# gazelle:prefix example.com/repo
+# gazelle:go_proto_compilers example.api.*=//compilers:go,example.api.*=//compilers:vtproto
+# gazelle:go_grpc_compilers //compilers:grpc,example.api.v1=//compilers:vtgrpc
+`,
+		},
+		{
+			Path: "api/v1/api.proto",
+			Content: `
+syntax = "proto3";
 
-load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
+package example.api.v1;
 
-go_rules_dependencies()
+option go_package = "example.com/repo/api/v1";
 
-go_register_toolchains()
+message Request {}
 
-load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies", "go_repository")
+service API {}
+`,
+		},
+		{
+			Path: "api/v1/types/types.proto",
+			Content: `
+syntax = "proto3";
 
-go_repository(
-    name = "org_golang_x_mod",
-    importpath = "golang.org/x/mod",
-    sum = "h1:RM4zey1++hCTbCVQfnWeKs9/IEsaBLA8vTkd0WVtmH4=",
-    version = "v0.3.0",
-)
+package example.api.v1.types;
 
-gazelle_dependencies()
+option go_package = "example.com/repo/api/v1/types";
+
+message Type {}
 `,
 		},
-	})
-}
-
-func TestUpdateReposSkipsDirectiveRepo(t *testing.T) {
-	files := []testtools.FileSpec{
 		{
-			Path: "WORKSPACE",
+			Path: "internal/internal.proto",
 			Content: `
-load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+syntax = "proto3";
 
-http_archive(
-    name = "io_bazel_rules_go",
-    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-    ],
-)
+package example.internal;
 
-http_archive(
-    name = "bazel_gazelle",
-    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-    ],
-)
+option go_package = "example.com/repo/internal";
 
-load("@io_bazel_rules_go//go:deps.bzl", "go_rules_dependencies", "go_register_toolchains")
+message Internal {}
 
-go_rules_dependencies()
+service Internal {}
+`,
+		},
+		{
+			Path: "other/BUILD.bazel",
+			Content: `
+# gazelle:go_grpc_compilers example.other.v2=//compilers:vtgrpc
+`,
+		},
+		{
+			Path: "other/other.proto",
+			Content: `
+syntax = "proto3";
 
-go_register_toolchains()
+package example.other;
 
-load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
+option go_package = "example.com/repo/other";
 
-gazelle_dependencies()
+message Other {}
 
-# gazelle:repository go_repository name=org_golang_x_mod importpath=golang.org/x/mod
+service Other {}
 `,
 		},
 	}
-
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{"update-repos", "golang.org/x/mod@v0.3.0"}
-	if err := runGazelle(dir, args); err != nil {
+	if err := runGazelle(dir, []string{"update"}); err != nil {
 		t.Fatal(err)
 	}
 
-	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+	for _, tc := range []struct {
+		path, compilers string
+	}{
+		{"api/v1/BUILD.bazel", `compilers = ["//compilers:vtgrpc"]`},
+		{"api/v1/types/BUILD.bazel", `compilers = [
+        "//compilers:go",
+        "//compilers:vtproto",
+    ]`},
+		{"internal/BUILD.bazel", `compilers = ["//compilers:grpc"]`},
+		{"other/BUILD.bazel", `compilers = ["//compilers:grpc"]`},
+	} {
+		content, err := os.ReadFile(filepath.Join(dir, tc.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(content), tc.compilers) {
+			t.Errorf("%s: want %s; got:\n%s", tc.path, tc.compilers, content)
+		}
+	}
+}
+
+func TestProtoInclude(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "main/WORKSPACE"},
 		{
-			Path: "WORKSPACE",
+			Path: "main/BUILD.bazel",
 			Content: `
-load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
-
-http_archive(
-    name = "io_bazel_rules_go",
-    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-    ],
-)
+# gazelle:prefix example.com/repo
+# gazelle:proto_include third_party/protos
+# gazelle:proto_include mounted
+# gazelle:exclude third_party/protos/legacy
+`,
+		},
+		{
+			Path: "main/api/api.proto",
+			Content: `
+syntax = "proto3";
 
-http_archive(
-    name = "bazel_gazelle",
-    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-    ],
-)
+package api;
 
-load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
+import "shared/v1/shared.proto";
+import "common/common.proto";
+import "legacy/legacy.proto";
+`,
+		},
+		{
+			Path: "main/third_party/protos/shared/v1/shared.proto",
+			Content: `
+syntax = "proto3";
 
-go_rules_dependencies()
+package shared.v1;
+`,
+		},
+		{Path: "main/third_party/protos/legacy/legacy.proto", Content: "syntax = \"proto3\";\n\npackage legacy;\n"},
+		{Path: "main/mounted", Symlink: "../shared"},
+		{Path: "shared/common/common.proto", Content: "syntax = \"proto3\";\n\npackage common;\n"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
 
-go_register_toolchains()
+	if err := runGazelle(filepath.Join(dir, "main"), []string{"update", "-lang=proto"}); err != nil {
+		t.Fatal(err)
+	}
 
-load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "main/api/BUILD.bazel",
+			Content: `
+load("@rules_proto//proto:defs.bzl", "proto_library")
 
-gazelle_dependencies()
+proto_library(
+    name = "api_proto",
+    srcs = ["api.proto"],
+    visibility = ["//visibility:public"],
+    deps = [
+        "//legacy:legacy_proto",
+        "//mounted/common:common_proto",
+        "//third_party/protos/shared/v1:shared_v1_proto",
+    ],
+)
+`,
+		}, {
+			Path: "main/third_party/protos/shared/v1/BUILD.bazel",
+			Content: `
+load("@rules_proto//proto:defs.bzl", "proto_library")
 
-# gazelle:repository go_repository name=org_golang_x_mod importpath=golang.org/x/mod
+proto_library(
+    name = "shared_v1_proto",
+    srcs = ["shared.proto"],
+    strip_import_prefix = "/third_party/protos",
+    visibility = ["//visibility:public"],
+)
 `,
 		},
 	})
 }
 
-func TestUpdateReposOldBoilerplateNewMacro(t *testing.T) {
+func TestProtoBuf(t *testing.T) {
 	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path: "WORKSPACE",
+			Path: "BUILD.bazel",
+			Content: `# gazelle:prefix example.com/repo
+# gazelle:proto_buf true
+# gazelle:proto_buf_dep_prefix acme/ext
+# gazelle:proto_buf_dep_prefix buf/validate
+`,
+		},
+		{
+			Path: "buf.work.yaml",
+			Content: `version: v1
+directories:
+  - proto
+`,
+		},
+		{
+			Path: "proto/buf.yaml",
+			Content: `version: v1
+deps:
+  - buf.build/bufbuild/protovalidate
+`,
+		},
+		{
+			Path: "proto/acme/api/v1/api.proto",
 			Content: `
-load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
-
-http_archive(
-    name = "io_bazel_rules_go",
-    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-    ],
-)
-
-http_archive(
-    name = "bazel_gazelle",
-    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-    ],
-)
-
-load("@io_bazel_rules_go//go:deps.bzl", "go_rules_dependencies", "go_register_toolchains")
-
-go_rules_dependencies()
+syntax = "proto3";
 
-go_register_toolchains()
+package acme.api.v1;
 
-load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
+import "acme/ext/v1/ext.proto";
+import "acme/types/v1/types.proto";
+import "buf/validate/validate.proto";
+import "google/type/date.proto";
+`,
+		},
+		{
+			Path: "proto/acme/types/v1/types.proto",
+			Content: `
+syntax = "proto3";
 
-gazelle_dependencies()
+package acme.types.v1;
 `,
 		},
 	}
-
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{"update-repos", "-to_macro=deps.bzl%deps", "golang.org/x/mod@v0.3.0"}
-	if err := runGazelle(dir, args); err != nil {
+	if err := runGazelle(dir, []string{"update", "-lang=proto"}); err != nil {
 		t.Fatal(err)
 	}
 
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "WORKSPACE",
+			Path: "proto/acme/api/v1/BUILD.bazel",
 			Content: `
-load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+load("@rules_proto//proto:defs.bzl", "proto_library")
 
-http_archive(
-    name = "io_bazel_rules_go",
-    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+proto_library(
+    name = "acme_api_v1_proto",
+    srcs = ["api.proto"],
+    strip_import_prefix = "/proto",
+    visibility = ["//visibility:public"],
+    deps = [
+        "//google/type:type_proto",
+        "//proto/acme/types/v1:acme_types_v1_proto",
+        "@buf_deps//acme/ext/v1:v1_proto",
+        "@buf_deps//buf/validate:validate_proto",
     ],
 )
+`,
+		}, {
+			Path: "proto/acme/types/v1/BUILD.bazel",
+			Content: `
+load("@rules_proto//proto:defs.bzl", "proto_library")
 
-http_archive(
-    name = "bazel_gazelle",
-    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-    ],
+proto_library(
+    name = "acme_types_v1_proto",
+    srcs = ["types.proto"],
+    strip_import_prefix = "/proto",
+    visibility = ["//visibility:public"],
 )
-
-load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
-
-go_rules_dependencies()
-
-go_register_toolchains()
-
-load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
-load("//:deps.bzl", "deps")
-
-# gazelle:repository_macro deps.bzl%deps
-deps()
-
-gazelle_dependencies()
 `,
 		},
 	})
 }
 
-func TestUpdateReposNewBoilerplateNewRepo(t *testing.T) {
+func TestGoVendorVisibility(t *testing.T) {
 	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path: "WORKSPACE",
+			Path: "BUILD.bazel",
 			Content: `
-load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
-
-http_archive(
-    name = "io_bazel_rules_go",
-    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-    ],
-)
+# gazelle:prefix example.com/m
+`,
+		},
+		{
+			Path:    "vendor/BUILD.bazel",
+			Content: "# gazelle:go_vendor_visibility //vendor:__subpackages__,//app:__pkg__\n",
+		},
+		{Path: "vendor/example.com/new/new.go", Content: "package new"},
+		{Path: "vendor/example.com/old/old.go", Content: "package old"},
+		{
+			Path: "vendor/example.com/old/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-http_archive(
-    name = "bazel_gazelle",
-    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-    ],
+go_library(
+    name = "old",
+    srcs = ["old.go"],
+    importmap = "example.com/m/vendor/example.com/old",
+    importpath = "example.com/old",
+    visibility = ["//visibility:public"],
 )
+`,
+		},
+		{Path: "vendor/example.com/open/open.go", Content: "package open"},
+		{
+			Path: "vendor/example.com/open/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
-load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
-
-go_rules_dependencies()
-
-go_register_toolchains()
+# gazelle:go_vendor_visibility
 
-gazelle_dependencies()
+go_library(
+    name = "open",
+    srcs = ["open.go"],
+    importmap = "example.com/m/vendor/example.com/open",
+    importpath = "example.com/open",
+    visibility = ["//app:__pkg__"],
+)
 `,
 		},
+		{Path: "app/app.go", Content: "package app"},
 	}
-
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{"update-repos", "golang.org/x/mod@v0.3.0"}
-	if err := runGazelle(dir, args); err != nil {
+	if err := runGazelle(dir, []string{"update"}); err != nil {
 		t.Fatal(err)
 	}
 
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "WORKSPACE",
+			Path: "vendor/example.com/new/BUILD.bazel",
 			Content: `
-load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-http_archive(
-    name = "io_bazel_rules_go",
-    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
+go_library(
+    name = "new",
+    srcs = ["new.go"],
+    importmap = "example.com/m/vendor/example.com/new",
+    importpath = "example.com/new",
+    visibility = [
+        "//app:__pkg__",
+        "//vendor:__subpackages__",
     ],
 )
+`,
+		}, {
+			Path: "vendor/example.com/old/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-http_archive(
-    name = "bazel_gazelle",
-    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+go_library(
+    name = "old",
+    srcs = ["old.go"],
+    importmap = "example.com/m/vendor/example.com/old",
+    importpath = "example.com/old",
+    visibility = [
+        "//app:__pkg__",
+        "//vendor:__subpackages__",
     ],
 )
+`,
+		}, {
+			Path: "vendor/example.com/open/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies", "go_repository")
-load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
+# gazelle:go_vendor_visibility
 
-go_repository(
-    name = "org_golang_x_mod",
-    importpath = "golang.org/x/mod",
-    sum = "h1:RM4zey1++hCTbCVQfnWeKs9/IEsaBLA8vTkd0WVtmH4=",
-    version = "v0.3.0",
+go_library(
+    name = "open",
+    srcs = ["open.go"],
+    importmap = "example.com/m/vendor/example.com/open",
+    importpath = "example.com/open",
+    visibility = ["//app:__pkg__"],
 )
+`,
+		}, {
+			Path: "app/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-go_rules_dependencies()
-
-go_register_toolchains()
-
-gazelle_dependencies()
+go_library(
+    name = "app",
+    srcs = ["app.go"],
+    importpath = "example.com/m/app",
+    visibility = ["//visibility:public"],
+)
 `,
 		},
 	})
 }
 
-func TestUpdateReposNewBoilerplateNewMacro(t *testing.T) {
+func TestGoGroupDeps(t *testing.T) {
 	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path: "WORKSPACE",
+			Path: "BUILD.bazel",
 			Content: `
-load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+# gazelle:prefix example.com/m
+# gazelle:go_group_deps true
+# gazelle:go_naming_convention_external import
+`,
+		},
+		{Path: "a/a.go", Content: "package a"},
+		{Path: "b/b.go", Content: "package b"},
+		{
+			Path: "c/c.go",
+			Content: `package c
 
-http_archive(
-    name = "io_bazel_rules_go",
-    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-    ],
+import (
+	_ "example.com/m/a"
+	_ "example.com/m/b"
+	_ "github.com/foo/bar"
+	_ "golang.org/x/sys/unix"
 )
+`,
+		},
+		{
+			Path: "c/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-http_archive(
-    name = "bazel_gazelle",
-    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
+go_library(
+    name = "c",
+    srcs = ["c.go"],
+    importpath = "example.com/m/c",
+    visibility = ["//visibility:public"],
+    deps = [
+        # group: internal
+        "//a",
+        "//old",
+        "@com_github_foo_bar//:bar",
     ],
 )
-
-load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
-load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
-
-go_rules_dependencies()
-
-go_register_toolchains()
-
-gazelle_dependencies()
 `,
 		},
+		{Path: "d/d.go", Content: "package d\n\nimport _ \"example.com/m/a\"\n"},
 	}
-
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{"update-repos", "-to_macro=deps.bzl%deps", "golang.org/x/mod@v0.3.0"}
-	if err := runGazelle(dir, args); err != nil {
-		t.Fatal(err)
+	want := []testtools.FileSpec{
+		{
+			Path: "c/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "c",
+    srcs = ["c.go"],
+    importpath = "example.com/m/c",
+    visibility = ["//visibility:public"],
+    deps = [
+        # group: golang.org/x
+        "@org_golang_x_sys//unix",
+        # group: internal
+        "//a",
+        "//b",
+        # group: external
+        "@com_github_foo_bar//:bar",
+    ],
+)
+`,
+		}, {
+			Path: "d/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "d",
+    srcs = ["d.go"],
+    importpath = "example.com/m/d",
+    visibility = ["//visibility:public"],
+    deps = ["//a"],
+)
+`,
+		},
 	}
+	for i := 0; i < 2; i++ {
+		if err := runGazelle(dir, []string{"update", "-external=external"}); err != nil {
+			t.Fatal(err)
+		}
+		testtools.CheckFiles(t, dir, want)
+	}
+}
 
-	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+func TestNewRuleTemplate(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path: "WORKSPACE",
+			Path: "BUILD.bazel",
 			Content: `
-load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+# gazelle:prefix example.com/m
+# gazelle:new_rule_template go_binary tmpl/go_binary.tpl
+`,
+		},
+		{
+			Path: "tmpl/go_binary.tpl",
+			Content: `
+go_binary(
+    clinkopts = ["-static"],
+    data = ["//runtime:files"],
+    tags = ["deploy"],
+)
+`,
+		},
+		{Path: "newcmd/main.go", Content: "package main\n\nfunc main() {}\n"},
+		{Path: "oldcmd/main.go", Content: "package main\n\nfunc main() {}\n"},
+		{
+			Path: "oldcmd/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library")
 
-http_archive(
-    name = "io_bazel_rules_go",
-    sha256 = "2697f6bc7c529ee5e6a2d9799870b9ec9eaeb3ee7d70ed50b87a2c2c97e13d9e",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-        "https://github.com/bazelbuild/rules_go/releases/download/v0.23.8/rules_go-v0.23.8.tar.gz",
-    ],
+go_library(
+    name = "oldcmd_lib",
+    srcs = ["main.go"],
+    importpath = "example.com/m/oldcmd",
+    visibility = ["//visibility:private"],
 )
 
-http_archive(
-    name = "bazel_gazelle",
-    sha256 = "cdb02a887a7187ea4d5a27452311a75ed8637379a1287d8eeb952138ea485f7d",
-    urls = [
-        "https://mirror.bazel.build/github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-        "https://github.com/bazelbuild/bazel-gazelle/releases/download/v0.21.1/bazel-gazelle-v0.21.1.tar.gz",
-    ],
+go_binary(
+    name = "oldcmd",
+    clinkopts = ["-lm"],
+    embed = [":oldcmd_lib"],
+    visibility = ["//visibility:public"],
 )
+`,
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
 
-load("@bazel_gazelle//:deps.bzl", "gazelle_dependencies")
-load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
-load("//:deps.bzl", "deps")
+	want := []testtools.FileSpec{
+		{
+			Path: "newcmd/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library")
 
-# gazelle:repository_macro deps.bzl%deps
-deps()
+go_library(
+    name = "newcmd_lib",
+    srcs = ["main.go"],
+    importpath = "example.com/m/newcmd",
+    visibility = ["//visibility:private"],
+)
 
-go_rules_dependencies()
+go_binary(
+    name = "newcmd",
+    clinkopts = ["-static"],
+    data = ["//runtime:files"],
+    embed = [":newcmd_lib"],
+    tags = ["deploy"],
+    visibility = ["//visibility:public"],
+)
+`,
+		}, {
+			Path: "oldcmd/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library")
 
-go_register_toolchains()
+go_library(
+    name = "oldcmd_lib",
+    srcs = ["main.go"],
+    importpath = "example.com/m/oldcmd",
+    visibility = ["//visibility:private"],
+)
 
-gazelle_dependencies()
+go_binary(
+    name = "oldcmd",
+    clinkopts = ["-lm"],
+    embed = [":oldcmd_lib"],
+    visibility = ["//visibility:public"],
+)
 `,
 		},
-	})
+	}
+	for i := 0; i < 2; i++ {
+		if err := runGazelle(dir, []string{"update"}); err != nil {
+			t.Fatal(err)
+		}
+		testtools.CheckFiles(t, dir, want)
+	}
 }
 
-func TestExternalOnly(t *testing.T) {
+func TestGoGeneratedSrcsManifest(t *testing.T) {
 	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path: "WORKSPACE",
-		},
-		{
-			Path: "foo/foo.go",
-			Content: `package foo
-import _ "golang.org/x/baz"
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix example.com/m",
+		}, {
+			Path:    "gen/BUILD.bazel",
+			Content: "",
+		}, {
+			Path:    "lib/lib.go",
+			Content: "package lib",
+		}, {
+			Path: "use/use.go",
+			Content: `package use
+
+import (
+	_ "example.com/m/gen/api"
+	_ "example.com/m/lib"
+)
 `,
+		}, {
+			Path: "generated_srcs.json",
+			Content: `{
+  "gen/api.pb.go": "example.com/m/gen/api",
+  "lib/lib_gen.go": "example.com/m/lib"
+}`,
 		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	args := []string{"update", "-go_generated_srcs_manifest=generated_srcs.json"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "foo/foo_test.go",
-			Content: `package foo_test
-import _ "golang.org/x/baz"
-import _ "example.com/foo"
+			Path: "gen/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "api",
+    srcs = ["api.pb.go"],
+    importpath = "example.com/m/gen/api",
+    visibility = ["//visibility:public"],
+)
 `,
-		},
-		{
-			Path: "foo/BUILD.bazel",
-			Content: `# gazelle:prefix example.com/foo
-load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+		}, {
+			Path: "lib/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
 go_library(
-    name = "foo",
-    srcs = ["foo.go"],
-    importpath = "example.com/foo",
+    name = "lib",
+    srcs = [
+        "lib.go",
+        "lib_gen.go",
+    ],
+    importpath = "example.com/m/lib",
     visibility = ["//visibility:public"],
-    deps = ["@org_golang_x_baz//:go_default_library"],
 )
+`,
+		}, {
+			Path: "use/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "use",
+    srcs = ["use.go"],
+    importpath = "example.com/m/use",
+    visibility = ["//visibility:public"],
+    deps = [
+        "//gen:api",
+        "//lib",
+    ],
+)
+`,
+		},
+	})
+}
 
-go_test(
-    name = "foo_test",
-    srcs = ["foo_test.go"],
-    embed = [":foo"],
-)`,
+func TestGoFileMetadataManifest(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix example.com/m",
+		}, {
+			Path:    "gen/stub.go",
+			Content: "package stub",
+		}, {
+			Path: "gen/data.txt",
+		}, {
+			Path:    "lib/lib.go",
+			Content: "package lib",
+		}, {
+			Path: "file_metadata.json",
+			Content: `{
+  "gen/gen.go": {
+    "package": "gen",
+    "imports": ["embed", "fmt", "example.com/m/lib"],
+    "embeds": ["data.txt"]
+  },
+  "gen/gen_test.go": {
+    "package": "gen_test",
+    "imports": ["testing", "example.com/m/gen"]
+  }
+}`,
 		},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	var args []string
+	args := []string{"update", "-go_file_metadata_manifest=file_metadata.json"}
 	if err := runGazelle(dir, args); err != nil {
 		t.Fatal(err)
 	}
 
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "foo/BUILD.bazel",
-			Content: `# gazelle:prefix example.com/foo
+			Path: "gen/BUILD.bazel",
+			Content: `
 load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
 go_library(
-    name = "foo",
-    srcs = ["foo.go"],
-    importpath = "example.com/foo",
+    name = "gen",
+    srcs = ["gen.go"],
+    embedsrcs = ["data.txt"],
+    importpath = "example.com/m/gen",
     visibility = ["//visibility:public"],
-    deps = ["@org_golang_x_baz//:go_default_library"],
+    deps = ["//lib"],
 )
 
 go_test(
-    name = "foo_test",
-    srcs = ["foo_test.go"],
-    deps = [
-        ":foo",
-        "@org_golang_x_baz//:go_default_library",
-    ],
-)`,
+    name = "gen_test",
+    srcs = ["gen_test.go"],
+    deps = [":gen"],
+)
+`,
 		},
 	})
 }
 
-func TestFindRulesGoVersionWithWORKSPACE(t *testing.T) {
+func TestAnnotateDeps(t *testing.T) {
 	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path: "WORKSPACE",
-			Content: `
-load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix example.com/m",
+		}, {
+			Path:    "a/a.go",
+			Content: "package a",
+		}, {
+			Path:    "b/b.go",
+			Content: "package b",
+		}, {
+			Path: "use/use.go",
+			Content: `package use
 
-http_archive(
-    name = "io_bazel_rules_go",
-    sha256 = "7b9bbe3ea1fccb46dcfa6c3f3e29ba7ec740d8733370e21cdc8937467b4a4349",
-    urls = [
-        "https://storage.googleapis.com/bazel-mirror/github.com/bazelbuild/rules_go/releases/download/v0.22.4/rules_go-v0.22.4.tar.gz",
-        "https://github.com/bazelbuild/rules_go/releases/download/v0.22.4/rules_go-v0.22.4.tar.gz",
-    ],
+import (
+	_ "example.com/m/a"
+	_ "example.com/m/b"
 )
-`,
-		},
-		{
-			Path: "foo_illumos.go",
-			Content: `
-// illumos not supported in rules_go v0.22.4
-package foo
-`,
-		},
-		{
-			Path: "BUILD.bazel",
-			Content: `
-# gazelle:prefix example.com/foo
 `,
 		},
 	}
-
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
+	if err := runGazelle(dir, []string{"update", "-annotate_deps"}); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "use/BUILD.bazel",
+		Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "use",
+    srcs = ["use.go"],
+    importpath = "example.com/m/use",
+    visibility = ["//visibility:public"],
+    deps = [
+        "//a",  # import "example.com/m/a"
+        "//b",  # import "example.com/m/b"
+    ],
+)
+`,
+	}})
+
+	// Annotations are removed when the flag isn't set.
 	if err := runGazelle(dir, []string{"update"}); err != nil {
 		t.Fatal(err)
 	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "use/BUILD.bazel",
+		Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-	testtools.CheckFiles(t, dir, []testtools.FileSpec{
-		{
-			Path: "BUILD.bazel",
-			Content: `
-# gazelle:prefix example.com/foo
+go_library(
+    name = "use",
+    srcs = ["use.go"],
+    importpath = "example.com/m/use",
+    visibility = ["//visibility:public"],
+    deps = [
+        "//a",
+        "//b",
+    ],
+)
 `,
-		},
-	})
+	}})
 }
 
-func TestPlatformSpecificEmbedsrcs(t *testing.T) {
+func TestGoTestModeChange(t *testing.T) {
 	files := []testtools.FileSpec{
-		{
-			Path: "WORKSPACE",
-		},
+		{Path: "WORKSPACE"},
 		{
 			Path: "BUILD.bazel",
-			Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
+			Content: `# gazelle:prefix example.com/m
+# gazelle:go_test_mode per_file
+`,
+		}, {
+			Path:    "lib/lib.go",
+			Content: "package lib",
+		}, {
+			Path:    "lib/a_test.go",
+			Content: "package lib",
+		}, {
+			Path:    "lib/b_test.go",
+			Content: "package lib",
+		},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
 
-# gazelle:prefix example.com/foo
+	if err := runGazelle(dir, []string{"update"}); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "lib/BUILD.bazel",
+		Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
 go_library(
-    name = "foo",
-    embedsrcs = ["deleted.txt"],
-    importpath = "example.com/foo",
-    srcs = ["foo.go"],
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/m/lib",
+    visibility = ["//visibility:public"],
 )
-`,
-		},
-		{
-			Path: "foo.go",
-			Content: `
-// +build windows
-
-package foo
 
-import _ "embed"
+go_test(
+    name = "a_test",
+    srcs = ["a_test.go"],
+    embed = [":lib"],
+)
 
-//go:embed windows.txt
-var s string
+go_test(
+    name = "b_test",
+    srcs = ["b_test.go"],
+    embed = [":lib"],
+)
 `,
-		},
-		{
-			Path: "windows.txt",
-		},
-	}
-
-	dir, cleanup := testtools.CreateFiles(t, files)
-	defer cleanup()
+	}})
 
+	// Per-file tests are replaced by a single test when the mode changes.
+	if err := os.WriteFile(filepath.Join(dir, "BUILD.bazel"), []byte(`# gazelle:prefix example.com/m
+# gazelle:go_test_mode per_package
+`), 0o666); err != nil {
+		t.Fatal(err)
+	}
 	if err := runGazelle(dir, []string{"update"}); err != nil {
 		t.Fatal(err)
 	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "lib/BUILD.bazel",
+		Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
-	testtools.CheckFiles(t, dir, []testtools.FileSpec{
-		{
-			Path: "BUILD.bazel",
-			Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/m/lib",
+    visibility = ["//visibility:public"],
+)
 
-# gazelle:prefix example.com/foo
+go_test(
+    name = "lib_test",
+    srcs = [
+        "a_test.go",
+        "b_test.go",
+    ],
+    embed = [":lib"],
+)
+`,
+	}})
+
+	// And back again.
+	if err := os.WriteFile(filepath.Join(dir, "BUILD.bazel"), []byte(`# gazelle:prefix example.com/m
+# gazelle:go_test_mode per_file
+`), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := runGazelle(dir, []string{"update"}); err != nil {
+		t.Fatal(err)
+	}
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "lib/BUILD.bazel",
+		Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
 go_library(
-    name = "foo",
-    srcs = ["foo.go"],
-    embedsrcs = select({
-        "@io_bazel_rules_go//go/platform:windows": [
-            "windows.txt",
-        ],
-        "//conditions:default": [],
-    }),
-    importpath = "example.com/foo",
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/m/lib",
     visibility = ["//visibility:public"],
 )
+
+go_test(
+    name = "a_test",
+    srcs = ["a_test.go"],
+    embed = [":lib"],
+)
+
+go_test(
+    name = "b_test",
+    srcs = ["b_test.go"],
+    embed = [":lib"],
+)
 `,
-		},
-	})
+	}})
 }
 
-// Checks that go:embed directives with spaces and quotes are parsed correctly.
-// This probably belongs in //language/go:go_test, but we need file names with
-// spaces, and Bazel doesn't allow those in runfiles, which that test depends
-// on.
-func TestQuotedEmbedsrcs(t *testing.T) {
+func TestGoTestModeDefaultKeepsSingleFileTests(t *testing.T) {
 	files := []testtools.FileSpec{
-		{
-			Path: "WORKSPACE",
-		},
+		{Path: "WORKSPACE"},
 		{
 			Path:    "BUILD.bazel",
-			Content: "# gazelle:prefix example.com/foo",
-		},
-		{
-			Path: "foo.go",
-			Content: strings.Join([]string{
-				"package foo",
-				"import \"embed\"",
-				"//go:embed q1.txt q2.txt \"q 3.txt\" `q 4.txt`",
-				"var fs embed.FS",
-			}, "\n"),
-		},
-		{
-			Path: "q1.txt",
-		},
-		{
-			Path: "q2.txt",
-		},
-		{
-			Path: "q 3.txt",
-		},
-		{
-			Path: "q 4.txt",
+			Content: "# gazelle:prefix example.com/m",
+		}, {
+			Path: "foo/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+
+go_library(
+    name = "foo",
+    srcs = ["foo.go"],
+    importpath = "example.com/m/foo",
+    visibility = ["//visibility:public"],
+)
+
+go_test(
+    name = "foo_test",
+    srcs = ["foo_test.go"],
+    embed = [":foo"],
+)
+
+go_test(
+    name = "bar_test",
+    srcs = ["bar_test.go"],
+    embed = [":foo"],
+    tags = ["exclusive"],
+)
+`,
 		},
+		{Path: "foo/foo.go", Content: "package foo"},
+		{Path: "foo/foo_test.go", Content: "package foo"},
+		{Path: "foo/bar_test.go", Content: "package foo"},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
@@ -4413,435 +8980,623 @@ func TestQuotedEmbedsrcs(t *testing.T) {
 	if err := runGazelle(dir, []string{"update"}); err != nil {
 		t.Fatal(err)
 	}
-
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
-		Path: "BUILD.bazel",
+		Path: "foo/BUILD.bazel",
 		Content: `
-load("@io_bazel_rules_go//go:def.bzl", "go_library")
-
-# gazelle:prefix example.com/foo
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
 
 go_library(
     name = "foo",
     srcs = ["foo.go"],
-    embedsrcs = [
-        "q 3.txt",
-        "q 4.txt",
-        "q1.txt",
-        "q2.txt",
-    ],
-    importpath = "example.com/foo",
+    importpath = "example.com/m/foo",
     visibility = ["//visibility:public"],
 )
+
+go_test(
+    name = "foo_test",
+    srcs = [
+        "bar_test.go",
+        "foo_test.go",
+    ],
+    embed = [":foo"],
+)
+
+go_test(
+    name = "bar_test",
+    srcs = ["bar_test.go"],
+    embed = [":foo"],
+    tags = ["exclusive"],
+)
 `,
 	}})
 }
 
-// TestUpdateReposDoesNotModifyGoSum verifies that commands executed by
-// update-repos do not modify go.sum, particularly 'go mod download' when
-// a sum is missing. Verifies #990.
-//
-// This could also be tested in language/go/update_import_test.go, but that
-// test relies on stubs for speed, and it's important to run the real
-// go command here.
-func TestUpdateReposDoesNotModifyGoSum(t *testing.T) {
-	if testing.Short() {
-		// Test may download small files over network.
-		t.Skip()
-	}
-	goSumFile := testtools.FileSpec{
-		// go.sum only contains the sum for the mod file, not the content.
-		// This is common for transitive dependencies not needed by the main module.
-		Path:    "go.sum",
-		Content: "golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1/go.mod h1:I/5z698sn9Ka8TeJc9MKroUUfqBBauWjQqLJ2OPfmY0=\n",
-	}
+func TestResolveGeneratedSrcs(t *testing.T) {
 	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path:    "WORKSPACE",
-			Content: "# gazelle:repo bazel_gazelle",
-		},
-		{
-			Path: "go.mod",
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix example.com/m",
+		}, {
+			Path: "gen/BUILD.bazel",
 			Content: `
-module test
+genrule(
+    name = "api_src",
+    outs = ["api/api.pb.go"],
+    cmd = "gen $@",
+)
+`,
+		}, {
+			Path: "lib/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-go 1.16
+go_library(
+    name = "api",
+    srcs = ["//gen:api_src"],
+    visibility = ["//visibility:public"],
+)
 
-require golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
+go_library(
+    name = "wrapper",
+    srcs = ["//gen:api_src"],
+    importpath = "example.com/m/lib/wrapper",
+    visibility = ["//visibility:public"],
+)
+`,
+		}, {
+			Path: "use/use.go",
+			Content: `package use
+
+import _ "example.com/m/gen/api"
 `,
 		},
-		goSumFile,
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	if err := runGazelle(dir, []string{"update-repos", "-from_file=go.mod"}); err != nil {
+	if err := runGazelle(dir, []string{"update"}); err != nil {
 		t.Fatal(err)
 	}
-	testtools.CheckFiles(t, dir, []testtools.FileSpec{goSumFile})
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+		Path: "use/BUILD.bazel",
+		Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "use",
+    srcs = ["use.go"],
+    importpath = "example.com/m/use",
+    visibility = ["//visibility:public"],
+    deps = ["//lib:api"],
+)
+`,
+	}})
 }
 
-func TestResolveGoStaticFromGoMod(t *testing.T) {
-	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+func TestChangedFiles(t *testing.T) {
+	files := []testtools.FileSpec{
 		{Path: "WORKSPACE"},
 		{
-			Path: "go.mod",
-			Content: `
-module example.com/use
-
-go 1.19
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix example.com/m",
+		}, {
+			Path:    "a/a.go",
+			Content: "package a",
+		}, {
+			Path: "b/b.go",
+			Content: `package b
 
-require example.com/dep v1.0.0
+import _ "example.com/m/a"
 `,
-		},
-		{
-			Path: "use.go",
+		}, {
+			Path: "b/BUILD.bazel",
 			Content: `
-package use
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-import _ "example.com/dep/pkg"
+go_library(
+    name = "b",
+    srcs = ["b.go"],
+    importpath = "example.com/m/b",
+    visibility = ["//visibility:public"],
+    deps = ["//a:old"],
+)
 `,
+		}, {
+			Path:    "c/c.go",
+			Content: "package c",
+		}, {
+			Path:    "changed.txt",
+			Content: "a/a.go\ngone/gone.go\n",
 		},
-	})
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	args := []string{
-		"-go_prefix=example.com/use",
-		"-external=static",
-		"-go_naming_convention_external=import",
-	}
-	if err := runGazelle(dir, args); err != nil {
+	if err := runGazelle(dir, []string{"update", "-changed_files=@changed.txt"}); err != nil {
 		t.Fatal(err)
 	}
-
 	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "BUILD.bazel",
+			Path: "a/BUILD.bazel",
 			Content: `
 load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
 go_library(
-    name = "use",
-    srcs = ["use.go"],
-    importpath = "example.com/use",
+    name = "a",
+    srcs = ["a.go"],
+    importpath = "example.com/m/a",
     visibility = ["//visibility:public"],
-    deps = ["@com_example_dep//pkg"],
 )
 `,
-		},
-	})
-}
-
-func TestMigrateSelectFromWorkspaceToBzlmod(t *testing.T) {
-	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
-		{Path: "WORKSPACE"},
-		{
-			Path:    "MODULE.bazel",
-			Content: `bazel_dep(name = "rules_go", version = "0.39.1", repo_name = "my_rules_go")`,
-		},
-		{
-			Path: "BUILD",
-			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+		}, {
+			// b depends on a package with changed files, so it's resolved again.
+			Path: "b/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
 go_library(
-    name = "foo",
-    srcs = [
-        "bar.go",
-        "foo.go",
-        "foo_android.go",
-        "foo_android_build_tag.go",
-    ],
-    importpath = "example.com/foo",
+    name = "b",
+    srcs = ["b.go"],
+    importpath = "example.com/m/b",
     visibility = ["//visibility:public"],
-    deps = select({
-        "@io_bazel_rules_go//go/platform:android": [
-            "//outer",
-            "//outer/inner",
-            "//outer_android_build_tag",
-            "//outer_android_suffix",
-            "@com_github_jr_hacker_tools//:go_default_library",
-        ],
-        "@io_bazel_rules_go//go/platform:linux": [
-            "//outer",
-            "//outer/inner",
-            "@com_github_jr_hacker_tools//:go_default_library",
-        ],
-        "//conditions:default": [],
-    }),
+    deps = ["//a"],
 )
 `,
+		}, {
+			// The root directory has a deleted subdirectory, so it's updated.
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix example.com/m",
+		}, {
+			Path:     "c/BUILD.bazel",
+			NotExist: true,
 		},
-		{
-			Path: "foo.go",
-			Content: `
-// +build linux
+	})
 
-package foo
+	if err := runGazelle(dir, []string{"update", "-changed_files=a/a.go", "c"}); err == nil {
+		t.Error("-changed_files with directory arguments: got success; want error")
+	}
+}
 
-import (
-    _ "example.com/foo/outer"
-    _ "example.com/foo/outer/inner"
-    _ "github.com/jr_hacker/tools"
-)
-`,
-		},
+func TestResolveEmbedsAcrossPackages(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path: "foo_android_build_tag.go",
+			Path: "BUILD.bazel",
 			Content: `
-// +build android
-
-package foo
-
-import (
-    _ "example.com/foo/outer_android_build_tag"
-)
+# gazelle:prefix example.com/m
+# gazelle:resolve go_embed go example.com/m/pkg/schema.json @com_example_b//gen:schema
 `,
-		},
-		{
-			Path: "foo_android.go",
+		}, {
+			Path: "pkg/assets/BUILD.bazel",
 			Content: `
-package foo
-
-import (
-    _ "example.com/foo/outer_android_suffix"
-)
-`,
-		},
-		{
-			Path: "bar.go",
-			Content: `// +build linux
-
-package foo
-`,
-		},
-		{Path: "outer/outer.go", Content: "package outer"},
-		{Path: "outer_android_build_tag/outer.go", Content: "package outer_android_build_tag"},
-		{Path: "outer_android_suffix/outer.go", Content: "package outer_android_suffix"},
-		{Path: "outer/inner/inner.go", Content: "package inner"},
-	})
-	want := `load("@io_bazel_rules_go//go:def.bzl", "go_library")
-
-go_library(
-    name = "foo",
-    srcs = [
-        "bar.go",
-        "foo.go",
-        "foo_android.go",
-        "foo_android_build_tag.go",
-    ],
-    importpath = "example.com/foo",
+filegroup(
+    name = "assets",
+    srcs = ["logo.png"],
     visibility = ["//visibility:public"],
-    deps = select({
-        "@my_rules_go//go/platform:android": [
-            "//outer",
-            "//outer/inner",
-            "//outer_android_build_tag",
-            "//outer_android_suffix",
-            "@com_github_jr_hacker_tools//:go_default_library",
-        ],
-        "@my_rules_go//go/platform:linux": [
-            "//outer",
-            "//outer/inner",
-            "@com_github_jr_hacker_tools//:go_default_library",
-        ],
-        "//conditions:default": [],
-    }),
 )
-`
-	defer cleanup()
+`,
+		},
+		{Path: "pkg/assets/logo.png"},
+		{Path: "pkg/local.txt"},
+		{
+			Path: "pkg/pkg.go",
+			Content: `package pkg
 
-	if err := runGazelle(dir, []string{"-go_prefix", "example.com/foo"}); err != nil {
-		t.Fatal(err)
+import _ "embed"
+
+//go:embed local.txt
+var local string
+
+//go:embed assets/logo.png
+var logo []byte
+
+//go:embed schema.json
+var schema []byte
+`,
+		},
 	}
-	if got, err := os.ReadFile(filepath.Join(dir, "BUILD")); err != nil {
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	if err := runGazelle(dir, []string{"update"}); err != nil {
 		t.Fatal(err)
-	} else if string(got) != want {
-		t.Fatalf("got %s ; want %s; diff %s", string(got), want, cmp.Diff(string(got), want))
 	}
-}
 
-func TestUpdateReposWithBzlmodWithToMacro(t *testing.T) {
-	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
-		{Path: "WORKSPACE"},
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "go.mod",
+			Path: "pkg/BUILD.bazel",
 			Content: `
-module example.com/foo/v2
-
-go 1.19
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-require (
-	github.com/stretchr/testify v1.8.4
+go_library(
+    name = "pkg",
+    srcs = ["pkg.go"],
+    embedsrcs = [
+        "local.txt",
+        "//pkg/assets",
+        "@com_example_b//gen:schema",
+    ],
+    importpath = "example.com/m/pkg",
+    visibility = ["//visibility:public"],
 )
 `,
 		},
 	})
+}
 
-	t.Cleanup(cleanup)
+// emitLang is a language that provides an emit mode, which records the
+// build files it's called with instead of writing them.
+type emitLang struct {
+	language.BaseLang
+	name    string
+	emitted map[string]string
+}
 
-	args := []string{
-		"update-repos",
-		"-from_file=go.mod",
-		"-to_macro=go_deps.bzl%my_go_deps",
-		"-bzlmod",
+func (l *emitLang) Name() string { return l.name }
+
+func (l *emitLang) EmitModes() map[string]language.EmitFunc {
+	return map[string]language.EmitFunc{
+		"record": func(c *config.Config, f *rule.File) error {
+			rel, err := filepath.Rel(c.RepoRoot, f.Path)
+			if err != nil {
+				return err
+			}
+			l.emitted[filepath.ToSlash(rel)] = string(f.Format())
+			return nil
+		},
 	}
-	if err := runGazelle(dir, args); err != nil {
-		t.Fatal(err)
+}
+
+func TestCustomEmitMode(t *testing.T) {
+	lang := &emitLang{name: "emit", emitted: make(map[string]string)}
+	defer func(old []language.Language) { languages = old }(languages)
+	languages = append(languages[:len(languages):len(languages)], lang)
+
+	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{Path: "BUILD.bazel", Content: "# gazelle:prefix example.com/m"},
+		{Path: "a/a.go", Content: "package a"},
 	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
 
-	// Confirm that the WORKSPACE is still empty
-	want := ""
-	if got, err := os.ReadFile(filepath.Join(dir, "WORKSPACE")); err != nil {
+	if err := runGazelle(dir, []string{"-mode=record"}); err != nil {
 		t.Fatal(err)
-	} else if string(got) != want {
-		t.Fatalf("got %s ; want %s; diff %s", string(got), want, cmp.Diff(string(got), want))
 	}
 
-	// Confirm that the macro file was written
-	want = `load("@bazel_gazelle//:deps.bzl", "go_repository")
+	want := map[string]string{
+		"BUILD.bazel": "# gazelle:prefix example.com/m\n",
+		"a/BUILD.bazel": `load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-def my_go_deps():
-    go_repository(
-        name = "com_github_stretchr_testify",
-        importpath = "github.com/stretchr/testify",
-        sum = "h1:CcVxjf3Q8PM0mHUKJCdn+eZZtm5yQwehR5yeSVQQcUk=",
-        version = "v1.8.4",
-    )
-`
-	if got, err := os.ReadFile(filepath.Join(dir, "go_deps.bzl")); err != nil {
-		t.Fatal(err)
-	} else if string(got) != want {
-		t.Fatalf("got %s ; want %s; diff %s", string(got), want, cmp.Diff(string(got), want))
+go_library(
+    name = "a",
+    srcs = ["a.go"],
+    importpath = "example.com/m/a",
+    visibility = ["//visibility:public"],
+)
+`,
+	}
+	if diff := cmp.Diff(want, lang.emitted); diff != "" {
+		t.Errorf("emitted files (-want,+got):\n%s", diff)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a", "BUILD.bazel")); !os.IsNotExist(err) {
+		t.Errorf("a/BUILD.bazel was written with -mode=record: %v", err)
 	}
 }
 
-func TestUpdateReposWithBzlmodWithoutToMacro(t *testing.T) {
-	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
-		{Path: "WORKSPACE"},
+func TestEmitModesConflict(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		langs   []language.Language
+		wantErr string
+	}{
 		{
-			Path: "go.mod",
-			Content: `
-module example.com/foo/v2
+			desc: "built-in",
+			langs: []language.Language{&overrideEmitLang{
+				emitLang: emitLang{name: "override"},
+			}},
+			wantErr: `override: emit mode "diff" conflicts with a built-in mode`,
+		}, {
+			desc: "other language",
+			langs: []language.Language{
+				&emitLang{name: "first"},
+				&emitLang{name: "second"},
+			},
+			wantErr: `emit mode "record" is provided by both first and second`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{{Path: "WORKSPACE"}})
+			defer cleanup()
+			_, err := gazelle.Run(context.Background(), gazelle.Config{WorkDir: dir}, tc.langs)
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("got error %v; want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
 
-go 1.19
+type overrideEmitLang struct {
+	emitLang
+}
 
-require (
-	github.com/stretchr/testify v1.8.4
-)
-`,
+func (l *overrideEmitLang) EmitModes() map[string]language.EmitFunc {
+	return map[string]language.EmitFunc{
+		"diff": func(*config.Config, *rule.File) error { return nil },
+	}
+}
+
+func TestGitCommitMode(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	for _, tc := range []struct {
+		desc        string
+		args        []string
+		wantCommits []string
+	}{
+		{
+			desc:        "single",
+			args:        []string{"-mode=git-commit", "-commit_message=Update BUILD files"},
+			wantCommits: []string{"Update BUILD files\ta/BUILD.bazel b/c/BUILD.bazel"},
+		}, {
+			desc: "per_dir",
+			args: []string{"-mode=git-commit", "-commit_message=Update BUILD files", "-commit_per_dir"},
+			wantCommits: []string{
+				"b: Update BUILD files\tb/c/BUILD.bazel",
+				"a: Update BUILD files\ta/BUILD.bazel",
+			},
 		},
-	})
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+				{Path: "WORKSPACE"},
+				{Path: "BUILD.bazel", Content: "# gazelle:prefix example.com/m\n"},
+				{Path: "a/a.go", Content: "package a"},
+				{Path: "b/c/c.go", Content: "package c"},
+				{Path: "other.txt", Content: "unrelated change"},
+			})
+			defer cleanup()
+			t.Setenv("GIT_AUTHOR_NAME", "gazelle")
+			t.Setenv("GIT_AUTHOR_EMAIL", "gazelle@example.com")
+			t.Setenv("GIT_COMMITTER_NAME", "gazelle")
+			t.Setenv("GIT_COMMITTER_EMAIL", "gazelle@example.com")
+			git := func(args ...string) string {
+				t.Helper()
+				cmd := exec.Command("git", args...)
+				cmd.Dir = dir
+				out, err := cmd.CombinedOutput()
+				if err != nil {
+					t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+				}
+				return string(out)
+			}
+			git("init", "--quiet")
+			git("add", "WORKSPACE", "BUILD.bazel", "a/a.go", "b/c/c.go")
+			git("commit", "--quiet", "--message=initial")
 
-	t.Cleanup(cleanup)
+			if err := runGazelle(dir, tc.args); err != nil {
+				t.Fatal(err)
+			}
 
-	args := []string{
-		"update-repos",
-		"-from_file=go.mod",
-		"-bzlmod",
+			// Each commit is described by its subject and the files it changed.
+			var got []string
+			for i := range tc.wantCommits {
+				rev := fmt.Sprintf("HEAD~%d", i)
+				subject := strings.TrimSpace(git("log", "-1", "--format=%s", rev))
+				files := strings.Fields(git("show", "--name-only", "--format=", rev))
+				got = append(got, subject+"\t"+strings.Join(files, " "))
+			}
+			if diff := cmp.Diff(tc.wantCommits, got); diff != "" {
+				t.Errorf("commits (-want,+got):\n%s", diff)
+			}
+			if status := git("status", "--porcelain"); status != "?? other.txt\n" {
+				t.Errorf("got git status:\n%s\nwant only other.txt untracked", status)
+			}
+		})
 	}
-	if err := runGazelle(dir, args); err != nil {
+}
+
+func TestIndexOutIn(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "other/WORKSPACE", Content: `workspace(name = "com_example_other")`},
+		{Path: "other/BUILD.bazel", Content: "# gazelle:prefix example.com/other"},
+		{Path: "other/lib/lib.go", Content: "package lib"},
+		{Path: "main/WORKSPACE"},
+		{Path: "main/BUILD.bazel", Content: "# gazelle:prefix example.com/main"},
+		{Path: "main/app/app.go", Content: `package app
+
+import _ "example.com/other/lib"
+`},
+	})
+	defer cleanup()
+
+	indexPath := filepath.Join(dir, "other.json")
+	if err := runGazelle(filepath.Join(dir, "other"), []string{"-index_out=" + indexPath}); err != nil {
 		t.Fatal(err)
 	}
+	for _, tc := range []struct {
+		indexIn, wantDep string
+	}{
+		{indexIn: indexPath, wantDep: "@com_example_other//lib"},
+		{indexIn: "other_alias=" + indexPath, wantDep: "@other_alias//lib"},
+	} {
+		if err := runGazelle(filepath.Join(dir, "main"), []string{"-external=static", "-index_in=" + tc.indexIn}); err != nil {
+			t.Fatal(err)
+		}
+		testtools.CheckFiles(t, dir, []testtools.FileSpec{{
+			Path: "main/app/BUILD.bazel",
+			Content: fmt.Sprintf(`load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
-	// Confirm that the WORKSPACE is still empty
-	want := ""
-	if got, err := os.ReadFile(filepath.Join(dir, "WORKSPACE")); err != nil {
-		t.Fatal(err)
-	} else if string(got) != want {
-		t.Fatalf("got %s ; want %s; diff %s", string(got), want, cmp.Diff(string(got), want))
+go_library(
+    name = "app",
+    srcs = ["app.go"],
+    importpath = "example.com/main/app",
+    visibility = ["//visibility:public"],
+    deps = ["%s"],
+)
+`, tc.wantDep),
+		}})
 	}
 }
 
-func TestCgoFlagsHaveExternalPrefix(t *testing.T) {
+func TestConfigFile(t *testing.T) {
 	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path:    "external/com_example_foo_v2/go.mod",
-			Content: "module example.com/foo/v2",
-		}, {
-			Path: "external/com_example_foo_v2/cgo_static.go",
-			Content: `
-package duckdb
-
-/*
-#cgo LDFLAGS: -lstdc++ -lm -ldl -L${SRCDIR}/deps
-*/
-import "C"
+			Path: ".gazelle.yaml",
+			Content: `go_prefix: example.com/m
+go_naming_convention: go_default_library
+exclude:
+  - skip
 `,
+		}, {
+			Path:    "foo/foo.go",
+			Content: "package foo",
+		}, {
+			Path:    "skip/skip.go",
+			Content: "package skip",
 		},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	repoRoot := filepath.Join(dir, "external", "com_example_foo_v2")
-
-	args := []string{"update", "-repo_root", repoRoot, "-go_prefix", "example.com/foo/v2", "-go_repository_mode", "-go_repository_module_mode"}
-	if err := runGazelle(repoRoot, args); err != nil {
+	// Flags on the command line take precedence over the config file.
+	if err := runGazelle(dir, []string{"-go_naming_convention=import"}); err != nil {
 		t.Fatal(err)
 	}
 
-	testtools.CheckFiles(t, repoRoot, []testtools.FileSpec{
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "BUILD.bazel",
+			Path: "foo/BUILD.bazel",
 			Content: `
 load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
 go_library(
     name = "foo",
-    srcs = ["cgo_static.go"],
-    cgo = True,
-    clinkopts = ["-lstdc++ -lm -ldl -Lexternal/com_example_foo_v2/deps"],
-    importpath = "example.com/foo/v2",
-    importpath_aliases = ["example.com/foo"],
+    srcs = ["foo.go"],
+    importpath = "example.com/m/foo",
     visibility = ["//visibility:public"],
 )
 `,
+		}, {
+			Path:     "skip/BUILD.bazel",
+			NotExist: true,
 		},
 	})
 }
 
-func TestCgoFlagsHaveDotDotPrefixWithSiblingRepositoryLayout(t *testing.T) {
+// TestConfigFileRelativePaths checks that relative paths set in the config
+// file are resolved against the repository root, even when Gazelle runs in a
+// subdirectory.
+func TestConfigFileRelativePaths(t *testing.T) {
 	files := []testtools.FileSpec{
+		{Path: "WORKSPACE"},
 		{
-			Path:    "execroot/com_example_foo_v2/go.mod",
-			Content: "module example.com/foo/v2",
-		}, {
-			Path: "execroot/com_example_foo_v2/cgo_static.go",
-			Content: `
-package duckdb
-
-/*
-#cgo LDFLAGS: -lstdc++ -lm -ldl -L${SRCDIR}/deps
-*/
-import "C"
+			Path: ".gazelle.yaml",
+			Content: `go_prefix: example.com/m
+managed_files_out: managed.txt
 `,
+		}, {
+			Path:    "foo/foo.go",
+			Content: "package foo",
 		},
 	}
 	dir, cleanup := testtools.CreateFiles(t, files)
 	defer cleanup()
 
-	repoRoot := filepath.Join(dir, "execroot", "com_example_foo_v2")
+	if err := runGazelle(filepath.Join(dir, "foo"), nil); err != nil {
+		t.Fatal(err)
+	}
 
-	args := []string{"update", "-repo_root", repoRoot, "-go_prefix", "example.com/foo/v2", "-go_repository_mode", "-go_repository_module_mode"}
-	if err := runGazelle(repoRoot, args); err != nil {
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path:    "managed.txt",
+			Content: "foo/BUILD.bazel\n",
+		}, {
+			Path:     "foo/managed.txt",
+			NotExist: true,
+		},
+	})
+}
+
+func TestVendorSymlinksToModuleCache(t *testing.T) {
+	cache, cleanupCache := testtools.CreateFiles(t, []testtools.FileSpec{
+		{
+			Path:    "example.com/dep@v1.0.0/dep.go",
+			Content: "package dep",
+		},
+	})
+	defer cleanupCache()
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path:    "BUILD.bazel",
+			Content: "# gazelle:prefix example.com/m",
+		}, {
+			Path: "lib/lib.go",
+			Content: `package lib
+
+import _ "example.com/dep"
+`,
+		},
+		{Path: "vendor/example.com/"},
+	})
+	defer cleanup()
+	target := filepath.Join(cache, "example.com", "dep@v1.0.0")
+	for _, name := range []string{"dep", "dep_copy"} {
+		if err := os.Symlink(target, filepath.Join(dir, "vendor", "example.com", name)); err != nil {
+			t.Skipf("can't create symlinks: %v", err)
+		}
+	}
+
+	args := []string{"update", "-external=vendored"}
+	if err := runGazelle(dir, args); err != nil {
 		t.Fatal(err)
 	}
 
-	testtools.CheckFiles(t, repoRoot, []testtools.FileSpec{
+	// The linked module is generated once, through the first link, and
+	// labels refer to it by its path in the repository.
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
 		{
-			Path: "BUILD.bazel",
+			Path: "lib/BUILD.bazel",
 			Content: `
 load("@io_bazel_rules_go//go:def.bzl", "go_library")
 
 go_library(
-    name = "foo",
-    srcs = ["cgo_static.go"],
-    cgo = True,
-    clinkopts = ["-lstdc++ -lm -ldl -L../com_example_foo_v2/deps"],
-    importpath = "example.com/foo/v2",
-    importpath_aliases = ["example.com/foo"],
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/m/lib",
+    visibility = ["//visibility:public"],
+    deps = ["//vendor/example.com/dep"],
+)
+`,
+		}, {
+			Path: "vendor/example.com/dep/BUILD.bazel",
+			Content: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "dep",
+    srcs = ["dep.go"],
+    importmap = "example.com/m/vendor/example.com/dep",
+    importpath = "example.com/dep",
     visibility = ["//visibility:public"],
 )
 `,
 		},
 	})
+
+	// A linked directory may be named on the command line.
+	if err := os.Remove(filepath.Join(target, "BUILD.bazel")); err != nil {
+		t.Fatal(err)
+	}
+	args = []string{"update", "-external=vendored", "vendor/example.com/dep"}
+	if err := runGazelle(dir, args); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "BUILD.bazel")); err != nil {
+		t.Error(err)
+	}
 }
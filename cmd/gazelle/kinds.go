@@ -0,0 +1,245 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/bazelbuild/bazel-gazelle/walk"
+)
+
+// kindStats describes the rules of one kind found by the kinds command.
+type kindStats struct {
+	// Kind is the name of the rule kind, as written in build files.
+	Kind string `json:"kind"`
+
+	// Count is the number of rules of this kind.
+	Count int `json:"count"`
+
+	// Language is the name of the language that claims the kind, either
+	// directly or through a # gazelle:map_kind directive. It's empty if no
+	// language loaded in this binary claims the kind.
+	Language string `json:"language,omitempty"`
+
+	// MappedFrom lists the kinds mapped to this kind with
+	// # gazelle:map_kind directives.
+	MappedFrom []string `json:"mapped_from,omitempty"`
+
+	// Loads lists the .bzl files the kind is loaded from. Native rules
+	// aren't loaded, so this is empty for them.
+	Loads []string `json:"loads,omitempty"`
+}
+
+// kinds lists each rule kind used in the build files of the repository,
+// with the number of rules of that kind, the language that claims it, and
+// the files it's loaded from. This helps to choose the languages and
+// # gazelle:map_kind directives a custom gazelle_binary needs.
+func kinds(wd string, args []string) error {
+	cexts := make([]config.Configurer, 0, len(languages)+2)
+	cexts = append(cexts, &config.CommonConfigurer{}, &walk.Configurer{})
+	for _, lang := range languages {
+		cexts = append(cexts, lang)
+	}
+
+	c := config.New()
+	c.WorkDir = wd
+	fs := flag.NewFlagSet("gazelle", flag.ContinueOnError)
+	// Flag will call this on any parse error. Don't print usage unless
+	// -h or -help were passed explicitly.
+	fs.Usage = func() {}
+	var jsonOut, unknownOnly bool
+	var outPath string
+	fs.BoolVar(&jsonOut, "json", false, "when true, the kinds are printed as a JSON array instead of a table")
+	fs.BoolVar(&unknownOnly, "unknown", false, "when true, only kinds that no language claims are listed")
+	fs.StringVar(&outPath, "out", "", "file to write the kinds to. If unset, they're printed to stdout.")
+	for _, cext := range cexts {
+		cext.RegisterFlags(fs, "kinds", c)
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			kindsUsage(fs)
+			return err
+		}
+		// flag already prints the error; don't print it again.
+		return errors.New("Try -help for more information")
+	}
+	if len(fs.Args()) != 0 {
+		return fmt.Errorf("got %d positional arguments; wanted 0.\nTry -help for more information.", len(fs.Args()))
+	}
+	for _, cext := range cexts {
+		if err := cext.CheckFlags(fs, c); err != nil {
+			return err
+		}
+	}
+
+	stats := collectKindStats(c, cexts, languages)
+	if unknownOnly {
+		unknown := stats[:0]
+		for _, s := range stats {
+			if s.Language == "" {
+				unknown = append(unknown, s)
+			}
+		}
+		stats = unknown
+	}
+
+	var w io.Writer = os.Stdout
+	if outPath != "" {
+		if !filepath.IsAbs(outPath) {
+			outPath = filepath.Join(wd, outPath)
+		}
+		f, err := os.Create(outPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if jsonOut {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if stats == nil {
+			stats = []kindStats{}
+		}
+		return enc.Encode(stats)
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tCOUNT\tLANGUAGE\tLOADED FROM")
+	for _, s := range stats {
+		lang := s.Language
+		if lang == "" {
+			lang = "-"
+		} else if len(s.MappedFrom) > 0 {
+			lang = fmt.Sprintf("%s (map_kind from %s)", lang, strings.Join(s.MappedFrom, ", "))
+		}
+		loads := "native"
+		if len(s.Loads) > 0 {
+			loads = strings.Join(s.Loads, ", ")
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", s.Kind, s.Count, lang, loads)
+	}
+	return tw.Flush()
+}
+
+// collectKindStats walks all build files in the repository and returns
+// statistics for each rule kind, sorted by decreasing count, then by name.
+func collectKindStats(c *config.Config, cexts []config.Configurer, langs []language.Language) []kindStats {
+	langKinds := make(map[string]string)
+	for _, lang := range langs {
+		for kind := range lang.Kinds() {
+			if _, ok := langKinds[kind]; !ok {
+				langKinds[kind] = lang.Name()
+			}
+		}
+	}
+
+	type kindInfo struct {
+		stats      kindStats
+		loads      map[string]bool
+		mappedFrom map[string]bool
+	}
+	infos := make(map[string]*kindInfo)
+	walk.Walk(c, cexts, []string{c.RepoRoot}, walk.VisitAllUpdateSubdirsMode, func(_, _ string, c *config.Config, _ bool, f *rule.File, _, _, _ []string) {
+		if f == nil {
+			return
+		}
+		loadedFrom := make(map[string]string)
+		for _, l := range f.Loads {
+			for _, sym := range l.Symbols() {
+				loadedFrom[sym] = l.Name()
+			}
+		}
+		for _, r := range f.Rules {
+			kind := r.Kind()
+			info, ok := infos[kind]
+			if !ok {
+				info = &kindInfo{
+					stats:      kindStats{Kind: kind, Language: langKinds[kind]},
+					loads:      make(map[string]bool),
+					mappedFrom: make(map[string]bool),
+				}
+				infos[kind] = info
+			}
+			info.stats.Count++
+			if load, ok := loadedFrom[kind]; ok {
+				info.loads[load] = true
+			}
+			for _, mk := range c.KindMap {
+				if mk.KindName != kind {
+					continue
+				}
+				info.mappedFrom[mk.FromKind] = true
+				if info.stats.Language == "" {
+					info.stats.Language = langKinds[mk.FromKind]
+				}
+			}
+		}
+	})
+
+	stats := make([]kindStats, 0, len(infos))
+	for _, info := range infos {
+		s := info.stats
+		s.Loads = sortedKeys(info.loads)
+		s.MappedFrom = sortedKeys(info.mappedFrom)
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		return stats[i].Kind < stats[j].Kind
+	})
+	return stats
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func kindsUsage(fs *flag.FlagSet) {
+	fmt.Fprint(os.Stderr, `usage: gazelle kinds [flags...]
+
+The kinds command lists each rule kind used in the build files of the
+repository, with the number of rules of that kind, the language in this
+Gazelle binary that claims it, and the files it's loaded from. Kinds that are
+claimed through # gazelle:map_kind directives are shown with the kinds they're
+mapped from. Kinds that no language claims are shown with "-".
+
+This is useful before building a custom gazelle_binary, to find which
+languages and map_kind directives are actually needed.
+
+FLAGS:
+
+`)
+	fs.PrintDefaults()
+}
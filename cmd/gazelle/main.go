@@ -18,13 +18,13 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 
-	"github.com/bazelbuild/bazel-gazelle/config"
-	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/pkg/gazelle"
 )
 
 type command int
@@ -33,14 +33,24 @@ const (
 	updateCmd command = iota
 	fixCmd
 	updateReposCmd
+	migrateWorkspaceCmd
+	doctorCmd
+	listDepsCmd
+	kindsCmd
+	explainCmd
 	helpCmd
 )
 
 var commandFromName = map[string]command{
-	"fix":          fixCmd,
-	"help":         helpCmd,
-	"update":       updateCmd,
-	"update-repos": updateReposCmd,
+	"doctor":            doctorCmd,
+	"explain":           explainCmd,
+	"fix":               fixCmd,
+	"help":              helpCmd,
+	"kinds":             kindsCmd,
+	"list-deps":         listDepsCmd,
+	"migrate-workspace": migrateWorkspaceCmd,
+	"update":            updateCmd,
+	"update-repos":      updateReposCmd,
 }
 
 var nameFromCommand = []string{
@@ -48,6 +58,11 @@ var nameFromCommand = []string{
 	"update",
 	"fix",
 	"update-repos",
+	"migrate-workspace",
+	"doctor",
+	"list-deps",
+	"kinds",
+	"explain",
 	"help",
 }
 
@@ -70,7 +85,7 @@ func main() {
 	}
 
 	if err := run(wd, os.Args[1:]); err != nil && err != flag.ErrHelp {
-		if err == errExit {
+		if err == gazelle.ErrDiffChanges {
 			os.Exit(1)
 		} else {
 			log.Fatal(err)
@@ -92,11 +107,32 @@ func run(wd string, args []string) error {
 
 	switch cmd {
 	case fixCmd, updateCmd:
-		return runFixUpdate(wd, cmd, args)
+		_, err := gazelle.Run(context.Background(), gazelle.Config{
+			Command: cmd.String(),
+			Args:    args,
+			WorkDir: wd,
+		}, languages)
+		return err
 	case helpCmd:
 		return help()
 	case updateReposCmd:
 		return updateRepos(wd, args)
+	case migrateWorkspaceCmd:
+		return migrateWorkspace(wd, args)
+	case doctorCmd:
+		return doctor(wd, args)
+	case listDepsCmd:
+		return gazelle.ListDeps(context.Background(), gazelle.Config{
+			Args:    args,
+			WorkDir: wd,
+		}, languages, os.Stdout)
+	case kindsCmd:
+		return kinds(wd, args)
+	case explainCmd:
+		return gazelle.Explain(context.Background(), gazelle.Config{
+			Args:    args,
+			WorkDir: wd,
+		}, languages, os.Stdout)
 	default:
 		log.Panicf("unknown command: %v", cmd)
 	}
@@ -122,6 +158,20 @@ Gazelle defaults to "update".
       existing rules.
   update-repos - updates repository rules in the WORKSPACE file. Run with
       -h for details.
+  migrate-workspace - moves go_repository rules from WORKSPACE to go_deps
+      tags in MODULE.bazel. Run with -h for details.
+  doctor - checks for common problems in the environment Gazelle runs in,
+      like a missing go command or gazelle_dependencies call, and suggests
+      fixes. Run with -h for details.
+  list-deps - prints the rules that import paths resolve to, or with -reverse,
+      the rules that depend on labels, without changing any files. Run with
+      -h for details.
+  kinds - lists the rule kinds used in build files, how many rules of each
+      kind there are, and which language claims each kind. Run with -h for
+      details.
+  explain - prints why each value is in an attribute of a rule, like the
+      imports and files a dependency was resolved from, without changing any
+      files. Run with -h for details.
   help - show this message.
 
 For usage information for a specific command, run the command with the -h flag.
@@ -135,28 +185,3 @@ without notice.
 `)
 	return flag.ErrHelp
 }
-
-// filterLanguages returns the subset of input languages that pass the config's
-// filter, if any. Gazelle should not generate rules for languages not returned.
-func filterLanguages(c *config.Config, langs []language.Language) []language.Language {
-	if len(c.Langs) == 0 {
-		return langs
-	}
-
-	var result []language.Language
-	for _, inputLang := range langs {
-		if containsLang(c.Langs, inputLang) {
-			result = append(result, inputLang)
-		}
-	}
-	return result
-}
-
-func containsLang(langNames []string, lang language.Language) bool {
-	for _, langName := range langNames {
-		if langName == lang.Name() {
-			return true
-		}
-	}
-	return false
-}
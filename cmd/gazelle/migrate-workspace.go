@@ -0,0 +1,362 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/internal/module"
+	"github.com/bazelbuild/bazel-gazelle/internal/overrides"
+	"github.com/bazelbuild/bazel-gazelle/internal/wspace"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/merger"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"golang.org/x/mod/modfile"
+)
+
+// migrateWorkspace moves go_repository rules declared in WORKSPACE and the
+// repository macros it calls to go_deps tags in MODULE.bazel. go_deps reads
+// module versions from go.mod, so a go_repository is only migrated if its
+// module is required there and all of its attributes can be expressed as
+// override tags. Migrated rules are deleted. Everything else is listed in a
+// report so it can be migrated by hand.
+func migrateWorkspace(wd string, args []string) error {
+	fs := flag.NewFlagSet("gazelle", flag.ContinueOnError)
+	// Flag will call this on any parse error. Don't print usage unless
+	// -h or -help were passed explicitly.
+	fs.Usage = func() {}
+	var repoRoot, goModRel, reportPath string
+	fs.StringVar(&repoRoot, "repo_root", "", "path to the repository root directory. If unset, Gazelle searches for it from the working directory.")
+	fs.StringVar(&goModRel, "from_file", "go.mod", "path to the go.mod file that go_deps reads, relative to the repository root")
+	fs.StringVar(&reportPath, "report", "", "file to write the report of what couldn't be migrated to. If unset, the report is printed to stderr.")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			migrateWorkspaceUsage(fs)
+			return err
+		}
+		// flag already prints the error; don't print it again.
+		return errors.New("Try -help for more information")
+	}
+	if len(fs.Args()) != 0 {
+		return fmt.Errorf("got %d positional arguments; wanted 0.\nTry -help for more information.", len(fs.Args()))
+	}
+
+	if repoRoot == "" {
+		var err error
+		if repoRoot, err = wspace.FindRepoRoot(wd); err != nil {
+			return fmt.Errorf("-repo_root not specified, and WORKSPACE cannot be found: %v", err)
+		}
+	} else if !filepath.IsAbs(repoRoot) {
+		repoRoot = filepath.Join(wd, repoRoot)
+	}
+
+	workspace, err := rule.LoadWorkspaceFile(wspace.FindWORKSPACEFile(repoRoot), "")
+	if err != nil {
+		return fmt.Errorf("loading WORKSPACE file: %v", err)
+	}
+	repos, repoFileMap, err := repo.ListRepositories(workspace)
+	if err != nil {
+		return fmt.Errorf("loading WORKSPACE file: %v", err)
+	}
+
+	goModPath := filepath.Join(repoRoot, filepath.FromSlash(goModRel))
+	goModData, err := os.ReadFile(goModPath)
+	if err != nil {
+		return err
+	}
+	goMod, err := modfile.ParseLax(goModPath, goModData, nil)
+	if err != nil {
+		return err
+	}
+	required := make(map[string]string)
+	for _, req := range goMod.Require {
+		required[req.Mod.Path] = req.Mod.Version
+	}
+	goSum, err := loadGoSumHashes(filepath.Join(filepath.Dir(goModPath), "go.sum"))
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Name() < repos[j].Name() })
+	var tags []*rule.Rule
+	var report, differences []string
+	useRepo := rule.NewRule("use_repo", "")
+	useRepo.AddArg(&bzl.Ident{Name: "go_deps"})
+	changedFiles := make(map[*rule.File]bool)
+	migrated := 0
+	for _, r := range repos {
+		if repo.IsFromDirective(r) {
+			continue
+		}
+		if r.Kind() != "go_repository" {
+			report = append(report, fmt.Sprintf("%s %q: only go_repository rules are migrated; use bazel_dep or a module extension", r.Kind(), r.Name()))
+			continue
+		}
+		importPath := r.AttrString("importpath")
+		requiredVersion, ok := required[importPath]
+		if !ok {
+			report = append(report, fmt.Sprintf("go_repository %q: %s is not required in %s; add it with go get", r.Name(), importPath, goModRel))
+			continue
+		}
+		if attrs := overrides.UntranslatedAttrs(r); len(attrs) > 0 {
+			report = append(report, fmt.Sprintf("go_repository %q: no go_deps equivalent for %s", r.Name(), strings.Join(attrs, ", ")))
+			continue
+		}
+
+		// go_deps takes the version and sum from go.mod and go.sum, which
+		// may not match what WORKSPACE used.
+		version, sum := r.AttrString("version"), r.AttrString("sum")
+		if version != "" && version != requiredVersion {
+			differences = append(differences, fmt.Sprintf("go_repository %q: version %s differs from %s in %s", r.Name(), version, requiredVersion, goModRel))
+		} else if goSumHash, ok := goSum[importPath+" "+requiredVersion]; ok && sum != "" && sum != goSumHash {
+			differences = append(differences, fmt.Sprintf("go_repository %q: sum %s differs from %s in go.sum", r.Name(), sum, goSumHash))
+		}
+
+		tags = append(tags, overrides.FromGoRepository(r, overrides.DefaultBuildFileGeneration, overrides.DefaultBuildFileProtoMode)...)
+		// go_deps names repositories after their module paths, so
+		// repositories with other names need an alias.
+		if name := label.ImportPathToBazelRepoName(importPath); name == r.Name() {
+			useRepo.AddArg(&bzl.StringExpr{Value: name})
+		} else {
+			useRepo.SetAttr(r.Name(), name)
+		}
+		f := repoFileMap[r.Name()]
+		r.Delete()
+		changedFiles[f] = true
+		migrated++
+	}
+
+	if migrated > 0 {
+		goModLabel := label.New("", path.Dir(path.Clean(filepath.ToSlash(goModRel))), path.Base(goModRel))
+		if goModLabel.Pkg == "." {
+			goModLabel.Pkg = ""
+		}
+		if err := addGoDepsToModule(filepath.Join(repoRoot, "MODULE.bazel"), goModLabel.String(), tags, useRepo); err != nil {
+			return err
+		}
+
+		moduleToApparentName, err := module.ExtractModuleToApparentNameMapping(repoRoot)
+		if err != nil {
+			return err
+		}
+		var loads []rule.LoadInfo
+		for _, lang := range languages {
+			if moduleAwareLang, ok := lang.(language.ModuleAwareLanguage); ok {
+				loads = append(loads, moduleAwareLang.ApparentLoads(moduleToApparentName)...)
+			} else {
+				loads = append(loads, lang.Loads()...)
+			}
+		}
+		files := make([]*rule.File, 0, len(changedFiles))
+		for f := range changedFiles {
+			files = append(files, f)
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+		for _, f := range files {
+			merger.FixLoads(f, loads)
+			if err := f.Save(f.Path); err != nil {
+				return err
+			}
+		}
+	}
+
+	var w io.Writer = os.Stderr
+	if reportPath != "" {
+		if !filepath.IsAbs(reportPath) {
+			reportPath = filepath.Join(wd, reportPath)
+		}
+		reportFile, err := os.Create(reportPath)
+		if err != nil {
+			return err
+		}
+		defer reportFile.Close()
+		w = reportFile
+	}
+	fmt.Fprintf(w, "migrated %d go_repository rules to MODULE.bazel\n", migrated)
+	if len(differences) > 0 {
+		fmt.Fprintf(w, "migrated, but go_deps will use the version from go.mod and go.sum:\n")
+		for _, line := range differences {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+	if len(report) > 0 {
+		fmt.Fprintf(w, "not migrated:\n")
+		for _, line := range report {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+	return nil
+}
+
+// addGoDepsToModule adds the go_deps extension to the MODULE.bazel file at
+// modulePath, unless it's already used, followed by tags and useRepo. The
+// file is created if it doesn't exist.
+func addGoDepsToModule(modulePath, goModLabel string, tags []*rule.Rule, useRepo *rule.Rule) error {
+	data, err := os.ReadFile(modulePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := loadModuleData(modulePath, data)
+	if err != nil {
+		return err
+	}
+
+	gazelleRepoName := "gazelle"
+	hasFromFile := false
+	for _, r := range f.Rules {
+		switch r.Kind() {
+		case "bazel_dep":
+			if r.Name() == "gazelle" && r.AttrString("repo_name") != "" {
+				gazelleRepoName = r.AttrString("repo_name")
+			}
+		case "go_deps.from_file":
+			hasFromFile = true
+		}
+	}
+	hasGoDeps := false
+	for _, stmt := range f.File.Stmt {
+		if assign, ok := stmt.(*bzl.AssignExpr); ok {
+			if lhs, ok := assign.LHS.(*bzl.Ident); ok && lhs.Name == "go_deps" {
+				hasGoDeps = true
+			}
+		}
+	}
+
+	var extra strings.Builder
+	if !hasGoDeps {
+		fmt.Fprintf(&extra, "go_deps = use_extension(\"@%s//:extensions.bzl\", \"go_deps\")\n", gazelleRepoName)
+	}
+	if !hasFromFile {
+		fmt.Fprintf(&extra, "go_deps.from_file(go_mod = %q)\n", goModLabel)
+	}
+	if extra.Len() > 0 {
+		data = append(append(data, '\n'), extra.String()...)
+		if f, err = loadModuleData(modulePath, data); err != nil {
+			return err
+		}
+	}
+	for _, tag := range tags {
+		tag.Insert(f)
+	}
+	if existing := findUseRepo(f, "go_deps"); existing != nil {
+		mergeUseRepo(existing, useRepo)
+	} else {
+		useRepo.Insert(f)
+	}
+	return f.Save(modulePath)
+}
+
+// findUseRepo returns the first use_repo call for the extension proxy named
+// ext in f, or nil if there is none.
+func findUseRepo(f *rule.File, ext string) *rule.Rule {
+	for _, r := range f.Rules {
+		if r.Kind() != "use_repo" {
+			continue
+		}
+		if args := r.Args(); len(args) > 0 {
+			if id, ok := args[0].(*bzl.Ident); ok && id.Name == ext {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// mergeUseRepo adds the repositories imported by src to dst, skipping those
+// dst already imports.
+func mergeUseRepo(dst, src *rule.Rule) {
+	have := make(map[string]bool)
+	for _, arg := range dst.Args()[1:] {
+		if s, ok := arg.(*bzl.StringExpr); ok {
+			have[s.Value] = true
+		}
+	}
+	for _, arg := range src.Args()[1:] {
+		if s, ok := arg.(*bzl.StringExpr); ok && !have[s.Value] {
+			dst.AddArg(&bzl.StringExpr{Value: s.Value})
+			have[s.Value] = true
+		}
+	}
+	for _, key := range src.AttrKeys() {
+		if dst.Attr(key) == nil {
+			dst.SetAttr(key, src.AttrString(key))
+		}
+	}
+}
+
+// loadGoSumHashes reads the go.sum file at goSumPath and returns a map from
+// module paths and versions, separated by a space, to the hashes of the
+// modules' contents. A missing file is not an error.
+func loadGoSumHashes(goSumPath string) (map[string]string, error) {
+	data, err := os.ReadFile(goSumPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		hashes[fields[0]+" "+fields[1]] = fields[2]
+	}
+	return hashes, nil
+}
+
+// loadModuleData parses data as a MODULE.bazel file, so it's formatted the
+// way buildifier formats module files when saved.
+func loadModuleData(modulePath string, data []byte) (*rule.File, error) {
+	ast, err := bzl.ParseModule(modulePath, data)
+	if err != nil {
+		return nil, err
+	}
+	f := rule.ScanAST("", ast)
+	f.Path = modulePath
+	f.Content = data
+	return f, nil
+}
+
+func migrateWorkspaceUsage(fs *flag.FlagSet) {
+	fmt.Fprint(os.Stderr, `usage: gazelle migrate-workspace [flags...]
+
+The migrate-workspace command moves go_repository rules from WORKSPACE and
+the repository macros it calls to MODULE.bazel. It adds the go_deps module
+extension, reading module versions from go.mod with go_deps.from_file, and
+translates go_repository attributes to gazelle_override, module_override, and
+archive_override tags. Migrated go_repository rules are deleted.
+
+Rules that can't be translated are left in place and listed in a report:
+rules of other kinds, go_repository rules for modules not required in go.mod,
+and go_repository rules with attributes go_deps doesn't support.
+
+FLAGS:
+
+`)
+	fs.PrintDefaults()
+}
@@ -0,0 +1,165 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// updateBzlmod requires the modules of the go_repository rules in gen in the
+// go.mod file read by go_deps, with their sums in go.sum, and adds their
+// repositories to the use_repo call for go_deps in MODULE.bazel. This is
+// what -to_bzlmod does instead of writing the rules to WORKSPACE or a macro.
+// go_deps is added to MODULE.bazel if it isn't used yet.
+func updateBzlmod(c *config.Config, gen []*rule.Rule) error {
+	modulePath := filepath.Join(c.RepoRoot, "MODULE.bazel")
+	data, err := os.ReadFile(modulePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	module, err := loadModuleData(modulePath, data)
+	if err != nil {
+		return err
+	}
+
+	goModLabel := "//:go.mod"
+	var useRepo *rule.Rule
+	for _, r := range module.Rules {
+		switch r.Kind() {
+		case "go_deps.from_file":
+			if l := r.AttrString("go_mod"); l != "" {
+				goModLabel = l
+			}
+		case "use_repo":
+			if args := r.Args(); len(args) > 0 {
+				if id, ok := args[0].(*bzl.Ident); ok && id.Name == "go_deps" {
+					useRepo = r
+				}
+			}
+		}
+	}
+	l, err := label.Parse(goModLabel)
+	if err != nil || l.Repo != "" {
+		return fmt.Errorf("%s: go_deps.from_file reads %q, which is not a file in this repository", modulePath, goModLabel)
+	}
+	goModPath := filepath.Join(c.RepoRoot, filepath.FromSlash(l.Pkg), l.Name)
+
+	sort.Slice(gen, func(i, j int) bool { return gen[i].Name() < gen[j].Name() })
+	var repoNames []string
+	for _, r := range gen {
+		if r.Kind() != "go_repository" {
+			continue
+		}
+		importPath, version := r.AttrString("importpath"), r.AttrString("version")
+		if version == "" {
+			return fmt.Errorf("go_repository %q: no module version, so %s can't be required in go.mod", r.Name(), importPath)
+		}
+		repoNames = append(repoNames, label.ImportPathToBazelRepoName(importPath))
+	}
+	if len(repoNames) == 0 {
+		return nil
+	}
+
+	if err := goGetModules(goModPath, gen); err != nil {
+		return err
+	}
+
+	if useRepo == nil {
+		useRepo = rule.NewRule("use_repo", "")
+		useRepo.AddArg(&bzl.Ident{Name: "go_deps"})
+		for _, name := range repoNames {
+			useRepo.AddArg(&bzl.StringExpr{Value: name})
+		}
+		return addGoDepsToModule(modulePath, goModLabel, nil, useRepo)
+	}
+	addUseRepoNames(useRepo, repoNames)
+	if newContent := module.Format(); !bytes.Equal(newContent, data) {
+		return module.Save(modulePath)
+	}
+	return nil
+}
+
+// goGetModules runs "go get" in the directory of the go.mod file at
+// goModPath for the modules of the go_repository rules in gen. The go command
+// requires each module at its version, along with any dependencies the
+// module graph needs, and writes their sums to go.sum, including the sums of
+// go.mod files go_deps checks.
+func goGetModules(goModPath string, gen []*rule.Rule) error {
+	args := []string{"get", "--"}
+	for _, r := range gen {
+		if r.Kind() != "go_repository" {
+			continue
+		}
+		args = append(args, r.AttrString("importpath")+"@"+r.AttrString("version"))
+	}
+	cmd := exec.Command(findGoTool(), args...)
+	cmd.Dir = filepath.Dir(goModPath)
+	cmd.Env = append(os.Environ(), "GO111MODULE=on")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running go %s in %s: %v\n%s", strings.Join(args, " "), cmd.Dir, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// addUseRepoNames adds the repository names in names to the use_repo call
+// r, unless they're listed already. Names are kept sorted. Keyword arguments,
+// which alias repositories, aren't changed.
+func addUseRepoNames(r *rule.Rule, names []string) {
+	args := r.Args()
+	listed := make(map[string]bool)
+	var positional []string
+	for _, arg := range args[1:] {
+		if s, ok := arg.(*bzl.StringExpr); ok {
+			listed[s.Value] = true
+			positional = append(positional, s.Value)
+		}
+	}
+	added := false
+	for _, name := range names {
+		if !listed[name] {
+			listed[name] = true
+			positional = append(positional, name)
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+	sort.Strings(positional)
+	i := 0
+	for j, arg := range args[1:] {
+		if _, ok := arg.(*bzl.StringExpr); ok {
+			r.UpdateArg(j+1, &bzl.StringExpr{Value: positional[i]})
+			i++
+		}
+	}
+	for _, name := range positional[i:] {
+		r.AddArg(&bzl.StringExpr{Value: name})
+	}
+}
@@ -0,0 +1,146 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// reposLockVersion is the version of the lockfile format written by
+// update-repos -lockfile. It's incremented when the format or the way hashes
+// are computed changes, so older lockfiles are never considered up to date.
+const reposLockVersion = 1
+
+// reposLock is the content of a lockfile written by update-repos -lockfile.
+// It records the repository rules update-repos generated, so later runs that
+// would generate the same rules can skip rewriting WORKSPACE and macro files,
+// and so changes to dependencies can be reviewed by diffing the lockfile.
+type reposLock struct {
+	Version      int             `json:"version"`
+	Repositories []reposLockRepo `json:"repositories"`
+}
+
+// reposLockRepo records one generated repository rule.
+type reposLockRepo struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+
+	// Hash is the SHA-256 sum of the rule's kind and attributes, formatted
+	// in a canonical way. It doesn't depend on the order of attributes or
+	// on comments.
+	Hash string `json:"hash"`
+}
+
+// newReposLock returns a lock recording the rules in gen.
+func newReposLock(gen []*rule.Rule) *reposLock {
+	lock := &reposLock{Version: reposLockVersion, Repositories: []reposLockRepo{}}
+	for _, r := range gen {
+		lock.Repositories = append(lock.Repositories, reposLockRepo{
+			Name: r.Name(),
+			Kind: r.Kind(),
+			Hash: repoRuleHash(r),
+		})
+	}
+	sort.Slice(lock.Repositories, func(i, j int) bool {
+		return lock.Repositories[i].Name < lock.Repositories[j].Name
+	})
+	return lock
+}
+
+// repoRuleHash returns a hash of the kind and attributes of r.
+func repoRuleHash(r *rule.Rule) string {
+	keys := r.AttrKeys()
+	sort.Strings(keys)
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", r.Kind())
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s = %s\n", key, bzl.FormatString(r.Attr(key)))
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil))
+}
+
+// readReposLock reads the lockfile at path. It returns nil without an error
+// if the file doesn't exist.
+func readReposLock(path string) (*reposLock, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	lock := &reposLock{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("reading lockfile %s: %v", path, err)
+	}
+	return lock, nil
+}
+
+// equal returns whether l and other record the same rules in the same
+// format version.
+func (l *reposLock) equal(other *reposLock) bool {
+	if l == nil || other == nil || l.Version != other.Version || len(l.Repositories) != len(other.Repositories) {
+		return false
+	}
+	for i := range l.Repositories {
+		if l.Repositories[i] != other.Repositories[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// declaredIn returns whether each rule in l is declared among repos, the
+// repository rules loaded from WORKSPACE and macro files, with the same kind
+// and attributes. If a rule was deleted, renamed, or edited by hand since the
+// lockfile was written, the files need to be updated even if the generated
+// rules didn't change.
+func (l *reposLock) declaredIn(repos []*rule.Rule) bool {
+	hashes := make(map[string]string, len(repos))
+	for _, r := range repos {
+		hashes[r.Name()] = repoRuleHash(r)
+	}
+	for _, lr := range l.Repositories {
+		if hashes[lr.Name] != lr.Hash {
+			return false
+		}
+	}
+	return true
+}
+
+// write writes l to path, unless the file already has the same content.
+func (l *reposLock) write(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o666)
+}
@@ -20,28 +20,44 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"unicode"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
+	gzflag "github.com/bazelbuild/bazel-gazelle/flag"
 	"github.com/bazelbuild/bazel-gazelle/internal/wspace"
 	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/language"
 	"github.com/bazelbuild/bazel-gazelle/merger"
+	"github.com/bazelbuild/bazel-gazelle/pkg/gazelle"
 	"github.com/bazelbuild/bazel-gazelle/repo"
 	"github.com/bazelbuild/bazel-gazelle/rule"
+	"golang.org/x/mod/semver"
 )
 
 type updateReposConfig struct {
-	repoFilePath  string
+	repoFilePaths []string
 	importPaths   []string
 	macroFileName string
 	macroDefName  string
 	pruneRules    bool
+	caseCollision string
+	lockfilePath  string
+	toBzlmod      bool
 	workspace     *rule.File
-	repoFileMap   map[string]*rule.File
+
+	repoRootOverrides     []string
+	repoRootOverridesFile string
+	rootOverrides         []repo.RootOverride
+
+	repoFileMap map[string]*rule.File
+
+	// macroFile is the file named by -to_macro, if it already exists.
+	macroFile *rule.File
 }
 
 const updateReposName = "_update-repos"
@@ -79,20 +95,49 @@ func (f macroFlag) String() string {
 func (*updateReposConfigurer) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config) {
 	uc := &updateReposConfig{}
 	c.Exts[updateReposName] = uc
-	fs.StringVar(&uc.repoFilePath, "from_file", "", "Gazelle will translate repositories listed in this file into repository rules in WORKSPACE or a .bzl macro function. Gopkg.lock and go.mod files are supported")
+	fs.Var(&gzflag.MultiFlag{Values: &uc.repoFilePaths}, "from_file", "Gazelle will translate repositories listed in this file into repository rules in WORKSPACE or a .bzl macro function. go.mod, go.work, vendor/modules.txt, and SPDX or CycloneDX SBOM files are supported. May be repeated or a glob pattern; repositories imported from several files are merged, choosing the highest version")
 	fs.Var(macroFlag{macroFileName: &uc.macroFileName, macroDefName: &uc.macroDefName}, "to_macro", "Tells Gazelle to write repository rules into a .bzl macro function rather than the WORKSPACE file. . The expected format is: macroFile%defName")
 	fs.BoolVar(&uc.pruneRules, "prune", false, "When enabled, Gazelle will remove rules that no longer have equivalent repos in the go.mod file. Can only used with -from_file.")
+	fs.StringVar(&uc.caseCollision, "case_collision", caseCollisionError, "How to handle import paths that differ only in case and resolve to the same repository rule name: error, suffix, or lowercase_wins")
+	fs.Var(&gzflag.MultiFlag{Values: &uc.repoRootOverrides}, "repo_root_override", "repository root for import paths with a prefix, written as prefix=vcs remote, for example, example.corp=git https://git.example.corp/... (can specify multiple times)")
+	fs.StringVar(&uc.repoRootOverridesFile, "repo_root_overrides_file", "", "file with one -repo_root_override value per line")
+	fs.BoolVar(&uc.toBzlmod, "to_bzlmod", false, "Tells Gazelle to run go get for the named modules, updating go.mod and go.sum, and to list their repositories in use_repo for go_deps in MODULE.bazel, rather than writing repository rules. Can't be used with -from_file or -to_macro.")
+	fs.StringVar(&uc.lockfilePath, "lockfile", "", "JSON file recording the repository rules generated by update-repos and their content hashes. If the generated rules match the file, WORKSPACE and macro files are not rewritten. The file is updated otherwise.")
 }
 
 func (*updateReposConfigurer) CheckFlags(fs *flag.FlagSet, c *config.Config) error {
 	uc := getUpdateReposConfig(c)
+	switch uc.caseCollision {
+	case caseCollisionError, caseCollisionSuffix, caseCollisionLowercaseWins:
+	default:
+		return fmt.Errorf("invalid value for -case_collision: %q; want error, suffix, or lowercase_wins", uc.caseCollision)
+	}
+	if uc.lockfilePath != "" && !filepath.IsAbs(uc.lockfilePath) {
+		uc.lockfilePath = filepath.Join(c.WorkDir, uc.lockfilePath)
+	}
+	if uc.repoRootOverridesFile != "" && !filepath.IsAbs(uc.repoRootOverridesFile) {
+		uc.repoRootOverridesFile = filepath.Join(c.WorkDir, uc.repoRootOverridesFile)
+	}
+	var err error
+	uc.rootOverrides, err = repo.LoadRootOverrides(uc.repoRootOverridesFile, uc.repoRootOverrides)
+	if err != nil {
+		return err
+	}
+	if uc.toBzlmod {
+		if len(uc.repoFilePaths) > 0 {
+			return fmt.Errorf("the -to_bzlmod option can't be used with -from_file; go_deps reads go.mod directly")
+		}
+		if uc.macroFileName != "" {
+			return fmt.Errorf("the -to_bzlmod option can't be used with -to_macro")
+		}
+	}
 	switch {
-	case uc.repoFilePath != "":
+	case len(uc.repoFilePaths) > 0:
 		if len(fs.Args()) != 0 {
 			return fmt.Errorf("got %d positional arguments with -from_file; wanted 0.\nTry -help for more information.", len(fs.Args()))
 		}
-		if !filepath.IsAbs(uc.repoFilePath) {
-			uc.repoFilePath = filepath.Join(c.WorkDir, uc.repoFilePath)
+		if uc.repoFilePaths, err = expandRepoFilePaths(c.WorkDir, uc.repoFilePaths); err != nil {
+			return err
 		}
 
 	default:
@@ -105,11 +150,10 @@ func (*updateReposConfigurer) CheckFlags(fs *flag.FlagSet, c *config.Config) err
 		uc.importPaths = fs.Args()
 	}
 
-	var err error
 	workspacePath := wspace.FindWORKSPACEFile(c.RepoRoot)
 	uc.workspace, err = rule.LoadWorkspaceFile(workspacePath, "")
 	if err != nil {
-		if c.Bzlmod {
+		if c.Bzlmod || uc.toBzlmod {
 			return nil
 		} else {
 			return fmt.Errorf("loading WORKSPACE file: %v", err)
@@ -119,7 +163,40 @@ func (*updateReposConfigurer) CheckFlags(fs *flag.FlagSet, c *config.Config) err
 	if err != nil {
 		return fmt.Errorf("loading WORKSPACE file: %v", err)
 	}
+	if uc.macroFileName != "" {
+		if err := loadMacroRepos(c, uc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
+// loadMacroRepos loads the file named by -to_macro, if it exists, and adds
+// the repository rules it declares to c.Repos. This lets those rules be
+// updated and pruned even when WORKSPACE doesn't declare the macro with a
+// repository_macro directive, for example, in bzlmod mode.
+func loadMacroRepos(c *config.Config, uc *updateReposConfig) error {
+	macroPath := filepath.Join(c.RepoRoot, filepath.Clean(uc.macroFileName))
+	for _, f := range uc.repoFileMap {
+		if f.Path == macroPath && f.DefName == uc.macroDefName {
+			uc.macroFile = f
+			return nil
+		}
+	}
+	f, err := rule.LoadMacroFile(macroPath, "", uc.macroDefName)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error loading %q: %v", macroPath, err)
+	}
+	uc.macroFile = f
+	for _, r := range f.Rules {
+		if name := r.Name(); name != "" && uc.repoFileMap[name] == nil {
+			c.Repos = append(c.Repos, r)
+			uc.repoFileMap[name] = f
+		}
+	}
 	return nil
 }
 
@@ -174,6 +251,7 @@ func updateRepos(wd string, args []string) (err error) {
 		}
 	}
 	rc, cleanup := repo.NewRemoteCache(knownRepos)
+	rc.RootOverrides = uc.rootOverrides
 	defer func() {
 		if cerr := cleanup(); err == nil && cerr != nil {
 			err = cerr
@@ -181,13 +259,17 @@ func updateRepos(wd string, args []string) (err error) {
 	}()
 
 	// Fix the workspace file with each language.
-	for _, lang := range filterLanguages(c, languages) {
-		lang.Fix(c, uc.workspace)
+	if uc.workspace != nil {
+		fixLangs := gazelle.FilterLanguages(c, languages)
+		for _, lang := range fixLangs {
+			lang.Fix(c, uc.workspace)
+		}
+		language.ApplyFileFixes(c, uc.workspace, fixLangs)
 	}
 
 	// Generate rules from command language arguments or by importing a file.
 	var gen, empty []*rule.Rule
-	if uc.repoFilePath == "" {
+	if len(uc.repoFilePaths) == 0 {
 		gen, err = updateRepoImports(c, rc)
 	} else {
 		gen, empty, err = importRepos(c, rc)
@@ -195,11 +277,15 @@ func updateRepos(wd string, args []string) (err error) {
 	if err != nil {
 		return err
 	}
+	gen, empty = resolveCaseCollisions(gen, empty, uc.caseCollision)
+	if uc.toBzlmod {
+		return updateBzlmod(c, gen)
+	}
 
 	// Organize generated and empty rules by file. A rule should go into the file
 	// it came from (by name). New rules should go into WORKSPACE or the file
 	// specified with -to_macro.
-	var newGen []*rule.Rule
+	var newGen, lockedGen []*rule.Rule
 	genForFiles := make(map[*rule.File][]*rule.Rule)
 	emptyForFiles := make(map[*rule.File][]*rule.Rule)
 	genNames := make(map[string]*rule.Rule)
@@ -218,6 +304,7 @@ func updateRepos(wd string, args []string) (err error) {
 		} else {
 			genNames[r.Name()] = r
 		}
+		lockedGen = append(lockedGen, r)
 		f := uc.repoFileMap[r.Name()]
 		if f != nil {
 			genForFiles[f] = append(genForFiles[f], r)
@@ -233,6 +320,20 @@ func updateRepos(wd string, args []string) (err error) {
 		emptyForFiles[f] = append(emptyForFiles[f], r)
 	}
 
+	// If the rules are the same as when the lockfile was written, and
+	// they're all still declared unchanged, there's nothing to update.
+	var lock *reposLock
+	if uc.lockfilePath != "" {
+		lock = newReposLock(lockedGen)
+		oldLock, err := readReposLock(uc.lockfilePath)
+		if err != nil {
+			return err
+		}
+		if len(empty) == 0 && lock.equal(oldLock) && oldLock.declaredIn(c.Repos) {
+			return nil
+		}
+	}
+
 	var macroPath string
 	if uc.macroFileName != "" {
 		macroPath = filepath.Join(c.RepoRoot, filepath.Clean(uc.macroFileName))
@@ -252,6 +353,8 @@ func updateRepos(wd string, args []string) (err error) {
 		if newGenFile == nil {
 			if uc.macroFileName == "" {
 				newGenFile = uc.workspace
+			} else if uc.macroFile != nil {
+				newGenFile = uc.macroFile
 			} else {
 				var err error
 				newGenFile, err = rule.LoadMacroFile(macroPath, "", uc.macroDefName)
@@ -335,6 +438,12 @@ func updateRepos(wd string, args []string) (err error) {
 		}
 	}
 
+	if lock != nil {
+		if err := lock.write(uc.lockfilePath); err != nil {
+			return fmt.Errorf("writing lockfile: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -373,6 +482,15 @@ gazelle update-repos example.com/repo1 example.com/repo2
 # Import repositories from lock file
 gazelle update-repos -from_file=file
 
+# Import repositories from several go.mod files, choosing the highest versions
+gazelle update-repos -from_file=go.mod -from_file='*/go.mod'
+
+# Record generated repositories, and skip rewriting files when they're unchanged
+gazelle update-repos -from_file=go.mod -lockfile=gazelle_repos.lock.json
+
+# Add a module to go.mod, and its repository to use_repo in MODULE.bazel
+gazelle update-repos -to_bzlmod example.com/repo1@v1.2.3
+
 The update-repos command updates repository rules in the WORKSPACE file.
 update-repos can add or update repositories explicitly by import path.
 update-repos can also import repository rules from a vendoring tool's lock
@@ -389,7 +507,7 @@ func updateRepoImports(c *config.Config, rc *repo.RemoteCache) (gen []*rule.Rule
 	// For now, only use the first language that implements the interface.
 	uc := getUpdateReposConfig(c)
 	var updater language.RepoUpdater
-	for _, lang := range filterLanguages(c, languages) {
+	for _, lang := range gazelle.FilterLanguages(c, languages) {
 		if u, ok := lang.(language.RepoUpdater); ok {
 			updater = u
 			break
@@ -406,14 +524,43 @@ func updateRepoImports(c *config.Config, rc *repo.RemoteCache) (gen []*rule.Rule
 	return res.Gen, res.Error
 }
 
+// importRepos imports repository rules from the files named with -from_file.
+// Rules imported from several files are merged with mergeImportedRepos, and
+// version conflicts between the files are logged.
 func importRepos(c *config.Config, rc *repo.RemoteCache) (gen, empty []*rule.Rule, err error) {
+	uc := getUpdateReposConfig(c)
+	var imports []importedRepos
+	for _, path := range uc.repoFilePaths {
+		res, err := importReposFromFile(c, rc, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		rel, err := filepath.Rel(c.RepoRoot, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = path
+		}
+		imports = append(imports, importedRepos{path: filepath.ToSlash(rel), gen: res.Gen, empty: res.Empty})
+	}
+	if len(imports) == 1 {
+		return imports[0].gen, imports[0].empty, nil
+	}
+	gen, empty, conflicts := mergeImportedRepos(imports)
+	for _, conflict := range conflicts {
+		log.Print(conflict)
+	}
+	return gen, empty, nil
+}
+
+// importReposFromFile imports repository rules from the file at path with
+// the first language that can import it.
+func importReposFromFile(c *config.Config, rc *repo.RemoteCache, path string) (language.ImportReposResult, error) {
 	uc := getUpdateReposConfig(c)
 	importSupported := false
 	var importer language.RepoImporter
-	for _, lang := range filterLanguages(c, languages) {
+	for _, lang := range gazelle.FilterLanguages(c, languages) {
 		if i, ok := lang.(language.RepoImporter); ok {
 			importSupported = true
-			if i.CanImport(uc.repoFilePath) {
+			if i.CanImport(path) {
 				importer = i
 				break
 			}
@@ -421,18 +568,119 @@ func importRepos(c *config.Config, rc *repo.RemoteCache) (gen, empty []*rule.Rul
 	}
 	if importer == nil {
 		if importSupported {
-			return nil, nil, fmt.Errorf("unknown file format: %s", uc.repoFilePath)
+			return language.ImportReposResult{}, fmt.Errorf("unknown file format: %s", path)
 		} else {
-			return nil, nil, fmt.Errorf("no supported languages can import configuration files")
+			return language.ImportReposResult{}, fmt.Errorf("no supported languages can import configuration files")
 		}
 	}
 	res := importer.ImportRepos(language.ImportReposArgs{
 		Config: c,
-		Path:   uc.repoFilePath,
+		Path:   path,
 		Prune:  uc.pruneRules,
 		Cache:  rc,
 	})
-	return res.Gen, res.Empty, res.Error
+	return res, res.Error
+}
+
+// expandRepoFilePaths makes the -from_file paths absolute and expands glob
+// patterns, for example, "*/go.mod". A pattern that matches no files is an
+// error. Paths named more than once are only imported once.
+func expandRepoFilePaths(workDir string, paths []string) ([]string, error) {
+	var expanded []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workDir, path)
+		}
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("-from_file %s: %v", path, err)
+		}
+		if matches == nil {
+			if strings.ContainsAny(path, "*?[") {
+				return nil, fmt.Errorf("-from_file %s: pattern matches no files", path)
+			}
+			matches = []string{path}
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				expanded = append(expanded, m)
+			}
+		}
+	}
+	return expanded, nil
+}
+
+// importedRepos holds the rules imported from one -from_file file.
+type importedRepos struct {
+	path       string
+	gen, empty []*rule.Rule
+}
+
+// mergeImportedRepos merges rules imported from several files. When more
+// than one file imports a repository, the rule with the highest version is
+// kept, like minimal version selection in the go command. Rules that can't be
+// compared, for example, because a file replaces the module, are taken from
+// the first file that imports them. A rule is only empty if no file imports
+// it. Each repository imported at different versions is described in
+// conflicts.
+func mergeImportedRepos(imports []importedRepos) (gen, empty []*rule.Rule, conflicts []string) {
+	genIndex := make(map[string]int)
+	var requirements [][]string
+	var conflicting []bool
+	for _, imp := range imports {
+		for _, r := range imp.gen {
+			desc := fmt.Sprintf("%s requires %s", imp.path, importedVersion(r))
+			i, ok := genIndex[r.Name()]
+			if !ok {
+				genIndex[r.Name()] = len(gen)
+				gen = append(gen, r)
+				requirements = append(requirements, []string{desc})
+				conflicting = append(conflicting, false)
+				continue
+			}
+			requirements[i] = append(requirements[i], desc)
+			if importedVersion(r) == importedVersion(gen[i]) {
+				continue
+			}
+			conflicting[i] = true
+			v1, v2 := gen[i].AttrString("version"), r.AttrString("version")
+			if gen[i].AttrString("replace") == "" && r.AttrString("replace") == "" &&
+				semver.IsValid(v1) && semver.IsValid(v2) && semver.Compare(v2, v1) > 0 {
+				gen[i] = r
+			}
+		}
+	}
+	for i, r := range gen {
+		if conflicting[i] {
+			conflicts = append(conflicts, fmt.Sprintf("%s: %s; using %s", r.AttrString("importpath"), strings.Join(requirements[i], ", "), importedVersion(r)))
+		}
+	}
+
+	emptyNames := make(map[string]bool)
+	for _, imp := range imports {
+		for _, r := range imp.empty {
+			if _, ok := genIndex[r.Name()]; !ok && !emptyNames[r.Name()] {
+				emptyNames[r.Name()] = true
+				empty = append(empty, r)
+			}
+		}
+	}
+	return gen, empty, conflicts
+}
+
+// importedVersion describes the version of an imported go_repository rule,
+// including its replacement module, if any.
+func importedVersion(r *rule.Rule) string {
+	v := r.AttrString("version")
+	if v == "" {
+		v = r.AttrString("commit")
+	}
+	if replace := r.AttrString("replace"); replace != "" {
+		return replace + " " + v
+	}
+	return v
 }
 
 // findWorkspaceInsertIndex reads a WORKSPACE file and finds an index within
@@ -567,3 +815,99 @@ func ensureMacroInWorkspace(uc *updateReposConfig, insertIndex int) (updated boo
 
 	return true
 }
+
+const (
+	caseCollisionError         = "error"
+	caseCollisionSuffix        = "suffix"
+	caseCollisionLowercaseWins = "lowercase_wins"
+)
+
+// resolveCaseCollisions applies the -case_collision policy to generated
+// repository rules whose import paths differ only in case and therefore have
+// the same name. Within each group, paths are ranked by their number of
+// upper-case letters, then lexically. With "lowercase_wins", only the first
+// rule is kept. With "suffix", the first rule keeps its name, and the others
+// are renamed with "_2", "_3", and so on. With "error", rules are returned
+// unchanged, and the collision is reported later.
+//
+// Empty rules that share a name with a renamed rule are dropped, so a
+// renamed rule is not pruned by -prune.
+func resolveCaseCollisions(gen, empty []*rule.Rule, policy string) ([]*rule.Rule, []*rule.Rule) {
+	if policy == caseCollisionError {
+		return gen, empty
+	}
+
+	byName := make(map[string][]*rule.Rule)
+	var names []string
+	for _, r := range gen {
+		if byName[r.Name()] == nil {
+			names = append(names, r.Name())
+		}
+		byName[r.Name()] = append(byName[r.Name()], r)
+	}
+	sort.Strings(names)
+	dropped := make(map[*rule.Rule]bool)
+	renamed := make(map[string]bool)
+	for _, name := range names {
+		rs := byName[name]
+		if len(rs) < 2 || !sameImportPathIgnoringCase(rs) {
+			continue
+		}
+		sort.SliceStable(rs, func(i, j int) bool {
+			pi, pj := rs[i].AttrString("importpath"), rs[j].AttrString("importpath")
+			if ui, uj := countUpper(pi), countUpper(pj); ui != uj {
+				return ui < uj
+			}
+			return pi < pj
+		})
+		for i, r := range rs[1:] {
+			if policy == caseCollisionLowercaseWins {
+				log.Printf("%s: dropping %s in favor of %s", name, r.AttrString("importpath"), rs[0].AttrString("importpath"))
+				dropped[r] = true
+				continue
+			}
+			n := i + 2
+			newName := fmt.Sprintf("%s_%d", name, n)
+			for byName[newName] != nil || renamed[newName] {
+				n++
+				newName = fmt.Sprintf("%s_%d", name, n)
+			}
+			r.SetName(newName)
+			renamed[newName] = true
+		}
+	}
+
+	keptGen := gen[:0]
+	for _, r := range gen {
+		if !dropped[r] {
+			keptGen = append(keptGen, r)
+		}
+	}
+	var keptEmpty []*rule.Rule
+	for _, r := range empty {
+		if !renamed[r.Name()] {
+			keptEmpty = append(keptEmpty, r)
+		}
+	}
+	return keptGen, keptEmpty
+}
+
+func sameImportPathIgnoringCase(rs []*rule.Rule) bool {
+	first := rs[0].AttrString("importpath")
+	for _, r := range rs[1:] {
+		if !strings.EqualFold(first, r.AttrString("importpath")) {
+			return false
+		}
+	}
+	return true
+}
+
+func countUpper(s string) int {
+	n := 0
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			n++
+		}
+	}
+	return n
+}
@@ -34,6 +34,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	gzflag "github.com/bazelbuild/bazel-gazelle/flag"
 	"github.com/bazelbuild/bazel-gazelle/internal/module"
 	"github.com/bazelbuild/bazel-gazelle/internal/wspace"
 	"github.com/bazelbuild/bazel-gazelle/rule"
@@ -78,19 +79,56 @@ type Config struct {
 	// usage of deprecated rules.
 	ShouldFix bool
 
-	// Strict determines how Gazelle handles build file and directive errors. When
-	// set, Gazelle will exit with non-zero value after logging such errors.
+	// Strict determines how Gazelle handles build file and directive errors,
+	// and # keep comments on files or targets that don't exist. When set,
+	// Gazelle will exit with non-zero value after logging such errors.
 	Strict bool
 
 	// IndexLibraries determines whether Gazelle should build an index of
 	// libraries in the workspace for dependency resolution
 	IndexLibraries bool
 
+	// OmitVisibility determines whether languages should leave the visibility
+	// attribute unset on generated rules. This is useful in repositories that
+	// manage visibility exclusively with package(default_visibility = ...).
+	// Set with -generate_visibility=false or # gazelle:generate_visibility false.
+	OmitVisibility bool
+
+	// AnnotateDeps determines whether languages should attach a comment to
+	// each resolved dependency naming the imports it was resolved from. This
+	// helps review large generated diffs. Set with -annotate_deps.
+	AnnotateDeps bool
+
+	// RecordProvenance determines whether languages should record why values
+	// are in the attributes of generated rules with rule.Rule.AddProvenance.
+	// It's set by the explain command.
+	RecordProvenance bool
+
 	// KindMap maps from a kind name to its replacement. It provides a way for
 	// users to customize the kind of rules created by Gazelle, via
 	// # gazelle:map_kind.
 	KindMap map[string]MappedKind
 
+	// MergeableAttrs maps rule kinds to attributes that should be merged like
+	// those in rule.KindInfo.MergeableAttrs when generated rules that set them
+	// are merged into existing rules. Existing values are preserved when the
+	// attributes aren't generated. It lets users declare attributes of mapped
+	// kinds (for example, macros) without writing an extension, via
+	// # gazelle:mergeable_attr. The inner maps must not be modified; they are
+	// shared with parent configurations.
+	MergeableAttrs map[string]map[string]bool
+
+	// NewRuleTemplates maps rule kinds to paths of template files, relative
+	// to the repository root. Attributes in a template are added to newly
+	// created rules of its kind. Set with # gazelle:new_rule_template.
+	NewRuleTemplates map[string]string
+
+	// RepoDefaults is the repo() call in the REPO.bazel file at the
+	// repository root, or nil if there is no such call. Its attributes, like
+	// default_visibility and default_package_metadata, apply to every package
+	// in the repository that doesn't override them with package().
+	RepoDefaults *rule.Rule
+
 	// Repos is a list of repository rules declared in the main WORKSPACE file
 	// or in macros called by the main WORKSPACE file. This may affect rule
 	// generation and dependency resolution.
@@ -140,6 +178,18 @@ func (c *Config) Clone() *Config {
 	for k, v := range c.KindMap {
 		cc.KindMap[k] = v
 	}
+	if c.MergeableAttrs != nil {
+		cc.MergeableAttrs = make(map[string]map[string]bool, len(c.MergeableAttrs))
+		for k, v := range c.MergeableAttrs {
+			cc.MergeableAttrs[k] = v
+		}
+	}
+	if c.NewRuleTemplates != nil {
+		cc.NewRuleTemplates = make(map[string]string, len(c.NewRuleTemplates))
+		for k, v := range c.NewRuleTemplates {
+			cc.NewRuleTemplates[k] = v
+		}
+	}
 	return &cc
 }
 
@@ -195,26 +245,29 @@ type Configurer interface {
 	Configure(c *Config, rel string, f *rule.File)
 }
 
-var _ Configurer = (*CommonConfigurer)(nil)
+var _ DirectiveDeclarer = (*CommonConfigurer)(nil)
 
 // CommonConfigurer handles language-agnostic command-line flags and directives,
 // i.e., those that apply to Config itself and not to Config.Exts.
 type CommonConfigurer struct {
 	repoRoot, buildFileNames, readBuildFilesDir, writeBuildFilesDir string
-	indexLibraries, strict                                          bool
+	indexLibraries, strict, generateVisibility, annotateDeps        bool
 	langCsv                                                         string
-	bzlmod                                                          bool
+	bzlmod, useConfigFile                                           bool
 }
 
 func (cc *CommonConfigurer) RegisterFlags(fs *flag.FlagSet, cmd string, c *Config) {
 	fs.StringVar(&cc.repoRoot, "repo_root", "", "path to a directory which corresponds to go_prefix, otherwise gazelle searches for it.")
 	fs.StringVar(&cc.buildFileNames, "build_file_name", strings.Join(DefaultValidBuildFileNames, ","), "comma-separated list of valid build file names.\nThe first element of the list is the name of output build files to generate.")
 	fs.BoolVar(&cc.indexLibraries, "index", true, "when true, gazelle will build an index of libraries in the workspace for dependency resolution")
-	fs.BoolVar(&cc.strict, "strict", false, "when true, gazelle will exit with none-zero value for build file syntax errors or unknown directives")
-	fs.StringVar(&cc.readBuildFilesDir, "experimental_read_build_files_dir", "", "path to a directory where build files should be read from (instead of -repo_root)")
-	fs.StringVar(&cc.writeBuildFilesDir, "experimental_write_build_files_dir", "", "path to a directory where build files should be written to (instead of -repo_root)")
+	fs.BoolVar(&cc.generateVisibility, "generate_visibility", true, "when false, gazelle will not set the visibility attribute on generated rules")
+	fs.BoolVar(&cc.annotateDeps, "annotate_deps", false, "when true, gazelle will add a comment to each resolved dependency naming the imports it was resolved from")
+	fs.BoolVar(&cc.strict, "strict", false, "when true, gazelle will exit with none-zero value for build file syntax errors, unknown directives, or # keep comments on files or targets that don't exist")
+	fs.Var(&gzflag.PathFlag{Value: &cc.readBuildFilesDir}, "experimental_read_build_files_dir", "path to a directory where build files should be read from (instead of -repo_root)")
+	fs.Var(&gzflag.PathFlag{Value: &cc.writeBuildFilesDir}, "experimental_write_build_files_dir", "path to a directory where build files should be written to (instead of -repo_root)")
 	fs.StringVar(&cc.langCsv, "lang", "", "if non-empty, process only these languages (e.g. \"go,proto\")")
 	fs.BoolVar(&cc.bzlmod, "bzlmod", false, "for internal usage only")
+	cc.useConfigFile = cmd == "fix" || cmd == "update"
 }
 
 func (cc *CommonConfigurer) CheckFlags(fs *flag.FlagSet, c *Config) error {
@@ -237,6 +290,17 @@ func (cc *CommonConfigurer) CheckFlags(fs *flag.FlagSet, c *Config) error {
 	if err != nil {
 		return fmt.Errorf("%s: failed to resolve symlinks: %v", cc.repoRoot, err)
 	}
+	if cc.useConfigFile {
+		// Flags set in the config file are applied before any flag values
+		// are read, including by other Configurers, which check flags later.
+		if err := applyConfigFile(fs, filepath.Join(c.RepoRoot, ConfigFileName)); err != nil {
+			return err
+		}
+	}
+	c.RepoDefaults, err = loadRepoDefaults(c.RepoRoot)
+	if err != nil {
+		return err
+	}
 	c.ValidBuildFileNames = strings.Split(cc.buildFileNames, ",")
 	if cc.readBuildFilesDir != "" {
 		if filepath.IsAbs(cc.readBuildFilesDir) {
@@ -253,6 +317,8 @@ func (cc *CommonConfigurer) CheckFlags(fs *flag.FlagSet, c *Config) error {
 		}
 	}
 	c.IndexLibraries = cc.indexLibraries
+	c.OmitVisibility = !cc.generateVisibility
+	c.AnnotateDeps = cc.annotateDeps
 	c.Strict = cc.strict
 	if len(cc.langCsv) > 0 {
 		c.Langs = strings.Split(cc.langCsv, ",")
@@ -265,21 +331,62 @@ func (cc *CommonConfigurer) CheckFlags(fs *flag.FlagSet, c *Config) error {
 	return nil
 }
 
+// loadRepoDefaults returns the repo() call in the REPO.bazel file in
+// repoRoot. It returns nil if there is no REPO.bazel file or if the file
+// doesn't call repo().
+func loadRepoDefaults(repoRoot string) (*rule.Rule, error) {
+	path := wspace.FindREPOFile(repoRoot)
+	if path == "" {
+		return nil, nil
+	}
+	f, err := rule.LoadFile(path, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range f.Rules {
+		if r.Kind() == "repo" {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// HasRepoDefaultVisibility returns whether the REPO.bazel file sets
+// default_visibility for all packages in the repository. Like
+// rule.File.HasDefaultVisibility, this means rules generated by Gazelle
+// should not have their own visibility attributes.
+func (c *Config) HasRepoDefaultVisibility() bool {
+	return c.RepoDefaults != nil && c.RepoDefaults.Attr("default_visibility") != nil
+}
+
+var commonDirectives = []DirectiveInfo{
+	{Name: "build_file_name", Type: ListDirective},
+	{Name: "generate_visibility", Type: BoolDirective},
+	{Name: "map_kind", Type: StringDirective},
+	{Name: "mergeable_attr", Type: StringDirective},
+	{Name: "new_rule_template", Type: StringDirective},
+	{Name: "lang", Type: ListDirective, AllowEmpty: true},
+}
+
+func (cc *CommonConfigurer) Directives() []DirectiveInfo {
+	return commonDirectives
+}
+
 func (cc *CommonConfigurer) KnownDirectives() []string {
-	return []string{"build_file_name", "map_kind", "lang"}
+	return DeclaredDirectiveNames(commonDirectives)
 }
 
 func (cc *CommonConfigurer) Configure(c *Config, rel string, f *rule.File) {
-	if f == nil {
-		return
-	}
-	for _, d := range f.Directives {
-		switch d.Key {
+	for _, d := range ParseDirectives(commonDirectives, rel, f) {
+		switch d.Name {
 		case "build_file_name":
-			c.ValidBuildFileNames = strings.Split(d.Value, ",")
+			c.ValidBuildFileNames = d.List
+
+		case "generate_visibility":
+			c.OmitVisibility = !d.Bool
 
 		case "map_kind":
-			vals := strings.Fields(d.Value)
+			vals := strings.Fields(d.Raw)
 			if len(vals) != 3 {
 				log.Printf("expected three arguments (gazelle:map_kind from_kind to_kind load_file), got %v", vals)
 				continue
@@ -293,12 +400,40 @@ func (cc *CommonConfigurer) Configure(c *Config, rel string, f *rule.File) {
 				KindLoad: vals[2],
 			}
 
-		case "lang":
-			if len(d.Value) > 0 {
-				c.Langs = strings.Split(d.Value, ",")
+		case "mergeable_attr":
+			vals := strings.Fields(d.Raw)
+			if len(vals) != 2 {
+				log.Printf("expected two arguments (gazelle:mergeable_attr kind attr), got %v", vals)
+				continue
+			}
+			kind, attr := vals[0], vals[1]
+			attrs := make(map[string]bool, len(c.MergeableAttrs[kind])+1)
+			for a := range c.MergeableAttrs[kind] {
+				attrs[a] = true
+			}
+			attrs[attr] = true
+			if c.MergeableAttrs == nil {
+				c.MergeableAttrs = make(map[string]map[string]bool)
+			}
+			c.MergeableAttrs[kind] = attrs
+
+		case "new_rule_template":
+			vals := strings.Fields(d.Raw)
+			if len(vals) < 1 || len(vals) > 2 {
+				log.Printf("expected one or two arguments (gazelle:new_rule_template kind [template_file]), got %v", vals)
+				continue
+			}
+			if c.NewRuleTemplates == nil {
+				c.NewRuleTemplates = make(map[string]string)
+			}
+			if len(vals) == 1 {
+				delete(c.NewRuleTemplates, vals[0])
 			} else {
-				c.Langs = nil
+				c.NewRuleTemplates[vals[0]] = vals[1]
 			}
+
+		case "lang":
+			c.Langs = d.List
 		}
 	}
 }
@@ -0,0 +1,170 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gzflag "github.com/bazelbuild/bazel-gazelle/flag"
+	"github.com/bazelbuild/bazel-gazelle/internal/yamlscalar"
+)
+
+// ConfigFileName is the name of the file in the repository root that sets
+// default values for command line flags of the fix and update commands.
+const ConfigFileName = ".gazelle.yaml"
+
+// configFileEntry is a flag value set in a config file.
+type configFileEntry struct {
+	name   string
+	values []string
+	isList bool
+	line   int
+}
+
+// applyConfigFile sets flags in fs to values from the config file at path,
+// if it exists. Flags set on the command line aren't changed. Keys that
+// don't name flags in fs are ignored, since a file may set flags for
+// languages that aren't compiled into every Gazelle binary.
+//
+// A list value sets a repeatable flag once for each element. For other
+// flags, the elements are joined with commas. Relative paths set for flags
+// defined with gzflag.PathFlag are resolved against the directory containing
+// the config file, so they don't depend on where Gazelle is run.
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	entries, err := parseConfigFile(path, data)
+	if err != nil {
+		return err
+	}
+
+	setOnCommandLine := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+	for _, e := range entries {
+		f := fs.Lookup(e.name)
+		if f == nil || setOnCommandLine[e.name] {
+			continue
+		}
+		var values []string
+		if _, ok := f.Value.(*gzflag.MultiFlag); ok && e.isList {
+			values = e.values
+		} else {
+			values = []string{strings.Join(e.values, ",")}
+		}
+		if _, ok := f.Value.(*gzflag.PathFlag); ok && values[0] != "" && !filepath.IsAbs(values[0]) {
+			values[0] = filepath.Join(filepath.Dir(path), filepath.FromSlash(values[0]))
+		}
+		for _, v := range values {
+			if err := fs.Set(e.name, v); err != nil {
+				return fmt.Errorf("%s:%d: invalid value %q for %s: %v", path, e.line, v, e.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseConfigFile parses a config file. Config files are written in a small
+// subset of YAML: a mapping from flag names to scalars or lists of scalars.
+// Lists may be written in flow style ("[a, b]") or block style (one "- a"
+// item per indented line). Scalars may be quoted.
+func parseConfigFile(path string, data []byte) ([]configFileEntry, error) {
+	var entries []configFileEntry
+	seen := make(map[string]bool)
+	var blockList *configFileEntry
+	for i, line := range strings.Split(string(data), "\n") {
+		lineNum := i + 1
+		line = strings.TrimRight(yamlscalar.StripComment(line), " \t\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", path, lineNum, fmt.Sprintf(format, args...))
+		}
+
+		if line[0] == ' ' || line[0] == '\t' || (line[0] == '-' && blockList != nil) {
+			item := strings.TrimSpace(line)
+			if blockList == nil || !strings.HasPrefix(item, "-") {
+				return nil, errorf("unexpected indented line; only lists may be nested")
+			}
+			v, err := yamlscalar.Unquote(strings.TrimSpace(item[1:]))
+			if err != nil {
+				return nil, errorf("%v", err)
+			}
+			blockList.values = append(blockList.values, v)
+			continue
+		}
+		if blockList != nil {
+			entries = append(entries, *blockList)
+			blockList = nil
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, errorf("expected \"name: value\"")
+		}
+		if seen[key] {
+			return nil, errorf("%s is set more than once", key)
+		}
+		seen[key] = true
+		e := configFileEntry{name: key, line: lineNum}
+		switch {
+		case value == "":
+			e.isList = true
+			blockList = &e
+			continue
+		case strings.HasPrefix(value, "["):
+			if !strings.HasSuffix(value, "]") {
+				return nil, errorf("unterminated list")
+			}
+			e.isList = true
+			e.values = []string{}
+			for _, elem := range strings.Split(value[1:len(value)-1], ",") {
+				if elem = strings.TrimSpace(elem); elem == "" {
+					continue
+				}
+				v, err := yamlscalar.Unquote(elem)
+				if err != nil {
+					return nil, errorf("%v", err)
+				}
+				e.values = append(e.values, v)
+			}
+		default:
+			v, err := yamlscalar.Unquote(value)
+			if err != nil {
+				return nil, errorf("%v", err)
+			}
+			e.values = []string{v}
+		}
+		entries = append(entries, e)
+	}
+	if blockList != nil {
+		entries = append(entries, *blockList)
+	}
+	return entries, nil
+}
@@ -0,0 +1,98 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	for _, tc := range []struct {
+		desc, data string
+		want       []configFileEntry
+		wantErr    string
+	}{
+		{
+			desc: "scalars",
+			data: `a: x
+b: "quoted # not a comment"  # comment
+c: 'it''s'
+d: x#y
+`,
+			want: []configFileEntry{
+				{name: "a", values: []string{"x"}, line: 1},
+				{name: "b", values: []string{"quoted # not a comment"}, line: 2},
+				{name: "c", values: []string{"it's"}, line: 3},
+				{name: "d", values: []string{"x#y"}, line: 4},
+			},
+		}, {
+			desc: "lists",
+			data: `flow: [x, "y", ]
+empty: []
+block:
+  - x
+  # comment
+  - 'y'
+unindented:
+- z
+`,
+			want: []configFileEntry{
+				{name: "flow", values: []string{"x", "y"}, isList: true, line: 1},
+				{name: "empty", values: []string{}, isList: true, line: 2},
+				{name: "block", values: []string{"x", "y"}, isList: true, line: 3},
+				{name: "unindented", values: []string{"z"}, isList: true, line: 7},
+			},
+		}, {
+			desc:    "nested_mapping",
+			data:    "a:\n  b: c\n",
+			wantErr: ":2: unexpected indented line",
+		}, {
+			desc:    "duplicate",
+			data:    "a: x\na: y\n",
+			wantErr: ":2: a is set more than once",
+		}, {
+			desc:    "no_colon",
+			data:    "a\n",
+			wantErr: ":1: expected",
+		}, {
+			desc:    "unterminated_list",
+			data:    "a: [x, y\n",
+			wantErr: ":1: unterminated list",
+		}, {
+			desc:    "unterminated_quote",
+			data:    "a: \"x\n",
+			wantErr: ":1: unterminated quoted value",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := parseConfigFile(ConfigFileName, []byte(tc.data))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v; want error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %#v; want %#v", got, tc.want)
+			}
+		})
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"reflect"
 	"testing"
 
+	gzflag "github.com/bazelbuild/bazel-gazelle/flag"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 )
 
@@ -43,7 +44,7 @@ func TestCommonConfigurerFlags(t *testing.T) {
 	cc := &CommonConfigurer{}
 	fs := flag.NewFlagSet("test", flag.ContinueOnError)
 	cc.RegisterFlags(fs, "test", c)
-	args := []string{"-repo_root", dir, "-build_file_name", "x,y", "-lang", "go"}
+	args := []string{"-repo_root", dir, "-build_file_name", "x,y", "-generate_visibility=false", "-lang", "go"}
 	if err := fs.Parse(args); err != nil {
 		t.Fatal(err)
 	}
@@ -64,12 +65,121 @@ func TestCommonConfigurerFlags(t *testing.T) {
 	if !reflect.DeepEqual(c.Langs, wantLangs) {
 		t.Errorf("for Langs, got %#v, want %#v", c.Langs, wantLangs)
 	}
+
+	if !c.OmitVisibility {
+		t.Errorf("for OmitVisibility, got false, want true")
+	}
+}
+
+func TestCommonConfigurerRepoFile(t *testing.T) {
+	dir, err := os.MkdirTemp(os.Getenv("TEST_TEMPDIR"), "config_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoData := []byte(`repo(
+    default_package_metadata = ["//:license"],
+    default_visibility = ["//visibility:public"],
+)
+`)
+	if err := os.WriteFile(filepath.Join(dir, "REPO.bazel"), repoData, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	subdir := filepath.Join(dir, "sub")
+	if err := os.Mkdir(subdir, 0o777); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New()
+	c.WorkDir = subdir
+	cc := &CommonConfigurer{}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cc.RegisterFlags(fs, "test", c)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BUILD_WORKSPACE_DIRECTORY", "")
+	if err := cc.CheckFlags(fs, c); err != nil {
+		t.Fatalf("CheckFlags: %v", err)
+	}
+
+	if c.RepoRoot != dir {
+		t.Errorf("for RepoRoot, got %#v, want %#v", c.RepoRoot, dir)
+	}
+	if c.RepoDefaults == nil {
+		t.Fatal("for RepoDefaults, got nil, want repo() call")
+	}
+	wantMetadata := []string{"//:license"}
+	if got := c.RepoDefaults.AttrStrings("default_package_metadata"); !reflect.DeepEqual(got, wantMetadata) {
+		t.Errorf("for default_package_metadata, got %#v, want %#v", got, wantMetadata)
+	}
+	if !c.HasRepoDefaultVisibility() {
+		t.Errorf("for HasRepoDefaultVisibility, got false, want true")
+	}
+}
+
+func TestCommonConfigurerConfigFile(t *testing.T) {
+	dir, err := os.MkdirTemp(os.Getenv("TEST_TEMPDIR"), "config_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configData := []byte(`# Defaults for all Gazelle invocations.
+build_file_name: [x, y]
+lang: go  # overridden on the command line
+generate_visibility: false
+exclude:
+  - third_party
+  - "gen/**"
+unknown_flag: ignored
+`)
+	if err := os.WriteFile(filepath.Join(dir, ConfigFileName), configData, 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New()
+	cc := &CommonConfigurer{}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cc.RegisterFlags(fs, "update", c)
+	var excludes []string
+	fs.Var(&gzflag.MultiFlag{Values: &excludes}, "exclude", "")
+	if err := fs.Parse([]string{"-repo_root", dir, "-lang", "proto"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cc.CheckFlags(fs, c); err != nil {
+		t.Fatalf("CheckFlags: %v", err)
+	}
+
+	wantBuildFileNames := []string{"x", "y"}
+	if !reflect.DeepEqual(c.ValidBuildFileNames, wantBuildFileNames) {
+		t.Errorf("for ValidBuildFileNames, got %#v, want %#v", c.ValidBuildFileNames, wantBuildFileNames)
+	}
+	wantLangs := []string{"proto"}
+	if !reflect.DeepEqual(c.Langs, wantLangs) {
+		t.Errorf("for Langs, got %#v, want %#v", c.Langs, wantLangs)
+	}
+	if !c.OmitVisibility {
+		t.Errorf("for OmitVisibility, got false, want true")
+	}
+	wantExcludes := []string{"third_party", "gen/**"}
+	if !reflect.DeepEqual(excludes, wantExcludes) {
+		t.Errorf("for exclude, got %#v, want %#v", excludes, wantExcludes)
+	}
 }
 
 func TestCommonConfigurerDirectives(t *testing.T) {
 	c := New()
 	cc := &CommonConfigurer{}
 	buildData := []byte(`# gazelle:build_file_name x,y
+# gazelle:generate_visibility false
 # gazelle:lang go`)
 	f, err := rule.LoadData(filepath.Join("test", "BUILD.bazel"), "", buildData)
 	if err != nil {
@@ -85,4 +195,35 @@ func TestCommonConfigurerDirectives(t *testing.T) {
 	if !reflect.DeepEqual(c.Langs, wantLangs) {
 		t.Errorf("for Langs, got %#v, want %#v", c.Langs, wantLangs)
 	}
+
+	if !c.OmitVisibility {
+		t.Errorf("for OmitVisibility, got false, want true")
+	}
+}
+
+func TestMergeableAttrDirective(t *testing.T) {
+	cc := &CommonConfigurer{}
+	parent := New()
+	f, err := rule.LoadData(filepath.Join("test", "BUILD.bazel"), "", []byte(`# gazelle:mergeable_attr my_library lint_config`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc.Configure(parent, "", f)
+
+	child := parent.Clone()
+	f, err = rule.LoadData(filepath.Join("test", "sub", "BUILD.bazel"), "sub", []byte(`# gazelle:mergeable_attr my_library extra_srcs
+# gazelle:mergeable_attr my_library`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc.Configure(child, "sub", f)
+
+	wantParent := map[string]map[string]bool{"my_library": {"lint_config": true}}
+	if !reflect.DeepEqual(parent.MergeableAttrs, wantParent) {
+		t.Errorf("for parent MergeableAttrs, got %#v, want %#v", parent.MergeableAttrs, wantParent)
+	}
+	wantChild := map[string]map[string]bool{"my_library": {"lint_config": true, "extra_srcs": true}}
+	if !reflect.DeepEqual(child.MergeableAttrs, wantChild) {
+		t.Errorf("for child MergeableAttrs, got %#v, want %#v", child.MergeableAttrs, wantChild)
+	}
 }
@@ -0,0 +1,205 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// DirectiveType determines how the value of a directive is parsed.
+type DirectiveType int
+
+const (
+	// StringDirective values are used as written.
+	StringDirective DirectiveType = iota
+
+	// BoolDirective values are parsed with strconv.ParseBool.
+	BoolDirective
+
+	// ListDirective values are comma-separated lists. Whitespace around
+	// elements and empty elements are dropped.
+	ListDirective
+
+	// LabelDirective values are Bazel labels, parsed with label.Parse.
+	LabelDirective
+)
+
+func (t DirectiveType) String() string {
+	switch t {
+	case StringDirective:
+		return "string"
+	case BoolDirective:
+		return "bool"
+	case ListDirective:
+		return "list"
+	case LabelDirective:
+		return "label"
+	default:
+		return "unknown"
+	}
+}
+
+// DirectiveScope determines which build files a directive may appear in.
+type DirectiveScope int
+
+const (
+	// AnyDirectory directives may appear in any build file. They apply to
+	// the directory and its subdirectories.
+	AnyDirectory DirectiveScope = iota
+
+	// RootOnly directives may only appear in the build file in the
+	// repository root directory.
+	RootOnly
+)
+
+// DirectiveInfo declares a directive that a Configurer interprets.
+type DirectiveInfo struct {
+	// Name is the directive key, for example, "build_file_name" for
+	// # gazelle:build_file_name.
+	Name string
+
+	// Type determines how the directive's value is parsed.
+	Type DirectiveType
+
+	// Scope determines which build files the directive may appear in.
+	Scope DirectiveScope
+
+	// AllowEmpty indicates the directive may have an empty value, which
+	// usually resets it to its default. Empty values of BoolDirective
+	// directives are always invalid.
+	AllowEmpty bool
+}
+
+// DirectiveDeclarer may be implemented by a Configurer to declare the types
+// and scopes of the directives it interprets, instead of listing their names
+// in KnownDirectives. Gazelle reports directives whose values can't be
+// parsed or that appear outside their scope, the same way it reports unknown
+// directives, so Configure doesn't need to. Configure can get parsed values
+// with ParseDirectives.
+//
+// KnownDirectives should still return the declared names, for callers that
+// don't know about this interface. DeclaredDirectiveNames may be used to
+// implement it.
+//
+// Implementing DirectiveDeclarer is optional, and Configurers that do and
+// don't may be mixed freely. A Configurer may also declare only some of its
+// directives: those it doesn't declare are listed in KnownDirectives and
+// validated in Configure. Within Gazelle, the common and walk Configurers
+// declare all their directives, and the Go and proto extensions declare
+// their bool and list directives. Directives with their own syntax, like
+// "resolve" or "go_proto_compilers", aren't declared, since DirectiveType
+// can't describe them.
+type DirectiveDeclarer interface {
+	Configurer
+
+	// Directives returns the directives this Configurer interprets.
+	Directives() []DirectiveInfo
+}
+
+// DirectiveValue is a parsed directive value.
+type DirectiveValue struct {
+	DirectiveInfo
+
+	// Raw is the value as written in the build file.
+	Raw string
+
+	// Bool is the value of a BoolDirective.
+	Bool bool
+
+	// List is the value of a ListDirective. It's nil if the value is empty.
+	List []string
+
+	// Label is the value of a LabelDirective. It's label.NoLabel if the
+	// value is empty.
+	Label label.Label
+}
+
+// ParseDirective parses the value of the directive d, which appears in the
+// build file in the directory rel, according to info. An error is returned if
+// the value is invalid or the directive is outside its scope.
+func ParseDirective(info DirectiveInfo, rel string, d rule.Directive) (DirectiveValue, error) {
+	v := DirectiveValue{DirectiveInfo: info, Raw: d.Value}
+	if info.Scope == RootOnly && rel != "" {
+		return v, fmt.Errorf("directive gazelle:%s may only be used in the repository root build file", info.Name)
+	}
+	if d.Value == "" && (!info.AllowEmpty || info.Type == BoolDirective) {
+		return v, fmt.Errorf("directive gazelle:%s requires a %s value", info.Name, info.Type)
+	}
+	if d.Value == "" {
+		return v, nil
+	}
+	switch info.Type {
+	case BoolDirective:
+		b, err := strconv.ParseBool(d.Value)
+		if err != nil {
+			return v, fmt.Errorf("directive gazelle:%s: invalid bool value %q", info.Name, d.Value)
+		}
+		v.Bool = b
+	case ListDirective:
+		for _, elem := range strings.Split(d.Value, ",") {
+			if elem = strings.TrimSpace(elem); elem != "" {
+				v.List = append(v.List, elem)
+			}
+		}
+	case LabelDirective:
+		l, err := label.Parse(d.Value)
+		if err != nil {
+			return v, fmt.Errorf("directive gazelle:%s: %v", info.Name, err)
+		}
+		v.Label = l
+	}
+	return v, nil
+}
+
+// ParseDirectives parses the directives in f that are declared in infos, in
+// the order they appear. Directives that aren't declared or can't be parsed
+// are skipped; Gazelle reports the latter while walking the repository.
+// f may be nil.
+func ParseDirectives(infos []DirectiveInfo, rel string, f *rule.File) []DirectiveValue {
+	if f == nil {
+		return nil
+	}
+	byName := make(map[string]DirectiveInfo, len(infos))
+	for _, info := range infos {
+		byName[info.Name] = info
+	}
+	var values []DirectiveValue
+	for _, d := range f.Directives {
+		info, ok := byName[d.Key]
+		if !ok {
+			continue
+		}
+		if v, err := ParseDirective(info, rel, d); err == nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// DeclaredDirectiveNames returns the names of infos, for implementing
+// KnownDirectives in a DirectiveDeclarer.
+func DeclaredDirectiveNames(infos []DirectiveInfo) []string {
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name
+	}
+	return names
+}
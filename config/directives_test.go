@@ -0,0 +1,127 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestParseDirective(t *testing.T) {
+	for _, tc := range []struct {
+		desc, rel, value string
+		info             DirectiveInfo
+		want             DirectiveValue
+		wantErr          bool
+	}{
+		{
+			desc:  "string",
+			info:  DirectiveInfo{Name: "d", Type: StringDirective},
+			value: "a b",
+			want:  DirectiveValue{Raw: "a b"},
+		}, {
+			desc:  "bool",
+			info:  DirectiveInfo{Name: "d", Type: BoolDirective},
+			value: "true",
+			want:  DirectiveValue{Raw: "true", Bool: true},
+		}, {
+			desc:    "bool_invalid",
+			info:    DirectiveInfo{Name: "d", Type: BoolDirective},
+			value:   "yes please",
+			wantErr: true,
+		}, {
+			desc:    "bool_empty",
+			info:    DirectiveInfo{Name: "d", Type: BoolDirective, AllowEmpty: true},
+			wantErr: true,
+		}, {
+			desc:  "list",
+			info:  DirectiveInfo{Name: "d", Type: ListDirective},
+			value: "a, b,,c",
+			want:  DirectiveValue{Raw: "a, b,,c", List: []string{"a", "b", "c"}},
+		}, {
+			desc:  "label",
+			info:  DirectiveInfo{Name: "d", Type: LabelDirective},
+			value: "@r//p:n",
+			want:  DirectiveValue{Raw: "@r//p:n", Label: label.New("r", "p", "n")},
+		}, {
+			desc:    "label_invalid",
+			info:    DirectiveInfo{Name: "d", Type: LabelDirective},
+			value:   "//p:",
+			wantErr: true,
+		}, {
+			desc:    "empty",
+			info:    DirectiveInfo{Name: "d", Type: ListDirective},
+			wantErr: true,
+		}, {
+			desc: "empty_allowed",
+			info: DirectiveInfo{Name: "d", Type: ListDirective, AllowEmpty: true},
+		}, {
+			desc:  "root_only_in_root",
+			info:  DirectiveInfo{Name: "d", Scope: RootOnly},
+			value: "x",
+			want:  DirectiveValue{Raw: "x"},
+		}, {
+			desc:    "root_only_in_subdir",
+			info:    DirectiveInfo{Name: "d", Scope: RootOnly},
+			rel:     "sub",
+			value:   "x",
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := ParseDirective(tc.info, tc.rel, rule.Directive{Key: tc.info.Name, Value: tc.value})
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("got %#v; want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.want.DirectiveInfo = tc.info
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %#v; want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseDirectives(t *testing.T) {
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`# gazelle:a x
+# gazelle:b not_a_bool
+# gazelle:c y
+# gazelle:b true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos := []DirectiveInfo{
+		{Name: "a", Type: StringDirective},
+		{Name: "b", Type: BoolDirective},
+	}
+	var got []string
+	for _, d := range ParseDirectives(infos, "", f) {
+		got = append(got, d.Name+"="+d.Raw)
+	}
+	// Undeclared and invalid directives are skipped.
+	if want := []string{"a=x", "b=true"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
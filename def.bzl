@@ -47,6 +47,7 @@ gazelle_generation_test = _gazelle_generation_test
 DEFAULT_LANGUAGES = [
     Label("//language/proto:go_default_library"),
     Label("//language/go:go_default_library"),
+    Label("//language/plugin:go_default_library"),
 ]
 
 def _valid_env_variable_name(name):
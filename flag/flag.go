@@ -67,6 +67,28 @@ func (f *ExplicitFlag) String() string {
 	return *f.Value
 }
 
+// PathFlag is a string flag whose value is a file or directory path.
+// Commands resolve relative paths set on the command line against the
+// working directory, but relative paths set in a config file are resolved
+// against the directory containing the file when the file is applied.
+type PathFlag struct {
+	Value *string
+}
+
+var _ stdflag.Value = (*PathFlag)(nil)
+
+func (f *PathFlag) Set(value string) error {
+	*f.Value = value
+	return nil
+}
+
+func (f *PathFlag) String() string {
+	if f == nil || f.Value == nil {
+		return ""
+	}
+	return *f.Value
+}
+
 var _ stdflag.Value = (*AllowedStringFlag)(nil)
 
 type AllowedStringFlag struct {
@@ -24,9 +24,13 @@ load(":semver.bzl", "COMPARES_HIGHEST_SENTINEL", "semver")
 load(
     ":utils.bzl",
     "drop_nones",
+    "expects_use_repo",
     "extension_metadata",
     "format_rule_call",
     "get_directive_value",
+    "remove_excluded_modules",
+    "resolve_case_collisions",
+    "use_repo_deps",
     "with_replaced_or_new_fields",
 )
 
@@ -222,6 +226,9 @@ def _process_overrides(module_ctx, module, override_type, overrides, process_ove
 
         overrides[override_tag.path] = process_override_func(override_tag)
 
+def _process_exclude(exclude_tag):
+    return exclude_tag
+
 def _process_gazelle_override(gazelle_override_tag):
     for directive in gazelle_override_tag.directives:
         _check_directive(directive)
@@ -343,11 +350,15 @@ def _go_deps_impl(module_ctx):
     archive_overrides = {}
     gazelle_overrides = {}
     module_overrides = {}
+    excludes = {}
 
     root_versions = {}
     root_module_direct_deps = {}
     root_module_direct_dev_deps = {}
 
+    # Paths of the Go modules whose repos the root module is expected to import with use_repo.
+    root_module_paths = {}
+
     first_module = module_ctx.modules[0]
     if first_module.is_root and first_module.name in ["gazelle", "rules_go"]:
         root_module_direct_deps["bazel_gazelle_go_repository_config"] = None
@@ -356,6 +367,8 @@ def _go_deps_impl(module_ctx):
     go_env = {}
     dep_files = []
     debug_mode = False
+    case_collision = "error"
+    use_repo_check = "direct"
     for module in module_ctx.modules:
         if len(module.tags.config) > 1:
             fail(
@@ -376,10 +389,13 @@ def _go_deps_impl(module_ctx):
                 outdated_direct_dep_printer = fail
             go_env = mod_config.go_env
             debug_mode = mod_config.debug_mode
+            case_collision = mod_config.case_collision
+            use_repo_check = mod_config.use_repo_check
 
         _process_overrides(module_ctx, module, "gazelle_override", gazelle_overrides, _process_gazelle_override)
         _process_overrides(module_ctx, module, "module_override", module_overrides, _process_module_override, archive_overrides)
         _process_overrides(module_ctx, module, "archive_override", archive_overrides, _process_archive_override, module_overrides)
+        _process_overrides(module_ctx, module, "exclude", excludes, _process_exclude)
 
         if len(module.tags.from_file) > 1:
             fail(
@@ -498,6 +514,9 @@ def _go_deps_impl(module_ctx):
             # the "indirect" attribute.
             if module.is_root and not module_tag.indirect:
                 root_versions[module_tag.path] = raw_version
+
+            if module.is_root and expects_use_repo(module_tag, use_repo_check):
+                root_module_paths[module_tag.path] = None
                 if _is_dev_dependency(module_ctx, module_tag):
                     root_module_direct_dev_deps[_repo_name(module_tag.path)] = None
                 else:
@@ -578,6 +597,41 @@ def _go_deps_impl(module_ctx):
         #   module. However, we currently don't have a way to determine that.
         module_resolutions[path] = bazel_dep
 
+    # Excluded modules are provided by the root module in some other way, for
+    # example with http_archive, so they must not be created or indexed here.
+    _fail_on_unmatched_overrides(excludes.keys(), module_resolutions, "excludes")
+    remove_excluded_modules(
+        excludes.keys(),
+        module_resolutions,
+        root_versions,
+        root_module_direct_deps,
+        root_module_direct_dev_deps,
+        _repo_name,
+    )
+
+    repo_names = resolve_case_collisions(
+        {
+            path: module.repo_name
+            for path, module in module_resolutions.items()
+            if not hasattr(module, "module_name")
+        },
+        case_collision,
+    )
+    for path, module in module_resolutions.items():
+        if hasattr(module, "module_name"):
+            continue
+        if path not in repo_names:
+            print("Go module {} is not used because its path differs only in case from another module that resolves to the repo name {}.".format(path, module.repo_name))
+            module_resolutions.pop(path)
+            root_versions.pop(path, None)
+        elif repo_names[path] != module.repo_name:
+            module_resolutions[path] = with_replaced_or_new_fields(module, repo_name = repo_names[path])
+            if path in root_module_paths:
+                if module.repo_name in root_module_direct_deps:
+                    root_module_direct_deps[repo_names[path]] = None
+                if module.repo_name in root_module_direct_dev_deps:
+                    root_module_direct_dev_deps[repo_names[path]] = None
+
     for path, root_version in root_versions.items():
         if semver.to_comparable(root_version) < module_resolutions[path].version:
             outdated_direct_dep_printer(
@@ -600,7 +654,7 @@ def _go_deps_impl(module_ctx):
             # go_deps.
             continue
         if module.repo_name in repos_processed:
-            fail("Go module {prev_path} and {path} will resolve to the same Bazel repo name: {name}. While Go allows modules to only differ in case, this isn't supported in Gazelle (yet). Please ensure you only use one of these modules in your go.mod(s)".format(
+            fail("Go module {prev_path} and {path} will resolve to the same Bazel repo name: {name}. If their paths only differ in case, set case_collision in go_deps.config to choose how to handle them. Otherwise, please ensure you only use one of these modules in your go.mod(s)".format(
                 prev_path = repos_processed[module.repo_name],
                 path = path,
                 name = module.repo_name,
@@ -676,16 +730,11 @@ def _go_deps_impl(module_ctx):
         dep_files = dep_files,
     )
 
+    direct_deps, direct_dev_deps = use_repo_deps(use_repo_check, root_module_direct_deps, root_module_direct_dev_deps)
     return extension_metadata(
         module_ctx,
-        root_module_direct_deps = root_module_direct_deps.keys(),
-        # If a Go module appears as both a dev and a non-dev dependency, it has to be imported as a
-        # non-dev dependency.
-        root_module_direct_dev_deps = {
-            repo_name: None
-            for repo_name in root_module_direct_dev_deps.keys()
-            if repo_name not in root_module_direct_deps
-        }.keys(),
+        root_module_direct_deps = direct_deps,
+        root_module_direct_dev_deps = direct_dev_deps,
         reproducible = True,
     )
 
@@ -725,6 +774,20 @@ _config_tag = tag_class(
             doc = "The environment variables to use when fetching Go dependencies or running the `@rules_go//go` tool.",
         ),
         "debug_mode": attr.bool(doc = "Whether or not to print stdout and stderr messages from gazelle", default = False),
+        "case_collision": attr.string(
+            doc = """How to handle Go modules whose paths differ only in case and thus resolve to the same repo name.
+
+"error" fails the build. "suffix" keeps the name for the path with the fewest upper-case letters and appends "_2", "_3", and so on to the names of the others. "lowercase_wins" only creates a repo for the path with the fewest upper-case letters.""",
+            values = ["error", "suffix", "lowercase_wins"],
+            default = "error",
+        ),
+        "use_repo_check": attr.string(
+            doc = """Which repos Bazel expects the root module to import with use_repo for go_deps.
+
+Bazel warns about missing and unused use_repo entries and prints a buildozer command to fix them, which "bazel mod tidy" applies. "direct" expects the repos of modules the root module requires directly. "all" also expects the repos of modules marked "// indirect" in go.mod, which BUILD files may still reference, for example in tests. "off" disables the check.""",
+            values = ["direct", "all", "off"],
+            default = "direct",
+        ),
     },
 )
 
@@ -791,6 +854,23 @@ _archive_override_tag = tag_class(
     doc = "Override the default source location on a given Go module in this extension.",
 )
 
+_exclude_tag = tag_class(
+    attrs = {
+        "path": attr.string(
+            doc = """The Go module path to exclude.
+
+            This module path must be defined by other tags in this
+            extension or required by a go.mod file.""",
+            mandatory = True,
+        ),
+    },
+    doc = """Do not create a repository for a given Go module in this extension.
+
+    The module is also removed from the index Gazelle uses to resolve imports
+    to repositories. This is useful if the module is defined manually, for
+    example with `http_archive`.""",
+)
+
 _gazelle_override_tag = tag_class(
     attrs = {
         "path": attr.string(
@@ -834,6 +914,7 @@ go_deps = module_extension(
     tag_classes = {
         "archive_override": _archive_override_tag,
         "config": _config_tag,
+        "exclude": _exclude_tag,
         "from_file": _from_file_tag,
         "gazelle_override": _gazelle_override_tag,
         "gazelle_default_attributes": _gazelle_default_attributes_tag,
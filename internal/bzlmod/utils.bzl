@@ -96,6 +96,138 @@ def get_directive_value(directives, key):
 
     return value
 
+def resolve_case_collisions(repo_names, policy):
+    """Assigns repository names to Go modules whose paths differ only in case.
+
+    Such paths map to the same repository name. Within each group of colliding
+    paths, paths are ranked by their number of upper-case letters, then
+    lexically. The first path keeps the name. This matches the -case_collision
+    flag of update-repos.
+
+    Args:
+        repo_names: A dict mapping module paths to default repository names.
+        policy: One of "error", "suffix", or "lowercase_wins". With "error",
+            names are not changed and the caller reports the collision. With
+            "suffix", the other paths get names ending in "_2", "_3", and so
+            on. With "lowercase_wins", the other paths are omitted.
+
+    Returns:
+        A dict mapping module paths to repository names.
+    """
+    if policy == "error":
+        return dict(repo_names)
+
+    paths_by_name = {}
+    for path, name in repo_names.items():
+        paths_by_name.setdefault(name, []).append(path)
+
+    taken = {name: None for name in paths_by_name}
+    result = {}
+    for name in sorted(paths_by_name):
+        paths = paths_by_name[name]
+        if len(paths) < 2 or len({path.lower(): None for path in paths}) > 1:
+            for path in paths:
+                result[path] = name
+            continue
+
+        paths = sorted(paths, key = _case_collision_rank)
+        result[paths[0]] = name
+        if policy == "lowercase_wins":
+            continue
+        for i, path in enumerate(paths[1:]):
+            # Starlark has no while loops, but at most len(taken) candidates
+            # can be taken.
+            for n in range(i + 2, i + 3 + len(taken)):
+                new_name = "{}_{}".format(name, n)
+                if new_name not in taken:
+                    break
+            taken[new_name] = None
+            result[path] = new_name
+
+    return result
+
+def remove_excluded_modules(excluded_paths, module_resolutions, root_versions, root_module_direct_deps, root_module_direct_dev_deps, default_repo_name):
+    """Removes excluded Go modules and the repositories they would provide.
+
+    Direct dependencies of the root module are keyed by the default repository
+    name of the module path, which may differ from the repository name of the
+    resolved module, for example when the module is provided by a bazel_dep.
+    Both names are removed, unless another module that isn't excluded still
+    provides the name, for example because its path differs only in case.
+
+    Args:
+        excluded_paths: The module paths to remove.
+        module_resolutions: A dict mapping module paths to resolved modules
+            with a repo_name field. Modified in place.
+        root_versions: A dict mapping module paths to versions required by the
+            root module. Modified in place.
+        root_module_direct_deps: A dict whose keys are repository names of
+            direct dependencies of the root module. Modified in place.
+        root_module_direct_dev_deps: Like root_module_direct_deps, for dev
+            dependencies. Modified in place.
+        default_repo_name: A function returning the default repository name of
+            a module path.
+    """
+    removed = {}
+    for path in excluded_paths:
+        module = module_resolutions.pop(path)
+        root_versions.pop(path, None)
+        removed[default_repo_name(path)] = None
+        removed[module.repo_name] = None
+
+    for path, module in module_resolutions.items():
+        removed.pop(default_repo_name(path), None)
+        removed.pop(module.repo_name, None)
+
+    for name in removed:
+        root_module_direct_deps.pop(name, None)
+        root_module_direct_dev_deps.pop(name, None)
+
+def expects_use_repo(module_tag, use_repo_check):
+    """Returns whether the root module is expected to import the repository of a Go module with use_repo.
+
+    Args:
+        module_tag: A go_deps.module tag of the root module, or a struct with
+            an indirect field for a module read from go.mod.
+        use_repo_check: The use_repo_check attribute of go_deps.config.
+
+    Returns:
+        True for direct dependencies, and for indirect dependencies with
+        use_repo_check = "all", since BUILD files may still reference them,
+        for example in tests. False with use_repo_check = "off".
+    """
+    if use_repo_check == "off":
+        return False
+    return not module_tag.indirect or use_repo_check == "all"
+
+def use_repo_deps(use_repo_check, root_module_direct_deps, root_module_direct_dev_deps):
+    """Returns the repositories Bazel checks the use_repo call for go_deps against.
+
+    Args:
+        use_repo_check: The use_repo_check attribute of go_deps.config.
+        root_module_direct_deps: A dict whose keys are repository names of
+            direct dependencies of the root module.
+        root_module_direct_dev_deps: Like root_module_direct_deps, for dev
+            dependencies.
+
+    Returns:
+        A tuple of the direct and direct dev dependencies to pass to
+        extension_metadata, or (None, None) with use_repo_check = "off", so
+        Bazel doesn't check use_repo. A repository that is both a dev and a
+        non-dev dependency has to be imported as a non-dev dependency.
+    """
+    if use_repo_check == "off":
+        return None, None
+    dev_deps = [
+        repo_name
+        for repo_name in root_module_direct_dev_deps.keys()
+        if repo_name not in root_module_direct_deps
+    ]
+    return root_module_direct_deps.keys(), dev_deps
+
+def _case_collision_rank(path):
+    return (len([c for c in path.elems() if c.isupper()]), path)
+
 def with_replaced_or_new_fields(_struct, **replacements):
     """Provides a shallow copy of a structure with replacements and/or new fields
 
@@ -20,6 +20,15 @@ To extend Gazelle, you must do three things:
   `bazel run //:gazelle`, your binary will be built and executed instead of
   the default binary.
 
+Emit modes
+----------
+
+A language may also implement [EmitModeProvider] to add values for the
+`-mode` flag of the `fix` and `update` commands, in addition to `fix`,
+`print`, and `diff`. The emit function is called for each visited build file
+instead of writing it to disk, so a custom `gazelle_binary` can, for example,
+send changes to a code review service.
+
 Tests
 -----
 
@@ -77,6 +86,23 @@ gazelle(
 
 You can run this with `bazel run //:gazelle`.
 
+Subprocess plugins
+------------------
+
+A language extension may also be built as a standalone executable and passed
+to the stock Gazelle binary with `-plugin`. This lets you add a language
+without building a custom `gazelle_binary`.
+
+```
+gazelle -plugin=path/to/my_plugin
+```
+
+Gazelle starts each plugin once and exchanges JSON messages with it, one per
+line, over stdin and stdout. The plugin describes its kinds, loads, and
+directives, then generates rules for each directory Gazelle updates. Gazelle
+resolves the imports returned by the plugin into `deps` using `# gazelle:resolve`
+directives and its rule index. See the [plugin godoc] for the protocol.
+
 Interacting with protos
 -----------------------
 
@@ -97,6 +123,7 @@ rules in each directory, if there were any. For each of these rules, you can
 call `r.PrivateAttr(proto.PackageKey)` to get a [proto.Package] record. This
 includes the proto package name, as well as source names, imports, and options.
 
+[EmitModeProvider]: https://godoc.org/github.com/bazelbuild/bazel-gazelle/language#EmitModeProvider
 [Language]: https://godoc.org/github.com/bazelbuild/bazel-gazelle/language#Language
 [//internal/gazellebinarytest:go_default_library]: https://github.com/bazelbuild/bazel-gazelle/tree/master/internal/gazellebinarytest
 [//language/go:go_default_library]: https://github.com/bazelbuild/bazel-gazelle/tree/master/language/go
@@ -105,6 +132,7 @@ includes the proto package name, as well as source names, imports, and options.
 [go_binary]: https://github.com/bazelbuild/rules_go/blob/master/go/core.rst#go-binary
 [go_library]: https://github.com/bazelbuild/rules_go/blob/master/go/core.rst#go-library
 [proto godoc]: https://godoc.org/github.com/bazelbuild/bazel-gazelle/language/proto
+[plugin godoc]: https://godoc.org/github.com/bazelbuild/bazel-gazelle/language/plugin
 [proto.GetProtoConfig]: https://godoc.org/github.com/bazelbuild/bazel-gazelle/language/proto#GetProtoConfig
 [proto.Package]: https://godoc.org/github.com/bazelbuild/bazel-gazelle/language/proto#Package
 """
@@ -12,7 +12,7 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
-load("@bazel_tools//tools/build_defs/repo:utils.bzl", "patch", "read_user_netrc", "use_netrc")
+load("@bazel_tools//tools/build_defs/repo:utils.bzl", "patch", "read_netrc", "read_user_netrc", "use_netrc")
 load("//internal:common.bzl", "env_execute", "executable_extension")
 load("//internal:go_repository_cache.bzl", "read_cache_env")
 
@@ -29,6 +29,16 @@ returned by `go env GOPATH`. Alternatively, by setting the environment variable
 `GO_REPOSITORY_USE_HOST_MODCACHE=1`, you can force `go_repository` to use only
 the module cache on the host system in the location returned by `go env GOMODCACHE`.
 
+To diagnose flaky fetches or to make fetches deterministic in CI, set the
+environment variable `GAZELLE_REPO_RECORD` to an absolute path. Modules and
+repositories fetched by `go_repository` in module mode (`version`) or with a
+version control tool (`commit` or `tag`) are copied into that directory after
+they're fetched. Later, set `GAZELLE_REPO_REPLAY` to the same directory instead:
+recorded contents are copied without going to the network, and fetches that
+weren't recorded fail. Recorded modules are verified against `sum`. Archives
+downloaded with `urls` aren't recorded; use Bazel's `--repository_cache` or
+`--distdir` for those. Pass these variables to Bazel with `--repo_env`.
+
 **Example**
 
 ```starlark
@@ -112,8 +122,17 @@ The final HTTP request would have the following header:
 <pre>
 Authorization: Bearer RANDOM-TOKEN
 </pre>
+
+In module mode (`version` is set), the patterns apply to requests to private
+module proxies listed in `GOPROXY`, such as Artifactory or GitLab. This requires
+Go 1.24 or later, which supports `GOAUTH`.
 """
 
+def _read_netrc(ctx):
+    if ctx.attr.netrc:
+        return read_netrc(ctx, ctx.attr.netrc)
+    return read_user_netrc(ctx)
+
 # We can't disable timeouts on Bazel, but we can set them to large values.
 _GO_REPOSITORY_TIMEOUT = 86400
 
@@ -155,7 +174,7 @@ def _go_repository_impl(ctx):
             canonical_id = ctx.attr.canonical_id,
             stripPrefix = ctx.attr.strip_prefix,
             type = ctx.attr.type,
-            auth = use_netrc(read_user_netrc(ctx), ctx.attr.urls, ctx.attr.auth_patterns),
+            auth = use_netrc(_read_netrc(ctx), ctx.attr.urls, ctx.attr.auth_patterns),
         )
         if not ctx.attr.sha256:
             print("For Go module \"{path}\", integrity not specified, calculated sha256 = \"{sha256}\"".format(
@@ -203,9 +222,24 @@ def _go_repository_impl(ctx):
             "-version=" + ctx.attr.version,
             "-sum=" + ctx.attr.sum,
         ]
+        if ctx.attr.netrc:
+            fetch_repo_args.append("-netrc=" + str(ctx.path(ctx.attr.netrc)))
+        for host, pattern in sorted(ctx.attr.auth_patterns.items()):
+            fetch_repo_args.append("-auth_pattern=%s=%s" % (host, pattern))
     else:
         fail("one of urls, commit, tag, or version must be specified")
 
+    # Record or replay fetches of modules and repositories if requested.
+    record_dir = ctx.os.environ.get("GAZELLE_REPO_RECORD", "")
+    replay_dir = ctx.os.environ.get("GAZELLE_REPO_REPLAY", "")
+    if record_dir and replay_dir:
+        fail("GAZELLE_REPO_RECORD and GAZELLE_REPO_REPLAY can't both be set")
+    if ctx.attr.version or ctx.attr.commit or ctx.attr.tag:
+        if record_dir:
+            fetch_repo_args.append("-record_dir=" + record_dir)
+        if replay_dir:
+            fetch_repo_args.append("-replay_dir=" + replay_dir)
+
     env = read_cache_env(ctx, go_env_cache)
     env_keys = [
         # keep sorted
@@ -215,6 +249,7 @@ def _go_repository_impl(ctx):
         # not go out to the network at all. This means *the build*
         # goes out to the network. We tolerate this for downloading
         # archives, but finding module roots is a bit much.
+        "GOAUTH",
         "GONOPROXY",
         "GONOSUMDB",
         "GOPRIVATE",
@@ -238,6 +273,7 @@ def _go_repository_impl(ctx):
         "GIT_SSL_CAINFO",
         "HTTPS_PROXY",
         "HTTP_PROXY",
+        "NETRC",
         "NO_PROXY",
         "SSH_AUTH_SOCK",
         "SSL_CERT_DIR",
@@ -498,6 +534,13 @@ go_repository = repository_rule(
         "auth_patterns": attr.string_dict(
             doc = _AUTH_PATTERN_DOC,
         ),
+        "netrc": attr.string(
+            doc = """Location of the .netrc file with credentials for downloading the
+            repository. If unset, `$NETRC` or `~/.netrc` is used.
+
+            In module mode (`version` is set), the Go command reads credentials for
+            private module proxies (`GOPROXY`) from this file.""",
+        ),
 
         # Attributes for a module that should be loaded from the local file system.
         "local_path": attr.string(
@@ -652,5 +695,9 @@ go_repository = repository_rule(
         ),
         "internal_only_do_not_use_apparent_name": attr.string(doc = "Internal usage only"),
     },
+    environ = [
+        "GAZELLE_REPO_RECORD",
+        "GAZELLE_REPO_REPLAY",
+    ],
 )
 """See repository.md#go-repository for full documentation."""
@@ -8,6 +8,7 @@ GO_REPOSITORY_TOOLS_SRCS = [
     Label("//cmd/autogazelle:main.go"),
     Label("//cmd/autogazelle:server_unix.go"),
     Label("//cmd/fetch_repo:BUILD.bazel"),
+    Label("//cmd/fetch_repo:auth.go"),
     Label("//cmd/fetch_repo:clean.go"),
     Label("//cmd/fetch_repo:copy_tree.go"),
     Label("//cmd/fetch_repo:errorscompat.go"),
@@ -15,16 +16,16 @@ GO_REPOSITORY_TOOLS_SRCS = [
     Label("//cmd/fetch_repo:main.go"),
     Label("//cmd/fetch_repo:module.go"),
     Label("//cmd/fetch_repo:path.go"),
+    Label("//cmd/fetch_repo:record.go"),
     Label("//cmd/fetch_repo:vcs.go"),
     Label("//cmd/gazelle:BUILD.bazel"),
-    Label("//cmd/gazelle:diff.go"),
-    Label("//cmd/gazelle:fix-update.go"),
-    Label("//cmd/gazelle:fix.go"),
+    Label("//cmd/gazelle:doctor.go"),
+    Label("//cmd/gazelle:kinds.go"),
     Label("//cmd/gazelle:langs.go"),
     Label("//cmd/gazelle:main.go"),
-    Label("//cmd/gazelle:metaresolver.go"),
-    Label("//cmd/gazelle:print.go"),
-    Label("//cmd/gazelle:profiler.go"),
+    Label("//cmd/gazelle:migrate-workspace.go"),
+    Label("//cmd/gazelle:repos_bzlmod.go"),
+    Label("//cmd/gazelle:repos_lock.go"),
     Label("//cmd/gazelle:update-repos.go"),
     Label("//cmd/generate_repo_config:BUILD.bazel"),
     Label("//cmd/generate_repo_config:main.go"),
@@ -32,7 +33,9 @@ GO_REPOSITORY_TOOLS_SRCS = [
     Label("//cmd/move_labels:main.go"),
     Label("//config:BUILD.bazel"),
     Label("//config:config.go"),
+    Label("//config:config_file.go"),
     Label("//config:constants.go"),
+    Label("//config:directives.go"),
     Label("//flag:BUILD.bazel"),
     Label("//flag:flag.go"),
     Label("//internal:BUILD.bazel"),
@@ -50,10 +53,14 @@ GO_REPOSITORY_TOOLS_SRCS = [
     Label("//internal:list_repository_tools_srcs.go"),
     Label("//internal/module:BUILD.bazel"),
     Label("//internal/module:module.go"),
+    Label("//internal/overrides:BUILD.bazel"),
+    Label("//internal/overrides:overrides.go"),
     Label("//internal/version:BUILD.bazel"),
     Label("//internal/version:version.go"),
     Label("//internal/wspace:BUILD.bazel"),
     Label("//internal/wspace:finder.go"),
+    Label("//internal/yamlscalar:BUILD.bazel"),
+    Label("//internal/yamlscalar:yamlscalar.go"),
     Label("//label:BUILD.bazel"),
     Label("//label:label.go"),
     Label("//language:BUILD.bazel"),
@@ -63,29 +70,50 @@ GO_REPOSITORY_TOOLS_SRCS = [
     Label("//language/bazel/visibility:config.go"),
     Label("//language/bazel/visibility:lang.go"),
     Label("//language/bazel/visibility:resolve.go"),
+    Label("//language/bzl:BUILD.bazel"),
+    Label("//language/bzl:generate.go"),
+    Label("//language/bzl:kinds.go"),
+    Label("//language/bzl:lang.go"),
+    Label("//language/bzl:resolve.go"),
+    Label("//language:fix.go"),
     Label("//language/go:BUILD.bazel"),
     Label("//language/go:build_constraints.go"),
+    Label("//language/go:compat.go"),
     Label("//language/go:config.go"),
     Label("//language/go:constants.go"),
     Label("//language/go:embed.go"),
+    Label("//language/go:external_repos.go"),
+    Label("//language/go:features.go"),
+    Label("//language/go:file_metadata.go"),
     Label("//language/go:fileinfo.go"),
     Label("//language/go:fix.go"),
     Label("//language/go/gen_std_package_list:BUILD.bazel"),
     Label("//language/go/gen_std_package_list:gen_std_package_list.go"),
     Label("//language/go:generate.go"),
+    Label("//language/go:generated_srcs.go"),
     Label("//language/go:kinds.go"),
     Label("//language/go:lang.go"),
     Label("//language/go:modules.go"),
     Label("//language/go:package.go"),
+    Label("//language/go:proto_compilers.go"),
     Label("//language/go:resolve.go"),
+    Label("//language/go:sbom.go"),
     Label("//language/go:std_package_list.go"),
     Label("//language/go:stdlib_links.go"),
     Label("//language/go:update.go"),
     Label("//language/go:utils.go"),
+    Label("//language/go:vendor.go"),
     Label("//language/go:work.go"),
     Label("//language:lang.go"),
     Label("//language:lifecycle.go"),
+    Label("//language/plugin:BUILD.bazel"),
+    Label("//language/plugin:generate.go"),
+    Label("//language/plugin:lang.go"),
+    Label("//language/plugin:process.go"),
+    Label("//language/plugin:protocol.go"),
+    Label("//language/plugin:resolve.go"),
     Label("//language/proto:BUILD.bazel"),
+    Label("//language/proto:buf.go"),
     Label("//language/proto:config.go"),
     Label("//language/proto:constants.go"),
     Label("//language/proto:fileinfo.go"),
@@ -106,15 +134,40 @@ GO_REPOSITORY_TOOLS_SRCS = [
     Label("//merger:merger.go"),
     Label("//pathtools:BUILD.bazel"),
     Label("//pathtools:path.go"),
+    Label("//pkg/gazelle:BUILD.bazel"),
+    Label("//pkg/gazelle:buildozer.go"),
+    Label("//pkg/gazelle:changed_files.go"),
+    Label("//pkg/gazelle:diff.go"),
+    Label("//pkg/gazelle:explain.go"),
+    Label("//pkg/gazelle:fix-update.go"),
+    Label("//pkg/gazelle:fix.go"),
+    Label("//pkg/gazelle:gazelle.go"),
+    Label("//pkg/gazelle:gitcommit.go"),
+    Label("//pkg/gazelle:interactive.go"),
+    Label("//pkg/gazelle:list_deps.go"),
+    Label("//pkg/gazelle:managed_files.go"),
+    Label("//pkg/gazelle:metaresolver.go"),
+    Label("//pkg/gazelle:print.go"),
+    Label("//pkg/gazelle:profiler.go"),
+    Label("//pkg/gazelle:references.go"),
+    Label("//pkg/gazelle:report.go"),
+    Label("//pkg/gazelle:sandbox.go"),
+    Label("//pkg/gazelle:stale_keep.go"),
+    Label("//pkg/gazelle:stamp.go"),
+    Label("//pkg/gazelle:template.go"),
+    Label("//pkg/gazelle:timings.go"),
     Label("//repo:BUILD.bazel"),
     Label("//repo:remote.go"),
     Label("//repo:repo.go"),
+    Label("//repo:root_override.go"),
     Label("//resolve:BUILD.bazel"),
     Label("//resolve:config.go"),
     Label("//resolve:index.go"),
+    Label("//resolve:index_file.go"),
     Label("//rule:BUILD.bazel"),
     Label("//rule:directives.go"),
     Label("//rule:expr.go"),
+    Label("//rule:format.go"),
     Label("//rule:merge.go"),
     Label("//rule:platform.go"),
     Label("//rule:platform_strings.go"),
@@ -0,0 +1,280 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package overrides converts go_repository rules to go_deps override tags,
+// which configure the same repositories in MODULE.bazel.
+package overrides
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/bazelbuild/buildtools/build"
+)
+
+// Override tag kinds.
+const (
+	GazelleOverride = "go_deps.gazelle_override"
+	ArchiveOverride = "go_deps.archive_override"
+	ModuleOverride  = "go_deps.module_override"
+)
+
+// Defaults applied by go_deps to repositories without overrides.
+const (
+	DefaultBuildFileGeneration = "auto"
+	DefaultBuildFileProtoMode  = "default"
+)
+
+// attribute constants that are used multiple times.
+const (
+	buildFileGenerationAttr = "build_file_generation"
+	buildFileProtoModeAttr  = "build_file_proto_mode"
+	patchArgsAttr           = "patch_args"
+	buildDirectivesAttr     = "build_directives"
+	directivesAttr          = "directives"
+)
+
+var mapAttrToOverride = map[string]string{
+	buildDirectivesAttr:     GazelleOverride,
+	buildFileGenerationAttr: GazelleOverride,
+	patchArgsAttr:           ModuleOverride,
+	"patches":               ModuleOverride,
+	"build_extra_args":      GazelleOverride,
+	"urls":                  ArchiveOverride,
+	"strip_prefix":          ArchiveOverride,
+	"sha256":                ArchiveOverride,
+}
+
+var attrOverrideKeys = map[string]string{
+	buildDirectivesAttr: directivesAttr,
+}
+
+// goModAttrs are go_repository attributes whose information comes from
+// go.mod when go_deps reads it with from_file.
+var goModAttrs = map[string]bool{
+	"name":       true,
+	"importpath": true,
+	"sum":        true,
+	"version":    true,
+}
+
+type overrideSet map[string]*rule.Rule
+
+// FromGoRepository returns the override tags needed to configure the
+// go_repository r the same way with go_deps, sorted by kind. Attributes
+// that match the go_deps defaults given here don't need overrides.
+// Attributes without an override equivalent are ignored; see
+// UntranslatedAttrs.
+func FromGoRepository(r *rule.Rule, defaultBuildFileGeneration, defaultBuildFileProtoMode string) []*rule.Rule {
+	return setToOverridesSlice(goRepositoryToOverrideSet(r, defaultBuildFileGeneration, defaultBuildFileProtoMode))
+}
+
+// UntranslatedAttrs returns the sorted names of attributes set on the
+// go_repository r that are neither read from go.mod by go_deps nor
+// translated to override tags by FromGoRepository.
+func UntranslatedAttrs(r *rule.Rule) []string {
+	var attrs []string
+	for _, attr := range r.AttrKeys() {
+		if _, ok := mapAttrToOverride[attr]; ok || goModAttrs[attr] || attr == buildFileProtoModeAttr {
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+	return attrs
+}
+
+func goRepositoryToOverrideSet(r *rule.Rule, defaultBuildFileGeneration, defaultBuildFileProtoMode string) overrideSet {
+	// each repo has its own override set, and can't have multiple
+	// duplicate overrides. This set is created to be populated and read
+	set := make(overrideSet)
+	importPath := r.AttrString("importpath")
+
+	// Load the attribute keys from the rule.
+	attrs := r.AttrKeys()
+	for _, attr := range attrs {
+		if _, ok := mapAttrToOverride[attr]; !ok {
+			continue
+		}
+
+		attrValue := r.Attr(attr)
+
+		// proto mode and build file generation require special handling.
+		if attrValue == nil || attr == buildFileProtoModeAttr || attr == buildFileGenerationAttr {
+			continue
+		}
+
+		kind := mapAttrToOverride[attr]
+		override := rule.NewRule(kind, "")
+		if o, ok := set[kind]; ok {
+			override = o
+		}
+		override.SetAttr("path", importPath)
+		val := r.Attr(attr)
+
+		// Special case for certain renamed attributes like "build_directives"
+		// attribute to convert to "directives" attribute.
+		if k, ok := attrOverrideKeys[attr]; ok {
+			attr = k
+		}
+
+		if val != nil {
+			switch v := val.(type) {
+			case *build.StringExpr:
+				override.SetAttr(attr, v)
+			case *build.ListExpr:
+				// Special case for "patch_args" attribute to convert to
+				// "patch_strip" attribute.
+				if attr == patchArgsAttr {
+					setPatchArgs(r.AttrStrings(patchArgsAttr), override)
+				} else {
+					override.SetAttr(attr, v)
+				}
+			}
+		}
+
+		set[kind] = override
+	}
+
+	// If the user default doesn't match the global default, but there's a gazelle override, we need to still apply
+	// it to the individual overrides.
+	// Also, since "build_file_proto_mode" is added to the "directives", we need
+	// to apply it last to make sure "directives" is set.
+	applyBuildFileGeneration(r, set, defaultBuildFileGeneration)
+	applyBuildFileProtoMode(r, set, defaultBuildFileProtoMode, defaultBuildFileGeneration)
+	return set
+}
+
+func applyBuildFileGeneration(r *rule.Rule, set overrideSet, userDefaultGeneration string) {
+	ruleGeneration := r.AttrString(buildFileGenerationAttr)
+	o, ok := set[GazelleOverride]
+	if !ok {
+		if ruleGeneration == "" || ruleGeneration == userDefaultGeneration {
+			return
+		}
+		set[GazelleOverride] = newGenerationOverride(r.AttrString("importpath"), ruleGeneration)
+		return
+	}
+
+	if ruleGeneration == "" {
+		ruleGeneration = userDefaultGeneration
+	}
+
+	o.SetAttr(buildFileGenerationAttr, ruleGeneration)
+	set[GazelleOverride] = o
+}
+
+func newGenerationOverride(path, ruleGeneration string) *rule.Rule {
+	override := rule.NewRule(GazelleOverride, "")
+	override.SetAttr("path", path)
+	override.SetAttr(buildFileGenerationAttr, ruleGeneration)
+	return override
+}
+
+func applyBuildFileProtoMode(r *rule.Rule, set overrideSet, userDefaultProtoMode, userDefaultGeneration string) {
+	protoMode := r.AttrString(buildFileProtoModeAttr)
+
+	// If the gazelle_override doesn't exist. We only need to apply the proto mode
+	// if it does not match the user default proto mode.
+	gazelleOverride, ok := set[GazelleOverride]
+	if !ok {
+		if protoMode == "" || protoMode == userDefaultProtoMode {
+			return
+		}
+
+		set[GazelleOverride] = newProtoOverride(r.AttrString("importpath"), protoMode)
+
+		// Since it's a new override, we need to apply build_file_generation again.
+		applyBuildFileGeneration(r, set, userDefaultGeneration)
+		return
+	}
+
+	// If the gazelle_override exists, we should apply the override anyway since
+	// the tag overwrites the defaults.
+	if protoMode == "" {
+		protoMode = userDefaultProtoMode
+	}
+
+	safeAppendDirective(gazelleOverride, "gazelle:proto "+protoMode)
+	set[GazelleOverride] = gazelleOverride
+}
+
+func newProtoOverride(path, protoMode string) *rule.Rule {
+	override := rule.NewRule(GazelleOverride, "")
+	override.SetAttr("path", path)
+	directives := []string{"gazelle:proto " + protoMode}
+	override.SetAttr(directivesAttr, directives)
+	return override
+}
+
+func safeAppendDirective(gazelleOverride *rule.Rule, directive string) {
+	directives := gazelleOverride.AttrStrings(directivesAttr)
+	for _, d := range directives {
+		if d == directive {
+			return
+		}
+	}
+	directives = append(directives, directive)
+	gazelleOverride.SetAttr(directivesAttr, directives)
+}
+
+func setPatchArgs(patchArgs []string, override *rule.Rule) {
+	for _, arg := range patchArgs {
+		if !strings.HasPrefix(arg, "-p") {
+			continue
+		}
+		numStr := strings.TrimPrefix(arg, "-p")
+		if num, err := strconv.Atoi(numStr); err == nil {
+			override.SetAttr("patch_strip", num)
+			return
+		}
+	}
+}
+
+func setToOverridesSlice(set overrideSet) []*rule.Rule {
+	// Check if both archive and module overrides exist
+	if archiveOverride, archiveExists := set[ArchiveOverride]; archiveExists {
+		if moduleOverride, moduleExists := set[ModuleOverride]; moduleExists {
+			// Merge attributes from module override into archive override
+			mergeAttributes(moduleOverride, archiveOverride)
+			// Remove the module override as its attributes are now merged
+			delete(set, ModuleOverride)
+		}
+	}
+
+	// Create a sorted slice of the remaining override keys
+	var keys []string
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Create a slice of overrides based on the sorted keys
+	var overrides []*rule.Rule
+	for _, k := range keys {
+		overrides = append(overrides, set[k])
+	}
+	return overrides
+}
+
+func mergeAttributes(source, destination *rule.Rule) {
+	for _, attr := range source.AttrKeys() {
+		if val := source.Attr(attr); val != nil {
+			destination.SetAttr(attr, val)
+		}
+	}
+}
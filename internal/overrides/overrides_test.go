@@ -0,0 +1,57 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package overrides
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestFromGoRepository(t *testing.T) {
+	r := rule.NewRule("go_repository", "com_github_a_b")
+	r.SetAttr("importpath", "github.com/a/b")
+	r.SetAttr("version", "v1.0.0")
+	r.SetAttr("patches", []string{"//:a.patch"})
+	r.SetAttr("patch_args", []string{"-p1"})
+	r.SetAttr("urls", []string{"https://example.com/b.zip"})
+
+	var got []string
+	for _, o := range FromGoRepository(r, DefaultBuildFileGeneration, DefaultBuildFileProtoMode) {
+		got = append(got, o.Kind())
+	}
+	// The module override is merged into the archive override.
+	if want := []string{ArchiveOverride}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got override kinds %v; want %v", got, want)
+	}
+}
+
+func TestUntranslatedAttrs(t *testing.T) {
+	r := rule.NewRule("go_repository", "com_github_a_b")
+	r.SetAttr("importpath", "github.com/a/b")
+	r.SetAttr("sum", "h1:ab")
+	r.SetAttr("version", "v1.0.0")
+	r.SetAttr("build_file_proto_mode", "disable")
+	r.SetAttr("build_directives", []string{"gazelle:exclude testdata"})
+	r.SetAttr("vcs", "git")
+	r.SetAttr("commit", "abc123")
+
+	got := UntranslatedAttrs(r)
+	if want := []string{"commit", "vcs"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
@@ -10,7 +10,8 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// Package wspace provides functions to locate and modify a bazel WORKSPACE file.
+// Package wspace provides functions to locate and modify a bazel WORKSPACE file
+// and to locate the REPO.bazel file at the root of a repository.
 package wspace
 
 import (
@@ -21,6 +22,14 @@ import (
 
 var workspaceFiles = []string{"WORKSPACE.bazel", "WORKSPACE"}
 
+// repoFile is the name of the file that declares attributes for all packages
+// in a repository with a repo() call. Like a WORKSPACE file, it marks the
+// root of a repository.
+const repoFile = "REPO.bazel"
+
+// rootMarkerFiles are the names of files that mark the root of a repository.
+var rootMarkerFiles = append([]string{repoFile}, workspaceFiles...)
+
 // IsWORKSPACE checks whether path is named WORKSPACE or WORKSPACE.bazel
 func IsWORKSPACE(path string) bool {
 	base := filepath.Base(path)
@@ -45,8 +54,19 @@ func FindWORKSPACEFile(root string) string {
 	return filepath.Join(root, "WORKSPACE")
 }
 
-// FindRepoRoot searches from the given dir and up for a directory containing a WORKSPACE file
-// returning the directory containing it, or an error if none found in the tree.
+// FindREPOFile returns a path to the REPO.bazel file in the provided root
+// directory, or "" if there is no such file. Like FindWORKSPACEFile, it does
+// not check parent directories.
+func FindREPOFile(root string) string {
+	path := filepath.Join(root, repoFile)
+	if fileInfo, err := os.Stat(path); err == nil && !fileInfo.IsDir() {
+		return path
+	}
+	return ""
+}
+
+// FindRepoRoot searches from the given dir and up for a directory containing a WORKSPACE
+// or REPO.bazel file returning the directory containing it, or an error if none found in the tree.
 func FindRepoRoot(dir string) (string, error) {
 	dir, err := filepath.Abs(dir)
 	if err != nil {
@@ -54,8 +74,8 @@ func FindRepoRoot(dir string) (string, error) {
 	}
 
 	for {
-		for _, workspaceFile := range workspaceFiles {
-			filepath := filepath.Join(dir, workspaceFile)
+		for _, markerFile := range rootMarkerFiles {
+			filepath := filepath.Join(dir, markerFile)
 			info, err := os.Stat(filepath)
 			if err == nil && !info.IsDir() {
 				return dir, nil
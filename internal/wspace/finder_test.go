@@ -92,3 +92,37 @@ func TestFind(t *testing.T) {
 		})
 	}
 }
+
+func TestFindREPOFile(t *testing.T) {
+	tmp := t.TempDir()
+	tmp, err := filepath.EvalSymlinks(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent, err := FindRepoRoot(tmp); err == nil {
+		t.Skipf("WORKSPACE visible in parent %q of tmp %q", parent, tmp)
+	}
+
+	if got := FindREPOFile(tmp); got != "" {
+		t.Errorf("FindREPOFile(%q): got %q, wanted no file", tmp, got)
+	}
+	repoPath := filepath.Join(tmp, "REPO.bazel")
+	if err := os.WriteFile(repoPath, []byte("repo()\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	subdir := filepath.Join(tmp, "dir1", "dir2")
+	if err := os.MkdirAll(subdir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := FindRepoRoot(subdir)
+	if err != nil {
+		t.Fatalf("FindRepoRoot(%q): got error %v, wanted %q", subdir, err, tmp)
+	}
+	if root != tmp {
+		t.Errorf("FindRepoRoot(%q): got %q, wanted %q", subdir, root, tmp)
+	}
+	if got := FindREPOFile(root); got != repoPath {
+		t.Errorf("FindREPOFile(%q): got %q, wanted %q", root, got, repoPath)
+	}
+}
@@ -0,0 +1,61 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package yamlscalar provides helpers for the small line-based subsets of
+// YAML that Gazelle reads, like .gazelle.yaml and buf.yaml files, without
+// depending on a full YAML parser.
+package yamlscalar
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StripComment removes a comment starting with "#" from line. A "#" only
+// starts a comment at the beginning of a line or after a space, and not
+// within a quoted scalar.
+func StripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t:[,-", line[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// Unquote returns the value of a plain, single-quoted, or double-quoted
+// scalar.
+func Unquote(s string) (string, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		return strconv.Unquote(s)
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.HasPrefix(s, "\"") || strings.HasPrefix(s, "'"):
+		return "", fmt.Errorf("unterminated quoted value %s", s)
+	}
+	return s, nil
+}
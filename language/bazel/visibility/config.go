@@ -17,6 +17,8 @@ package visibility
 
 import (
 	"flag"
+	"log"
+	"strconv"
 	"strings"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
@@ -24,11 +26,17 @@ import (
 )
 
 const (
-	_directiveName = "default_visibility"
+	_directiveName       = "default_visibility"
+	_manageDirectiveName = "manage_default_visibility"
 )
 
 type visConfig struct {
 	visibilityTargets []string
+
+	// manage indicates that package(default_visibility = ...) should also be
+	// written into new build files, and that per-rule visibility attributes
+	// matching the default should be removed.
+	manage bool
 }
 
 // getVisConfig directly returns the internal configuration struct rather
@@ -52,7 +60,7 @@ func (*visibilityExtension) CheckFlags(fs *flag.FlagSet, c *config.Config) error
 
 // KnownDirectives returns the only directive this extension operates on.
 func (*visibilityExtension) KnownDirectives() []string {
-	return []string{_directiveName}
+	return []string{_directiveName, _manageDirectiveName}
 }
 
 // Configure identifies the visibility targets from the directive value, if it exists.
@@ -72,6 +80,13 @@ func (*visibilityExtension) Configure(c *config.Config, _ string, f *rule.File)
 			for _, target := range strings.Split(d.Value, ",") {
 				newVisTargets = append(newVisTargets, target)
 			}
+		case _manageDirectiveName:
+			manage, err := strconv.ParseBool(d.Value)
+			if err != nil {
+				log.Printf("parsing %s: %v", _manageDirectiveName, err)
+				continue
+			}
+			cfg.manage = manage
 		}
 	}
 
@@ -80,6 +95,14 @@ func (*visibilityExtension) Configure(c *config.Config, _ string, f *rule.File)
 		cfg.visibilityTargets = newVisTargets
 	}
 
+	// package(default_visibility = ...) is written into every build file with
+	// rules, so languages leave visibility unset on the rules they generate,
+	// as they would for an existing file with a default. Otherwise, the
+	// visibility set in a new file would be dropped on the next run.
+	if cfg.manage && len(cfg.visibilityTargets) != 0 {
+		c.OmitVisibility = true
+	}
+
 	c.Exts[_extName] = cfg
 }
 
@@ -18,6 +18,7 @@ package visibility
 import (
 	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/merger"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 )
 
@@ -58,13 +59,17 @@ func (*visibilityExtension) GenerateRules(args language.GenerateArgs) language.G
 		return res
 	}
 
-	if args.File == nil {
+	if args.File == nil && (!cfg.manage || len(args.OtherGen) == 0) {
 		// No need to create a visibility if we're not in a visible directory.
+		// When managing default visibility, a new build file will be created
+		// for the rules generated by other languages, so it needs one too.
 		return res
 	}
 
 	r := rule.NewRule("package", "")
 	r.SetAttr("default_visibility", cfg.visibilityTargets)
+	// package() must be called before any rules.
+	r.SetPrivateAttr(merger.UnstableInsertIndexKey, firstRuleIndex(args.File))
 
 	res.Gen = append(res.Gen, r)
 	// we have to add a nil to Imports because there is length-matching validation with Gen.
@@ -72,5 +77,56 @@ func (*visibilityExtension) GenerateRules(args language.GenerateArgs) language.G
 	return res
 }
 
-// Fix noop because there is nothing out there to fix yet
-func (*visibilityExtension) Fix(c *config.Config, f *rule.File) {}
+// Fix removes visibility attributes that are redundant with the configured
+// default_visibility when the manage_default_visibility directive is set.
+// Rules generated by other languages don't need this, since Configure sets
+// OmitVisibility for them.
+func (*visibilityExtension) Fix(c *config.Config, f *rule.File) {
+	if c == nil || f == nil {
+		return
+	}
+	cfg := getVisConfig(c)
+	if !cfg.manage || len(cfg.visibilityTargets) == 0 {
+		return
+	}
+	for _, r := range f.Rules {
+		dropRedundantVisibility(r, cfg.visibilityTargets)
+	}
+}
+
+// dropRedundantVisibility deletes the visibility attribute of r if it lists
+// the same labels as defaultVisibility, ignoring order.
+func dropRedundantVisibility(r *rule.Rule, defaultVisibility []string) {
+	if r.Kind() == "package" {
+		return
+	}
+	vis := r.AttrStrings("visibility")
+	if vis == nil || len(vis) != len(defaultVisibility) {
+		return
+	}
+	want := make(map[string]bool, len(defaultVisibility))
+	for _, v := range defaultVisibility {
+		want[v] = true
+	}
+	for _, v := range vis {
+		if !want[v] {
+			return
+		}
+	}
+	r.DelAttr("visibility")
+}
+
+// firstRuleIndex returns the index of the first rule statement in f, or the
+// number of statements if there are no rules. It returns 0 if f is nil.
+func firstRuleIndex(f *rule.File) int {
+	if f == nil {
+		return 0
+	}
+	index := len(f.File.Stmt)
+	for _, r := range f.Rules {
+		if r.Index() < index {
+			index = r.Index()
+		}
+	}
+	return index
+}
@@ -286,3 +286,93 @@ func Test_MultipleDirectivesAcrossFilesSupercede(t *testing.T) {
 		t.Fatal("expected returned visibility to match '//src:__subpackages__'")
 	}
 }
+
+func Test_ManageNewFile(t *testing.T) {
+	testVis := "//src:__subpackages__"
+	cfg := config.New()
+	file, err := rule.LoadData("path", "pkg", []byte(fmt.Sprintf(`
+# gazelle:default_visibility %s
+# gazelle:manage_default_visibility true
+`, testVis)))
+	if err != nil {
+		t.Fatalf("expected not nil - %+v", err)
+	}
+
+	ext := visibility.NewLanguage()
+	ext.Configure(cfg, "rel", file)
+
+	redundant := rule.NewRule("go_library", "redundant")
+	redundant.SetAttr("visibility", []string{testVis})
+	public := rule.NewRule("go_library", "public")
+	public.SetAttr("visibility", []string{"//visibility:public"})
+	res := ext.GenerateRules(language.GenerateArgs{
+		Config:   cfg,
+		OtherGen: []*rule.Rule{redundant, public},
+	})
+
+	if len(res.Gen) != 1 {
+		t.Fatal("expected array of length 1")
+	}
+	if got := res.Gen[0].AttrStrings("default_visibility"); len(got) != 1 || got[0] != testVis {
+		t.Fatalf("expected default_visibility to be [%s], got %v", testVis, got)
+	}
+	if redundant.Attr("visibility") == nil || public.Attr("visibility") == nil {
+		t.Fatal("expected rules generated by other languages to be left alone")
+	}
+}
+
+func Test_NoManageNewFile(t *testing.T) {
+	cfg := config.New()
+	file, err := rule.LoadData("path", "pkg", []byte(`
+# gazelle:default_visibility //src:__subpackages__
+`))
+	if err != nil {
+		t.Fatalf("expected not nil - %+v", err)
+	}
+
+	ext := visibility.NewLanguage()
+	ext.Configure(cfg, "rel", file)
+	res := ext.GenerateRules(language.GenerateArgs{
+		Config:   cfg,
+		OtherGen: []*rule.Rule{rule.NewRule("go_library", "lib")},
+	})
+
+	if len(res.Gen) != 0 {
+		t.Fatal("expected empty array")
+	}
+}
+
+func Test_ManageFix(t *testing.T) {
+	cfg := config.New()
+	file, err := rule.LoadData("path", "pkg", []byte(`
+# gazelle:default_visibility //b:__pkg__,//a:__pkg__
+# gazelle:manage_default_visibility true
+
+go_library(
+    name = "redundant",
+    visibility = [
+        "//a:__pkg__",
+        "//b:__pkg__",
+    ],
+)
+
+go_library(
+    name = "private",
+    visibility = ["//visibility:private"],
+)
+`))
+	if err != nil {
+		t.Fatalf("expected not nil - %+v", err)
+	}
+
+	ext := visibility.NewLanguage()
+	ext.Configure(cfg, "rel", file)
+	ext.Fix(cfg, file)
+
+	if file.Rules[0].Attr("visibility") != nil {
+		t.Fatal("expected redundant visibility to be removed")
+	}
+	if file.Rules[1].Attr("visibility") == nil {
+		t.Fatal("expected non-default visibility to be kept")
+	}
+}
@@ -0,0 +1,95 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bzl
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+func (*bzlLang) GenerateRules(args language.GenerateArgs) language.GenerateResult {
+	var res language.GenerateResult
+	c := args.Config
+	shouldSetVisibility := !c.OmitVisibility && !c.HasRepoDefaultVisibility() && (args.File == nil || !args.File.HasDefaultVisibility())
+
+	srcSet := make(map[string]bool)
+	for _, name := range args.RegularFiles {
+		if !strings.HasSuffix(name, ".bzl") {
+			continue
+		}
+		srcSet[name] = true
+		loads, err := readLoads(filepath.Join(args.Dir, name))
+		if err != nil {
+			log.Print(err)
+		}
+		r := rule.NewRule(bzlLibraryKind, strings.TrimSuffix(name, ".bzl"))
+		r.SetAttr("srcs", []string{name})
+		if shouldSetVisibility {
+			r.SetAttr("visibility", []string{rule.CheckInternalVisibility(args.Rel, "//visibility:public")})
+		}
+		r.SetPrivateAttr(config.GazelleImportsKey, loads)
+		res.Gen = append(res.Gen, r)
+		res.Imports = append(res.Imports, loads)
+	}
+
+	// Existing bzl_library rules for files that were removed should be deleted.
+	if args.File != nil {
+		for _, r := range args.File.Rules {
+			if r.Kind() != bzlLibraryKind {
+				continue
+			}
+			srcs := r.AttrStrings("srcs")
+			if len(srcs) == 1 && !srcSet[srcs[0]] {
+				res.Empty = append(res.Empty, rule.NewRule(bzlLibraryKind, r.Name()))
+			}
+		}
+	}
+
+	return res
+}
+
+// readLoads returns the sorted, de-duplicated list of labels loaded by the
+// .bzl file at path.
+func readLoads(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := bzl.ParseBzl(path, data)
+	if err != nil {
+		return nil, err
+	}
+	loadSet := make(map[string]bool)
+	for _, stmt := range f.Stmt {
+		if load, ok := stmt.(*bzl.LoadStmt); ok {
+			loadSet[load.Module.Value] = true
+		}
+	}
+	loads := make([]string, 0, len(loadSet))
+	for l := range loadSet {
+		loads = append(loads, l)
+	}
+	sort.Strings(loads)
+	return loads, nil
+}
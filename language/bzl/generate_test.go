@@ -0,0 +1,144 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bzl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/merger"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/bazelbuild/bazel-gazelle/testtools"
+	"github.com/bazelbuild/bazel-gazelle/walk"
+
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+func TestGenerateRules(t *testing.T) {
+	if _, err := os.Stat("testdata"); os.IsNotExist(err) {
+		t.Skip("testdata missing on windows due to lack of symbolic links")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	c, lang, _ := testConfig(t, "testdata")
+
+	walk.Walk(c, []config.Configurer{lang}, []string{"testdata"}, walk.VisitAllUpdateSubdirsMode, func(dir, rel string, c *config.Config, update bool, oldFile *rule.File, subdirs, regularFiles, genFiles []string) {
+		isTest := false
+		for _, name := range regularFiles {
+			if name == "BUILD.want" {
+				isTest = true
+				break
+			}
+		}
+		if !isTest {
+			return
+		}
+		t.Run(rel, func(t *testing.T) {
+			res := lang.GenerateRules(language.GenerateArgs{
+				Config:       c,
+				Dir:          dir,
+				Rel:          rel,
+				File:         oldFile,
+				Subdirs:      subdirs,
+				RegularFiles: regularFiles,
+				GenFiles:     genFiles,
+			})
+			if len(res.Gen) != len(res.Imports) {
+				t.Fatalf("got %d generated rules and %d imports; want the same number", len(res.Gen), len(res.Imports))
+			}
+			f := rule.EmptyFile("test", "")
+			for _, r := range res.Gen {
+				r.Insert(f)
+			}
+			convertImportsAttrs(f)
+			merger.FixLoads(f, lang.(language.ModuleAwareLanguage).ApparentLoads(func(string) string { return "" }))
+			f.Sync()
+			got := string(bzl.Format(f.File))
+			wantPath := filepath.Join(dir, "BUILD.want")
+			wantBytes, err := os.ReadFile(wantPath)
+			if err != nil {
+				t.Fatalf("error reading %s: %v", wantPath, err)
+			}
+			want := string(wantBytes)
+			want = strings.ReplaceAll(want, "\r\n", "\n")
+			if got != want {
+				t.Errorf("GenerateRules %q: got:\n%s\nwant:\n%s", rel, got, want)
+			}
+		})
+	})
+}
+
+func TestGenerateRulesEmpty(t *testing.T) {
+	c, lang, _ := testConfig(t, ".")
+	old, err := rule.LoadData("BUILD.bazel", "", []byte(`
+bzl_library(
+    name = "gone",
+    srcs = ["gone.bzl"],
+)
+
+bzl_library(
+    name = "custom",
+    srcs = ["a.bzl", "b.bzl"],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := lang.GenerateRules(language.GenerateArgs{
+		Config: c,
+		Dir:    t.TempDir(),
+		File:   old,
+	})
+	if len(res.Gen) != 0 {
+		t.Errorf("got %d generated rules; want 0", len(res.Gen))
+	}
+	if len(res.Empty) != 1 || res.Empty[0].Name() != "gone" {
+		t.Errorf("got empty rules %v; want [gone]", res.Empty)
+	}
+}
+
+func testConfig(t *testing.T, repoRoot string) (*config.Config, language.Language, []config.Configurer) {
+	cexts := []config.Configurer{
+		&config.CommonConfigurer{},
+		&walk.Configurer{},
+		&resolve.Configurer{},
+	}
+	lang := NewLanguage()
+	c := testtools.NewTestConfig(t, cexts, []language.Language{lang}, []string{
+		"-build_file_name=BUILD.old",
+		"-repo_root=" + repoRoot,
+	})
+	cexts = append(cexts, lang)
+	return c, lang, cexts
+}
+
+// convertImportsAttrs copies private attributes to regular attributes, which
+// will later be written out to build files. This allows tests to check the
+// values of private attributes with simple string comparison.
+func convertImportsAttrs(f *rule.File) {
+	for _, r := range f.Rules {
+		v := r.PrivateAttr(config.GazelleImportsKey)
+		if v != nil {
+			r.SetAttr(config.GazelleImportsKey, v)
+		}
+	}
+}
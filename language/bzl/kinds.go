@@ -0,0 +1,57 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bzl
+
+import (
+	"fmt"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+const bzlLibraryKind = "bzl_library"
+
+var bzlKinds = map[string]rule.KindInfo{
+	bzlLibraryKind: {
+		MatchAttrs:     []string{"srcs"},
+		NonEmptyAttrs:  map[string]bool{"srcs": true},
+		MergeableAttrs: map[string]bool{"srcs": true},
+		ResolveAttrs:   map[string]bool{"deps": true},
+		KnownAttrs: map[string]bool{
+			"data": true,
+			"deps": true,
+			"srcs": true,
+		},
+	},
+}
+
+func (*bzlLang) Kinds() map[string]rule.KindInfo { return bzlKinds }
+
+func (*bzlLang) Loads() []rule.LoadInfo {
+	panic("ApparentLoads should be called instead")
+}
+
+func (*bzlLang) ApparentLoads(moduleToApparentName func(string) string) []rule.LoadInfo {
+	skylib := moduleToApparentName("bazel_skylib")
+	if skylib == "" {
+		skylib = "bazel_skylib"
+	}
+	return []rule.LoadInfo{
+		{
+			Name:    fmt.Sprintf("@%s//:bzl_library.bzl", skylib),
+			Symbols: []string{bzlLibraryKind},
+		},
+	}
+}
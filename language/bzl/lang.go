@@ -0,0 +1,71 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bzl provides support for Starlark (.bzl) files. It generates
+// bzl_library rules from @bazel_skylib.
+//
+// This language is not included in the default Gazelle binary. To use it,
+// add "@bazel_gazelle//language/bzl" to the languages of a gazelle_binary.
+//
+// # Rule generation
+//
+// Gazelle generates one bzl_library for each .bzl file in a directory. The
+// rule is named after the file without its extension; for example, foo.bzl
+// produces a bzl_library named "foo". Rules are public unless the directory
+// is internal.
+//
+// # Dependency resolution
+//
+// bzl_library rules are indexed by the labels of their srcs. Gazelle resolves
+// each load() statement to the bzl_library containing the loaded file. If no
+// indexed rule provides the file and the file is in the main repository,
+// Gazelle guesses a label, following the naming convention above. Loads from
+// other repositories are only resolved with # gazelle:resolve directives,
+// except for @bazel_tools, which provides //tools:bzl_srcs.
+package bzl
+
+import (
+	"flag"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+const bzlName = "bzl"
+
+type bzlLang struct{}
+
+func (*bzlLang) Name() string { return bzlName }
+
+// NewLanguage constructs a new language.Language generating bzl_library rules.
+func NewLanguage() language.Language {
+	return &bzlLang{}
+}
+
+// RegisterFlags noops because this extension has no flags.
+func (*bzlLang) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config) {}
+
+// CheckFlags noops because this extension has no flags.
+func (*bzlLang) CheckFlags(fs *flag.FlagSet, c *config.Config) error { return nil }
+
+// KnownDirectives returns nil because this extension has no directives.
+func (*bzlLang) KnownDirectives() []string { return nil }
+
+// Configure noops because this extension has no configuration.
+func (*bzlLang) Configure(c *config.Config, rel string, f *rule.File) {}
+
+// Fix noops because there is no deprecated usage to fix yet.
+func (*bzlLang) Fix(c *config.Config, f *rule.File) {}
@@ -0,0 +1,131 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bzl
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// bazelToolsBzlSrcs is a filegroup containing all .bzl files in @bazel_tools.
+// bzl_library accepts it in deps.
+var bazelToolsBzlSrcs = label.New("bazel_tools", "tools", "bzl_srcs")
+
+func (*bzlLang) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
+	srcs := r.AttrStrings("srcs")
+	imports := make([]resolve.ImportSpec, 0, len(srcs))
+	for _, src := range srcs {
+		l, err := label.Parse(src)
+		if err != nil || !l.Relative {
+			continue
+		}
+		imports = append(imports, resolve.ImportSpec{Lang: bzlName, Imp: label.New("", f.Pkg, l.Name).String()})
+	}
+	return imports
+}
+
+func (*bzlLang) Embeds(r *rule.Rule, from label.Label) []label.Label {
+	return nil
+}
+
+// ResolveConcurrently returns true, since Resolve doesn't modify shared
+// state.
+func (*bzlLang) ResolveConcurrently() bool { return true }
+
+func (*bzlLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, importsRaw interface{}, from label.Label) {
+	if importsRaw == nil {
+		// may not be set in tests.
+		return
+	}
+	imports := importsRaw.([]string)
+	r.DelAttr("deps")
+	depSet := make(map[string]bool)
+	for _, imp := range imports {
+		l, err := resolveBzl(c, ix, imp, from)
+		if err == errSkipImport {
+			continue
+		} else if err != nil {
+			log.Print(err)
+		} else {
+			l = l.Rel(from.Repo, from.Pkg)
+			depSet[l.String()] = true
+		}
+	}
+	if len(depSet) > 0 {
+		deps := make([]string, 0, len(depSet))
+		for dep := range depSet {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+		r.SetAttr("deps", deps)
+	}
+}
+
+var (
+	errSkipImport = errors.New("self or unresolvable import")
+	errNotFound   = errors.New("not found")
+)
+
+// resolveBzl returns the label of the bzl_library that provides the .bzl file
+// loaded with the label string imp.
+func resolveBzl(c *config.Config, ix *resolve.RuleIndex, imp string, from label.Label) (label.Label, error) {
+	l, err := label.Parse(imp)
+	if err != nil {
+		return label.NoLabel, fmt.Errorf("%s: invalid load: %v", from, err)
+	}
+	l = l.Abs(from.Repo, from.Pkg)
+	if l.Repo == "@" || l.Repo == c.RepoName {
+		l.Repo = ""
+	}
+	spec := resolve.ImportSpec{Lang: bzlName, Imp: l.String()}
+
+	if dep, ok := resolve.FindRuleWithOverride(c, spec, bzlName); ok {
+		return dep, nil
+	}
+
+	if l.Repo != "" {
+		if l.Repo == bazelToolsBzlSrcs.Repo {
+			return bazelToolsBzlSrcs, nil
+		}
+		return label.NoLabel, errSkipImport
+	}
+
+	matches := ix.FindRulesByImportWithConfig(c, spec, bzlName)
+	if len(matches) > 1 {
+		return label.NoLabel, fmt.Errorf("multiple rules (%s and %s) may be loaded with %q from %s", matches[0].Label, matches[1].Label, imp, from)
+	} else if len(matches) == 1 {
+		if matches[0].IsSelfImport(from) {
+			return label.NoLabel, errSkipImport
+		}
+		return matches[0].Label, nil
+	}
+
+	if strings.Contains(l.Name, "/") || !strings.HasSuffix(l.Name, ".bzl") {
+		// Gazelle wouldn't generate a bzl_library for this file, so we can't
+		// guess its name.
+		return label.NoLabel, errSkipImport
+	}
+	return label.New("", l.Pkg, strings.TrimSuffix(l.Name, ".bzl")), nil
+}
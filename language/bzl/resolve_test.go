@@ -0,0 +1,222 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bzl
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+func TestResolveBzl(t *testing.T) {
+	type buildFile struct {
+		rel, content string
+	}
+	type testCase struct {
+		desc      string
+		index     []buildFile
+		old, want string
+	}
+	for _, tc := range []testCase{
+		{
+			desc: "index",
+			index: []buildFile{{
+				rel: "foo",
+				content: `
+bzl_library(
+    name = "lib",
+    srcs = ["defs.bzl"],
+)
+`,
+			}},
+			old: `
+bzl_library(
+    name = "dep",
+    _imports = ["//foo:defs.bzl"],
+)
+`,
+			want: `
+bzl_library(
+    name = "dep",
+    deps = ["//foo:lib"],
+)
+`,
+		}, {
+			desc: "index_local",
+			old: `
+bzl_library(
+    name = "a",
+    srcs = ["a.bzl"],
+)
+
+bzl_library(
+    name = "b",
+    srcs = ["b.bzl"],
+    _imports = [
+        ":a.bzl",
+        ":b.bzl",
+        "@//test:a.bzl",
+    ],
+)
+`,
+			want: `
+bzl_library(
+    name = "a",
+    srcs = ["a.bzl"],
+)
+
+bzl_library(
+    name = "b",
+    srcs = ["b.bzl"],
+    deps = [":a"],
+)
+`,
+		}, {
+			desc: "override",
+			index: []buildFile{
+				{
+					rel: "foo",
+					content: `
+bzl_library(
+    name = "bad",
+    srcs = ["defs.bzl"],
+)
+`,
+				}, {
+					rel: "",
+					content: `
+# gazelle:resolve bzl //foo:defs.bzl //:good
+# gazelle:resolve bzl @rules_cc//cc:defs.bzl @rules_cc//cc:core_rules
+`,
+				},
+			},
+			old: `
+bzl_library(
+    name = "dep",
+    _imports = [
+        "//foo:defs.bzl",
+        "@rules_cc//cc:defs.bzl",
+    ],
+)
+`,
+			want: `
+bzl_library(
+    name = "dep",
+    deps = [
+        "//:good",
+        "@rules_cc//cc:core_rules",
+    ],
+)
+`,
+		}, {
+			desc: "external",
+			old: `
+bzl_library(
+    name = "dep",
+    _imports = [
+        "@bazel_skylib//lib:paths.bzl",
+        "@bazel_tools//tools/cpp:toolchain_utils.bzl",
+    ],
+)
+`,
+			want: `
+bzl_library(
+    name = "dep",
+    deps = ["@bazel_tools//tools:bzl_srcs"],
+)
+`,
+		}, {
+			desc: "guess",
+			old: `
+bzl_library(
+    name = "dep",
+    _imports = [
+        "//bar:baz.bzl",
+        "//bar:sub/baz.bzl",
+    ],
+)
+`,
+			want: `
+bzl_library(
+    name = "dep",
+    deps = ["//bar:baz"],
+)
+`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			c, lang, cexts := testConfig(t, ".")
+			mrslv := make(mapResolver)
+			mrslv[bzlLibraryKind] = lang
+			ix := resolve.NewRuleIndex(mrslv.Resolver)
+			rc := (*repo.RemoteCache)(nil)
+			for _, bf := range tc.index {
+				f, err := rule.LoadData(filepath.Join(bf.rel, "BUILD.bazel"), bf.rel, []byte(bf.content))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bf.rel == "" {
+					for _, cext := range cexts {
+						cext.Configure(c, "", f)
+					}
+				}
+				for _, r := range f.Rules {
+					ix.AddRule(c, r, f)
+				}
+			}
+			f, err := rule.LoadData("test/BUILD.bazel", "test", []byte(tc.old))
+			if err != nil {
+				t.Fatal(err)
+			}
+			imports := make([]interface{}, len(f.Rules))
+			for i, r := range f.Rules {
+				imports[i] = convertImportsAttr(r)
+				ix.AddRule(c, r, f)
+			}
+			ix.Finish()
+			for i, r := range f.Rules {
+				lang.Resolve(c, ix, rc, r, imports[i], label.New("", "test", r.Name()))
+			}
+			f.Sync()
+			got := strings.TrimSpace(string(bzl.Format(f.File)))
+			want := strings.TrimSpace(tc.want)
+			if got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func convertImportsAttr(r *rule.Rule) interface{} {
+	value := r.AttrStrings("_imports")
+	if value == nil {
+		value = []string(nil)
+	}
+	r.DelAttr("_imports")
+	return value
+}
+
+type mapResolver map[string]resolve.Resolver
+
+func (mr mapResolver) Resolver(r *rule.Rule, f string) resolve.Resolver {
+	return mr[r.Kind()]
+}
@@ -0,0 +1,6 @@
+load("//simple:util.bzl", "helper")
+load(":util.bzl", "other")
+load("@bazel_skylib//lib:paths.bzl", "paths")
+
+def my_macro(name):
+    helper(name)
@@ -0,0 +1,4 @@
+def helper(name):
+    pass
+
+other = 1
@@ -0,0 +1,80 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package language
+
+import (
+	"log"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// FileFixer may be implemented by a Language to register fixes that apply
+// to a whole build file, rather than to individual rules. These may delete
+// obsolete load statements or symbols, macro calls, and rules that no longer
+// have a replacement.
+//
+// Unlike Fix, a FileFix doesn't need to check c.ShouldFix. Gazelle checks
+// each file with every FileFix. In fix mode, it applies the fixes that are
+// needed. Otherwise, it only reports them, so users can see what
+// 'gazelle fix' would change.
+type FileFixer interface {
+	FileFixes() []FileFix
+}
+
+// FileFix is a fix applied to a whole build file by ApplyFileFixes.
+type FileFix struct {
+	// Name identifies the fix in reports, for example, "legacy_proto".
+	Name string
+
+	// Check returns a description of what Fix would change in f, or "" if
+	// f doesn't need to be fixed. Check must not modify f.
+	Check func(c *config.Config, f *rule.File) string
+
+	// Fix modifies f. It's only called in fix mode, after Check returned a
+	// non-empty description.
+	Fix func(c *config.Config, f *rule.File)
+}
+
+// ApplyFileFixes checks f with the FileFixes of each language in langs that
+// implements FileFixer, in order. If c.ShouldFix is true, needed fixes are
+// applied. Otherwise, they're logged. The descriptions of the needed fixes
+// are returned. f may be nil.
+func ApplyFileFixes(c *config.Config, f *rule.File, langs []Language) []string {
+	if f == nil {
+		return nil
+	}
+	var needed []string
+	for _, lang := range langs {
+		fixer, ok := lang.(FileFixer)
+		if !ok {
+			continue
+		}
+		for _, fix := range fixer.FileFixes() {
+			desc := fix.Check(c, f)
+			if desc == "" {
+				continue
+			}
+			needed = append(needed, desc)
+			if c.ShouldFix {
+				fix.Fix(c, f)
+			} else {
+				log.Printf("%s: %s. Run 'gazelle fix' to apply the %s fix.", f.Path, desc, fix.Name)
+			}
+		}
+	}
+	return needed
+}
@@ -0,0 +1,127 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golang
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/internal/version"
+)
+
+// goVersionFlag is a flag.Value that parses a Go version, like "1.21",
+// "1.21.3", or "go1.21.3".
+type goVersionFlag struct {
+	v *version.Version
+}
+
+func (f goVersionFlag) Set(value string) error {
+	v, err := parseGoVersion(value)
+	if err != nil {
+		return err
+	}
+	*f.v = v
+	return nil
+}
+
+func (f *goVersionFlag) String() string {
+	if f == nil || f.v == nil {
+		return ""
+	}
+	return f.v.String()
+}
+
+// parseGoVersion parses a Go version as written in a go.mod go directive or
+// a toolchain name. A "go" prefix is trimmed. Pre-release suffixes like
+// "rc1" and "beta2" are ignored, and a missing patch version is 0, so
+// "1.22rc1" and "1.22" are both treated like "1.22.0".
+func parseGoVersion(s string) (version.Version, error) {
+	vs := strings.TrimPrefix(s, "go")
+	if i := strings.IndexAny(vs, "abcdefghijklmnopqrstuvwxyz"); i >= 0 {
+		vs = vs[:i]
+	}
+	v, err := version.ParseVersion(vs)
+	if err != nil || len(v) < 2 {
+		return nil, fmt.Errorf("invalid Go version %q", s)
+	}
+	if len(v) == 2 {
+		v = append(v, 0)
+	}
+	return v, nil
+}
+
+// compatReport returns a summary of modules in pathToModule that declare a
+// go directive newer than the Go version the repository is built with, set
+// with -compat_level. Builds of these modules fail with the older toolchain,
+// often with errors about language features or missing standard library
+// packages that don't point at the cause. The summary suggests a
+// go_register_toolchains call for the newest version required. compatReport
+// returns "" if all modules are compatible or -compat_level isn't set.
+func compatReport(gc *goConfig, pathToModule map[string]*moduleFromList) string {
+	if gc.compatLevel == nil {
+		return ""
+	}
+
+	type requirement struct {
+		goVersion version.Version
+		modules   []string
+	}
+	byVersion := make(map[string]*requirement)
+	count := 0
+	for pathVer, mod := range pathToModule {
+		if mod.GoVersion == "" {
+			continue
+		}
+		v, err := parseGoVersion(mod.GoVersion)
+		if err != nil || v.Compare(gc.compatLevel) <= 0 {
+			continue
+		}
+		req := byVersion[v.String()]
+		if req == nil {
+			req = &requirement{goVersion: v}
+			byVersion[v.String()] = req
+		}
+		req.modules = append(req.modules, pathVer)
+		count++
+	}
+	if count == 0 {
+		return ""
+	}
+
+	reqs := make([]*requirement, 0, len(byVersion))
+	for _, req := range byVersion {
+		sort.Strings(req.modules)
+		reqs = append(reqs, req)
+	}
+	sort.Slice(reqs, func(i, j int) bool {
+		return reqs[i].goVersion.Compare(reqs[j].goVersion) < 0
+	})
+
+	var sb strings.Builder
+	noun := "modules require"
+	if count == 1 {
+		noun = "module requires"
+	}
+	fmt.Fprintf(&sb, "%d %s a newer version of Go than %s, set with -compat_level:\n", count, noun, gc.compatLevel)
+	for _, req := range reqs {
+		fmt.Fprintf(&sb, "\tgo %s: %s\n", req.goVersion, strings.Join(req.modules, ", "))
+	}
+	newest := reqs[len(reqs)-1].goVersion
+	sb.WriteString("Targets in these modules may fail to build. To build them, register a newer Go toolchain:\n")
+	fmt.Fprintf(&sb, "\tgo_register_toolchains(version = %q)", newest.String())
+	return sb.String()
+}
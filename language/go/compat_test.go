@@ -0,0 +1,93 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golang
+
+import (
+	"flag"
+	"io"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+)
+
+func TestCompatReport(t *testing.T) {
+	pathToModule := map[string]*moduleFromList{
+		"example.com/old@v1.0.0":   {Path: "example.com/old", Version: "v1.0.0", GoVersion: "1.16"},
+		"example.com/same@v1.0.0":  {Path: "example.com/same", Version: "v1.0.0", GoVersion: "1.21.0"},
+		"example.com/none@v1.0.0":  {Path: "example.com/none", Version: "v1.0.0"},
+		"example.com/b@v1.2.0":     {Path: "example.com/b", Version: "v1.2.0", GoVersion: "1.22"},
+		"example.com/a@v0.3.0":     {Path: "example.com/a", Version: "v0.3.0", GoVersion: "1.22.1"},
+		"example.com/c@v2.0.0":     {Path: "example.com/c", Version: "v2.0.0", GoVersion: "1.23rc1"},
+		"example.com/fork@v0.1.0":  {Path: "example.com/orig", Version: "v0.1.0", GoVersion: "1.22"},
+		"example.com/patch@v1.0.0": {Path: "example.com/patch", Version: "v1.0.0", GoVersion: "1.21.5"},
+	}
+
+	for _, tc := range []struct {
+		desc, compatLevel, want string
+	}{
+		{
+			desc: "unset",
+		}, {
+			desc:        "compatible",
+			compatLevel: "go1.23.0",
+		}, {
+			desc:        "newer",
+			compatLevel: "1.21",
+			want: `5 modules require a newer version of Go than 1.21.0, set with -compat_level:
+	go 1.21.5: example.com/patch@v1.0.0
+	go 1.22.0: example.com/b@v1.2.0, example.com/fork@v0.1.0
+	go 1.22.1: example.com/a@v0.3.0
+	go 1.23.0: example.com/c@v2.0.0
+Targets in these modules may fail to build. To build them, register a newer Go toolchain:
+	go_register_toolchains(version = "1.23.0")`,
+		}, {
+			desc:        "one",
+			compatLevel: "1.22.1",
+			want: `1 module requires a newer version of Go than 1.22.1, set with -compat_level:
+	go 1.23.0: example.com/c@v2.0.0
+Targets in these modules may fail to build. To build them, register a newer Go toolchain:
+	go_register_toolchains(version = "1.23.0")`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			c := config.New()
+			gl := NewLanguage()
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			gl.RegisterFlags(fs, "update-repos", c)
+			if tc.compatLevel != "" {
+				if err := fs.Parse([]string{"-compat_level=" + tc.compatLevel}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := compatReport(getGoConfig(c), pathToModule); got != tc.want {
+				t.Errorf("got:\n%s\n\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompatLevelFlagInvalid(t *testing.T) {
+	c := config.New()
+	gl := NewLanguage()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	gl.RegisterFlags(fs, "update-repos", c)
+	for _, value := range []string{"1", "latest", "1.x"} {
+		if err := fs.Parse([]string{"-compat_level=" + value}); err == nil {
+			t.Errorf("-compat_level=%s: got no error", value)
+		}
+	}
+}
@@ -32,7 +32,9 @@ import (
 	gzflag "github.com/bazelbuild/bazel-gazelle/flag"
 	"github.com/bazelbuild/bazel-gazelle/internal/module"
 	"github.com/bazelbuild/bazel-gazelle/internal/version"
+	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/language/proto"
+	"github.com/bazelbuild/bazel-gazelle/pathtools"
 	"github.com/bazelbuild/bazel-gazelle/repo"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 	bzl "github.com/bazelbuild/buildtools/build"
@@ -51,6 +53,20 @@ type goConfig struct {
 	// by reading go/def.bzl. May be unset if the version can't be read.
 	rulesGoVersion version.Version
 
+	// minimumRulesGo is the oldest version of rules_go that generated build
+	// files must work with. When set with -go_minimum_rules_go, it's used
+	// instead of rulesGoVersion to decide which features to generate.
+	minimumRulesGo version.Version
+
+	// featureFlags enables or disables features from rulesGoFeatures
+	// regardless of the rules_go version. Set with -go_feature_flags.
+	featureFlags map[string]bool
+
+	// skippedFeatures records features that weren't generated because of the
+	// rules_go version, so each is reported once. It's shared by all
+	// directories.
+	skippedFeatures map[string]bool
+
 	// genericTags is a set of tags that Gazelle considers to be true. Set with
 	// -build_tags or # gazelle:build_tags. Some tags, like gc, are always on.
 	genericTags map[string]bool
@@ -68,17 +84,55 @@ type goConfig struct {
 	prefixSet bool
 
 	// importMapPrefix is a prefix of a package path, used to generate importmap
-	// attributes. Set with # gazelle:importmap_prefix.
+	// attributes. Set with # gazelle:go_importmap_prefix.
 	importMapPrefix string
 
 	// importMapPrefixRel is the package name of the directory where importMapPrefix
 	// was set ("" for the root directory).
 	importMapPrefixRel string
 
+	// importMapPrefixSet indicates importMapPrefix was set explicitly with a
+	// directive. An explicit prefix applies to vendor directories below it
+	// instead of the prefix inferred from the vendor directory's location.
+	importMapPrefixSet bool
+
 	// depMode determines how imports that are not standard, indexed, or local
 	// (under the current prefix) should be resolved.
 	depMode dependencyMode
 
+	// groupDeps indicates whether deps should be grouped by category:
+	// golang.org/x repositories, then targets in this repository, then
+	// other repositories. Set with # gazelle:go_group_deps.
+	groupDeps bool
+
+	// goSelect maps attributes to whether they're set with select expressions
+	// when their values depend on the platform. Attributes that aren't listed
+	// use the default. Set with # gazelle:go_select.
+	goSelect map[string]bool
+
+	// buildTagSettings maps custom build tags to labels of config_settings.
+	// Files with build constraints that depend on one of these tags are
+	// listed in select expressions with the config_setting as the condition.
+	// Set with # gazelle:go_build_tag.
+	buildTagSettings map[string]string
+
+	// aliasDeprecation is the deprecation message set on the go_default_library
+	// aliases generated with the import_alias naming convention. Set with
+	// # gazelle:go_alias_deprecation.
+	aliasDeprecation string
+
+	// aliasSunset indicates whether go_default_library aliases generated with
+	// the import_alias naming convention are deleted once no indexed rule
+	// refers to them. Set with # gazelle:go_alias_sunset.
+	aliasSunset bool
+
+	// strictDeps indicates whether imports that can't be resolved to an
+	// indexed rule, a known repository, or the standard library are errors
+	// that make Gazelle exit without writing build files, rather than being
+	// resolved to a label in a repository named by convention. Set with
+	// -strict_deps or # gazelle:strict_deps.
+	strictDeps bool
+
 	// goGenerateProto indicates whether to generate go_proto_library
 	goGenerateProto bool
 
@@ -101,15 +155,66 @@ type goConfig struct {
 	// goGrpcCompilersSet indicates whether goGrpcCompiler was set explicitly.
 	goGrpcCompilersSet bool
 
+	// goProtoCompilerOverrides and goGrpcCompilerOverrides replace
+	// goProtoCompilers and goGrpcCompilers for proto packages matching their
+	// patterns. They're set with pattern=label entries in the
+	// go_proto_compilers and go_grpc_compilers directives.
+	goProtoCompilerOverrides, goGrpcCompilerOverrides []compilerOverride
+
 	// goRepositoryMode is true if Gazelle was invoked by a go_repository rule.
 	// In this mode, we won't go out to the network to resolve external deps.
 	goRepositoryMode bool
 
 	// By default, internal packages are only visible to its siblings.
 	// goVisibility adds a list of packages the internal packages should be
-	// visible to
+	// visible to. Labels accumulate from parent directories; clone caps the
+	// slice so that appends in one subtree are not seen in another.
 	goVisibility []string
 
+	// goVendorVisibility replaces //visibility:public on rules generated in
+	// vendor directories when it's set. It's nil by default.
+	goVendorVisibility []string
+
+	// ignoredDeps lists import paths set with ignore_dep directives.
+	// Dependencies aren't resolved for these imports, so they're left out of
+	// deps. Like goVisibility, paths accumulate from parent directories.
+	ignoredDeps []string
+
+	// goInternalFriends lists repository names (without "@") that internal
+	// packages should be visible to. When non-nil, it replaces the repos
+	// Gazelle would otherwise find by matching import path prefixes.
+	goInternalFriends []string
+
+	// generatedSrcs maps directories to Go files generated at build time that
+	// Gazelle can't discover from rules in build files. It's loaded from the
+	// file named by -go_generated_srcs_manifest and shared by all
+	// directories.
+	generatedSrcs         map[string][]generatedSrc
+	generatedSrcsManifest string
+
+	// fileMetadata maps directories to Go files whose metadata is provided
+	// by other extensions with SetFileMetadata or loaded from the file named
+	// by -go_file_metadata_manifest. Files in those directories aren't
+	// parsed. It's shared by all directories.
+	fileMetadata         map[string][]FileMetadata
+	fileMetadataManifest string
+
+	// externalRepos lists the external Go repositories that exist, loaded
+	// from the file or directory named by -go_external_repos. When set,
+	// imports from other repositories are resolved with it instead of the
+	// remote cache. It's shared by all directories.
+	externalRepos     *externalRepos
+	externalReposPath string
+
+	// roots memoizes the repository roots of imported packages looked up in
+	// the remote cache. It's shared by all directories.
+	roots *rootCache
+
+	// root holds the configuration computed when the repository root is
+	// first configured. It's shared by all directories, so the root may be
+	// configured again for gazelle:reset without replacing it.
+	root *rootConfig
+
 	// moduleMode is true if the current directory is intended to be built
 	// as part of a module. Minimal module compatibility won't be supported
 	// if this is true in the root directory. External dependencies may be
@@ -120,6 +225,30 @@ type goConfig struct {
 	// attribute.
 	repoNamingConvention map[string]namingConvention
 
+	// workModules lists the modules in use directives of the go.work file at
+	// the repository root, if there is one. Each module sets the prefix in
+	// its directory, and imports within those modules are resolved to local
+	// labels. It's set in the root directory and shared by all directories.
+	workModules []workModule
+
+	// moduleBoundaries indicates that each go.mod file below the repository
+	// root starts a separate module. Each module sets the prefix in its
+	// directory, and imports aren't resolved to local labels in other modules
+	// unless both are listed in the go.work file.
+	// Set with # gazelle:go_module_boundaries.
+	moduleBoundaries bool
+
+	// moduleRoots finds the go.mod files in the repository when
+	// moduleBoundaries is set. It's created in the root directory and shared
+	// by all directories.
+	moduleRoots *moduleRoots
+
+	// libraryNames maps directories to the names pinned with
+	// # gazelle:go_library_name in them. It's created in the root directory
+	// and shared by all directories, so imports of those directories resolve
+	// to the pinned name without the index.
+	libraryNames map[string]string
+
 	// submodules is a list of modules which have the current module's path
 	// as a prefix of their own path. This affects visibility attributes
 	// in internal packages.
@@ -128,21 +257,83 @@ type goConfig struct {
 	// testMode determines how go_test targets are generated.
 	testMode testMode
 
+	// platformDirs indicates whether directory names that match a known GOOS
+	// or GOARCH constrain the files in those directories, as if the files had
+	// the corresponding _GOOS or _GOARCH suffix. Only directories below
+	// platformDirsRel are considered. Set with # gazelle:go_platform_dirs.
+	platformDirs    bool
+	platformDirsRel string
+
+	// goLibraryName is the name of the go_library generated in the current
+	// directory, overriding the naming convention. Unlike most settings, it
+	// is not inherited by subdirectories. Set with # gazelle:go_library_name.
+	goLibraryName string
+
+	// goGenerateFuzzTargets indicates whether a separate go_test should be
+	// generated for each native fuzz target (FuzzXxx function) in test files.
+	// Set with # gazelle:go_generate_fuzz_targets.
+	goGenerateFuzzTargets bool
+
+	// goGenerateFuzzTargetsSet indicates whether go_generate_fuzz_targets was
+	// set in this directory or a parent, so existing fuzz test targets may
+	// have been generated by Gazelle.
+	goGenerateFuzzTargetsSet bool
+
+	// excludedOS is the set of operating systems left out of generated
+	// select expressions. Files that only build on these operating systems
+	// are left out entirely. Set with # gazelle:go_exclude_os.
+	excludedOS map[string]bool
+
+	// goTestTagTargets lists build tags that get their own go_test. Test
+	// files that require one of these tags are built by a separate go_test
+	// instead of the regular one. Set with # gazelle:go_test_tag_targets.
+	goTestTagTargets []string
+
+	// goTestName is a template for the name of the go_test generated for a
+	// package, overriding the naming convention. "{dirname}" is replaced
+	// with the name of the package's directory. Set with
+	// # gazelle:go_test_name.
+	goTestName string
+
+	// goTestSuite is a template for the name of a test_suite generated in
+	// each directory with Go tests, listing all the go_test rules generated
+	// there. It's expanded like goTestName. No test_suite is generated if
+	// it's empty. Set with # gazelle:go_test_suite.
+	goTestSuite string
+
+	// goTestShardCount is the shard_count set on generated go_test rules.
+	// It's 0 if shard_count is not managed, or autoShardCount if it's
+	// computed from the number of test functions. Set with
+	// # gazelle:go_test_shard_count.
+	goTestShardCount int
+
+	// testonlyPaths matches the slash-separated, repository-relative paths
+	// of packages whose go_library and go_test rules are testonly. It's nil
+	// if testonly is not added. Set with # gazelle:go_testonly_paths.
+	testonlyPaths *regexp.Regexp
+
 	// buildDirectives, buildExternalAttr, buildExtraArgsAttr,
 	// buildFileGenerationAttr, buildFileNamesAttr, buildFileProtoModeAttr and
 	// buildTagsAttr are attributes for go_repository rules, set on the command
 	// line.
 	buildDirectivesAttr, buildExternalAttr, buildExtraArgsAttr, buildFileGenerationAttr, buildFileNamesAttr, buildFileProtoModeAttr, buildTagsAttr string
+
+	// compatLevel is the version of Go the repository is built with, set
+	// with -compat_level. If set, update-repos reports imported modules that
+	// require a newer version.
+	compatLevel version.Version
 }
 
 // testMode determines how go_test rules are generated.
 type testMode int
 
 const (
-	// defaultTestMode generates a go_test for the primary package in a directory.
+	// defaultTestMode generates a go_test for the primary package in a
+	// directory. It's set with "per_package", or "default" for go_test.
 	defaultTestMode = iota
 
-	// fileTestMode generates a go_test for each Go test file.
+	// fileTestMode generates a go_test for each Go test file. It's set with
+	// "per_file", or "file" for go_test.
 	fileTestMode
 )
 
@@ -151,22 +342,90 @@ var (
 	defaultGoGrpcCompilers  = []string{"@io_bazel_rules_go//proto:go_grpc"}
 )
 
+const (
+	// grpcGatewayCompiler is added to go_proto_library compilers for packages
+	// with google.api.http annotations when proto_grpc_gateway is enabled.
+	grpcGatewayCompiler = "@com_github_grpc_ecosystem_grpc_gateway_v2//protoc-gen-grpc-gateway:go_gen_grpc_gateway"
+
+	// protoValidateCompiler is added to go_proto_library compilers for
+	// packages with validate options when proto_validate is enabled.
+	protoValidateCompiler = "@com_envoyproxy_protoc_gen_validate//:pgv_plugin_go"
+)
+
 func (m testMode) String() string {
 	switch m {
 	case defaultTestMode:
-		return "default"
+		return "per_package"
 	case fileTestMode:
-		return "file"
+		return "per_file"
 	default:
 		return "unknown"
 	}
 }
 
+// autoShardCount is the value of goConfig.goTestShardCount when the shard
+// count is computed from the number of test functions.
+const autoShardCount = -1
+
+// testFuncsPerShard and maxAutoShardCount control the shard count computed
+// for # gazelle:go_test_shard_count auto.
+const (
+	testFuncsPerShard = 10
+	maxAutoShardCount = 50
+)
+
+func shardCountFromString(s string) (int, error) {
+	if s == "auto" {
+		return autoShardCount, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid go_test_shard_count %q: want auto or a positive number", s)
+	}
+	return n, nil
+}
+
+// setAttrMergeable adds or removes attr from the mergeable attributes of kind
+// in c, so Gazelle updates the attribute in existing rules only while it's
+// managed by a directive, like # gazelle:go_test_shard_count.
+func setAttrMergeable(c *config.Config, kind, attr string, mergeable bool) {
+	if c.MergeableAttrs[kind][attr] == mergeable {
+		return
+	}
+	attrs := make(map[string]bool, len(c.MergeableAttrs[kind])+1)
+	for a := range c.MergeableAttrs[kind] {
+		attrs[a] = true
+	}
+	if mergeable {
+		attrs[attr] = true
+	} else {
+		delete(attrs, attr)
+	}
+	if c.MergeableAttrs == nil {
+		c.MergeableAttrs = make(map[string]map[string]bool)
+	}
+	c.MergeableAttrs[kind] = attrs
+}
+
+// vendorVisibilityKinds are the kinds of rules whose visibility is set by
+// # gazelle:go_vendor_visibility.
+var vendorVisibilityKinds = []string{"alias", "go_binary", "go_library", "go_proto_library"}
+
+// isVendored returns whether the directory rel is in a vendor directory.
+func isVendored(rel string) bool {
+	for _, dir := range strings.Split(rel, "/") {
+		if dir == "vendor" {
+			return true
+		}
+	}
+	return false
+}
+
 func testModeFromString(s string) (testMode, error) {
 	switch s {
-	case "default":
+	case "per_package", "default":
 		return defaultTestMode, nil
-	case "file":
+	case "per_file", "file":
 		return fileTestMode, nil
 	default:
 		return 0, fmt.Errorf("unrecognized go_test mode: %q", s)
@@ -178,6 +437,10 @@ func newGoConfig() *goConfig {
 		goProtoCompilers: defaultGoProtoCompilers,
 		goGrpcCompilers:  defaultGoGrpcCompilers,
 		goGenerateProto:  true,
+		skippedFeatures:  make(map[string]bool),
+		fileMetadata:     make(map[string][]FileMetadata),
+		roots:            &rootCache{},
+		root:             &rootConfig{},
 	}
 	gc.preprocessTags()
 	return gc
@@ -196,6 +459,8 @@ func (gc *goConfig) clone() *goConfig {
 	gcCopy.goProtoCompilers = gc.goProtoCompilers[:len(gc.goProtoCompilers):len(gc.goProtoCompilers)]
 	gcCopy.goGrpcCompilers = gc.goGrpcCompilers[:len(gc.goGrpcCompilers):len(gc.goGrpcCompilers)]
 	gcCopy.submodules = gc.submodules[:len(gc.submodules):len(gc.submodules)]
+	gcCopy.goVisibility = gc.goVisibility[:len(gc.goVisibility):len(gc.goVisibility)]
+	gcCopy.ignoredDeps = gc.ignoredDeps[:len(gc.ignoredDeps):len(gc.ignoredDeps)]
 	return &gcCopy
 }
 
@@ -339,6 +604,10 @@ const (
 	// Same as importNamingConvention, but generate alias rules for libraries that have
 	// the legacy 'go_default_library' name.
 	importAliasNamingConvention
+
+	// Same as importNamingConvention, but libraries that embed a
+	// go_proto_library are named with a '_pb' suffix, for example, 'foo_pb'.
+	pbSuffixNamingConvention
 )
 
 func (nc namingConvention) String() string {
@@ -349,6 +618,8 @@ func (nc namingConvention) String() string {
 		return "import"
 	case importAliasNamingConvention:
 		return "import_alias"
+	case pbSuffixNamingConvention:
+		return "pb_suffix"
 	}
 	return ""
 }
@@ -363,6 +634,8 @@ func namingConventionFromString(s string) (namingConvention, error) {
 		return importNamingConvention, nil
 	case "import_alias":
 		return importAliasNamingConvention, nil
+	case "pb_suffix":
+		return pbSuffixNamingConvention, nil
 	default:
 		return unknownNamingConvention, fmt.Errorf("unknown naming convention %q", s)
 	}
@@ -378,18 +651,61 @@ var (
 	validBuildFileProtoModeAttr  = []string{"default", "legacy", "disable", "disable_global", "package"}
 )
 
+// goDirectives declares the Go directives whose values are bools or
+// comma-separated lists. The others have their own syntax, so they're only
+// listed in KnownDirectives.
+var goDirectives = []config.DirectiveInfo{
+	{Name: "go_alias_sunset", Type: config.BoolDirective},
+	{Name: "go_exclude_os", Type: config.ListDirective, AllowEmpty: true},
+	{Name: "go_generate_fuzz_targets", Type: config.BoolDirective},
+	{Name: "go_generate_proto", Type: config.BoolDirective},
+	{Name: "go_group_deps", Type: config.BoolDirective},
+	{Name: "go_internal_friends", Type: config.ListDirective, AllowEmpty: true},
+	{Name: "go_module_boundaries", Type: config.BoolDirective},
+	{Name: "go_platform_dirs", Type: config.BoolDirective},
+	{Name: "go_test_tag_targets", Type: config.ListDirective, AllowEmpty: true},
+	{Name: "go_vendor_visibility", Type: config.ListDirective, AllowEmpty: true},
+	{Name: "ignore_dep", Type: config.ListDirective, AllowEmpty: true},
+	{Name: "strict_deps", Type: config.BoolDirective},
+}
+
+func (*goLang) Directives() []config.DirectiveInfo {
+	return goDirectives
+}
+
 func (*goLang) KnownDirectives() []string {
 	return []string{
 		"build_tags",
+		"go_alias_deprecation",
+		"go_alias_sunset",
+		"go_build_tag",
+		"go_exclude_os",
+		"go_generate_fuzz_targets",
 		"go_generate_proto",
+		"go_group_deps",
 		"go_grpc_compilers",
+		"go_importmap_prefix",
+		"go_internal_friends",
+		"go_library_name",
+		"go_module_boundaries",
 		"go_naming_convention",
 		"go_naming_convention_external",
+		"go_platform_dirs",
 		"go_proto_compilers",
+		"go_select",
 		"go_test",
+		"go_test_mode",
+		"go_test_name",
+		"go_test_shard_count",
+		"go_test_suite",
+		"go_test_tag_targets",
+		"go_testonly_paths",
+		"go_vendor_visibility",
 		"go_visibility",
+		"ignore_dep",
 		"importmap_prefix",
 		"prefix",
+		"strict_deps",
 	}
 }
 
@@ -430,11 +746,36 @@ func (*goLang) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config) {
 		fs.Var(
 			&namingConventionFlag{&gc.goNamingConvention},
 			"go_naming_convention",
-			"controls generated library names. One of (go_default_library, import, import_alias)")
+			"controls generated library names. One of (go_default_library, import, import_alias, pb_suffix)")
 		fs.Var(
 			&namingConventionFlag{&gc.goNamingConventionExternal},
 			"go_naming_convention_external",
 			"controls naming convention used when resolving libraries in external repositories with unknown conventions")
+		fs.Var(
+			&gzflag.PathFlag{Value: &gc.generatedSrcsManifest},
+			"go_generated_srcs_manifest",
+			"JSON file mapping repository-relative paths of Go files generated at build time to their packages' import paths")
+		fs.Var(
+			&gzflag.PathFlag{Value: &gc.fileMetadataManifest},
+			"go_file_metadata_manifest",
+			"JSON file mapping repository-relative paths of Go files to their package names, imports, and embed patterns. Directories with listed files aren't parsed.")
+		fs.Var(
+			&gzflag.PathFlag{Value: &gc.externalReposPath},
+			"go_external_repos",
+			"WORKSPACE file written by go_deps or go_repository_config, or Bazel's external directory containing it. Imports are only resolved to the Go repositories it lists.")
+		fs.Var(
+			&versionFlag{&gc.minimumRulesGo},
+			"go_minimum_rules_go",
+			"oldest version of rules_go that generated build files must work with. Newer features are not generated.")
+		fs.Var(
+			&featureFlagsFlag{&gc.featureFlags},
+			"go_feature_flags",
+			"comma-separated list of features to generate regardless of the rules_go version. Prefix a feature with - to disable it.")
+		fs.BoolVar(
+			&gc.strictDeps,
+			"strict_deps",
+			false,
+			"when true, Go imports that can't be resolved to an indexed rule, a known repository, or the standard library are errors, and no build files are written")
 
 	case "update-repos":
 		fs.StringVar(&gc.buildDirectivesAttr,
@@ -462,6 +803,9 @@ func (*goLang) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config) {
 			"build_tags",
 			"",
 			"Sets the build_tags attribute for the generated go_repository rule(s).")
+		fs.Var(&goVersionFlag{&gc.compatLevel},
+			"compat_level",
+			"version of Go the repository is built with, for example, 1.21. Imported modules that require a newer version are reported.")
 	}
 	c.Exts[goName] = gc
 }
@@ -492,6 +836,47 @@ func (*goLang) CheckFlags(fs *flag.FlagSet, c *config.Config) error {
 		gc.submodules = append(gc.submodules, m)
 	}
 
+	if gc.generatedSrcsManifest != "" {
+		manifestPath := gc.generatedSrcsManifest
+		if !filepath.IsAbs(manifestPath) {
+			manifestPath = filepath.Join(c.WorkDir, manifestPath)
+		}
+		srcs, err := loadGeneratedSrcsManifest(manifestPath)
+		if err != nil {
+			return fmt.Errorf("-go_generated_srcs_manifest: %w", err)
+		}
+		gc.generatedSrcs = srcs
+	}
+
+	if gc.fileMetadataManifest != "" {
+		manifestPath := gc.fileMetadataManifest
+		if !filepath.IsAbs(manifestPath) {
+			manifestPath = filepath.Join(c.WorkDir, manifestPath)
+		}
+		files, err := loadFileMetadataManifest(manifestPath)
+		if err != nil {
+			return fmt.Errorf("-go_file_metadata_manifest: %w", err)
+		}
+		for dir, dirFiles := range files {
+			// Metadata set by other extensions takes precedence.
+			if _, ok := gc.fileMetadata[dir]; !ok {
+				gc.fileMetadata[dir] = dirFiles
+			}
+		}
+	}
+
+	if gc.externalReposPath != "" {
+		p := gc.externalReposPath
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(c.WorkDir, p)
+		}
+		er, err := loadExternalRepos(c, p)
+		if err != nil {
+			return fmt.Errorf("-go_external_repos: %w", err)
+		}
+		gc.externalRepos = er
+	}
+
 	return nil
 }
 
@@ -503,52 +888,18 @@ func (*goLang) Configure(c *config.Config, rel string, f *rule.File) {
 		gc = raw.(*goConfig).clone()
 	}
 	c.Exts[goName] = gc
+	gc.goLibraryName = ""
 
 	if rel == "" {
-		moduleToApparentName, err := module.ExtractModuleToApparentNameMapping(c.RepoRoot)
-		if err != nil {
-			log.Print(err)
-		} else {
-			gc.rulesGoRepoName = moduleToApparentName("rules_go")
-		}
-		if gc.rulesGoRepoName == "" {
-			// The legacy name used in WORKSPACE.
-			gc.rulesGoRepoName = "io_bazel_rules_go"
+		if !gc.root.configured {
+			gc.root.configure(c, gc)
 		}
-
-		const message = `Gazelle may not be compatible with this version of rules_go.
-Update io_bazel_rules_go to a newer version in your WORKSPACE file.`
-		gc.rulesGoVersion, err = findRulesGoVersion(c)
-		if c.ShouldFix {
-			// Only check the version when "fix" is run. Generated build files
-			// frequently work with older version of rules_go, and we don't want to
-			// nag too much since there's no way to disable this warning.
-			// Also, don't print a warning if the rules_go repo hasn't been fetched,
-			// since that's a common issue when Gazelle is run as a separate binary.
-			if err != nil && err != errRulesGoRepoNotFound && c.ShouldFix {
-				log.Printf("%v\n%s", err, message)
-			} else if err == nil && gc.rulesGoVersion.Compare(minimumRulesGoVersion) < 0 {
-				log.Printf("Found RULES_GO_VERSION %s. Minimum compatible version is %s.\n%s", gc.rulesGoVersion, minimumRulesGoVersion, message)
-			}
-		}
-		repoNamingConvention := map[string]namingConvention{}
-		for _, repo := range c.Repos {
-			if repo.Kind() == "go_repository" {
-				if attr := repo.AttrString("build_naming_convention"); attr == "" {
-					// No naming convention specified.
-					// go_repsitory uses importAliasNamingConvention by default, so we
-					// could use whichever name.
-					// resolveExternal should take that as a signal to follow the current
-					// naming convention to avoid churn.
-					repoNamingConvention[repo.Name()] = importAliasNamingConvention
-				} else if nc, err := namingConventionFromString(attr); err != nil {
-					log.Printf("in go_repository named %q: %v", repo.Name(), err)
-				} else {
-					repoNamingConvention[repo.Name()] = nc
-				}
-			}
-		}
-		gc.repoNamingConvention = repoNamingConvention
+		gc.rulesGoRepoName = gc.root.rulesGoRepoName
+		gc.rulesGoVersion = gc.root.rulesGoVersion
+		gc.repoNamingConvention = gc.root.repoNamingConvention
+		gc.workModules = gc.root.workModules
+		gc.moduleRoots = gc.root.moduleRoots
+		gc.libraryNames = gc.root.libraryNames
 	}
 
 	if !gc.moduleMode {
@@ -559,22 +910,109 @@ Update io_bazel_rules_go to a newer version in your WORKSPACE file.`
 	}
 
 	if path.Base(rel) == "vendor" {
-		gc.importMapPrefix = InferImportPath(c, rel)
-		gc.importMapPrefixRel = rel
+		if !gc.importMapPrefixSet {
+			gc.importMapPrefix = InferImportPath(c, rel)
+			gc.importMapPrefixRel = rel
+		}
 		gc.prefix = ""
 		gc.prefixRel = rel
 	}
 
-	if f != nil {
-		setPrefix := func(prefix string) {
-			if err := checkPrefix(prefix); err != nil {
-				log.Print(err)
-				return
+	setPrefix := func(prefix string) {
+		if err := checkPrefix(prefix); err != nil {
+			log.Print(err)
+			return
+		}
+		gc.prefix = prefix
+		gc.prefixSet = true
+		gc.prefixRel = rel
+	}
+
+	// Each module in the go.work file sets the prefix for its directory,
+	// even if a parent directory already set one. A prefix directive in the
+	// same directory or the -go_prefix flag still takes precedence.
+	for _, m := range gc.workModules {
+		if m.rel == rel && (!gc.prefixSet || gc.prefixRel != rel) {
+			setPrefix(m.modulePath)
+			gc.moduleMode = true
+		}
+	}
+
+	// Invalid values of declared directives are reported by walk.
+	for _, d := range config.ParseDirectives(goDirectives, rel, f) {
+		switch d.Name {
+		case "go_alias_sunset":
+			gc.aliasSunset = d.Bool
+
+		case "go_exclude_os":
+			// Special syntax (empty value) to reset directive.
+			if d.Raw == "" {
+				gc.excludedOS = nil
+				continue
+			}
+			excluded := make(map[string]bool)
+			for _, goos := range d.List {
+				if !rule.KnownOSSet[goos] {
+					log.Printf("go_exclude_os: unknown operating system %q", goos)
+					continue
+				}
+				excluded[goos] = true
+			}
+			gc.excludedOS = excluded
+
+		case "go_generate_fuzz_targets":
+			gc.goGenerateFuzzTargets = d.Bool
+			gc.goGenerateFuzzTargetsSet = true
+
+		case "go_generate_proto":
+			gc.goGenerateProto = d.Bool
+
+		case "go_group_deps":
+			gc.groupDeps = d.Bool
+
+		case "go_internal_friends":
+			// Special syntax (empty value) to reset directive.
+			if d.Raw == "" {
+				gc.goInternalFriends = nil
+				continue
+			}
+			gc.goInternalFriends = []string{}
+			for _, friend := range d.List {
+				friend = strings.TrimPrefix(friend, "@")
+				if friend == "" || strings.ContainsAny(friend, "/:") {
+					log.Printf("%s: invalid repository name in go_internal_friends: %q", f.Path, friend)
+					continue
+				}
+				gc.goInternalFriends = append(gc.goInternalFriends, friend)
+			}
+
+		case "go_module_boundaries":
+			gc.moduleBoundaries = d.Bool
+
+		case "go_platform_dirs":
+			gc.platformDirs = d.Bool
+			gc.platformDirsRel = rel
+
+		case "go_test_tag_targets":
+			gc.goTestTagTargets = d.List
+
+		case "go_vendor_visibility":
+			gc.goVendorVisibility = d.List
+
+		case "ignore_dep":
+			// Special syntax (empty value) to reset directive.
+			if d.Raw == "" {
+				gc.ignoredDeps = nil
+				continue
 			}
-			gc.prefix = prefix
-			gc.prefixSet = true
-			gc.prefixRel = rel
+			gc.ignoredDeps = append(gc.ignoredDeps, d.List...)
+
+		case "strict_deps":
+			gc.strictDeps = d.Bool
 		}
+	}
+
+	if f != nil {
 		for _, d := range f.Directives {
 			switch d.Key {
 			case "build_tags":
@@ -587,11 +1025,36 @@ Update io_bazel_rules_go to a newer version in your WORKSPACE file.`
 					log.Print(err)
 				}
 
-			case "go_generate_proto":
-				if goGenerateProto, err := strconv.ParseBool(d.Value); err == nil {
-					gc.goGenerateProto = goGenerateProto
-				} else {
-					log.Printf("parsing go_generate_proto: %v", err)
+			case "go_alias_deprecation":
+				gc.aliasDeprecation = d.Value
+
+			case "go_build_tag":
+				if d.Value == "" {
+					gc.buildTagSettings = nil
+					continue
+				}
+				tag, setting, ok := strings.Cut(d.Value, "=")
+				tag, setting = strings.TrimSpace(tag), strings.TrimSpace(setting)
+				l, err := label.Parse(setting)
+				if !ok || tag == "" || err != nil {
+					log.Printf("%s: invalid go_build_tag directive %q: want tag=label", f.Path, d.Value)
+					continue
+				}
+				settings := make(map[string]string, len(gc.buildTagSettings)+1)
+				for k, v := range gc.buildTagSettings {
+					settings[k] = v
+				}
+				settings[tag] = l.Abs("", rel).String()
+				gc.buildTagSettings = settings
+
+			case "go_library_name":
+				if l, err := label.Parse(":" + d.Value); err != nil || l.Name != d.Value {
+					log.Printf("%s: invalid go_library_name %q", f.Path, d.Value)
+					continue
+				}
+				gc.goLibraryName = d.Value
+				if gc.libraryNames != nil {
+					gc.libraryNames[rel] = d.Value
 				}
 
 			case "go_naming_convention":
@@ -613,22 +1076,49 @@ Update io_bazel_rules_go to a newer version in your WORKSPACE file.`
 				if d.Value == "" {
 					gc.goGrpcCompilersSet = false
 					gc.goGrpcCompilers = defaultGoGrpcCompilers
-				} else {
+					gc.goGrpcCompilerOverrides = nil
+					continue
+				}
+				compilers, overrides, err := parseCompilers(d.Value)
+				if err != nil {
+					log.Printf("%s: go_grpc_compilers: %v", f.Path, err)
+					continue
+				}
+				// A value with only pattern=label entries keeps the inherited
+				// compilers for packages that don't match.
+				if len(compilers) > 0 {
 					gc.goGrpcCompilersSet = true
-					gc.goGrpcCompilers = splitValue(d.Value)
+					gc.goGrpcCompilers = compilers
 				}
+				gc.goGrpcCompilerOverrides = overrides
 
 			case "go_proto_compilers":
 				// Special syntax (empty value) to reset directive.
 				if d.Value == "" {
 					gc.goProtoCompilersSet = false
 					gc.goProtoCompilers = defaultGoProtoCompilers
-				} else {
+					gc.goProtoCompilerOverrides = nil
+					continue
+				}
+				compilers, overrides, err := parseCompilers(d.Value)
+				if err != nil {
+					log.Printf("%s: go_proto_compilers: %v", f.Path, err)
+					continue
+				}
+				if len(compilers) > 0 {
 					gc.goProtoCompilersSet = true
-					gc.goProtoCompilers = splitValue(d.Value)
+					gc.goProtoCompilers = compilers
 				}
+				gc.goProtoCompilerOverrides = overrides
 
-			case "go_test":
+			case "go_select":
+				if goSelect, err := parseGoSelect(d.Value); err == nil {
+					gc.goSelect = goSelect
+				} else {
+					log.Printf("%s: invalid go_select directive: %v", f.Path, err)
+				}
+
+			case "go_test", "go_test_mode":
 				mode, err := testModeFromString(d.Value)
 				if err != nil {
 					log.Print(err)
@@ -636,12 +1126,63 @@ Update io_bazel_rules_go to a newer version in your WORKSPACE file.`
 				}
 				gc.testMode = mode
 
+			case "go_test_shard_count":
+				// Special syntax (empty value) to reset directive.
+				if d.Value == "" {
+					gc.goTestShardCount = 0
+					setAttrMergeable(c, "go_test", "shard_count", false)
+					continue
+				}
+				n, err := shardCountFromString(d.Value)
+				if err != nil {
+					log.Printf("%s: %v", f.Path, err)
+					continue
+				}
+				gc.goTestShardCount = n
+				setAttrMergeable(c, "go_test", "shard_count", true)
+
+			case "go_testonly_paths":
+				// Special syntax (empty value) to reset directive.
+				if d.Value == "" {
+					gc.testonlyPaths = nil
+					continue
+				}
+				re, err := regexp.Compile(d.Value)
+				if err != nil {
+					log.Printf("%s: invalid go_testonly_paths %q: %v", f.Path, d.Value, err)
+					continue
+				}
+				gc.testonlyPaths = re
+
+			case "go_test_name", "go_test_suite":
+				// Special syntax (empty value) to reset directive.
+				if d.Value != "" {
+					name := expandNameTemplate(d.Value, "dir")
+					if l, err := label.Parse(":" + name); err != nil || l.Name != name {
+						log.Printf("%s: invalid %s %q", f.Path, d.Key, d.Value)
+						continue
+					}
+				}
+				if d.Key == "go_test_name" {
+					gc.goTestName = d.Value
+				} else {
+					gc.goTestSuite = d.Value
+					if d.Value != "" {
+						declareTestSuiteMergeable(c)
+					}
+				}
+
 			case "go_visibility":
 				gc.goVisibility = append(gc.goVisibility, strings.TrimSpace(d.Value))
 
-			case "importmap_prefix":
+			case "go_importmap_prefix", "importmap_prefix":
+				// An empty value stops Gazelle from setting importmap until
+				// the next vendor directory. The older importmap_prefix
+				// spelling keeps its old behavior: vendor directories below
+				// it still infer their own prefix.
 				gc.importMapPrefix = d.Value
 				gc.importMapPrefixRel = rel
+				gc.importMapPrefixSet = d.Key == "go_importmap_prefix" && d.Value != ""
 
 			case "prefix":
 				setPrefix(d.Value)
@@ -687,9 +1228,141 @@ Update io_bazel_rules_go to a newer version in your WORKSPACE file.`
 		}
 	}
 
+	// With go_module_boundaries, a nested go.mod file starts a new module, so
+	// it sets the prefix for its directory like an implicit prefix directive.
+	// A prefix directive in the same directory still takes precedence.
+	if gc.moduleBoundaries && rel != "" && gc.moduleRoots != nil && (!gc.prefixSet || gc.prefixRel != rel) {
+		if modulePath, ok := gc.moduleRoots.get()[rel]; ok {
+			setPrefix(modulePath)
+		}
+	}
+
 	if gc.goNamingConvention == unknownNamingConvention {
 		gc.goNamingConvention = detectNamingConvention(c, f)
 	}
+
+	// Existing rules in vendor directories are updated with the visibility
+	// set by go_vendor_visibility. Elsewhere, visibility is left alone.
+	if isVendored(rel) {
+		for _, kind := range vendorVisibilityKinds {
+			setAttrMergeable(c, kind, "visibility", gc.goVendorVisibility != nil)
+		}
+	}
+}
+
+// declareTestSuiteMergeable declares the tests attribute of test_suite
+// mergeable in c, like # gazelle:mergeable_attr test_suite tests, so suites
+// generated for go_test_suite are updated. The Go extension doesn't claim
+// the test_suite kind, since suites are only generated where the directive
+// is set.
+func declareTestSuiteMergeable(c *config.Config) {
+	if c.MergeableAttrs["test_suite"]["tests"] {
+		return
+	}
+	attrs := make(map[string]bool, len(c.MergeableAttrs["test_suite"])+1)
+	for a := range c.MergeableAttrs["test_suite"] {
+		attrs[a] = true
+	}
+	attrs["tests"] = true
+	if c.MergeableAttrs == nil {
+		c.MergeableAttrs = make(map[string]map[string]bool)
+	}
+	c.MergeableAttrs["test_suite"] = attrs
+}
+
+// rootConfig holds the parts of goConfig that are computed when the
+// repository root is configured and shared by all directories.
+type rootConfig struct {
+	configured           bool
+	rulesGoRepoName      string
+	rulesGoVersion       version.Version
+	repoNamingConvention map[string]namingConvention
+	workModules          []workModule
+	moduleRoots          *moduleRoots
+	libraryNames         map[string]string
+}
+
+// configure computes the shared configuration for the repository root.
+// gc is the configuration inherited from flags.
+func (r *rootConfig) configure(c *config.Config, gc *goConfig) {
+	r.configured = true
+	r.rulesGoRepoName = gc.rulesGoRepoName
+	moduleToApparentName, err := module.ExtractModuleToApparentNameMapping(c.RepoRoot)
+	if err != nil {
+		log.Print(err)
+	} else {
+		r.rulesGoRepoName = moduleToApparentName("rules_go")
+	}
+	if r.rulesGoRepoName == "" {
+		// The legacy name used in WORKSPACE.
+		r.rulesGoRepoName = "io_bazel_rules_go"
+	}
+
+	const message = `Gazelle may not be compatible with this version of rules_go.
+Update io_bazel_rules_go to a newer version in your WORKSPACE file.`
+	r.rulesGoVersion, err = findRulesGoVersion(c)
+	if c.ShouldFix {
+		// Only check the version when "fix" is run. Generated build files
+		// frequently work with older version of rules_go, and we don't want to
+		// nag too much since there's no way to disable this warning.
+		// Also, don't print a warning if the rules_go repo hasn't been fetched,
+		// since that's a common issue when Gazelle is run as a separate binary.
+		if err != nil && err != errRulesGoRepoNotFound && c.ShouldFix {
+			log.Printf("%v\n%s", err, message)
+		} else if err == nil && r.rulesGoVersion.Compare(minimumRulesGoVersion) < 0 {
+			log.Printf("Found RULES_GO_VERSION %s. Minimum compatible version is %s.\n%s", r.rulesGoVersion, minimumRulesGoVersion, message)
+		}
+	}
+	repoNamingConvention := map[string]namingConvention{}
+	repos := c.Repos
+	if gc.externalRepos != nil {
+		repos = append(repos[:len(repos):len(repos)], gc.externalRepos.rules...)
+	}
+	for _, repo := range repos {
+		if repo.Kind() == "go_repository" {
+			if attr := repo.AttrString("build_naming_convention"); attr == "" {
+				// No naming convention specified.
+				// go_repsitory uses importAliasNamingConvention by default, so we
+				// could use whichever name.
+				// resolveExternal should take that as a signal to follow the current
+				// naming convention to avoid churn.
+				repoNamingConvention[repo.Name()] = importAliasNamingConvention
+			} else if nc, err := namingConventionFromString(attr); err != nil {
+				log.Printf("in go_repository named %q: %v", repo.Name(), err)
+			} else {
+				repoNamingConvention[repo.Name()] = nc
+			}
+		}
+	}
+	r.repoNamingConvention = repoNamingConvention
+
+	workModules, err := loadWorkModules(c.RepoRoot)
+	if err != nil {
+		log.Print(err)
+	}
+	r.workModules = workModules
+	r.moduleRoots = &moduleRoots{repoRoot: c.RepoRoot}
+	r.libraryNames = make(map[string]string)
+
+}
+
+// platformDirConstraints returns the GOOS and GOARCH implied by the names of
+// the directories between the directory where # gazelle:go_platform_dirs was
+// set and rel. For example, if the directive was set in "internal", then
+// "internal/arch/linux/amd64" implies "linux" and "amd64". Either result may
+// be empty. When several directories match, the innermost one wins.
+func (gc *goConfig) platformDirConstraints(rel string) (goos, goarch string) {
+	if !gc.platformDirs {
+		return "", ""
+	}
+	for _, dir := range strings.Split(pathtools.TrimPrefix(rel, gc.platformDirsRel), "/") {
+		if rule.KnownOSSet[dir] {
+			goos = dir
+		} else if rule.KnownArchSet[dir] {
+			goarch = dir
+		}
+	}
+	return goos, goarch
 }
 
 // checkPrefix checks that a string may be used as a prefix. We forbid local
@@ -702,6 +1375,53 @@ func checkPrefix(prefix string) error {
 	return nil
 }
 
+// isIgnoredDep returns whether imp was named in an ignore_dep directive.
+func (gc *goConfig) isIgnoredDep(imp string) bool {
+	for _, ignored := range gc.ignoredDeps {
+		if imp == ignored {
+			return true
+		}
+	}
+	return false
+}
+
+// parseGoSelect parses the value of a go_select directive, a comma-separated
+// list of attr=on or attr=off entries, for example, "deps=off,srcs=on". An
+// empty value restores the defaults.
+func parseGoSelect(value string) (map[string]bool, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	goSelect := make(map[string]bool)
+	for _, entry := range splitValue(value) {
+		attr, mode, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q: want attr=on or attr=off", entry)
+		}
+		if attr != "deps" && attr != "srcs" {
+			return nil, fmt.Errorf("%q: attribute %q can't be set; want deps or srcs", entry, attr)
+		}
+		switch mode {
+		case "on":
+			goSelect[attr] = true
+		case "off":
+			goSelect[attr] = false
+		default:
+			return nil, fmt.Errorf("%q: want attr=on or attr=off", entry)
+		}
+	}
+	return goSelect, nil
+}
+
+// useSelect returns whether attr should be set with a select expression when
+// its values depend on the platform. dflt is used unless go_select sets attr.
+func (gc *goConfig) useSelect(attr string, dflt bool) bool {
+	if on, ok := gc.goSelect[attr]; ok {
+		return on
+	}
+	return dflt
+}
+
 // splitDirective splits a comma-separated directive value into its component
 // parts, trimming each of any whitespace characters.
 func splitValue(value string) []string {
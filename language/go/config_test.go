@@ -349,3 +349,138 @@ func TestSplitValue(t *testing.T) {
 
 	}
 }
+
+func TestPlatformDirConstraints(t *testing.T) {
+	gc := &goConfig{platformDirs: true, platformDirsRel: "internal"}
+	for _, tc := range []struct {
+		rel, wantOS, wantArch string
+	}{
+		{rel: "internal", wantOS: "", wantArch: ""},
+		{rel: "internal/arch/amd64", wantOS: "", wantArch: "amd64"},
+		{rel: "internal/linux/arm64/x", wantOS: "linux", wantArch: "arm64"},
+		{rel: "internal/darwin/windows", wantOS: "windows", wantArch: ""},
+	} {
+		t.Run(tc.rel, func(t *testing.T) {
+			gotOS, gotArch := gc.platformDirConstraints(tc.rel)
+			if gotOS != tc.wantOS || gotArch != tc.wantArch {
+				t.Errorf("got (%q, %q); want (%q, %q)", gotOS, gotArch, tc.wantOS, tc.wantArch)
+			}
+		})
+	}
+
+	gc.platformDirs = false
+	if gotOS, gotArch := gc.platformDirConstraints("internal/linux/amd64"); gotOS != "" || gotArch != "" {
+		t.Errorf("got (%q, %q) with go_platform_dirs disabled; want empty", gotOS, gotArch)
+	}
+}
+
+func TestGoVisibilitySubtrees(t *testing.T) {
+	c, _, cexts := testConfig(t)
+	configure := func(c *config.Config, rel, content string) *config.Config {
+		c = c.Clone()
+		f, err := rule.LoadData(filepath.FromSlash(rel+"/BUILD.bazel"), rel, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cext := range cexts {
+			cext.Configure(c, rel, f)
+		}
+		return c
+	}
+
+	root := configure(c, "", `
+# gazelle:go_visibility //a:__pkg__
+# gazelle:go_visibility //b:__pkg__
+`)
+	x := configure(root, "x", "# gazelle:go_visibility //c:__pkg__")
+	xy := configure(x, "x/y", "# gazelle:go_visibility //d:__pkg__")
+	xz := configure(x, "x/z", "# gazelle:go_visibility //e:__pkg__")
+
+	for _, tc := range []struct {
+		c    *config.Config
+		want []string
+	}{
+		{root, []string{"//a:__pkg__", "//b:__pkg__"}},
+		{x, []string{"//a:__pkg__", "//b:__pkg__", "//c:__pkg__"}},
+		{xy, []string{"//a:__pkg__", "//b:__pkg__", "//c:__pkg__", "//d:__pkg__"}},
+		{xz, []string{"//a:__pkg__", "//b:__pkg__", "//c:__pkg__", "//e:__pkg__"}},
+	} {
+		if diff := cmp.Diff(tc.want, getGoConfig(tc.c).goVisibility); diff != "" {
+			t.Errorf("(-want, +got): %s", diff)
+		}
+	}
+}
+
+func TestIgnoreDepSubtrees(t *testing.T) {
+	c, _, cexts := testConfig(t)
+	configure := func(c *config.Config, rel, content string) *config.Config {
+		c = c.Clone()
+		f, err := rule.LoadData(filepath.FromSlash(rel+"/BUILD.bazel"), rel, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cext := range cexts {
+			cext.Configure(c, rel, f)
+		}
+		return c
+	}
+
+	root := configure(c, "", "# gazelle:ignore_dep example.com/a")
+	x := configure(root, "x", "# gazelle:ignore_dep example.com/b, example.com/c")
+	y := configure(root, "y", "# gazelle:ignore_dep example.com/d")
+	xz := configure(x, "x/z", "# gazelle:ignore_dep")
+
+	for _, tc := range []struct {
+		c    *config.Config
+		want []string
+	}{
+		{root, []string{"example.com/a"}},
+		{x, []string{"example.com/a", "example.com/b", "example.com/c"}},
+		{y, []string{"example.com/a", "example.com/d"}},
+		{xz, nil},
+	} {
+		if diff := cmp.Diff(tc.want, getGoConfig(tc.c).ignoredDeps); diff != "" {
+			t.Errorf("(-want, +got): %s", diff)
+		}
+	}
+}
+
+func TestVendorConfigExplicitImportMapPrefix(t *testing.T) {
+	c, _, cexts := testConfig(t)
+	gc := getGoConfig(c)
+	gc.prefix = "example.com/repo"
+	gc.prefixRel = ""
+	gc.importMapPrefix = "x/fork"
+	gc.importMapPrefixRel = "fork"
+	gc.importMapPrefixSet = true
+	for _, cext := range cexts {
+		cext.Configure(c, "fork/vendor", nil)
+	}
+	gc = getGoConfig(c)
+	if gc.importMapPrefix != "x/fork" {
+		t.Errorf(`importMapPrefix: got %q; want "x/fork"`, gc.importMapPrefix)
+	}
+	if gc.importMapPrefixRel != "fork" {
+		t.Errorf(`importMapPrefixRel: got %q; want "fork"`, gc.importMapPrefixRel)
+	}
+}
+
+func TestVendorConfigLegacyImportMapPrefix(t *testing.T) {
+	c, _, cexts := testConfig(t)
+	f, err := rule.LoadData(filepath.FromSlash("fork/BUILD.bazel"), "fork", []byte("# gazelle:importmap_prefix x/fork\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cext := range cexts {
+		cext.Configure(c, "fork", f)
+	}
+	if gc := getGoConfig(c); gc.importMapPrefixSet {
+		t.Error("importmap_prefix set importMapPrefixSet; only go_importmap_prefix should")
+	}
+	for _, cext := range cexts {
+		cext.Configure(c, "fork/vendor", nil)
+	}
+	if gc := getGoConfig(c); gc.importMapPrefixRel != "fork/vendor" {
+		t.Errorf(`importMapPrefixRel: got %q; want "fork/vendor"`, gc.importMapPrefixRel)
+	}
+}
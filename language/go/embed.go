@@ -16,6 +16,7 @@ limitations under the License.
 package golang
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -24,9 +25,28 @@ import (
 	"strings"
 	"unicode/utf8"
 
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
 	"golang.org/x/mod/module"
 )
 
+// embedLang is the language used in import specs for files that may be
+// embedded with go:embed. The import string is the file's path appended to
+// the import path of the package directory that contains it, for example,
+// "example.com/repo/assets/logo.png".
+const embedLang = "go_embed"
+
+// unresolvedEmbedsKey is the private attribute that holds go:embed patterns
+// for a generated rule that must be resolved to labels by resolveEmbeds.
+const unresolvedEmbedsKey = "_go_unresolved_embeds"
+
+// errEmbedNoMatch is returned by embedResolver.resolve when a pattern doesn't
+// match any file in the package. The pattern may still be resolved to a
+// target in another package or repository; see resolveEmbeds.
+var errEmbedNoMatch = errors.New("matched no files")
+
 // embedResolver maps go:embed patterns in source files to lists of files that
 // should appear in embedsrcs attributes.
 type embedResolver struct {
@@ -194,11 +214,80 @@ func (er *embedResolver) resolve(embed fileEmbed) (list []string, err error) {
 		visit(f, false)
 	}
 	if len(list) == 0 {
-		return nil, fmt.Errorf("matched no files")
+		return nil, errEmbedNoMatch
 	}
 	return list, nil
 }
 
+// isLiteralEmbedPattern returns whether pattern names a single file, without
+// wildcards. Only such patterns are resolved with the rule index.
+func isLiteralEmbedPattern(pattern string) bool {
+	return !strings.HasPrefix(pattern, "all:") && !strings.ContainsAny(pattern, "*?[\\")
+}
+
+// embedImports returns import specs for files listed in the srcs of a
+// filegroup, so that go:embed patterns in other packages can be resolved to
+// the filegroup.
+func embedImports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
+	importPath := InferImportPath(c, f.Pkg)
+	if importPath == "" {
+		return nil
+	}
+	var specs []resolve.ImportSpec
+	for _, src := range r.AttrStrings("srcs") {
+		if strings.HasPrefix(src, ":") || strings.HasPrefix(src, "//") || strings.HasPrefix(src, "@") || !fsValidPath(src) {
+			continue
+		}
+		specs = append(specs, resolve.ImportSpec{Lang: embedLang, Imp: path.Join(importPath, src)})
+	}
+	return specs
+}
+
+// resolveEmbeds resolves go:embed patterns that didn't match files in the
+// package of r to labels, using overrides, the rule index, and cross-language
+// resolvers, and adds the labels to embedsrcs. This allows embedding files
+// from other packages and other repositories. Patterns that can't be resolved
+// are logged.
+func resolveEmbeds(c *config.Config, ix *resolve.RuleIndex, r *rule.Rule, embeds []fileEmbed, from label.Label) {
+	importPath := r.AttrString("importpath")
+	if importPath == "" {
+		importPath = InferImportPath(c, from.Pkg)
+	}
+	var labels []string
+	for _, embed := range embeds {
+		spec := resolve.ImportSpec{Lang: embedLang, Imp: path.Join(importPath, embed.path)}
+		l, ok := resolve.FindRuleWithOverride(c, spec, goName)
+		if !ok && ix != nil {
+			switch matches := ix.FindRulesByImportWithConfig(c, spec, goName); len(matches) {
+			case 0:
+			case 1:
+				l, ok = matches[0].Label, true
+			default:
+				log.Printf("%v: pattern %s: multiple rules provide %s: %v and %v", embed.pos, embed.path, spec.Imp, matches[0].Label, matches[1].Label)
+				continue
+			}
+		}
+		if !ok {
+			log.Printf("%v: pattern %s: %v", embed.pos, embed.path, errEmbedNoMatch)
+			continue
+		}
+		labels = append(labels, l.Rel(from.Repo, from.Pkg).String())
+	}
+	if len(labels) == 0 {
+		return
+	}
+
+	if r.Attr("embedsrcs") != nil {
+		existing := r.AttrStrings("embedsrcs")
+		if existing == nil {
+			log.Printf("%s: can't add resolved embedsrcs %v to a platform-specific expression", from, labels)
+			return
+		}
+		labels = append(existing, labels...)
+	}
+	r.SetAttr("embedsrcs", rule.SortedStrings(labels))
+}
+
 // Copied from cmd/go/internal/load.validEmbedPattern.
 func validEmbedPattern(pattern string) bool {
 	return pattern != "." && fsValidPath(pattern)
@@ -0,0 +1,176 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golang
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// repoConfigName is the name of the repository generated by go_deps and
+// go_repository_config. Its WORKSPACE file declares a go_repository rule with
+// the name and import path of each Go repository that exists.
+const repoConfigName = "bazel_gazelle_go_repository_config"
+
+// externalRepos indexes the external Go repositories that exist, loaded from
+// the file or directory named by -go_external_repos. Modules pruned by
+// minimal version selection aren't listed, so imports from them aren't
+// resolved to repositories that would fail to load.
+type externalRepos struct {
+	// path is the file the repositories were loaded from.
+	path string
+
+	// rules are the go_repository rules declared in path.
+	rules []*rule.Rule
+
+	// repos maps the import path of each repository to its name. It's built
+	// once when the file is loaded, so each import is resolved by walking its
+	// path elements rather than by comparing it with every repository.
+	repos importPathTrie
+}
+
+// loadExternalRepos reads the go_repository rules in the WORKSPACE file
+// written by go_deps or go_repository_config. p may name the file itself, or
+// Bazel's external directory (output_base/external), which is searched for
+// the repository that contains it.
+func loadExternalRepos(c *config.Config, p string) (*externalRepos, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		if p, err = findRepoConfig(p); err != nil {
+			return nil, err
+		}
+	}
+	f, err := rule.LoadWorkspaceFile(p, "")
+	if err != nil {
+		return nil, err
+	}
+
+	er := &externalRepos{path: p}
+	for _, r := range f.Rules {
+		importPath := r.AttrString("importpath")
+		if r.Kind() != "go_repository" || importPath == "" {
+			continue
+		}
+		name := r.Name()
+		if c.ModuleToApparentName != nil {
+			if apparentName := c.ModuleToApparentName(r.AttrString("module_name")); apparentName != "" {
+				name = apparentName
+			}
+		}
+		er.rules = append(er.rules, r)
+		er.repos.add(importPath, name)
+	}
+	return er, nil
+}
+
+// findRepoConfig returns the path of the WORKSPACE file in the repository
+// config in Bazel's external directory dir. With Bzlmod, the repository's
+// directory has a canonical name like
+// "gazelle++go_deps+bazel_gazelle_go_repository_config", so any directory
+// whose name ends with the repository name is accepted.
+func findRepoConfig(dir string) (string, error) {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var found []string
+	for _, ent := range ents {
+		name := ent.Name()
+		if name == repoConfigName || strings.HasSuffix(name, "+"+repoConfigName) || strings.HasSuffix(name, "~"+repoConfigName) {
+			p := filepath.Join(dir, name, "WORKSPACE")
+			if _, err := os.Stat(p); err == nil {
+				found = append(found, p)
+			}
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("%s: no %s repository found; run a build that uses go_deps or go_repository first", dir, repoConfigName)
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("%s: multiple %s repositories found: %s", dir, repoConfigName, strings.Join(found, ", "))
+	}
+}
+
+// root returns the import path prefix and name of the repository that
+// provides the package imp. It's used instead of the heuristics and network
+// lookups of repo.RemoteCache. An error is returned if no listed repository
+// provides imp.
+func (er *externalRepos) root(imp string) (string, string, error) {
+	prefix, name := er.repos.longestPrefix(imp)
+	if prefix == "" {
+		return "", "", fmt.Errorf("import %q is not provided by any Go repository in %s", imp, er.path)
+	}
+	return prefix, name, nil
+}
+
+// importPathTrie maps import paths to repository names. Each node is an
+// element of an import path.
+type importPathTrie struct {
+	children map[string]*importPathTrie
+
+	// name is the name of the repository whose import path ends at this
+	// node, or "" if there's none.
+	name string
+}
+
+func (t *importPathTrie) add(importPath, name string) {
+	n := t
+	for _, elem := range strings.Split(importPath, "/") {
+		child, ok := n.children[elem]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[string]*importPathTrie)
+			}
+			child = &importPathTrie{}
+			n.children[elem] = child
+		}
+		n = child
+	}
+	n.name = name
+}
+
+// longestPrefix returns the longest import path in t that is imp or a
+// parent of imp, and the name of its repository. It returns empty strings
+// if there's none.
+func (t *importPathTrie) longestPrefix(imp string) (prefix, name string) {
+	n := t
+	rest, end := imp, 0
+	for {
+		elem, tail, more := strings.Cut(rest, "/")
+		if n = n.children[elem]; n == nil {
+			break
+		}
+		end += len(elem)
+		if n.name != "" {
+			prefix, name = imp[:end], n.name
+		}
+		if !more {
+			break
+		}
+		rest, end = tail, end+1
+	}
+	return prefix, name
+}
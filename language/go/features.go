@@ -0,0 +1,129 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golang
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/internal/version"
+)
+
+// rulesGoFeatures maps features Gazelle may generate, usually attributes, to
+// the first version of rules_go that supports them. Features that aren't
+// listed are supported by every compatible version of rules_go.
+var rulesGoFeatures = map[string]version.Version{
+	"embedsrcs":          {0, 27, 0},
+	"importpath_aliases": {0, 19, 0},
+}
+
+// supportsFeature returns whether Gazelle may generate the named feature from
+// rulesGoFeatures. -go_feature_flags takes precedence. Otherwise, the
+// feature must be supported by the version set with -go_minimum_rules_go or,
+// if that's not set, the version of rules_go found in the workspace. When
+// neither version is known, all features are generated.
+//
+// The first time a feature is skipped because of its version, a message
+// explains why, so users aren't surprised by missing attributes.
+func (gc *goConfig) supportsFeature(feature string) bool {
+	if enabled, ok := gc.featureFlags[feature]; ok {
+		return enabled
+	}
+	v, source := gc.minimumRulesGo, "-go_minimum_rules_go"
+	if len(v) == 0 {
+		v, source = gc.rulesGoVersion, "the version of rules_go in use"
+	}
+	since := rulesGoFeatures[feature]
+	if len(v) == 0 || v.Compare(since) >= 0 {
+		return true
+	}
+	if !gc.skippedFeatures[feature] {
+		gc.skippedFeatures[feature] = true
+		log.Printf("not generating %s: it requires rules_go %s, and %s is %s. Set -go_feature_flags=%s to generate it anyway.", feature, since, source, v, feature)
+	}
+	return false
+}
+
+// versionFlag is a flag.Value that parses a version like "0.50.1".
+type versionFlag struct {
+	v *version.Version
+}
+
+func (f versionFlag) Set(value string) error {
+	v, err := version.ParseVersion(value)
+	if err != nil {
+		return err
+	}
+	*f.v = v
+	return nil
+}
+
+func (f *versionFlag) String() string {
+	if f == nil || f.v == nil {
+		return ""
+	}
+	return f.v.String()
+}
+
+// featureFlagsFlag is a flag.Value that parses a comma-separated list of
+// feature names from rulesGoFeatures. A name enables its feature regardless
+// of the rules_go version; a name prefixed with "-" disables it.
+type featureFlagsFlag struct {
+	flags *map[string]bool
+}
+
+func (f featureFlagsFlag) Set(value string) error {
+	flags := make(map[string]bool)
+	for _, name := range splitValue(value) {
+		if name == "" {
+			continue
+		}
+		enabled := true
+		if strings.HasPrefix(name, "-") {
+			name, enabled = name[1:], false
+		} else {
+			name = strings.TrimPrefix(name, "+")
+		}
+		if _, ok := rulesGoFeatures[name]; !ok {
+			known := make([]string, 0, len(rulesGoFeatures))
+			for k := range rulesGoFeatures {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown feature %q; known features are %s", name, strings.Join(known, ", "))
+		}
+		flags[name] = enabled
+	}
+	*f.flags = flags
+	return nil
+}
+
+func (f *featureFlagsFlag) String() string {
+	if f == nil || f.flags == nil {
+		return ""
+	}
+	var names []string
+	for name, enabled := range *f.flags {
+		if !enabled {
+			name = "-" + name
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,88 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golang
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/internal/version"
+)
+
+func TestSupportsFeature(t *testing.T) {
+	for _, tc := range []struct {
+		desc                           string
+		rulesGoVersion, minimumRulesGo version.Version
+		featureFlags                   map[string]bool
+		want                           bool
+	}{
+		{
+			desc: "unknown_version",
+			want: true,
+		}, {
+			desc:           "detected_new",
+			rulesGoVersion: version.Version{0, 50, 1},
+			want:           true,
+		}, {
+			desc:           "detected_old",
+			rulesGoVersion: version.Version{0, 26, 0},
+			want:           false,
+		}, {
+			desc:           "minimum_overrides_detected",
+			rulesGoVersion: version.Version{0, 50, 1},
+			minimumRulesGo: version.Version{0, 26, 0},
+			want:           false,
+		}, {
+			desc:           "flag_enables",
+			rulesGoVersion: version.Version{0, 26, 0},
+			featureFlags:   map[string]bool{"embedsrcs": true},
+			want:           true,
+		}, {
+			desc:           "flag_disables",
+			rulesGoVersion: version.Version{0, 50, 1},
+			featureFlags:   map[string]bool{"embedsrcs": false},
+			want:           false,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			gc := newGoConfig()
+			gc.rulesGoVersion = tc.rulesGoVersion
+			gc.minimumRulesGo = tc.minimumRulesGo
+			gc.featureFlags = tc.featureFlags
+			if got := gc.supportsFeature("embedsrcs"); got != tc.want {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFeatureFlagsFlag(t *testing.T) {
+	var flags map[string]bool
+	f := &featureFlagsFlag{&flags}
+	if err := f.Set("embedsrcs, -importpath_aliases"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"embedsrcs": true, "importpath_aliases": false}
+	if !reflect.DeepEqual(flags, want) {
+		t.Errorf("got %v; want %v", flags, want)
+	}
+	if got, want := f.String(), "-importpath_aliases,embedsrcs"; got != want {
+		t.Errorf("got String() %q; want %q", got, want)
+	}
+	if err := f.Set("go_grpc_library"); err == nil {
+		t.Error("unknown feature: got nil error; want error")
+	}
+}
@@ -0,0 +1,123 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golang
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+)
+
+// FileMetadata describes a Go source file whose contents are known without
+// parsing it, for example because the file is produced by another build
+// step and doesn't exist yet.
+type FileMetadata struct {
+	// Name is the base name of the file within its directory, for example,
+	// "foo.go" or "foo_test.go". Build constraints in the name are applied.
+	Name string `json:"name"`
+
+	// Package is the name in the file's package clause. For external test
+	// files, it ends with "_test".
+	Package string `json:"package"`
+
+	// Imports lists the import paths of packages the file imports.
+	Imports []string `json:"imports,omitempty"`
+
+	// Embeds lists the patterns in the file's //go:embed directives.
+	Embeds []string `json:"embeds,omitempty"`
+}
+
+// SetFileMetadata tells the Go extension to use files instead of the .go
+// files in the directory rel, which is slash-separated and relative to the
+// repository root. Files in the directory aren't parsed.
+//
+// Other extensions may call SetFileMetadata from their CheckFlags or
+// Configure methods. It must be called before rules are generated for rel.
+// Metadata is shared by all directories, so it may be set for directories
+// other than the one being configured.
+func SetFileMetadata(c *config.Config, rel string, files []FileMetadata) {
+	gc := getGoConfig(c)
+	gc.fileMetadata[rel] = append([]FileMetadata(nil), files...)
+}
+
+// loadFileMetadataManifest reads a JSON object mapping slash-separated,
+// repository-relative paths of Go files to their metadata. The name field of
+// each file's metadata is ignored. The result maps each directory to the
+// files within it, sorted by name.
+func loadFileMetadataManifest(manifestPath string) (map[string][]FileMetadata, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var manifest map[string]FileMetadata
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestPath, err)
+	}
+
+	files := make(map[string][]FileMetadata)
+	for p, md := range manifest {
+		if path.IsAbs(p) || p != path.Clean(p) || p == ".." || strings.HasPrefix(p, "../") {
+			return nil, fmt.Errorf("%s: %q is not a clean path relative to the repository root", manifestPath, p)
+		}
+		if !strings.HasSuffix(p, ".go") {
+			return nil, fmt.Errorf("%s: %q is not a .go file", manifestPath, p)
+		}
+		if md.Package == "" {
+			return nil, fmt.Errorf("%s: no package name for %q", manifestPath, p)
+		}
+		dir := path.Dir(p)
+		if dir == "." {
+			dir = ""
+		}
+		md.Name = path.Base(p)
+		files[dir] = append(files[dir], md)
+	}
+	for _, dirFiles := range files {
+		sort.Slice(dirFiles, func(i, j int) bool { return dirFiles[i].Name < dirFiles[j].Name })
+	}
+	return files, nil
+}
+
+// fileInfo returns information about the file described by md in the
+// directory dir, like goFileInfo would if it parsed the file. Since there's
+// no source, files in package main are assumed to have a main function, and
+// test files aren't sharded by their number of test functions.
+func (md FileMetadata) fileInfo(dir string) fileInfo {
+	info := fileNameInfo(filepath.Join(dir, md.Name))
+	info.packageName = md.Package
+	if info.isTest && strings.HasSuffix(info.packageName, "_test") {
+		info.packageName = info.packageName[:len(info.packageName)-len("_test")]
+		info.isExternalTest = true
+	}
+	info.hasMainFunction = info.packageName == "main"
+	for _, imp := range md.Imports {
+		if imp == "C" {
+			info.isCgo = true
+			continue
+		}
+		info.imports = append(info.imports, imp)
+	}
+	for _, pattern := range md.Embeds {
+		info.embeds = append(info.embeds, fileEmbed{path: pattern})
+	}
+	return info
+}
@@ -0,0 +1,80 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golang
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadFileMetadataManifest(t *testing.T) {
+	for _, tc := range []struct {
+		desc, manifest string
+		want           map[string][]FileMetadata
+		wantErr        string
+	}{
+		{
+			desc: "ok",
+			manifest: `{
+  "a/z.go": {"package": "a", "imports": ["example.com/b"]},
+  "a/b.go": {"name": "ignored.go", "package": "a", "embeds": ["*.txt"]},
+  "root.go": {"package": "root"}
+}`,
+			want: map[string][]FileMetadata{
+				"a": {
+					{Name: "b.go", Package: "a", Embeds: []string{"*.txt"}},
+					{Name: "z.go", Package: "a", Imports: []string{"example.com/b"}},
+				},
+				"": {{Name: "root.go", Package: "root"}},
+			},
+		}, {
+			desc:     "not_relative",
+			manifest: `{"../a.go": {"package": "a"}}`,
+			wantErr:  "not a clean path",
+		}, {
+			desc:     "not_go",
+			manifest: `{"a/a.proto": {"package": "a"}}`,
+			wantErr:  "not a .go file",
+		}, {
+			desc:     "no_package",
+			manifest: `{"a/a.go": {}}`,
+			wantErr:  "no package name",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "manifest.json")
+			if err := os.WriteFile(path, []byte(tc.manifest), 0o666); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadFileMetadataManifest(path)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v; want error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %#v; want %#v", got, tc.want)
+			}
+		})
+	}
+}
@@ -23,8 +23,10 @@ import (
 	"go/parser"
 	"go/token"
 	"log"
+	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
@@ -85,6 +87,14 @@ type fileInfo struct {
 
 	// hasServices indicates whether a .proto file has service definitions.
 	hasServices bool
+
+	// fuzzFuncs is a list of native fuzz targets (functions named FuzzXxx
+	// that accept a *testing.F) declared in a test file.
+	fuzzFuncs []string
+
+	// testFuncs is the number of test functions (functions named TestXxx
+	// that accept a *testing.T) declared in a test file.
+	testFuncs int
 }
 
 // fileEmbed represents an individual go:embed pattern.
@@ -187,6 +197,27 @@ func fileNameInfo(path_ string) fileInfo {
 	}
 }
 
+// applyPlatformDir constrains a file to the GOOS and GOARCH implied by the
+// name of the directory containing it (see goConfig.platformDirConstraints),
+// as if the file name had the corresponding suffixes. Files with suffixes
+// that conflict with the directory are never buildable.
+func (info *fileInfo) applyPlatformDir(goos, goarch string) {
+	if goos != "" {
+		if info.goos == "" {
+			info.goos = goos
+		} else if info.goos != goos {
+			info.ext = unknownExt
+		}
+	}
+	if goarch != "" {
+		if info.goarch == "" {
+			info.goarch = goarch
+		} else if info.goarch != goarch {
+			info.ext = unknownExt
+		}
+	}
+}
+
 // otherFileInfo returns information about a non-.go file. It will parse
 // part of the file to determine build tags. If the file can't be read, an
 // error will be logged, and partial information will be returned.
@@ -210,11 +241,18 @@ func otherFileInfo(path string) fileInfo {
 // If the file can't be read, an error will be logged, and partial information
 // will be returned.
 // This function is intended to match go/build.Context.Import.
+// Test functions are only counted when countTests is true, since that
+// requires parsing the whole file.
 // TODD(#53): extract canonical import path
-func goFileInfo(path, srcdir string) fileInfo {
+func goFileInfo(path, srcdir string, countTests bool) fileInfo {
 	info := fileNameInfo(path)
 	fset := token.NewFileSet()
-	pf, err := parser.ParseFile(fset, info.path, nil, parser.ImportsOnly|parser.ParseComments)
+	src, err := os.ReadFile(info.path)
+	if err != nil {
+		log.Printf("%s: error reading go file: %v", info.path, err)
+		return info
+	}
+	pf, err := parser.ParseFile(fset, info.path, src, parser.ImportsOnly|parser.ParseComments)
 	if err != nil {
 		log.Printf("%s: error reading go file: %v", info.path, err)
 		return info
@@ -274,8 +312,10 @@ func goFileInfo(path, srcdir string) fileInfo {
 	}
 	info.tags = tags
 
-	if importsEmbed || info.packageName == "main" {
-		pf, err = parser.ParseFile(fset, info.path, nil, parser.ParseComments)
+	mayHaveFuzz := info.isTest && bytes.Contains(src, []byte("func Fuzz"))
+	mayHaveTests := countTests && info.isTest && bytes.Contains(src, []byte("func Test"))
+	if importsEmbed || info.packageName == "main" || mayHaveFuzz || mayHaveTests {
+		pf, err = parser.ParseFile(fset, info.path, src, parser.ParseComments)
 		if err != nil {
 			log.Printf("%s: error reading go file: %v", info.path, err)
 			return info
@@ -302,11 +342,18 @@ func goFileInfo(path, srcdir string) fileInfo {
 			}
 		}
 		for _, decl := range pf.Decls {
-			if fdecl, ok := decl.(*ast.FuncDecl); ok {
-				if fdecl.Name.Name == "main" {
-					info.hasMainFunction = true
-					break
-				}
+			fdecl, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			if fdecl.Name.Name == "main" {
+				info.hasMainFunction = true
+			}
+			if mayHaveFuzz && isFuzzFunc(fdecl) {
+				info.fuzzFuncs = append(info.fuzzFuncs, fdecl.Name.Name)
+			}
+			if mayHaveTests && isTestFunc(fdecl) {
+				info.testFuncs++
 			}
 		}
 	}
@@ -314,6 +361,48 @@ func goFileInfo(path, srcdir string) fileInfo {
 	return info
 }
 
+// isFuzzFunc returns whether a function declaration is a native fuzz target,
+// as recognized by "go test": a top-level function named FuzzXxx (where Xxx
+// does not start with a lower case letter) with a single *testing.F parameter.
+func isFuzzFunc(fdecl *ast.FuncDecl) bool {
+	return isTestingFunc(fdecl, "Fuzz", "F")
+}
+
+// isTestFunc returns whether a function declaration is a test function, as
+// recognized by "go test": a top-level function named TestXxx (where Xxx
+// does not start with a lower case letter) with a single *testing.T
+// parameter.
+func isTestFunc(fdecl *ast.FuncDecl) bool {
+	return isTestingFunc(fdecl, "Test", "T")
+}
+
+// isTestingFunc returns whether a function declaration is a top-level
+// function whose name starts with prefix, followed by anything that doesn't
+// start with a lower case letter, with a single parameter of type *T, where T
+// is named typeName.
+func isTestingFunc(fdecl *ast.FuncDecl, prefix, typeName string) bool {
+	name := fdecl.Name.Name
+	if fdecl.Recv != nil || !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	if len(name) > len(prefix) {
+		r, _ := utf8.DecodeRuneInString(name[len(prefix):])
+		if unicode.IsLower(r) {
+			return false
+		}
+	}
+	params := fdecl.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) > 1 {
+		return false
+	}
+	star, ok := params[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == typeName
+}
+
 // saveCgo extracts CFLAGS, CPPFLAGS, CXXFLAGS, and LDFLAGS directives
 // from a comment above a "C" import. This is intended to match logic in
 // go/build.Context.saveCgo.
@@ -533,6 +622,26 @@ func isOSArchSpecific(info fileInfo, cgoTags *cgoTagsAndOpts) (osSpecific, archS
 	return
 }
 
+// customBuildTags returns the tags declared with # gazelle:go_build_tag that
+// the file's build constraints depend on, sorted. Tags set with -build_tags
+// or # gazelle:build_tags are true everywhere, so they're not returned.
+func customBuildTags(c *config.Config, info fileInfo, cgoTags *cgoTagsAndOpts) []string {
+	gc := getGoConfig(c)
+	if len(gc.buildTagSettings) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var custom []string
+	for _, tag := range append(info.tags.tags(), cgoTags.tags()...) {
+		if _, ok := gc.buildTagSettings[tag]; ok && !gc.genericTags[tag] && !seen[tag] {
+			seen[tag] = true
+			custom = append(custom, tag)
+		}
+	}
+	sort.Strings(custom)
+	return custom
+}
+
 // matchesOS checks if a value is equal to either an OS value or to any of its
 // aliases.
 func matchesOS(os, value string) bool {
@@ -564,6 +673,12 @@ func matchesOS(os, value string) bool {
 // is the parsed build tags found near the top of the file. cgoTags
 // is an extra set of tags in a #cgo directive.
 func checkConstraints(c *config.Config, os, arch, osSuffix, archSuffix string, tags *buildTags, cgoTags *cgoTagsAndOpts) bool {
+	return checkConstraintsWithTags(c, os, arch, osSuffix, archSuffix, tags, cgoTags, nil)
+}
+
+// checkConstraintsWithTags is like checkConstraints, but tags in customTags
+// are true or false according to the map instead of genericTags.
+func checkConstraintsWithTags(c *config.Config, os, arch, osSuffix, archSuffix string, tags *buildTags, cgoTags *cgoTagsAndOpts, customTags map[string]bool) bool {
 	if osSuffix != "" && !matchesOS(os, osSuffix) || archSuffix != "" && archSuffix != arch {
 		return false
 	}
@@ -588,6 +703,9 @@ func checkConstraints(c *config.Config, os, arch, osSuffix, archSuffix string, t
 
 		}
 
+		if v, ok := customTags[tag]; ok {
+			return v
+		}
 		return goConf.genericTags[tag]
 	}
 
@@ -605,6 +723,9 @@ func rulesGoSupportsOS(v version.Version, os string) bool {
 		(os == "aix" || os == "illumos") {
 		return false
 	}
+	if v.Compare(version.Version{0, 26, 0}) < 0 && os == "ios" {
+		return false
+	}
 	return true
 }
 
@@ -640,6 +761,9 @@ func rulesGoSupportsPlatform(v version.Version, p rule.Platform) bool {
 			p.OS == "windows" && p.Arch == "arm64") {
 		return false
 	}
+	if v.Compare(version.Version{0, 26, 0}) < 0 && p.OS == "ios" {
+		return false
+	}
 	return true
 }
 
@@ -168,6 +168,52 @@ var src string
 				embeds:      []fileEmbed{{path: "embed.go"}},
 			},
 		},
+		{
+			"fuzz",
+			"foo_test.go",
+			`package foo
+
+import "testing"
+
+func FuzzFoo(f *testing.F) {}
+
+func Fuzz(f *testing.F) {}
+
+func Fuzzy(f *testing.F) {}
+
+func FuzzBar(t *testing.T, f *testing.F) {}
+`,
+			fileInfo{
+				packageName: "foo",
+				isTest:      true,
+				imports:     []string{"testing"},
+				fuzzFuncs:   []string{"FuzzFoo", "Fuzz"},
+			},
+		},
+		{
+			"test funcs",
+			"foo_test.go",
+			`package foo
+
+import "testing"
+
+func TestFoo(t *testing.T) {}
+
+func Test(t *testing.T) {}
+
+func Testing(t *testing.T) {}
+
+func TestBar(t *testing.T, x int) {}
+
+func (s suite) TestMethod(t *testing.T) {}
+`,
+			fileInfo{
+				packageName: "foo",
+				isTest:      true,
+				imports:     []string{"testing"},
+				testFuncs:   2,
+			},
+		},
 	} {
 		t.Run(tc.desc, func(t *testing.T) {
 			dir, err := os.MkdirTemp(os.Getenv("TEST_TEMPDIR"), "TestGoFileInfo")
@@ -180,7 +226,7 @@ var src string
 				t.Fatal(err)
 			}
 
-			got := goFileInfo(path, "")
+			got := goFileInfo(path, "", true)
 			// Clear fields we don't care about for testing.
 			got = fileInfo{
 				packageName: got.packageName,
@@ -189,6 +235,8 @@ var src string
 				embeds:      got.embeds,
 				isCgo:       got.isCgo,
 				tags:        got.tags,
+				fuzzFuncs:   got.fuzzFuncs,
+				testFuncs:   got.testFuncs,
 			}
 			for i := range got.embeds {
 				got.embeds[i] = fileEmbed{path: got.embeds[i].path}
@@ -197,7 +245,9 @@ var src string
 			if diff := cmp.Diff(tc.want, got, fileInfoCmpOption); diff != "" {
 				t.Errorf("(-want, +got): %s", diff)
 			}
-
+			if got := goFileInfo(path, "", false).testFuncs; got != 0 {
+				t.Errorf("got %d test functions without counting tests; want 0", got)
+			}
 		})
 	}
 }
@@ -214,7 +264,7 @@ func TestGoFileInfoFailure(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	got := goFileInfo(path, "")
+	got := goFileInfo(path, "", false)
 	want := fileInfo{
 		path:   path,
 		name:   name,
@@ -341,7 +391,7 @@ import ("C")
 				t.Fatal(err)
 			}
 
-			got := goFileInfo(path, "")
+			got := goFileInfo(path, "", false)
 
 			// Clear fields we don't care about for testing.
 			got = fileInfo{
@@ -427,7 +477,7 @@ import "C"
 		t,
 		"-repo_root="+repo,
 		"-go_prefix=example.com/repo")
-	fi := goFileInfo(filepath.Join(sub, "sub.go"), "sub")
+	fi := goFileInfo(filepath.Join(sub, "sub.go"), "sub", false)
 	pkgs, _ := buildPackages(c, sub, "sub", false, nil, []fileInfo{fi})
 	got, ok := pkgs["sub"]
 	if !ok {
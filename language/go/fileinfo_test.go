@@ -599,7 +599,7 @@ import "C"
 				t.Fatal(err)
 			}
 
-			fi := goFileInfo(path, "")
+			fi := goFileInfo(path, "", false)
 			var cgoTags *cgoTagsAndOpts
 			if len(fi.copts) > 0 {
 				cgoTags = fi.copts[0]
@@ -698,7 +698,7 @@ func TestIsOSArchSpecific(t *testing.T) {
 			if err := os.WriteFile(path, []byte(tc.content), 0o666); err != nil {
 				t.Fatal(err)
 			}
-			fi := goFileInfo(path, "")
+			fi := goFileInfo(path, "", false)
 			var cgoTags *cgoTagsAndOpts
 			if len(fi.copts) > 0 {
 				cgoTags = fi.copts[0]
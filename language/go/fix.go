@@ -16,9 +16,12 @@ limitations under the License.
 package golang
 
 import (
+	"fmt"
 	"log"
+	"strings"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/language"
 	"github.com/bazelbuild/bazel-gazelle/language/proto"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 	bzl "github.com/bazelbuild/buildtools/build"
@@ -33,6 +36,7 @@ func (*goLang) Fix(c *config.Config, f *rule.File) {
 	removeLegacyProto(c, f)
 	removeLegacyGazelle(c, f)
 	migrateNamingConvention(c, f)
+	migrateLibraryName(c, f)
 }
 
 // migrateNamingConvention renames rules according to go_naming_convention
@@ -55,12 +59,15 @@ func migrateNamingConvention(c *config.Config, f *rule.File) {
 	case goDefaultLibraryNamingConvention:
 		migrateLibName = libNameByConvention(importNamingConvention, importPath, pkgName)
 		migrateTestName = testNameByConvention(importNamingConvention, importPath)
-	case importNamingConvention, importAliasNamingConvention:
+	case importNamingConvention, importAliasNamingConvention, pbSuffixNamingConvention:
 		migrateLibName = defaultLibName
 		migrateTestName = defaultTestName
 	default:
 		return
 	}
+	if nc == pbSuffixNamingConvention && embedsGoProtoLibrary(f, migrateLibName) {
+		libName = protoLibNameByConvention(nc, importPath, pkgName)
+	}
 
 	// Check whether the new names are in use. If there are rules with both old
 	// and new names, there will be a conflict.
@@ -110,6 +117,68 @@ func migrateNamingConvention(c *config.Config, f *rule.File) {
 	}
 }
 
+// embedsGoProtoLibrary returns whether the go_library named libName in f
+// embeds a go_proto_library declared in f.
+func embedsGoProtoLibrary(f *rule.File, libName string) bool {
+	protoLibs := make(map[string]bool)
+	for _, r := range f.Rules {
+		if r.Kind() == "go_proto_library" {
+			protoLibs[":"+r.Name()] = true
+		}
+	}
+	for _, r := range f.Rules {
+		if r.Kind() != "go_library" || r.Name() != libName {
+			continue
+		}
+		for _, embed := range r.AttrStrings("embed") {
+			if protoLibs[embed] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// migrateLibraryName renames the go_library for the package in f to the name
+// set with the go_library_name directive, and updates references to it
+// within f. References in other packages are updated when their
+// dependencies are resolved.
+func migrateLibraryName(c *config.Config, f *rule.File) {
+	libName := getGoConfig(c).goLibraryName
+	if libName == "" {
+		return
+	}
+	importPath := InferImportPath(c, f.Pkg)
+	if importPath == "" {
+		return
+	}
+	var oldName string
+	for _, r := range f.Rules {
+		if r.Name() == libName {
+			return
+		}
+		if r.Kind() == "go_library" && r.AttrString("importpath") == importPath {
+			if oldName != "" {
+				return
+			}
+			oldName = r.Name()
+		}
+	}
+	if oldName == "" {
+		return
+	}
+	for _, r := range f.Rules {
+		switch r.Kind() {
+		case "go_library":
+			if r.Name() == oldName {
+				r.SetName(libName)
+			}
+		case "go_binary", "go_test":
+			replaceInStrListAttr(r, "embed", ":"+oldName, ":"+libName)
+		}
+	}
+}
+
 // fileContainsGoBinary returns whether the file has a go_binary rule.
 func fileContainsGoBinary(c *config.Config, f *rule.File) bool {
 	if f == nil {
@@ -226,6 +295,7 @@ func squashCgoLibrary(c *config.Config, f *rule.File) {
 		return
 	}
 
+	setBuildTagConditions(c, cgoLibrary)
 	if err := rule.SquashRules(cgoLibrary, goLibrary, f.Path); err != nil {
 		log.Print(err)
 		return
@@ -272,6 +342,7 @@ func squashXtest(c *config.Config, f *rule.File) {
 	}
 
 	// Attempt to squash.
+	setBuildTagConditions(c, xtest)
 	if err := rule.SquashRules(xtest, itest, f.Path); err != nil {
 		log.Print(err)
 		return
@@ -300,25 +371,73 @@ func flattenSrcs(c *config.Config, f *rule.File) {
 	}
 }
 
-// removeLegacyProto removes uses of the old proto rules. It deletes loads
-// from go_proto_library.bzl. It deletes proto filegroups. It removes
-// go_proto_library attributes which are no longer recognized. New rules
-// are generated in place of the deleted rules, but attributes and comments
-// are not migrated.
-func removeLegacyProto(c *config.Config, f *rule.File) {
+// FileFixes implements language.FileFixer.
+func (*goLang) FileFixes() []language.FileFix {
+	return []language.FileFix{{
+		Name:  "legacy_proto",
+		Check: checkLegacyProto,
+		Fix:   removeLegacyProto,
+	}, {
+		Name:  "deprecated_attrs",
+		Check: checkDeprecatedAttrs,
+		Fix:   migrateDeprecatedAttrs,
+	}}
+}
+
+// deprecatedAttrs returns the names of attributes of r that are deprecated
+// by recent versions of rules_go and can be removed by
+// migrateDeprecatedAttrs. Currently, this is importmap on go_binary and
+// go_test, which is ignored, since binaries and tests can't be imported.
+//
+// Attributes with "# keep" comments are left alone.
+func deprecatedAttrs(r *rule.Rule) []string {
+	if r.ShouldKeep() {
+		return nil
+	}
+	var attrs []string
+	switch r.Kind() {
+	case "go_binary", "go_test":
+		if r.Attr("importmap") != nil && !attrShouldKeep(r, "importmap") {
+			attrs = append(attrs, "importmap")
+		}
+	}
+	return attrs
+}
+
+// checkDeprecatedAttrs reports whether rules in f have attributes that
+// migrateDeprecatedAttrs would change.
+func checkDeprecatedAttrs(c *config.Config, f *rule.File) string {
+	var descs []string
+	for _, r := range f.Rules {
+		if attrs := deprecatedAttrs(r); len(attrs) > 0 {
+			descs = append(descs, fmt.Sprintf("%s %q uses deprecated attributes %s", r.Kind(), r.Name(), strings.Join(attrs, ", ")))
+		}
+	}
+	return strings.Join(descs, "; ")
+}
+
+// migrateDeprecatedAttrs removes the attributes listed by deprecatedAttrs.
+func migrateDeprecatedAttrs(c *config.Config, f *rule.File) {
+	for _, r := range f.Rules {
+		for _, key := range deprecatedAttrs(r) {
+			r.DelAttr(key)
+		}
+	}
+}
+
+// legacyProtoDefs returns the loads of the old proto rules and the
+// definitions removeLegacyProto deletes with them.
+func legacyProtoDefs(c *config.Config, f *rule.File) (protoLoads []*rule.Load, protoFilegroups, protoRules []*rule.Rule) {
 	// Don't fix if the proto mode was set to something other than the default.
 	if pcMode := getProtoMode(c); pcMode != proto.DefaultMode {
-		return
+		return nil, nil, nil
 	}
 
-	// Scan for definitions to delete.
-	var protoLoads []*rule.Load
 	for _, l := range f.Loads {
 		if l.Name() == "@io_bazel_rules_go//proto:go_proto_library.bzl" {
 			protoLoads = append(protoLoads, l)
 		}
 	}
-	var protoFilegroups, protoRules []*rule.Rule
 	for _, r := range f.Rules {
 		if r.Kind() == "filegroup" && r.Name() == legacyProtoFilegroupName {
 			protoFilegroups = append(protoFilegroups, r)
@@ -327,13 +446,29 @@ func removeLegacyProto(c *config.Config, f *rule.File) {
 			protoRules = append(protoRules, r)
 		}
 	}
+	return protoLoads, protoFilegroups, protoRules
+}
+
+// checkLegacyProto reports whether f uses the old proto rules.
+func checkLegacyProto(c *config.Config, f *rule.File) string {
+	protoLoads, protoFilegroups, _ := legacyProtoDefs(c, f)
 	if len(protoLoads)+len(protoFilegroups) == 0 {
-		return
+		return ""
 	}
+	return "go_proto_library.bzl is deprecated"
+}
+
+// removeLegacyProto removes uses of the old proto rules. It deletes loads
+// from go_proto_library.bzl. It deletes proto filegroups. It removes
+// go_proto_library attributes which are no longer recognized. New rules
+// are generated in place of the deleted rules, but attributes and comments
+// are not migrated. Outside fix mode, nothing is changed; the legacy_proto
+// FileFix reports the old rules instead.
+func removeLegacyProto(c *config.Config, f *rule.File) {
 	if !c.ShouldFix {
-		log.Printf("%s: go_proto_library.bzl is deprecated. Run 'gazelle fix' to replace old rules.", f.Path)
 		return
 	}
+	protoLoads, protoFilegroups, protoRules := legacyProtoDefs(c, f)
 
 	// Delete legacy proto loads and filegroups. Only delete go_proto_library
 	// rules if we deleted a load.
@@ -364,6 +499,14 @@ func removeLegacyGazelle(c *config.Config, f *rule.File) {
 	}
 }
 
+// setBuildTagConditions records the conditions of custom build tags on r, so
+// selects on them are squashed like selects on platforms.
+func setBuildTagConditions(c *config.Config, r *rule.Rule) {
+	if tagConds := buildTagConditions(getGoConfig(c)); tagConds != nil {
+		r.SetPrivateAttr(rule.BuildTagConditionsKey, tagConds)
+	}
+}
+
 func isGoRule(kind string) bool {
 	return kind == "go_library" ||
 		kind == "go_binary" ||
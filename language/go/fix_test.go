@@ -19,6 +19,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/bazelbuild/bazel-gazelle/language"
 	"github.com/bazelbuild/bazel-gazelle/merger"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 )
@@ -61,6 +62,54 @@ go_test(
     srcs = ["foo_test.go"],
     embed = [":foo"],
 )
+`,
+		},
+		{
+			desc:             "go_naming_convention=go_default_library -> pb_suffix for proto lib",
+			namingConvention: pbSuffixNamingConvention,
+			old: `load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
+
+go_proto_library(
+    name = "foo_go_proto",
+    importpath = "example.com/foo",
+    proto = ":foo_proto",
+)
+
+go_library(
+    name = "go_default_library",
+    srcs = ["extra.go"],
+    embed = [":foo_go_proto"],
+    importpath = "example.com/foo",
+)
+
+go_test(
+    name = "go_default_test",
+    srcs = ["extra_test.go"],
+    embed = [":go_default_library"],
+)
+`,
+			want: `load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
+
+go_proto_library(
+    name = "foo_go_proto",
+    importpath = "example.com/foo",
+    proto = ":foo_proto",
+)
+
+go_library(
+    name = "foo_pb",
+    srcs = ["extra.go"],
+    embed = [":foo_go_proto"],
+    importpath = "example.com/foo",
+)
+
+go_test(
+    name = "foo_test",
+    srcs = ["extra_test.go"],
+    embed = [":foo_pb"],
+)
 `,
 		},
 		{
@@ -870,6 +919,91 @@ go_proto_library(
 go_proto_library(name = "foo_proto")
 `,
 			want: `go_proto_library(name = "foo_proto")
+`,
+		},
+		// migrateDeprecatedAttrs tests
+		{
+			desc: "deprecated attrs migrated",
+			old: `load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library", "go_test")
+
+go_library(
+    name = "foo",
+    srcs = ["foo.go"],
+    importmap = "vendor/example.com/foo",
+    importpath = "example.com/foo",
+)
+
+go_binary(
+    name = "cmd",
+    embed = [":foo"],
+    importmap = "example.com/foo/cmd",
+    pure = "on",
+    static = "off",
+)
+
+go_test(
+    name = "foo_test",
+    embed = [":foo"],
+    importmap = "example.com/foo_test",
+)
+`,
+			want: `load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library", "go_test")
+
+go_library(
+    name = "foo",
+    srcs = ["foo.go"],
+    importmap = "vendor/example.com/foo",
+    importpath = "example.com/foo",
+)
+
+go_binary(
+    name = "cmd",
+    embed = [":foo"],
+    pure = "on",
+    static = "off",
+)
+
+go_test(
+    name = "foo_test",
+    embed = [":foo"],
+)
+`,
+		},
+		{
+			desc: "deprecated attrs kept",
+			old: `load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "cmd",
+    importmap = "example.com/foo/cmd",  # keep
+    pure = select({
+        "//:pure": "on",
+        "//conditions:default": "off",
+    }),
+)
+
+# keep
+go_binary(
+    name = "cmd2",
+    static = "on",
+)
+`,
+			want: `load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "cmd",
+    importmap = "example.com/foo/cmd",  # keep
+    pure = select({
+        "//:pure": "on",
+        "//conditions:default": "off",
+    }),
+)
+
+# keep
+go_binary(
+    name = "cmd2",
+    static = "on",
+)
 `,
 		},
 	} {
@@ -883,11 +1017,80 @@ go_proto_library(name = "foo_proto")
 				for _, lang := range langs {
 					lang.Fix(c, f)
 				}
+				language.ApplyFileFixes(c, f, langs)
 			})
 		})
 	}
 }
 
+func TestFileFixesReportOnly(t *testing.T) {
+	old := `load("@io_bazel_rules_go//proto:go_proto_library.bzl", "go_proto_library")
+
+go_proto_library(
+    name = "go_default_library_protos",
+    srcs = ["foo.proto"],
+)
+`
+	f, err := rule.LoadData(filepath.Join("old", "BUILD.bazel"), "", []byte(old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, langs, _ := testConfig(t, "-go_prefix=example.com/foo")
+	c.ShouldFix = false
+	needed := language.ApplyFileFixes(c, f, langs)
+	if want := []string{"go_proto_library.bzl is deprecated"}; len(needed) != 1 || needed[0] != want[0] {
+		t.Errorf("got needed fixes %q; want %q", needed, want)
+	}
+	if got := string(f.Format()); got != old {
+		t.Errorf("file was modified without fix mode:\n%s", got)
+	}
+}
+
+func TestFixRemovesLegacyProto(t *testing.T) {
+	f, err := rule.LoadData(filepath.Join("old", "BUILD.bazel"), "", []byte(`load("@io_bazel_rules_go//proto:go_proto_library.bzl", "go_proto_library")
+
+go_proto_library(
+    name = "go_default_library_protos",
+    srcs = ["foo.proto"],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, langs, _ := testConfig(t, "-go_prefix=example.com/foo")
+	c.ShouldFix = true
+	for _, lang := range langs {
+		lang.Fix(c, f)
+	}
+	if got := string(f.Format()); got != "" {
+		t.Errorf("legacy proto rules were not removed by Fix:\n%s", got)
+	}
+}
+
+func TestDeprecatedAttrsReportOnly(t *testing.T) {
+	old := `load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "cmd",
+    importmap = "example.com/foo/cmd",
+    pure = "on",
+)
+`
+	f, err := rule.LoadData(filepath.Join("old", "BUILD.bazel"), "", []byte(old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, langs, _ := testConfig(t, "-go_prefix=example.com/foo")
+	c.ShouldFix = false
+	needed := language.ApplyFileFixes(c, f, langs)
+	if want := []string{`go_binary "cmd" uses deprecated attributes importmap`}; len(needed) != 1 || needed[0] != want[0] {
+		t.Errorf("got needed fixes %q; want %q", needed, want)
+	}
+	if got := string(f.Format()); got != old {
+		t.Errorf("file was modified without fix mode:\n%s", got)
+	}
+}
+
 func TestFixLoads(t *testing.T) {
 	for _, tc := range []fixTestCase{
 		{
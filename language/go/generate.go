@@ -21,6 +21,8 @@ import (
 	"log"
 	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -28,6 +30,7 @@ import (
 	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/language"
 	"github.com/bazelbuild/bazel-gazelle/language/proto"
+	"github.com/bazelbuild/bazel-gazelle/merger"
 	"github.com/bazelbuild/bazel-gazelle/pathtools"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 )
@@ -80,6 +83,24 @@ func (gl *goLang) GenerateRules(args language.GenerateArgs) language.GenerateRes
 	// to any .proto files present.
 	regularFiles := append([]string{}, args.RegularFiles...)
 	genFiles := append([]string{}, args.GenFiles...)
+
+	// Add Go files generated at build time that are listed in
+	// -go_generated_srcs_manifest. Rules that produce them may not be
+	// visible in build files, for example when they're reported by an aspect.
+	var genImportPath string
+	for _, src := range gc.generatedSrcs[args.Rel] {
+		genImportPath = src.importPath
+		found := false
+		for _, f := range genFiles {
+			if f == src.name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			genFiles = append(genFiles, src.name)
+		}
+	}
 	if !pcMode.ShouldIncludePregeneratedFiles() {
 		keep := func(f string) bool {
 			for _, suffix := range []string{".pb.go", "_grpc.pb.go"} {
@@ -96,15 +117,24 @@ func (gl *goLang) GenerateRules(args language.GenerateArgs) language.GenerateRes
 	}
 
 	// Split regular files into files which can determine the package name and
-	// import path and other files.
+	// import path and other files. If metadata for Go files in this directory
+	// was provided, those files are used instead of parsing .go files.
+	fileMetadata, haveFileMetadata := gc.fileMetadata[args.Rel]
 	var goFiles, otherFiles []string
 	for _, f := range regularFiles {
 		if strings.HasSuffix(f, ".go") {
-			goFiles = append(goFiles, f)
+			if !haveFileMetadata {
+				goFiles = append(goFiles, f)
+			}
 		} else {
 			otherFiles = append(otherFiles, f)
 		}
 	}
+	if haveFileMetadata {
+		for _, md := range fileMetadata {
+			goFiles = append(goFiles, md.Name)
+		}
+	}
 
 	// Look for a subdirectory named testdata. Only treat it as data if it does
 	// not contain a buildable package.
@@ -134,11 +164,17 @@ func (gl *goLang) GenerateRules(args language.GenerateArgs) language.GenerateRes
 			srcdir = path.Join("..", repoName, srcdir)
 		}
 	}
+	dirGoos, dirGoarch := gc.platformDirConstraints(args.Rel)
 	goFileInfos := make([]fileInfo, len(goFiles))
 	var er *embedResolver
 	for i, name := range goFiles {
-		path := filepath.Join(args.Dir, name)
-		goFileInfos[i] = goFileInfo(path, srcdir)
+		if haveFileMetadata {
+			goFileInfos[i] = fileMetadata[i].fileInfo(args.Dir)
+		} else {
+			path := filepath.Join(args.Dir, name)
+			goFileInfos[i] = goFileInfo(path, srcdir, gc.goTestShardCount == autoShardCount)
+		}
+		goFileInfos[i].applyPlatformDir(dirGoos, dirGoarch)
 		if len(goFileInfos[i].embeds) > 0 && er == nil {
 			er = newEmbedResolver(args.Dir, args.Rel, c.ValidBuildFileNames, gl.goPkgRels, args.Subdirs, args.RegularFiles, args.GenFiles)
 		}
@@ -178,6 +214,11 @@ func (gl *goLang) GenerateRules(args language.GenerateArgs) language.GenerateRes
 
 	// Try to link the selected package with a proto package.
 	if pkg != nil {
+		if pkg.importPath == "" && len(goFiles) == 0 && genImportPath != "" {
+			// The package only has generated sources, so we can't infer
+			// its import path from them.
+			pkg.importPath = genImportPath
+		}
 		if pkg.importPath == "" {
 			if err := pkg.inferImportPath(c); err != nil && pkg.firstGoFile() != "" {
 				inferImportPathErrorOnce.Do(func() { log.Print(err) })
@@ -204,7 +245,10 @@ func (gl *goLang) GenerateRules(args language.GenerateArgs) language.GenerateRes
 	var rules []*rule.Rule
 	var protoEmbeds []string
 	var protoEmbed string
-	if pcMode == proto.FileMode {
+	if pcMode == proto.FileMode || pcMode == proto.PackageMode {
+		// Proto packages with the same Go import path are compiled by a single
+		// go_proto_library, which may be embedded in the go_library.
+		//
 		// get the list of protoRuleNames that are not already in goProtoRules
 		var newProtoRuleNames []string
 		for _, name := range protoRuleNames {
@@ -215,18 +259,21 @@ func (gl *goLang) GenerateRules(args language.GenerateArgs) language.GenerateRes
 
 		// get the protoTargets for the new protoRuleNames
 		var importPathToProtoTargets = make(map[string][]protoTarget)
+		importPaths := []string{}
 		for _, name := range newProtoRuleNames {
 			ppkg := protoPackages[name]
 			importPath := goProtoImportPath(c, ppkg, args.Rel)
+			if _, ok := importPathToProtoTargets[importPath]; !ok {
+				importPaths = append(importPaths, importPath)
+			}
 			importPathToProtoTargets[importPath] = append(importPathToProtoTargets[importPath], protoTargetFromProtoPackage(name, ppkg))
 		}
 
-		// Deterministically sort by order of importpath.
-		importPaths := []string{}
-		for importPath, _ := range importPathToProtoTargets {
-			importPaths = append(importPaths, importPath)
+		// Deterministically sort by order of importpath in file mode. In
+		// package mode, keep the order of the proto_library rules.
+		if pcMode == proto.FileMode {
+			sort.Strings(importPaths)
 		}
-		sort.Strings(importPaths)
 
 		for _, importPath := range importPaths {
 			var rs []*rule.Rule
@@ -297,6 +344,7 @@ func (gl *goLang) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		// Process the other static files.
 		for _, file := range otherFiles {
 			info := otherFileInfo(filepath.Join(args.Dir, file))
+			info.applyPlatformDir(dirGoos, dirGoarch)
 			if err := pkg.addFile(c, er, info, cgo); err != nil {
 				log.Print(err)
 			}
@@ -309,6 +357,9 @@ func (gl *goLang) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		for _, f := range regularFiles {
 			regularFileSet[f] = true
 		}
+		for _, f := range goFiles {
+			regularFileSet[f] = true
+		}
 		// Some of the generated files may have been consumed by other rules
 		consumedFileSet := make(map[string]bool)
 		for _, r := range args.OtherGen {
@@ -324,6 +375,7 @@ func (gl *goLang) GenerateRules(args language.GenerateArgs) language.GenerateRes
 				continue
 			}
 			info := fileNameInfo(filepath.Join(args.Dir, f))
+			info.applyPlatformDir(dirGoos, dirGoarch)
 			if err := pkg.addFile(c, er, info, cgo); err != nil {
 				log.Print(err)
 			}
@@ -374,11 +426,24 @@ func (gl *goLang) GenerateRules(args language.GenerateArgs) language.GenerateRes
 			g.maybePublishToolLib(r, pkg)
 			rules = append(rules, r)
 		}
+		if r := g.maybeGeneratePbSuffixAlias(pkg, libName); r != nil {
+			rules = append(rules, r)
+		}
 		rules = append(rules, g.generateBin(pkg, libName))
 		rules = append(rules, g.generateTests(pkg, libName)...)
+		rules = append(rules, g.generateEmptyTestsForMode(args.File, pkg, rules)...)
+		rules = append(rules, g.generateEmptyTestsForName(args.File, pkg, rules)...)
+		rules = append(rules, g.generateEmptyFuzzTests(args.File, rules)...)
+		if r := g.maybeGenerateTestSuite(args.File, pkg, rules); r != nil {
+			rules = append(rules, r)
+		}
 	}
 
+	tagConds := buildTagConditions(gc)
 	for _, r := range rules {
+		if tagConds != nil {
+			r.SetPrivateAttr(rule.BuildTagConditionsKey, tagConds)
+		}
 		if r.IsEmpty(goKinds[r.Kind()]) {
 			res.Empty = append(res.Empty, r)
 		} else {
@@ -572,17 +637,38 @@ func (g *generator) generateProto(mode proto.Mode, targets []protoTarget, import
 	}
 
 	g.setImportAttrs(goProtoLibrary, importPath)
-	var atLeastOneTargetHasServices bool
+	var atLeastOneTargetHasServices, needsGateway, needsValidate bool
 	for _, target := range targets {
-		if target.hasServices {
-			atLeastOneTargetHasServices = true
-			break
+		atLeastOneTargetHasServices = atLeastOneTargetHasServices || target.hasServices
+		needsGateway = needsGateway || target.hasHTTPAnnotations
+		needsValidate = needsValidate || target.hasValidateRules
+	}
+	pc := proto.GetProtoConfig(g.c)
+	needsGateway = needsGateway && atLeastOneTargetHasServices && pc != nil && pc.GrpcGateway
+	needsValidate = needsValidate && pc != nil && pc.Validate
+	protoPkgs := make([]string, len(targets))
+	for i, target := range targets {
+		protoPkgs[i] = target.protoPkg
+	}
+	var compilers []string
+	if atLeastOneTargetHasServices {
+		compilers = gc.goGrpcCompilers
+		if override := findCompilerOverride(gc.goGrpcCompilerOverrides, protoPkgs); override != nil {
+			compilers = override
 		}
+	} else if override := findCompilerOverride(gc.goProtoCompilerOverrides, protoPkgs); override != nil {
+		compilers = override
+	} else if gc.goProtoCompilersSet || needsValidate {
+		compilers = gc.goProtoCompilers
 	}
-	if atLeastOneTargetHasServices {
-		goProtoLibrary.SetAttr("compilers", gc.goGrpcCompilers)
-	} else if gc.goProtoCompilersSet {
-		goProtoLibrary.SetAttr("compilers", gc.goProtoCompilers)
+	if needsGateway {
+		compilers = append(compilers[:len(compilers):len(compilers)], grpcGatewayCompiler)
+	}
+	if needsValidate {
+		compilers = append(compilers[:len(compilers):len(compilers)], protoValidateCompiler)
+	}
+	if compilers != nil {
+		goProtoLibrary.SetAttr("compilers", compilers)
 	}
 	if g.shouldSetVisibility {
 		goProtoLibrary.SetAttr("visibility", visibility)
@@ -622,6 +708,12 @@ func (g *generator) generateProto(mode proto.Mode, targets []protoTarget, import
 func (g *generator) generateLib(pkg *goPackage, embeds []string) *rule.Rule {
 	gc := getGoConfig(g.c)
 	name := libNameByConvention(gc.goNamingConvention, pkg.importPath, pkg.name)
+	if len(embeds) > 0 {
+		name = protoLibNameByConvention(gc.goNamingConvention, pkg.importPath, pkg.name)
+	}
+	if gc.goLibraryName != "" {
+		name = gc.goLibraryName
+	}
 	goLibrary := rule.NewRule("go_library", name)
 	if !pkg.library.sources.hasGo() && len(embeds) == 0 {
 		return goLibrary // empty
@@ -638,6 +730,7 @@ func (g *generator) generateLib(pkg *goPackage, embeds []string) *rule.Rule {
 	}
 	g.setCommonAttrs(goLibrary, pkg.rel, visibility, pkg.library, embeds)
 	g.setImportAttrs(goLibrary, pkg.importPath)
+	g.setTestonly(goLibrary, pkg.rel)
 	return goLibrary
 }
 
@@ -650,9 +743,36 @@ func (g *generator) maybeGenerateAlias(pkg *goPackage, libName string) *rule.Rul
 		return nil
 	}
 	alias := rule.NewRule("alias", defaultLibName)
-	alias.SetAttr("visibility", g.commonVisibility(pkg.importPath))
+	if !g.c.OmitVisibility {
+		alias.SetAttr("visibility", g.commonVisibility(pkg.importPath))
+	}
 	if gc.goNamingConvention == importAliasNamingConvention {
 		alias.SetAttr("actual", ":"+libName)
+		if gc.aliasDeprecation != "" {
+			alias.SetAttr("deprecation", gc.aliasDeprecation)
+		}
+	}
+	return alias
+}
+
+// maybeGeneratePbSuffixAlias returns an alias to a library named with the
+// pb_suffix naming convention, named as the library would be without the
+// suffix. It's only generated in go_repository, since other repositories
+// can't tell which of its packages are generated from protos, and they
+// resolve imports to the name without the suffix.
+func (g *generator) maybeGeneratePbSuffixAlias(pkg *goPackage, libName string) *rule.Rule {
+	gc := getGoConfig(g.c)
+	if !gc.goRepositoryMode || gc.goNamingConvention != pbSuffixNamingConvention || libName == "" {
+		return nil
+	}
+	name := libNameByConvention(gc.goNamingConvention, pkg.importPath, pkg.name)
+	if name == libName {
+		return nil
+	}
+	alias := rule.NewRule("alias", name)
+	alias.SetAttr("actual", ":"+libName)
+	if !g.c.OmitVisibility {
+		alias.SetAttr("visibility", g.commonVisibility(pkg.importPath))
 	}
 	return alias
 }
@@ -679,7 +799,7 @@ func (g *generator) generateTests(pkg *goPackage, library string) []*rule.Rule {
 	switch gc.testMode {
 	case defaultTestMode:
 		name = func(goTarget) string {
-			return testNameByConvention(gc.goNamingConvention, pkg.importPath)
+			return testName(g.c, pkg)
 		}
 	case fileTestMode:
 		name = func(test goTarget) string {
@@ -688,7 +808,7 @@ func (g *generator) generateTests(pkg *goPackage, library string) []*rule.Rule {
 					return testNameFromSingleSource(srcs[0])
 				}
 			}
-			return testNameByConvention(gc.goNamingConvention, pkg.importPath)
+			return testName(g.c, pkg)
 		}
 	}
 	var res []*rule.Rule
@@ -708,6 +828,53 @@ func (g *generator) generateTests(pkg *goPackage, library string) []*rule.Rule {
 			}
 		}
 		g.setCommonAttrs(goTest, pkg.rel, nil, test, embeds)
+		g.setShardCount(goTest, test)
+		g.setTestonly(goTest, pkg.rel)
+		if pkg.hasTestdata {
+			goTest.SetAttr("data", rule.GlobValue{Patterns: []string{"testdata/**"}})
+		}
+	}
+	for _, test := range tests {
+		var embeds []string
+		if test.hasInternalTest && library != "" {
+			embeds = append(embeds, library)
+		}
+		for _, fn := range test.fuzzFuncs {
+			goTest := rule.NewRule("go_test", testNameFromFuzzFunc(fn))
+			g.setCommonAttrs(goTest, pkg.rel, nil, test, embeds)
+			g.setTestonly(goTest, pkg.rel)
+			// Other tests in the same files are run by the regular go_test.
+			goTest.SetAttr("args", []string{fmt.Sprintf("-test.run=^%s$", fn)})
+			if pkg.hasTestdata {
+				// Seed corpora are stored in testdata/fuzz/FuzzXxx.
+				goTest.SetAttr("data", rule.GlobValue{Patterns: []string{"testdata/**"}})
+			}
+			res = append(res, goTest)
+		}
+	}
+	for _, tag := range gc.goTestTagTargets {
+		test := goTarget{testTag: tag}
+		for _, t := range pkg.tagTests {
+			if t.testTag == tag {
+				test = t
+				break
+			}
+		}
+		goTest := rule.NewRule("go_test", testNameForTag(testName(g.c, pkg), tag))
+		res = append(res, goTest)
+		if !test.sources.hasGo() {
+			// Empty rule, so a target for a tag that's no longer used is deleted.
+			continue
+		}
+		var embeds []string
+		if test.hasInternalTest && library != "" {
+			embeds = append(embeds, library)
+		}
+		g.setCommonAttrs(goTest, pkg.rel, nil, test, embeds)
+		g.setShardCount(goTest, test)
+		g.setTestonly(goTest, pkg.rel)
+		goTest.SetAttr("gotags", []string{tag})
+		goTest.SetAttr("tags", []string{"manual", tag})
 		if pkg.hasTestdata {
 			goTest.SetAttr("data", rule.GlobValue{Patterns: []string{"testdata/**"}})
 		}
@@ -715,6 +882,211 @@ func (g *generator) generateTests(pkg *goPackage, library string) []*rule.Rule {
 	return res
 }
 
+// maybeGenerateTestSuite returns a test_suite listing the non-empty go_test
+// rules in rules, if the go_test_suite directive is set. This includes tests
+// for fuzz targets and for tags listed with go_test_tag_targets, so the
+// suite is a single label for all of a package's tests. If there are no
+// tests, an existing test_suite with the same name in f is deleted. Since
+// test_suite is a native rule, there's nothing to tell a generated suite from
+// a hand-written one with the same name; both are merged like any other
+// generated rule.
+//
+// The Go extension doesn't claim the test_suite kind, since it's only
+// generated where the directive is set. The directive declares tests
+// mergeable for test_suite in those directories instead.
+func (g *generator) maybeGenerateTestSuite(f *rule.File, pkg *goPackage, rules []*rule.Rule) *rule.Rule {
+	gc := getGoConfig(g.c)
+	if gc.goTestSuite == "" {
+		return nil
+	}
+	suite := rule.NewRule("test_suite", expandNameTemplate(gc.goTestSuite, binName(pkg.rel, gc.prefix, g.c.RepoRoot)))
+	var tests []string
+	for _, r := range rules {
+		if r.Kind() == "go_test" && !r.IsEmpty(goKinds["go_test"]) {
+			tests = append(tests, ":"+r.Name())
+		}
+	}
+	if len(tests) > 0 {
+		suite.SetAttr("tests", tests)
+		return suite
+	}
+	if f != nil {
+		for _, r := range f.Rules {
+			if r.Kind() == "test_suite" && r.Name() == suite.Name() {
+				suite.SetPrivateAttr(merger.UnstableDeleteKey, true)
+				return suite
+			}
+		}
+	}
+	return nil
+}
+
+// fuzzTestArgRe matches the args of a go_test generated for a fuzz function,
+// capturing the function name.
+var fuzzTestArgRe = regexp.MustCompile(`^-test\.run=\^(Fuzz\w*)\$$`)
+
+// generateEmptyFuzzTests returns empty go_test rules for existing tests in f
+// that were generated for fuzz functions that no longer exist, or before
+// go_generate_fuzz_targets was turned off, so they're deleted. These tests
+// are recognized by their names and args. Tests with the same names as
+// generated rules are left alone, and nothing is deleted unless the
+// directive was set, so hand-written tests in other packages are kept.
+func (g *generator) generateEmptyFuzzTests(f *rule.File, gen []*rule.Rule) []*rule.Rule {
+	if f == nil || !getGoConfig(g.c).goGenerateFuzzTargetsSet {
+		return nil
+	}
+	genNames := make(map[string]bool)
+	for _, r := range gen {
+		genNames[r.Name()] = true
+	}
+	var empty []*rule.Rule
+	for _, r := range f.Rules {
+		if !isGoKind(g.c, r.Kind(), "go_test") || genNames[r.Name()] {
+			continue
+		}
+		args := r.AttrStrings("args")
+		if len(args) != 1 {
+			continue
+		}
+		if m := fuzzTestArgRe.FindStringSubmatch(args[0]); m != nil && testNameFromFuzzFunc(m[1]) == r.Name() {
+			empty = append(empty, rule.NewRule("go_test", r.Name()))
+		}
+	}
+	return empty
+}
+
+// isGoKind returns whether kind, the kind of an existing rule, is goKind or
+// the kind goKind is mapped to with the map_kind directive.
+func isGoKind(c *config.Config, kind, goKind string) bool {
+	if kind == goKind {
+		return true
+	}
+	mapped, ok := c.KindMap[goKind]
+	return ok && mapped.KindName == kind
+}
+
+// generateEmptyTestsForMode returns empty go_test rules for existing tests
+// in f that were generated in the go_test mode not currently in effect, so
+// they're deleted when the mode changes. In per_file mode, that's the test
+// named by convention for the package. In per_package mode, it's tests named
+// after their only source, which is one of the package's test files. Tests
+// with the same names as generated rules are left alone.
+//
+// The mode is only considered changed if none of the tests generated in the
+// current mode exist yet, so tests written by hand next to generated tests
+// aren't deleted.
+func (g *generator) generateEmptyTestsForMode(f *rule.File, pkg *goPackage, gen []*rule.Rule) []*rule.Rule {
+	if f == nil {
+		return nil
+	}
+	gc := getGoConfig(g.c)
+	existing := make(map[string]bool)
+	for _, r := range f.Rules {
+		if r.Kind() == "go_test" {
+			existing[r.Name()] = true
+		}
+	}
+	pkgTestName := testName(g.c, pkg)
+	genNames := make(map[string]bool)
+	for _, r := range gen {
+		genNames[r.Name()] = true
+		if r.Kind() == "go_test" && existing[r.Name()] && (gc.testMode == defaultTestMode || r.Name() != pkgTestName) {
+			return nil
+		}
+	}
+	testSrcs := make(map[string]bool)
+	for _, test := range pkg.tests {
+		for _, src := range test.sources.buildFlat() {
+			testSrcs[src] = true
+		}
+	}
+	var empty []*rule.Rule
+	for _, r := range f.Rules {
+		if r.Kind() != "go_test" || genNames[r.Name()] {
+			continue
+		}
+		var stale bool
+		switch gc.testMode {
+		case defaultTestMode:
+			srcs := r.AttrStrings("srcs")
+			stale = len(srcs) == 1 && testSrcs[srcs[0]] && testNameFromSingleSource(srcs[0]) == r.Name()
+		case fileTestMode:
+			stale = r.Name() == pkgTestName
+		}
+		if stale {
+			empty = append(empty, rule.NewRule("go_test", r.Name()))
+		}
+	}
+	return empty
+}
+
+// generateEmptyTestsForName returns empty go_test rules for existing tests
+// in f named by the naming convention, when go_test_name gives generated
+// tests a different name, so they're replaced instead of duplicated. This
+// includes tests for tags listed with go_test_tag_targets. Like
+// generateEmptyTestsForMode, tests are only deleted while the renamed tests
+// don't exist yet.
+func (g *generator) generateEmptyTestsForName(f *rule.File, pkg *goPackage, gen []*rule.Rule) []*rule.Rule {
+	gc := getGoConfig(g.c)
+	if f == nil || gc.goTestName == "" {
+		return nil
+	}
+	oldName := testNameByConvention(gc.goNamingConvention, pkg.importPath)
+	newName := testName(g.c, pkg)
+	if oldName == newName {
+		return nil
+	}
+	renames := map[string]string{oldName: newName}
+	for _, tag := range gc.goTestTagTargets {
+		renames[testNameForTag(oldName, tag)] = testNameForTag(newName, tag)
+	}
+	existing := make(map[string]bool)
+	for _, r := range f.Rules {
+		if r.Kind() == "go_test" {
+			existing[r.Name()] = true
+		}
+	}
+	genNames := make(map[string]bool)
+	for _, r := range gen {
+		genNames[r.Name()] = true
+	}
+	var empty []*rule.Rule
+	for _, r := range f.Rules {
+		renamed, ok := renames[r.Name()]
+		if r.Kind() != "go_test" || !ok || genNames[r.Name()] || existing[renamed] {
+			continue
+		}
+		empty = append(empty, rule.NewRule("go_test", r.Name()))
+	}
+	return empty
+}
+
+// setShardCount sets shard_count on a go_test according to the
+// go_test_shard_count directive. With "auto", tests are split into one
+// shard per testFuncsPerShard test functions, up to maxAutoShardCount
+// shards, and targets that need only one shard are not sharded.
+func (g *generator) setShardCount(goTest *rule.Rule, test goTarget) {
+	n := getGoConfig(g.c).goTestShardCount
+	if n == autoShardCount {
+		n = (test.testFuncs + testFuncsPerShard - 1) / testFuncsPerShard
+		if n > maxAutoShardCount {
+			n = maxAutoShardCount
+		}
+	}
+	if n > 1 {
+		goTest.SetAttr("shard_count", n)
+	}
+}
+
+// setTestonly sets testonly on a go_library or go_test in the package rel
+// if rel matches the go_testonly_paths directive. Test helper libraries
+// marked this way can't be depended on by production targets.
+func (g *generator) setTestonly(r *rule.Rule, rel string) {
+	if re := getGoConfig(g.c).testonlyPaths; re != nil && re.MatchString(rel) {
+		r.SetAttr("testonly", true)
+	}
+}
+
 // maybePublishToolLib makes the given go_library rule public if needed for nogo.
 // Updating it here automatically makes it easier to upgrade org_golang_x_tools.
 func (g *generator) maybePublishToolLib(lib *rule.Rule, pkg *goPackage) {
@@ -762,9 +1134,22 @@ func (g *generator) maybeGenerateExtraLib(lib *rule.Rule, pkg *goPackage) *rule.
 
 func (g *generator) setCommonAttrs(r *rule.Rule, pkgRel string, visibility []string, target goTarget, embeds []string) {
 	if !target.sources.isEmpty() {
-		r.SetAttr("srcs", target.sources.buildFlat())
+		gc := getGoConfig(g.c)
+		if goos, goarch := gc.platformDirConstraints(pkgRel); gc.useSelect("srcs", goos != "" || goarch != "") {
+			// rules_go filters sources by file name and build tags, but it doesn't
+			// know about platform directories, so we need a select expression.
+			r.SetAttr("srcs", target.sources.build())
+		} else if target.sources.hasTagStrings() {
+			// Sources that need custom build tags declared with go_build_tag
+			// are still selected with the tags' config_settings.
+			r.SetAttr("srcs", target.sources.buildTagged())
+		} else {
+			r.SetAttr("srcs", target.sources.buildFlat())
+		}
 	}
-	if !target.embedSrcs.isEmpty() {
+	hasEmbeds := !target.embedSrcs.isEmpty() || len(target.unresolvedEmbeds) > 0
+	embedsrcs := hasEmbeds && getGoConfig(g.c).supportsFeature("embedsrcs")
+	if embedsrcs && !target.embedSrcs.isEmpty() {
 		r.SetAttr("embedsrcs", target.embedSrcs.build())
 	}
 	if target.cgo {
@@ -792,19 +1177,56 @@ func (g *generator) setCommonAttrs(r *rule.Rule, pkgRel string, visibility []str
 		}
 		r.SetAttr("embed", colonEmbeds)
 	}
+	if embedsrcs && len(target.unresolvedEmbeds) > 0 {
+		r.SetPrivateAttr(unresolvedEmbedsKey, target.unresolvedEmbeds)
+	}
 	r.SetPrivateAttr(config.GazelleImportsKey, target.imports.build())
+	if g.c.RecordProvenance {
+		g.recordProvenance(r, target, visibility)
+	}
+}
+
+// recordProvenance records why the sources, embeds and visibility set by
+// setCommonAttrs are in r. Files importing each import path are saved, so
+// they can be named when dependencies are resolved.
+func (g *generator) recordProvenance(r *rule.Rule, target goTarget, visibility []string) {
+	for _, src := range target.sources.buildFlat() {
+		r.AddProvenance("srcs", src, fmt.Sprintf("Go source file in //%s", g.rel))
+	}
+	for _, embed := range r.AttrStrings("embed") {
+		r.AddProvenance("embed", embed, "the test has files in the same package as the library")
+	}
+	gc := getGoConfig(g.c)
+	for _, v := range visibility {
+		var reason string
+		switch {
+		case slices.Contains(gc.goVisibility, v):
+			reason = "listed in # gazelle:go_visibility"
+		case slices.Contains(gc.goVendorVisibility, v):
+			reason = "listed in # gazelle:go_vendor_visibility"
+		case v == "//visibility:public":
+			reason = "default visibility of Go packages that aren't internal"
+		default:
+			reason = "the package is internal, so it's only visible to the packages that may import it"
+		}
+		r.AddProvenance("visibility", v, reason)
+	}
+	r.SetPrivateAttr(importFilesKey, target.importFiles)
 }
 
 func (g *generator) setImportAttrs(r *rule.Rule, importPath string) {
 	gc := getGoConfig(g.c)
 	r.SetAttr("importpath", importPath)
+	if g.c.RecordProvenance {
+		r.AddProvenance("importpath", importPath, fmt.Sprintf("the Go prefix %q set in //%s, followed by the path of the directory", gc.prefix, gc.prefixRel))
+	}
 
 	// Set importpath_aliases if we need minimal module compatibility.
 	// If a package is part of a module with a v2+ semantic import version
 	// suffix, packages that are not part of modules may import it without
 	// the suffix.
 	if gc.goRepositoryMode && gc.moduleMode && pathtools.HasPrefix(importPath, gc.prefix) && gc.prefixRel == "" {
-		if mmcImportPath := pathWithoutSemver(importPath); mmcImportPath != "" {
+		if mmcImportPath := pathWithoutSemver(importPath); mmcImportPath != "" && gc.supportsFeature("importpath_aliases") {
 			r.SetAttr("importpath_aliases", []string{mmcImportPath})
 		}
 	}
@@ -825,28 +1247,37 @@ func (g *generator) commonVisibility(importPath string) []string {
 	// probably an internal submodule. Add visibility for all subpackages.
 	relIndex := pathtools.Index(g.rel, "internal")
 	importIndex := pathtools.Index(importPath, "internal")
-	visibility := getGoConfig(g.c).goVisibility
+	gc := getGoConfig(g.c)
+	visibility := gc.goVisibility[:len(gc.goVisibility):len(gc.goVisibility)]
 	if relIndex >= 0 {
 		parent := strings.TrimSuffix(g.rel[:relIndex], "/")
 		visibility = append(visibility, fmt.Sprintf("//%s:__subpackages__", parent))
 	} else if importIndex >= 0 {
 		// This entire module is within an internal directory.
-		// Identify other repos which should have access too.
+		// Identify other repos which should have access too, unless the
+		// go_internal_friends directive lists them explicitly.
 		visibility = append(visibility, "//:__subpackages__")
-		for _, repo := range g.c.Repos {
-			if pathtools.HasPrefix(repo.AttrString("importpath"), importPath[:importIndex]) {
-				visibility = append(visibility, "@"+repo.Name()+"//:__subpackages__")
+		if gc.goInternalFriends == nil {
+			for _, repo := range g.c.Repos {
+				if pathtools.HasPrefix(repo.AttrString("importpath"), importPath[:importIndex]) {
+					visibility = append(visibility, "@"+repo.Name()+"//:__subpackages__")
+				}
 			}
 		}
 
+	} else if gc.goVendorVisibility != nil && isVendored(g.rel) {
+		return gc.goVendorVisibility
 	} else {
 		return []string{"//visibility:public"}
 	}
 
+	for _, friend := range gc.goInternalFriends {
+		visibility = append(visibility, "@"+friend+"//:__subpackages__")
+	}
+
 	// Add visibility for any submodules that have the internal parent as
 	// a prefix of their module path.
 	if importIndex >= 0 {
-		gc := getGoConfig(g.c)
 		internalRoot := strings.TrimSuffix(importPath[:importIndex], "/")
 		for _, m := range gc.submodules {
 			if strings.HasPrefix(m.modulePath, internalRoot) {
@@ -937,7 +1368,25 @@ func escapeOption(opt string) string {
 	).Replace(opt)
 }
 
+// buildTagConditions returns the config_setting labels of custom build tags
+// set with go_build_tag, or nil if there are none. They're recorded on rules
+// as rule.BuildTagConditionsKey, so selects on them are merged as selects
+// for build tags.
+func buildTagConditions(gc *goConfig) map[string]bool {
+	if len(gc.buildTagSettings) == 0 {
+		return nil
+	}
+	tagConds := make(map[string]bool, len(gc.buildTagSettings))
+	for _, setting := range gc.buildTagSettings {
+		tagConds[setting] = true
+	}
+	return tagConds
+}
+
 func shouldSetVisibility(args language.GenerateArgs) bool {
+	if args.Config != nil && (args.Config.OmitVisibility || args.Config.HasRepoDefaultVisibility()) {
+		return false
+	}
 	if args.File != nil && args.File.HasDefaultVisibility() {
 		return false
 	}
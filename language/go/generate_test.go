@@ -327,6 +327,20 @@ func TestShouldSetVisibility(t *testing.T) {
 	}) {
 		t.Error("got 'True' for shouldSetVisibility with rule defining a default visibility; expected 'False'")
 	}
+
+	if shouldSetVisibility(language.GenerateArgs{
+		Config: &config.Config{OmitVisibility: true},
+	}) {
+		t.Error("got 'True' for shouldSetVisibility with visibility generation disabled; expected 'False'")
+	}
+
+	repoDefaults := rule.NewRule("repo", "")
+	repoDefaults.SetAttr("default_visibility", []string{"//visibility:public"})
+	if shouldSetVisibility(language.GenerateArgs{
+		Config: &config.Config{RepoDefaults: repoDefaults},
+	}) {
+		t.Error("got 'True' for shouldSetVisibility with default visibility in REPO.bazel; expected 'False'")
+	}
 }
 
 func prebuiltProtoRules() []*rule.Rule {
@@ -0,0 +1,75 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golang
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// generatedSrc is a Go source file generated at build time, listed in the
+// manifest passed with -go_generated_srcs_manifest.
+type generatedSrc struct {
+	// name is the base name of the file within its directory.
+	name string
+
+	// importPath is the import path of the package the file belongs to.
+	importPath string
+}
+
+// loadGeneratedSrcsManifest reads a JSON object mapping slash-separated,
+// repository-relative paths of generated files to the import paths of their
+// packages. Such a manifest is typically written by a Bazel aspect and
+// requested through an output group. The result maps each directory to the
+// generated files within it, sorted by name.
+func loadGeneratedSrcsManifest(manifestPath string) (map[string][]generatedSrc, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var manifest map[string]string
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestPath, err)
+	}
+
+	srcs := make(map[string][]generatedSrc)
+	for p, importPath := range manifest {
+		if path.IsAbs(p) || p != path.Clean(p) || p == ".." || strings.HasPrefix(p, "../") {
+			return nil, fmt.Errorf("%s: %q is not a clean path relative to the repository root", manifestPath, p)
+		}
+		if importPath == "" {
+			return nil, fmt.Errorf("%s: no import path for %q", manifestPath, p)
+		}
+		dir := path.Dir(p)
+		if dir == "." {
+			dir = ""
+		}
+		srcs[dir] = append(srcs[dir], generatedSrc{name: path.Base(p), importPath: importPath})
+	}
+	for dir, dirSrcs := range srcs {
+		sort.Slice(dirSrcs, func(i, j int) bool { return dirSrcs[i].name < dirSrcs[j].name })
+		for _, src := range dirSrcs[1:] {
+			if src.importPath != dirSrcs[0].importPath {
+				return nil, fmt.Errorf("%s: generated files in %q have different import paths: %q and %q", manifestPath, dir, dirSrcs[0].importPath, src.importPath)
+			}
+		}
+	}
+	return srcs, nil
+}
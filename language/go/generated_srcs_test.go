@@ -0,0 +1,80 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golang
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadGeneratedSrcsManifest(t *testing.T) {
+	for _, tc := range []struct {
+		desc, manifest string
+		want           map[string][]generatedSrc
+		wantErr        string
+	}{
+		{
+			desc: "ok",
+			manifest: `{
+  "a/z.go": "example.com/a",
+  "a/b.go": "example.com/a",
+  "root.go": "example.com"
+}`,
+			want: map[string][]generatedSrc{
+				"a": {
+					{name: "b.go", importPath: "example.com/a"},
+					{name: "z.go", importPath: "example.com/a"},
+				},
+				"": {{name: "root.go", importPath: "example.com"}},
+			},
+		}, {
+			desc:     "not_relative",
+			manifest: `{"../a.go": "example.com/a"}`,
+			wantErr:  "not a clean path",
+		}, {
+			desc:     "no_import_path",
+			manifest: `{"a/a.go": ""}`,
+			wantErr:  "no import path",
+		}, {
+			desc:     "conflicting_import_paths",
+			manifest: `{"a/a.go": "example.com/a", "a/b.go": "example.com/b"}`,
+			wantErr:  "different import paths",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "manifest.json")
+			if err := os.WriteFile(path, []byte(tc.manifest), 0o666); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadGeneratedSrcsManifest(path)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v; want error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %#v; want %#v", got, tc.want)
+			}
+		})
+	}
+}
@@ -47,7 +47,35 @@ var goKinds = map[string]rule.KindInfo{
 			"embedsrcs": true,
 			"srcs":      true,
 		},
-		ResolveAttrs: map[string]bool{"deps": true},
+		ResolveAttrs: map[string]bool{"deps": true, "embedsrcs": true},
+		KnownAttrs: map[string]bool{
+			"basename":    true,
+			"cdeps":       true,
+			"cgo":         true,
+			"clinkopts":   true,
+			"copts":       true,
+			"cppopts":     true,
+			"cxxopts":     true,
+			"data":        true,
+			"deps":        true,
+			"embed":       true,
+			"embedsrcs":   true,
+			"gc_goopts":   true,
+			"gc_linkopts": true,
+			"goarch":      true,
+			"goos":        true,
+			"gotags":      true,
+			"importpath":  true,
+			"linkmode":    true,
+			"msan":        true,
+			"out":         true,
+			"pgoprofile":  true,
+			"pure":        true,
+			"race":        true,
+			"srcs":        true,
+			"static":      true,
+			"x_defs":      true,
+		},
 	},
 	"go_library": {
 		MatchAttrs: []string{"importpath"},
@@ -71,7 +99,25 @@ var goKinds = map[string]rule.KindInfo{
 			"importpath": true,
 			"srcs":       true,
 		},
-		ResolveAttrs: map[string]bool{"deps": true},
+		ResolveAttrs: map[string]bool{"deps": true, "embedsrcs": true},
+		KnownAttrs: map[string]bool{
+			"cdeps":              true,
+			"cgo":                true,
+			"clinkopts":          true,
+			"copts":              true,
+			"cppopts":            true,
+			"cxxopts":            true,
+			"data":               true,
+			"deps":               true,
+			"embed":              true,
+			"embedsrcs":          true,
+			"gc_goopts":          true,
+			"importmap":          true,
+			"importpath":         true,
+			"importpath_aliases": true,
+			"srcs":               true,
+			"x_defs":             true,
+		},
 	},
 	"go_proto_library": {
 		MatchAttrs: []string{"importpath"},
@@ -136,7 +182,34 @@ var goKinds = map[string]rule.KindInfo{
 			"embedsrcs": true,
 			"srcs":      true,
 		},
-		ResolveAttrs: map[string]bool{"deps": true},
+		ResolveAttrs: map[string]bool{"deps": true, "embedsrcs": true},
+		KnownAttrs: map[string]bool{
+			"cdeps":       true,
+			"cgo":         true,
+			"clinkopts":   true,
+			"copts":       true,
+			"cppopts":     true,
+			"cxxopts":     true,
+			"data":        true,
+			"deps":        true,
+			"embed":       true,
+			"embedsrcs":   true,
+			"gc_goopts":   true,
+			"gc_linkopts": true,
+			"goarch":      true,
+			"goos":        true,
+			"gotags":      true,
+			"importpath":  true,
+			"linkmode":    true,
+			"msan":        true,
+			"pgoprofile":  true,
+			"pure":        true,
+			"race":        true,
+			"rundir":      true,
+			"srcs":        true,
+			"static":      true,
+			"x_defs":      true,
+		},
 	},
 	// HACK(#834): remove when bazelbuild/rules_go#2374 is resolved.
 	"go_tool_library": {
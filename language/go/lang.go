@@ -20,7 +20,7 @@ limitations under the License.
 //
 // Go rules support the flags -build_tags, -go_prefix, and -external.
 // They also support the directives # gazelle:build_tags, # gazelle:prefix,
-// and # gazelle:importmap_prefix. See
+// and # gazelle:go_importmap_prefix. See
 // https://github.com/bazelbuild/bazel-gazelle/blob/master/README.rst#directives
 // for information on these.
 //
@@ -53,7 +53,11 @@ limitations under the License.
 // Known Types and Google APIs. rules_go declares canonical rules for these.
 package golang
 
-import "github.com/bazelbuild/bazel-gazelle/language"
+import (
+	"sync"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+)
 
 const goName = "go"
 
@@ -62,6 +66,12 @@ type goLang struct {
 	// Go code. If the value is false, it means the directory does not contain
 	// buildable Go code, but it has a subdir which does.
 	goPkgRels map[string]bool
+
+	// unresolved lists imports that couldn't be resolved in directories
+	// where strict_deps is set. See ResolveErrors. It's guarded by mu, since
+	// Resolve may be called concurrently.
+	mu         sync.Mutex
+	unresolved []error
 }
 
 func (*goLang) Name() string { return goName }
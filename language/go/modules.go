@@ -18,6 +18,7 @@ package golang
 import (
 	"bytes"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -38,8 +39,25 @@ func importReposFromModules(args language.ImportReposArgs) language.ImportReposR
 	}
 
 	// Load sums from go.sum. Ideally, they're all there.
-	goSumPath := filepath.Join(filepath.Dir(args.Path), "go.sum")
-	data, _ = os.ReadFile(goSumPath)
+	loadGoSum(filepath.Join(filepath.Dir(args.Path), "go.sum"), pathToModule)
+
+	pathToModule, err = fillMissingSums(pathToModule)
+	if err != nil {
+		return language.ImportReposResult{Error: fmt.Errorf("finding module sums: %v", err)}
+	}
+
+	if report := compatReport(getGoConfig(args.Config), pathToModule); report != "" {
+		log.Print(report)
+	}
+
+	return language.ImportReposResult{Gen: toRepositoryRules(pathToModule)}
+}
+
+// loadGoSum sets the sums of modules in pathToModule from the go.sum file
+// at goSumPath. Missing files and modules without sums are ignored; callers
+// should use fillMissingSums afterward.
+func loadGoSum(goSumPath string, pathToModule map[string]*moduleFromList) {
+	data, _ := os.ReadFile(goSumPath)
 	lines := bytes.Split(data, []byte("\n"))
 	for _, line := range lines {
 		line = bytes.TrimSpace(line)
@@ -55,11 +73,4 @@ func importReposFromModules(args language.ImportReposArgs) language.ImportReposR
 			mod.Sum = sum
 		}
 	}
-
-	pathToModule, err = fillMissingSums(pathToModule)
-	if err != nil {
-		return language.ImportReposResult{Error: fmt.Errorf("finding module sums: %v", err)}
-	}
-
-	return language.ImportReposResult{Gen: toRepositoryRules(pathToModule)}
 }
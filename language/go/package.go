@@ -16,12 +16,15 @@ limitations under the License.
 package golang
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"path"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"unicode"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/language/proto"
@@ -35,6 +38,7 @@ type goPackage struct {
 	name, dir, rel        string
 	library, binary, test goTarget
 	tests                 []goTarget
+	tagTests              []goTarget
 	proto                 protoTarget
 	hasTestdata           bool
 	hasMainFunction       bool
@@ -46,14 +50,45 @@ type goPackage struct {
 type goTarget struct {
 	sources, embedSrcs, imports, cppopts, copts, cxxopts, clinkopts platformStringsBuilder
 	cgo, hasInternalTest                                            bool
+
+	// testFuncs is the number of test functions in the target's files.
+	testFuncs int
+
+	// unresolvedEmbeds lists go:embed patterns that name a single file and
+	// didn't match any file in the package. They may be resolved to targets
+	// in other packages or repositories with the rule index.
+	unresolvedEmbeds []fileEmbed
+
+	// fuzzFuncs are the names of the fuzz functions declared in a test
+	// target's files when go_generate_fuzz_targets is set. Each one gets its
+	// own target.
+	fuzzFuncs []string
+
+	// testTag is the build tag required by the files of a test target
+	// generated for the go_test_tag_targets directive. It is empty for other
+	// targets.
+	testTag string
+
+	// importFiles maps each import path to the names of the target's files
+	// that import it. It's only set when Config.RecordProvenance is set.
+	importFiles map[string][]string
 }
 
+// importFilesKey is the private attribute that holds goTarget.importFiles,
+// so the files may be named in the provenance of resolved dependencies.
+const importFilesKey = "_go_import_files"
+
 // protoTarget contains information used to generate a go_proto_library rule.
 type protoTarget struct {
 	name        string
+	protoPkg    string
 	sources     platformStringsBuilder
 	imports     platformStringsBuilder
 	hasServices bool
+
+	// hasHTTPAnnotations and hasValidateRules are copied from proto.Package.
+	// They are used with the proto_grpc_gateway and proto_validate directives.
+	hasHTTPAnnotations, hasValidateRules bool
 }
 
 // platformStringsBuilder is used to construct rule.PlatformStrings. Bazel
@@ -71,6 +106,11 @@ type platformStringInfo struct {
 	osConstraints       map[string]bool
 	archConstraints     map[string]bool
 	platformConstraints map[rule.PlatformConstraint]bool
+
+	// tagConstraints holds the select condition for a custom build tag
+	// declared with # gazelle:go_build_tag: the config_setting label, or
+	// the label prefixed with "!" for strings needed when the tag isn't set.
+	tagConstraints map[string]bool
 }
 
 type platformStringSet int
@@ -80,6 +120,7 @@ const (
 	osSet
 	archSet
 	platformSet
+	tagSet
 )
 
 // Matches a package version, eg. the end segment of 'example.com/foo/v1'
@@ -109,6 +150,10 @@ func (pkg *goPackage) addFile(c *config.Config, er *embedResolver, info fileInfo
 		if info.isCgo {
 			return fmt.Errorf("%s: use of cgo in test not supported", info.path)
 		}
+		if tag := requiredTestTag(c, info); tag != "" {
+			pkg.addTagTestFile(c, er, info, tag)
+			return nil
+		}
 		if getGoConfig(c).testMode == fileTestMode || len(pkg.tests) == 0 {
 			pkg.tests = append(pkg.tests, goTarget{})
 		}
@@ -120,6 +165,12 @@ func (pkg *goPackage) addFile(c *config.Config, er *embedResolver, info fileInfo
 		if !info.isExternalTest {
 			test.hasInternalTest = true
 		}
+		if getGoConfig(c).goGenerateFuzzTargets {
+			// Each fuzz function also gets its own target, built from the
+			// same files as the test that contains it, so it may use
+			// helpers declared in other test files.
+			test.fuzzFuncs = append(test.fuzzFuncs, info.fuzzFuncs...)
+		}
 	default:
 		pkg.hasMainFunction = pkg.hasMainFunction || info.hasMainFunction
 		pkg.library.addFile(c, er, info)
@@ -128,6 +179,47 @@ func (pkg *goPackage) addFile(c *config.Config, er *embedResolver, info fileInfo
 	return nil
 }
 
+// requiredTestTag returns the first tag listed with the go_test_tag_targets
+// directive that the test file described by info can't be built without.
+// Other tags in the file's constraints are assumed to be satisfied.
+func requiredTestTag(c *config.Config, info fileInfo) string {
+	for _, tag := range getGoConfig(c).goTestTagTargets {
+		if info.tags.empty() || !slices.Contains(info.tags.tags(), tag) {
+			continue
+		}
+		if !info.tags.eval(func(t string) bool { return t != tag }) {
+			return tag
+		}
+	}
+	return ""
+}
+
+// addTagTestFile adds a test file that requires tag to the test target for
+// that tag. Constraints are evaluated as if tag were passed with
+// build_tags, since the target is built with it in gotags.
+func (pkg *goPackage) addTagTestFile(c *config.Config, er *embedResolver, info fileInfo, tag string) {
+	var test *goTarget
+	for i := range pkg.tagTests {
+		if pkg.tagTests[i].testTag == tag {
+			test = &pkg.tagTests[i]
+			break
+		}
+	}
+	if test == nil {
+		pkg.tagTests = append(pkg.tagTests, goTarget{testTag: tag})
+		test = &pkg.tagTests[len(pkg.tagTests)-1]
+	}
+
+	tc := c.Clone()
+	gc := getGoConfig(c).clone()
+	gc.genericTags[tag] = true
+	tc.Exts[goName] = gc
+	test.addFile(tc, er, info)
+	if !info.isExternalTest {
+		test.hasInternalTest = true
+	}
+}
+
 // isCommand returns true if the package name is "main".
 func (pkg *goPackage) isCommand() bool {
 	return pkg.name == "main" && pkg.hasMainFunction
@@ -225,6 +317,17 @@ func libNameByConvention(nc namingConvention, imp string, pkgName string) string
 	return name
 }
 
+// protoLibNameByConvention returns a suitable name for a go_library that
+// embeds a go_proto_library. It's the same as libNameByConvention, except
+// with pbSuffixNamingConvention, which adds a "_pb" suffix.
+func protoLibNameByConvention(nc namingConvention, imp string, pkgName string) string {
+	name := libNameByConvention(nc, imp, pkgName)
+	if nc == pbSuffixNamingConvention && pkgName != "main" {
+		name += "_pb"
+	}
+	return name
+}
+
 // testNameByConvention returns a suitable name for a go_test using the given
 // naming convention and the import path.
 func testNameByConvention(nc namingConvention, imp string) string {
@@ -238,6 +341,30 @@ func testNameByConvention(nc namingConvention, imp string) string {
 	return libName + "_test"
 }
 
+// testName returns the name of the go_test generated for pkg, from the
+// go_test_name directive if it's set, or the naming convention otherwise.
+func testName(c *config.Config, pkg *goPackage) string {
+	gc := getGoConfig(c)
+	if gc.goTestName != "" {
+		return expandNameTemplate(gc.goTestName, binName(pkg.rel, gc.prefix, c.RepoRoot))
+	}
+	return testNameByConvention(gc.goNamingConvention, pkg.importPath)
+}
+
+// expandNameTemplate returns the rule name for a template set with the
+// go_test_name or go_test_suite directives, with "{dirname}" replaced by
+// dirname.
+func expandNameTemplate(template, dirname string) string {
+	return strings.ReplaceAll(template, "{dirname}", dirname)
+}
+
+// testNameForTag returns the name of the go_test generated for a tag listed
+// with the go_test_tag_targets directive. For example, "foo_test" becomes
+// "foo_integration_test".
+func testNameForTag(testName, tag string) string {
+	return strings.TrimSuffix(testName, "_test") + "_" + tag + "_test"
+}
+
 // testNameFromSingleSource returns a suitable name for a go_test using the
 // single Go source file name.
 func testNameFromSingleSource(src string) string {
@@ -254,6 +381,25 @@ func testNameFromSingleSource(src string) string {
 	return libName + "_test"
 }
 
+// testNameFromFuzzFunc returns a suitable name for a go_test that runs a
+// single fuzz function. For example, "FuzzParseURL" becomes
+// "fuzz_parse_url_test".
+func testNameFromFuzzFunc(fn string) string {
+	var b strings.Builder
+	runes := []rune(fn)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String() + "_test"
+}
+
 // binName returns a suitable name for a go_binary.
 func binName(rel, prefix, repoRoot string) string {
 	return pathtools.RelBaseName(rel, prefix, repoRoot)
@@ -299,13 +445,25 @@ func goProtoImportPath(c *config.Config, pkg proto.Package, rel string) string {
 
 func (t *goTarget) addFile(c *config.Config, er *embedResolver, info fileInfo) {
 	t.cgo = t.cgo || info.isCgo
+	t.testFuncs += info.testFuncs
 	add := getPlatformStringsAddFunction(c, info, nil)
 	add(&t.sources, info.name)
 	add(&t.imports, info.imports...)
+	if c.RecordProvenance {
+		if t.importFiles == nil {
+			t.importFiles = make(map[string][]string)
+		}
+		for _, imp := range info.imports {
+			t.importFiles[imp] = append(t.importFiles[imp], info.name)
+		}
+	}
 	if er != nil {
 		for _, embed := range info.embeds {
 			embedSrcs, err := er.resolve(embed)
-			if err != nil {
+			if errors.Is(err, errEmbedNoMatch) && isLiteralEmbedPattern(embed.path) {
+				t.unresolvedEmbeds = append(t.unresolvedEmbeds, embed)
+				continue
+			} else if err != nil {
 				log.Print(err)
 				continue
 			}
@@ -343,7 +501,7 @@ func (t *goTarget) addFile(c *config.Config, er *embedResolver, info fileInfo) {
 }
 
 func protoTargetFromProtoPackage(name string, pkg proto.Package) protoTarget {
-	target := protoTarget{name: name}
+	target := protoTarget{name: name, protoPkg: pkg.Name}
 	for _, fInfo := range pkg.Files {
 		target.sources.addGenericString(fInfo.Path)
 	}
@@ -351,6 +509,8 @@ func protoTargetFromProtoPackage(name string, pkg proto.Package) protoTarget {
 		target.imports.addGenericString(i)
 	}
 	target.hasServices = pkg.HasServices
+	target.hasHTTPAnnotations = pkg.HasHTTPAnnotations
+	target.hasValidateRules = pkg.HasValidateRules
 	return target
 }
 
@@ -367,7 +527,14 @@ func (t *protoTarget) addFile(info fileInfo) {
 // performance optimization to avoid evaluating constraints repeatedly.
 func getPlatformStringsAddFunction(c *config.Config, info fileInfo, cgoTags *cgoTagsAndOpts) func(sb *platformStringsBuilder, ss ...string) {
 	isOSSpecific, isArchSpecific := isOSArchSpecific(info, cgoTags)
+	if custom := customBuildTags(c, info, cgoTags); len(custom) > 0 {
+		if len(custom) == 1 && !isOSSpecific && !isArchSpecific {
+			return getCustomTagAddFunction(c, info, cgoTags, custom[0])
+		}
+		log.Printf("%s: build constraints depend on %s declared with go_build_tag; only constraints with a single custom tag and no OS or architecture can be translated to select expressions, so the tags are treated as unset", info.path, strings.Join(custom, ", "))
+	}
 	v := getGoConfig(c).rulesGoVersion
+	excludedOS := getGoConfig(c).excludedOS
 	constraintPrefix := "@" + getGoConfig(c).rulesGoRepoName + "//go/platform:"
 
 	switch {
@@ -383,7 +550,7 @@ func getPlatformStringsAddFunction(c *config.Config, info fileInfo, cgoTags *cgo
 	case isOSSpecific && !isArchSpecific:
 		var osMatch []string
 		for _, os := range rule.KnownOSs {
-			if rulesGoSupportsOS(v, os) &&
+			if rulesGoSupportsOS(v, os) && !excludedOS[os] &&
 				checkConstraints(c, os, "", info.goos, info.goarch, info.tags, cgoTags) {
 				osMatch = append(osMatch, os)
 			}
@@ -415,7 +582,7 @@ func getPlatformStringsAddFunction(c *config.Config, info fileInfo, cgoTags *cgo
 	default:
 		var platformMatch []rule.Platform
 		for _, platform := range rule.KnownPlatforms {
-			if rulesGoSupportsPlatform(v, platform) &&
+			if rulesGoSupportsPlatform(v, platform) && !excludedOS[platform.OS] &&
 				checkConstraints(c, platform.OS, platform.Arch, info.goos, info.goarch, info.tags, cgoTags) {
 				platformMatch = append(platformMatch, platform)
 			}
@@ -432,6 +599,37 @@ func getPlatformStringsAddFunction(c *config.Config, info fileInfo, cgoTags *cgo
 	return func(_ *platformStringsBuilder, _ ...string) {}
 }
 
+// getCustomTagAddFunction returns a function used to add strings from a file
+// whose build constraints depend on tag, a custom build tag declared with
+// # gazelle:go_build_tag. Strings are added to a select expression with the
+// tag's config_setting as the condition if they're only needed when the tag
+// is set, or to the default case if they're only needed when it isn't.
+func getCustomTagAddFunction(c *config.Config, info fileInfo, cgoTags *cgoTagsAndOpts, tag string) func(sb *platformStringsBuilder, ss ...string) {
+	setting := getGoConfig(c).buildTagSettings[tag]
+	on := checkConstraintsWithTags(c, "", "", info.goos, info.goarch, info.tags, cgoTags, map[string]bool{tag: true})
+	off := checkConstraintsWithTags(c, "", "", info.goos, info.goarch, info.tags, cgoTags, map[string]bool{tag: false})
+	var cond string
+	switch {
+	case on && off:
+		return func(sb *platformStringsBuilder, ss ...string) {
+			for _, s := range ss {
+				sb.addGenericString(s)
+			}
+		}
+	case on:
+		cond = setting
+	case off:
+		cond = "!" + setting
+	default:
+		return func(_ *platformStringsBuilder, _ ...string) {}
+	}
+	return func(sb *platformStringsBuilder, ss ...string) {
+		for _, s := range ss {
+			sb.addTagString(s, cond)
+		}
+	}
+}
+
 func (sb *platformStringsBuilder) isEmpty() bool {
 	return sb.strs == nil
 }
@@ -464,6 +662,10 @@ func (sb *platformStringsBuilder) addOSString(s string, oss []string, constraint
 	switch si.set {
 	case genericSet:
 		return
+	case tagSet:
+		// A string can't be in a select for a custom build tag and a
+		// platform select at once, so it's needed everywhere.
+		si = platformStringInfo{set: genericSet}
 	case osSet:
 		for _, os := range oss {
 			si.osConstraints[constraintPrefix+os] = true
@@ -494,6 +696,8 @@ func (sb *platformStringsBuilder) addArchString(s string, archs []string, constr
 	switch si.set {
 	case genericSet:
 		return
+	case tagSet:
+		si = platformStringInfo{set: genericSet}
 	case archSet:
 		for _, arch := range archs {
 			si.archConstraints[constraintPrefix+arch] = true
@@ -524,6 +728,8 @@ func (sb *platformStringsBuilder) addPlatformString(s string, platforms []rule.P
 	switch si.set {
 	case genericSet:
 		return
+	case tagSet:
+		si = platformStringInfo{set: genericSet}
 	default:
 		si.convertToPlatforms(constraintPrefix)
 		for _, p := range platforms {
@@ -534,6 +740,27 @@ func (sb *platformStringsBuilder) addPlatformString(s string, platforms []rule.P
 	sb.strs[s] = si
 }
 
+// addTagString adds s to the select expression for a custom build tag. cond
+// is the tag's config_setting label, or the label prefixed with "!" if s is
+// only needed when the tag isn't set. Strings needed in both cases, in
+// selects for more than one tag, or in platform selects are made generic.
+func (sb *platformStringsBuilder) addTagString(s, cond string) {
+	if sb.strs == nil {
+		sb.strs = make(map[string]platformStringInfo)
+	}
+	si, ok := sb.strs[s]
+	if !ok {
+		si.set = tagSet
+		si.tagConstraints = map[string]bool{cond: true}
+		sb.strs[s] = si
+		return
+	}
+	if si.set == tagSet && len(si.tagConstraints) == 1 && si.tagConstraints[cond] {
+		return
+	}
+	sb.strs[s] = platformStringInfo{set: genericSet}
+}
+
 func (sb *platformStringsBuilder) build() rule.PlatformStrings {
 	var ps rule.PlatformStrings
 	for s, si := range sb.strs {
@@ -561,6 +788,13 @@ func (sb *platformStringsBuilder) build() rule.PlatformStrings {
 			for p := range si.platformConstraints {
 				ps.Platform[p] = append(ps.Platform[p], s)
 			}
+		case tagSet:
+			if ps.Tags == nil {
+				ps.Tags = make(map[string][]string)
+			}
+			for cond := range si.tagConstraints {
+				ps.Tags[cond] = append(ps.Tags[cond], s)
+			}
 		}
 	}
 	sort.Strings(ps.Generic)
@@ -579,9 +813,38 @@ func (sb *platformStringsBuilder) build() rule.PlatformStrings {
 			sort.Strings(ss)
 		}
 	}
+	for _, ss := range ps.Tags {
+		sort.Strings(ss)
+	}
 	return ps
 }
 
+// buildTagged is like buildFlat, but strings in selects for custom build
+// tags stay in those selects, since they're only needed with some build
+// settings. Other strings are listed together.
+func (sb *platformStringsBuilder) buildTagged() rule.PlatformStrings {
+	ps := sb.build()
+	var generic []string
+	for s, si := range sb.strs {
+		if si.set != tagSet {
+			generic = append(generic, s)
+		}
+	}
+	sort.Strings(generic)
+	return rule.PlatformStrings{Generic: generic, Tags: ps.Tags}
+}
+
+// hasTagStrings returns whether any strings are in selects for custom build
+// tags.
+func (sb *platformStringsBuilder) hasTagStrings() bool {
+	for _, si := range sb.strs {
+		if si.set == tagSet {
+			return true
+		}
+	}
+	return false
+}
+
 func (sb *platformStringsBuilder) buildFlat() []string {
 	strs := make([]string, 0, len(sb.strs))
 	for s := range sb.strs {
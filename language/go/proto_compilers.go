@@ -0,0 +1,89 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golang
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// compilerOverride sets the compilers of go_proto_library rules for proto
+// packages matching a pattern. Overrides are written in the
+// go_proto_compilers and go_grpc_compilers directives as pattern=label
+// entries, for example, "example.api.*=//compilers:vtproto".
+type compilerOverride struct {
+	pattern   string
+	re        *regexp.Regexp
+	compilers []string
+}
+
+// overrideEntryRe matches an entry of a compilers directive that overrides
+// the compilers for a proto package pattern. Proto package names only
+// contain letters, digits, underscores, and dots, so labels aren't
+// mistaken for patterns.
+var overrideEntryRe = regexp.MustCompile(`^([\w.*]+)=(.*)$`)
+
+// parseCompilers parses the value of a go_proto_compilers or
+// go_grpc_compilers directive. Plain labels are returned in compilers.
+// Entries written as pattern=label are grouped by pattern, in the order each
+// pattern first appears.
+func parseCompilers(value string) (compilers []string, overrides []compilerOverride, err error) {
+	byPattern := make(map[string]int)
+	for _, entry := range splitValue(value) {
+		match := overrideEntryRe.FindStringSubmatch(entry)
+		if match == nil {
+			compilers = append(compilers, entry)
+			continue
+		}
+		pattern, compiler := match[1], strings.TrimSpace(match[2])
+		if compiler == "" {
+			return nil, nil, fmt.Errorf("no compiler for proto package pattern %q", pattern)
+		}
+		i, ok := byPattern[pattern]
+		if !ok {
+			i = len(overrides)
+			byPattern[pattern] = i
+			overrides = append(overrides, compilerOverride{pattern: pattern, re: protoPackagePatternRegexp(pattern)})
+		}
+		overrides[i].compilers = append(overrides[i].compilers, compiler)
+	}
+	return compilers, overrides, nil
+}
+
+// protoPackagePatternRegexp converts a proto package pattern to a regular
+// expression. "*" matches any sequence of characters, including dots, so
+// "example.api.*" matches "example.api.v1" and "example.api.v1.admin".
+func protoPackagePatternRegexp(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// findCompilerOverride returns the compilers of the first override whose
+// pattern matches one of protoPackages, or nil if none match.
+func findCompilerOverride(overrides []compilerOverride, protoPackages []string) []string {
+	for _, o := range overrides {
+		for _, pkg := range protoPackages {
+			if pkg != "" && o.re.MatchString(pkg) {
+				return o.compilers
+			}
+		}
+	}
+	return nil
+}
@@ -22,16 +22,22 @@ import (
 	"log"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language/proto"
+	"github.com/bazelbuild/bazel-gazelle/merger"
 	"github.com/bazelbuild/bazel-gazelle/pathtools"
 	"github.com/bazelbuild/bazel-gazelle/repo"
 	"github.com/bazelbuild/bazel-gazelle/resolve"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 )
 
-func (*goLang) Imports(_ *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
+func (*goLang) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
+	if r.Kind() == "filegroup" {
+		return embedImports(c, r, f)
+	}
 	if !isGoLibrary(r.Kind()) || isExtraLibrary(r) {
 		return nil
 	}
@@ -63,7 +69,18 @@ func (*goLang) Embeds(r *rule.Rule, from label.Label) []label.Label {
 	return embedLabels
 }
 
+// ResolveConcurrently returns true. Unresolved imports are recorded under
+// gl.mu, and lookups of repository roots are memoized in a cache shared by
+// the configurations of all directories.
+func (*goLang) ResolveConcurrently() bool { return true }
+
 func (gl *goLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, importsRaw interface{}, from label.Label) {
+	if r.Kind() == "alias" && r.Name() == defaultLibName && c.IndexLibraries && getGoConfig(c).aliasSunset && r.AttrString("actual") != "" && !ix.IsReferenced(from) {
+		// With go_alias_sunset, the go_default_library alias left for the
+		// import_alias naming convention is deleted once nothing refers to it.
+		r.SetPrivateAttr(merger.UnstableDeleteKey, true)
+		return
+	}
 	if importsRaw == nil {
 		// may not be set in tests.
 		return
@@ -77,11 +94,22 @@ func (gl *goLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.Remo
 	default:
 		resolve = ResolveGo
 	}
+	gc := getGoConfig(c)
+	depImports := make(map[string][]string)
 	deps, errs := imports.Map(func(imp string) (string, error) {
+		if gc.isIgnoredDep(imp) {
+			return "", nil
+		}
 		l, err := resolve(c, ix, rc, imp, from)
 		if err == errSkipImport {
 			return "", nil
 		} else if err != nil {
+			if _, ok := err.(*unresolvedImportError); ok {
+				gl.mu.Lock()
+				gl.unresolved = append(gl.unresolved, err)
+				gl.mu.Unlock()
+				return "", nil
+			}
 			return "", err
 		}
 		for _, embed := range gl.Embeds(r, from) {
@@ -89,21 +117,81 @@ func (gl *goLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.Remo
 				return "", nil
 			}
 		}
+		if c.RecordProvenance {
+			addDepProvenance(c, ix, r, imp, l, from)
+		}
 		l = l.Rel(from.Repo, from.Pkg)
+		depImports[l.String()] = append(depImports[l.String()], imp)
 		return l.String(), nil
 	})
 	for _, err := range errs {
 		log.Print(err)
 	}
+	if embeds, ok := r.PrivateAttr(unresolvedEmbedsKey).([]fileEmbed); ok {
+		resolveEmbeds(c, ix, r, embeds, from)
+	}
 	if !deps.IsEmpty() {
 		if r.Kind() == "go_proto_library" {
 			// protos may import the same library multiple times by different names,
 			// so we need to de-duplicate them. Protos are not platform-specific,
 			// so it's safe to just flatten them.
 			r.SetAttr("deps", deps.Flat())
+		} else if !gc.useSelect("deps", true) {
+			// go_select turns off select expressions for deps, so the deps for
+			// all platforms are listed together.
+			r.SetAttr("deps", deps.Flat())
 		} else {
 			r.SetAttr("deps", deps)
 		}
+		if c.AnnotateDeps {
+			r.SetImportComments("deps", depImports)
+		}
+		if gc.groupDeps {
+			r.SetAttrGroups("deps", depGroup)
+		}
+	}
+}
+
+// ResolveImport resolves a Go import path with ResolveGo. Standard library
+// imports need no dependency, so label.NoLabel is returned for them. Other
+// imports ResolveGo would skip, like imports of unknown repositories with
+// -external=static, are reported as errors.
+func (*goLang) ResolveImport(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, imp string, from label.Label) (label.Label, error) {
+	if IsStandard(imp) {
+		return label.NoLabel, nil
+	}
+	l, err := ResolveGo(c, ix, rc, imp, from)
+	if err == errSkipImport {
+		return label.NoLabel, fmt.Errorf("no rule provides %q", imp)
+	}
+	return l, err
+}
+
+// addDepProvenance records why the dependency on l, resolved from the import
+// imp, is in the deps of r.
+func addDepProvenance(c *config.Config, ix *resolve.RuleIndex, r *rule.Rule, imp string, l, from label.Label) {
+	spec := resolve.ImportSpec{Lang: "go", Imp: imp}
+	if r.Kind() == "go_proto_library" {
+		spec.Lang = "proto"
+	}
+	files, _ := r.PrivateAttr(importFilesKey).(map[string][]string)
+	reason := resolve.ImportProvenance(c, ix, spec, "go", files[imp], l)
+	r.AddProvenance("deps", l.Rel(from.Repo, from.Pkg).String(), reason)
+}
+
+// depGroup returns the group of a dependency label for # gazelle:go_group_deps.
+// Repositories for golang.org/x modules come first, since they're almost
+// part of the standard library, then targets in this repository, then
+// targets in other repositories.
+func depGroup(dep string) rule.StringGroup {
+	l, err := label.Parse(dep)
+	switch {
+	case err == nil && strings.HasPrefix(l.Repo, "org_golang_x_"):
+		return rule.StringGroup{Order: 0, Name: "golang.org/x"}
+	case err != nil || l.Repo == "":
+		return rule.StringGroup{Order: 1, Name: "internal"}
+	default:
+		return rule.StringGroup{Order: 2, Name: "external"}
 	}
 }
 
@@ -112,6 +200,28 @@ var (
 	errNotFound   = errors.New("rule not found")
 )
 
+// unresolvedImportError is returned by ResolveGo with strict_deps when an
+// import can't be resolved to an indexed rule, a known repository, or the
+// standard library.
+type unresolvedImportError struct {
+	from label.Label
+	imp  string
+}
+
+func (e *unresolvedImportError) Error() string {
+	return fmt.Sprintf("%s: import %q is not provided by an indexed rule, a known repository, or the standard library", e.from, e.imp)
+}
+
+// ResolveErrors returns the imports that couldn't be resolved in directories
+// where strict_deps is set since the last call.
+func (gl *goLang) ResolveErrors() []error {
+	gl.mu.Lock()
+	defer gl.mu.Unlock()
+	errs := gl.unresolved
+	gl.unresolved = nil
+	return errs
+}
+
 // ResolveGo resolves a Go import path to a Bazel label, possibly using the
 // given rule index and remote cache. Some special cases may be applied to
 // known proto import paths, depending on the current proto mode.
@@ -142,6 +252,12 @@ func ResolveGo(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, im
 		return label.NoLabel, err
 	}
 
+	if l, err := resolveWithGeneratedSrcsGo(c, ix, imp, from); err == nil || err == errSkipImport {
+		return l, err
+	} else if err != errNotFound {
+		return label.NoLabel, err
+	}
+
 	// Special cases for rules_go and bazel_gazelle.
 	// These have names that don't following conventions and they're
 	// typeically declared with http_archive, not go_repository, so Gazelle
@@ -161,8 +277,18 @@ func ResolveGo(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, im
 		// current repo
 		if pathtools.HasPrefix(imp, gc.prefix) {
 			pkg := path.Join(gc.prefixRel, pathtools.TrimPrefix(imp, gc.prefix))
-			libName := libNameByConvention(gc.goNamingConvention, imp, "")
-			return label.New("", pkg, libName), nil
+			if !gc.crossesModules(from.Pkg, pkg) {
+				return label.New("", pkg, gc.libNameInPkg(pkg, imp)), nil
+			}
+		}
+	}
+
+	// Modules in the go.work file are built from their local directories,
+	// so imports within them are never resolved to external repositories.
+	for _, m := range gc.workModules {
+		if pathtools.HasPrefix(imp, m.modulePath) {
+			pkg := path.Join(m.rel, pathtools.TrimPrefix(imp, m.modulePath))
+			return label.New("", pkg, gc.libNameInPkg(pkg, imp)), nil
 		}
 	}
 
@@ -170,14 +296,68 @@ func ResolveGo(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, im
 		return resolveVendored(gc, imp)
 	}
 	var resolveFn func(string) (string, string, error)
-	if gc.depMode == staticMode {
-		resolveFn = rc.RootStatic
+	if gc.externalRepos != nil {
+		resolveFn = gc.externalRepos.root
+	} else if gc.depMode == staticMode || gc.strictDeps {
+		// With strict_deps, only known repositories are used, rather than
+		// repositories named by convention after a network lookup.
+		resolveFn = gc.roots.memo(rc, rootStatic, rc.RootStatic)
 	} else if gc.moduleMode || pathWithoutSemver(imp) != "" {
-		resolveFn = rc.Mod
+		resolveFn = gc.roots.memo(rc, rootMod, rc.Mod)
 	} else {
-		resolveFn = rc.Root
+		resolveFn = gc.roots.memo(rc, rootRemote, rc.Root)
 	}
-	return resolveToExternalLabel(c, resolveFn, imp)
+	l, err := resolveToExternalLabel(c, resolveFn, imp)
+	if gc.strictDeps && (err == errSkipImport || err != nil && gc.externalRepos != nil) {
+		return label.NoLabel, &unresolvedImportError{from: from, imp: imp}
+	}
+	return l, err
+}
+
+// libNameInPkg returns the name of the go_library with the import path imp in
+// the package pkg, when the library isn't found in the index. The name pinned
+// with # gazelle:go_library_name is used if there is one.
+func (gc *goConfig) libNameInPkg(pkg, imp string) string {
+	if name, ok := gc.libraryNames[pkg]; ok {
+		return name
+	}
+	return libNameByConvention(gc.goNamingConvention, imp, "")
+}
+
+// moduleRel returns the directory of the innermost module containing the
+// package pkg, or "" if pkg isn't in a module below the repository root.
+func (gc *goConfig) moduleRel(pkg string) string {
+	moduleRel := ""
+	for rel := range gc.moduleRoots.get() {
+		if len(rel) > len(moduleRel) && pathtools.HasPrefix(pkg, rel) {
+			moduleRel = rel
+		}
+	}
+	return moduleRel
+}
+
+// crossesModules returns whether a dependency of the package fromPkg on the
+// package toPkg in the same repository crosses a module boundary. Modules
+// that are both listed in the go.work file aren't separated by a boundary.
+// Without go_module_boundaries, there are no boundaries.
+func (gc *goConfig) crossesModules(fromPkg, toPkg string) bool {
+	if !gc.moduleBoundaries || gc.moduleRoots == nil {
+		return false
+	}
+	fromRel, toRel := gc.moduleRel(fromPkg), gc.moduleRel(toPkg)
+	if fromRel == toRel {
+		return false
+	}
+	return !gc.isWorkModule(fromRel) || !gc.isWorkModule(toRel)
+}
+
+func (gc *goConfig) isWorkModule(rel string) bool {
+	for _, m := range gc.workModules {
+		if m.rel == rel {
+			return true
+		}
+	}
+	return false
 }
 
 // IsStandard returns whether a package is in the standard library.
@@ -192,7 +372,8 @@ func resolveWithIndexGo(c *config.Config, ix *resolve.RuleIndex, imp string, fro
 	var bestMatchVendorRoot string
 	var bestMatchEmbedsProtos bool
 	var matchError error
-	goRepositoryMode := getGoConfig(c).goRepositoryMode
+	gc := getGoConfig(c)
+	goRepositoryMode := gc.goRepositoryMode
 
 	for _, m := range matches {
 		// Apply vendoring logic for Go libraries. A library in a vendor directory
@@ -218,6 +399,11 @@ func resolveWithIndexGo(c *config.Config, ix *resolve.RuleIndex, imp string, fro
 			// vendor directory not visible
 			continue
 		}
+		if m.Label.Repo == from.Repo && gc.crossesModules(from.Pkg, m.Label.Pkg) {
+			// Other modules in the repository are built from their own
+			// repositories unless go.work or a resolve directive says otherwise.
+			continue
+		}
 
 		embedsProtos := false
 		for _, embed := range m.Embeds {
@@ -257,6 +443,86 @@ func resolveWithIndexGo(c *config.Config, ix *resolve.RuleIndex, imp string, fro
 	return bestMatch.Label, nil
 }
 
+// resolveWithGeneratedSrcsGo resolves imp, a package in the current
+// repository, to a library whose srcs include Go files generated into the
+// package's directory by other rules, such as a genrule. This handles
+// packages without their own rules, which would otherwise be resolved to a
+// conventional label in the package's directory.
+func resolveWithGeneratedSrcsGo(c *config.Config, ix *resolve.RuleIndex, imp string, from label.Label) (label.Label, error) {
+	gc := getGoConfig(c)
+	if !c.IndexLibraries || !pathtools.HasPrefix(imp, gc.prefix) {
+		return label.NoLabel, errNotFound
+	}
+	dir := path.Join(gc.prefixRel, pathtools.TrimPrefix(imp, gc.prefix))
+	var matches []label.Label
+	for _, m := range ix.FindRulesByGeneratedSrcDir(from.Repo, dir, resolve.ImportSpec{Lang: "go", Imp: imp}, "go") {
+		if gc.crossesModules(from.Pkg, m.Label.Pkg) {
+			continue
+		}
+		matches = append(matches, m.Label)
+	}
+	switch len(matches) {
+	case 0:
+		return label.NoLabel, errNotFound
+	case 1:
+		if matches[0].Equal(from) {
+			return label.NoLabel, errSkipImport
+		}
+		return matches[0], nil
+	default:
+		return label.NoLabel, fmt.Errorf("rule %s imports %q whose generated sources are in multiple rules: %s and %s. # gazelle:resolve may be used to disambiguate", from, imp, matches[0], matches[1])
+	}
+}
+
+// rootCache memoizes the repository roots of import paths looked up in a
+// repo.RemoteCache. The same packages are usually imported by many rules, and
+// each lookup otherwise checks every parent of the import path in the remote
+// cache. It may be used concurrently.
+type rootCache struct {
+	m sync.Map // rootKey -> rootResult
+}
+
+// rootMethod identifies the repo.RemoteCache method a root was looked up
+// with, since they may return different roots for the same import path.
+type rootMethod int
+
+const (
+	rootStatic rootMethod = iota
+	rootMod
+	rootRemote
+)
+
+type rootKey struct {
+	rc     *repo.RemoteCache
+	method rootMethod
+	imp    string
+}
+
+type rootResult struct {
+	prefix, name string
+	err          error
+}
+
+// memo returns a function that calls lookup, the method of rc identified
+// by method, once for each import path. If rcache is nil, lookup is
+// returned.
+func (rcache *rootCache) memo(rc *repo.RemoteCache, method rootMethod, lookup func(string) (string, string, error)) func(string) (string, string, error) {
+	if rcache == nil {
+		return lookup
+	}
+	return func(imp string) (string, string, error) {
+		key := rootKey{rc: rc, method: method, imp: imp}
+		if v, ok := rcache.m.Load(key); ok {
+			res := v.(rootResult)
+			return res.prefix, res.name, res.err
+		}
+		var res rootResult
+		res.prefix, res.name, res.err = lookup(imp)
+		rcache.m.Store(key, res)
+		return res.prefix, res.name, res.err
+	}
+}
+
 func resolveToExternalLabel(c *config.Config, resolveFn func(string) (string, string, error), imp string) (label.Label, error) {
 	prefix, repo, err := resolveFn(imp)
 	if err != nil {
@@ -297,6 +563,10 @@ func resolveToExternalLabel(c *config.Config, resolveFn func(string) (string, st
 		}
 	}
 
+	// With pb_suffix, libraries generated from protos have a "_pb" suffix,
+	// but the import path doesn't show whether a package is one of them.
+	// go_repository generates an alias without the suffix for each, so the
+	// name without the suffix works for every package.
 	name := libNameByConvention(nc, imp, "")
 	return label.New(repo, pkg, name), nil
 }
@@ -326,13 +596,15 @@ func resolveProto(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache,
 	// package name matches the directory base name. We also assume that protos
 	// in the vendor directory must refer to something else in vendor.
 	rel := path.Dir(imp)
+	if p, ok := proto.FindIncludedFile(c, imp); ok {
+		rel = path.Dir(p)
+	} else if from.Pkg == "vendor" || strings.HasPrefix(from.Pkg, "vendor/") {
+		rel = path.Join("vendor", rel)
+	}
 	if rel == "." {
 		rel = ""
 	}
-	if from.Pkg == "vendor" || strings.HasPrefix(from.Pkg, "vendor/") {
-		rel = path.Join("vendor", rel)
-	}
-	libName := libNameByConvention(getGoConfig(c).goNamingConvention, imp, "")
+	libName := protoLibNameByConvention(getGoConfig(c).goNamingConvention, imp, "")
 	return label.New("", rel, libName), nil
 }
 
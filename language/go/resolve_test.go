@@ -536,6 +536,32 @@ go_binary(
     name = "bin",
     deps = ["//vendor/example.com/outside/prefix"],
 )
+`,
+		}, {
+			desc: "ignore_dep",
+			index: []buildFile{{
+				content: `
+# gazelle:ignore_dep example.com/optional/a, example.com/optional/b
+`,
+			}},
+			old: buildFile{
+				rel: "sub",
+				content: `
+go_binary(
+    name = "bin",
+    _imports = [
+        "example.com/optional/a",
+        "example.com/optional/b",
+        "example.com/outside/prefix",
+    ],
+)
+`,
+			},
+			want: `
+go_binary(
+    name = "bin",
+    deps = ["//vendor/example.com/outside/prefix"],
+)
 `,
 		}, {
 			desc:             "vendor with go_naming_convention=import",
@@ -1322,3 +1348,53 @@ type mapResolver map[string]resolve.Resolver
 func (mr mapResolver) Resolver(r *rule.Rule, f string) resolve.Resolver {
 	return mr[r.Kind()]
 }
+
+func TestImportPathTrie(t *testing.T) {
+	var trie importPathTrie
+	trie.add("example.com/a", "com_example_a")
+	trie.add("example.com/a/b/v2", "com_example_a_b_v2")
+	trie.add("example.org", "org_example")
+	for _, tc := range []struct {
+		imp, wantPrefix, wantName string
+	}{
+		{imp: "example.com/a", wantPrefix: "example.com/a", wantName: "com_example_a"},
+		{imp: "example.com/a/b", wantPrefix: "example.com/a", wantName: "com_example_a"},
+		{imp: "example.com/a/b/v2/c", wantPrefix: "example.com/a/b/v2", wantName: "com_example_a_b_v2"},
+		{imp: "example.com/ab"},
+		{imp: "example.com"},
+		{imp: "example.org/x/y", wantPrefix: "example.org", wantName: "org_example"},
+	} {
+		t.Run(tc.imp, func(t *testing.T) {
+			prefix, name := trie.longestPrefix(tc.imp)
+			if prefix != tc.wantPrefix || name != tc.wantName {
+				t.Errorf("got (%q, %q); want (%q, %q)", prefix, name, tc.wantPrefix, tc.wantName)
+			}
+		})
+	}
+}
+
+func TestRootCache(t *testing.T) {
+	rc, cleanup := repo.NewRemoteCache(nil)
+	defer cleanup()
+	calls := 0
+	lookup := func(imp string) (string, string, error) {
+		calls++
+		return "example.com/repo", "com_example_repo", nil
+	}
+	var rcache rootCache
+	memo := rcache.memo(rc, rootRemote, lookup)
+	for i := 0; i < 3; i++ {
+		if prefix, name, err := memo("example.com/repo/lib"); err != nil || prefix != "example.com/repo" || name != "com_example_repo" {
+			t.Fatalf("got (%q, %q, %v); want (%q, %q, nil)", prefix, name, err, "example.com/repo", "com_example_repo")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("lookup called %d times; want 1", calls)
+	}
+	if _, _, err := rcache.memo(rc, rootStatic, lookup)("example.com/repo/lib"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("lookup called %d times after lookup with another method; want 2", calls)
+	}
+}
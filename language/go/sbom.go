@@ -0,0 +1,163 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golang
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"golang.org/x/mod/semver"
+)
+
+// isSBOMFile returns whether the file at path is named like an SPDX or
+// CycloneDX SBOM in JSON format.
+func isSBOMFile(path string) bool {
+	base := strings.ToLower(filepath.Base(path))
+	return base == "bom.json" || strings.HasSuffix(base, ".spdx.json") || strings.HasSuffix(base, ".cdx.json")
+}
+
+// importReposFromSBOM imports repositories from an SPDX or CycloneDX SBOM in
+// JSON format. Go modules are identified by "pkg:golang/" package URLs, which
+// give their paths and versions. Sums are read from the go.sum file next to
+// the SBOM, if there is one. Missing sums are downloaded.
+func importReposFromSBOM(args language.ImportReposArgs) language.ImportReposResult {
+	data, err := os.ReadFile(args.Path)
+	if err != nil {
+		return language.ImportReposResult{Error: err}
+	}
+	pathToModule, err := parseSBOM(data)
+	if err != nil {
+		return language.ImportReposResult{Error: fmt.Errorf("%s: %v", args.Path, err)}
+	}
+
+	loadGoSum(filepath.Join(filepath.Dir(args.Path), "go.sum"), pathToModule)
+
+	pathToModule, err = fillMissingSums(pathToModule)
+	if err != nil {
+		return language.ImportReposResult{Error: fmt.Errorf("finding module sums: %v", err)}
+	}
+
+	return language.ImportReposResult{Gen: toRepositoryRules(pathToModule)}
+}
+
+// sbom holds the parts of SPDX and CycloneDX documents needed to find Go
+// modules.
+type sbom struct {
+	// SPDXVersion is set in SPDX documents, for example, "SPDX-2.3".
+	SPDXVersion string `json:"spdxVersion"`
+	Packages    []struct {
+		ExternalRefs []struct {
+			ReferenceType    string `json:"referenceType"`
+			ReferenceLocator string `json:"referenceLocator"`
+		} `json:"externalRefs"`
+	} `json:"packages"`
+
+	// BOMFormat is "CycloneDX" in CycloneDX documents.
+	BOMFormat  string               `json:"bomFormat"`
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXComponent struct {
+	PURL       string               `json:"purl"`
+	Components []cycloneDXComponent `json:"components"`
+}
+
+// parseSBOM returns the Go modules listed in an SPDX or CycloneDX document,
+// keyed by path@version. Packages that aren't Go modules are skipped, and
+// so are Go modules without a valid semantic version, like the main module.
+// When a module is listed with several versions, only the highest is kept,
+// since go_repository rules are named after module paths.
+func parseSBOM(data []byte) (map[string]*moduleFromList, error) {
+	var doc sbom
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var purls []string
+	switch {
+	case doc.SPDXVersion != "":
+		for _, p := range doc.Packages {
+			for _, ref := range p.ExternalRefs {
+				if ref.ReferenceType == "purl" {
+					purls = append(purls, ref.ReferenceLocator)
+				}
+			}
+		}
+	case doc.BOMFormat == "CycloneDX":
+		var visit func([]cycloneDXComponent)
+		visit = func(components []cycloneDXComponent) {
+			for _, c := range components {
+				if c.PURL != "" {
+					purls = append(purls, c.PURL)
+				}
+				visit(c.Components)
+			}
+		}
+		visit(doc.Components)
+	default:
+		return nil, fmt.Errorf("not an SPDX or CycloneDX document")
+	}
+
+	versions := map[string]string{}
+	for _, purl := range purls {
+		modPath, version, ok, err := parseGoPURL(purl)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		if !semver.IsValid(version) {
+			log.Printf("skipping module %s with version %q: not a semantic version", modPath, version)
+			continue
+		}
+		if v, ok := versions[modPath]; !ok || semver.Compare(version, v) > 0 {
+			versions[modPath] = version
+		}
+	}
+
+	pathToModule := make(map[string]*moduleFromList, len(versions))
+	for modPath, version := range versions {
+		pathToModule[modPath+"@"+version] = &moduleFromList{Path: modPath, Version: version}
+	}
+	return pathToModule, nil
+}
+
+// parseGoPURL returns the module path and version from a package URL like
+// "pkg:golang/github.com/foo/bar@v1.2.3". ok is false for package URLs of
+// other types.
+func parseGoPURL(purl string) (modPath, version string, ok bool, err error) {
+	const prefix = "pkg:golang/"
+	if !strings.HasPrefix(purl, prefix) {
+		return "", "", false, nil
+	}
+	rest := strings.TrimPrefix(purl, prefix)
+	if i := strings.IndexAny(rest, "?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	escapedPath, escapedVersion, _ := strings.Cut(rest, "@")
+	if modPath, err = url.PathUnescape(escapedPath); err != nil {
+		return "", "", false, fmt.Errorf("invalid package URL %q: %v", purl, err)
+	}
+	if version, err = url.PathUnescape(escapedVersion); err != nil {
+		return "", "", false, fmt.Errorf("invalid package URL %q: %v", purl, err)
+	}
+	return modPath, version, true, nil
+}
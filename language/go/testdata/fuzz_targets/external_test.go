@@ -0,0 +1,11 @@
+package fuzz_targets_test
+
+import (
+	"testing"
+
+	"example.com/repo/fuzz_targets"
+)
+
+func FuzzExternal(f *testing.F) {
+	f.Fuzz(func(t *testing.T, s string) { fuzz_targets.Parse(s) })
+}
@@ -0,0 +1,13 @@
+package fuzz_targets
+
+import "testing"
+
+func TestParse(t *testing.T) {}
+
+func FuzzParse(f *testing.F) {
+	f.Fuzz(func(t *testing.T, s string) { Parse(s) })
+}
+
+func FuzzParseURL(f *testing.F) {}
+
+func Fuzzy(t *testing.T) {}
@@ -0,0 +1,3 @@
+package importmap_fork
+
+import _ "example.com/up"
@@ -0,0 +1,5 @@
+package protos
+
+import "testing"
+
+func TestExtra(t *testing.T) {}
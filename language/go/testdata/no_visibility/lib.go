@@ -0,0 +1 @@
+package no_visibility
@@ -0,0 +1 @@
+package amd64
@@ -0,0 +1 @@
+package arm64
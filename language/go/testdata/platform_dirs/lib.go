@@ -0,0 +1,3 @@
+package platform_dirs
+
+import _ "example.com/repo/platform_dirs/arch/amd64"
@@ -0,0 +1 @@
+package platforms_mobile
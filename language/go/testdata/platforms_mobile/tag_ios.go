@@ -0,0 +1,5 @@
+//go:build ios
+
+package platforms_mobile
+
+import _ "example.com/repo/platforms_mobile/ios"
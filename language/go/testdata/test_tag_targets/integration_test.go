@@ -0,0 +1,16 @@
+//go:build integration
+
+package test_tag_targets_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"example.com/repo/test_tag_targets"
+)
+
+func TestServer(t *testing.T) {
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+	_ = test_tag_targets.Answer()
+}
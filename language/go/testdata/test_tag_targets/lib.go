@@ -0,0 +1,3 @@
+package test_tag_targets
+
+func Answer() int { return 42 }
@@ -0,0 +1,7 @@
+//go:build !integration
+
+package test_tag_targets
+
+import "testing"
+
+func TestUnit(t *testing.T) {}
@@ -21,7 +21,9 @@ import (
 	"strings"
 
 	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/repo"
 	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -55,30 +57,45 @@ func (*goLang) UpdateRepos(args language.UpdateReposArgs) language.UpdateReposRe
 	if err := eg.Wait(); err != nil {
 		return language.UpdateReposResult{Error: err}
 	}
+	keepPinnedSources(args.Config.Repos, gen)
 	return language.UpdateReposResult{Gen: gen}
 }
 
 var repoImportFuncs = map[string]func(args language.ImportReposArgs) language.ImportReposResult{
-	"go.mod":  importReposFromModules,
-	"go.work": importReposFromWork,
+	"go.mod":      importReposFromModules,
+	"go.work":     importReposFromWork,
+	"modules.txt": importReposFromVendor,
+}
+
+// repoImportFunc returns the function that imports repositories from the
+// file at path, or nil if the file can't be imported.
+func repoImportFunc(path string) func(args language.ImportReposArgs) language.ImportReposResult {
+	if f := repoImportFuncs[filepath.Base(path)]; f != nil {
+		return f
+	}
+	if isSBOMFile(path) {
+		return importReposFromSBOM
+	}
+	return nil
 }
 
 func (*goLang) CanImport(path string) bool {
-	return repoImportFuncs[filepath.Base(path)] != nil
+	return repoImportFunc(path) != nil
 }
 
 func (*goLang) ImportRepos(args language.ImportReposArgs) language.ImportReposResult {
-	res := repoImportFuncs[filepath.Base(args.Path)](args)
+	res := repoImportFunc(args.Path)(args)
 	for _, r := range res.Gen {
 		setBuildAttrs(getGoConfig(args.Config), r)
 	}
+	keepPinnedSources(args.Config.Repos, res.Gen)
 	if args.Prune {
 		genNamesSet := make(map[string]bool)
 		for _, r := range res.Gen {
 			genNamesSet[r.Name()] = true
 		}
 		for _, r := range args.Config.Repos {
-			if name := r.Name(); r.Kind() == "go_repository" && !genNamesSet[name] {
+			if name := r.Name(); r.Kind() == "go_repository" && !genNamesSet[name] && !repo.IsFromDirective(r) {
 				res.Empty = append(res.Empty, rule.NewRule("go_repository", name))
 			}
 		}
@@ -114,6 +131,64 @@ func setBuildAttrs(gc *goConfig, r *rule.Rule) {
 	}
 }
 
+// sourceAttrs are the go_repository attributes that tell the repository rule
+// where to fetch a module from. They must be set consistently: a module may be
+// downloaded with version and sum, checked out from version control, or
+// downloaded from urls, but not a mix of these.
+var sourceAttrs = []string{
+	"version", "sum", "replace",
+	"commit", "tag", "remote", "vcs",
+	"urls", "strip_prefix", "type", "sha256",
+}
+
+// keepPinnedSources prevents generated rules from changing where a module is
+// fetched from when the user pinned the source of an existing rule by hand.
+// If any source attribute of an existing go_repository rule in repos is
+// marked with a "# keep" comment, the corresponding rule in gen is changed to
+// have the same source attributes as the existing rule, so merging leaves
+// them alone. Otherwise, a version bump would set version and sum next to
+// kept urls or commit attributes. Other attributes are still updated.
+func keepPinnedSources(repos, gen []*rule.Rule) {
+	existing := make(map[string]*rule.Rule)
+	for _, r := range repos {
+		if r.Kind() == "go_repository" {
+			existing[r.Name()] = r
+		}
+	}
+	for _, g := range gen {
+		r, ok := existing[g.Name()]
+		if !ok || g.Kind() != "go_repository" || !hasKeptSource(r) {
+			continue
+		}
+		for _, key := range sourceAttrs {
+			if attr := r.Attr(key); attr != nil && !attrShouldKeep(r, key) {
+				g.SetAttr(key, attr)
+			} else {
+				g.DelAttr(key)
+			}
+		}
+	}
+}
+
+func hasKeptSource(r *rule.Rule) bool {
+	for _, key := range sourceAttrs {
+		if attrShouldKeep(r, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// attrShouldKeep returns whether the named attribute of r is marked with a
+// "# keep" comment, either on the line before it or at the end of its line.
+func attrShouldKeep(r *rule.Rule, key string) bool {
+	comments := r.AttrComments(key)
+	if comments == nil {
+		return false
+	}
+	return rule.ShouldKeep(&bzl.Ident{Comments: *comments}) || rule.ShouldKeep(r.Attr(key))
+}
+
 func sortRules(rules []*rule.Rule) {
 	sort.SliceStable(rules, func(i, j int) bool {
 		if cmp := strings.Compare(rules[i].Name(), rules[j].Name()); cmp != 0 {
@@ -589,6 +589,233 @@ go_repository(
 `), nil
 			},
 		},
+		{
+			desc: "vendor",
+			files: []testtools.FileSpec{
+				{
+					Path: "vendor/modules.txt",
+					Content: `
+# github.com/BurntSushi/toml v0.3.1
+## explicit
+github.com/BurntSushi/toml
+# github.com/pelletier/go-toml v1.0.1 => github.com/fork/go-toml v0.0.0-20190425002759-70bc0436ed16
+## explicit
+github.com/pelletier/go-toml
+# golang.org/x/tools v0.0.0-20190122202912-9c309ee22fab
+## explicit; go 1.11
+golang.org/x/tools/go/vcs
+# example.com/local v1.0.0 => ../local
+example.com/local
+# example.com/local => ../local
+`,
+				},
+				{
+					// Note: the sum for x/tools has been deleted to force a call
+					// to goModDownload.
+					Path: "go.sum",
+					Content: `
+github.com/BurntSushi/toml v0.3.1 h1:WXkYYl6Yr3qBf1K79EBnL4mak0OimBfB0XUf9Vl28OQ=
+github.com/BurntSushi/toml v0.3.1/go.mod h1:xHWCNGjB5oqiDr8zfno3MHue2Ht5sIBksp03qcyfWMU=
+github.com/fork/go-toml v0.0.0-20190425002759-70bc0436ed16 h1:T5zMGML61Wp+FlcbWjRDT7yAxhJNAiPPLOFECq181zc=
+github.com/fork/go-toml v0.0.0-20190425002759-70bc0436ed16/go.mod h1:5z9KED0ma1S8pY6P1sdut58dfprrGBbd/94hg7ilaic=
+`,
+				},
+			},
+			stubGoModDownload: func(dir string, args []string) ([]byte, error) {
+				if len(args) != 1 || args[0] != "golang.org/x/tools@v0.0.0-20190122202912-9c309ee22fab" {
+					return nil, fmt.Errorf("unexpected download args: %v", args)
+				}
+				return []byte(`{
+"Path": "golang.org/x/tools",
+"Version": "v0.0.0-20190122202912-9c309ee22fab",
+"Sum": "h1:FkAkwuYWQw+IArrnmhGlisKHQF4MsZ2Nu/fX4ttW55o="
+}`), nil
+			},
+			want: `
+go_repository(
+    name = "com_github_burntsushi_toml",
+    importpath = "github.com/BurntSushi/toml",
+    sum = "h1:WXkYYl6Yr3qBf1K79EBnL4mak0OimBfB0XUf9Vl28OQ=",
+    version = "v0.3.1",
+)
+
+go_repository(
+    name = "com_github_pelletier_go_toml",
+    importpath = "github.com/pelletier/go-toml",
+    replace = "github.com/fork/go-toml",
+    sum = "h1:T5zMGML61Wp+FlcbWjRDT7yAxhJNAiPPLOFECq181zc=",
+    version = "v0.0.0-20190425002759-70bc0436ed16",
+)
+
+go_repository(
+    name = "org_golang_x_tools",
+    importpath = "golang.org/x/tools",
+    sum = "h1:FkAkwuYWQw+IArrnmhGlisKHQF4MsZ2Nu/fX4ttW55o=",
+    version = "v0.0.0-20190122202912-9c309ee22fab",
+)
+`,
+		},
+		{
+			desc: "sbom-spdx",
+			files: []testtools.FileSpec{
+				{
+					Path: "deps.spdx.json",
+					Content: `{
+  "spdxVersion": "SPDX-2.3",
+  "packages": [
+    {
+      "name": "example.com/main",
+      "versionInfo": "(devel)",
+      "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:golang/example.com/main@(devel)"}]
+    },
+    {
+      "name": "github.com/BurntSushi/toml",
+      "versionInfo": "v0.3.1",
+      "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:golang/github.com/BurntSushi/toml@v0.3.1"}]
+    },
+    {
+      "name": "golang.org/x/tools",
+      "versionInfo": "v0.0.0-20190122202912-9c309ee22fab",
+      "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:golang/golang.org/x/tools@v0.0.0-20190122202912-9c309ee22fab?type=module"}]
+    },
+    {
+      "name": "left-pad",
+      "versionInfo": "1.3.0",
+      "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:npm/left-pad@1.3.0"}]
+    }
+  ]
+}`,
+				},
+				{
+					Path: "go.sum",
+					Content: `
+github.com/BurntSushi/toml v0.3.1 h1:WXkYYl6Yr3qBf1K79EBnL4mak0OimBfB0XUf9Vl28OQ=
+github.com/BurntSushi/toml v0.3.1/go.mod h1:xHWCNGjB5oqiDr8zfno3MHue2Ht5sIBksp03qcyfWMU=
+`,
+				},
+			},
+			stubGoModDownload: func(dir string, args []string) ([]byte, error) {
+				if len(args) != 1 || args[0] != "golang.org/x/tools@v0.0.0-20190122202912-9c309ee22fab" {
+					return nil, fmt.Errorf("unexpected download args: %v", args)
+				}
+				return []byte(`{
+"Path": "golang.org/x/tools",
+"Version": "v0.0.0-20190122202912-9c309ee22fab",
+"Sum": "h1:FkAkwuYWQw+IArrnmhGlisKHQF4MsZ2Nu/fX4ttW55o="
+}`), nil
+			},
+			want: `
+go_repository(
+    name = "com_github_burntsushi_toml",
+    importpath = "github.com/BurntSushi/toml",
+    sum = "h1:WXkYYl6Yr3qBf1K79EBnL4mak0OimBfB0XUf9Vl28OQ=",
+    version = "v0.3.1",
+)
+
+go_repository(
+    name = "org_golang_x_tools",
+    importpath = "golang.org/x/tools",
+    sum = "h1:FkAkwuYWQw+IArrnmhGlisKHQF4MsZ2Nu/fX4ttW55o=",
+    version = "v0.0.0-20190122202912-9c309ee22fab",
+)
+`,
+		},
+		{
+			desc: "sbom-duplicate-versions",
+			files: []testtools.FileSpec{
+				{
+					Path: "deps.spdx.json",
+					Content: `{
+  "spdxVersion": "SPDX-2.3",
+  "packages": [
+    {
+      "name": "github.com/BurntSushi/toml",
+      "versionInfo": "v0.3.1",
+      "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:golang/github.com/BurntSushi/toml@v0.3.1"}]
+    },
+    {
+      "name": "github.com/BurntSushi/toml",
+      "versionInfo": "v0.3.0",
+      "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:golang/github.com/BurntSushi/toml@v0.3.0"}]
+    }
+  ]
+}`,
+				},
+				{
+					Path: "go.sum",
+					Content: `
+github.com/BurntSushi/toml v0.3.1 h1:WXkYYl6Yr3qBf1K79EBnL4mak0OimBfB0XUf9Vl28OQ=
+github.com/BurntSushi/toml v0.3.1/go.mod h1:xHWCNGjB5oqiDr8zfno3MHue2Ht5sIBksp03qcyfWMU=
+`,
+				},
+			},
+			stubGoModDownload: func(dir string, args []string) ([]byte, error) {
+				return nil, fmt.Errorf("unexpected download args: %v", args)
+			},
+			want: `
+go_repository(
+    name = "com_github_burntsushi_toml",
+    importpath = "github.com/BurntSushi/toml",
+    sum = "h1:WXkYYl6Yr3qBf1K79EBnL4mak0OimBfB0XUf9Vl28OQ=",
+    version = "v0.3.1",
+)
+`,
+		},
+		{
+			desc: "sbom-cyclonedx",
+			files: []testtools.FileSpec{
+				{
+					Path: "bom.json",
+					Content: `{
+  "bomFormat": "CycloneDX",
+  "specVersion": "1.5",
+  "metadata": {"component": {"type": "application", "purl": "pkg:golang/example.com/main@v0.0.0"}},
+  "components": [
+    {
+      "type": "library",
+      "name": "github.com/BurntSushi/toml",
+      "purl": "pkg:golang/github.com/BurntSushi/toml@v0.3.1",
+      "components": [
+        {"type": "library", "name": "golang.org/x/tools", "purl": "pkg:golang/golang.org/x/tools@v0.0.0-20190122202912-9c309ee22fab#go/vcs"}
+      ]
+    }
+  ]
+}`,
+				},
+				{
+					Path: "go.sum",
+					Content: `
+github.com/BurntSushi/toml v0.3.1 h1:WXkYYl6Yr3qBf1K79EBnL4mak0OimBfB0XUf9Vl28OQ=
+github.com/BurntSushi/toml v0.3.1/go.mod h1:xHWCNGjB5oqiDr8zfno3MHue2Ht5sIBksp03qcyfWMU=
+`,
+				},
+			},
+			stubGoModDownload: func(dir string, args []string) ([]byte, error) {
+				if len(args) != 1 || args[0] != "golang.org/x/tools@v0.0.0-20190122202912-9c309ee22fab" {
+					return nil, fmt.Errorf("unexpected download args: %v", args)
+				}
+				return []byte(`{
+"Path": "golang.org/x/tools",
+"Version": "v0.0.0-20190122202912-9c309ee22fab",
+"Sum": "h1:FkAkwuYWQw+IArrnmhGlisKHQF4MsZ2Nu/fX4ttW55o="
+}`), nil
+			},
+			want: `
+go_repository(
+    name = "com_github_burntsushi_toml",
+    importpath = "github.com/BurntSushi/toml",
+    sum = "h1:WXkYYl6Yr3qBf1K79EBnL4mak0OimBfB0XUf9Vl28OQ=",
+    version = "v0.3.1",
+)
+
+go_repository(
+    name = "org_golang_x_tools",
+    importpath = "golang.org/x/tools",
+    sum = "h1:FkAkwuYWQw+IArrnmhGlisKHQF4MsZ2Nu/fX4ttW55o=",
+    version = "v0.0.0-20190122202912-9c309ee22fab",
+)
+`,
+		},
 	} {
 		t.Run(tc.desc, func(t *testing.T) {
 			if tc.stubGoModDownload != nil {
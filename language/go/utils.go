@@ -51,6 +51,7 @@ var goModDownload = func(dir string, args []string) ([]byte, error) {
 type moduleFromList struct {
 	Path, Version, Sum string
 	Main               bool
+	GoVersion          string
 	Replace            *struct {
 		Path, Version string
 	}
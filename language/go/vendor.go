@@ -0,0 +1,106 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+)
+
+// importReposFromVendor imports repositories from a vendor/modules.txt file
+// written by 'go mod vendor'. Versions come from modules.txt; sums are read
+// from the go.sum file next to the vendor directory.
+func importReposFromVendor(args language.ImportReposArgs) language.ImportReposResult {
+	data, err := os.ReadFile(args.Path)
+	if err != nil {
+		return language.ImportReposResult{Error: err}
+	}
+	pathToModule, err := parseVendorModules(data)
+	if err != nil {
+		return language.ImportReposResult{Error: fmt.Errorf("%s: %v", args.Path, err)}
+	}
+
+	moduleDir := filepath.Dir(filepath.Dir(args.Path))
+	loadGoSum(filepath.Join(moduleDir, "go.sum"), pathToModule)
+
+	pathToModule, err = fillMissingSums(pathToModule)
+	if err != nil {
+		return language.ImportReposResult{Error: fmt.Errorf("finding module sums: %v", err)}
+	}
+
+	return language.ImportReposResult{Gen: toRepositoryRules(pathToModule)}
+}
+
+// parseVendorModules reads module lines from vendor/modules.txt. Module lines
+// have one of the forms below; package lines and "##" annotations are skipped.
+//
+//	# path version
+//	# path version => replacement replacementVersion
+//	# path => replacement replacementVersion
+//
+// Like extractModules, the result is keyed by the path@version of the module
+// that is actually downloaded.
+func parseVendorModules(data []byte) (map[string]*moduleFromList, error) {
+	pathToModule := map[string]*moduleFromList{}
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if !bytes.HasPrefix(line, []byte("# ")) {
+			continue
+		}
+		fields := strings.Fields(string(line[len("# "):]))
+		mod := new(moduleFromList)
+		arrow := -1
+		for j, f := range fields {
+			if f == "=>" {
+				arrow = j
+				break
+			}
+		}
+		left, right := fields, []string(nil)
+		if arrow >= 0 {
+			left, right = fields[:arrow], fields[arrow+1:]
+		}
+		if len(left) < 1 || len(left) > 2 || (arrow >= 0 && (len(right) < 1 || len(right) > 2)) {
+			return nil, fmt.Errorf("line %d: malformed module line: %q", i+1, line)
+		}
+		mod.Path = left[0]
+		if len(left) == 2 {
+			mod.Version = left[1]
+		}
+		if arrow < 0 {
+			if mod.Version == "" {
+				return nil, fmt.Errorf("line %d: module %s has no version", i+1, mod.Path)
+			}
+			pathToModule[mod.Path+"@"+mod.Version] = mod
+			continue
+		}
+		replPath := right[0]
+		if len(right) == 1 || filepath.IsAbs(replPath) || build.IsLocalImport(replPath) {
+			log.Printf("go_repository does not support file path replacements for %s -> %s", mod.Path, replPath)
+			continue
+		}
+		mod.Replace = &struct{ Path, Version string }{Path: replPath, Version: right[1]}
+		pathToModule[mod.Replace.Path+"@"+mod.Replace.Version] = mod
+	}
+	return pathToModule, nil
+}
@@ -17,11 +17,137 @@ package golang
 
 import (
 	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/bazelbuild/bazel-gazelle/language"
+	"golang.org/x/mod/modfile"
 )
 
+// workModule is a module listed in a use directive of a go.work file.
+type workModule struct {
+	// rel is the slash-separated path of the module's directory, relative to
+	// the repository root.
+	rel string
+
+	// modulePath is the module path declared in the module's go.mod file.
+	modulePath string
+}
+
+// loadWorkModules reads the go.work file in repoRoot, if there is one, and
+// returns the modules it uses that are within repoRoot. Modules are sorted
+// by module path, longest first, so the first match for an import path is
+// the innermost module.
+func loadWorkModules(repoRoot string) ([]workModule, error) {
+	workPath := filepath.Join(repoRoot, "go.work")
+	data, err := os.ReadFile(workPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	workFile, err := modfile.ParseWork(workPath, data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var modules []workModule
+	for _, use := range workFile.Use {
+		rel := path.Clean(filepath.ToSlash(use.Path))
+		if path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+			// Modules outside the repository can't be built with local labels.
+			continue
+		}
+		if rel == "." {
+			rel = ""
+		}
+		goModPath := filepath.Join(repoRoot, filepath.FromSlash(rel), "go.mod")
+		goMod, err := os.ReadFile(goModPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", workPath, err)
+		}
+		modulePath := modfile.ModulePath(goMod)
+		if modulePath == "" {
+			return nil, fmt.Errorf("%s: no module directive", goModPath)
+		}
+		modules = append(modules, workModule{rel: rel, modulePath: modulePath})
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		if len(modules[i].modulePath) != len(modules[j].modulePath) {
+			return len(modules[i].modulePath) > len(modules[j].modulePath)
+		}
+		return modules[i].modulePath < modules[j].modulePath
+	})
+	return modules, nil
+}
+
+// moduleRoots finds the directories containing go.mod files below the
+// repository root. The repository is searched once, the first time the
+// roots are needed, and the result is shared by all directories.
+type moduleRoots struct {
+	repoRoot string
+	once     sync.Once
+	paths    map[string]string
+}
+
+// get returns a map from slash-separated directories relative to the
+// repository root to the module paths declared by go.mod files in them.
+// It's safe to call concurrently.
+func (mr *moduleRoots) get() map[string]string {
+	mr.once.Do(func() {
+		mr.paths = findModuleRoots(mr.repoRoot)
+	})
+	return mr.paths
+}
+
+// findModuleRoots searches repoRoot for go.mod files. Like the go command,
+// it skips testdata and vendor directories and directories whose names
+// begin with "." or "_". Errors are logged.
+func findModuleRoots(repoRoot string) map[string]string {
+	paths := make(map[string]string)
+	err := filepath.WalkDir(repoRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if p != repoRoot && (name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != "go.mod" {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(repoRoot, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+		if modulePath := modfile.ModulePath(data); modulePath != "" {
+			paths[rel] = modulePath
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("finding go.mod files: %v", err)
+	}
+	return paths
+}
+
 func importReposFromWork(args language.ImportReposArgs) language.ImportReposResult {
 	// run go list in the dir where go.work is located
 	data, err := goListModules(filepath.Dir(args.Path))
@@ -39,5 +165,9 @@ func importReposFromWork(args language.ImportReposArgs) language.ImportReposResu
 		return language.ImportReposResult{Error: fmt.Errorf("finding module sums: %v", err)}
 	}
 
+	if report := compatReport(getGoConfig(args.Config), pathToModule); report != "" {
+		log.Print(report)
+	}
+
 	return language.ImportReposResult{Gen: toRepositoryRules(pathToModule)}
 }
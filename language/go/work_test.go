@@ -0,0 +1,70 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package golang
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/testtools"
+)
+
+func TestLoadWorkModules(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{
+			Path: "go.work",
+			Content: `
+go 1.21
+
+use (
+	.
+	./nested
+	../outside
+)
+`,
+		},
+		{Path: "go.mod", Content: "module example.com/root\n"},
+		{Path: "nested/go.mod", Content: "module example.com/root/nested\n"},
+	})
+	defer cleanup()
+
+	got, err := loadWorkModules(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []workModule{
+		{rel: "nested", modulePath: "example.com/root/nested"},
+		{rel: "", modulePath: "example.com/root"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v; want %#v", got, want)
+	}
+}
+
+func TestLoadWorkModulesNoWorkFile(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "go.mod", Content: "module example.com/root\n"},
+	})
+	defer cleanup()
+
+	got, err := loadWorkModules(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("got %#v; want nil", got)
+	}
+}
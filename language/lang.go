@@ -23,6 +23,8 @@ package language
 
 import (
 	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/repo"
 	"github.com/bazelbuild/bazel-gazelle/resolve"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 )
@@ -43,7 +45,9 @@ import (
 //
 // * Configuration (embedded interface config.Configurer). Languages may
 // define command line flags and alter the configuration in a directory
-// based on directives in build files.
+// based on directives in build files. Languages may implement
+// config.DirectiveDeclarer to declare the types and scopes of their
+// directives, so Gazelle validates them.
 //
 // * Fixing deprecated usage of rules in build files.
 //
@@ -94,7 +98,8 @@ type Language interface {
 
 	// Fix repairs deprecated usage of language-specific rules in f. This is
 	// called before the file is indexed. Unless c.ShouldFix is true, fixes
-	// that delete or rename rules should not be performed.
+	// that delete or rename rules should not be performed. Fixes that apply
+	// to the whole file may be registered by implementing FileFixer instead.
 	Fix(c *config.Config, f *rule.File)
 }
 
@@ -110,6 +115,47 @@ type FinishableLanguage interface {
 	DoneGeneratingRules()
 }
 
+// ResolveErrorReporter may be implemented by a Language that finds errors
+// while resolving dependencies which should make Gazelle exit with an error,
+// for example, imports that can't be resolved with strict dependency
+// checking. ResolveErrors is called after all rules are resolved. If any
+// errors are returned, Gazelle doesn't write build files.
+type ResolveErrorReporter interface {
+	ResolveErrors() []error
+}
+
+// ImportResolver may be implemented by a Language to resolve a single import
+// string the same way Resolve resolves the imports of generated rules. The
+// list-deps command uses it to print the rules import strings resolve to,
+// including rules in external repositories.
+type ImportResolver interface {
+	// ResolveImport returns the label of the rule that provides imp to rules
+	// in the package of from. If imp needs no dependency, for example,
+	// because it's provided by the standard library, label.NoLabel and a nil
+	// error are returned. An error is returned if imp can't be resolved.
+	ResolveImport(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, imp string, from label.Label) (label.Label, error)
+}
+
+// EmitFunc writes a build file that was updated by the fix or update
+// commands. The built-in emit modes write the file in place, print it to
+// stdout, or print a diff.
+type EmitFunc func(c *config.Config, f *rule.File) error
+
+// EmitModeProvider may be implemented by a Language to add emit modes that
+// can be selected with the -mode flag of the fix and update commands, in
+// addition to print, fix, and diff. This lets a Gazelle binary built with
+// gazelle_binary send changes somewhere other than the local file system,
+// for example, to a code review service.
+type EmitModeProvider interface {
+	// EmitModes returns emit functions keyed by mode name. Names must not
+	// conflict with built-in modes or modes provided by other languages.
+	// The chosen function is called once for each visited build file after
+	// dependencies are resolved, whether or not the file changed. f.Content
+	// holds the file's original content, which may be compared with
+	// f.Format().
+	EmitModes() map[string]EmitFunc
+}
+
 type ModuleAwareLanguage interface {
 	// ApparentLoads returns .bzl files and symbols they define. Every rule
 	// generated by GenerateRules, now or in the past, should be loadable from
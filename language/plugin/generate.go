@@ -0,0 +1,69 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"log"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+)
+
+func (pl *pluginLang) GenerateRules(args language.GenerateArgs) language.GenerateResult {
+	var res language.GenerateResult
+	if len(pl.plugins) == 0 {
+		return res
+	}
+
+	params := generateParams{
+		Rel:          args.Rel,
+		Dir:          args.Dir,
+		Subdirs:      args.Subdirs,
+		RegularFiles: args.RegularFiles,
+		GenFiles:     args.GenFiles,
+	}
+	if args.File != nil {
+		for _, r := range args.File.Rules {
+			params.Rules = append(params.Rules, fromRule(r))
+		}
+	}
+
+	for _, p := range pl.plugins {
+		var result generateResult
+		if err := p.call("generate", params, &result); err != nil {
+			log.Print(err)
+			continue
+		}
+		if len(result.Imports) != 0 && len(result.Imports) != len(result.Gen) {
+			log.Printf("plugin %s: generate: %s: got %d rules but %d imports", p.path, args.Rel, len(result.Gen), len(result.Imports))
+			continue
+		}
+		for i, pr := range result.Gen {
+			res.Gen = append(res.Gen, pr.toRule())
+			var imports []resolve.ImportSpec
+			if len(result.Imports) > 0 {
+				for _, imp := range result.Imports[i] {
+					imports = append(imports, resolve.ImportSpec{Lang: imp.Lang, Imp: imp.Imp})
+				}
+			}
+			res.Imports = append(res.Imports, imports)
+		}
+		for _, pr := range result.Empty {
+			res.Empty = append(res.Empty, pr.toRule())
+		}
+	}
+	return res
+}
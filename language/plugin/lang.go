@@ -0,0 +1,188 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugin runs language extensions as subprocesses, so they can be
+// used without building a custom gazelle_binary.
+//
+// Plugins are executables passed to Gazelle with the -plugin flag. Gazelle
+// starts each plugin once and sends it requests over stdin. The plugin
+// writes one response to stdout for each request. Each request and response
+// is a JSON object on a single line. Requests have the form
+//
+//	{"method": "...", "params": {...}}
+//
+// and responses have the form
+//
+//	{"result": {...}, "error": "..."}
+//
+// where "error" is empty or omitted on success. Plugins may log to stderr.
+//
+// The following methods are supported:
+//
+//   - "info": sent once after the plugin is started. The result has the
+//     fields "name" (the name of the language), "kinds" (a map from rule
+//     kinds to rule.KindInfo), "loads" (a list of rule.LoadInfo), and
+//     "directives" (a list of directive names the plugin recognizes).
+//   - "configure": sent for each directory whose build file contains
+//     directives the plugin recognizes, before rules are generated for that
+//     directory. The params have the fields "rel" and "directives" (a list of
+//     objects with "key" and "value"). Plugins are responsible for applying
+//     directives to subdirectories.
+//   - "generate": sent for each directory Gazelle updates. The params have
+//     the fields "rel", "dir", "subdirs", "regular_files", "gen_files", and
+//     "rules" (the rules already in the build file). The result has the
+//     fields "gen" and "empty" (lists of rules), and "imports" (a list with
+//     one element per generated rule, each a list of import specs).
+//   - "imports": sent for each rule of a kind the plugin owns, so the rule
+//     can be indexed for dependency resolution. The params have the fields
+//     "rel" and "rule". The result has the field "imports" (a list of import
+//     specs).
+//
+// Rules are objects with the fields "kind", "name", and "attrs" (a map from
+// attribute names to JSON values). Import specs are objects with the fields
+// "lang" and "imp" (see resolve.ImportSpec).
+//
+// Gazelle resolves the imports of generated rules itself, using
+// # gazelle:resolve directives and the rule index, and writes the results
+// to the "deps" attribute.
+package plugin
+
+import (
+	"context"
+	"flag"
+	"log"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	gzflag "github.com/bazelbuild/bazel-gazelle/flag"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+const pluginName = "plugin"
+
+// pluginLang is a language.Language that forwards requests to plugin
+// subprocesses.
+type pluginLang struct {
+	language.BaseLifecycleManager
+
+	// paths is the list of plugin executables, set by -plugin.
+	paths []string
+
+	// plugins is the list of running plugins, started in CheckFlags.
+	plugins []*process
+
+	// kindOwners maps each kind to the plugin that generates it.
+	kindOwners map[string]*process
+}
+
+// NewLanguage returns a language.Language that runs the plugins named with
+// the -plugin flag. If no plugins are named, it does nothing.
+func NewLanguage() language.Language {
+	return &pluginLang{}
+}
+
+func (*pluginLang) Name() string { return pluginName }
+
+func (pl *pluginLang) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config) {
+	pl.paths = nil
+	if cmd != "fix" && cmd != "update" {
+		return
+	}
+	fs.Var(&gzflag.MultiFlag{Values: &pl.paths}, "plugin", "path to a language plugin executable (can specify multiple times)")
+}
+
+func (pl *pluginLang) CheckFlags(fs *flag.FlagSet, c *config.Config) error {
+	pl.stop()
+	pl.kindOwners = make(map[string]*process)
+	for _, path := range pl.paths {
+		p, err := startProcess(path)
+		if err != nil {
+			pl.stop()
+			return err
+		}
+		pl.plugins = append(pl.plugins, p)
+		for kind := range p.info.Kinds {
+			pl.kindOwners[kind] = p
+		}
+	}
+	return nil
+}
+
+func (pl *pluginLang) KnownDirectives() []string {
+	var directives []string
+	for _, p := range pl.plugins {
+		directives = append(directives, p.info.Directives...)
+	}
+	return directives
+}
+
+func (pl *pluginLang) Configure(c *config.Config, rel string, f *rule.File) {
+	if f == nil {
+		return
+	}
+	for _, p := range pl.plugins {
+		var directives []directive
+		for _, d := range f.Directives {
+			if p.knownDirectives[d.Key] {
+				directives = append(directives, directive{Key: d.Key, Value: d.Value})
+			}
+		}
+		if len(directives) == 0 {
+			continue
+		}
+		params := configureParams{Rel: rel, Directives: directives}
+		if err := p.call("configure", params, nil); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+func (pl *pluginLang) Kinds() map[string]rule.KindInfo {
+	kinds := make(map[string]rule.KindInfo)
+	for _, p := range pl.plugins {
+		for kind, info := range p.info.Kinds {
+			kinds[kind] = info
+		}
+	}
+	return kinds
+}
+
+func (pl *pluginLang) Loads() []rule.LoadInfo {
+	var loads []rule.LoadInfo
+	for _, p := range pl.plugins {
+		loads = append(loads, p.info.Loads...)
+	}
+	sort.SliceStable(loads, func(i, j int) bool { return loads[i].Name < loads[j].Name })
+	return loads
+}
+
+func (*pluginLang) Fix(c *config.Config, f *rule.File) {}
+
+// AfterResolvingDeps stops the plugins, since they won't receive any more
+// requests.
+func (pl *pluginLang) AfterResolvingDeps(ctx context.Context) {
+	pl.stop()
+}
+
+func (pl *pluginLang) stop() {
+	for _, p := range pl.plugins {
+		if err := p.close(); err != nil {
+			log.Print(err)
+		}
+	}
+	pl.plugins = nil
+	pl.kindOwners = nil
+}
@@ -0,0 +1,236 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+const helperEnv = "GAZELLE_PLUGIN_TEST_HELPER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(helperEnv) != "" {
+		if err := runFakePlugin(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runFakePlugin implements a plugin that generates a fake_library for each
+// .fake file. Lines in .fake files starting with "import " name other .fake
+// files by their repo-relative paths.
+func runFakePlugin() error {
+	prefixes := map[string]string{}
+	in := bufio.NewScanner(os.Stdin)
+	out := json.NewEncoder(os.Stdout)
+	for in.Scan() {
+		var req struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(in.Bytes(), &req); err != nil {
+			return err
+		}
+		var result interface{}
+		var errMsg string
+		switch req.Method {
+		case "info":
+			result = infoResult{
+				Name: "fake",
+				Kinds: map[string]rule.KindInfo{
+					"fake_library": {
+						NonEmptyAttrs:  map[string]bool{"srcs": true},
+						MergeableAttrs: map[string]bool{"srcs": true},
+						ResolveAttrs:   map[string]bool{"deps": true},
+					},
+				},
+				Loads:      []rule.LoadInfo{{Name: "@fake//:defs.bzl", Symbols: []string{"fake_library"}}},
+				Directives: []string{"fake_prefix"},
+			}
+		case "configure":
+			var params configureParams
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				return err
+			}
+			for _, d := range params.Directives {
+				prefixes[params.Rel] = d.Value
+			}
+			result = struct{}{}
+		case "generate":
+			var params generateParams
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				return err
+			}
+			var res generateResult
+			for _, name := range params.RegularFiles {
+				if !strings.HasSuffix(name, ".fake") {
+					continue
+				}
+				data, err := os.ReadFile(filepath.Join(params.Dir, name))
+				if err != nil {
+					return err
+				}
+				var imports []importSpec
+				for _, line := range strings.Split(string(data), "\n") {
+					if imp, ok := strings.CutPrefix(line, "import "); ok {
+						imports = append(imports, importSpec{Lang: "fake", Imp: imp})
+					}
+				}
+				res.Gen = append(res.Gen, pluginRule{
+					Kind: "fake_library",
+					Name: prefixes[params.Rel] + strings.TrimSuffix(name, ".fake"),
+					Attrs: map[string]interface{}{
+						"srcs":     []string{name},
+						"testonly": true,
+						"shards":   2,
+					},
+				})
+				res.Imports = append(res.Imports, imports)
+			}
+			result = res
+		case "imports":
+			var params importsParams
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				return err
+			}
+			var res importsResult
+			srcs, _ := params.Rule.Attrs["srcs"].([]interface{})
+			for _, src := range srcs {
+				res.Imports = append(res.Imports, importSpec{Lang: "fake", Imp: path.Join(params.Rel, src.(string))})
+			}
+			result = res
+		default:
+			errMsg = "unknown method " + req.Method
+		}
+		resp := struct {
+			Result interface{} `json:"result,omitempty"`
+			Error  string      `json:"error,omitempty"`
+		}{result, errMsg}
+		if err := out.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return in.Err()
+}
+
+func TestPlugin(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(helperEnv, "1")
+
+	c := config.New()
+	lang := NewLanguage()
+	fs := flag.NewFlagSet("gazelle", flag.ContinueOnError)
+	lang.RegisterFlags(fs, "update", c)
+	if err := fs.Parse([]string{"-plugin", exe}); err != nil {
+		t.Fatal(err)
+	}
+	if err := lang.CheckFlags(fs, c); err != nil {
+		t.Fatal(err)
+	}
+	defer lang.(language.LifecycleManager).AfterResolvingDeps(context.Background())
+
+	if got, want := lang.KnownDirectives(), []string{"fake_prefix"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("KnownDirectives: got %v; want %v", got, want)
+	}
+	if _, ok := lang.Kinds()["fake_library"]; !ok {
+		t.Errorf("Kinds: missing fake_library")
+	}
+	if got := lang.Loads(); len(got) != 1 || got[0].Name != "@fake//:defs.bzl" {
+		t.Errorf("Loads: got %v", got)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.fake"), []byte("import pkg/b.fake\nimport pkg/a.fake\nimport missing.fake\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.fake"), nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	f, err := rule.LoadData(filepath.Join(dir, "BUILD.bazel"), "pkg", []byte("# gazelle:fake_prefix x_\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lang.Configure(c, "pkg", f)
+	res := lang.GenerateRules(language.GenerateArgs{
+		Config:       c,
+		Dir:          dir,
+		Rel:          "pkg",
+		File:         f,
+		RegularFiles: []string{"BUILD.bazel", "a.fake", "b.fake"},
+	})
+	if len(res.Gen) != 2 || len(res.Imports) != 2 {
+		t.Fatalf("GenerateRules: got %d rules and %d imports; want 2 and 2", len(res.Gen), len(res.Imports))
+	}
+
+	rc := &resolve.Configurer{}
+	rc.RegisterFlags(fs, "update", c)
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	for _, r := range res.Gen {
+		r.Insert(f)
+		ix.AddRule(c, r, f)
+	}
+	ix.Finish()
+	for i, r := range res.Gen {
+		lang.Resolve(c, ix, nil, r, res.Imports[i], label.New("", "pkg", r.Name()))
+	}
+
+	f.Sync()
+	got := strings.TrimSpace(string(bzl.Format(f.File)))
+	want := strings.TrimSpace(`
+# gazelle:fake_prefix x_
+
+fake_library(
+    name = "x_a",
+    testonly = True,
+    srcs = ["a.fake"],
+    shards = 2,
+    deps = [":x_b"],
+)
+
+fake_library(
+    name = "x_b",
+    testonly = True,
+    srcs = ["b.fake"],
+    shards = 2,
+)
+`)
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,116 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// process is a running plugin.
+type process struct {
+	path            string
+	cmd             *exec.Cmd
+	stdin           io.WriteCloser
+	stdout          *bufio.Scanner
+	info            infoResult
+	knownDirectives map[string]bool
+}
+
+// startProcess starts the plugin at path and requests its info.
+func startProcess(path string) (*process, error) {
+	cmd := exec.Command(path)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %v", path, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %v", path, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("plugin %s: %v", path, err)
+	}
+	scanner := bufio.NewScanner(stdout)
+	// Responses may contain many rules, so allow long lines.
+	scanner.Buffer(nil, 64<<20)
+	p := &process{
+		path:   path,
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: scanner,
+	}
+	if err := p.call("info", struct{}{}, &p.info); err != nil {
+		p.close()
+		return nil, err
+	}
+	if p.info.Name == "" {
+		p.close()
+		return nil, fmt.Errorf("plugin %s: info did not include a name", path)
+	}
+	p.knownDirectives = make(map[string]bool)
+	for _, d := range p.info.Directives {
+		p.knownDirectives[d] = true
+	}
+	return p, nil
+}
+
+// call sends a request to the plugin and waits for its response. If result
+// is not nil, the result in the response is decoded into it.
+func (p *process) call(method string, params, result interface{}) error {
+	req, err := json.Marshal(request{Method: method, Params: params})
+	if err != nil {
+		return fmt.Errorf("plugin %s: %s: %v", p.path, method, err)
+	}
+	req = append(req, '\n')
+	if _, err := p.stdin.Write(req); err != nil {
+		return fmt.Errorf("plugin %s: %s: %v", p.path, method, err)
+	}
+	if !p.stdout.Scan() {
+		err := p.stdout.Err()
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("plugin %s: %s: reading response: %v", p.path, method, err)
+	}
+	var resp response
+	if err := json.Unmarshal(p.stdout.Bytes(), &resp); err != nil {
+		return fmt.Errorf("plugin %s: %s: decoding response: %v", p.path, method, err)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("plugin %s: %s: %s", p.path, method, resp.Error)
+	}
+	if result != nil && len(resp.Result) > 0 {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("plugin %s: %s: decoding result: %v", p.path, method, err)
+		}
+	}
+	return nil
+}
+
+// close closes the plugin's stdin and waits for it to exit.
+func (p *process) close() error {
+	p.stdin.Close()
+	if err := p.cmd.Wait(); err != nil {
+		return fmt.Errorf("plugin %s: %v", p.path, err)
+	}
+	return nil
+}
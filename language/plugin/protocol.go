@@ -0,0 +1,196 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+type request struct {
+	Method string      `json:"method"`
+	Params interface{} `json:"params"`
+}
+
+type response struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type infoResult struct {
+	Name       string                   `json:"name"`
+	Kinds      map[string]rule.KindInfo `json:"kinds"`
+	Loads      []rule.LoadInfo          `json:"loads"`
+	Directives []string                 `json:"directives"`
+}
+
+type directive struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type configureParams struct {
+	Rel        string      `json:"rel"`
+	Directives []directive `json:"directives"`
+}
+
+type generateParams struct {
+	Rel          string       `json:"rel"`
+	Dir          string       `json:"dir"`
+	Subdirs      []string     `json:"subdirs"`
+	RegularFiles []string     `json:"regular_files"`
+	GenFiles     []string     `json:"gen_files"`
+	Rules        []pluginRule `json:"rules"`
+}
+
+type generateResult struct {
+	Gen     []pluginRule   `json:"gen"`
+	Empty   []pluginRule   `json:"empty"`
+	Imports [][]importSpec `json:"imports"`
+}
+
+type importsParams struct {
+	Rel  string     `json:"rel"`
+	Rule pluginRule `json:"rule"`
+}
+
+type importsResult struct {
+	Imports []importSpec `json:"imports"`
+}
+
+type importSpec struct {
+	Lang string `json:"lang"`
+	Imp  string `json:"imp"`
+}
+
+// pluginRule is the JSON representation of a rule.
+type pluginRule struct {
+	Kind  string                 `json:"kind"`
+	Name  string                 `json:"name"`
+	Attrs map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// fromRule converts r to its JSON representation. Attributes with values
+// that can't be represented in JSON, like select expressions, are omitted.
+func fromRule(r *rule.Rule) pluginRule {
+	pr := pluginRule{Kind: r.Kind(), Name: r.Name()}
+	for _, key := range r.AttrKeys() {
+		if key == "name" {
+			continue
+		}
+		if v, ok := valueFromExpr(r.Attr(key)); ok {
+			if pr.Attrs == nil {
+				pr.Attrs = make(map[string]interface{})
+			}
+			pr.Attrs[key] = v
+		}
+	}
+	return pr
+}
+
+// toRule converts the JSON representation of a rule to a new rule.
+func (pr pluginRule) toRule() *rule.Rule {
+	r := rule.NewRule(pr.Kind, pr.Name)
+	keys := make([]string, 0, len(pr.Attrs))
+	for key := range pr.Attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if v := normalizeValue(pr.Attrs[key]); v != nil {
+			r.SetAttr(key, v)
+		}
+	}
+	return r
+}
+
+func valueFromExpr(e bzl.Expr) (interface{}, bool) {
+	switch e := e.(type) {
+	case *bzl.StringExpr:
+		return e.Value, true
+	case *bzl.Ident:
+		switch e.Name {
+		case "True":
+			return true, true
+		case "False":
+			return false, true
+		}
+	case *bzl.LiteralExpr:
+		if n, err := strconv.ParseInt(e.Token, 0, 64); err == nil {
+			return n, true
+		}
+	case *bzl.ListExpr:
+		list := make([]interface{}, 0, len(e.List))
+		for _, elem := range e.List {
+			v, ok := valueFromExpr(elem)
+			if !ok {
+				return nil, false
+			}
+			list = append(list, v)
+		}
+		return list, true
+	case *bzl.DictExpr:
+		dict := make(map[string]interface{}, len(e.List))
+		for _, kv := range e.List {
+			k, ok := kv.Key.(*bzl.StringExpr)
+			if !ok {
+				return nil, false
+			}
+			v, ok := valueFromExpr(kv.Value)
+			if !ok {
+				return nil, false
+			}
+			dict[k.Value] = v
+		}
+		return dict, true
+	}
+	return nil, false
+}
+
+// normalizeValue converts a decoded JSON value to a value that can be passed
+// to rule.SetAttr. Integral numbers are converted to ints, and null values
+// are dropped.
+func normalizeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		if v == math.Trunc(v) {
+			return int64(v)
+		}
+		return v
+	case []interface{}:
+		list := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			if elem = normalizeValue(elem); elem != nil {
+				list = append(list, elem)
+			}
+		}
+		return list
+	case map[string]interface{}:
+		dict := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			if elem = normalizeValue(elem); elem != nil {
+				dict[k] = elem
+			}
+		}
+		return dict
+	}
+	return v
+}
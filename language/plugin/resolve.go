@@ -0,0 +1,84 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"log"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func (pl *pluginLang) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
+	p, ok := pl.kindOwners[r.Kind()]
+	if !ok {
+		return nil
+	}
+	var result importsResult
+	if err := p.call("imports", importsParams{Rel: f.Pkg, Rule: fromRule(r)}, &result); err != nil {
+		log.Print(err)
+		return nil
+	}
+	specs := make([]resolve.ImportSpec, 0, len(result.Imports))
+	for _, imp := range result.Imports {
+		specs = append(specs, resolve.ImportSpec{Lang: imp.Lang, Imp: imp.Imp})
+	}
+	return specs
+}
+
+func (*pluginLang) Embeds(r *rule.Rule, from label.Label) []label.Label {
+	return nil
+}
+
+// ResolveConcurrently returns true, since Resolve only reads the rule index
+// and doesn't call plugins.
+func (*pluginLang) ResolveConcurrently() bool { return true }
+
+// Resolve sets the deps attribute of r to the labels of rules that provide
+// the imports returned by the plugin for r. Imports that can't be resolved
+// are skipped.
+func (*pluginLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, importsRaw interface{}, from label.Label) {
+	imports, _ := importsRaw.([]resolve.ImportSpec)
+	depSet := make(map[string]bool)
+	for _, imp := range imports {
+		if l, ok := resolve.FindRuleWithOverride(c, imp, imp.Lang); ok {
+			depSet[l.Rel(from.Repo, from.Pkg).String()] = true
+			continue
+		}
+		matches := ix.FindRulesByImportWithConfig(c, imp, pluginName)
+		if len(matches) > 1 {
+			log.Printf("%s: multiple rules (%s and %s) may be imported with %q", from, matches[0].Label, matches[1].Label, imp.Imp)
+			continue
+		}
+		if len(matches) == 1 && !matches[0].IsSelfImport(from) {
+			depSet[matches[0].Label.Rel(from.Repo, from.Pkg).String()] = true
+		}
+	}
+	if len(depSet) == 0 {
+		r.DelAttr("deps")
+		return
+	}
+	deps := make([]string, 0, len(depSet))
+	for dep := range depSet {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	r.SetAttr("deps", deps)
+}
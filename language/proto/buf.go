@@ -0,0 +1,231 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proto
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/internal/yamlscalar"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/pathtools"
+)
+
+const (
+	// bufWorkFileName is the name of the workspace file of Buf v1, which
+	// lists the directories of the modules in the workspace.
+	bufWorkFileName = "buf.work.yaml"
+
+	// bufFileName is the name of the configuration file of a Buf module (v1)
+	// or workspace (v2).
+	bufFileName = "buf.yaml"
+
+	// defaultBufDepsRepo is the name of the repository that rules_buf's
+	// buf_dependencies rule is conventionally declared with.
+	defaultBufDepsRepo = "buf_deps"
+)
+
+// bufConfig is the part of a buf.yaml or buf.work.yaml file that Gazelle
+// uses to resolve imports.
+type bufConfig struct {
+	version string
+
+	// roots are the module directories, relative to the directory of the
+	// file. .proto files are imported relative to them.
+	roots []string
+}
+
+// configureBuf reads the Buf configuration files in the directory rel, if
+// there are any, and adds the module directories they declare to the include
+// roots.
+func (pc *ProtoConfig) configureBuf(c *config.Config, rel string) {
+	dir := filepath.Join(c.RepoRoot, filepath.FromSlash(rel))
+	for _, name := range []string{bufWorkFileName, bufFileName} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		bc, err := parseBufConfig(name, data)
+		if err != nil {
+			log.Printf("%s: %v", path.Join(rel, name), err)
+			continue
+		}
+		for _, r := range bc.roots {
+			root := path.Join(rel, r)
+			if root == ".." || strings.HasPrefix(root, "../") {
+				log.Printf("%s: module directory %q is not in the repository", path.Join(rel, name), r)
+				continue
+			}
+			if root == "." {
+				root = ""
+			}
+			pc.addIncludeRoot(root)
+		}
+	}
+}
+
+// addIncludeRoot adds root to the include roots, unless it's already there.
+// The slice is copied, since it may be shared with the configuration of
+// parent directories.
+func (pc *ProtoConfig) addIncludeRoot(root string) {
+	for _, r := range pc.includeRoots {
+		if r == root {
+			return
+		}
+	}
+	pc.includeRoots = append(pc.includeRoots[:len(pc.includeRoots):len(pc.includeRoots)], root)
+}
+
+// resolveWithBufDeps resolves imp to a rule in the repository of Buf
+// Schema Registry dependencies, if imp is in a directory set with the
+// proto_buf_dep_prefix directive. Rules in that repository are assumed to be
+// named by the default convention.
+func resolveWithBufDeps(c *config.Config, imp string) (label.Label, error) {
+	pc := GetProtoConfig(c)
+	if pc.bufDepsRepo == "" || !isBufDepImport(pc, imp) {
+		return label.NoLabel, errNotFound
+	}
+	rel := path.Dir(imp)
+	if rel == "." {
+		rel = ""
+	}
+	return label.New(pc.bufDepsRepo, rel, RuleName(rel)), nil
+}
+
+func isBufDepImport(pc *ProtoConfig, imp string) bool {
+	for _, prefix := range pc.bufDepPrefixes {
+		if pathtools.HasPrefix(imp, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBufConfig parses the contents of a buf.yaml or buf.work.yaml file.
+// Only the subset of YAML used by these files is supported: top-level keys
+// with scalar values, and lists of scalars or of mappings, in block or flow
+// style.
+//
+// In buf.work.yaml, roots are the listed directories. In buf.yaml, version
+// v2 roots are the paths of the listed modules, or "." if none are listed.
+// Otherwise, buf.yaml describes a single module rooted in its directory.
+func parseBufConfig(name string, data []byte) (bufConfig, error) {
+	var bc bufConfig
+	var key string
+	var modulePaths []string
+	hasModules := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := yamlscalar.StripComment(scanner.Text())
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' && line[0] != '-' {
+			k, v, ok := strings.Cut(trimmed, ":")
+			if !ok {
+				return bufConfig{}, fmt.Errorf("line %d: expected key", lineNum)
+			}
+			key = strings.TrimSpace(k)
+			v = strings.TrimSpace(v)
+			var err error
+			switch key {
+			case "version":
+				bc.version, err = yamlscalar.Unquote(v)
+			case "directories":
+				var roots []string
+				roots, err = parseYAMLFlowList(v)
+				bc.roots = append(bc.roots, roots...)
+			case "modules":
+				hasModules = true
+			}
+			if err != nil {
+				return bufConfig{}, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			continue
+		}
+
+		// The line is part of the value of key.
+		item := trimmed
+		isNewItem := strings.HasPrefix(item, "-")
+		if isNewItem {
+			item = strings.TrimSpace(item[1:])
+		}
+		var list *[]string
+		switch key {
+		case "directories":
+			if isNewItem {
+				list = &bc.roots
+			}
+		case "modules":
+			if k, v, ok := strings.Cut(item, ":"); ok && strings.TrimSpace(k) == "path" {
+				list, item = &modulePaths, strings.TrimSpace(v)
+			}
+		}
+		if list != nil {
+			v, err := yamlscalar.Unquote(item)
+			if err != nil {
+				return bufConfig{}, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			*list = append(*list, v)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return bufConfig{}, err
+	}
+
+	if name == bufFileName {
+		switch {
+		case bc.version != "v2":
+			bc.roots = []string{"."}
+		case hasModules:
+			bc.roots = modulePaths
+		default:
+			bc.roots = []string{"."}
+		}
+	}
+	return bc, nil
+}
+
+// parseYAMLFlowList parses a list written in flow style, like
+// "[a, b]". It returns nil for other values, including empty ones, which
+// start a list in block style.
+func parseYAMLFlowList(v string) ([]string, error) {
+	if !strings.HasPrefix(v, "[") || !strings.HasSuffix(v, "]") {
+		return nil, nil
+	}
+	var list []string
+	for _, elem := range strings.Split(v[1:len(v)-1], ",") {
+		if elem = strings.TrimSpace(elem); elem == "" {
+			continue
+		}
+		elem, err := yamlscalar.Unquote(elem)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, elem)
+	}
+	return list, nil
+}
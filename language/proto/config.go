@@ -49,6 +49,13 @@ type ProtoConfig struct {
 	// files into proto_library rules. If unset, the proto package name is used.
 	groupOption string
 
+	// namingConvention is a template for the names of generated
+	// proto_library rules, set with the proto_naming_convention directive.
+	// "{package}" and "{dir}" in the template are replaced with the last
+	// component of the proto package and of the directory. If empty, rules
+	// are named the default way.
+	namingConvention string
+
 	// StripImportPrefix The prefix to strip from the paths of the .proto files.
 	// If set, Gazelle will apply this value to the strip_import_prefix attribute
 	// within the proto_library_rule.
@@ -58,6 +65,36 @@ type ProtoConfig struct {
 	// If set, Gazelle will apply this value to the import_prefix attribute
 	// within the proto_library_rule.
 	ImportPrefix string
+
+	// includeRoots are slash-separated directories, relative to the
+	// repository root, that .proto files are imported relative to, like
+	// directories passed to protoc with -I. They're set with the
+	// proto_include directive.
+	includeRoots []string
+
+	// buf indicates whether buf.yaml and buf.work.yaml files are read. If so,
+	// the module directories they declare are added to includeRoots. It's set
+	// with the proto_buf directive.
+	buf bool
+
+	// bufDepsRepo is the name of the repository imports under bufDepPrefixes
+	// are resolved in. It's set with the proto_buf_deps_repo directive.
+	bufDepsRepo string
+
+	// bufDepPrefixes are import path prefixes of .proto files that are
+	// resolved in bufDepsRepo. It's set with the proto_buf_dep_prefix
+	// directive.
+	bufDepPrefixes []string
+
+	// GrpcGateway indicates whether languages should generate grpc-gateway
+	// code for packages with google.api.http annotations. It is set with the
+	// proto_grpc_gateway directive.
+	GrpcGateway bool
+
+	// Validate indicates whether languages should generate protoc-gen-validate
+	// code for packages with validate options. It is set with the
+	// proto_validate directive.
+	Validate bool
 }
 
 // GetProtoConfig returns the proto language configuration. If the proto
@@ -185,7 +222,7 @@ func (f *modeFlag) String() string {
 }
 
 func (*protoLang) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config) {
-	pc := &ProtoConfig{}
+	pc := &ProtoConfig{bufDepsRepo: defaultBufDepsRepo}
 	c.Exts[protoName] = pc
 
 	// Note: the -proto flag does not set the ModeExplicit flag. We want to
@@ -200,14 +237,36 @@ func (*protoLang) CheckFlags(fs *flag.FlagSet, c *config.Config) error {
 	return nil
 }
 
+// protoDirectives declares the proto directives whose values are bools.
+var protoDirectives = []config.DirectiveInfo{
+	{Name: "proto_buf", Type: config.BoolDirective},
+	{Name: "proto_grpc_gateway", Type: config.BoolDirective},
+	{Name: "proto_validate", Type: config.BoolDirective},
+}
+
+func (*protoLang) Directives() []config.DirectiveInfo {
+	return protoDirectives
+}
+
 func (*protoLang) KnownDirectives() []string {
-	return []string{"proto", "proto_group", "proto_strip_import_prefix", "proto_import_prefix"}
+	return []string{"proto", "proto_group", "proto_naming_convention", "proto_strip_import_prefix", "proto_import_prefix", "proto_include", "proto_buf", "proto_buf_deps_repo", "proto_buf_dep_prefix", "proto_grpc_gateway", "proto_validate"}
 }
 
 func (*protoLang) Configure(c *config.Config, rel string, f *rule.File) {
 	pc := &ProtoConfig{}
 	*pc = *GetProtoConfig(c)
 	c.Exts[protoName] = pc
+	// Invalid values of declared directives are reported by walk.
+	for _, d := range config.ParseDirectives(protoDirectives, rel, f) {
+		switch d.Name {
+		case "proto_buf":
+			pc.buf = d.Bool
+		case "proto_grpc_gateway":
+			pc.GrpcGateway = d.Bool
+		case "proto_validate":
+			pc.Validate = d.Bool
+		}
+	}
 	if f != nil {
 		for _, d := range f.Directives {
 			switch d.Key {
@@ -221,6 +280,16 @@ func (*protoLang) Configure(c *config.Config, rel string, f *rule.File) {
 				pc.ModeExplicit = true
 			case "proto_group":
 				pc.groupOption = d.Value
+			case "proto_naming_convention":
+				if d.Value == "default" {
+					pc.namingConvention = ""
+					continue
+				}
+				if err := checkNamingConvention(d.Value); err != nil {
+					log.Printf("%s: invalid value for proto_naming_convention: %v", f.Path, err)
+					continue
+				}
+				pc.namingConvention = d.Value
 			case "proto_strip_import_prefix":
 				pc.StripImportPrefix = d.Value
 				if err := checkStripImportPrefix(pc.StripImportPrefix, rel); err != nil {
@@ -228,12 +297,72 @@ func (*protoLang) Configure(c *config.Config, rel string, f *rule.File) {
 				}
 			case "proto_import_prefix":
 				pc.ImportPrefix = d.Value
+			case "proto_include":
+				// Special syntax (empty value) to reset directive.
+				if d.Value == "" {
+					pc.includeRoots = nil
+					continue
+				}
+				root := path.Join(rel, d.Value)
+				if path.IsAbs(d.Value) || root == ".." || strings.HasPrefix(root, "../") {
+					log.Printf("%s: proto_include %q is not a directory in the repository", f.Path, d.Value)
+					continue
+				}
+				if root == "." {
+					root = ""
+				}
+				pc.includeRoots = append(pc.includeRoots[:len(pc.includeRoots):len(pc.includeRoots)], root)
+			case "proto_buf_deps_repo":
+				pc.bufDepsRepo = d.Value
+			case "proto_buf_dep_prefix":
+				// Special syntax (empty value) to reset directive.
+				if d.Value == "" {
+					pc.bufDepPrefixes = nil
+					continue
+				}
+				pc.bufDepPrefixes = append(pc.bufDepPrefixes[:len(pc.bufDepPrefixes):len(pc.bufDepPrefixes)], d.Value)
 			}
 		}
 	}
+	if pc.buf {
+		pc.configureBuf(c, rel)
+	}
+	if pc.StripImportPrefix == "" {
+		// Protos in an include root are imported relative to it.
+		if root := pc.includeRootOf(rel); root != "" {
+			pc.StripImportPrefix = "/" + root
+		}
+	}
 	inferProtoMode(c, rel, f)
 }
 
+// includeRootOf returns the innermost include root containing the directory
+// rel, or "" if there is none.
+func (pc *ProtoConfig) includeRootOf(rel string) string {
+	innermost := ""
+	for _, root := range pc.includeRoots {
+		if len(root) > len(innermost) && pathtools.HasPrefix(rel, root) {
+			innermost = root
+		}
+	}
+	return innermost
+}
+
+// checkNamingConvention returns an error if the rule names produced by
+// the naming convention template nc wouldn't be identifiers.
+func checkNamingConvention(nc string) error {
+	rest := strings.NewReplacer("{package}", "x", "{dir}", "x").Replace(nc)
+	if rest == "" {
+		return fmt.Errorf("empty naming convention")
+	}
+	for _, c := range rest {
+		if !isIdentChar(c) {
+			return fmt.Errorf("%q may only contain letters, digits, underscores, {package}, and {dir}", nc)
+		}
+	}
+	return nil
+}
+
 // inferProtoMode sets ProtoConfig.Mode based on the directory name and the
 // contents of f. If the proto mode is set explicitly, this function does not
 // change it. If this is a vendor directory, or go_proto_library is loaded from
@@ -15,7 +15,10 @@ limitations under the License.
 
 package proto
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestCheckStripImportPrefix(t *testing.T) {
 	testCases := []struct {
@@ -47,3 +50,59 @@ func TestCheckStripImportPrefix(t *testing.T) {
 		})
 	}
 }
+
+func TestParseBufConfig(t *testing.T) {
+	for _, tc := range []struct {
+		desc, name, content string
+		want                bufConfig
+	}{
+		{
+			desc: "work_v1",
+			name: bufWorkFileName,
+			content: `version: v1
+directories:
+  - proto
+  - "third_party/proto" # vendored
+`,
+			want: bufConfig{version: "v1", roots: []string{"proto", "third_party/proto"}},
+		}, {
+			desc: "module_v1",
+			name: bufFileName,
+			content: `version: v1
+deps:
+- buf.build/googleapis/googleapis
+lint:
+  use:
+    - DEFAULT
+`,
+			want: bufConfig{version: "v1", roots: []string{"."}},
+		}, {
+			desc: "workspace_v2",
+			name: bufFileName,
+			content: `version: v2
+modules:
+  - path: proto
+    name: buf.build/acme/weather
+  - name: buf.build/acme/vendored
+    path: 'vendor/protos'
+deps: [buf.build/bufbuild/protovalidate, "buf.build/googleapis/googleapis"]
+`,
+			want: bufConfig{version: "v2", roots: []string{"proto", "vendor/protos"}},
+		}, {
+			desc:    "module_v2",
+			name:    bufFileName,
+			content: "version: v2\n",
+			want:    bufConfig{version: "v2", roots: []string{"."}},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := parseBufConfig(tc.name, []byte(tc.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %#v; want %#v", got, tc.want)
+			}
+		})
+	}
+}
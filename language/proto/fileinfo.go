@@ -37,6 +37,14 @@ type FileInfo struct {
 
 	HasServices bool
 
+	// HasHTTPAnnotations indicates whether the file uses google.api.http
+	// options, which grpc-gateway uses to generate reverse proxies.
+	HasHTTPAnnotations bool
+
+	// HasValidateRules indicates whether the file uses validate options from
+	// protoc-gen-validate.
+	HasValidateRules bool
+
 	Services []string
 	Messages []string
 	Enums []string
@@ -107,6 +115,12 @@ func protoFileInfo(dir, name string) FileInfo {
 			}
 
 
+		case match[httpOptSubexpIndex] != nil:
+			info.HasHTTPAnnotations = true
+
+		case match[validateOptSubexpIndex] != nil:
+			info.HasValidateRules = true
+
 		default:
 			// Comment matched. Nothing to extract.
 		}
@@ -124,6 +138,8 @@ const (
 	serviceSubexpIndex = 5
 	messageSubexpIndex = 6
 	enumSubexpIndex = 7
+	httpOptSubexpIndex = 8
+	validateOptSubexpIndex = 9
 )
 
 // Based on https://developers.google.com/protocol-buffers/docs/reference/proto3-spec
@@ -141,8 +157,10 @@ func buildProtoRegexp() *regexp.Regexp {
 	serviceStmt := `(?P<service>service\s+` + ident + `\s*{)`
 	messageStmt := `(?P<message>message\s+` + ident + `\s*{)`
 	enumStmt := `(?P<enum>enum\s+` + ident + `\s*{)`
+	httpOpt := `(?P<httpopt>\(\s*google\.api\.http\s*\))`
+	validateOpt := `(?P<validateopt>\(\s*validate\.` + ident + `\s*\))`
 	comment := `//[^\n]*`
-	protoReSrc := strings.Join([]string{importStmt, packageStmt, optionStmt, serviceStmt, messageStmt, enumStmt, comment}, "|")
+	protoReSrc := strings.Join([]string{importStmt, packageStmt, optionStmt, serviceStmt, messageStmt, enumStmt, httpOpt, validateOpt, comment}, "|")
 	return regexp.MustCompile(protoReSrc)
 }
 
@@ -32,6 +32,8 @@ func TestProtoRegexpGroupNames(t *testing.T) {
 		"service": serviceSubexpIndex,
 		"message": messageSubexpIndex,
 		"enum": enumSubexpIndex,
+		"httpopt": httpOptSubexpIndex,
+		"validateopt": validateOptSubexpIndex,
 	}
 	for name, index := range nameMap {
 		if names[index] != name {
@@ -132,6 +134,32 @@ import "second.proto";`,
 				Services: []string{"ChatService"},
 			},
 		},
+		{
+			desc:  "http annotation",
+			name:  "gateway.proto",
+			proto: `service Echo {
+  rpc Echo(Req) returns (Resp) {
+    option ( google.api.http ) = { post: "/v1/echo" };
+  }
+}`,
+			want: FileInfo{
+				HasServices: true,
+				HasHTTPAnnotations: true,
+				Services: []string{"Echo"},
+			},
+		},
+		{
+			desc:  "validate rules",
+			name:  "validate.proto",
+			proto: `message Req {
+  // (google.api.http) in a comment is ignored.
+  string name = 1 [(validate.rules).string.min_len = 1];
+}`,
+			want: FileInfo{
+				HasValidateRules: true,
+				Messages: []string{"Req"},
+			},
+		},
 		{
 			desc:  "service no space before service name not matched",
 			name:  "service.proto",
@@ -241,6 +269,8 @@ import "second.proto";`,
 				Imports:     got.Imports,
 				Options:     got.Options,
 				HasServices: got.HasServices,
+				HasHTTPAnnotations: got.HasHTTPAnnotations,
+				HasValidateRules: got.HasValidateRules,
 				Services:    got.Services,
 				Messages:    got.Messages,
 				Enums:       got.Enums,
@@ -69,10 +69,11 @@ func (*protoLang) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		}
 	}
 	pkgs := buildPackages(pc, args.Dir, args.Rel, regularProtoFiles, genProtoFilesNotConsumed)
-	shouldSetVisibility := args.File == nil || !args.File.HasDefaultVisibility()
+	shouldSetVisibility := !c.OmitVisibility && !c.HasRepoDefaultVisibility() && (args.File == nil || !args.File.HasDefaultVisibility())
 	var res language.GenerateResult
-	for _, pkg := range pkgs {
-		r := generateProto(pc, args.Rel, pkg, shouldSetVisibility)
+	names := ruleNames(pc, args.Rel, args.File, pkgs)
+	for i, pkg := range pkgs {
+		r := generateProto(pc, args.Rel, pkg, names[i], shouldSetVisibility)
 		if r.IsEmpty(protoKinds[r.Kind()]) {
 			res.Empty = append(res.Empty, r)
 		} else {
@@ -96,16 +97,7 @@ func (*protoLang) GenerateRules(args language.GenerateArgs) language.GenerateRes
 func RuleName(names ...string) string {
 	base := "root"
 	for _, name := range names {
-		notIdent := func(c rune) bool {
-			return !('A' <= c && c <= 'Z' ||
-				'a' <= c && c <= 'z' ||
-				'0' <= c && c <= '9' ||
-				c == '_')
-		}
-		if i := strings.LastIndexFunc(name, notIdent); i >= 0 {
-			name = name[i+1:]
-		}
-		if name != "" {
+		if name = identSuffix(name); name != "" {
 			base = name
 			break
 		}
@@ -113,6 +105,92 @@ func RuleName(names ...string) string {
 	return base + "_proto"
 }
 
+// identSuffix returns the longest suffix of s made of identifier characters.
+func identSuffix(s string) string {
+	notIdent := func(c rune) bool { return !isIdentChar(c) }
+	if i := strings.LastIndexFunc(s, notIdent); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
+
+func isIdentChar(c rune) bool {
+	return 'A' <= c && c <= 'Z' ||
+		'a' <= c && c <= 'z' ||
+		'0' <= c && c <= '9' ||
+		c == '_'
+}
+
+// ruleNames returns names for the proto_library rules generated for pkgs in
+// the directory rel. Rules are named using the naming convention set with
+// # gazelle:proto_naming_convention, except in file mode, for packages
+// grouped with # gazelle:proto_group, and for packages whose names would
+// collide. Those rules are named the default way.
+//
+// If f has a proto_library rule named for a package under either the default
+// convention or the configured one, that name is used instead, so existing
+// rules are updated rather than duplicated when the convention changes.
+func ruleNames(pc *ProtoConfig, rel string, f *rule.File, pkgs []*Package) []string {
+	defaultNames := make([]string, len(pkgs))
+	conventionNames := make([]string, len(pkgs))
+	conventionCount := make(map[string]int)
+	for i, pkg := range pkgs {
+		if pc.Mode == DefaultMode {
+			defaultNames[i] = RuleName(goPackageName(pkg), pc.GoPrefix, rel)
+		} else {
+			defaultNames[i] = RuleName(pkg.RuleName, pkg.Name, rel)
+		}
+		if pc.namingConvention != "" && pc.Mode != FileMode && pkg.RuleName == "" {
+			conventionNames[i] = conventionRuleName(pc.namingConvention, rel, pkg)
+			conventionCount[conventionNames[i]]++
+		}
+	}
+
+	existing := make(map[string]bool)
+	if f != nil {
+		for _, r := range f.Rules {
+			if r.Kind() == "proto_library" {
+				existing[r.Name()] = true
+			}
+		}
+	}
+	names := make([]string, len(pkgs))
+	used := make(map[string]bool)
+	for i := range pkgs {
+		name := defaultNames[i]
+		if conventionNames[i] != "" && conventionCount[conventionNames[i]] == 1 {
+			name = conventionNames[i]
+		}
+		if !existing[name] {
+			for _, alt := range []string{defaultNames[i], conventionNames[i]} {
+				if alt != "" && existing[alt] && !used[alt] {
+					name = alt
+					break
+				}
+			}
+		}
+		names[i] = name
+		used[name] = true
+	}
+	return names
+}
+
+// conventionRuleName returns the name for pkg's proto_library rule in the
+// directory rel according to the naming convention template nc.
+func conventionRuleName(nc, rel string, pkg *Package) string {
+	dir := identSuffix(path.Base(rel))
+	if rel == "" || dir == "" {
+		dir = "root"
+	}
+	pkgName := dir
+	if pkg.Name != "" {
+		if name := identSuffix(pkg.Name); name != "" {
+			pkgName = name
+		}
+	}
+	return strings.NewReplacer("{package}", pkgName, "{dir}", dir).Replace(nc)
+}
+
 // buildPackage extracts metadata from the .proto files in a directory and
 // constructs possibly several packages, then selects a package to generate
 // a proto_library rule for.
@@ -157,9 +235,17 @@ func buildPackages(pc *ProtoConfig, dir, rel string, protoFiles, genFiles []stri
 		return []*Package{pkg}
 
 	case PackageMode, FileMode:
-		pkgs := make([]*Package, 0, len(packageMap))
-		for _, pkg := range packageMap {
-			pkgs = append(pkgs, pkg)
+		keys := make([]string, 0, len(packageMap))
+		for key := range packageMap {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		pkgs := make([]*Package, 0, len(keys))
+		for _, key := range keys {
+			pkgs = append(pkgs, packageMap[key])
+		}
+		if pc.Mode == PackageMode {
+			disambiguatePackageRuleNames(rel, pkgs)
 		}
 		return pkgs
 
@@ -184,7 +270,30 @@ func selectPackage(dir, rel string, packageMap map[string]*Package) (*Package, e
 			return pkg, nil
 		}
 	}
-	return nil, fmt.Errorf("%s: directory contains multiple proto packages. Gazelle can only generate a proto_library for one package.", dir)
+	return nil, fmt.Errorf("%s: directory contains multiple proto packages. Gazelle can only generate a proto_library for one package. Add # gazelle:proto package to generate a proto_library for each package.", dir)
+}
+
+// disambiguatePackageRuleNames ensures packages generated in the same
+// directory in package mode get different rule names. By default, a rule is
+// named after the last component of its proto package, so packages like
+// "a.v1" and "b.v1" would both be named "v1_proto". When that happens, the
+// colliding rules are named after their full package names instead.
+func disambiguatePackageRuleNames(rel string, pkgs []*Package) {
+	byName := make(map[string][]*Package)
+	for _, pkg := range pkgs {
+		name := RuleName(pkg.RuleName, pkg.Name, rel)
+		byName[name] = append(byName[name], pkg)
+	}
+	for _, colliding := range byName {
+		if len(colliding) < 2 {
+			continue
+		}
+		for _, pkg := range colliding {
+			if pkg.RuleName == "" && pkg.Name != "" {
+				pkg.RuleName = strings.ReplaceAll(pkg.Name, ".", "_")
+			}
+		}
+	}
 }
 
 // goPackageName guesses the identifier in package declarations at the top of
@@ -214,15 +323,9 @@ func goPackageName(pkg *Package) string {
 	return ""
 }
 
-// generateProto creates a new proto_library rule for a package. The rule may
-// be empty if there are no sources.
-func generateProto(pc *ProtoConfig, rel string, pkg *Package, shouldSetVisibility bool) *rule.Rule {
-	var name string
-	if pc.Mode == DefaultMode {
-		name = RuleName(goPackageName(pkg), pc.GoPrefix, rel)
-	} else {
-		name = RuleName(pkg.RuleName, pkg.Name, rel)
-	}
+// generateProto creates a new proto_library rule named name for a package.
+// The rule may be empty if there are no sources.
+func generateProto(pc *ProtoConfig, rel string, pkg *Package, name string, shouldSetVisibility bool) *rule.Rule {
 	r := rule.NewRule("proto_library", name)
 	srcs := make([]string, 0, len(pkg.Files))
 	for f := range pkg.Files {
@@ -31,6 +31,16 @@ var protoKinds = map[string]rule.KindInfo{
 			"strip_import_prefix": true,
 		},
 		ResolveAttrs: map[string]bool{"deps": true},
+		KnownAttrs: map[string]bool{
+			"allow_exports":       true,
+			"data":                true,
+			"deps":                true,
+			"exports":             true,
+			"import_prefix":       true,
+			"option_deps":         true,
+			"srcs":                true,
+			"strip_import_prefix": true,
+		},
 	},
 }
 
@@ -26,6 +26,11 @@ type Package struct {
 	Imports     map[string]bool
 	Options     map[string]string
 	HasServices bool
+
+	// HasHTTPAnnotations and HasValidateRules are true if any file in the
+	// package has the corresponding FileInfo field set.
+	HasHTTPAnnotations bool
+	HasValidateRules   bool
 }
 
 func newPackage(name string) *Package {
@@ -46,6 +51,8 @@ func (p *Package) addFile(info FileInfo) {
 		p.Options[opt.Key] = opt.Value
 	}
 	p.HasServices = p.HasServices || info.HasServices
+	p.HasHTTPAnnotations = p.HasHTTPAnnotations || info.HasHTTPAnnotations
+	p.HasValidateRules = p.HasValidateRules || info.HasValidateRules
 }
 
 func (p *Package) addGenFile(dir, name string) {
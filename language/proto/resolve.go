@@ -19,7 +19,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
 	"path"
+	"path/filepath"
 	"sort"
 	"strings"
 
@@ -29,6 +31,7 @@ import (
 	"github.com/bazelbuild/bazel-gazelle/repo"
 	"github.com/bazelbuild/bazel-gazelle/resolve"
 	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/bazelbuild/bazel-gazelle/walk"
 )
 
 func (*protoLang) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
@@ -74,6 +77,10 @@ func (*protoLang) Embeds(r *rule.Rule, from label.Label) []label.Label {
 	return nil
 }
 
+// ResolveConcurrently returns true, since Resolve doesn't modify shared
+// state.
+func (*protoLang) ResolveConcurrently() bool { return true }
+
 func (*protoLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, importsRaw interface{}, from label.Label) {
 	if importsRaw == nil {
 		// may not be set in tests.
@@ -81,7 +88,7 @@ func (*protoLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.Remo
 	}
 	imports := importsRaw.([]string)
 	r.DelAttr("deps")
-	depSet := make(map[string]bool)
+	depImports := make(map[string][]string)
 	for _, imp := range imports {
 		l, err := resolveProto(c, ix, r, imp, from)
 		if err == errSkipImport {
@@ -89,18 +96,43 @@ func (*protoLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.Remo
 		} else if err != nil {
 			log.Print(err)
 		} else {
+			if c.RecordProvenance {
+				addDepProvenance(c, ix, r, imp, l, from)
+			}
 			l = l.Rel(from.Repo, from.Pkg)
-			depSet[l.String()] = true
+			depImports[l.String()] = append(depImports[l.String()], imp)
 		}
 	}
-	if len(depSet) > 0 {
-		deps := make([]string, 0, len(depSet))
-		for dep := range depSet {
+	if len(depImports) > 0 {
+		deps := make([]string, 0, len(depImports))
+		for dep := range depImports {
 			deps = append(deps, dep)
 		}
 		sort.Strings(deps)
 		r.SetAttr("deps", deps)
+		if c.AnnotateDeps {
+			r.SetImportComments("deps", depImports)
+		}
+	}
+}
+
+// addDepProvenance records why the dependency on l, resolved from the import
+// imp, is in the deps of r, naming the files of r that import it.
+func addDepProvenance(c *config.Config, ix *resolve.RuleIndex, r *rule.Rule, imp string, l, from label.Label) {
+	var files []string
+	if pkg, ok := r.PrivateAttr(PackageKey).(Package); ok {
+		for name, f := range pkg.Files {
+			for _, fi := range f.Imports {
+				if fi == imp {
+					files = append(files, name)
+					break
+				}
+			}
+		}
+		sort.Strings(files)
 	}
+	reason := resolve.ImportProvenance(c, ix, resolve.ImportSpec{Lang: "proto", Imp: imp}, "proto", files, l)
+	r.AddProvenance("deps", l.Rel(from.Repo, from.Pkg).String(), reason)
 }
 
 var (
@@ -108,6 +140,16 @@ var (
 	errNotFound   = errors.New("not found")
 )
 
+// ResolveImport resolves an imported .proto file the same way as the imports
+// of proto_library rules.
+func (*protoLang) ResolveImport(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, imp string, from label.Label) (label.Label, error) {
+	l, err := resolveProto(c, ix, nil, imp, from)
+	if err == errSkipImport {
+		return label.NoLabel, nil
+	}
+	return l, err
+}
+
 func resolveProto(c *config.Config, ix *resolve.RuleIndex, r *rule.Rule, imp string, from label.Label) (label.Label, error) {
 	pc := GetProtoConfig(c)
 	if !strings.HasSuffix(imp, ".proto") {
@@ -143,6 +185,14 @@ func resolveProto(c *config.Config, ix *resolve.RuleIndex, r *rule.Rule, imp str
 		return label.NoLabel, err
 	}
 
+	if l, err := resolveWithIncludeRoots(c, imp, from); err == nil || err == errSkipImport {
+		return l, err
+	}
+
+	if l, err := resolveWithBufDeps(c, imp); err == nil {
+		return l, nil
+	}
+
 	rel := path.Dir(imp)
 	if rel == "." {
 		rel = ""
@@ -151,6 +201,51 @@ func resolveProto(c *config.Config, ix *resolve.RuleIndex, r *rule.Rule, imp str
 	return label.New("", rel, name), nil
 }
 
+// resolveWithIncludeRoots resolves imp to a rule in the directory of the
+// file it names in one of the include roots set with the proto_include
+// directive.
+func resolveWithIncludeRoots(c *config.Config, imp string, from label.Label) (label.Label, error) {
+	p, ok := FindIncludedFile(c, imp)
+	if !ok {
+		return label.NoLabel, errNotFound
+	}
+	rel := path.Dir(p)
+	if rel == "." {
+		rel = ""
+	}
+	l := label.New("", rel, RuleName(rel))
+	if l.Equal(from) {
+		return label.NoLabel, errSkipImport
+	}
+	return l, nil
+}
+
+// FindIncludedFile returns the slash-separated path, relative to the
+// repository root, of the .proto file imported as imp, if it's in one of the
+// include roots set with the proto_include directive. Roots set later are
+// searched first. The file system is checked instead of the rule index, so
+// roots that are symbolic links to shared proto trees work even if Gazelle
+// doesn't generate rules in them. Excluded files are skipped.
+//
+// Other extensions that resolve proto imports, like the Go extension, may
+// use it when imp isn't indexed.
+func FindIncludedFile(c *config.Config, imp string) (string, bool) {
+	pc := GetProtoConfig(c)
+	if pc == nil {
+		return "", false
+	}
+	for i := len(pc.includeRoots) - 1; i >= 0; i-- {
+		p := path.Join(pc.includeRoots[i], imp)
+		if walk.IsExcluded(c, p) {
+			continue
+		}
+		if fi, err := os.Stat(filepath.Join(c.RepoRoot, filepath.FromSlash(p))); err == nil && !fi.IsDir() {
+			return p, true
+		}
+	}
+	return "", false
+}
+
 func resolveWithIndex(c *config.Config, ix *resolve.RuleIndex, imp string, from label.Label) (label.Label, error) {
 	matches := ix.FindRulesByImportWithConfig(c, resolve.ImportSpec{Lang: "proto", Imp: imp}, "proto")
 	if len(matches) == 0 {
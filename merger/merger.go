@@ -70,6 +70,15 @@ const (
 // TODO(jayconrod): make this stable *or* find a better way to express it.
 const UnstableInsertIndexKey = "_gazelle_insert_index"
 
+// UnstableDeleteKey is the name of an internal attribute that may be set on
+// generated rules while their dependencies are resolved. In the post-resolve
+// merge, MergeFile deletes the existing rule that matches a generated rule
+// with this key set to true, unless it's marked with # keep. The generated
+// rule is not inserted if no rule matches.
+//
+// This definition is unstable and may be removed in the future.
+const UnstableDeleteKey = "_gazelle_delete"
+
 // MergeFile combines information from newly generated rules with matching
 // rules in an existing build file. MergeFile can also delete rules which
 // are empty after merging.
@@ -97,7 +106,9 @@ const UnstableInsertIndexKey = "_gazelle_insert_index"
 // separately. If an attribute is mergeable (according to KindInfo), values
 // from the existing attribute are replaced by values from the generated
 // attribute. Comments are preserved on values that are present in both
-// versions of the attribute. If at attribute is not mergeable, the generated
+// versions of the attribute. Comments attached to a generated attribute with
+// rule.Rule.SetAttrComment replace the existing attribute's comments at the
+// same position. If at attribute is not mergeable, the generated
 // version of the attribute will be added if no existing attribute is present;
 // otherwise, the existing attribute will be preserved.
 //
@@ -106,6 +117,9 @@ const UnstableInsertIndexKey = "_gazelle_insert_index"
 // If an attribute is marked with a "# keep" comment, it will not be merged.
 // If a rule is marked with a "# keep" comment, the whole rule will not
 // be modified.
+//
+// In the PostResolve phase, rules marked with a "# gazelle:no_resolve"
+// comment are not modified either, so their dependencies are left alone.
 func MergeFile(oldFile *rule.File, emptyRules, genRules []*rule.Rule, phase Phase, kinds map[string]rule.KindInfo) {
 	getMergeAttrs := func(r *rule.Rule) map[string]bool {
 		if phase == PreResolve {
@@ -118,7 +132,7 @@ func MergeFile(oldFile *rule.File, emptyRules, genRules []*rule.Rule, phase Phas
 	// Merge empty rules into the file and delete any rules which become empty.
 	for _, emptyRule := range emptyRules {
 		if oldRule, _ := match(oldFile.Rules, emptyRule, kinds[emptyRule.Kind()], false); oldRule != nil {
-			if oldRule.ShouldKeep() {
+			if oldRule.ShouldKeep() || (phase == PostResolve && !oldRule.ShouldResolve()) {
 				continue
 			}
 			rule.MergeRules(emptyRule, oldRule, getMergeAttrs(emptyRule), oldFile.Path)
@@ -162,13 +176,19 @@ func MergeFile(oldFile *rule.File, emptyRules, genRules []*rule.Rule, phase Phas
 		if matchErrors[i] != nil {
 			continue
 		}
+		if del, _ := genRule.PrivateAttr(UnstableDeleteKey).(bool); del && phase == PostResolve {
+			if matchRules[i] != nil && !matchRules[i].ShouldKeep() {
+				matchRules[i].Delete()
+			}
+			continue
+		}
 		if matchRules[i] == nil {
 			if index, ok := genRule.PrivateAttr(UnstableInsertIndexKey).(int); ok {
 				genRule.InsertAt(oldFile, index)
 			} else {
 				genRule.Insert(oldFile)
 			}
-		} else {
+		} else if phase == PreResolve || matchRules[i].ShouldResolve() {
 			rule.MergeRules(genRule, matchRules[i], getMergeAttrs(genRule), oldFile.Path)
 		}
 	}
@@ -239,16 +239,60 @@ go_library(
         "bar.go",  # keep
         "foo.go",  # keep
     ] + select({
+        "darwin_amd64": [
+            "bar_darwin_amd64.go",
+        ],
         "linux_arm": [
             "bar_linux_arm.go",
             "foo_linux_arm.go",
         ],
-        "darwin_amd64": [
-            "bar_darwin_amd64.go",
-        ],
         "//conditions:default": [],
     }),
 )
+`,
+	}, {
+		desc: "sort select arms with custom config_settings",
+		previous: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["foo.go"],
+    deps = select({
+        "//conditions:default": [],
+        "//config:fast": [":fast"],
+        "@io_bazel_rules_go//go/platform:linux": [":linux"],
+        ":local": [":local"],
+    }),  # keep
+)
+`,
+		current: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = [
+        "bar.go",
+        "foo.go",
+    ],
+)
+`,
+		expected: `
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = [
+        "bar.go",
+        "foo.go",
+    ],
+    deps = select({
+        "//config:fast": [":fast"],
+        ":local": [":local"],
+        "@io_bazel_rules_go//go/platform:linux": [":linux"],
+        "//conditions:default": [],
+    }),  # keep
+)
 `,
 	}, {
 		desc: "merge old list and dict with gen list and dict",
@@ -0,0 +1,327 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/bazelbuild/buildtools/tables"
+)
+
+// buildozerKindChanges collects buildozer commands equivalent to map_kind
+// changes of existing rules in one build file. Commands are written in the
+// format accepted by "buildozer -f".
+type buildozerKindChanges struct {
+	pkg         string
+	existing    map[*rule.Rule]bool
+	loads       []string
+	seenLoads   map[string]bool
+	kindChanges []string
+}
+
+func newBuildozerKindChanges(rel string, f *rule.File) *buildozerKindChanges {
+	existing := make(map[*rule.Rule]bool, len(f.Rules))
+	for _, r := range f.Rules {
+		existing[r] = true
+	}
+	return &buildozerKindChanges{
+		pkg:       rel,
+		existing:  existing,
+		seenLoads: make(map[string]bool),
+	}
+}
+
+// add records a change of r's kind to repl.KindName. Rules that were not in
+// the build file before Gazelle ran are ignored.
+func (b *buildozerKindChanges) add(r *rule.Rule, repl config.MappedKind) {
+	if !b.existing[r] {
+		return
+	}
+	if repl.KindLoad != "" {
+		load := fmt.Sprintf("new_load %s %s", repl.KindLoad, repl.KindName)
+		if !b.seenLoads[load] {
+			b.seenLoads[load] = true
+			b.loads = append(b.loads, load)
+		}
+	}
+	b.kindChanges = append(b.kindChanges, fmt.Sprintf("set kind %s|%s", repl.KindName, label.New("", b.pkg, r.Name())))
+}
+
+func (b *buildozerKindChanges) writeTo(buf *bytes.Buffer) {
+	if len(b.kindChanges) == 0 {
+		return
+	}
+	pkgLabel := label.New("", b.pkg, "__pkg__")
+	for _, load := range b.loads {
+		fmt.Fprintf(buf, "%s|%s\n", load, pkgLabel)
+	}
+	for _, change := range b.kindChanges {
+		fmt.Fprintln(buf, change)
+	}
+	fmt.Fprintf(buf, "fix unusedLoads|%s\n", pkgLabel)
+}
+
+// buildozerFile prints buildozer commands that turn the original content of
+// f into its new content, in the format accepted by "buildozer -f". It's
+// used by -mode=buildozer.
+func buildozerFile(c *config.Config, f *rule.File) error {
+	newContent := f.Format()
+	if bytes.Equal(f.Content, newContent) {
+		return nil
+	}
+	old, err := rule.LoadData(f.Path, f.Pkg, f.Content)
+	if err != nil {
+		return err
+	}
+	updated, err := rule.LoadData(f.Path, f.Pkg, newContent)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if len(f.Content) == 0 {
+		// buildozer only edits existing files.
+		rel, err := filepath.Rel(c.RepoRoot, findOutputPath(c, f))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "# Create %s before running these commands.\n", filepath.ToSlash(rel))
+	}
+	if err := writeBuildozerCommands(&buf, f.Path, f.Pkg, old, updated); err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+// writeBuildozerCommands writes buildozer commands that change the loads and
+// rules in old to match those in updated. Rules are matched by name, and
+// comments aren't copied. An error is returned if a value can't be set with
+// buildozer, like a list concatenated with a select expression in a list
+// attribute, since the commands wouldn't make the same changes.
+func writeBuildozerCommands(buf *bytes.Buffer, path, pkg string, old, updated *rule.File) error {
+	pkgLabel := label.New("", pkg, "__pkg__")
+
+	oldSymbols := make(map[string]bool)
+	for _, l := range old.Loads {
+		for _, sym := range l.Symbols() {
+			oldSymbols[l.Name()+" "+sym] = true
+		}
+	}
+	newSymbols := make(map[string]bool)
+	for _, l := range updated.Loads {
+		for _, sym := range l.Symbols() {
+			key := l.Name() + " " + sym
+			newSymbols[key] = true
+			if !oldSymbols[key] {
+				fmt.Fprintf(buf, "new_load %s %s|%s\n", escapeBuildozerArg(l.Name()), escapeBuildozerArg(sym), pkgLabel)
+			}
+		}
+	}
+	removedLoads := false
+	for key := range oldSymbols {
+		if !newSymbols[key] {
+			removedLoads = true
+			break
+		}
+	}
+
+	oldRules := make(map[string]*rule.Rule)
+	for _, r := range old.Rules {
+		oldRules[r.Name()] = r
+	}
+	newRules := make(map[string]bool)
+	for _, r := range updated.Rules {
+		newRules[r.Name()] = true
+		l := label.New("", pkg, r.Name())
+		o := oldRules[r.Name()]
+		if o == nil {
+			fmt.Fprintf(buf, "new %s %s|%s\n", r.Kind(), r.Name(), pkgLabel)
+		} else if o.Kind() != r.Kind() {
+			fmt.Fprintf(buf, "set kind %s|%s\n", r.Kind(), l)
+		}
+		if o != nil {
+			for _, key := range o.AttrKeys() {
+				if r.Attr(key) == nil {
+					fmt.Fprintf(buf, "remove %s|%s\n", key, l)
+				}
+			}
+		}
+		for _, key := range r.AttrKeys() {
+			if key == "name" {
+				continue
+			}
+			value := r.Attr(key)
+			var oldValue bzl.Expr
+			if o != nil {
+				oldValue = o.Attr(key)
+			}
+			if oldValue != nil && bzl.FormatString(oldValue) == bzl.FormatString(value) {
+				continue
+			}
+			cmds, ok := buildozerAttrCommands(key, value, oldValue != nil)
+			if !ok {
+				return fmt.Errorf("%s: the new value of %s in %s can't be set with buildozer", path, key, l)
+			}
+			for _, cmd := range cmds {
+				fmt.Fprintf(buf, "%s|%s\n", cmd, l)
+			}
+		}
+	}
+	for _, r := range old.Rules {
+		if !newRules[r.Name()] {
+			fmt.Fprintf(buf, "delete|%s\n", label.New("", pkg, r.Name()))
+		}
+	}
+	if removedLoads {
+		fmt.Fprintf(buf, "fix unusedLoads|%s\n", pkgLabel)
+	}
+	return nil
+}
+
+// buildozerAttrCommands returns buildozer commands that set the attribute key
+// to value. hadValue tells whether the attribute was set before. ok is false
+// if buildozer can't set the value.
+//
+// buildozer interprets values of "set" commands by the attribute's type.
+// In attributes buildozer treats as lists, each argument is a string, so
+// lists of strings are written with "add", and selects of non-empty lists of
+// strings are written with "set_select". Other values of list and label
+// attributes can't be set. In other attributes, a string is set as a string,
+// and other expressions are passed through, written on one line.
+func buildozerAttrCommands(key string, value bzl.Expr, hadValue bool) (cmds []string, ok bool) {
+	if str, ok := value.(*bzl.StringExpr); ok {
+		if strings.Contains(str.Value, "\n") {
+			return nil, false
+		}
+		return []string{"set " + key + " " + escapeBuildozerArg(strconv.Quote(str.Value))}, true
+	}
+
+	if list, ok := value.(*bzl.ListExpr); ok {
+		if args, ok := buildozerStringArgs(list); ok {
+			if hadValue {
+				cmds = append(cmds, "remove "+key)
+			}
+			if len(args) > 0 {
+				cmds = append(cmds, "add "+key+" "+strings.Join(args, " "))
+			}
+			return cmds, true
+		}
+	}
+
+	if !isBuildozerListAttr(key) && !tables.IsLabelArg[key] {
+		text, ok := buildozerExprArg(value)
+		if !ok {
+			return nil, false
+		}
+		return []string{"set " + key + " " + text}, true
+	}
+
+	call, ok := value.(*bzl.CallExpr)
+	if !ok || len(call.List) != 1 || !isBuildozerListAttr(key) {
+		return nil, false
+	}
+	if fn, ok := call.X.(*bzl.Ident); !ok || fn.Name != "select" {
+		return nil, false
+	}
+	dict, ok := call.List[0].(*bzl.DictExpr)
+	if !ok || len(dict.List) == 0 {
+		return nil, false
+	}
+	cmd := "set_select " + key
+	for _, kv := range dict.List {
+		condition, ok := kv.Key.(*bzl.StringExpr)
+		if !ok || strings.Contains(condition.Value, "\n") {
+			return nil, false
+		}
+		list, ok := kv.Value.(*bzl.ListExpr)
+		if !ok || len(list.List) == 0 {
+			// buildozer can't set an empty list for a condition.
+			return nil, false
+		}
+		args, ok := buildozerStringArgs(list)
+		if !ok {
+			return nil, false
+		}
+		for _, arg := range args {
+			cmd += " " + escapeBuildozerArg(condition.Value) + " " + arg
+		}
+	}
+	return []string{cmd}, true
+}
+
+// isBuildozerListAttr returns whether buildozer treats values of the
+// attribute key as lists of strings.
+func isBuildozerListAttr(key string) bool {
+	if isList, ok := tables.IsListArg[key]; ok {
+		return isList
+	}
+	return tables.IsSortableListArg[key]
+}
+
+// buildozerStringArgs returns the strings in list, quoted and escaped for
+// buildozer. ok is false if list has elements other than strings, or strings
+// that span lines.
+func buildozerStringArgs(list *bzl.ListExpr) (args []string, ok bool) {
+	args = make([]string, 0, len(list.List))
+	for _, elem := range list.List {
+		str, ok := elem.(*bzl.StringExpr)
+		if !ok || strings.Contains(str.Value, "\n") {
+			return nil, false
+		}
+		args = append(args, escapeBuildozerArg(strconv.Quote(str.Value)))
+	}
+	return args, true
+}
+
+// buildozerExprArg formats e on one line, escaped for buildozer. Line breaks
+// in formatted expressions are only whitespace, so they're replaced with
+// spaces. ok is false if e has comments or strings that span lines, which
+// can't be written on one line.
+func buildozerExprArg(e bzl.Expr) (arg string, ok bool) {
+	ok = true
+	bzl.Walk(e, func(x bzl.Expr, _ []bzl.Expr) {
+		if c := x.Comment(); len(c.Before) > 0 || len(c.Suffix) > 0 || len(c.After) > 0 {
+			ok = false
+		}
+		if str, isStr := x.(*bzl.StringExpr); isStr && strings.Contains(str.Value, "\n") {
+			ok = false
+		}
+	})
+	if !ok {
+		return "", false
+	}
+	lines := strings.Split(bzl.FormatString(e), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return escapeBuildozerArg(strings.Join(lines, " ")), true
+}
+
+// escapeBuildozerArg escapes spaces and pipes, which separate arguments and
+// commands in buildozer command files.
+func escapeBuildozerArg(s string) string {
+	return strings.NewReplacer(" ", `\ `, "|", `\|`).Replace(s)
+}
@@ -0,0 +1,136 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestWriteBuildozerCommands(t *testing.T) {
+	old := `load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+
+go_library(
+    name = "foo",
+    srcs = ["foo.go"],
+    cgo = True,
+    importpath = "example.com/foo",
+    visibility = ["//visibility:public"],
+)
+
+go_test(
+    name = "foo_test",
+    srcs = ["foo_test.go"],
+)
+`
+	updated := `load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library")
+load("//tools:go.bzl", "my_library")
+
+my_library(
+    name = "foo",
+    srcs = [
+        "foo.go",
+        "foo unix.go",
+    ],
+    importpath = "example.com/foo|bar",
+    pure = select({
+        "//:pure": "on",
+        "//conditions:default": "off",
+    }),
+    visibility = ["//visibility:public"],
+    x_defs = {"Version": "1.0"},
+    deps = select({
+        "@io_bazel_rules_go//go/platform:linux": [
+            "//bar",
+            "//baz",
+        ],
+        "//conditions:default": ["//bar"],
+    }),
+)
+
+go_binary(
+    name = "cmd",
+    embed = [":foo"],
+)
+`
+	oldFile, err := rule.LoadData("foo/BUILD.bazel", "foo", []byte(old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	updatedFile, err := rule.LoadData("foo/BUILD.bazel", "foo", []byte(updated))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeBuildozerCommands(&buf, "foo/BUILD.bazel", "foo", oldFile, updatedFile); err != nil {
+		t.Fatal(err)
+	}
+	want := `new_load @io_bazel_rules_go//go:def.bzl go_binary|//foo:__pkg__
+new_load //tools:go.bzl my_library|//foo:__pkg__
+set kind my_library|//foo
+remove cgo|//foo
+remove srcs|//foo
+add srcs "foo.go" "foo\ unix.go"|//foo
+set importpath "example.com/foo\|bar"|//foo
+set pure select({\ "//:pure":\ "on",\ "//conditions:default":\ "off",\ })|//foo
+set x_defs {"Version":\ "1.0"}|//foo
+set_select deps @io_bazel_rules_go//go/platform:linux "//bar" @io_bazel_rules_go//go/platform:linux "//baz" //conditions:default "//bar"|//foo
+new go_binary cmd|//foo:__pkg__
+add embed ":foo"|//foo:cmd
+delete|//foo:foo_test
+fix unusedLoads|//foo:__pkg__
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got commands:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteBuildozerCommandsUnsupported(t *testing.T) {
+	for _, tc := range []struct {
+		desc, deps string
+	}{
+		{
+			desc: "list_and_select",
+			deps: `["//a"] + select({"//:x": ["//b"], "//conditions:default": []})`,
+		}, {
+			desc: "empty_select_arm",
+			deps: `select({"//:x": ["//b"], "//conditions:default": []})`,
+		}, {
+			desc: "non_string_list",
+			deps: `[":a", LIB]`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			oldFile, err := rule.LoadData("foo/BUILD.bazel", "foo", []byte(`go_library(name = "foo")`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			updatedFile, err := rule.LoadData("foo/BUILD.bazel", "foo", []byte(`go_library(name = "foo", deps = `+tc.deps+`)`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			err = writeBuildozerCommands(&buf, "foo/BUILD.bazel", "foo", oldFile, updatedFile)
+			if want := "the new value of deps in //foo can't be set with buildozer"; err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("got error %v; want error containing %q", err, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// readChangedFiles parses the value of -changed_files. A value starting with
+// "@" names a file listing changed files, one per line, like the output of
+// git diff --name-only. Otherwise, the value is a comma-separated list of
+// changed files. Paths are slash-separated and relative to the repository
+// root. Relative file names are resolved from wd.
+func readChangedFiles(wd, value string) ([]string, error) {
+	var files []string
+	if strings.HasPrefix(value, "@") {
+		name := value[len("@"):]
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(wd, name)
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("reading -changed_files: %v", err)
+		}
+		files = strings.Split(string(data), "\n")
+	} else {
+		files = strings.Split(value, ",")
+	}
+	var changed []string
+	for _, f := range files {
+		if f = strings.TrimSpace(f); f != "" {
+			changed = append(changed, path.Clean(filepath.ToSlash(f)))
+		}
+	}
+	return changed, nil
+}
+
+// changedDirs returns the sorted, slash-separated paths of the directories
+// containing changed files, relative to repoRoot. Files in directories that
+// no longer exist are attributed to their closest existing ancestor, so
+// rules that listed them are updated.
+func changedDirs(repoRoot string, files []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, f := range files {
+		if path.IsAbs(f) || f == ".." || strings.HasPrefix(f, "../") {
+			return nil, fmt.Errorf("changed file %s: not a relative path in the repository", f)
+		}
+		dir := f
+		if fi, err := os.Stat(filepath.Join(repoRoot, filepath.FromSlash(f))); err != nil || !fi.IsDir() {
+			dir = path.Dir(f)
+		}
+		for dir != "." {
+			if fi, err := os.Stat(filepath.Join(repoRoot, filepath.FromSlash(dir))); err == nil && fi.IsDir() {
+				break
+			}
+			dir = path.Dir(dir)
+		}
+		if dir == "." {
+			dir = ""
+		}
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// dependsOnPackages returns whether a rule in f refers to a label in the
+// repository repoName in one of the packages pkgs. Rules in f need to be
+// resolved again when those packages change, since the rules they depend on
+// may have been renamed, split, or deleted.
+func dependsOnPackages(f *rule.File, repoName string, pkgs map[string]bool) bool {
+	for _, r := range f.Rules {
+		for _, key := range r.AttrKeys() {
+			for _, s := range r.AttrStrings(key) {
+				l, err := label.Parse(s)
+				if err != nil || l.Relative {
+					continue
+				}
+				if (l.Repo == "" || l.Repo == repoName) && pkgs[l.Pkg] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// hasIgnoreDirective returns whether f has a # gazelle:ignore directive,
+// which prevents Gazelle from updating it.
+func hasIgnoreDirective(f *rule.File) bool {
+	for _, d := range f.Directives {
+		if d.Key == "ignore" {
+			return true
+		}
+	}
+	return false
+}
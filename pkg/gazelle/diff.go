@@ -0,0 +1,151 @@
+/* Copyright 2016 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// ErrDiffChanges is returned by Run in -mode=diff when build files would
+// change.
+var ErrDiffChanges = fmt.Errorf("encountered changes while running diff")
+
+// diffFile records the diff of f's changes. Diffs are collected and written
+// together by writePatch, sorted by path, so the output doesn't depend on the
+// order files were visited.
+func diffFile(c *config.Config, f *rule.File) error {
+	rel, diff, err := unifiedDiff(c, f)
+	if err != nil || len(diff) == 0 {
+		return err
+	}
+	uc := getUpdateConfig(c)
+	uc.diffs = append(uc.diffs, fileDiff{path: rel, diff: diff})
+	return ErrDiffChanges
+}
+
+// unifiedDiff returns the slash-separated path of f relative to the
+// repository root and a unified diff between f's original and formatted
+// content. The diff is empty if the content didn't change.
+func unifiedDiff(c *config.Config, f *rule.File) (string, []byte, error) {
+	rel, err := filepath.Rel(c.RepoRoot, f.Path)
+	if err != nil {
+		return "", nil, fmt.Errorf("error getting old path for file %q: %v", f.Path, err)
+	}
+	rel = filepath.ToSlash(rel)
+
+	// The epoch timestamp is assumed to represent file creation/deletion events
+	// by some tools, so use a dummy timestamp that is one ns past the epoch.
+	// See https://github.com/bazelbuild/bazel-gazelle/issues/1528.
+	date := "1970-01-01 00:00:00.000000001 +0000"
+
+	diff := difflib.UnifiedDiff{
+		Context:  3,
+		FromDate: date,
+		ToDate:   date,
+	}
+
+	newContent := f.Format()
+	if bytes.Equal(newContent, f.Content) {
+		// No change.
+		return rel, nil, nil
+	}
+
+	if _, err := os.Stat(f.Path); os.IsNotExist(err) {
+		diff.FromFile = "/dev/null"
+	} else if err != nil {
+		return "", nil, fmt.Errorf("error reading original file: %v", err)
+	} else if c.ReadBuildFilesDir == "" {
+		diff.FromFile = rel
+	} else {
+		diff.FromFile = f.Path
+	}
+
+	if len(f.Content) != 0 {
+		diff.A = difflib.SplitLines(string(f.Content))
+	}
+
+	diff.B = difflib.SplitLines(string(newContent))
+	outPath := findOutputPath(c, f)
+	if c.WriteBuildFilesDir == "" {
+		diff.ToFile = rel
+	} else {
+		diff.ToFile = outPath
+	}
+	// Trim off trailing newline from the end of the file.  Modern diff tools typically
+	// handle this, however difflib does not and is no longer maintained, so we need to
+	// handle it here.
+	if len(diff.A) > 0 {
+		if diff.A[len(diff.A)-1] == "\n" {diff.A = diff.A[:len(diff.A)-1]}
+	}
+	if len(diff.B) > 0 {
+		if diff.B[len(diff.B)-1] == "\n" {diff.B = diff.B[:len(diff.B)-1]}
+	}
+
+	var buf bytes.Buffer
+	if err := difflib.WriteUnifiedDiff(&buf, diff); err != nil {
+		return "", nil, fmt.Errorf("error diffing %s: %v", f.Path, err)
+	}
+	return rel, buf.Bytes(), nil
+}
+
+// fileDiff is the unified diff of one build file, recorded by diffFile.
+type fileDiff struct {
+	path string
+	diff []byte
+}
+
+// writePatch writes the diffs recorded by diffFile as a single patch, sorted
+// by path. The patch is written to the file named by -patch_file if set,
+// or to stdout otherwise. The file is replaced atomically, so a reader never
+// sees a partial patch.
+func writePatch(uc *updateConfig) error {
+	sort.SliceStable(uc.diffs, func(i, j int) bool { return uc.diffs[i].path < uc.diffs[j].path })
+	var patch bytes.Buffer
+	for _, d := range uc.diffs {
+		patch.Write(d.diff)
+	}
+
+	if uc.patchPath == "" {
+		_, err := os.Stdout.Write(patch.Bytes())
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(uc.patchPath), "."+filepath.Base(uc.patchPath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(patch.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	// CreateTemp makes the file readable only by its owner.
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), uc.patchPath)
+}
@@ -0,0 +1,268 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// Explain runs the explain command. It updates the repository like the update
+// command, then prints why each value is in the attribute named by the second
+// argument in cfg.Args, of the rule named by the first, to w. If there's no
+// second argument, every attribute is explained. No files are written.
+//
+// cfg.Command is ignored. Flags of the update command may be used, except
+// for flags that write files.
+func Explain(ctx context.Context, cfg Config, langs []language.Language, w io.Writer) error {
+	cfg.Command = "update"
+	_, err := run(ctx, cfg, langs, make(map[string]*rule.File), &explainQuery{out: w})
+	return err
+}
+
+// explainQuery holds the arguments of the explain command.
+type explainQuery struct {
+	// target is the absolute label of the rule to explain.
+	target label.Label
+
+	// attr is the attribute to explain. If empty, all attributes are
+	// explained.
+	attr string
+
+	out io.Writer
+}
+
+func (q *explainQuery) registerFlags(fs *flag.FlagSet) {}
+
+func (q *explainQuery) setArgs(c *config.Config, args []string) ([]string, error) {
+	if name := fileWritingFlag(getUpdateConfig(c)); name != "" {
+		return nil, fmt.Errorf("explain: %s can't be used, since no files are written", name)
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("explain: got %d arguments; want a label and, optionally, an attribute name", len(args))
+	}
+	l, err := label.Parse(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("explain: %v", err)
+	}
+	if l.Repo != "" && l.Repo != "@" && l.Repo != c.RepoName {
+		return nil, fmt.Errorf("explain: %s is not in the main repository", args[0])
+	}
+	if l.Relative {
+		rel, err := filepath.Rel(c.RepoRoot, c.WorkDir)
+		if err != nil {
+			return nil, err
+		}
+		if rel == "." {
+			rel = ""
+		}
+		l = l.Abs("", filepath.ToSlash(rel))
+	}
+	q.target = normalizeLabel(c.RepoName, l)
+	if len(args) == 2 {
+		q.attr = args[1]
+	}
+	c.RecordProvenance = true
+	dir := filepath.Join(c.RepoRoot, filepath.FromSlash(q.target.Pkg))
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return nil, fmt.Errorf("explain: package %q doesn't exist", q.target.Pkg)
+	}
+	// The whole repository is updated, so dependencies on packages without
+	// build files are resolved as they would be by the update command.
+	return []string{c.RepoRoot}, nil
+}
+
+func (q *explainQuery) usage(fs *flag.FlagSet) {
+	explainUsage(fs)
+}
+
+// answer prints why each value is in the explained attributes of the target
+// after its build file is updated. Reasons recorded by languages with
+// rule.Rule.AddProvenance are printed for values in the generated rule.
+// Other values are explained by # keep comments, or by attributes Gazelle
+// doesn't manage.
+func (q *explainQuery) answer(c *config.Config, langs []language.Language, _ *resolve.RuleIndex, _ *repo.RemoteCache, visits []visitRecord, _ []*rule.File) error {
+	var visit *visitRecord
+	for i := range visits {
+		if visits[i].pkgRel == q.target.Pkg {
+			visit = &visits[i]
+			break
+		}
+	}
+	if visit == nil {
+		return fmt.Errorf("explain: no build file for package %q", q.target.Pkg)
+	}
+	// Format the file, so values are sorted as they would be written.
+	visit.file.Format()
+	var r, gen *rule.Rule
+	for _, fr := range visit.file.Rules {
+		if fr.Name() == q.target.Name {
+			r = fr
+			break
+		}
+	}
+	if r == nil {
+		return fmt.Errorf("explain: %s: no rule named %q", visit.file.Path, q.target.Name)
+	}
+	for _, gr := range visit.rules {
+		if gr.Name() == r.Name() {
+			gen = gr
+			break
+		}
+	}
+
+	kindLangs := make(map[string]string)
+	kinds := make(map[string]rule.KindInfo)
+	for _, lang := range langs {
+		for kind, info := range lang.Kinds() {
+			if _, ok := kinds[kind]; !ok {
+				kinds[kind] = info
+				kindLangs[kind] = lang.Name()
+			}
+		}
+	}
+	for kind, info := range visit.mappedKindInfo {
+		kinds[kind] = info
+	}
+
+	attrs := r.AttrKeys()
+	if q.attr != "" {
+		if r.Attr(q.attr) == nil {
+			return fmt.Errorf("explain: %s has no attribute %q", q.target, q.attr)
+		}
+		attrs = []string{q.attr}
+	}
+	fmt.Fprintf(q.out, "%s (%s)\n", q.target, r.Kind())
+	if r.ShouldKeep() {
+		fmt.Fprintln(q.out, "  the rule is marked # keep, so Gazelle doesn't change it")
+	}
+	for _, attr := range attrs {
+		if attr == "name" {
+			continue
+		}
+		fmt.Fprintf(q.out, "%s:\n", attr)
+		for _, v := range explainValues(r.Attr(attr)) {
+			for _, reason := range q.reasons(r, gen, attr, v, kinds, kindLangs) {
+				fmt.Fprintf(q.out, "  %s: %s\n", v.text, reason)
+			}
+		}
+	}
+	return nil
+}
+
+// reasons returns why the value v is in the attribute attr of r. gen is the
+// rule generated for r, or nil if no rule was generated.
+func (q *explainQuery) reasons(r, gen *rule.Rule, attr string, v explainValue, kinds map[string]rule.KindInfo, kindLangs map[string]string) []string {
+	var reasons []string
+	if v.keep {
+		reasons = append(reasons, "marked # keep")
+	}
+	if gen != nil {
+		reasons = append(reasons, gen.Provenance(attr, v.key)...)
+		if len(reasons) == 0 && v.generatedBy(gen.Attr(attr)) {
+			if lang := kindLangs[gen.Kind()]; lang != "" {
+				reasons = append(reasons, fmt.Sprintf("generated by the %s extension", lang))
+			} else {
+				reasons = append(reasons, "generated by Gazelle")
+			}
+		}
+	}
+	if len(reasons) > 0 {
+		return reasons
+	}
+	switch info := kinds[r.Kind()]; {
+	case r.ShouldKeep():
+		return []string{"kept from the existing build file"}
+	case !info.MergeableAttrs[attr] && !info.ResolveAttrs[attr]:
+		return []string{fmt.Sprintf("attribute isn't managed by Gazelle for %s, so the value in the build file is kept", r.Kind())}
+	default:
+		return []string{"not generated; kept from the existing build file"}
+	}
+}
+
+// explainValue is a value in an attribute explained by the explain command.
+type explainValue struct {
+	// text is the value as printed, and key is the value provenance is
+	// recorded for. For strings, text is quoted and key is unquoted. Other
+	// values are printed and recorded as formatted expressions.
+	text, key string
+
+	keep bool
+}
+
+// explainValues returns the strings in the expression e, including those in
+// lists, dicts and select expressions. If there are none, e is returned as a
+// single value.
+func explainValues(e bzl.Expr) []explainValue {
+	var values []explainValue
+	bzl.Walk(e, func(x bzl.Expr, _ []bzl.Expr) {
+		s, ok := x.(*bzl.StringExpr)
+		if !ok {
+			return
+		}
+		values = append(values, explainValue{text: fmt.Sprintf("%q", s.Value), key: s.Value, keep: rule.ShouldKeep(s)})
+	})
+	if len(values) == 0 {
+		text := bzl.FormatString(e)
+		values = append(values, explainValue{text: text, key: text, keep: rule.ShouldKeep(e)})
+	}
+	return values
+}
+
+// generatedBy returns whether v is in the generated attribute value e.
+func (v explainValue) generatedBy(e bzl.Expr) bool {
+	if e == nil {
+		return false
+	}
+	for _, gv := range explainValues(e) {
+		if gv.key == v.key {
+			return true
+		}
+	}
+	return false
+}
+
+func explainUsage(fs *flag.FlagSet) {
+	fmt.Fprint(os.Stderr, `usage: gazelle explain [flags...] label [attribute]
+
+The explain command updates the repository like the update command, then
+prints why each value is in an attribute of the rule named by label after
+it's updated, or in every attribute if none is named. For example, a dependency is
+explained by the import it was resolved from, the files containing the
+import, and whether it was resolved with a # gazelle:resolve directive, the
+index of rules in the repository, or an external repository. Values may also
+be explained by # keep comments, or by attributes Gazelle doesn't manage.
+
+No build files are written. Flags of the update command that write files,
+like -patch_file and -report, can't be used.
+
+FLAGS:
+
+`)
+	fs.PrintDefaults()
+}
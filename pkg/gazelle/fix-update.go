@@ -0,0 +1,1529 @@
+/* Copyright 2017 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bazelbuild/buildtools/build"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	gzflag "github.com/bazelbuild/bazel-gazelle/flag"
+	"github.com/bazelbuild/bazel-gazelle/internal/wspace"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/merger"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/bazelbuild/bazel-gazelle/walk"
+)
+
+// updateConfig holds configuration information needed to run the fix and
+// update commands. This includes everything in config.Config, but it also
+// includes some additional fields that aren't relevant to other packages.
+type updateConfig struct {
+	dirs           []string
+	emit           emitFunc
+	repos          []repo.Repo
+	rootOverrides  []repo.RootOverride
+	workspaceFiles []*rule.File
+	walkMode       walk.Mode
+	patchPath      string
+	diffs          []fileDiff
+	print0         bool
+	profile        profiler
+
+	// timings is set by -timings. When non-nil, wall time spent in each
+	// phase and in each directory is recorded and reported at the end.
+	timings *timings
+
+	// buildozerScriptPath is set by -emit_buildozer_script. When set,
+	// buildozer commands equivalent to map_kind changes of existing rules are
+	// collected in buildozerScript and written to this file.
+	buildozerScriptPath string
+	buildozerScript     bytes.Buffer
+
+	// pruneUnknownAttrs is set by -prune_unknown_attrs. When true, attributes
+	// not listed in a rule's KindInfo.KnownAttrs are deleted.
+	pruneUnknownAttrs bool
+
+	// preserveFormatting is set by -preserve_formatting. When true, statements
+	// in existing build files that weren't changed are written as they were,
+	// and only changed statements are formatted.
+	preserveFormatting bool
+
+	// stamp is set by -stamp. When true, a "# gazelle:stamp" comment with a
+	// hash of each updated build file and its sources is written at the top
+	// of the file.
+	stamp bool
+
+	// reportDuplicateImports is set by -report_duplicate_imports. When true,
+	// imports provided by rules of the same kind in more than one package
+	// are logged while building the index.
+	reportDuplicateImports bool
+
+	// ruleTemplates holds template files read for
+	// # gazelle:new_rule_template during this run.
+	ruleTemplates ruleTemplateCache
+
+	// restrictToArgs is set by -restrict_to_args. When true, the command fails
+	// without writing anything if a build file outside the directories named
+	// on the command line would change.
+	restrictToArgs bool
+
+	// maxFileChanges is set by -max_file_changes. When positive, the command
+	// fails without writing anything if more build files would change,
+	// unless force is set by -force.
+	maxFileChanges int
+	force          bool
+
+	// resolveJobs is set by -resolve_jobs. It's the maximum number of
+	// directories whose dependencies are resolved concurrently. If it's not
+	// positive, GOMAXPROCS is used.
+	resolveJobs int
+
+	// keepGoing is set by -keep_going. When true, a panic in a language
+	// extension is logged, and directories where it didn't happen are still
+	// updated.
+	keepGoing bool
+
+	// commitMessage and commitPerDir are set by -commit_message and
+	// -commit_per_dir. With -mode=git-commit, the paths of changed build
+	// files are collected in commitFiles and committed after they're
+	// written.
+	commitMessage string
+	commitPerDir  bool
+	commitFiles   []string
+
+	// reportPath is set by -report. When set, the rules created, updated,
+	// and deleted in each directory, messages logged by resolvers, and the
+	// directives in each build file are collected in report and written to
+	// this file.
+	reportPath string
+	report     *changeReport
+
+	// indexOutPath is set by -index_out. When set, the importable rules in
+	// the index are written to this file after indexing.
+	indexOutPath string
+
+	// managedFilesOutPath is set by -managed_files_out. When set, the paths
+	// of build files in directories Gazelle updates are written to this file
+	// after the run.
+	managedFilesOutPath string
+
+	// indexIn lists the index files of other repositories set with
+	// -index_in. Their rules are added to the index, so dependencies on them
+	// can be resolved without indexing their build files.
+	indexIn []indexInput
+
+	// interactive is set by -interactive. When true, the diff of each
+	// changed build file is shown, and the user is asked whether to apply it.
+	interactive bool
+
+	// changedPkgs is set by -changed_files. It contains the directories with
+	// changed files, which are updated instead of directories named on the
+	// command line. Directories with rules that depend on these packages are
+	// updated, too.
+	changedPkgs map[string]bool
+}
+
+// indexInput is an index file named with -index_in.
+type indexInput struct {
+	// repo is the name of the repository the file describes, or "" to use
+	// the name recorded in the file.
+	repo, path string
+}
+
+type emitFunc = language.EmitFunc
+
+var modeFromName = map[string]emitFunc{
+	"print":     printFile,
+	"fix":       fixFile,
+	"diff":      diffFile,
+	"buildozer": buildozerFile,
+
+	gitCommitMode: gitCommitFile,
+}
+
+// emitModes returns the built-in emit modes together with the modes
+// provided by languages that implement language.EmitModeProvider.
+func emitModes(langs []language.Language) (map[string]emitFunc, error) {
+	modes := make(map[string]emitFunc, len(modeFromName))
+	for name, emit := range modeFromName {
+		modes[name] = emit
+	}
+	provider := make(map[string]string)
+	for _, lang := range langs {
+		p, ok := lang.(language.EmitModeProvider)
+		if !ok {
+			continue
+		}
+		for name, emit := range p.EmitModes() {
+			if _, ok := modes[name]; ok {
+				if other, ok := provider[name]; ok {
+					return nil, fmt.Errorf("emit mode %q is provided by both %s and %s", name, other, lang.Name())
+				}
+				return nil, fmt.Errorf("%s: emit mode %q conflicts with a built-in mode", lang.Name(), name)
+			}
+			modes[name] = emit
+			provider[name] = lang.Name()
+		}
+	}
+	return modes, nil
+}
+
+const updateName = "_update"
+
+func getUpdateConfig(c *config.Config) *updateConfig {
+	return c.Exts[updateName].(*updateConfig)
+}
+
+var _ config.Configurer = (*updateConfigurer)(nil)
+
+type updateConfigurer struct {
+	mode           string
+	recursive      bool
+	knownImports   []string
+	repoConfigPath string
+	cpuProfile     string
+	memProfile     string
+	timings        bool
+	timingsDirs    int
+	changedFiles   string
+
+	repoRootOverrides     []string
+	repoRootOverridesFile string
+	indexIn               []string
+
+	// langs are the languages whose emit modes may be selected with -mode.
+	langs []language.Language
+
+	// q is set when running a query command, like list-deps. Its arguments
+	// are taken from the command line instead of directories.
+	q query
+}
+
+func (ucr *updateConfigurer) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config) {
+	uc := &updateConfig{ruleTemplates: make(ruleTemplateCache)}
+	c.Exts[updateName] = uc
+
+	c.ShouldFix = cmd == "fix"
+
+	fs.StringVar(&ucr.mode, "mode", "fix", "print: prints all of the updated BUILD files\n\tfix: rewrites all of the BUILD files in place\n\tdiff: computes the rewrite but then just does a diff\n\tgit-commit: rewrites the BUILD files in place and commits the changed files with git\n\tbuildozer: prints buildozer commands equivalent to the changes\n\tlanguage extensions may provide other modes")
+	fs.BoolVar(&ucr.recursive, "r", true, "when true, gazelle will update subdirectories recursively")
+	fs.Var(&gzflag.PathFlag{Value: &uc.patchPath}, "patch_file", "when set with -mode=diff, gazelle will write a single patch with all changes to this file instead of stdout")
+	fs.Var(&gzflag.PathFlag{Value: &uc.patchPath}, "patch", "deprecated alias for -patch_file")
+	fs.Var(&gzflag.PathFlag{Value: &uc.buildozerScriptPath}, "emit_buildozer_script", "when set, gazelle will write buildozer commands equivalent to map_kind changes of existing rules to this file")
+	fs.StringVar(&uc.commitMessage, "commit_message", "", "when set with -mode=git-commit, the message of the commit with the changed BUILD files")
+	fs.BoolVar(&uc.commitPerDir, "commit_per_dir", false, "when set with -mode=git-commit, gazelle will make a separate commit for each top-level directory")
+	fs.BoolVar(&uc.print0, "print0", false, "when set with -mode=fix, gazelle will print the names of rewritten files separated with \\0 (NULL)")
+	fs.BoolVar(&uc.interactive, "interactive", false, "when true, gazelle will show the diff of each changed build file and ask whether to apply it")
+	fs.BoolVar(&uc.restrictToArgs, "restrict_to_args", false, "when true, gazelle will fail without writing anything if a build file outside the directories named on the command line would change")
+	fs.IntVar(&uc.maxFileChanges, "max_file_changes", 0, "when positive, gazelle will fail without writing anything if more than this many build files would change, unless -force is set")
+	fs.BoolVar(&uc.force, "force", false, "when true, gazelle will write changed build files even if there are more than -max_file_changes")
+	fs.IntVar(&uc.resolveJobs, "resolve_jobs", 0, "maximum number of directories whose dependencies are resolved concurrently. If 0, the number of CPUs is used. Directories are resolved one at a time unless every enabled language supports concurrent resolution.")
+	fs.BoolVar(&uc.keepGoing, "keep_going", false, "when true, gazelle logs panics in language extensions and updates the directories where they didn't happen, instead of stopping")
+	fs.StringVar(&ucr.changedFiles, "changed_files", "", "comma-separated list of files changed since the last update, relative to the repository root, or @file to read them from a file, one per line. When set, gazelle updates only directories with changed files and directories with rules that depend on them")
+	fs.Var(&gzflag.PathFlag{Value: &uc.indexOutPath}, "index_out", "when set, gazelle will write the importable rules in the index to this file, so other repositories can load it with -index_in")
+	fs.Var(&gzflag.PathFlag{Value: &uc.managedFilesOutPath}, "managed_files_out", "when set, gazelle will write the paths of the build files it manages in the updated directories to this file, one per line")
+	fs.Var(&gzflag.MultiFlag{Values: &ucr.indexIn}, "index_in", "index file written by -index_out in another repository, optionally prefixed with the repository's name and =, like other_repo=index.json. Rules in the file are used to resolve dependencies (can specify multiple times)")
+	fs.Var(&gzflag.PathFlag{Value: &uc.reportPath}, "report", "when set, gazelle will write a summary of the rules created, updated, and deleted, unresolved imports, and directives written in each directory's build file to this file, formatted as HTML if the file name ends with .html and as Markdown otherwise")
+	fs.BoolVar(&uc.preserveFormatting, "preserve_formatting", false, "when true, gazelle will only format the rules and loads it changes in existing build files, leaving other statements as they were")
+	fs.BoolVar(&uc.reportDuplicateImports, "report_duplicate_imports", false, "when true, gazelle will log imports provided by rules of the same kind in more than one package")
+	fs.BoolVar(&uc.stamp, "stamp", false, "when true, gazelle will write a comment with a hash of each updated build file and its sources at the top of the file, after any leading comment block")
+	fs.Var(&gzflag.PathFlag{Value: &ucr.cpuProfile}, "cpuprofile", "write cpu profile to `file`")
+	fs.Var(&gzflag.PathFlag{Value: &ucr.memProfile}, "memprofile", "write memory profile to `file`")
+	fs.BoolVar(&ucr.timings, "timings", false, "when true, gazelle will report wall time spent in each phase and in the slowest directories")
+	fs.IntVar(&ucr.timingsDirs, "timings_dirs", 10, "number of slowest directories reported by -timings")
+	fs.Var(&gzflag.MultiFlag{Values: &ucr.knownImports}, "known_import", "import path for which external resolution is skipped (can specify multiple times)")
+	fs.Var(&gzflag.PathFlag{Value: &ucr.repoConfigPath}, "repo_config", "file where Gazelle should load repository configuration. Defaults to WORKSPACE.")
+	fs.Var(&gzflag.MultiFlag{Values: &ucr.repoRootOverrides}, "repo_root_override", "repository root for import paths with a prefix, written as prefix=vcs remote, for example, example.corp=git https://git.example.corp/... (can specify multiple times)")
+	fs.Var(&gzflag.PathFlag{Value: &ucr.repoRootOverridesFile}, "repo_root_overrides_file", "file with one -repo_root_override value per line")
+	if ucr.q != nil {
+		ucr.q.registerFlags(fs)
+	}
+	if cmd == "fix" {
+		fs.BoolVar(&uc.pruneUnknownAttrs, "prune_unknown_attrs", false, "when true, gazelle will delete attributes that are not supported by a rule's kind")
+	}
+}
+
+func (ucr *updateConfigurer) CheckFlags(fs *flag.FlagSet, c *config.Config) error {
+	uc := getUpdateConfig(c)
+
+	modes, err := emitModes(ucr.langs)
+	if err != nil {
+		return err
+	}
+	var ok bool
+	uc.emit, ok = modes[ucr.mode]
+	if !ok {
+		return fmt.Errorf("unrecognized emit mode: %q", ucr.mode)
+	}
+	if uc.maxFileChanges < 0 {
+		return fmt.Errorf("-max_file_changes must not be negative, got %d", uc.maxFileChanges)
+	}
+	if uc.patchPath != "" && ucr.mode != "diff" {
+		return fmt.Errorf("-patch_file set but -mode is %s, not diff", ucr.mode)
+	}
+	if ucr.mode == gitCommitMode && uc.commitMessage == "" {
+		return fmt.Errorf("-mode=%s requires -commit_message", gitCommitMode)
+	}
+	if ucr.mode != gitCommitMode && (uc.commitMessage != "" || uc.commitPerDir) {
+		return fmt.Errorf("-commit_message and -commit_per_dir require -mode=%s", gitCommitMode)
+	}
+	if uc.interactive {
+		if ucr.mode != "fix" && ucr.mode != gitCommitMode {
+			return fmt.Errorf("-interactive requires -mode=fix or -mode=%s", gitCommitMode)
+		}
+		uc.emit = newInteractiveReviewer(uc.emit, os.Stdin, os.Stdout).emitFile
+	}
+	if uc.patchPath != "" && !filepath.IsAbs(uc.patchPath) {
+		uc.patchPath = filepath.Join(c.WorkDir, uc.patchPath)
+	}
+	if uc.buildozerScriptPath != "" && !filepath.IsAbs(uc.buildozerScriptPath) {
+		uc.buildozerScriptPath = filepath.Join(c.WorkDir, uc.buildozerScriptPath)
+	}
+	if uc.reportPath != "" {
+		if !filepath.IsAbs(uc.reportPath) {
+			uc.reportPath = filepath.Join(c.WorkDir, uc.reportPath)
+		}
+		uc.report = newChangeReport()
+	}
+	if uc.indexOutPath != "" && !filepath.IsAbs(uc.indexOutPath) {
+		uc.indexOutPath = filepath.Join(c.WorkDir, uc.indexOutPath)
+	}
+	if uc.managedFilesOutPath != "" && !filepath.IsAbs(uc.managedFilesOutPath) {
+		uc.managedFilesOutPath = filepath.Join(c.WorkDir, uc.managedFilesOutPath)
+	}
+	for _, v := range ucr.indexIn {
+		in := indexInput{path: v}
+		if name, path, ok := strings.Cut(v, "="); ok && name != "" && !strings.ContainsAny(name, `/\`) {
+			in = indexInput{repo: strings.TrimPrefix(name, "@"), path: path}
+		}
+		if !filepath.IsAbs(in.path) {
+			in.path = filepath.Join(c.WorkDir, in.path)
+		}
+		uc.indexIn = append(uc.indexIn, in)
+	}
+	p, err := newProfiler(ucr.cpuProfile, ucr.memProfile)
+	if err != nil {
+		return err
+	}
+	uc.profile = p
+	if ucr.timings {
+		uc.timings = newTimings(ucr.timingsDirs)
+	}
+
+	dirs := fs.Args()
+	if ucr.q != nil {
+		if dirs, err = ucr.q.setArgs(c, dirs); err != nil {
+			return err
+		}
+	}
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+	uc.dirs = make([]string, len(dirs))
+	for i, arg := range dirs {
+		dir := arg
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(c.WorkDir, dir)
+		}
+		dir, err = resolveDirArg(dir, c.RepoRoot)
+		if err != nil {
+			return fmt.Errorf("%s: failed to resolve symlinks: %v", arg, err)
+		}
+		if !isDescendingDir(dir, c.RepoRoot) {
+			return fmt.Errorf("%s: not a subdirectory of repo root %s", arg, c.RepoRoot)
+		}
+		uc.dirs[i] = dir
+	}
+
+	if ucr.recursive && c.IndexLibraries {
+		uc.walkMode = walk.VisitAllUpdateSubdirsMode
+	} else if c.IndexLibraries {
+		uc.walkMode = walk.VisitAllUpdateDirsMode
+	} else if ucr.recursive {
+		uc.walkMode = walk.UpdateSubdirsMode
+	} else {
+		uc.walkMode = walk.UpdateDirsMode
+	}
+
+	if ucr.changedFiles != "" {
+		if len(fs.Args()) > 0 {
+			return fmt.Errorf("-changed_files can't be used with directory arguments")
+		}
+		files, err := readChangedFiles(c.WorkDir, ucr.changedFiles)
+		if err != nil {
+			return err
+		}
+		rels, err := changedDirs(c.RepoRoot, files)
+		if err != nil {
+			return err
+		}
+		uc.changedPkgs = make(map[string]bool)
+		uc.dirs = make([]string, len(rels))
+		for i, rel := range rels {
+			uc.changedPkgs[rel] = true
+			uc.dirs[i] = filepath.Join(c.RepoRoot, filepath.FromSlash(rel))
+		}
+		// Only the changed directories are updated, not their subdirectories.
+		// Dependents are found while indexing, so every directory is visited
+		// when the index is enabled.
+		if c.IndexLibraries {
+			uc.walkMode = walk.VisitAllUpdateDirsMode
+		} else {
+			uc.walkMode = walk.UpdateDirsMode
+		}
+	}
+
+	// Load the repo configuration file (WORKSPACE by default) to find out
+	// names and prefixes of other go_repositories. This affects external
+	// dependency resolution for Go.
+	// TODO(jayconrod): Go-specific code should be moved to language/go.
+	if ucr.repoConfigPath == "" {
+		ucr.repoConfigPath = wspace.FindWORKSPACEFile(c.RepoRoot)
+	}
+	repoConfigFile, err := rule.LoadWorkspaceFile(ucr.repoConfigPath, "")
+	if err != nil && !os.IsNotExist(err) && !isDirErr(err) {
+		return err
+	} else if err == nil {
+		c.Repos, _, err = repo.ListRepositories(repoConfigFile)
+		if err != nil {
+			return err
+		}
+	}
+	if ucr.repoRootOverridesFile != "" && !filepath.IsAbs(ucr.repoRootOverridesFile) {
+		ucr.repoRootOverridesFile = filepath.Join(c.WorkDir, ucr.repoRootOverridesFile)
+	}
+	uc.rootOverrides, err = repo.LoadRootOverrides(ucr.repoRootOverridesFile, ucr.repoRootOverrides)
+	if err != nil {
+		return err
+	}
+	for _, imp := range ucr.knownImports {
+		uc.repos = append(uc.repos, repo.Repo{
+			Name:     label.ImportPathToBazelRepoName(imp),
+			GoPrefix: imp,
+		})
+	}
+
+	for _, r := range c.Repos {
+		if r.Kind() == "go_repository" {
+			var name string
+			if apparentName := c.ModuleToApparentName(r.AttrString("module_name")); apparentName != "" {
+				name = apparentName
+			} else {
+				name = r.Name()
+			}
+			uc.repos = append(uc.repos, repo.Repo{
+				Name:     name,
+				GoPrefix: r.AttrString("importpath"),
+			})
+		}
+	}
+
+	// If the repo configuration file is not WORKSPACE, also load WORKSPACE
+	// and any declared macro files so we can apply fixes.
+	workspacePath := wspace.FindWORKSPACEFile(c.RepoRoot)
+	var workspace *rule.File
+	if ucr.repoConfigPath == workspacePath {
+		workspace = repoConfigFile
+	} else {
+		workspace, err = rule.LoadWorkspaceFile(workspacePath, "")
+		if err != nil && !os.IsNotExist(err) && !isDirErr(err) {
+			return err
+		}
+	}
+	if workspace != nil {
+		c.RepoName = findWorkspaceName(workspace)
+		_, repoFileMap, err := repo.ListRepositories(workspace)
+		if err != nil {
+			return err
+		}
+		seen := make(map[*rule.File]bool)
+		for _, f := range repoFileMap {
+			if !seen[f] {
+				uc.workspaceFiles = append(uc.workspaceFiles, f)
+				seen[f] = true
+			}
+		}
+		sort.Slice(uc.workspaceFiles, func(i, j int) bool {
+			return uc.workspaceFiles[i].Path < uc.workspaceFiles[j].Path
+		})
+	}
+
+	return nil
+}
+
+func (ucr *updateConfigurer) KnownDirectives() []string { return []string{stampDirective} }
+
+func (ucr *updateConfigurer) Configure(c *config.Config, rel string, f *rule.File) {}
+
+// visitRecord stores information about a directory visited with
+// packages.Walk.
+type visitRecord struct {
+	// pkgRel is the slash-separated path to the visited directory, relative to
+	// the repository root. "" for the repository root itself.
+	pkgRel string
+
+	// dir is the absolute path to the visited directory, and regularFiles
+	// lists the base names of regular files within it.
+	dir          string
+	regularFiles []string
+
+	// c is the configuration for the directory with directives applied.
+	c *config.Config
+
+	// rules is a list of generated Go rules.
+	rules []*rule.Rule
+
+	// imports contains opaque import information for each rule in rules.
+	imports []interface{}
+
+	// empty is a list of empty Go rules that may be deleted.
+	empty []*rule.Rule
+
+	// file is the build file being processed. newFile is true if the
+	// directory had no build file before the run.
+	file    *rule.File
+	newFile bool
+
+	// oldRuleNames lists the names of the rules in file before it was fixed
+	// and merged.
+	oldRuleNames []string
+
+	// mappedKinds are mapped kinds used during this visit.
+	mappedKinds    []config.MappedKind
+	mappedKindInfo map[string]rule.KindInfo
+}
+
+var genericLoads = []rule.LoadInfo{
+	{
+		Name:    "@bazel_gazelle//:def.bzl",
+		Symbols: []string{"gazelle"},
+	},
+}
+
+func runFixUpdate(ctx context.Context, wd, cmd string, args []string, langs []language.Language, files map[string]*rule.File, q query, result *Result) (err error) {
+	cexts := make([]config.Configurer, 0, len(langs)+4)
+	cexts = append(cexts,
+		&config.CommonConfigurer{},
+		&updateConfigurer{langs: langs, q: q},
+		&walk.Configurer{},
+		&resolve.Configurer{})
+
+	// Language extensions are called through sandbox, so a panic in one is
+	// reported with the language and directory it happened in.
+	sandbox := newExtensionSandbox()
+	for _, lang := range langs {
+		cexts = append(cexts, &sandboxedConfigurer{Configurer: lang, name: lang.Name(), s: sandbox})
+	}
+
+	usage := fixUpdateUsage
+	if q != nil {
+		usage = q.usage
+	}
+	c, err := newFixUpdateConfiguration(wd, cmd, args, cexts, usage)
+	if err != nil {
+		return err
+	}
+	sandbox.keepGoing = getUpdateConfig(c).keepGoing
+	if files != nil {
+		if err := collectFiles(c, files); err != nil {
+			return err
+		}
+	}
+
+	mrslv := newMetaResolver()
+	kinds := make(map[string]rule.KindInfo)
+	loads := genericLoads
+	exts := make([]interface{}, 0, len(langs))
+	for _, lang := range langs {
+		for kind, info := range lang.Kinds() {
+			mrslv.AddBuiltin(kind, lang)
+			kinds[kind] = info
+		}
+		if moduleAwareLang, ok := lang.(language.ModuleAwareLanguage); ok {
+			loads = append(loads, moduleAwareLang.ApparentLoads(c.ModuleToApparentName)...)
+		} else {
+			loads = append(loads, lang.Loads()...)
+		}
+		exts = append(exts, lang)
+	}
+	ruleIndex := resolve.NewRuleIndex(mrslv.Resolver, exts...)
+	ruleIndex.ReportDuplicates = getUpdateConfig(c).reportDuplicateImports
+	indexRule := func(c *config.Config, r *rule.Rule, f *rule.File) {
+		rslv := mrslv.Resolver(r, f.Pkg)
+		if rslv == nil {
+			ruleIndex.AddRule(c, r, f)
+			return
+		}
+		sandbox.callDir(rslv.Name(), "Imports", f.Pkg, func() { ruleIndex.AddRule(c, r, f) })
+	}
+
+	if err = fixRepoFiles(c, loads); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for _, lang := range langs {
+		if life, ok := lang.(language.LifecycleManager); ok {
+			sandbox.call(lang.Name(), "Before", func() { life.Before(ctx) })
+		}
+	}
+
+	// Visit all directories in the repository. indexedFiles holds build
+	// files that were indexed but aren't being updated.
+	var visits []visitRecord
+	var indexedFiles []*rule.File
+	uc := getUpdateConfig(c)
+	defer func() {
+		if err := uc.profile.stop(); err != nil {
+			log.Printf("stopping profiler: %v", err)
+		}
+	}()
+	tm := uc.timings
+	defer tm.report(os.Stderr)
+
+	var errorsFromWalk []error
+	walkStart := time.Now()
+	walk.Walk(c, cexts, uc.dirs, uc.walkMode, func(dir, rel string, c *config.Config, update bool, f *rule.File, subdirs, regularFiles, genFiles []string) {
+		if sandbox.stopped() {
+			return
+		}
+		dirStart := time.Now()
+		defer tm.addDir(rel, dirStart)
+
+		// With -changed_files, directories with rules that depend on changed
+		// packages are updated, so their dependencies are resolved again.
+		if !update && uc.changedPkgs != nil && f != nil && !hasIgnoreDirective(f) && dependsOnPackages(f, c.RepoName, uc.changedPkgs) {
+			update = true
+		}
+
+		// If this file is ignored or if Gazelle was not asked to update this
+		// directory, just index the build file and move on. This is also done
+		// for directories where a language extension panicked.
+		indexOnly := func() {
+			for _, repl := range c.KindMap {
+				mrslv.MappedKind(rel, repl)
+			}
+			if c.IndexLibraries && f != nil {
+				for _, r := range f.Rules {
+					indexRule(c, r, f)
+				}
+				indexedFiles = append(indexedFiles, f)
+			}
+			tm.add("index", dirStart)
+		}
+		if !update || sandbox.skipDir(rel) {
+			indexOnly()
+			return
+		}
+
+		// Remember the names of existing rules, so references to rules that
+		// are renamed or deleted can be found later.
+		var oldRuleNames []string
+		if f != nil {
+			for _, r := range f.Rules {
+				oldRuleNames = append(oldRuleNames, r.Name())
+			}
+		}
+
+		// Fix any problems in the file.
+		if f != nil {
+			fixLangs := FilterLanguages(c, langs)
+			for _, l := range fixLangs {
+				sandbox.callDir(l.Name(), "Fix", rel, func() {
+					l.Fix(c, f)
+					language.ApplyFileFixes(c, f, []language.Language{l})
+				})
+			}
+			if sandbox.skipDir(rel) {
+				indexOnly()
+				return
+			}
+			if uc.pruneUnknownAttrs {
+				pruneUnknownAttrs(f, kinds)
+			}
+		}
+		phaseStart := tm.add("fix", dirStart)
+
+		// Generate rules.
+		var empty, gen []*rule.Rule
+		var imports []interface{}
+		for _, l := range FilterLanguages(c, langs) {
+			var res language.GenerateResult
+			ok := sandbox.callDir(l.Name(), "GenerateRules", rel, func() {
+				res = l.GenerateRules(language.GenerateArgs{
+					Config:       c,
+					Dir:          dir,
+					Rel:          rel,
+					File:         f,
+					Subdirs:      subdirs,
+					RegularFiles: regularFiles,
+					GenFiles:     genFiles,
+					OtherEmpty:   empty,
+					OtherGen:     gen,
+				})
+				if len(res.Gen) != len(res.Imports) {
+					log.Panicf("%s: language %s generated %d rules but returned %d imports", rel, l.Name(), len(res.Gen), len(res.Imports))
+				}
+			})
+			if !ok {
+				indexOnly()
+				return
+			}
+			empty = append(empty, res.Empty...)
+			gen = append(gen, res.Gen...)
+			imports = append(imports, res.Imports...)
+		}
+		phaseStart = tm.add("generate", phaseStart)
+		if f == nil && len(gen) == 0 {
+			return
+		}
+
+		genKinds := make([]string, len(gen))
+		for i, r := range gen {
+			genKinds[i] = r.Kind()
+		}
+
+		// Apply and record relevant kind mappings.
+		var (
+			mappedKinds    []config.MappedKind
+			mappedKindInfo = make(map[string]rule.KindInfo)
+		)
+		// We apply map_kind to all rules, including pre-existing ones.
+		var allRules []*rule.Rule
+		allRules = append(allRules, gen...)
+		if f != nil {
+			allRules = append(allRules, f.Rules...)
+		}
+
+		maybeRecordReplacement := func(ruleKind string) (*config.MappedKind, error) {
+			var repl *config.MappedKind
+			repl, err = lookupMapKindReplacement(c.KindMap, ruleKind)
+			if err != nil {
+				return nil, err
+			}
+			if repl != nil {
+				mappedKindInfo[repl.KindName] = kinds[ruleKind]
+				mappedKinds = append(mappedKinds, *repl)
+				mrslv.MappedKind(rel, *repl)
+				return repl, nil
+			}
+			return nil, nil
+		}
+
+		// Record kind changes of existing rules, so they can be replayed with
+		// buildozer by consumers of the build files.
+		var bz *buildozerKindChanges
+		if uc.buildozerScriptPath != "" && f != nil {
+			bz = newBuildozerKindChanges(rel, f)
+		}
+
+		for _, r := range allRules {
+			if repl, err := maybeRecordReplacement(r.Kind()); err != nil {
+				errorsFromWalk = append(errorsFromWalk, fmt.Errorf("looking up mapped kind: %w", err))
+			} else if repl != nil {
+				if bz != nil && r.Kind() != repl.KindName {
+					bz.add(r, *repl)
+				}
+				r.SetKind(repl.KindName)
+			}
+
+			for i, arg := range r.Args() {
+				// Only check the first arg - this supports the maybe(java_library, ...) pattern,
+				// but avoids potential false positives from other uses of symbols.
+				if i != 0 {
+					break
+				}
+				if ident, ok := arg.(*build.Ident); ok {
+					// Don't allow re-mapping symbols that aren't known loads of a plugin.
+					if _, knownKind := kinds[ident.Name]; !knownKind {
+						continue
+					}
+					if repl, err := maybeRecordReplacement(ident.Name); err != nil {
+						errorsFromWalk = append(errorsFromWalk, fmt.Errorf("looking up mapped kind: %w", err))
+					} else if repl != nil {
+						if err := r.UpdateArg(i, &build.Ident{Name: repl.KindName}); err != nil {
+							log.Panicf("%s: %v", rel, err)
+						}
+					}
+				}
+			}
+		}
+		if bz != nil {
+			bz.writeTo(&uc.buildozerScript)
+		}
+		for _, r := range empty {
+			if repl, ok := c.KindMap[r.Kind()]; ok {
+				mappedKindInfo[repl.KindName] = kinds[r.Kind()]
+				mappedKinds = append(mappedKinds, repl)
+				mrslv.MappedKind(rel, repl)
+				r.SetKind(repl.KindName)
+			}
+		}
+
+		if err := applyNewRuleTemplates(c, uc.ruleTemplates, f, gen, genKinds, unionKindInfoMaps(kinds, mappedKindInfo)); err != nil {
+			errorsFromWalk = append(errorsFromWalk, err)
+		}
+
+		// Insert or merge rules into the build file.
+		newFile := f == nil
+		if f == nil {
+			f = rule.EmptyFile(filepath.Join(dir, c.DefaultBuildFileName()), rel)
+			// Rules with an explicit insert index (for example, package())
+			// go before other rules.
+			for _, r := range gen {
+				if index, ok := r.PrivateAttr(merger.UnstableInsertIndexKey).(int); ok {
+					r.InsertAt(f, index)
+				}
+			}
+			for _, r := range gen {
+				if _, ok := r.PrivateAttr(merger.UnstableInsertIndexKey).(int); !ok {
+					r.Insert(f)
+				}
+			}
+		} else {
+			merger.MergeFile(f, empty, gen, merger.PreResolve,
+				addMergeableAttrs(c, unionKindInfoMaps(kinds, mappedKindInfo), gen))
+		}
+		f.PreserveFormatting = uc.preserveFormatting
+		visits = append(visits, visitRecord{
+			pkgRel:         rel,
+			dir:            dir,
+			regularFiles:   regularFiles,
+			c:              c,
+			rules:          gen,
+			imports:        imports,
+			empty:          empty,
+			file:           f,
+			newFile:        newFile,
+			oldRuleNames:   oldRuleNames,
+			mappedKinds:    mappedKinds,
+			mappedKindInfo: mappedKindInfo,
+		})
+		phaseStart = tm.add("merge", phaseStart)
+
+		// Add library rules to the dependency resolution table.
+		if c.IndexLibraries {
+			for _, r := range f.Rules {
+				indexRule(c, r, f)
+			}
+		}
+		tm.add("index", phaseStart)
+	})
+	tm.addWalk(walkStart)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, lang := range langs {
+		if finishable, ok := lang.(language.FinishableLanguage); ok {
+			sandbox.call(lang.Name(), "DoneGeneratingRules", finishable.DoneGeneratingRules)
+		}
+	}
+
+	if sandbox.stopped() {
+		return sandbox.err()
+	}
+
+	if len(errorsFromWalk) == 1 {
+		return errorsFromWalk[0]
+	}
+
+	if len(errorsFromWalk) > 1 {
+		var additionalErrors []string
+		for _, err = range errorsFromWalk[1:] {
+			additionalErrors = append(additionalErrors, err.Error())
+		}
+
+		return fmt.Errorf("encountered multiple errors: %w, %v", errorsFromWalk[0], strings.Join(additionalErrors, ", "))
+	}
+
+	// Finish building the index for dependency resolution.
+	phaseStart := time.Now()
+	for _, in := range uc.indexIn {
+		if err := ruleIndex.LoadIndexFile(in.path, in.repo); err != nil {
+			return err
+		}
+	}
+	ruleIndex.Finish()
+	if uc.indexOutPath != "" {
+		if err := ruleIndex.WriteIndexFile(uc.indexOutPath, c.RepoName); err != nil {
+			return err
+		}
+	}
+	phaseStart = tm.add("index", phaseStart)
+
+	// Resolve dependencies.
+	rc, cleanupRc := repo.NewRemoteCache(uc.repos)
+	rc.RootOverrides = uc.rootOverrides
+	defer func() {
+		if cerr := cleanupRc(); err == nil && cerr != nil {
+			err = cerr
+		}
+	}()
+	if err = maybePopulateRemoteCacheFromGoMod(c, rc); err != nil {
+		log.Print(err)
+	}
+	// With -report, messages logged by resolvers are recorded for each
+	// directory. Built-in resolvers only log imports they couldn't resolve.
+	// Messages logged while merging aren't recorded.
+	var resolveLog *diagnosticWriter
+	if uc.report != nil {
+		resolveLog = newDiagnosticWriter()
+		out := log.Writer()
+		log.SetOutput(io.MultiWriter(out, resolveLog))
+		defer log.SetOutput(out)
+	}
+	resolveRules := func(v visitRecord, mergeKinds map[string]rule.KindInfo) {
+		for i, r := range v.rules {
+			if old, err := merger.Match(v.file.Rules, r, mergeKinds[r.Kind()]); err == nil && old != nil && !old.ShouldResolve() {
+				// Dependencies of rules marked with # gazelle:no_resolve are
+				// left alone when merging, so they aren't resolved.
+				continue
+			}
+			from := label.New(c.RepoName, v.pkgRel, r.Name())
+			if rslv := mrslv.Resolver(r, v.pkgRel); rslv != nil {
+				if resolveLog != nil {
+					resolveLog.take()
+				}
+				sandbox.callDir(rslv.Name(), "Resolve", v.pkgRel, func() {
+					rslv.Resolve(v.c, ruleIndex, rc, r, v.imports[i], from)
+				})
+				if resolveLog != nil {
+					uc.report.addUnresolved(v.pkgRel, resolveLog.take())
+				}
+			}
+		}
+	}
+	jobs := uc.resolveJobs
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+	if resolveLog != nil {
+		// Messages are attributed to the directory being resolved.
+		jobs = 1
+	}
+	for _, lang := range FilterLanguages(c, langs) {
+		// Resolvers may look up imports of other languages with
+		// CrossResolve, so directories are only resolved concurrently if
+		// every enabled language supports it.
+		if cr, ok := lang.(resolve.ConcurrentResolver); !ok || !cr.ResolveConcurrently() {
+			jobs = 1
+			break
+		}
+	}
+	if jobs == 1 {
+		for _, v := range visits {
+			mergeKinds := unionKindInfoMaps(kinds, v.mappedKindInfo)
+			resolveRules(v, mergeKinds)
+			phaseStart = tm.add("resolve", phaseStart)
+			merger.MergeFile(v.file, v.empty, v.rules, merger.PostResolve, mergeKinds)
+			phaseStart = tm.add("merge", phaseStart)
+		}
+	} else {
+		// Each directory is resolved and merged by one worker. With
+		// -timings, the time spent merging is attributed to resolve.
+		var eg errgroup.Group
+		eg.SetLimit(jobs)
+		for _, v := range visits {
+			v := v
+			eg.Go(func() error {
+				mergeKinds := unionKindInfoMaps(kinds, v.mappedKindInfo)
+				resolveRules(v, mergeKinds)
+				merger.MergeFile(v.file, v.empty, v.rules, merger.PostResolve, mergeKinds)
+				return nil
+			})
+		}
+		eg.Wait()
+		phaseStart = tm.add("resolve", phaseStart)
+	}
+	for _, lang := range langs {
+		if life, ok := lang.(language.LifecycleManager); ok {
+			sandbox.call(lang.Name(), "AfterResolvingDeps", func() { life.AfterResolvingDeps(ctx) })
+		}
+	}
+	if sandbox.stopped() {
+		return sandbox.err()
+	}
+	visits = sandbox.filterVisits(visits)
+	var resolveErrs []string
+	for _, lang := range langs {
+		if r, ok := lang.(language.ResolveErrorReporter); ok {
+			for _, err := range r.ResolveErrors() {
+				resolveErrs = append(resolveErrs, err.Error())
+			}
+		}
+	}
+	if len(resolveErrs) > 0 {
+		return fmt.Errorf("dependencies could not be resolved, so no build files were written:\n\t%s", strings.Join(resolveErrs, "\n\t"))
+	}
+	if q != nil {
+		return q.answer(c, FilterLanguages(c, langs), ruleIndex, rc, visits, indexedFiles)
+	}
+
+	// Update references to renamed rules, including references from rules
+	// of kinds Gazelle doesn't know about.
+	findRuleChanges(visits, kinds).fixReferences(c.RepoName, visits, indexedFiles)
+	phaseStart = tm.add("resolve", phaseStart)
+
+	// Report strings marked with # keep comments that refer to files or
+	// targets that no longer exist. The fix command removes them instead.
+	if stale := checkStaleKeeps(visits, indexedFiles, kinds); len(stale) > 0 {
+		if c.Strict {
+			return fmt.Errorf("found # keep comments on files or targets that don't exist, so no build files were written. Run 'gazelle fix' to remove them:\n\t%s", strings.Join(stale, "\n\t"))
+		}
+		for _, msg := range stale {
+			log.Printf("%s. Run 'gazelle fix' to remove it.", msg)
+		}
+	}
+
+	// Emit merged files. Files are stamped first, so the checks below see
+	// the content that would be written.
+	for _, v := range visits {
+		merger.FixLoads(v.file, applyKindMappings(v.mappedKinds, loads))
+		if uc.stamp {
+			if err := stampFile(v.c, v.file, v.dir, v.regularFiles); err != nil {
+				log.Printf("%s: stamping build file: %v", v.file.Path, err)
+			}
+		}
+	}
+	if uc.restrictToArgs {
+		if err := checkRestrictedToArgs(c, visits); err != nil {
+			return err
+		}
+	}
+	if uc.maxFileChanges > 0 && !uc.force {
+		if err := checkMaxFileChanges(visits, uc.maxFileChanges); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var exit error
+	for _, v := range visits {
+		if !bytes.Equal(v.file.Content, v.file.Format()) {
+			result.Files = append(result.Files, findOutputPath(v.c, v.file))
+		}
+		if uc.report != nil {
+			if err := uc.report.addFile(v.pkgRel, v.file); err != nil {
+				log.Printf("%s: adding build file to report: %v", v.file.Path, err)
+			}
+		}
+		if err := uc.emit(v.c, v.file); err != nil {
+			if err == ErrDiffChanges {
+				exit = err
+			} else {
+				log.Print(err)
+			}
+		}
+	}
+	if uc.patchPath != "" || len(uc.diffs) > 0 {
+		if err := writePatch(uc); err != nil {
+			return err
+		}
+	}
+	if uc.report != nil {
+		if err := uc.report.write(uc.reportPath); err != nil {
+			return err
+		}
+	}
+	if uc.buildozerScriptPath != "" {
+		if err := os.WriteFile(uc.buildozerScriptPath, uc.buildozerScript.Bytes(), 0o666); err != nil {
+			return err
+		}
+	}
+	if uc.managedFilesOutPath != "" {
+		if err := writeManagedFiles(uc.managedFilesOutPath, visits); err != nil {
+			return err
+		}
+	}
+	if err := commitChangedFiles(c.RepoRoot, uc.commitFiles, uc.commitMessage, uc.commitPerDir); err != nil {
+		return err
+	}
+	tm.add("emit", phaseStart)
+
+	// With -keep_going, other build files were written, but the run still
+	// fails if a language extension panicked.
+	if err := sandbox.err(); err != nil {
+		return err
+	}
+	return exit
+}
+
+// checkRestrictedToArgs returns an error listing the build files in visits
+// that would be written outside the directories named on the command line
+// (or their subdirectories, when updating recursively). Directories other
+// than those named may be updated, for example, with -changed_files, when
+// their rules depend on changed packages.
+func checkRestrictedToArgs(c *config.Config, visits []visitRecord) error {
+	uc := getUpdateConfig(c)
+	recursive := uc.walkMode == walk.UpdateSubdirsMode || uc.walkMode == walk.VisitAllUpdateSubdirsMode
+	var argRels []string
+	for _, dir := range uc.dirs {
+		rel, err := filepath.Rel(c.RepoRoot, dir)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+		argRels = append(argRels, rel)
+	}
+	inArgs := func(rel string) bool {
+		for _, argRel := range argRels {
+			if rel == argRel || recursive && (argRel == "" || strings.HasPrefix(rel, argRel+"/")) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var outside []string
+	for _, v := range visits {
+		if bytes.Equal(v.file.Content, v.file.Format()) {
+			continue
+		}
+		outPath := findOutputPath(v.c, v.file)
+		baseDir := v.c.RepoRoot
+		if v.c.WriteBuildFilesDir != "" {
+			baseDir = v.c.WriteBuildFilesDir
+		}
+		rel, err := filepath.Rel(baseDir, filepath.Dir(outPath))
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+		if !inArgs(rel) {
+			outside = append(outside, outPath)
+		}
+	}
+	if len(outside) > 0 {
+		return fmt.Errorf("-restrict_to_args is set, but build files outside the requested directories would change:\n\t%s", strings.Join(outside, "\n\t"))
+	}
+	return nil
+}
+
+// checkMaxFileChanges returns an error listing the build files that would
+// change if there are more than max of them. This protects against
+// misconfigured directives, like a changed prefix in the root build file,
+// rewriting every build file in the repository at once.
+func checkMaxFileChanges(visits []visitRecord, max int) error {
+	var changed []string
+	for _, v := range visits {
+		if !bytes.Equal(v.file.Content, v.file.Format()) {
+			changed = append(changed, findOutputPath(v.c, v.file))
+		}
+	}
+	if len(changed) <= max {
+		return nil
+	}
+	const shown = 10
+	list := changed
+	more := ""
+	if len(list) > shown {
+		list = list[:shown]
+		more = fmt.Sprintf("\n\t... and %d more", len(changed)-shown)
+	}
+	return fmt.Errorf("%d build files would change, more than -max_file_changes=%d, so no build files were written. Run with -force to write them anyway:\n\t%s%s", len(changed), max, strings.Join(list, "\n\t"), more)
+}
+
+// lookupMapKindReplacement finds a mapped replacement for rule kind `kind`, resolving transitively.
+// i.e. if go_library is mapped to custom_go_library, and custom_go_library is mapped to other_go_library,
+// looking up go_library will return other_go_library.
+// It returns an error on a loop, and may return nil if no remapping should be performed.
+func lookupMapKindReplacement(kindMap map[string]config.MappedKind, kind string) (*config.MappedKind, error) {
+	var mapped *config.MappedKind
+	seenKinds := make(map[string]struct{})
+	seenKindPath := []string{kind}
+	for {
+		replacement, ok := kindMap[kind]
+		if !ok {
+			break
+		}
+
+		seenKindPath = append(seenKindPath, replacement.KindName)
+		if _, alreadySeen := seenKinds[replacement.KindName]; alreadySeen {
+			return nil, fmt.Errorf("found loop of map_kind replacements: %s", strings.Join(seenKindPath, " -> "))
+		}
+
+		seenKinds[replacement.KindName] = struct{}{}
+		mapped = &replacement
+		if kind == replacement.KindName {
+			break
+		}
+
+		kind = replacement.KindName
+	}
+
+	return mapped, nil
+}
+
+func newFixUpdateConfiguration(wd, cmd string, args []string, cexts []config.Configurer, usage func(*flag.FlagSet)) (*config.Config, error) {
+	c := config.New()
+	c.WorkDir = wd
+
+	fs := flag.NewFlagSet("gazelle", flag.ContinueOnError)
+	// Flag will call this on any parse error. Don't print usage unless
+	// -h or -help were passed explicitly.
+	fs.Usage = func() {}
+
+	for _, cext := range cexts {
+		cext.RegisterFlags(fs, cmd, c)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			usage(fs)
+			return nil, err
+		}
+		// flag already prints the error; don't print it again.
+		return nil, errors.New("Try -help for more information.")
+	}
+
+	for _, cext := range cexts {
+		if err := cext.CheckFlags(fs, c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func fixUpdateUsage(fs *flag.FlagSet) {
+	fmt.Fprint(os.Stderr, `usage: gazelle [fix|update] [flags...] [package-dirs...]
+
+The update command creates new build files and update existing BUILD files
+when needed.
+
+The fix command also creates and updates build files, and in addition, it may
+make potentially breaking updates to usage of rules. For example, it may
+delete obsolete rules or rename existing rules.
+
+There are several output modes which can be selected with the -mode flag. The
+output mode determines what Gazelle does with updated BUILD files.
+
+  fix (default) - write updated BUILD files back to disk.
+  print - print updated BUILD files to stdout.
+  diff - diff updated BUILD files against existing files in unified format.
+    Diffs of all files are printed together as one patch, sorted by path, or
+    written to the file named by -patch_file.
+
+Gazelle accepts a list of paths to Go package directories to process (defaults
+to the working directory if none are given). It recursively traverses
+subdirectories. All directories must be under the directory specified by
+-repo_root; if -repo_root is not given, this is the directory containing the
+WORKSPACE file.
+
+FLAGS:
+
+`)
+	fs.PrintDefaults()
+}
+
+func fixRepoFiles(c *config.Config, loads []rule.LoadInfo) error {
+	uc := getUpdateConfig(c)
+	if !c.ShouldFix {
+		return nil
+	}
+	shouldFix := false
+	for _, d := range uc.dirs {
+		if d == c.RepoRoot {
+			shouldFix = true
+		}
+	}
+	if !shouldFix {
+		return nil
+	}
+
+	for _, f := range uc.workspaceFiles {
+		merger.FixLoads(f, loads)
+		workspaceFile := wspace.FindWORKSPACEFile(c.RepoRoot)
+
+		if f.Path == workspaceFile {
+			removeLegacyGoRepository(f)
+			if err := merger.CheckGazelleLoaded(f); err != nil {
+				return err
+			}
+		}
+		if err := uc.emit(c, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeLegacyGoRepository removes loads of go_repository from
+// @io_bazel_rules_go. FixLoads should be called after this; it will load from
+// @bazel_gazelle.
+func removeLegacyGoRepository(f *rule.File) {
+	for _, l := range f.Loads {
+		if l.Name() == "@io_bazel_rules_go//go:def.bzl" {
+			l.Remove("go_repository")
+			if l.IsEmpty() {
+				l.Delete()
+			}
+		}
+	}
+}
+
+func findWorkspaceName(f *rule.File) string {
+	var name string
+	for _, r := range f.Rules {
+		if r.Kind() == "workspace" {
+			name = r.Name()
+			break
+		}
+	}
+	// HACK(bazelbuild/rules_go#2355, bazelbuild/rules_go#2387):
+	// We can't patch the WORKSPACE file with the correct name because Bazel
+	// writes it first; our patches won't apply.
+	if name == "com_google_googleapis" {
+		return "go_googleapis"
+	}
+	return name
+}
+
+func isDescendingDir(dir, root string) bool {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return false
+	}
+	if rel == "." {
+		return true
+	}
+	return !strings.HasPrefix(rel, "..")
+}
+
+// resolveDirArg resolves symlinks in dir, a directory named on the command
+// line. If dir is reached through a symlink to a directory outside the
+// repository, like a vendored module linked from a shared module cache, the
+// path through the link is returned instead, so the directory is updated
+// where it appears in the repository.
+func resolveDirArg(dir, repoRoot string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil || isDescendingDir(resolved, repoRoot) {
+		return resolved, err
+	}
+	parent := filepath.Dir(dir)
+	if parent == dir {
+		return resolved, nil
+	}
+	resolvedParent, err := resolveDirArg(parent, repoRoot)
+	if err != nil || !isDescendingDir(resolvedParent, repoRoot) {
+		return resolved, err
+	}
+	return filepath.Join(resolvedParent, filepath.Base(dir)), nil
+}
+
+func findOutputPath(c *config.Config, f *rule.File) string {
+	if c.ReadBuildFilesDir == "" && c.WriteBuildFilesDir == "" {
+		return f.Path
+	}
+	baseDir := c.WriteBuildFilesDir
+	if c.WriteBuildFilesDir == "" {
+		baseDir = c.RepoRoot
+	}
+	outputDir := filepath.Join(baseDir, filepath.FromSlash(f.Pkg))
+	defaultOutputPath := filepath.Join(outputDir, c.DefaultBuildFileName())
+	ents, err := os.ReadDir(outputDir)
+	if err != nil {
+		// Ignore error. Directory probably doesn't exist.
+		return defaultOutputPath
+	}
+	outputPath := rule.MatchBuildFile(outputDir, c.ValidBuildFileNames, ents)
+	if outputPath == "" {
+		return defaultOutputPath
+	}
+	return outputPath
+}
+
+// maybePopulateRemoteCacheFromGoMod reads go.mod and adds a root to rc for each
+// module requirement. This lets the Go extension avoid a network lookup for
+// unknown imports with -external=external, and it lets dependency resolution
+// succeed with -external=static when it might not otherwise.
+//
+// This function does not override roots added from WORKSPACE (or some other
+// configuration file), but it's useful when there is no such file. In most
+// cases, a user of Gazelle with indirect Go dependencies does not need to add
+// '# gazelle:repository' or '# gazelle:repository_macro' directives to their
+// WORKSPACE file. This need was frustrating for developers in non-Go
+// repositories with go_repository dependencies declared in macros. It wasn't
+// obvious that Gazelle was missing these.
+//
+// This function is regrettably Go specific and does not belong here, but it
+// can't be moved to //language/go until //repo is broken up and moved there.
+func maybePopulateRemoteCacheFromGoMod(c *config.Config, rc *repo.RemoteCache) error {
+	haveGo := false
+	for name := range c.Exts {
+		if name == "go" {
+			haveGo = true
+			break
+		}
+	}
+	if !haveGo {
+		return nil
+	}
+
+	goModPath := filepath.Join(c.RepoRoot, "go.mod")
+	if _, err := os.Stat(goModPath); err != nil {
+		return nil
+	}
+
+	return rc.PopulateFromGoMod(goModPath)
+}
+
+func unionKindInfoMaps(a, b map[string]rule.KindInfo) map[string]rule.KindInfo {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+	result := make(map[string]rule.KindInfo, len(a)+len(b))
+	for _, m := range []map[string]rule.KindInfo{a, b} {
+		for k, v := range m {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// addMergeableAttrs returns a copy of kinds where attributes declared with
+// # gazelle:mergeable_attr are added to each kind's MergeableAttrs. An
+// attribute is only added if every rule of its kind in gen sets it, so
+// existing values of attributes Gazelle doesn't generate are preserved
+// instead of deleted. kinds is returned unmodified if no attributes were
+// added.
+func addMergeableAttrs(c *config.Config, kinds map[string]rule.KindInfo, gen []*rule.Rule) map[string]rule.KindInfo {
+	if len(c.MergeableAttrs) == 0 {
+		return kinds
+	}
+	var result map[string]rule.KindInfo
+	for kind, attrs := range c.MergeableAttrs {
+		var added []string
+		for attr := range attrs {
+			if generatesAttr(gen, kind, attr) {
+				added = append(added, attr)
+			}
+		}
+		if len(added) == 0 {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]rule.KindInfo, len(kinds)+len(c.MergeableAttrs))
+			for k, v := range kinds {
+				result[k] = v
+			}
+		}
+		info := result[kind]
+		mergeable := make(map[string]bool, len(info.MergeableAttrs)+len(added))
+		for attr := range info.MergeableAttrs {
+			mergeable[attr] = true
+		}
+		for _, attr := range added {
+			mergeable[attr] = true
+		}
+		info.MergeableAttrs = mergeable
+		result[kind] = info
+	}
+	if result == nil {
+		return kinds
+	}
+	return result
+}
+
+// generatesAttr returns whether gen has at least one rule of the given kind
+// and every such rule sets attr.
+func generatesAttr(gen []*rule.Rule, kind, attr string) bool {
+	found := false
+	for _, r := range gen {
+		if r.Kind() != kind {
+			continue
+		}
+		if r.Attr(attr) == nil {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// applyKindMappings returns a copy of LoadInfo that includes c.KindMap.
+func applyKindMappings(mappedKinds []config.MappedKind, loads []rule.LoadInfo) []rule.LoadInfo {
+	if len(mappedKinds) == 0 {
+		return loads
+	}
+
+	// Add new RuleInfos or replace existing ones with merged ones.
+	mappedLoads := make([]rule.LoadInfo, len(loads))
+	copy(mappedLoads, loads)
+	for _, mappedKind := range mappedKinds {
+		mappedLoads = appendOrMergeKindMapping(mappedLoads, mappedKind)
+	}
+	return mappedLoads
+}
+
+// appendOrMergeKindMapping adds LoadInfo for the given replacement.
+func appendOrMergeKindMapping(mappedLoads []rule.LoadInfo, mappedKind config.MappedKind) []rule.LoadInfo {
+	// If mappedKind.KindLoad already exists in the list, create a merged copy.
+	for i, load := range mappedLoads {
+		if load.Name == mappedKind.KindLoad {
+			mappedLoads[i].Symbols = append(load.Symbols, mappedKind.KindName)
+			return mappedLoads
+		}
+	}
+
+	// Add a new LoadInfo.
+	return append(mappedLoads, rule.LoadInfo{
+		Name:    mappedKind.KindLoad,
+		Symbols: []string{mappedKind.KindName},
+	})
+}
+
+func isDirErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return pe.Err == syscall.EISDIR
+	}
+	return false
+}
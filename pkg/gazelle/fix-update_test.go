@@ -0,0 +1,557 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/language/bazel/visibility"
+	golang "github.com/bazelbuild/bazel-gazelle/language/go"
+	"github.com/bazelbuild/bazel-gazelle/language/plugin"
+	"github.com/bazelbuild/bazel-gazelle/language/proto"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/bazelbuild/bazel-gazelle/testtools"
+	"github.com/bazelbuild/bazel-gazelle/walk"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRun(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{Path: "BUILD.bazel", Content: "# gazelle:prefix example.com/m\n"},
+		{Path: "a/a.go", Content: "package a"},
+		{Path: "b/b.go", Content: "package b"},
+		{Path: "b/BUILD.bazel", Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "b",
+    srcs = ["b.go"],
+    importpath = "example.com/m/b",
+    visibility = ["//visibility:public"],
+)
+`},
+		{Path: "c/BUILD.bazel", Content: "# gazelle:no_such_directive\n"},
+	})
+	defer cleanup()
+	langs := []language.Language{proto.NewLanguage(), golang.NewLanguage()}
+
+	// In diff mode, changed files are reported but not written.
+	res, err := Run(context.Background(), Config{WorkDir: dir, Args: []string{"-mode=diff", "-patch_file=" + filepath.Join(dir, "patch")}}, langs)
+	if !errors.Is(err, ErrDiffChanges) {
+		t.Fatalf("got error %v; want ErrDiffChanges", err)
+	}
+	wantFiles := []string{filepath.Join(dir, "a", "BUILD.bazel")}
+	if diff := cmp.Diff(wantFiles, res.Files); diff != "" {
+		t.Errorf("files (-want,+got):\n%s", diff)
+	}
+	if _, err := os.Stat(wantFiles[0]); !os.IsNotExist(err) {
+		t.Errorf("a/BUILD.bazel was written with -mode=diff: %v", err)
+	}
+	var found bool
+	for _, d := range res.Diagnostics {
+		if strings.Contains(d, "unknown directive: gazelle:no_such_directive") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("got diagnostics %q; want one about an unknown directive", res.Diagnostics)
+	}
+
+	// Files are written in the default mode.
+	res, err = Run(context.Background(), Config{Command: "fix", WorkDir: dir}, langs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(wantFiles, res.Files); diff != "" {
+		t.Errorf("files (-want,+got):\n%s", diff)
+	}
+	if _, err := os.Stat(wantFiles[0]); err != nil {
+		t.Error(err)
+	}
+
+	// Nothing changes when the files are up to date.
+	if res, err = Run(context.Background(), Config{WorkDir: dir}, langs); err != nil {
+		t.Fatal(err)
+	} else if len(res.Files) > 0 {
+		t.Errorf("got files %q after update; want none", res.Files)
+	}
+}
+
+func TestRunManageDefaultVisibility(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{Path: "BUILD.bazel", Content: `# gazelle:prefix example.com/m
+# gazelle:default_visibility //visibility:public
+# gazelle:manage_default_visibility true
+`},
+		{Path: "a/a.go", Content: "package a"},
+	})
+	defer cleanup()
+	langs := []language.Language{golang.NewLanguage(), visibility.NewLanguage()}
+
+	if _, err := Run(context.Background(), Config{WorkDir: dir}, langs); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "a", "BUILD.bazel"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+package(default_visibility = ["//visibility:public"])
+
+go_library(
+    name = "a",
+    srcs = ["a.go"],
+    importpath = "example.com/m/a",
+)
+`
+	if diff := cmp.Diff(want, string(data)); diff != "" {
+		t.Errorf("a/BUILD.bazel (-want,+got):\n%s", diff)
+	}
+
+	// A second run doesn't change anything.
+	if res, err := Run(context.Background(), Config{WorkDir: dir}, langs); err != nil {
+		t.Fatal(err)
+	} else if len(res.Files) > 0 {
+		t.Errorf("got files %q after second update; want none", res.Files)
+	}
+}
+
+func TestRunReusedLanguages(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{Path: "BUILD.bazel", Content: "# gazelle:prefix example.com/m\n"},
+		{Path: "a/BUILD.bazel", Content: "# gazelle:go_library_name pinned\n"},
+		{Path: "a/a.go", Content: "package a"},
+		{Path: "b/b.go", Content: "package b\n\nimport _ \"example.com/m/a\"\n"},
+	})
+	defer cleanup()
+	langs := []language.Language{golang.NewLanguage()}
+	readDeps := func() []string {
+		t.Helper()
+		f, err := rule.LoadFile(filepath.Join(dir, "b", "BUILD.bazel"), "b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f.Rules[0].AttrStrings("deps")
+	}
+
+	if _, err := Run(context.Background(), Config{WorkDir: dir, Args: []string{"-index=false"}}, langs); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"//a:pinned"}, readDeps()); diff != "" {
+		t.Errorf("deps after first run (-want,+got):\n%s", diff)
+	}
+
+	// Names pinned in an earlier run aren't remembered by the languages.
+	if err := os.WriteFile(filepath.Join(dir, "a", "BUILD.bazel"), nil, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Run(context.Background(), Config{WorkDir: dir, Args: []string{"-index=false"}}, langs); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"//a"}, readDeps()); diff != "" {
+		t.Errorf("deps after second run (-want,+got):\n%s", diff)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{Path: "BUILD.bazel", Content: "# gazelle:prefix example.com/m\n"},
+		{Path: "a/a.go", Content: "package a"},
+	})
+	defer cleanup()
+	langs := []language.Language{golang.NewLanguage()}
+
+	files, res, err := Generate(context.Background(), Config{WorkDir: dir, Args: []string{"-mode=fix"}}, langs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "a", "BUILD.bazel")
+	if diff := cmp.Diff([]string{path}, res.Files); diff != "" {
+		t.Errorf("result files (-want,+got):\n%s", diff)
+	}
+	f, ok := files[path]
+	if !ok || len(files) != 1 {
+		t.Fatalf("got files for %v; want only %s", files, path)
+	}
+	if len(f.Rules) != 1 || f.Rules[0].Kind() != "go_library" || f.Rules[0].Name() != "a" {
+		t.Errorf("got build file:\n%s", f.Format())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("a/BUILD.bazel was written by Generate: %v", err)
+	}
+
+	if _, _, err := Generate(context.Background(), Config{WorkDir: dir, Args: []string{"-report=report.md"}}, langs); err == nil {
+		t.Error("Generate with -report: got success; want error")
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{Path: "BUILD.bazel", Content: "# gazelle:prefix example.com/m\n"},
+		{Path: "a/a.go", Content: "package a"},
+	})
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Run(ctx, Config{WorkDir: dir}, []language.Language{golang.NewLanguage()})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v; want context.Canceled", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a", "BUILD.bazel")); !os.IsNotExist(err) {
+		t.Errorf("a/BUILD.bazel was written after cancellation: %v", err)
+	}
+}
+
+func TestListDeps(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE", Content: `go_repository(
+    name = "com_github_pkg_errors",
+    importpath = "github.com/pkg/errors",
+)
+`},
+		{Path: "BUILD.bazel", Content: `# gazelle:prefix example.com/m
+# gazelle:resolve go example.com/ext //third_party:ext
+`},
+		{Path: "a/a.go", Content: `package a
+
+import (
+	_ "example.com/ext"
+	_ "example.com/m/b"
+)
+`},
+		{Path: "b/b.go", Content: "package b"},
+	})
+	defer cleanup()
+	langs := []language.Language{golang.NewLanguage()}
+
+	var out strings.Builder
+	// Imports are resolved like the imports of generated rules, so external
+	// repositories are found, and standard library imports need no rule.
+	err := ListDeps(context.Background(), Config{WorkDir: dir, Args: []string{"example.com/m/b", "example.com/ext", "github.com/pkg/errors", "fmt"}}, langs, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "example.com/m/b\t//b\nexample.com/ext\t//third_party:ext\ngithub.com/pkg/errors\t@com_github_pkg_errors//:errors\nfmt\t\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("forward (-want,+got):\n%s", diff)
+	}
+
+	// Rules depending on a label are listed after their dependencies are
+	// resolved, even though their build files haven't been written yet.
+	out.Reset()
+	err = ListDeps(context.Background(), Config{WorkDir: dir, Args: []string{"-reverse", "//b", "//third_party:ext"}}, langs, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "//b\t//a\n//third_party:ext\t//a\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("reverse (-want,+got):\n%s", diff)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a", "BUILD.bazel")); !os.IsNotExist(err) {
+		t.Errorf("a/BUILD.bazel was written by ListDeps: %v", err)
+	}
+
+	out.Reset()
+	err = ListDeps(context.Background(), Config{WorkDir: dir, Args: []string{"-external=static", "example.com/missing"}}, langs, &out)
+	if err == nil || !strings.Contains(err.Error(), "example.com/missing") {
+		t.Errorf("got error %v; want error about example.com/missing", err)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{Path: "BUILD.bazel", Content: `# gazelle:prefix example.com/m
+# gazelle:resolve go example.com/ext //third_party:ext
+`},
+		{Path: "a/a.go", Content: `package a
+
+import (
+	_ "example.com/ext"
+	_ "example.com/m/b"
+)
+`},
+		{Path: "a/BUILD.bazel", Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "a",
+    srcs = ["a.go"],
+    importpath = "example.com/m/a",
+    visibility = ["//visibility:public"],
+    deps = [
+        "//c",  # keep
+    ],
+)
+`},
+		{Path: "b/b.go", Content: "package b"},
+		{Path: "c/c.go", Content: "package c"},
+	})
+	defer cleanup()
+	langs := []language.Language{golang.NewLanguage()}
+
+	var out strings.Builder
+	err := Explain(context.Background(), Config{WorkDir: dir, Args: []string{"//a", "deps"}}, langs, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `//a (go_library)
+deps:
+  "//b": import "example.com/m/b" in a.go: provided by an indexed rule
+  "//c": marked # keep
+  "//third_party:ext": import "example.com/ext" in a.go: resolved with a # gazelle:resolve directive
+`
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("deps (-want,+got):\n%s", diff)
+	}
+
+	// Labels relative to the working directory may be used, and all
+	// attributes are explained if none is named.
+	out.Reset()
+	err = Explain(context.Background(), Config{WorkDir: filepath.Join(dir, "a"), Args: []string{":a"}}, langs, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`  "a.go": Go source file in //a`,
+		`  "example.com/m/a": the Go prefix "example.com/m" set in //, followed by the path of the directory`,
+		`  "//visibility:public": default visibility of Go packages that aren't internal`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("output doesn't contain %q:\n%s", line, out.String())
+		}
+	}
+
+	err = Explain(context.Background(), Config{WorkDir: dir, Args: []string{"//a:missing"}}, langs, &out)
+	if err == nil || !strings.Contains(err.Error(), `no rule named "missing"`) {
+		t.Errorf("got error %v; want error about missing rule", err)
+	}
+
+	for _, flag := range []string{"-patch_file", "-report"} {
+		path := filepath.Join(dir, "out")
+		err = Explain(context.Background(), Config{WorkDir: dir, Args: []string{"-mode=diff", flag + "=" + path, "//a"}}, langs, &out)
+		if err == nil || !strings.Contains(err.Error(), "explain: "+flag+" can't be used") {
+			t.Errorf("%s: got error %v; want error about the flag", flag, err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: file was written", flag)
+		}
+	}
+}
+
+// countingLang generates a fake_rule for each directory with a fake.txt file
+// and records the largest number of concurrent calls to Resolve.
+type countingLang struct {
+	language.BaseLang
+	concurrent        bool
+	active, maxActive atomic.Int32
+}
+
+func (*countingLang) Name() string { return "counting" }
+
+func (*countingLang) Kinds() map[string]rule.KindInfo {
+	return map[string]rule.KindInfo{
+		"fake_rule": {
+			NonEmptyAttrs:  map[string]bool{"srcs": true},
+			MergeableAttrs: map[string]bool{"srcs": true},
+			ResolveAttrs:   map[string]bool{"deps": true},
+		},
+	}
+}
+
+func (*countingLang) GenerateRules(args language.GenerateArgs) language.GenerateResult {
+	var res language.GenerateResult
+	for _, name := range args.RegularFiles {
+		if name == "fake.txt" {
+			r := rule.NewRule("fake_rule", "fake")
+			r.SetAttr("srcs", []string{name})
+			res.Gen = append(res.Gen, r)
+			res.Imports = append(res.Imports, nil)
+		}
+	}
+	return res
+}
+
+func (l *countingLang) ResolveConcurrently() bool { return l.concurrent }
+
+func (l *countingLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, imports interface{}, from label.Label) {
+	n := l.active.Add(1)
+	defer l.active.Add(-1)
+	for {
+		max := l.maxActive.Load()
+		if n <= max || l.maxActive.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	r.SetAttr("deps", []string{"//dep"})
+}
+
+// serialLang generates no rules and doesn't support concurrent resolution.
+type serialLang struct {
+	language.BaseLang
+}
+
+func (*serialLang) Name() string { return "serial" }
+
+func TestResolveJobs(t *testing.T) {
+	files := []testtools.FileSpec{{Path: "WORKSPACE"}}
+	for i := 0; i < 8; i++ {
+		files = append(files, testtools.FileSpec{Path: fmt.Sprintf("d%d/fake.txt", i)})
+	}
+	for _, tc := range []struct {
+		name           string
+		concurrent     bool
+		otherLangs     []language.Language
+		args           []string
+		wantConcurrent bool
+	}{
+		{name: "serial"},
+		{name: "concurrent", concurrent: true, wantConcurrent: true},
+		{
+			// Concurrent resolvers may call CrossResolve on other
+			// languages, so every language must opt in.
+			name:       "mixed",
+			concurrent: true,
+			otherLangs: []language.Language{&serialLang{}},
+		},
+		{
+			// Languages disabled with -lang aren't resolved.
+			name:           "mixed_filtered",
+			concurrent:     true,
+			otherLangs:     []language.Language{&serialLang{}},
+			args:           []string{"-lang=counting"},
+			wantConcurrent: true,
+		},
+		{
+			// The languages built into the gazelle binary.
+			name:           "default_langs",
+			concurrent:     true,
+			otherLangs:     []language.Language{proto.NewLanguage(), golang.NewLanguage(), plugin.NewLanguage()},
+			wantConcurrent: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, cleanup := testtools.CreateFiles(t, files)
+			defer cleanup()
+			lang := &countingLang{concurrent: tc.concurrent}
+			langs := append([]language.Language{lang}, tc.otherLangs...)
+			if _, err := Run(context.Background(), Config{WorkDir: dir, Args: append([]string{"-resolve_jobs=4"}, tc.args...)}, langs); err != nil {
+				t.Fatal(err)
+			}
+			if got := lang.maxActive.Load(); tc.wantConcurrent && got < 2 || !tc.wantConcurrent && got != 1 {
+				t.Errorf("got at most %d concurrent calls to Resolve", got)
+			}
+			for i := 0; i < 8; i++ {
+				data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("d%d", i), "BUILD.bazel"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(data), `deps = ["//dep"]`) {
+					t.Errorf("d%d/BUILD.bazel doesn't contain resolved deps:\n%s", i, data)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckRestrictedToArgs(t *testing.T) {
+	repoRoot := t.TempDir()
+	unchanged, err := rule.LoadData(filepath.Join(repoRoot, "c", "BUILD.bazel"), "c", []byte("# unchanged\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newFile := func(rel string) *rule.File {
+		f := rule.EmptyFile(filepath.Join(repoRoot, filepath.FromSlash(rel), "BUILD.bazel"), rel)
+		rule.NewRule("filegroup", "files").Insert(f)
+		return f
+	}
+
+	for _, tc := range []struct {
+		desc     string
+		mode     walk.Mode
+		visits   map[string]*rule.File
+		wantErrs []string
+	}{
+		{
+			desc: "recursive",
+			mode: walk.VisitAllUpdateSubdirsMode,
+			visits: map[string]*rule.File{
+				"a":     newFile("a"),
+				"a/sub": newFile("a/sub"),
+				"c":     unchanged,
+			},
+		}, {
+			desc: "non_recursive",
+			mode: walk.VisitAllUpdateDirsMode,
+			visits: map[string]*rule.File{
+				"a":     newFile("a"),
+				"a/sub": newFile("a/sub"),
+				"ab":    newFile("ab"),
+			},
+			wantErrs: []string{"a/sub/BUILD.bazel", "ab/BUILD.bazel"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			c := config.New()
+			c.RepoRoot = repoRoot
+			c.Exts[updateName] = &updateConfig{
+				dirs:     []string{filepath.Join(repoRoot, "a")},
+				walkMode: tc.mode,
+			}
+			var visits []visitRecord
+			for rel, f := range tc.visits {
+				visits = append(visits, visitRecord{pkgRel: rel, c: c, file: f})
+			}
+			err := checkRestrictedToArgs(c, visits)
+			if len(tc.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("got error %v; want success", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("got success; want error")
+			}
+			for _, want := range tc.wantErrs {
+				if !strings.Contains(err.Error(), filepath.FromSlash(want)) {
+					t.Errorf("got error %q; want it to mention %s", err, want)
+				}
+			}
+			if got := strings.Count(err.Error(), "\n\t"); got != len(tc.wantErrs) {
+				t.Errorf("got error %q listing %d files; want %d", err, got, len(tc.wantErrs))
+			}
+		})
+	}
+}
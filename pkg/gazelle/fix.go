@@ -0,0 +1,83 @@
+/* Copyright 2016 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+func fixFile(c *config.Config, f *rule.File) error {
+	newContent := f.Format()
+	if bytes.Equal(f.Content, newContent) {
+		return nil
+	}
+	outPath := findOutputPath(c, f)
+	if err := os.MkdirAll(filepath.Dir(outPath), 0o777); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outPath, newContent, 0o666); err != nil {
+		return err
+	}
+	f.Content = newContent
+	if getUpdateConfig(c).print0 {
+		fmt.Printf("%s\x00", outPath)
+	}
+	return nil
+}
+
+// pruneUnknownAttrs deletes attributes from rules in f that are not supported
+// by the rule's kind, according to KindInfo.KnownAttrs. Rules of kinds with
+// unknown attributes, including mapped kinds, are not changed. Attributes
+// marked with a "# keep" comment are not deleted. Each deleted attribute is
+// logged.
+func pruneUnknownAttrs(f *rule.File, kinds map[string]rule.KindInfo) {
+	for _, r := range f.Rules {
+		info, ok := kinds[r.Kind()]
+		if !ok || info.KnownAttrs == nil {
+			continue
+		}
+		var pruned []string
+		for _, key := range r.AttrKeys() {
+			if !info.KnownAttrs[key] && !rule.CommonAttrs[key] && !shouldKeepAttr(r, key) {
+				pruned = append(pruned, key)
+			}
+		}
+		sort.Strings(pruned)
+		for _, key := range pruned {
+			r.DelAttr(key)
+			log.Printf("%s: removed attribute %q from %s %q: not supported by %s", f.Path, key, r.Kind(), r.Name(), r.Kind())
+		}
+	}
+}
+
+// shouldKeepAttr returns whether the attribute key of r or its value is
+// marked with a "# keep" comment.
+func shouldKeepAttr(r *rule.Rule, key string) bool {
+	if rule.ShouldKeep(r.Attr(key)) {
+		return true
+	}
+	c := r.AttrComments(key)
+	return c != nil && rule.ShouldKeep(&bzl.CommentBlock{Comments: *c})
+}
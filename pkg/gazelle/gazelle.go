@@ -0,0 +1,277 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gazelle runs the Gazelle fix and update commands as a library.
+// Tools that embed Gazelle can call Run with their own set of languages
+// instead of building a gazelle_binary and running it in a subprocess.
+package gazelle
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// Config describes a single run of Gazelle.
+type Config struct {
+	// Command is the Gazelle command to run, either "update" or "fix".
+	// If empty, "update" is run.
+	Command string
+
+	// Args are the command line arguments for the command, not including
+	// the command name, for example, []string{"-mode=diff", "pkg/foo"}.
+	Args []string
+
+	// WorkDir is the directory Gazelle is run from. Relative paths in Args
+	// are resolved against it, and the repository root is found by searching
+	// its parent directories. If empty, the current directory is used.
+	WorkDir string
+}
+
+// Result describes the outcome of Run.
+type Result struct {
+	// Files lists the paths of build files that were changed. With the
+	// default emit mode, these files were written. With other modes, such
+	// as -mode=diff or -mode=print, they were only reported.
+	Files []string
+
+	// Diagnostics holds warnings and other messages Gazelle and its
+	// languages logged during the run, one message per element, without the
+	// log prefix, dates, or times.
+	Diagnostics []string
+}
+
+// Run runs the fix or update command named by cfg.Command with the given
+// languages. The languages are used in order, like the languages of a
+// gazelle_binary.
+//
+// Messages logged during the run are collected in Result.Diagnostics. They
+// are still written to the standard logger's output, too. Since the
+// standard logger is shared by the whole process, Run must not be called
+// concurrently.
+//
+// In -mode=diff, Run returns ErrDiffChanges if any build file would change.
+// If -h or -help is passed, Run prints usage information and returns
+// flag.ErrHelp. Cancelling ctx stops Run before any files are written.
+func Run(ctx context.Context, cfg Config, langs []language.Language) (Result, error) {
+	return run(ctx, cfg, langs, nil, nil)
+}
+
+// Generate runs the fix or update command like Run, but it doesn't write
+// build files. Instead, it returns the build files that would change, keyed
+// by the paths they would be written to, which are also listed in
+// Result.Files. The files have been merged with the existing build files,
+// and their Format methods return the new content. This lets services show
+// the results somewhere else, for example, as code review suggestions.
+//
+// The -mode flag is ignored. Flags that write other files, like -patch_file
+// and -report, can't be used.
+func Generate(ctx context.Context, cfg Config, langs []language.Language) (map[string]*rule.File, Result, error) {
+	files := make(map[string]*rule.File)
+	result, err := run(ctx, cfg, langs, files, nil)
+	if err != nil {
+		return nil, result, err
+	}
+	return files, result, nil
+}
+
+// query is a question about the repository answered after dependencies are
+// resolved, instead of emitting build files. The list-deps and explain
+// commands are implemented with queries.
+type query interface {
+	// registerFlags registers flags specific to the query's command.
+	registerFlags(fs *flag.FlagSet)
+
+	// setArgs is called with the positional arguments on the command line
+	// after other flags are checked. It returns the directories to update.
+	setArgs(c *config.Config, args []string) ([]string, error)
+
+	// usage prints the usage message of the query's command.
+	usage(fs *flag.FlagSet)
+
+	// answer prints the answer to the query. visits are the updated
+	// directories, and indexedFiles are build files that were only indexed.
+	// rc is the remote cache dependencies were resolved with.
+	answer(c *config.Config, langs []language.Language, ix *resolve.RuleIndex, rc *repo.RemoteCache, visits []visitRecord, indexedFiles []*rule.File) error
+}
+
+// run implements Run, Generate, ListDeps and Explain. If files is not nil,
+// changed build files are recorded there instead of being emitted. If q is
+// not nil, it's answered after dependencies are resolved.
+func run(ctx context.Context, cfg Config, langs []language.Language, files map[string]*rule.File, q query) (Result, error) {
+	var result Result
+	cmd := cfg.Command
+	switch cmd {
+	case "":
+		cmd = "update"
+	case "update", "fix":
+	default:
+		return result, fmt.Errorf("unknown command: %q", cmd)
+	}
+	wd := cfg.WorkDir
+	if wd == "" {
+		var err error
+		if wd, err = os.Getwd(); err != nil {
+			return result, err
+		}
+	}
+
+	diags := newDiagnosticWriter()
+	out := log.Writer()
+	log.SetOutput(io.MultiWriter(out, diags))
+	defer log.SetOutput(out)
+
+	err := runFixUpdate(ctx, wd, cmd, cfg.Args, langs, files, q, &result)
+	result.Diagnostics = diags.messages()
+	return result, err
+}
+
+// collectFiles changes the emit function in c's update configuration to
+// record changed build files in files, keyed by output path, instead of
+// writing them.
+func collectFiles(c *config.Config, files map[string]*rule.File) error {
+	uc := getUpdateConfig(c)
+	if name := fileWritingFlag(uc); name != "" {
+		return fmt.Errorf("%s can't be used when generating build files without writing them", name)
+	}
+	uc.emit = func(c *config.Config, f *rule.File) error {
+		if !bytes.Equal(f.Content, f.Format()) {
+			files[findOutputPath(c, f)] = f
+		}
+		return nil
+	}
+	return nil
+}
+
+// fileWritingFlag returns the name of a flag set in uc that makes the update
+// command write files other than build files, or prompt before writing them.
+// It returns "" if there are none.
+func fileWritingFlag(uc *updateConfig) string {
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"-patch_file", uc.patchPath != ""},
+		{"-commit_message", uc.commitMessage != ""},
+		{"-emit_buildozer_script", uc.buildozerScriptPath != ""},
+		{"-index_out", uc.indexOutPath != ""},
+		{"-managed_files_out", uc.managedFilesOutPath != ""},
+		{"-report", uc.reportPath != ""},
+		{"-interactive", uc.interactive},
+	} {
+		if f.set {
+			return f.name
+		}
+	}
+	return ""
+}
+
+// FilterLanguages returns the subset of input languages that pass the config's
+// filter, if any. Gazelle should not generate rules for languages not returned.
+func FilterLanguages(c *config.Config, langs []language.Language) []language.Language {
+	if len(c.Langs) == 0 {
+		return langs
+	}
+
+	var result []language.Language
+	for _, inputLang := range langs {
+		if containsLang(c.Langs, inputLang) {
+			result = append(result, inputLang)
+		}
+	}
+	return result
+}
+
+func containsLang(langNames []string, lang language.Language) bool {
+	for _, langName := range langNames {
+		if langName == lang.Name() {
+			return true
+		}
+	}
+	return false
+}
+
+// diagnosticWriter records messages written by the standard logger. The
+// logger writes each message with a single call to Write. The prefix and the
+// header added by the logger's flags are removed from each message.
+type diagnosticWriter struct {
+	prefix string
+	flags  int
+
+	mu   sync.Mutex
+	msgs []string
+}
+
+func newDiagnosticWriter() *diagnosticWriter {
+	return &diagnosticWriter{prefix: log.Prefix(), flags: log.Flags()}
+}
+
+func (w *diagnosticWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	if w.flags&log.Lmsgprefix == 0 {
+		msg = strings.TrimPrefix(msg, w.prefix)
+	}
+	if w.flags&log.Ldate != 0 && len(msg) >= len("2006/01/02 ") {
+		msg = msg[len("2006/01/02 "):]
+	}
+	if w.flags&(log.Ltime|log.Lmicroseconds) != 0 {
+		n := len("15:04:05 ")
+		if w.flags&log.Lmicroseconds != 0 {
+			n += len(".000000")
+		}
+		if len(msg) >= n {
+			msg = msg[n:]
+		}
+	}
+	if w.flags&(log.Lshortfile|log.Llongfile) != 0 {
+		if i := strings.Index(msg, ": "); i >= 0 {
+			msg = msg[i+len(": "):]
+		}
+	}
+	if w.flags&log.Lmsgprefix != 0 {
+		msg = strings.TrimPrefix(msg, w.prefix)
+	}
+	w.mu.Lock()
+	w.msgs = append(w.msgs, msg)
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+// take returns the messages recorded since the last call and forgets them.
+func (w *diagnosticWriter) take() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	msgs := w.msgs
+	w.msgs = nil
+	return msgs
+}
+
+func (w *diagnosticWriter) messages() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.msgs
+}
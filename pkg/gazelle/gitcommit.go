@@ -0,0 +1,100 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+const gitCommitMode = "git-commit"
+
+// gitCommitFile writes f like fixFile and records its path if it changed, so
+// the file can be committed by commitChangedFiles.
+func gitCommitFile(c *config.Config, f *rule.File) error {
+	changed := !bytes.Equal(f.Content, f.Format())
+	if err := fixFile(c, f); err != nil {
+		return err
+	}
+	if changed {
+		uc := getUpdateConfig(c)
+		uc.commitFiles = append(uc.commitFiles, findOutputPath(c, f))
+	}
+	return nil
+}
+
+// commitChangedFiles stages and commits the files recorded by gitCommitFile
+// in the Git repository containing repoRoot. Other changes in the working
+// tree and the index are not committed. When perDir is true, files are
+// committed separately for each top-level directory, and the directory is
+// prepended to the subject of each commit message.
+func commitChangedFiles(repoRoot string, files []string, message string, perDir bool) error {
+	if len(files) == 0 {
+		return nil
+	}
+	groups := make(map[string][]string)
+	for _, file := range files {
+		rel, err := filepath.Rel(repoRoot, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		var dir string
+		if perDir {
+			if i := strings.IndexByte(rel, '/'); i >= 0 {
+				dir = rel[:i]
+			}
+		}
+		groups[dir] = append(groups[dir], rel)
+	}
+	dirs := make([]string, 0, len(groups))
+	for dir := range groups {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		rels := groups[dir]
+		sort.Strings(rels)
+		msg := message
+		if dir != "" {
+			msg = dir + ": " + message
+		}
+		if err := runGit(repoRoot, append([]string{"add", "--"}, rels...)...); err != nil {
+			return err
+		}
+		if err := runGit(repoRoot, append([]string{"commit", "--quiet", "--message", msg, "--"}, rels...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runGit(dir string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s: %v\n%s", args[0], err, out)
+	}
+	return nil
+}
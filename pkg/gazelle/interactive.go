@@ -0,0 +1,97 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// interactiveReviewer is set up by -interactive. It shows the diff of each
+// changed build file and asks whether to apply it before passing the file
+// to emit.
+type interactiveReviewer struct {
+	emit emitFunc
+	in   *bufio.Reader
+	out  io.Writer
+
+	// applyAll is set when the user answers "a". Later files are applied
+	// without asking.
+	applyAll bool
+
+	// quit is set when the user answers "q" or input ends. Later files are
+	// skipped without asking.
+	quit bool
+}
+
+func newInteractiveReviewer(emit emitFunc, in io.Reader, out io.Writer) *interactiveReviewer {
+	return &interactiveReviewer{emit: emit, in: bufio.NewReader(in), out: out}
+}
+
+const interactiveHelp = `y - apply the changes to this file
+n - skip this file
+a - apply the changes to this file and all later files
+q - skip this file and all later files
+? - print help
+`
+
+// emitFile is an emitFunc that asks before emitting files that changed.
+// Files that didn't change are emitted as usual.
+func (r *interactiveReviewer) emitFile(c *config.Config, f *rule.File) error {
+	if bytes.Equal(f.Content, f.Format()) || r.applyAll {
+		return r.emit(c, f)
+	}
+	if r.quit {
+		return nil
+	}
+	rel, diff, err := unifiedDiff(c, f)
+	if err != nil {
+		return err
+	}
+	if _, err := r.out.Write(diff); err != nil {
+		return err
+	}
+	for {
+		fmt.Fprintf(r.out, "Apply changes to %s [y,n,a,q,?]? ", rel)
+		line, err := r.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			// Without more input, nothing else can be applied.
+			fmt.Fprintln(r.out)
+			r.quit = true
+			return nil
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return r.emit(c, f)
+		case "n", "no":
+			return nil
+		case "a", "all":
+			r.applyAll = true
+			return r.emit(c, f)
+		case "q", "quit":
+			r.quit = true
+			return nil
+		default:
+			fmt.Fprint(r.out, interactiveHelp)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestInteractiveReviewer(t *testing.T) {
+	for _, tc := range []struct {
+		desc, input string
+		wantEmitted []string
+		wantOutput  []string
+	}{
+		{
+			desc:        "yes_no",
+			input:       "y\nn\nyes\n",
+			wantEmitted: []string{"a/BUILD.bazel", "unchanged/BUILD.bazel", "c/BUILD.bazel"},
+			wantOutput:  []string{"+++ b/BUILD.bazel", "Apply changes to b/BUILD.bazel [y,n,a,q,?]? "},
+		}, {
+			desc:        "help",
+			input:       "x\nn\nn\nn\n",
+			wantEmitted: []string{"unchanged/BUILD.bazel"},
+			wantOutput:  []string{"? - print help"},
+		}, {
+			desc:        "all",
+			input:       "n\na\n",
+			wantEmitted: []string{"b/BUILD.bazel", "unchanged/BUILD.bazel", "c/BUILD.bazel"},
+		}, {
+			desc:        "quit",
+			input:       "y\nq\n",
+			wantEmitted: []string{"a/BUILD.bazel", "unchanged/BUILD.bazel"},
+		}, {
+			desc:        "eof",
+			input:       "y",
+			wantEmitted: []string{"a/BUILD.bazel", "unchanged/BUILD.bazel"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			c := config.New()
+			c.RepoRoot = t.TempDir()
+			var emitted []string
+			emit := func(c *config.Config, f *rule.File) error {
+				rel, _ := filepath.Rel(c.RepoRoot, f.Path)
+				emitted = append(emitted, filepath.ToSlash(rel))
+				return nil
+			}
+			var out strings.Builder
+			r := newInteractiveReviewer(emit, strings.NewReader(tc.input), &out)
+
+			for _, dir := range []string{"a", "b", "unchanged", "c"} {
+				f := rule.EmptyFile(filepath.Join(c.RepoRoot, dir, "BUILD.bazel"), dir)
+				if dir != "unchanged" {
+					rule.NewRule("filegroup", dir).Insert(f)
+				}
+				if err := r.emitFile(c, f); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if !reflect.DeepEqual(emitted, tc.wantEmitted) {
+				t.Errorf("got emitted files %q; want %q", emitted, tc.wantEmitted)
+			}
+			for _, want := range tc.wantOutput {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output doesn't contain %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
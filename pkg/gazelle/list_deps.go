@@ -0,0 +1,255 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// ListDeps runs the list-deps command. It indexes the repository like the
+// update command, then prints how each import path named in cfg.Args is
+// resolved to w, one "import<TAB>label" line per rule. With -reverse, the
+// arguments are labels, and the rules that depend on each label are printed
+// instead, one "label<TAB>dependent" line per rule. No files are written.
+//
+// cfg.Command is ignored. Flags of the update command may be used, except
+// for flags that write files.
+func ListDeps(ctx context.Context, cfg Config, langs []language.Language, w io.Writer) error {
+	cfg.Command = "update"
+	_, err := run(ctx, cfg, langs, make(map[string]*rule.File), &listDepsQuery{out: w})
+	return err
+}
+
+// listDepsQuery holds the arguments of the list-deps command. When it's
+// passed to runFixUpdate, the queries are answered after dependencies are
+// resolved, and build files aren't emitted.
+type listDepsQuery struct {
+	// reverse is set by -reverse. When true, args are labels, and rules
+	// depending on them are listed.
+	reverse bool
+
+	// args are the positional arguments: import paths, or labels with
+	// -reverse.
+	args []string
+
+	out io.Writer
+}
+
+func (q *listDepsQuery) registerFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&q.reverse, "reverse", false, "when true, arguments are labels, and rules that depend on them are listed instead of rules providing import paths")
+}
+
+func (q *listDepsQuery) setArgs(c *config.Config, args []string) ([]string, error) {
+	// The whole repository is indexed to answer list-deps queries.
+	if !c.IndexLibraries {
+		return nil, errors.New("list-deps requires -index")
+	}
+	q.args = args
+	return nil, nil
+}
+
+func (q *listDepsQuery) usage(fs *flag.FlagSet) {
+	listDepsUsage(fs)
+}
+
+// answer prints the results of q. Forward queries are answered by the
+// language resolvers, with # gazelle:resolve directives and other
+// configuration in the repository root. Reverse queries are answered by
+// searching the resolved rules in visited build files and the rules in other
+// indexed build files.
+func (q *listDepsQuery) answer(c *config.Config, langs []language.Language, ix *resolve.RuleIndex, rc *repo.RemoteCache, visits []visitRecord, indexedFiles []*rule.File) error {
+	if len(q.args) == 0 {
+		return errors.New("list-deps: at least one argument is required")
+	}
+	if q.reverse {
+		return q.listDependents(c, visits, indexedFiles)
+	}
+	return q.listProviders(c, langs, ix, rc)
+}
+
+// listProviders prints the labels each import path in q.args resolves to.
+// Languages that implement language.ImportResolver resolve imports the same
+// way as the imports of generated rules, so imports provided by external
+// repositories are found, and imports that need no dependency, like those
+// in the Go standard library, are printed with an empty label. Imports are
+// looked up in the index and # gazelle:resolve directives for other
+// languages.
+func (q *listDepsQuery) listProviders(c *config.Config, langs []language.Language, ix *resolve.RuleIndex, rc *repo.RemoteCache) error {
+	from := label.New("", "", "")
+	var missing []string
+	for _, imp := range q.args {
+		var labels []label.Label
+		seen := make(map[label.Label]bool)
+		add := func(l label.Label) {
+			if !seen[l] {
+				seen[l] = true
+				labels = append(labels, l)
+			}
+		}
+		noDep := false
+		for _, lang := range langs {
+			if ir, ok := lang.(language.ImportResolver); ok {
+				l, err := ir.ResolveImport(c, ix, rc, imp, from)
+				if err != nil {
+					continue
+				}
+				if l == label.NoLabel {
+					noDep = true
+				} else {
+					add(l)
+				}
+				continue
+			}
+			spec := resolve.ImportSpec{Lang: lang.Name(), Imp: imp}
+			if l, ok := resolve.FindRuleWithOverride(c, spec, lang.Name()); ok {
+				add(l)
+				continue
+			}
+			for _, r := range ix.FindRulesByImportWithConfig(c, spec, lang.Name()) {
+				add(r.Label)
+			}
+		}
+		if len(labels) == 0 && noDep {
+			fmt.Fprintf(q.out, "%s\t\n", imp)
+			continue
+		}
+		if len(labels) == 0 {
+			missing = append(missing, imp)
+			continue
+		}
+		for _, l := range labels {
+			fmt.Fprintf(q.out, "%s\t%s\n", imp, l.Rel(c.RepoName, ""))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("list-deps: no rules found for: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (q *listDepsQuery) listDependents(c *config.Config, visits []visitRecord, indexedFiles []*rule.File) error {
+	targets := make([]label.Label, len(q.args))
+	for i, arg := range q.args {
+		l, err := label.Parse(arg)
+		if err != nil {
+			return fmt.Errorf("list-deps: %v", err)
+		}
+		targets[i] = normalizeLabel(c.RepoName, l.Abs("", ""))
+	}
+
+	// Visited files have been merged with resolved rules, so they reflect
+	// the dependencies the update command would write.
+	files := make([]*rule.File, 0, len(visits)+len(indexedFiles))
+	for _, v := range visits {
+		files = append(files, v.file)
+	}
+	files = append(files, indexedFiles...)
+
+	dependents := make(map[label.Label][]string)
+	for _, f := range files {
+		for _, r := range f.Rules {
+			from := label.New("", f.Pkg, r.Name())
+			for _, l := range ruleReferences(c.RepoName, r, f.Pkg) {
+				dependents[l] = append(dependents[l], from.String())
+			}
+		}
+	}
+	for i, t := range targets {
+		deps := dependents[t]
+		sort.Strings(deps)
+		for j, d := range deps {
+			if j > 0 && deps[j-1] == d {
+				continue
+			}
+			fmt.Fprintf(q.out, "%s\t%s\n", q.args[i], d)
+		}
+	}
+	return nil
+}
+
+// ruleReferences returns the labels referenced by strings in r's attributes,
+// normalized with normalizeLabel. Strings that aren't labels are skipped.
+func ruleReferences(repoName string, r *rule.Rule, pkg string) []label.Label {
+	var refs []label.Label
+	for _, key := range r.AttrKeys() {
+		if key == "name" {
+			continue
+		}
+		bzl.Walk(r.Attr(key), func(e bzl.Expr, _ []bzl.Expr) {
+			s, ok := e.(*bzl.StringExpr)
+			if !ok {
+				return
+			}
+			l, err := label.Parse(s.Value)
+			if err != nil {
+				return
+			}
+			refs = append(refs, normalizeLabel(repoName, l.Abs("", pkg)))
+		})
+	}
+	return refs
+}
+
+// normalizeLabel returns l with references to the main repository, written
+// with its name or as "@", changed to labels without a repository, so they
+// can be compared.
+func normalizeLabel(repoName string, l label.Label) label.Label {
+	if l.Repo == "@" || (repoName != "" && l.Repo == repoName) {
+		l.Repo = ""
+	}
+	l.Canonical = false
+	return l
+}
+
+func listDepsUsage(fs *flag.FlagSet) {
+	fmt.Fprint(os.Stderr, `usage: gazelle list-deps [flags...] import-path...
+       gazelle list-deps -reverse [flags...] label...
+
+The list-deps command indexes the repository like the update command and
+prints how each import path is resolved, one line per rule, with the import
+path and the label separated by a tab. Imports are resolved the same way as
+the imports of generated rules, with the configuration of the repository
+root, so rules in external repositories are listed too. Imports that need no
+rule, like those in the Go standard library, are printed with an empty label.
+The command fails if no rule is found for an import path.
+
+With -reverse, the arguments are labels, and the rules that depend on each
+label after dependencies are resolved are printed instead, with the label and
+the dependent rule separated by a tab.
+
+No build files are written. Flags of the update command that write files,
+like -patch_file and -report, can't be used.
+
+FLAGS:
+
+`)
+	fs.PrintDefaults()
+}
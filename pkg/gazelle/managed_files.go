@@ -0,0 +1,51 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// managedFiles returns the slash-separated paths, relative to the repository
+// root, of the build files Gazelle manages in the directories in visits.
+// These are the build files in updated directories, other than new files
+// with nothing in them, which aren't written. Paths are sorted.
+func managedFiles(visits []visitRecord) []string {
+	var paths []string
+	for _, v := range visits {
+		if v.newFile && len(v.file.Format()) == 0 {
+			continue
+		}
+		paths = append(paths, path.Join(v.pkgRel, filepath.Base(v.file.Path)))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// writeManagedFiles writes the paths returned by managedFiles to the file
+// at outPath, one per line. This is used by -managed_files_out.
+func writeManagedFiles(outPath string, visits []visitRecord) error {
+	var sb strings.Builder
+	for _, p := range managedFiles(visits) {
+		sb.WriteString(p)
+		sb.WriteByte('\n')
+	}
+	return os.WriteFile(outPath, []byte(sb.String()), 0o666)
+}
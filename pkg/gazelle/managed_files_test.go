@@ -0,0 +1,57 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	golang "github.com/bazelbuild/bazel-gazelle/language/go"
+	"github.com/bazelbuild/bazel-gazelle/language/proto"
+	"github.com/bazelbuild/bazel-gazelle/testtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestManagedFilesOut(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{Path: "BUILD.bazel", Content: "# gazelle:prefix example.com/m\n"},
+		{Path: "new/new.go", Content: "package new"},
+		{Path: "existing/BUILD", Content: `filegroup(name = "data")`},
+		{Path: "ignored/BUILD.bazel", Content: "# gazelle:ignore\n"},
+		{Path: "empty/README.md"},
+	})
+	defer cleanup()
+	langs := []language.Language{proto.NewLanguage(), golang.NewLanguage()}
+
+	// Files that would be created are listed, even when they're not written.
+	args := []string{"-mode=diff", "-managed_files_out=managed.txt"}
+	if _, err := Run(context.Background(), Config{WorkDir: dir, Args: args}, langs); !errors.Is(err, ErrDiffChanges) {
+		t.Fatalf("got error %v; want ErrDiffChanges", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "managed.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "BUILD.bazel\nexisting/BUILD\nnew/BUILD.bazel\n"
+	if diff := cmp.Diff(want, string(data)); diff != "" {
+		t.Errorf("managed files (-want,+got):\n%s", diff)
+	}
+}
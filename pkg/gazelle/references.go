@@ -0,0 +1,159 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"log"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/merger"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/bazelbuild/buildtools/tables"
+)
+
+// ruleChanges records rules that were renamed or deleted in the build files
+// being updated. Labels are keyed without a repository name.
+type ruleChanges struct {
+	renamed map[label.Label]label.Label
+	deleted map[label.Label]bool
+}
+
+// findRuleChanges compares the rules in each visited build file with the
+// rules the file had before it was updated. A rule that's no longer in the
+// file was renamed if it matches a new rule, the same way generated rules
+// are matched with existing rules when they're merged. Otherwise, it was
+// deleted. Files are only parsed again if some of their rules are missing.
+func findRuleChanges(visits []visitRecord, kinds map[string]rule.KindInfo) ruleChanges {
+	changes := ruleChanges{
+		renamed: make(map[label.Label]label.Label),
+		deleted: make(map[label.Label]bool),
+	}
+	for _, v := range visits {
+		newNames := make(map[string]bool)
+		for _, r := range v.file.Rules {
+			newNames[r.Name()] = true
+		}
+		missing := false
+		for _, name := range v.oldRuleNames {
+			if !newNames[name] {
+				missing = true
+				break
+			}
+		}
+		if !missing {
+			continue
+		}
+
+		old, err := rule.LoadData(v.file.Path, v.pkgRel, v.file.Content)
+		if err != nil {
+			// The file was parsed before, so this shouldn't happen.
+			log.Printf("%s: %v", v.file.Path, err)
+			continue
+		}
+		oldNames := make(map[string]bool)
+		for _, r := range old.Rules {
+			oldNames[r.Name()] = true
+		}
+		var added []*rule.Rule
+		for _, r := range v.file.Rules {
+			if !oldNames[r.Name()] {
+				added = append(added, r)
+			}
+		}
+		for _, r := range old.Rules {
+			if r.Name() == "" || newNames[r.Name()] {
+				continue
+			}
+			from := label.New("", v.pkgRel, r.Name())
+			if to, err := merger.Match(added, r, kinds[r.Kind()]); err == nil && to != nil {
+				changes.renamed[from] = label.New("", v.pkgRel, to.Name())
+			} else {
+				changes.deleted[from] = true
+			}
+		}
+	}
+	return changes
+}
+
+// fixReferences updates labels in attributes of rules in the visited build
+// files that refer to renamed rules. Rules of kinds Gazelle doesn't know
+// about, like hand-written macros, don't have their dependencies resolved,
+// so they'd refer to the old names otherwise. References in others, build
+// files that aren't being updated, and references to deleted rules are
+// logged instead.
+func (changes ruleChanges) fixReferences(repoName string, visits []visitRecord, others []*rule.File) {
+	if len(changes.renamed) == 0 && len(changes.deleted) == 0 {
+		return
+	}
+	for _, v := range visits {
+		changes.fixFileReferences(repoName, v.file, true)
+	}
+	for _, f := range others {
+		changes.fixFileReferences(repoName, f, false)
+	}
+}
+
+// fixFileReferences updates or logs references in f to renamed and deleted
+// rules. Since the kinds of rules aren't known, a string is only treated as
+// a label if the attribute usually holds labels, like deps, or the string is
+// written with explicit label syntax, like ":name" or "//pkg:name". Other
+// strings, like tags, may happen to match the name of a rule.
+func (changes ruleChanges) fixFileReferences(repoName string, f *rule.File, update bool) {
+	for _, r := range f.Rules {
+		for _, key := range r.AttrKeys() {
+			if key == "name" {
+				continue
+			}
+			value := r.Attr(key)
+			labelAttr := tables.IsLabelArg[key]
+			changed := false
+			bzl.Walk(value, func(e bzl.Expr, _ []bzl.Expr) {
+				s, ok := e.(*bzl.StringExpr)
+				if !ok || !labelAttr && !hasLabelSyntax(s.Value) {
+					return
+				}
+				l, err := label.Parse(s.Value)
+				if err != nil || (l.Repo != "" && l.Repo != "@" && l.Repo != repoName) {
+					return
+				}
+				l = l.Abs("", f.Pkg)
+				from := label.New("", l.Pkg, l.Name)
+				if to, ok := changes.renamed[from]; ok {
+					if !update {
+						log.Printf("%s: %s in %s refers to %s, which was renamed to %s", f.Path, key, r.Name(), s.Value, to)
+						return
+					}
+					s.Value = to.Rel("", f.Pkg).String()
+					changed = true
+				} else if changes.deleted[from] {
+					log.Printf("%s: %s in %s refers to %s, which was deleted", f.Path, key, r.Name(), s.Value)
+				}
+			})
+			if changed {
+				// Set the attribute again, so its labels are sorted.
+				r.SetAttr(key, value)
+			}
+		}
+	}
+}
+
+// hasLabelSyntax returns whether s is written like a label rather than a
+// plain name, which could be any string.
+func hasLabelSyntax(s string) bool {
+	return strings.HasPrefix(s, ":") || strings.HasPrefix(s, "//") || strings.HasPrefix(s, "@")
+}
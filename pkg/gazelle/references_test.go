@@ -0,0 +1,152 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	golang "github.com/bazelbuild/bazel-gazelle/language/go"
+	"github.com/bazelbuild/bazel-gazelle/language/proto"
+	"github.com/bazelbuild/bazel-gazelle/testtools"
+)
+
+func TestFixReferencesToRenamedRules(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{
+			Path: "BUILD.bazel",
+			Content: `# gazelle:prefix example.com/m
+# gazelle:go_naming_convention import
+`,
+		},
+		{Path: "lib/lib.go", Content: "package lib"},
+		{
+			Path: "lib/BUILD.bazel",
+			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("//tools:macro.bzl", "my_macro")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["lib.go"],
+    importpath = "example.com/m/lib",
+    visibility = ["//visibility:public"],
+)
+
+my_macro(
+    name = "same_package",
+    deps = [":go_default_library"],
+)
+
+my_macro(
+    name = "not_labels",
+    label = ":go_default_library",
+    suffix = "go_default_library",
+    tags = ["go_default_library"],
+)
+`,
+		},
+		{
+			Path: "other/BUILD.bazel",
+			Content: `load("//tools:macro.bzl", "my_macro")
+
+my_macro(
+    name = "other",
+    deps = ["//lib:go_default_library"],
+)
+`,
+		},
+		{
+			Path: "ignored/BUILD.bazel",
+			Content: `# gazelle:ignore
+
+load("//tools:macro.bzl", "my_macro")
+
+my_macro(
+    name = "ignored",
+    deps = ["//lib:go_default_library"],
+)
+`,
+		},
+	})
+	defer cleanup()
+	langs := []language.Language{proto.NewLanguage(), golang.NewLanguage()}
+
+	res, err := Run(context.Background(), Config{Command: "fix", WorkDir: dir}, langs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testtools.CheckFiles(t, dir, []testtools.FileSpec{
+		{
+			Path: "lib/BUILD.bazel",
+			Content: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+load("//tools:macro.bzl", "my_macro")
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/m/lib",
+    visibility = ["//visibility:public"],
+)
+
+my_macro(
+    name = "same_package",
+    deps = [":lib"],
+)
+
+my_macro(
+    name = "not_labels",
+    label = ":lib",
+    suffix = "go_default_library",
+    tags = ["go_default_library"],
+)
+`,
+		}, {
+			Path: "other/BUILD.bazel",
+			Content: `load("//tools:macro.bzl", "my_macro")
+
+my_macro(
+    name = "other",
+    deps = ["//lib"],
+)
+`,
+		}, {
+			Path: "ignored/BUILD.bazel",
+			Content: `# gazelle:ignore
+
+load("//tools:macro.bzl", "my_macro")
+
+my_macro(
+    name = "ignored",
+    deps = ["//lib:go_default_library"],
+)
+`,
+		},
+	})
+
+	var found bool
+	for _, d := range res.Diagnostics {
+		if strings.Contains(d, "refers to //lib:go_default_library, which was renamed to //lib") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("got diagnostics %q; want one about a reference to a renamed rule in an ignored file", res.Diagnostics)
+	}
+}
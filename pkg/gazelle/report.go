@@ -0,0 +1,231 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// changeReport collects the changes Gazelle made in each directory for
+// -report, so large migrations can be reviewed directory by directory.
+type changeReport struct {
+	dirs map[string]*reportDir
+}
+
+// reportDir describes the changes in one directory. Rules are described by
+// kind and name, for example, `go_library "foo"`.
+type reportDir struct {
+	Rel                       string
+	Created, Updated, Deleted []string
+
+	// Unresolved holds the messages logged by resolvers for rules in the
+	// directory, usually about imports that couldn't be resolved. Messages
+	// logged while merging or by other phases aren't included.
+	Unresolved []string
+
+	// Directives lists the directives written in the directory's build file.
+	// Directives inherited from parent directories aren't included.
+	Directives []string
+}
+
+func newChangeReport() *changeReport {
+	return &changeReport{dirs: make(map[string]*reportDir)}
+}
+
+func (r *changeReport) dir(rel string) *reportDir {
+	d, ok := r.dirs[rel]
+	if !ok {
+		d = &reportDir{Rel: rel}
+		r.dirs[rel] = d
+	}
+	return d
+}
+
+// addUnresolved records messages logged by a resolver for a rule in the
+// directory rel.
+func (r *changeReport) addUnresolved(rel string, msgs []string) {
+	if len(msgs) > 0 {
+		d := r.dir(rel)
+		d.Unresolved = append(d.Unresolved, msgs...)
+	}
+}
+
+// addFile records the rules created, updated, and deleted in f by comparing
+// the content f was loaded with to its current content. It must be called
+// before f is emitted, since emitting may replace f.Content.
+func (r *changeReport) addFile(rel string, f *rule.File) error {
+	oldRules, err := formatRules(f.Path, f.Content)
+	if err != nil {
+		return err
+	}
+	newRules, err := formatRules(f.Path, f.Format())
+	if err != nil {
+		return err
+	}
+	d := r.dir(rel)
+	for key, text := range newRules {
+		if oldText, ok := oldRules[key]; !ok {
+			d.Created = append(d.Created, key)
+		} else if oldText != text {
+			d.Updated = append(d.Updated, key)
+		}
+	}
+	for key := range oldRules {
+		if _, ok := newRules[key]; !ok {
+			d.Deleted = append(d.Deleted, key)
+		}
+	}
+	sort.Strings(d.Created)
+	sort.Strings(d.Updated)
+	sort.Strings(d.Deleted)
+	for _, dir := range f.Directives {
+		d.Directives = append(d.Directives, strings.TrimSpace(fmt.Sprintf("gazelle:%s %s", dir.Key, dir.Value)))
+	}
+	return nil
+}
+
+// formatRules parses a build file and returns the formatted text of each
+// rule, keyed by its kind and name.
+func formatRules(path string, content []byte) (map[string]string, error) {
+	rules := make(map[string]string)
+	if len(content) == 0 {
+		return rules, nil
+	}
+	f, err := bzl.ParseBuild(path, content)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range f.Stmt {
+		call, ok := stmt.(*bzl.CallExpr)
+		if !ok {
+			continue
+		}
+		key := bzl.FormatString(call.X)
+		for _, arg := range call.List {
+			if assign, ok := arg.(*bzl.AssignExpr); ok {
+				if lhs, ok := assign.LHS.(*bzl.Ident); ok && lhs.Name == "name" {
+					if name, ok := assign.RHS.(*bzl.StringExpr); ok {
+						key = fmt.Sprintf("%s %q", key, name.Value)
+					}
+				}
+			}
+		}
+		rules[key] = bzl.FormatString(call)
+	}
+	return rules, nil
+}
+
+// sortedDirs returns the directories with something to report, sorted by
+// path.
+func (r *changeReport) sortedDirs() []*reportDir {
+	var dirs []*reportDir
+	for _, d := range r.dirs {
+		if len(d.Created)+len(d.Updated)+len(d.Deleted)+len(d.Unresolved)+len(d.Directives) > 0 {
+			dirs = append(dirs, d)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].Rel < dirs[j].Rel })
+	return dirs
+}
+
+// write writes the report to path. The report is formatted as HTML if path
+// ends with ".html" or ".htm", and as Markdown otherwise.
+func (r *changeReport) write(path string) error {
+	buf := &bytes.Buffer{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		if err := htmlReportTemplate.Execute(buf, r.sortedDirs()); err != nil {
+			return err
+		}
+	default:
+		r.writeMarkdown(buf)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o666)
+}
+
+func (r *changeReport) writeMarkdown(buf *bytes.Buffer) {
+	buf.WriteString("# Gazelle report\n")
+	dirs := r.sortedDirs()
+	if len(dirs) == 0 {
+		buf.WriteString("\nNo changes.\n")
+	}
+	for _, d := range dirs {
+		fmt.Fprintf(buf, "\n## `//%s`\n", d.Rel)
+		for _, section := range []struct {
+			title string
+			items []string
+		}{
+			{"Created rules", d.Created},
+			{"Updated rules", d.Updated},
+			{"Deleted rules", d.Deleted},
+			{"Unresolved imports", d.Unresolved},
+			{"Directives in this build file", d.Directives},
+		} {
+			if len(section.items) == 0 {
+				continue
+			}
+			fmt.Fprintf(buf, "\n%s:\n\n", section.title)
+			for _, item := range section.items {
+				fmt.Fprintf(buf, "- `%s`\n", item)
+			}
+		}
+	}
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"sectionArgs": func(title string, items []string) interface{} {
+		return struct {
+			Title string
+			Items []string
+		}{title, items}
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Gazelle report</title></head>
+<body>
+<h1>Gazelle report</h1>
+{{- range .}}
+<h2><code>//{{.Rel}}</code></h2>
+{{- template "section" (sectionArgs "Created rules" .Created)}}
+{{- template "section" (sectionArgs "Updated rules" .Updated)}}
+{{- template "section" (sectionArgs "Deleted rules" .Deleted)}}
+{{- template "section" (sectionArgs "Unresolved imports" .Unresolved)}}
+{{- template "section" (sectionArgs "Directives in this build file" .Directives)}}
+{{- else}}
+<p>No changes.</p>
+{{- end}}
+</body>
+</html>
+{{define "section"}}{{if .Items}}
+<h3>{{.Title}}</h3>
+<ul>
+{{- range .Items}}
+<li><code>{{.}}</code></li>
+{{- end}}
+</ul>{{end}}{{end}}
+`))
@@ -0,0 +1,140 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/bazelbuild/bazel-gazelle/testtools"
+	"github.com/google/go-cmp/cmp"
+)
+
+// reportLang generates a fake_rule for each directory with a fake.txt file
+// and logs that its import can't be resolved. It sets deps on the rule, so
+// an existing deps expression that can't be merged is logged after resolving.
+type reportLang struct {
+	language.BaseLang
+}
+
+func (*reportLang) Name() string { return "report" }
+
+func (*reportLang) Kinds() map[string]rule.KindInfo {
+	return map[string]rule.KindInfo{
+		"fake_rule": {
+			NonEmptyAttrs:  map[string]bool{"srcs": true},
+			MergeableAttrs: map[string]bool{"srcs": true},
+			ResolveAttrs:   map[string]bool{"deps": true},
+		},
+	}
+}
+
+func (*reportLang) GenerateRules(args language.GenerateArgs) language.GenerateResult {
+	res := language.GenerateResult{Empty: []*rule.Rule{rule.NewRule("fake_rule", "old")}}
+	for _, name := range args.RegularFiles {
+		if name == "fake.txt" {
+			r := rule.NewRule("fake_rule", "fake")
+			r.SetAttr("srcs", []string{name})
+			res.Gen = append(res.Gen, r)
+			res.Imports = append(res.Imports, "example.com/missing")
+		}
+	}
+	return res
+}
+
+func (*reportLang) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, imports interface{}, from label.Label) {
+	log.Printf("%s: could not resolve import %q", from, imports)
+	r.SetAttr("deps", []string{"//:dep"})
+}
+
+func TestReport(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "WORKSPACE"},
+		{Path: "BUILD.bazel", Content: "# gazelle:exclude docs\n"},
+		{Path: "a/fake.txt"},
+		{Path: "b/BUILD.bazel", Content: `fake_rule(name = "old")`},
+		{Path: "c/fake.txt"},
+		{Path: "c/BUILD.bazel", Content: `
+fake_rule(
+    name = "fake",
+    srcs = ["old.txt"],
+    deps = [":a"] + my_deps(),
+)
+`},
+		{Path: "d/fake.txt"},
+	})
+	defer cleanup()
+	langs := []language.Language{&reportLang{}}
+
+	for _, tc := range []struct {
+		name string
+		want func(t *testing.T, got string)
+	}{
+		{
+			name: "report.md",
+			want: func(t *testing.T, got string) {
+				want := "# Gazelle report\n" +
+					"\n## `//`\n\nDirectives in this build file:\n\n- `gazelle:exclude docs`\n" +
+					"\n## `//a`\n\nCreated rules:\n\n- `fake_rule \"fake\"`\n" +
+					"\nUnresolved imports:\n\n- `//a:fake: could not resolve import \"example.com/missing\"`\n" +
+					"\n## `//b`\n\nDeleted rules:\n\n- `fake_rule \"old\"`\n" +
+					"\n## `//c`\n\nUpdated rules:\n\n- `fake_rule \"fake\"`\n" +
+					"\nUnresolved imports:\n\n- `//c:fake: could not resolve import \"example.com/missing\"`\n" +
+					"\n## `//d`\n\nCreated rules:\n\n- `fake_rule \"fake\"`\n" +
+					"\nUnresolved imports:\n\n- `//d:fake: could not resolve import \"example.com/missing\"`\n"
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Errorf("report (-want,+got):\n%s", diff)
+				}
+			},
+		}, {
+			name: "report.html",
+			want: func(t *testing.T, got string) {
+				for _, want := range []string{
+					"<h2><code>//a</code></h2>\n<h3>Created rules</h3>\n<ul>\n<li><code>fake_rule &#34;fake&#34;</code></li>\n</ul>",
+					"<h2><code>//b</code></h2>\n<h3>Deleted rules</h3>",
+				} {
+					if !strings.Contains(got, want) {
+						t.Errorf("report doesn't contain %q:\n%s", want, got)
+					}
+				}
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			reportPath := filepath.Join(tmp, tc.name)
+			args := []string{"-mode=diff", "-patch_file=" + filepath.Join(tmp, "patch"), "-report=" + reportPath}
+			if _, err := Run(context.Background(), Config{WorkDir: dir, Args: args}, langs); err != ErrDiffChanges {
+				t.Fatalf("got error %v; want ErrDiffChanges", err)
+			}
+			got, err := os.ReadFile(reportPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.want(t, string(got))
+		})
+	}
+}
@@ -0,0 +1,201 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/pathtools"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// extensionPanic describes a panic in a hook of a language extension.
+type extensionPanic struct {
+	lang, hook string
+
+	// rel is the directory the hook was called for. It's only meaningful
+	// if inDir is true.
+	rel   string
+	inDir bool
+
+	value interface{}
+	stack []byte
+}
+
+func (e *extensionPanic) Error() string {
+	where := ""
+	if e.inDir {
+		where = fmt.Sprintf(" in directory %q", e.rel)
+	}
+	return fmt.Sprintf("language %q panicked in %s%s: %v\n%s", e.lang, e.hook, where, e.value, e.stack)
+}
+
+// extensionSandbox recovers from panics in the hooks of language extensions,
+// so a bug in one extension is reported with the language, hook and
+// directory it happened in, instead of crashing Gazelle.
+//
+// Without -keep_going, the run stops after the first panic, and no build
+// files are written. With -keep_going, each panic is logged, and other
+// directories and languages are processed. Build files in directories where
+// a panic happened aren't changed.
+type extensionSandbox struct {
+	keepGoing bool
+
+	// mu guards the fields below, since Resolve may be called concurrently.
+	mu     sync.Mutex
+	panics []*extensionPanic
+
+	// failedDirs are the directories where a hook panicked.
+	failedDirs map[string]bool
+
+	// failedConfigDirs are the directories where Configure panicked. Their
+	// subdirectories inherit a configuration that may be incomplete, so
+	// they're skipped, too.
+	failedConfigDirs []string
+}
+
+func newExtensionSandbox() *extensionSandbox {
+	return &extensionSandbox{failedDirs: make(map[string]bool)}
+}
+
+// call calls f, the hook named hook of the language lang, which isn't called
+// for a particular directory. It returns false if f panicked.
+func (s *extensionSandbox) call(lang, hook string, f func()) bool {
+	return s.run(lang, hook, "", false, f)
+}
+
+// callDir calls f, the hook named hook of the language lang, for the
+// directory rel. It returns false if f panicked, and the directory isn't
+// updated after that.
+func (s *extensionSandbox) callDir(lang, hook, rel string, f func()) bool {
+	return s.run(lang, hook, rel, true, f)
+}
+
+func (s *extensionSandbox) run(lang, hook, rel string, inDir bool, f func()) (ok bool) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		ok = false
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, p := range s.panics {
+			if p.lang == lang && p.hook == hook && p.rel == rel && p.inDir == inDir {
+				// Configure is called again for parent directories when
+				// their configuration is rebuilt.
+				return
+			}
+		}
+		p := &extensionPanic{lang: lang, hook: hook, rel: rel, inDir: inDir, value: v, stack: debug.Stack()}
+		s.panics = append(s.panics, p)
+		if inDir {
+			s.failedDirs[rel] = true
+			if hook == "Configure" {
+				s.failedConfigDirs = append(s.failedConfigDirs, rel)
+			}
+		}
+		if s.keepGoing {
+			log.Print(p)
+		}
+	}()
+	f()
+	return true
+}
+
+// stopped returns whether the run should stop because a hook panicked and
+// -keep_going isn't set.
+func (s *extensionSandbox) stopped() bool {
+	return !s.keepGoing && len(s.panics) > 0
+}
+
+// skipDir returns whether the directory rel shouldn't be updated because a
+// hook panicked in it or Configure panicked in a parent directory.
+func (s *extensionSandbox) skipDir(rel string) bool {
+	if s.stopped() || s.failedDirs[rel] {
+		return true
+	}
+	for _, dir := range s.failedConfigDirs {
+		if pathtools.HasPrefix(rel, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// err returns an error describing the panics, or nil if there were none.
+func (s *extensionSandbox) err() error {
+	if len(s.panics) == 0 {
+		return nil
+	}
+	if !s.keepGoing {
+		return fmt.Errorf("%v\nNo build files were written. Run with -keep_going to update other directories", s.panics[0])
+	}
+	var dirs []string
+	for rel := range s.failedDirs {
+		if rel == "" {
+			rel = "."
+		}
+		dirs = append(dirs, rel)
+	}
+	sort.Strings(dirs)
+	if len(dirs) == 0 {
+		return fmt.Errorf("language extensions panicked %d times", len(s.panics))
+	}
+	return fmt.Errorf("language extensions panicked %d times, so build files in these directories weren't changed: %s", len(s.panics), strings.Join(dirs, ", "))
+}
+
+// filterVisits returns the visits of directories that should still be
+// updated. visits is modified in place.
+func (s *extensionSandbox) filterVisits(visits []visitRecord) []visitRecord {
+	if len(s.panics) == 0 {
+		return visits
+	}
+	kept := visits[:0]
+	for _, v := range visits {
+		if !s.skipDir(v.pkgRel) {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// sandboxedConfigurer calls Configure on a language extension through an
+// extensionSandbox.
+type sandboxedConfigurer struct {
+	config.Configurer
+	name string
+	s    *extensionSandbox
+}
+
+func (sc *sandboxedConfigurer) Configure(c *config.Config, rel string, f *rule.File) {
+	sc.s.callDir(sc.name, "Configure", rel, func() {
+		sc.Configurer.Configure(c, rel, f)
+	})
+}
+
+func (sc *sandboxedConfigurer) Directives() []config.DirectiveInfo {
+	if dd, ok := sc.Configurer.(config.DirectiveDeclarer); ok {
+		return dd.Directives()
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/bazelbuild/bazel-gazelle/testtools"
+)
+
+// panicLang generates a fake_rule for each directory with a fake.txt file,
+// and panics in directories with a panic.txt file.
+type panicLang struct {
+	language.BaseLang
+}
+
+func (*panicLang) Name() string { return "panicky" }
+
+func (*panicLang) Kinds() map[string]rule.KindInfo {
+	return map[string]rule.KindInfo{
+		"fake_rule": {
+			NonEmptyAttrs:  map[string]bool{"srcs": true},
+			MergeableAttrs: map[string]bool{"srcs": true},
+		},
+	}
+}
+
+func (*panicLang) GenerateRules(args language.GenerateArgs) language.GenerateResult {
+	var res language.GenerateResult
+	for _, name := range args.RegularFiles {
+		switch name {
+		case "panic.txt":
+			panic("boom")
+		case "fake.txt":
+			r := rule.NewRule("fake_rule", "fake")
+			r.SetAttr("srcs", []string{name})
+			res.Gen = append(res.Gen, r)
+			res.Imports = append(res.Imports, nil)
+		}
+	}
+	return res
+}
+
+func TestExtensionPanic(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		args      []string
+		wantErr   []string
+		wantFiles map[string]bool
+	}{
+		{
+			name: "stop",
+			wantErr: []string{
+				`language "panicky" panicked in GenerateRules in directory "b": boom`,
+				"No build files were written. Run with -keep_going",
+			},
+			wantFiles: map[string]bool{"a/BUILD.bazel": false, "c/BUILD.bazel": false},
+		}, {
+			name:      "keep_going",
+			args:      []string{"-keep_going"},
+			wantErr:   []string{"build files in these directories weren't changed: b"},
+			wantFiles: map[string]bool{"a/BUILD.bazel": true, "c/BUILD.bazel": true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+				{Path: "WORKSPACE"},
+				{Path: "a/fake.txt"},
+				{Path: "b/fake.txt"},
+				{Path: "b/panic.txt"},
+				{Path: "c/fake.txt"},
+			})
+			defer cleanup()
+
+			_, err := Run(context.Background(), Config{WorkDir: dir, Args: tc.args}, []language.Language{&panicLang{}})
+			if err == nil {
+				t.Fatal("got success; want error")
+			}
+			for _, want := range tc.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error doesn't contain %q:\n%v", want, err)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(dir, "b", "BUILD.bazel")); !os.IsNotExist(err) {
+				t.Errorf("b/BUILD.bazel was written: %v", err)
+			}
+			for path, want := range tc.wantFiles {
+				_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path)))
+				if got := err == nil; got != want {
+					t.Errorf("%s written: got %v, want %v", path, got, want)
+				}
+			}
+		})
+	}
+}
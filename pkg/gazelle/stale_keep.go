@@ -0,0 +1,168 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/bazelbuild/buildtools/tables"
+)
+
+// checkStaleKeeps looks for strings marked with # keep comments in the
+// label-valued list attributes of rules in visited build files, like srcs and
+// deps, that refer to files or targets in the main repository that don't
+// exist. Other attributes, like tags and copts, hold strings that aren't
+// labels, so they aren't checked. Gazelle never removes kept strings, so
+// without this check they're left behind after the files or targets are
+// deleted.
+//
+// With the fix command, stale strings are removed, and each removal is
+// logged. Otherwise, a message is returned for each one. Labels in other
+// repositories, and labels in packages whose build files weren't loaded
+// during this run, aren't checked unless their directory doesn't exist.
+//
+// Packages that call loaded macros or rules of kinds not in kinds may declare
+// targets that don't appear in the build file. Missing targets in these
+// packages are only logged as warnings; they're never removed or returned.
+func checkStaleKeeps(visits []visitRecord, indexedFiles []*rule.File, kinds map[string]rule.KindInfo) []string {
+	targets := make(map[string]map[string]bool)
+	unknownKinds := make(map[string]bool)
+	addTargets := func(f *rule.File) {
+		names := make(map[string]bool)
+		loaded := make(map[string]bool)
+		for _, l := range f.Loads {
+			for _, sym := range l.Symbols() {
+				loaded[sym] = true
+			}
+		}
+		for _, r := range f.Rules {
+			names[r.Name()] = true
+			// Files generated by rules, like genrule outputs, may be referred
+			// to by name, too.
+			for _, s := range append(r.AttrStrings("outs"), r.AttrString("out")) {
+				if s != "" {
+					names[s] = true
+				}
+			}
+			if _, ok := kinds[r.Kind()]; !ok && loaded[r.Kind()] {
+				unknownKinds[f.Pkg] = true
+			}
+		}
+		targets[f.Pkg] = names
+	}
+	for _, v := range visits {
+		addTargets(v.file)
+	}
+	for _, f := range indexedFiles {
+		addTargets(f)
+	}
+
+	var msgs []string
+	for _, v := range visits {
+		c := v.c
+		for _, r := range v.file.Rules {
+			for _, key := range r.AttrKeys() {
+				if !tables.IsLabelArg[key] || nonTargetLabelAttrs[key] {
+					continue
+				}
+				removed := false
+				bzl.Walk(r.Attr(key), func(e bzl.Expr, _ []bzl.Expr) {
+					list, ok := e.(*bzl.ListExpr)
+					if !ok {
+						return
+					}
+					kept := list.List[:0]
+					for _, elem := range list.List {
+						s, ok := elem.(*bzl.StringExpr)
+						if !ok || !rule.ShouldKeep(elem) {
+							kept = append(kept, elem)
+							continue
+						}
+						exists, pkg := targetExists(c, targets, v.pkgRel, s.Value)
+						if exists {
+							kept = append(kept, elem)
+							continue
+						}
+						if unknownKinds[pkg] {
+							log.Printf("%s: %q in %s of %s %q is marked # keep, but no such file or target is declared in the build file. It may be declared by a macro, so it's not removed", v.file.Path, s.Value, key, r.Kind(), r.Name())
+							kept = append(kept, elem)
+							continue
+						}
+						if c.ShouldFix {
+							log.Printf("%s: removed %q from %s of %s %q: it's marked # keep, but no such file or target exists", v.file.Path, s.Value, key, r.Kind(), r.Name())
+							removed = true
+							continue
+						}
+						msgs = append(msgs, fmt.Sprintf("%s: %q in %s of %s %q is marked # keep, but no such file or target exists", v.file.Path, s.Value, key, r.Kind(), r.Name()))
+						kept = append(kept, elem)
+					}
+					list.List = kept
+				})
+				if removed {
+					// Mark the attribute as changed, so the rule is formatted
+					// again.
+					r.SetAttr(key, r.Attr(key))
+				}
+			}
+		}
+	}
+	return msgs
+}
+
+// nonTargetLabelAttrs are attributes buildtools treats as label-valued whose
+// strings don't name files or targets: package specifications in visibility,
+// and include directories in includes.
+var nonTargetLabelAttrs = map[string]bool{
+	"default_visibility": true,
+	"includes":           true,
+	"visibility":         true,
+}
+
+// targetExists returns whether s, a string in an attribute of a rule in the
+// package pkg, refers to an existing file or target, and the package of the
+// label. Strings that aren't labels in the main repository are assumed to
+// exist.
+func targetExists(c *config.Config, targets map[string]map[string]bool, pkg, s string) (bool, string) {
+	l, err := label.Parse(s)
+	if err != nil {
+		return true, ""
+	}
+	if l.Repo != "" && l.Repo != "@" && l.Repo != c.RepoName {
+		return true, ""
+	}
+	l = l.Abs("", pkg)
+	if names, ok := targets[l.Pkg]; ok && names[l.Name] {
+		return true, l.Pkg
+	}
+	dir := filepath.Join(c.RepoRoot, filepath.FromSlash(l.Pkg))
+	if _, err := os.Stat(dir); err != nil {
+		return false, l.Pkg
+	}
+	if _, ok := targets[l.Pkg]; !ok {
+		// The package's build file wasn't loaded, so its targets aren't
+		// known.
+		return true, l.Pkg
+	}
+	_, err = os.Stat(filepath.Join(dir, filepath.FromSlash(l.Name)))
+	return err == nil, l.Pkg
+}
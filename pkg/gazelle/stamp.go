@@ -0,0 +1,121 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// stampDirective is the directive used to record the stamp written by
+// -stamp. It's recognized so that stamped files don't produce unknown
+// directive warnings.
+const stampDirective = "stamp"
+
+const stampPrefix = "# gazelle:" + stampDirective
+
+// stampFile replaces any stamp comment in f with a new one at the top of the
+// file, after the file's leading comment block, if it has one. The stamp is
+// a hash of the formatted content of f without the stamp, followed by the
+// names and contents of regularFiles in dir, other than build files. A CI
+// check can recompute the hash to detect build files that are out of date
+// with their sources or were edited by hand.
+func stampFile(c *config.Config, f *rule.File, dir string, regularFiles []string) error {
+	// Sync pending edits first so statement indices don't need to account for
+	// the comments added or removed below.
+	f.Sync()
+	removeStamp(f)
+	hash, err := computeStamp(c, f.Format(), dir, regularFiles)
+	if err != nil {
+		return err
+	}
+	stamp := &bzl.CommentBlock{Comments: bzl.Comments{After: []bzl.Comment{{Token: stampPrefix + " " + hash}}}}
+	// Keep a leading comment block, like a license header, at the top.
+	i := 0
+	if len(f.File.Stmt) > 0 {
+		if _, ok := f.File.Stmt[0].(*bzl.CommentBlock); ok {
+			i = 1
+		}
+	}
+	stmts := make([]bzl.Expr, 0, len(f.File.Stmt)+1)
+	stmts = append(stmts, f.File.Stmt[:i]...)
+	stmts = append(stmts, stamp)
+	f.File.Stmt = append(stmts, f.File.Stmt[i:]...)
+	return nil
+}
+
+// removeStamp deletes stamp comments from the top-level statements of f.
+func removeStamp(f *rule.File) {
+	stmts := f.File.Stmt[:0]
+	for _, stmt := range f.File.Stmt {
+		comments := stmt.Comment()
+		comments.Before = filterStampComments(comments.Before)
+		comments.After = filterStampComments(comments.After)
+		if cb, ok := stmt.(*bzl.CommentBlock); ok && len(cb.Before) == 0 && len(cb.After) == 0 {
+			continue
+		}
+		stmts = append(stmts, stmt)
+	}
+	f.File.Stmt = stmts
+}
+
+func filterStampComments(comments []bzl.Comment) []bzl.Comment {
+	filtered := comments[:0]
+	for _, com := range comments {
+		if !isStampComment(com.Token) {
+			filtered = append(filtered, com)
+		}
+	}
+	return filtered
+}
+
+func isStampComment(token string) bool {
+	return token == stampPrefix || strings.HasPrefix(token, stampPrefix+" ")
+}
+
+// computeStamp returns a hex-encoded SHA-256 hash of content and of the
+// names and contents of regularFiles in dir, sorted by name. Build files
+// are skipped, since content already stands for them.
+func computeStamp(c *config.Config, content []byte, dir string, regularFiles []string) (string, error) {
+	h := sha256.New()
+	h.Write(content)
+	names := make([]string, 0, len(regularFiles))
+	for _, name := range regularFiles {
+		if !c.IsValidBuildFileName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write(data)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,111 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/merger"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// applyNewRuleTemplates adds attributes from templates set with
+// # gazelle:new_rule_template to generated rules. genKinds are the kinds of
+// the rules in gen before map_kind was applied; templates may name either
+// kind.
+//
+// Templates only apply to rules that don't match a rule in f, which will be
+// created. For rules that match, attributes named in the template are copied
+// from the existing rule instead, so they're left alone when the rules are
+// merged, even if the attributes are mergeable.
+func applyNewRuleTemplates(c *config.Config, templates ruleTemplateCache, f *rule.File, gen []*rule.Rule, genKinds []string, kinds map[string]rule.KindInfo) error {
+	if len(c.NewRuleTemplates) == 0 {
+		return nil
+	}
+	for i, r := range gen {
+		path, ok := c.NewRuleTemplates[r.Kind()]
+		if !ok {
+			if path, ok = c.NewRuleTemplates[genKinds[i]]; !ok {
+				continue
+			}
+		}
+		// The template is parsed for each rule, so rules don't share
+		// expressions.
+		tmpl, err := templates.load(c, path)
+		if err != nil {
+			return err
+		}
+
+		var existing *rule.Rule
+		if f != nil {
+			// Ambiguous matches are reported when the rules are merged.
+			existing, _ = merger.Match(f.Rules, r, kinds[r.Kind()])
+		}
+		for _, key := range tmpl.AttrKeys() {
+			if key == "name" || r.Attr(key) != nil {
+				continue
+			}
+			if existing == nil {
+				r.SetAttr(key, tmpl.Attr(key))
+			} else if value := existing.Attr(key); value != nil {
+				r.SetAttr(key, value)
+			}
+		}
+	}
+	return nil
+}
+
+// ruleTemplateCache holds the contents of template files named by
+// # gazelle:new_rule_template, keyed by path, so each file is read once per
+// run.
+type ruleTemplateCache map[string]ruleTemplateFile
+
+type ruleTemplateFile struct {
+	absPath string
+	data    []byte
+	err     error
+}
+
+// load returns the rule in the template file at path, reading the file if
+// it hasn't been read yet. The file must contain exactly one rule call. Its
+// attributes, other than name, are the attributes added to new rules.
+func (tc ruleTemplateCache) load(c *config.Config, path string) (*rule.Rule, error) {
+	tf, ok := tc[path]
+	if !ok {
+		tf.absPath = path
+		if !filepath.IsAbs(tf.absPath) {
+			tf.absPath = filepath.Join(c.RepoRoot, filepath.FromSlash(path))
+		}
+		if tf.data, tf.err = os.ReadFile(tf.absPath); tf.err != nil {
+			tf.err = fmt.Errorf("reading rule template: %w", tf.err)
+		}
+		tc[path] = tf
+	}
+	if tf.err != nil {
+		return nil, tf.err
+	}
+	f, err := rule.LoadData(tf.absPath, "", tf.data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing rule template: %w", err)
+	}
+	if len(f.Rules) != 1 {
+		return nil, fmt.Errorf("rule template %s: want exactly one rule, got %d", path, len(f.Rules))
+	}
+	return f.Rules[0], nil
+}
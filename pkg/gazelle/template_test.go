@@ -0,0 +1,57 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+)
+
+func TestRuleTemplateCache(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "go_binary.tpl")
+	if err := os.WriteFile(path, []byte(`go_binary(name = "x", pure = "on", tags = ["manual"])`), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	c := &config.Config{RepoRoot: dir}
+	tc := make(ruleTemplateCache)
+
+	first, err := tc.load(c, "go_binary.tpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file is read once, so later loads don't see it change.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	second, err := tc.load(c, "go_binary.tpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := second.AttrString("pure"); got != "on" {
+		t.Errorf("pure: got %q; want %q", got, "on")
+	}
+	if first.Attr("tags") == second.Attr("tags") {
+		t.Error("loads share attribute expressions; want a copy for each load")
+	}
+
+	if _, err := tc.load(c, "missing.tpl"); err == nil {
+		t.Error("loading a missing template: got success; want error")
+	}
+}
@@ -0,0 +1,111 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// timingPhases lists the phases reported by -timings in the order they run.
+// The walk phase includes reading and parsing build files and applying
+// directives; it excludes time spent in the per-directory callback, which is
+// attributed to the other phases.
+var timingPhases = []string{"walk", "fix", "generate", "merge", "index", "resolve", "emit"}
+
+// timings records wall time spent in each phase of fix and update and in
+// each visited directory. A nil *timings discards all measurements, so
+// callers don't need to check whether -timings was set.
+type timings struct {
+	phases   map[string]time.Duration
+	dirs     []dirTiming
+	dirTotal time.Duration
+	slowest  int
+}
+
+type dirTiming struct {
+	rel string
+	d   time.Duration
+}
+
+func newTimings(slowest int) *timings {
+	return &timings{phases: make(map[string]time.Duration), slowest: slowest}
+}
+
+// add attributes the time since start to phase and returns the current time,
+// so consecutive phases can be measured by chaining calls.
+func (t *timings) add(phase string, start time.Time) time.Time {
+	now := time.Now()
+	if t != nil {
+		t.phases[phase] += now.Sub(start)
+	}
+	return now
+}
+
+// addDir records the time since start as time spent in the directory rel.
+func (t *timings) addDir(rel string, start time.Time) {
+	if t == nil {
+		return
+	}
+	d := time.Since(start)
+	t.dirs = append(t.dirs, dirTiming{rel: rel, d: d})
+	t.dirTotal += d
+}
+
+// addWalk attributes the time since start to the walk phase, excluding time
+// already recorded with addDir.
+func (t *timings) addWalk(start time.Time) {
+	if t == nil {
+		return
+	}
+	t.phases["walk"] += time.Since(start) - t.dirTotal
+}
+
+// report writes the time spent in each phase and the slowest directories
+// to w.
+func (t *timings) report(w io.Writer) {
+	if t == nil {
+		return
+	}
+	var total time.Duration
+	fmt.Fprintln(w, "gazelle: time per phase:")
+	for _, phase := range timingPhases {
+		d := t.phases[phase]
+		total += d
+		fmt.Fprintf(w, "  %-10s %v\n", phase, d.Round(time.Microsecond))
+	}
+	fmt.Fprintf(w, "  %-10s %v\n", "total", total.Round(time.Microsecond))
+
+	if t.slowest <= 0 || len(t.dirs) == 0 {
+		return
+	}
+	dirs := make([]dirTiming, len(t.dirs))
+	copy(dirs, t.dirs)
+	sort.SliceStable(dirs, func(i, j int) bool { return dirs[i].d > dirs[j].d })
+	if len(dirs) > t.slowest {
+		dirs = dirs[:t.slowest]
+	}
+	fmt.Fprintf(w, "gazelle: slowest %d directories:\n", len(dirs))
+	for _, dir := range dirs {
+		rel := dir.rel
+		if rel == "" {
+			rel = "."
+		}
+		fmt.Fprintf(w, "  %-10v %s\n", dir.d.Round(time.Microsecond), rel)
+	}
+}
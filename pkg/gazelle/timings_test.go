@@ -0,0 +1,67 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gazelle
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNilTimings(t *testing.T) {
+	var tm *timings
+	start := time.Now()
+	if now := tm.add("walk", start); now.Before(start) {
+		t.Errorf("add returned %v, which is before start %v", now, start)
+	}
+	tm.addDir("a", start)
+	tm.addWalk(start)
+	var sb strings.Builder
+	tm.report(&sb)
+	if sb.Len() != 0 {
+		t.Errorf("got report %q; want empty report", sb.String())
+	}
+}
+
+func TestTimingsReport(t *testing.T) {
+	tm := newTimings(2)
+	tm.phases["generate"] = 3 * time.Millisecond
+	tm.phases["resolve"] = 2 * time.Millisecond
+	tm.dirs = []dirTiming{
+		{rel: "", d: 1 * time.Millisecond},
+		{rel: "a", d: 5 * time.Millisecond},
+		{rel: "a/b", d: 2 * time.Millisecond},
+	}
+
+	var sb strings.Builder
+	tm.report(&sb)
+	want := `gazelle: time per phase:
+  walk       0s
+  fix        0s
+  generate   3ms
+  merge      0s
+  index      0s
+  resolve    2ms
+  emit       0s
+  total      5ms
+gazelle: slowest 2 directories:
+  5ms        a
+  2ms        a/b
+`
+	if got := sb.String(); got != want {
+		t.Errorf("got report:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -28,6 +28,8 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/pathtools"
@@ -64,20 +66,65 @@ type RemoteCache struct {
 	// This is used by ModVersion. It may be stubbed out for tests.
 	ModVersionInfo func(modPath, query string) (version, sum string, err error)
 
+	// RootOverrides are consulted by Root and Remote before
+	// RepoRootForImportPath, so repositories on self-hosted servers can be
+	// found without network access. Known repositories still take
+	// precedence. RootOverrides must be set before other methods are called.
+	RootOverrides []RootOverride
+
+	// Now returns the current time. It's used to measure the time spent
+	// loading values, reported by Stats. It may be stubbed out for tests.
+	Now func() time.Time
+
 	root, remote, head, mod, modVersion remoteCacheMap
 
+	hits, shared, misses, loadTime atomic.Int64
+
 	tmpOnce sync.Once
 	tmpDir  string
 	tmpErr  error
 }
 
+// RemoteCacheStats counts lookups in a RemoteCache.
+type RemoteCacheStats struct {
+	// Hits is the number of lookups answered with a value already in the
+	// cache, including values for known repositories.
+	Hits int64
+
+	// Shared is the number of lookups that waited for a concurrent lookup of
+	// the same key to finish instead of loading the value again.
+	Shared int64
+
+	// Misses is the number of lookups that loaded a value, usually over
+	// the network.
+	Misses int64
+
+	// LoadTime is the total time spent loading values, measured with Now.
+	LoadTime time.Duration
+}
+
+// Stats returns the number of lookups in the cache so far. It may be called
+// concurrently with other methods.
+func (r *RemoteCache) Stats() RemoteCacheStats {
+	return RemoteCacheStats{
+		Hits:     r.hits.Load(),
+		Shared:   r.shared.Load(),
+		Misses:   r.misses.Load(),
+		LoadTime: time.Duration(r.loadTime.Load()),
+	}
+}
+
 // remoteCacheMap is a thread-safe, idempotent cache. It is used to store
 // information which should be fetched over the network no more than once.
-// This follows the Memo pattern described in The Go Programming Language,
-// section 9.7.
+// Concurrent lookups of the same key share a single load. This follows the
+// Memo pattern described in The Go Programming Language, section 9.7.
 type remoteCacheMap struct {
 	mu    sync.Mutex
 	cache map[string]*remoteCacheEntry
+
+	// rc is the RemoteCache this map belongs to. Lookups are counted in
+	// its stats.
+	rc *RemoteCache
 }
 
 type remoteCacheEntry struct {
@@ -134,11 +181,11 @@ func NewRemoteCache(knownRepos []Repo) (r *RemoteCache, cleanup func() error) {
 	r = &RemoteCache{
 		RepoRootForImportPath: vcs.RepoRootForImportPath,
 		HeadCmd:               defaultHeadCmd,
-		root:                  remoteCacheMap{cache: make(map[string]*remoteCacheEntry)},
-		remote:                remoteCacheMap{cache: make(map[string]*remoteCacheEntry)},
-		head:                  remoteCacheMap{cache: make(map[string]*remoteCacheEntry)},
-		mod:                   remoteCacheMap{cache: make(map[string]*remoteCacheEntry)},
-		modVersion:            remoteCacheMap{cache: make(map[string]*remoteCacheEntry)},
+		Now:                   time.Now,
+	}
+	for _, m := range []*remoteCacheMap{&r.root, &r.remote, &r.head, &r.mod, &r.modVersion} {
+		m.cache = make(map[string]*remoteCacheEntry)
+		m.rc = r
 	}
 	r.ModInfo = func(importPath string) (string, error) {
 		return defaultModInfo(r, importPath)
@@ -301,6 +348,14 @@ func (r *RemoteCache) Root(importPath string) (root, name string, err error) {
 		}
 	}
 
+	// Try overrides configured by the user.
+	if root, _, _, ok, err := r.overrideRoot(importPath); ok {
+		if err != nil {
+			return "", "", err
+		}
+		return root, label.ImportPathToBazelRepoName(root), nil
+	}
+
 	// Try known prefixes.
 	for _, p := range knownPrefixes {
 		if pathtools.HasPrefix(importPath, p.prefix) {
@@ -348,6 +403,9 @@ func (r *RemoteCache) Root(importPath string) (root, name string, err error) {
 // given root import path. This is suitable for creating new repository rules.
 func (r *RemoteCache) Remote(root string) (remote, vcs string, err error) {
 	v, err := r.remote.ensure(root, func() (interface{}, error) {
+		if overrideRoot, remote, vcs, ok, err := r.overrideRoot(root); ok && err == nil && overrideRoot == root {
+			return remoteValue{remote: remote, vcs: vcs}, nil
+		}
 		repo, err := r.RepoRootForImportPath(root, false)
 		if err != nil {
 			return nil, err
@@ -565,7 +623,8 @@ func defaultModVersionInfo(rc *RemoteCache, modPath, query string) (version, sum
 
 // get retrieves a value associated with the given key from the cache. ok will
 // be true if the key exists in the cache, even if it's in the process of
-// being fetched.
+// being fetched. Keys that don't exist aren't counted as misses, since
+// callers use get to probe prefixes of import paths.
 func (m *remoteCacheMap) get(key string) (value interface{}, ok bool, err error) {
 	m.mu.Lock()
 	e, ok := m.cache[key]
@@ -573,16 +632,14 @@ func (m *remoteCacheMap) get(key string) (value interface{}, ok bool, err error)
 	if !ok {
 		return nil, ok, nil
 	}
-	if e.ready != nil {
-		<-e.ready
-	}
+	m.wait(e)
 	return e.value, ok, e.err
 }
 
 // ensure retreives a value associated with the given key from the cache. If
 // the key does not exist in the cache, the load function will be called,
 // and its result will be associated with the key. The load function will not
-// be called more than once for any key.
+// be called more than once for any key, even by concurrent callers.
 func (m *remoteCacheMap) ensure(key string, load func() (interface{}, error)) (interface{}, error) {
 	m.mu.Lock()
 	e, ok := m.cache[key]
@@ -590,17 +647,43 @@ func (m *remoteCacheMap) ensure(key string, load func() (interface{}, error)) (i
 		e = &remoteCacheEntry{ready: make(chan struct{})}
 		m.cache[key] = e
 		m.mu.Unlock()
-		e.value, e.err = load()
-		close(e.ready)
+		m.load(e, load)
 	} else {
 		m.mu.Unlock()
-		if e.ready != nil {
-			<-e.ready
-		}
+		m.wait(e)
 	}
 	return e.value, e.err
 }
 
+// load calls the load function to fill in e, then marks e ready. If load
+// panics, e is still marked ready so that concurrent lookups don't block
+// forever.
+func (m *remoteCacheMap) load(e *remoteCacheEntry, load func() (interface{}, error)) {
+	m.rc.misses.Add(1)
+	start := m.rc.Now()
+	defer func() {
+		m.rc.loadTime.Add(int64(m.rc.Now().Sub(start)))
+		close(e.ready)
+	}()
+	e.value, e.err = load()
+}
+
+// wait blocks until e is ready and counts the lookup as a hit if e was
+// already ready, or as shared if it was being loaded concurrently.
+func (m *remoteCacheMap) wait(e *remoteCacheEntry) {
+	if e.ready == nil {
+		m.rc.hits.Add(1)
+		return
+	}
+	select {
+	case <-e.ready:
+		m.rc.hits.Add(1)
+	default:
+		m.rc.shared.Add(1)
+		<-e.ready
+	}
+}
+
 func (rc *RemoteCache) initTmp() {
 	rc.tmpOnce.Do(func() {
 		rc.tmpDir, rc.tmpErr = os.MkdirTemp("", "gazelle-remotecache-")
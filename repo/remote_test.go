@@ -19,7 +19,11 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"golang.org/x/tools/go/vcs"
 )
@@ -238,6 +242,101 @@ func TestRemote(t *testing.T) {
 	}
 }
 
+func TestRootOverrides(t *testing.T) {
+	overrides, err := LoadRootOverrides("", []string{
+		"example.corp=git corp-git.example/...",
+		"example.corp/mono=git https://corp-git.example/mono.git",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		in, wantRoot, wantName, wantRemote string
+		repos                              []Repo
+		wantError                          bool
+	}{
+		{
+			in:         "example.corp/tools/cmd/lint",
+			wantRoot:   "example.corp/tools",
+			wantName:   "corp_example_tools",
+			wantRemote: "https://corp-git.example/tools",
+		}, {
+			in:         "example.corp/mono/pkg/a",
+			wantRoot:   "example.corp/mono",
+			wantName:   "corp_example_mono",
+			wantRemote: "https://corp-git.example/mono.git",
+		}, {
+			in:        "example.corp",
+			wantError: true,
+		}, {
+			in: "example.corp/tools/cmd/lint",
+			repos: []Repo{{
+				Name:     "corp_tools",
+				GoPrefix: "example.corp/tools",
+				Remote:   "https://mirror.example/tools",
+				VCS:      "git",
+			}},
+			wantRoot:   "example.corp/tools",
+			wantName:   "corp_tools",
+			wantRemote: "https://mirror.example/tools",
+		},
+	} {
+		t.Run(tc.in, func(t *testing.T) {
+			rc := NewStubRemoteCache(tc.repos)
+			rc.RootOverrides = overrides
+			gotRoot, gotName, err := rc.Root(tc.in)
+			if err != nil {
+				if !tc.wantError {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			} else if tc.wantError {
+				t.Fatalf("unexpected success: %v", tc.in)
+			}
+			if gotRoot != tc.wantRoot || gotName != tc.wantName {
+				t.Errorf("root for %q: got %q, %q; want %q, %q", tc.in, gotRoot, gotName, tc.wantRoot, tc.wantName)
+			}
+			gotRemote, gotVCS, err := rc.Remote(gotRoot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotRemote != tc.wantRemote || gotVCS != "git" {
+				t.Errorf("remote for %q: got %q, %q; want %q, \"git\"", gotRoot, gotRemote, gotVCS, tc.wantRemote)
+			}
+		})
+	}
+}
+
+func TestLoadRootOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.txt")
+	content := `# Self-hosted repositories.
+example.corp=git corp-git.example/...
+
+example.corp/mono = hg ssh://hg.example/mono
+`
+	if err := os.WriteFile(path, []byte(content), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadRootOverrides(path, []string{"other.example=git https://other.example/..."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RootOverride{
+		{Prefix: "example.corp", VCS: "git", Remote: "https://corp-git.example", Wildcard: true},
+		{Prefix: "example.corp/mono", VCS: "hg", Remote: "ssh://hg.example/mono"},
+		{Prefix: "other.example", VCS: "git", Remote: "https://other.example", Wildcard: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v; want %#v", got, want)
+	}
+
+	for _, bad := range []string{"example.corp", "example.corp=git", "=git https://example.corp"} {
+		if _, err := ParseRootOverride(bad); err == nil {
+			t.Errorf("ParseRootOverride(%q): unexpected success", bad)
+		}
+	}
+}
+
 func TestHead(t *testing.T) {
 	for _, tc := range []struct {
 		desc, remote, vcs   string
@@ -371,3 +470,62 @@ func TestModVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestRemoteCacheSharedLoad(t *testing.T) {
+	rc := NewStubRemoteCache(nil)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	rc.RepoRootForImportPath = func(importPath string, verbose bool) (*vcs.RepoRoot, error) {
+		calls.Add(1)
+		<-release
+		return stubRepoRootForImportPath(importPath, verbose)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	rc.Now = func() time.Time {
+		t := now
+		now = now.Add(2 * time.Second)
+		return t
+	}
+
+	const n = 8
+	var wg sync.WaitGroup
+	roots := make([]string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			roots[i], _, _ = rc.Root("example.com/repo/pkg")
+		}(i)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for rc.Stats().Shared < n-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("lookups did not wait for the shared load: %+v", rc.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("got %d calls to RepoRootForImportPath; want 1", got)
+	}
+	for i, root := range roots {
+		if root != "example.com/repo" {
+			t.Errorf("lookup %d: got root %q; want %q", i, root, "example.com/repo")
+		}
+	}
+	want := RemoteCacheStats{Shared: n - 1, Misses: 1, LoadTime: 2 * time.Second}
+	if got := rc.Stats(); got != want {
+		t.Errorf("got stats %+v; want %+v", got, want)
+	}
+
+	if _, _, err := rc.Root("example.com/repo/pkg"); err != nil {
+		t.Fatal(err)
+	}
+	want.Hits++
+	if got := rc.Stats(); got != want {
+		t.Errorf("after cached lookup, got stats %+v; want %+v", got, want)
+	}
+}
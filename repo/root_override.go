@@ -0,0 +1,137 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/pathtools"
+)
+
+// RootOverride tells RemoteCache where repositories with import paths
+// under Prefix are hosted, so their roots and remotes can be found without
+// fetching "?go-get=1" pages over the network. This is useful for
+// self-hosted version control servers that don't serve those pages.
+type RootOverride struct {
+	// Prefix is an import path prefix, for example, "example.corp".
+	Prefix string
+
+	// VCS is the version control system used by the repositories, for
+	// example, "git".
+	VCS string
+
+	// Remote is the URL of the repository whose root is Prefix. If Wildcard
+	// is true, each path component after Prefix names a separate repository
+	// instead, and Remote is the URL those repositories are nested in.
+	// For example, the repository for "example.corp/foo" is at Remote + "/foo".
+	Remote   string
+	Wildcard bool
+}
+
+// ParseRootOverride parses an override written as "prefix=vcs remote", for
+// example, "example.corp=git https://corp-git.example/...". If the remote
+// ends with "/...", each path component after the prefix names a separate
+// repository. If the remote has no scheme, "https://" is used.
+func ParseRootOverride(s string) (RootOverride, error) {
+	prefix, rest, ok := strings.Cut(s, "=")
+	fields := strings.Fields(rest)
+	if !ok || len(fields) != 2 {
+		return RootOverride{}, fmt.Errorf("invalid repository root override %q: want \"prefix=vcs remote\"", s)
+	}
+	o := RootOverride{
+		Prefix: strings.TrimSuffix(strings.TrimSpace(prefix), "/"),
+		VCS:    fields[0],
+		Remote: fields[1],
+	}
+	if o.Prefix == "" {
+		return RootOverride{}, fmt.Errorf("invalid repository root override %q: empty prefix", s)
+	}
+	if strings.HasSuffix(o.Remote, "/...") {
+		o.Remote = strings.TrimSuffix(o.Remote, "/...")
+		o.Wildcard = true
+	}
+	if !strings.Contains(o.Remote, "://") {
+		o.Remote = "https://" + o.Remote
+	}
+	return o, nil
+}
+
+// LoadRootOverrides reads overrides from the file at path, if path is not
+// empty, then parses overrides given in values. The file contains one
+// override per line in the format accepted by ParseRootOverride. Blank lines
+// and lines starting with "#" are ignored. When several overrides have the
+// same prefix, the last one is used, so values take precedence over the file.
+func LoadRootOverrides(path string, values []string) ([]RootOverride, error) {
+	var overrides []RootOverride
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for lineNum := 1; sc.Scan(); lineNum++ {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			o, err := ParseRootOverride(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, lineNum, err)
+			}
+			overrides = append(overrides, o)
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range values {
+		o, err := ParseRootOverride(v)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, nil
+}
+
+// overrideRoot returns the root and remote for importPath from the override
+// with the longest matching prefix. ok is false if no override matches.
+func (r *RemoteCache) overrideRoot(importPath string) (root, remote, vcs string, ok bool, err error) {
+	var best *RootOverride
+	for i := range r.RootOverrides {
+		o := &r.RootOverrides[i]
+		if pathtools.HasPrefix(importPath, o.Prefix) && (best == nil || len(o.Prefix) >= len(best.Prefix)) {
+			best = o
+		}
+	}
+	if best == nil {
+		return "", "", "", false, nil
+	}
+	if !best.Wildcard {
+		return best.Prefix, best.Remote, best.VCS, true, nil
+	}
+	rest := pathtools.TrimPrefix(importPath, best.Prefix)
+	if rest == "" {
+		return "", "", "", true, fmt.Errorf("import path %q is shorter than the overridden prefix %q", importPath, best.Prefix+"/...")
+	}
+	name, _, _ := strings.Cut(rest, "/")
+	return path.Join(best.Prefix, name), best.Remote + "/" + name, best.VCS, true, nil
+}
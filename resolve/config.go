@@ -24,6 +24,7 @@ import (
 	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/bmatcuk/doublestar/v4"
 )
 
 // FindRuleWithOverride searches the current configuration for user-specified
@@ -35,6 +36,9 @@ func FindRuleWithOverride(c *config.Config, imp ImportSpec, lang string) (label.
 	if dep, ok := rc.findOverride(imp, lang); ok {
 		return dep, true
 	}
+	if dep, ok := rc.findGlobOverride(imp, lang); ok {
+		return dep, true
+	}
 	for i := len(rc.regexpOverrides) - 1; i >= 0; i-- {
 		o := rc.regexpOverrides[i]
 		if o.matches(imp, lang) {
@@ -50,6 +54,37 @@ type overrideKey struct {
 	lang string
 }
 
+// globOverrideSpec is a resolve directive with an import pattern containing
+// wildcards. "*" matches any sequence of characters within a path segment,
+// and "**" matches any number of path segments.
+type globOverrideSpec struct {
+	key         overrideKey
+	specificity int
+	dep         label.Label
+}
+
+func (o globOverrideSpec) matches(imp ImportSpec, lang string) bool {
+	if imp.Lang != o.key.imp.Lang || lang != o.key.lang {
+		return false
+	}
+	// The pattern was validated when the directive was parsed.
+	matched, _ := doublestar.Match(o.key.imp.Imp, imp.Imp)
+	return matched
+}
+
+// isGlobPattern returns whether an import string in a resolve directive
+// should be treated as a glob pattern.
+func isGlobPattern(imp string) bool {
+	return strings.Contains(imp, "*")
+}
+
+// globSpecificity returns the number of characters in pattern that aren't
+// wildcards. When multiple patterns match an import, the pattern with the
+// most literal characters is used.
+func globSpecificity(pattern string) int {
+	return len(pattern) - strings.Count(pattern, "*")
+}
+
 type regexpOverrideSpec struct {
 	ImpLang  string
 	ImpRegex *regexp.Regexp
@@ -76,19 +111,21 @@ func (o regexpOverrideSpec) resolveRegexpDep(imp ImportSpec) label.Label {
 
 type resolveConfig struct {
 	overrides       map[overrideKey]label.Label
+	globOverrides   []globOverrideSpec
 	regexpOverrides []regexpOverrideSpec
 	parent          *resolveConfig
 }
 
-// newResolveConfig creates a new resolveConfig with the given overrides and
-// regexpOverrides. If the new overrides are the same as the parent's, the
-// parent is returned instead.
-func newResolveConfig(parent *resolveConfig, newOverrides map[overrideKey]label.Label, regexpOverrides []regexpOverrideSpec) *resolveConfig {
-	if len(newOverrides) == 0 && len(regexpOverrides) == len(parent.regexpOverrides) {
+// newResolveConfig creates a new resolveConfig with the given overrides,
+// globOverrides, and regexpOverrides. If the new overrides are the same as
+// the parent's, the parent is returned instead.
+func newResolveConfig(parent *resolveConfig, newOverrides map[overrideKey]label.Label, globOverrides []globOverrideSpec, regexpOverrides []regexpOverrideSpec) *resolveConfig {
+	if len(newOverrides) == 0 && len(globOverrides) == len(parent.globOverrides) && len(regexpOverrides) == len(parent.regexpOverrides) {
 		return parent
 	}
 	return &resolveConfig{
 		overrides:       newOverrides,
+		globOverrides:   globOverrides,
 		regexpOverrides: regexpOverrides,
 		parent:          parent,
 	}
@@ -108,6 +145,23 @@ func (rc *resolveConfig) findOverride(imp ImportSpec, lang string) (label.Label,
 	return label.NoLabel, false
 }
 
+// findGlobOverride returns the dependency for the most specific glob override
+// matching the given import and language. If several overrides are equally
+// specific, the one specified last wins.
+func (rc *resolveConfig) findGlobOverride(imp ImportSpec, lang string) (label.Label, bool) {
+	var best *globOverrideSpec
+	for i := len(rc.globOverrides) - 1; i >= 0; i-- {
+		o := &rc.globOverrides[i]
+		if (best == nil || o.specificity > best.specificity) && o.matches(imp, lang) {
+			best = o
+		}
+	}
+	if best == nil {
+		return label.NoLabel, false
+	}
+	return best.dep, true
+}
+
 const resolveName = "_resolve"
 
 func getResolveConfig(c *config.Config) *resolveConfig {
@@ -125,7 +179,9 @@ func (*Configurer) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config)
 func (*Configurer) CheckFlags(fs *flag.FlagSet, c *config.Config) error { return nil }
 
 func (*Configurer) KnownDirectives() []string {
-	return []string{"resolve", "resolve_regexp"}
+	// no_resolve is written above individual rules. It's checked with
+	// rule.Rule.ShouldResolve, not configured here.
+	return []string{"no_resolve", "resolve", "resolve_regexp"}
 }
 
 func (*Configurer) Configure(c *config.Config, rel string, f *rule.File) {
@@ -135,6 +191,7 @@ func (*Configurer) Configure(c *config.Config, rel string, f *rule.File) {
 
 	rc := getResolveConfig(c)
 	var newOverrides map[overrideKey]label.Label
+	globOverrides := rc.globOverrides[:len(rc.globOverrides):len(rc.globOverrides)]
 	regexpOverrides := rc.regexpOverrides[:len(rc.regexpOverrides):len(rc.regexpOverrides)]
 
 	for _, d := range f.Directives {
@@ -162,6 +219,18 @@ func (*Configurer) Configure(c *config.Config, rel string, f *rule.File) {
 				continue
 			}
 			dep = dep.Abs("", rel)
+			if isGlobPattern(key.imp.Imp) {
+				if !doublestar.ValidatePattern(key.imp.Imp) {
+					log.Printf("gazelle:resolve %s: invalid pattern %q", d.Value, key.imp.Imp)
+					continue
+				}
+				globOverrides = append(globOverrides, globOverrideSpec{
+					key:         key,
+					specificity: globSpecificity(key.imp.Imp),
+					dep:         dep,
+				})
+				continue
+			}
 			if newOverrides == nil {
 				newOverrides = make(map[overrideKey]label.Label, len(f.Directives))
 			}
@@ -205,5 +274,5 @@ func (*Configurer) Configure(c *config.Config, rel string, f *rule.File) {
 		}
 	}
 
-	c.Exts[resolveName] = newResolveConfig(rc, newOverrides, regexpOverrides)
+	c.Exts[resolveName] = newResolveConfig(rc, newOverrides, globOverrides, regexpOverrides)
 }
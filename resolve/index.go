@@ -16,12 +16,17 @@ limitations under the License.
 package resolve
 
 import (
+	"fmt"
 	"log"
+	"path"
+	"sort"
+	"strings"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/repo"
 	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
 )
 
 // ImportSpec describes a library to be imported. Imp is an import string for
@@ -70,12 +75,26 @@ type CrossResolver interface {
 	CrossResolve(c *config.Config, ix *RuleIndex, imp ImportSpec, lang string) []FindResult
 }
 
+// ConcurrentResolver is an interface that language extensions can implement
+// to allow Gazelle to call Resolve concurrently for rules in different
+// directories. Resolve and CrossResolve must not modify state shared between
+// calls without synchronization. Directories are resolved one at a time
+// unless every language implements this interface.
+type ConcurrentResolver interface {
+	// ResolveConcurrently returns whether Resolve may be called concurrently.
+	ResolveConcurrently() bool
+}
+
 // RuleIndex is a table of rules in a workspace, indexed by label and by
 // import path. Used by Resolver to map import paths to labels.
 type RuleIndex struct {
 	mrslv          func(r *rule.Rule, pkgRel string) Resolver
 	crossResolvers []CrossResolver
 
+	// ReportDuplicates enables logging of imports provided by rules of the
+	// same kind in more than one package when Finish is called.
+	ReportDuplicates bool
+
 	// The underlying state of rules. All indexing should be reproducible from this.
 	rules []*ruleRecord
 
@@ -106,6 +125,25 @@ type RuleIndex struct {
 	// the Embeds method). This may include imports of other languages.
 	// Computed from `rules` when indexing.
 	imports map[label.Label][]ImportSpec
+
+	// Files generated by rules, mapped to the labels of the rules that
+	// generate them. Recorded from the out and outs attributes of every rule
+	// passed to AddRule, importable or not.
+	outputs map[label.Label]label.Label
+
+	// Labels in the main repository that attributes of rules passed to
+	// AddRule refer to, keyed without a repository name.
+	references map[label.Label]bool
+
+	// Indexed rules with srcs generated by other rules, keyed by the
+	// directories the generated files are in.
+	// Computed from `rules` and `outputs` when indexing.
+	generatedSrcDirs map[generatedSrcDir][]*ruleRecord
+}
+
+// generatedSrcDir identifies a directory containing generated files.
+type generatedSrcDir struct {
+	repo, dir string
 }
 
 // ruleRecord contains information about a rule relevant to import indexing.
@@ -123,11 +161,19 @@ type ruleRecord struct {
 	// The set of labels (of any language) that this rule directly embeds.
 	Embeds []label.Label `json:"embeds"`
 
+	// Labels of files and rules in srcs. These are matched against outputs
+	// of other rules when indexing.
+	Srcs []label.Label `json:"srcs"`
+
 	// The language that this rule is relevant for.
 	// Due to the presence of mapped kinds, it's otherwise
 	// impossible to know the underlying builtin rule type for an
 	// arbitrary import.
 	Lang string `json:"lang"`
+
+	// loaded is true for rules from other repositories, loaded with
+	// LoadIndexFile. rule is nil for these.
+	loaded bool
 }
 
 // NewRuleIndex creates a new index.
@@ -162,6 +208,8 @@ func (ix *RuleIndex) AddRule(c *config.Config, r *rule.Rule, f *rule.File) {
 	var embeds []label.Label
 
 	l := label.New(c.RepoName, f.Pkg, r.Name())
+	ix.addOutputs(r, l)
+	ix.addReferences(c.RepoName, r, f.Pkg)
 
 	if rslv := ix.mrslv(r, f.Pkg); rslv != nil {
 		lang = rslv.Name()
@@ -186,11 +234,73 @@ func (ix *RuleIndex) AddRule(c *config.Config, r *rule.Rule, f *rule.File) {
 		Label:      l,
 		ImportedAs: imps,
 		Embeds:     embeds,
+		Srcs:       srcLabels(r, l),
 		Lang:       lang,
 	}
 	ix.rules = append(ix.rules, record)
 }
 
+// addOutputs records the files listed in the out and outs attributes of r,
+// which has the label l, as generated by r.
+func (ix *RuleIndex) addOutputs(r *rule.Rule, l label.Label) {
+	outs := r.AttrStrings("outs")
+	if out := r.AttrString("out"); out != "" {
+		outs = append(outs, out)
+	}
+	for _, out := range outs {
+		if ix.outputs == nil {
+			ix.outputs = make(map[label.Label]label.Label)
+		}
+		ix.outputs[label.New(l.Repo, l.Pkg, out)] = l
+	}
+}
+
+// addReferences records the labels in the main repository that attributes of
+// r, a rule in the package pkg, refer to.
+func (ix *RuleIndex) addReferences(repoName string, r *rule.Rule, pkg string) {
+	for _, key := range r.AttrKeys() {
+		if key == "name" {
+			continue
+		}
+		bzl.Walk(r.Attr(key), func(e bzl.Expr, _ []bzl.Expr) {
+			s, ok := e.(*bzl.StringExpr)
+			if !ok {
+				return
+			}
+			l, err := label.Parse(s.Value)
+			if err != nil || (l.Repo != "" && l.Repo != "@" && l.Repo != repoName) {
+				return
+			}
+			l = l.Abs("", pkg)
+			if ix.references == nil {
+				ix.references = make(map[label.Label]bool)
+			}
+			ix.references[label.New("", l.Pkg, l.Name)] = true
+		})
+	}
+}
+
+// IsReferenced returns whether an attribute of any rule passed to AddRule
+// refers to l, a label in the main repository. References from build files
+// that weren't indexed aren't known.
+func (ix *RuleIndex) IsReferenced(l label.Label) bool {
+	return ix.references[label.New("", l.Pkg, l.Name)]
+}
+
+// srcLabels returns the absolute labels in the srcs attribute of r, which
+// has the label l. Strings that aren't labels are skipped.
+func srcLabels(r *rule.Rule, l label.Label) []label.Label {
+	var srcs []label.Label
+	for _, s := range r.AttrStrings("srcs") {
+		src, err := label.Parse(s)
+		if err != nil {
+			continue
+		}
+		srcs = append(srcs, src.Abs(l.Repo, l.Pkg))
+	}
+	return srcs
+}
+
 // Finish constructs the import index and performs any other necessary indexing
 // actions after all rules have been added. This step is necessary because
 // a rule may be indexed differently based on what rules are added later.
@@ -213,6 +323,10 @@ func (ix *RuleIndex) Finish() {
 
 	ix.collectEmbeds()
 	ix.buildImportIndex()
+	ix.buildGeneratedSrcIndex()
+	if ix.ReportDuplicates {
+		ix.reportDuplicates()
+	}
 
 	ix.indexed = true
 }
@@ -231,7 +345,6 @@ func (ix *RuleIndex) collectRecordEmbeds(r *ruleRecord, didCollectEmbeds map[lab
 	if _, ok := didCollectEmbeds[r.Label]; ok {
 		return
 	}
-	resolver := ix.mrslv(r.rule, r.Pkg)
 	didCollectEmbeds[r.Label] = true
 	ix.embeds[r.Label] = r.Embeds
 	for _, e := range r.Embeds {
@@ -240,8 +353,9 @@ func (ix *RuleIndex) collectRecordEmbeds(r *ruleRecord, didCollectEmbeds map[lab
 			continue
 		}
 		ix.collectRecordEmbeds(er, didCollectEmbeds)
-		erResolver := ix.mrslv(er.rule, er.Pkg)
-		if resolver.Name() == erResolver.Name() {
+		// Lang is the name of the resolver for each rule. Rules loaded from
+		// index files have no *rule.Rule to look up a resolver with.
+		if r.Lang == er.Lang {
 			ix.embedded[er.Label] = struct{}{}
 			ix.embeds[r.Label] = append(ix.embeds[r.Label], ix.embeds[er.Label]...)
 		}
@@ -267,6 +381,119 @@ func (ix *RuleIndex) buildImportIndex() {
 	}
 }
 
+// buildGeneratedSrcIndex constructs the map used by
+// FindRulesByGeneratedSrcDir. A rule's srcs may name generated files
+// directly or name the rules that generate them.
+func (ix *RuleIndex) buildGeneratedSrcIndex() {
+	ix.generatedSrcDirs = make(map[generatedSrcDir][]*ruleRecord)
+	if len(ix.outputs) == 0 {
+		return
+	}
+	outputsByRule := make(map[label.Label][]label.Label)
+	for out, gen := range ix.outputs {
+		outputsByRule[gen] = append(outputsByRule[gen], out)
+	}
+	for _, r := range ix.rules {
+		dirs := make(map[generatedSrcDir]bool)
+		for _, src := range r.Srcs {
+			var outs []label.Label
+			if _, ok := ix.outputs[src]; ok {
+				outs = []label.Label{src}
+			} else {
+				outs = outputsByRule[src]
+			}
+			for _, out := range outs {
+				dir := generatedSrcDir{repo: out.Repo, dir: path.Dir(path.Join(out.Pkg, out.Name))}
+				if dir.dir == "." {
+					dir.dir = ""
+				}
+				if !dirs[dir] {
+					dirs[dir] = true
+					ix.generatedSrcDirs[dir] = append(ix.generatedSrcDirs[dir], r)
+				}
+			}
+		}
+	}
+}
+
+// reportDuplicates logs imports provided by rules of the same kind in more
+// than one package. This usually happens when a package is copied or moved
+// without deleting the old build file, and it makes resolution of the import
+// ambiguous. A canonical rule is suggested for each import.
+func (ix *RuleIndex) reportDuplicates() {
+	var imps []ImportSpec
+	for imp, records := range ix.importMap {
+		if len(records) > 1 {
+			imps = append(imps, imp)
+		}
+	}
+	sort.Slice(imps, func(i, j int) bool {
+		if imps[i].Lang != imps[j].Lang {
+			return imps[i].Lang < imps[j].Lang
+		}
+		return imps[i].Imp < imps[j].Imp
+	})
+
+	for _, imp := range imps {
+		byKind := make(map[string][]*ruleRecord)
+		var kinds []string
+		for _, r := range ix.importMap[imp] {
+			if _, ok := byKind[r.Kind]; !ok {
+				kinds = append(kinds, r.Kind)
+			}
+			byKind[r.Kind] = append(byKind[r.Kind], r)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			records := byKind[kind]
+			if !inMultiplePackages(records) {
+				continue
+			}
+			labels := make([]string, len(records))
+			for i, r := range records {
+				labels[i] = r.Label.String()
+			}
+			sort.Strings(labels)
+			log.Printf("import %q is provided by %s rules in multiple packages: %s. Consider keeping only %s, or use # gazelle:resolve to choose one.", imp.Imp, kind, strings.Join(labels, ", "), canonicalRecord(imp, records).Label)
+		}
+	}
+}
+
+// inMultiplePackages returns whether records are in more than one package.
+// Records in vendor directories are expected to duplicate other rules, so
+// false is returned if any record is vendored.
+func inMultiplePackages(records []*ruleRecord) bool {
+	multiple := false
+	for _, r := range records {
+		if strings.Contains("/"+r.Pkg+"/", "/vendor/") {
+			return false
+		}
+		if r.Pkg != records[0].Pkg {
+			multiple = true
+		}
+	}
+	return multiple
+}
+
+// canonicalRecord suggests which of several records providing imp should be
+// kept. It prefers the record whose package path is the longest suffix of
+// the import string, then the record with the lowest label.
+func canonicalRecord(imp ImportSpec, records []*ruleRecord) *ruleRecord {
+	suffixLen := func(r *ruleRecord) int {
+		if r.Pkg != "" && (imp.Imp == r.Pkg || strings.HasSuffix(imp.Imp, "/"+r.Pkg)) {
+			return len(r.Pkg)
+		}
+		return 0
+	}
+	best := records[0]
+	for _, r := range records[1:] {
+		if n, bestN := suffixLen(r), suffixLen(best); n > bestN || (n == bestN && r.Label.String() < best.Label.String()) {
+			best = r
+		}
+	}
+	return best
+}
+
 type FindResult struct {
 	// Label is the absolute label (including repository and package name) for
 	// a matched rule.
@@ -305,6 +532,48 @@ func (ix *RuleIndex) FindRulesByImport(imp ImportSpec, lang string) []FindResult
 	return results
 }
 
+// FindRulesByGeneratedSrcDir returns rules of the language lang whose srcs
+// include files generated by other rules into the directory dir, a
+// slash-separated path relative to the root of the repository repo. Files
+// are known to be generated if they're listed in the out or outs attribute
+// of an indexed build file's rule.
+//
+// Languages may use this to resolve imports of packages that don't have
+// their own rules, because their sources are generated elsewhere, without
+// # gazelle:resolve directives. imp is the import of the package. Rules that
+// are imported with a different string in imp.Lang are skipped, since they
+// provide another package.
+func (ix *RuleIndex) FindRulesByGeneratedSrcDir(repo, dir string, imp ImportSpec, lang string) []FindResult {
+	matches := ix.generatedSrcDirs[generatedSrcDir{repo: repo, dir: dir}]
+	results := make([]FindResult, 0, len(matches))
+	for _, m := range matches {
+		if m.Lang != lang || !mayProvide(m, imp) {
+			continue
+		}
+		results = append(results, FindResult{
+			Label:  m.Label,
+			Embeds: ix.embeds[m.Label],
+		})
+	}
+	return results
+}
+
+// mayProvide returns whether r is imported with imp, or isn't imported with
+// any other non-empty string of imp.Lang.
+func mayProvide(r *ruleRecord, imp ImportSpec) bool {
+	other := false
+	for _, i := range r.ImportedAs {
+		if i.Lang != imp.Lang || i.Imp == "" {
+			continue
+		}
+		if i.Imp == imp.Imp {
+			return true
+		}
+		other = true
+	}
+	return !other
+}
+
 // FindRulesByImportWithConfig attempts to resolve an import to a rule first by
 // checking the rule index, then if no matches are found any registered
 // CrossResolve implementations are called.
@@ -319,6 +588,38 @@ func (ix *RuleIndex) FindRulesByImportWithConfig(c *config.Config, imp ImportSpe
 	return results
 }
 
+// ImportProvenance returns a reason, for rule.Rule.AddProvenance, why a
+// dependency on l is in a rule: the import it was resolved from, the source
+// files containing the import, if they're known, and how the import was
+// resolved. l must be the absolute label returned by the resolver.
+func ImportProvenance(c *config.Config, ix *RuleIndex, imp ImportSpec, lang string, files []string, l label.Label) string {
+	var how string
+	if o, ok := FindRuleWithOverride(c, imp, lang); ok && o.Equal(l) {
+		how = "resolved with a # gazelle:resolve directive"
+	} else if ix != nil && ix.provides(c, imp, lang, l) {
+		how = "provided by an indexed rule"
+	} else if l.Repo != "" && l.Repo != c.RepoName {
+		how = "resolved to an external repository"
+	} else {
+		how = "resolved by naming convention"
+	}
+	if len(files) == 0 {
+		return fmt.Sprintf("import %q: %s", imp.Imp, how)
+	}
+	return fmt.Sprintf("import %q in %s: %s", imp.Imp, strings.Join(files, ", "), how)
+}
+
+// provides returns whether l is one of the rules imp resolves to in the
+// index.
+func (ix *RuleIndex) provides(c *config.Config, imp ImportSpec, lang string, l label.Label) bool {
+	for _, m := range ix.FindRulesByImportWithConfig(c, imp, lang) {
+		if m.Label.Equal(l) {
+			return true
+		}
+	}
+	return false
+}
+
 // IsSelfImport returns true if the result's label matches the given label
 // or the result's rule transitively embeds the rule with the given label.
 // Self imports cause cyclic dependencies, so the caller may want to omit
@@ -0,0 +1,185 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolve
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// indexFileVersion is the version of the format written by WriteIndexFile.
+// It's incremented when the format changes incompatibly.
+const indexFileVersion = 1
+
+// indexFile is the content of a file written by WriteIndexFile. It lists the
+// importable rules of one repository, so other repositories can resolve
+// dependencies on them without indexing the repository's build files.
+type indexFile struct {
+	Version int `json:"version"`
+
+	// Repo is the name of the repository the rules are in. Labels in Rules
+	// are relative to the repository.
+	Repo string `json:"repo"`
+
+	Rules []indexFileRule `json:"rules"`
+}
+
+// indexFileRule describes an importable rule. Imports and Embeds include
+// those inherited from embedded rules, which aren't listed separately.
+type indexFileRule struct {
+	Label   string            `json:"label"`
+	Kind    string            `json:"kind"`
+	Lang    string            `json:"lang"`
+	Imports []indexFileImport `json:"imports"`
+	Embeds  []string          `json:"embeds,omitempty"`
+}
+
+type indexFileImport struct {
+	Lang string `json:"lang"`
+	Imp  string `json:"imp"`
+}
+
+// WriteIndexFile writes the importable rules in ix to a JSON file at path,
+// so other repositories can load them with LoadIndexFile. repoName is the
+// name of the repository the rules are in. Rules loaded from other index
+// files aren't written.
+//
+// WriteIndexFile must be called after Finish.
+func (ix *RuleIndex) WriteIndexFile(path, repoName string) error {
+	if !ix.indexed {
+		return fmt.Errorf("WriteIndexFile called before Finish")
+	}
+	f := indexFile{Version: indexFileVersion, Repo: repoName, Rules: []indexFileRule{}}
+	for _, r := range ix.rules {
+		if r.loaded {
+			continue
+		}
+		if _, embedded := ix.embedded[r.Label]; embedded {
+			continue
+		}
+		if ix.labelMap[r.Label] != r {
+			// Duplicate label, reported by Finish.
+			continue
+		}
+		fr := indexFileRule{
+			Label:   relLabel(r.Label).String(),
+			Kind:    r.Kind,
+			Lang:    r.Lang,
+			Imports: []indexFileImport{},
+		}
+		seen := make(map[ImportSpec]bool)
+		for _, imp := range ix.imports[r.Label] {
+			if !seen[imp] {
+				seen[imp] = true
+				fr.Imports = append(fr.Imports, indexFileImport{Lang: imp.Lang, Imp: imp.Imp})
+			}
+		}
+		for _, e := range ix.embeds[r.Label] {
+			fr.Embeds = append(fr.Embeds, relLabel(e).String())
+		}
+		f.Rules = append(f.Rules, fr)
+	}
+	sort.Slice(f.Rules, func(i, j int) bool { return f.Rules[i].Label < f.Rules[j].Label })
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o666)
+}
+
+// LoadIndexFile adds the rules listed in an index file written by
+// WriteIndexFile to ix. Labels of the rules are qualified with repoName,
+// the name of the other repository as seen from this one. If repoName is
+// empty, the repository name recorded in the file is used.
+//
+// LoadIndexFile must be called before Finish.
+func (ix *RuleIndex) LoadIndexFile(path, repoName string) error {
+	if ix.indexed {
+		return fmt.Errorf("LoadIndexFile called after Finish")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var f indexFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if f.Version != indexFileVersion {
+		return fmt.Errorf("%s: unsupported index file version %d; want %d", path, f.Version, indexFileVersion)
+	}
+	if repoName == "" {
+		repoName = f.Repo
+	}
+	if repoName == "" {
+		return fmt.Errorf("%s: index file doesn't name its repository; a repository name must be given", path)
+	}
+	for _, fr := range f.Rules {
+		l, err := parseIndexLabel(fr.Label, repoName)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		record := &ruleRecord{
+			Kind:       fr.Kind,
+			Label:      l,
+			Pkg:        l.Pkg,
+			ImportedAs: []ImportSpec{},
+			Lang:       fr.Lang,
+			loaded:     true,
+		}
+		for _, imp := range fr.Imports {
+			record.ImportedAs = append(record.ImportedAs, ImportSpec{Lang: imp.Lang, Imp: imp.Imp})
+		}
+		for _, e := range fr.Embeds {
+			el, err := parseIndexLabel(e, repoName)
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			record.Embeds = append(record.Embeds, el)
+		}
+		ix.rules = append(ix.rules, record)
+	}
+	return nil
+}
+
+// relLabel returns l without its repository name.
+func relLabel(l label.Label) label.Label {
+	l.Repo = ""
+	l.Canonical = false
+	return l
+}
+
+func parseIndexLabel(s, repoName string) (label.Label, error) {
+	l, err := label.Parse(s)
+	if err != nil {
+		return label.NoLabel, err
+	}
+	if l.Repo != "" || l.Relative {
+		return label.NoLabel, fmt.Errorf("label %q in index file must be an absolute label without a repository name", s)
+	}
+	l.Repo = repoName
+	return l, nil
+}
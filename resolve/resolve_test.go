@@ -1,10 +1,16 @@
 package resolve
 
 import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/repo"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 	"github.com/google/go-cmp/cmp"
 )
@@ -125,6 +131,261 @@ func TestFindRuleWithOverride_ParentTraversal(t *testing.T) {
 	}
 }
 
+func TestFindRuleWithOverride_Glob(t *testing.T) {
+	rootCfg := getConfig(t, "", []rule.Directive{
+		{Key: "resolve", Value: "go example.com/gen/** //gen:all_protos"},
+		{Key: "resolve", Value: "go example.com/gen/api/* //gen/api:api_protos"},
+		{Key: "resolve", Value: "go example.com/gen/api/v1 //gen/api/v1:exact"},
+		{Key: "resolve", Value: "go example.com/[bad* //bad:pattern"},
+	}, nil)
+
+	childCfg := getConfig(t, "child", []rule.Directive{
+		{Key: "resolve", Value: "go example.com/gen/** //child:all_protos"},
+		{Key: "resolve", Value: "proto go example.com/gen/** //child:proto_protos"},
+	}, rootCfg)
+
+	tests := []struct {
+		name       string
+		cfg        *config.Config
+		importSpec ImportSpec
+		lang       string
+		want       label.Label
+		wantFound  bool
+	}{
+		{
+			name:       "Double star matches nested path",
+			cfg:        rootCfg,
+			importSpec: ImportSpec{Lang: "go", Imp: "example.com/gen/foo/bar"},
+			lang:       "go",
+			want:       getTestLabel(t, "//gen:all_protos"),
+			wantFound:  true,
+		},
+		{
+			name:       "More specific pattern wins",
+			cfg:        rootCfg,
+			importSpec: ImportSpec{Lang: "go", Imp: "example.com/gen/api/v2"},
+			lang:       "go",
+			want:       getTestLabel(t, "//gen/api:api_protos"),
+			wantFound:  true,
+		},
+		{
+			name:       "Single star does not match nested path",
+			cfg:        rootCfg,
+			importSpec: ImportSpec{Lang: "go", Imp: "example.com/gen/api/v2/sub"},
+			lang:       "go",
+			want:       getTestLabel(t, "//gen:all_protos"),
+			wantFound:  true,
+		},
+		{
+			name:       "Exact match wins",
+			cfg:        rootCfg,
+			importSpec: ImportSpec{Lang: "go", Imp: "example.com/gen/api/v1"},
+			lang:       "go",
+			want:       getTestLabel(t, "//gen/api/v1:exact"),
+			wantFound:  true,
+		},
+		{
+			name:       "Invalid pattern is ignored",
+			cfg:        rootCfg,
+			importSpec: ImportSpec{Lang: "go", Imp: "example.com/[bad"},
+			lang:       "go",
+			want:       label.NoLabel,
+			wantFound:  false,
+		},
+		{
+			name:       "Later pattern wins tie",
+			cfg:        childCfg,
+			importSpec: ImportSpec{Lang: "go", Imp: "example.com/gen/foo"},
+			lang:       "go",
+			want:       getTestLabel(t, "//child:all_protos"),
+			wantFound:  true,
+		},
+		{
+			name:       "Import language must match",
+			cfg:        childCfg,
+			importSpec: ImportSpec{Lang: "proto", Imp: "example.com/gen/foo"},
+			lang:       "go",
+			want:       getTestLabel(t, "//child:proto_protos"),
+			wantFound:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := FindRuleWithOverride(tt.cfg, tt.importSpec, tt.lang)
+			if found != tt.wantFound {
+				t.Fatalf("FindRuleWithOverride() found = %v, wantFound %v", found, tt.wantFound)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("FindRuleWithOverride() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFinishReportsDuplicates(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		report bool
+		want   string
+	}{
+		{
+			name: "off",
+		}, {
+			name:   "on",
+			report: true,
+			want:   `import "example.com/repo/foo" is provided by fake_library rules in multiple packages: //foo, //old/foo. Consider keeping only //foo, or use # gazelle:resolve to choose one.`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			defer log.SetOutput(log.Writer())
+			defer log.SetFlags(log.Flags())
+			log.SetOutput(&buf)
+			log.SetFlags(0)
+
+			c := &config.Config{}
+			ix := NewRuleIndex(func(r *rule.Rule, pkgRel string) Resolver { return importpathResolver{} })
+			ix.ReportDuplicates = tc.report
+			for _, lib := range []struct{ pkg, name, importpath string }{
+				{"old/foo", "foo", "example.com/repo/foo"},
+				{"foo", "foo", "example.com/repo/foo"},
+				{"bar", "bar", "example.com/repo/bar"},
+				{"bar", "bar_alias", "example.com/repo/bar"},
+				{"vendor/example.com/baz", "baz", "example.com/baz"},
+				{"third_party/baz", "baz", "example.com/baz"},
+			} {
+				f := rule.EmptyFile(lib.pkg+"/BUILD.bazel", lib.pkg)
+				r := rule.NewRule("fake_library", lib.name)
+				r.SetAttr("importpath", lib.importpath)
+				ix.AddRule(c, r, f)
+			}
+			ix.Finish()
+
+			if got := strings.TrimSpace(buf.String()); got != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFindRulesByGeneratedSrcDir(t *testing.T) {
+	c := &config.Config{}
+	ix := NewRuleIndex(func(r *rule.Rule, pkgRel string) Resolver { return importpathResolver{} })
+	genFile := rule.EmptyFile("gen/BUILD.bazel", "gen")
+	gen := rule.NewRule("genrule", "gen")
+	gen.SetAttr("outs", []string{"a/a.go", "b/b.go"})
+	ix.AddRule(c, gen, genFile)
+	single := rule.NewRule("genrule", "single")
+	single.SetAttr("out", "c.go")
+	ix.AddRule(c, single, genFile)
+
+	libFile := rule.EmptyFile("lib/BUILD.bazel", "lib")
+	byRule := rule.NewRule("fake_library", "by_rule")
+	byRule.SetAttr("srcs", []string{"//gen"})
+	ix.AddRule(c, byRule, libFile)
+	byFile := rule.NewRule("fake_library", "by_file")
+	byFile.SetAttr("srcs", []string{"//gen:c.go", "static.go"})
+	ix.AddRule(c, byFile, libFile)
+	samePath := rule.NewRule("fake_library", "same_path")
+	samePath.SetAttr("srcs", []string{"//gen:a/a.go"})
+	samePath.SetAttr("importpath", "example.com/gen/a")
+	ix.AddRule(c, samePath, libFile)
+	otherPath := rule.NewRule("fake_library", "other_path")
+	otherPath.SetAttr("srcs", []string{"//gen:b/b.go"})
+	otherPath.SetAttr("importpath", "example.com/other")
+	ix.AddRule(c, otherPath, libFile)
+	ix.Finish()
+
+	for _, tc := range []struct {
+		dir, imp string
+		want     []string
+	}{
+		{dir: "gen/a", imp: "example.com/gen/a", want: []string{"//lib:by_rule", "//lib:same_path"}},
+		{dir: "gen/b", imp: "example.com/gen/b", want: []string{"//lib:by_rule"}},
+		{dir: "gen", imp: "example.com/gen", want: []string{"//lib:by_file"}},
+		{dir: "lib", imp: "example.com/lib"},
+	} {
+		var got []string
+		for _, r := range ix.FindRulesByGeneratedSrcDir("", tc.dir, ImportSpec{Lang: "fake", Imp: tc.imp}, "fake") {
+			got = append(got, r.Label.String())
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("%s (-want,+got):\n%s", tc.dir, diff)
+		}
+	}
+}
+
+func TestIndexFile(t *testing.T) {
+	dir := t.TempDir()
+	newIndex := func(libs ...[3]string) *RuleIndex {
+		ix := NewRuleIndex(func(r *rule.Rule, pkgRel string) Resolver { return importpathResolver{} })
+		for _, lib := range libs {
+			f := rule.EmptyFile(lib[0]+"/BUILD.bazel", lib[0])
+			r := rule.NewRule("fake_library", lib[1])
+			r.SetAttr("importpath", lib[2])
+			ix.AddRule(&config.Config{}, r, f)
+		}
+		return ix
+	}
+
+	other := newIndex([3]string{"foo", "foo", "example.com/other/foo"})
+	if err := other.LoadIndexFile(filepath.Join(dir, "missing.json"), "x"); err == nil {
+		t.Error("LoadIndexFile with missing file: got success; want error")
+	}
+	other.Finish()
+	otherPath := filepath.Join(dir, "other.json")
+	if err := other.WriteIndexFile(otherPath, "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		repo, want string
+	}{
+		{repo: "", want: "@other//foo"},
+		{repo: "renamed", want: "@renamed//foo"},
+	} {
+		ix := newIndex([3]string{"bar", "bar", "example.com/repo/bar"})
+		if err := ix.LoadIndexFile(otherPath, tc.repo); err != nil {
+			t.Fatal(err)
+		}
+		ix.Finish()
+		var got []string
+		for _, r := range ix.FindRulesByImport(ImportSpec{Lang: "fake", Imp: "example.com/other/foo"}, "fake") {
+			got = append(got, r.Label.String())
+		}
+		if diff := cmp.Diff([]string{tc.want}, got); diff != "" {
+			t.Errorf("repo %q (-want,+got):\n%s", tc.repo, diff)
+		}
+
+		// Rules loaded from other index files aren't written again.
+		path := filepath.Join(dir, "repo.json")
+		if err := ix.WriteIndexFile(path, ""); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), `"//bar"`) || strings.Contains(string(data), "foo") {
+			t.Errorf("got index file:\n%s", data)
+		}
+	}
+}
+
+type importpathResolver struct{}
+
+func (importpathResolver) Name() string { return "fake" }
+
+func (importpathResolver) Imports(c *config.Config, r *rule.Rule, f *rule.File) []ImportSpec {
+	return []ImportSpec{{Lang: "fake", Imp: r.AttrString("importpath")}}
+}
+
+func (importpathResolver) Embeds(r *rule.Rule, from label.Label) []label.Label { return nil }
+
+func (importpathResolver) Resolve(c *config.Config, ix *RuleIndex, rc *repo.RemoteCache, r *rule.Rule, imports interface{}, from label.Label) {
+}
+
 func getConfig(t *testing.T, path string, directives []rule.Directive, parent *config.Config) *config.Config {
 	cfg := &config.Config{
 		Exts: map[string]interface{}{},
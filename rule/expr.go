@@ -112,7 +112,7 @@ func MapExprStrings(e bzl.Expr, f func(string) string) bzl.Expr {
 // expressions. If the expression could not have been generted by
 // PlatformStrings, the expression will be returned unmodified.
 func FlattenExpr(e bzl.Expr) bzl.Expr {
-	ps, err := extractPlatformStringsExprs(e)
+	ps, err := extractPlatformStringsExprs(e, nil)
 	if err != nil {
 		return e
 	}
@@ -152,7 +152,7 @@ func FlattenExpr(e bzl.Expr) bzl.Expr {
 			return e
 		}
 	}
-	for _, d := range []*bzl.DictExpr{ps.os, ps.arch, ps.platform} {
+	for _, d := range append([]*bzl.DictExpr{ps.os, ps.arch, ps.platform}, ps.tags...) {
 		if d == nil {
 			continue
 		}
@@ -164,6 +164,27 @@ func FlattenExpr(e bzl.Expr) bzl.Expr {
 	return ls.list()
 }
 
+// tagCondition returns the condition of a select for a custom build tag,
+// which has exactly one case other than the default. It returns "" if dict
+// has any other form.
+func tagCondition(dict *bzl.DictExpr) string {
+	cond := ""
+	for _, kv := range dict.List {
+		k, ok := kv.Key.(*bzl.StringExpr)
+		if !ok {
+			return ""
+		}
+		if k.Value == "//conditions:default" {
+			continue
+		}
+		if cond != "" {
+			return ""
+		}
+		cond = k.Value
+	}
+	return cond
+}
+
 func isScalar(e bzl.Expr) bool {
 	switch e.(type) {
 	case *bzl.StringExpr, *bzl.LiteralExpr, *bzl.Ident:
@@ -207,18 +228,23 @@ func stringValue(e bzl.Expr) string {
 // [] + select({}) + select({}) + select({})
 //
 // The four collections may appear in any order, and some or all of them may
-// be omitted (all fields are nil for a nil expression).
+// be omitted (all fields are nil for a nil expression). They may be followed
+// by selects for custom build tags, each with a single condition other than
+// the default, which must be the config_setting of a tag declared with
+// # gazelle:go_build_tag.
 type platformStringsExprs struct {
 	generic            *bzl.ListExpr
 	os, arch, platform *bzl.DictExpr
+	tags               []*bzl.DictExpr
 }
 
 // extractPlatformStringsExprs matches an expression and attempts to extract
 // sub-expressions in platformStringsExprs. The sub-expressions can then be
 // merged with corresponding sub-expressions. Any field in the returned
 // structure may be nil. An error is returned if the given expression does
-// not follow the pattern described by platformStringsExprs.
-func extractPlatformStringsExprs(expr bzl.Expr) (platformStringsExprs, error) {
+// not follow the pattern described by platformStringsExprs. Selects are only
+// matched as selects for custom build tags if their condition is in tagConds.
+func extractPlatformStringsExprs(expr bzl.Expr, tagConds map[string]bool) (platformStringsExprs, error) {
 	var ps platformStringsExprs
 	if expr == nil {
 		return ps, nil
@@ -254,6 +280,10 @@ func extractPlatformStringsExprs(expr bzl.Expr) (platformStringsExprs, error) {
 			if !ok {
 				return platformStringsExprs{}, fmt.Errorf("expression could not be matched: select argument not dict")
 			}
+			if cond := tagCondition(arg); cond != "" && tagConds[cond] {
+				ps.tags = append(ps.tags, arg)
+				continue
+			}
 			var dict **bzl.DictExpr
 			for _, kv := range arg.List {
 				k, ok := kv.Key.(*bzl.StringExpr)
@@ -328,6 +358,9 @@ func makePlatformStringsExpr(ps platformStringsExprs) bzl.Expr {
 	if ps.platform != nil {
 		parts = append(parts, makeSelect(ps.platform))
 	}
+	for _, tag := range ps.tags {
+		parts = append(parts, makeSelect(tag))
+	}
 
 	if len(parts) == 0 {
 		return nil
@@ -0,0 +1,142 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"bytes"
+
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// formatPreserving formats the file like bzl.Format, except that top-level
+// statements that weren't changed since the file was loaded are copied from
+// Content byte for byte, along with the text between statements that were
+// adjacent in Content. Only inserted and changed statements are
+// reformatted, so files that aren't formatted with buildifier don't get
+// unrelated changes.
+//
+// A statement is unchanged if it formats the same way as the statement at
+// the same position in Content. Sync must be called first.
+func (f *File) formatPreserving() []byte {
+	orig, err := parseLike(f.File, f.Content)
+	if len(f.Content) == 0 || err != nil {
+		return bzl.Format(f.File)
+	}
+	origIndexByStart := make(map[int]int)
+	for i, stmt := range orig.Stmt {
+		origIndexByStart[stmtStart(stmt)] = i
+	}
+
+	var buf bytes.Buffer
+	// prevOrig is the index in orig.Stmt of the previous statement, or -1 if
+	// it was inserted.
+	prevOrig, prevCopied := -1, false
+	var prev bzl.Expr
+	for _, stmt := range f.File.Stmt {
+		cur, copied := -1, false
+		text := formatStmt(f.File.Type, stmt)
+		if start, _ := stmt.Span(); start.Line > 0 {
+			if i, ok := origIndexByStart[stmtStart(stmt)]; ok {
+				cur = i
+				copied = bytes.Equal(text, formatStmt(orig.Type, orig.Stmt[i]))
+			}
+		}
+
+		switch {
+		case cur >= 0 && prevOrig >= 0 && cur == prevOrig+1 && bytes.HasPrefix(f.Content[stmtEnd(orig.Stmt[prevOrig]):], []byte("\n")):
+			// Copy the text between statements that were adjacent, except for
+			// the newline already written after the previous statement.
+			buf.Write(f.Content[stmtEnd(orig.Stmt[prevOrig])+1 : stmtStart(orig.Stmt[cur])])
+		case prev == nil && cur == 0:
+			buf.Write(f.Content[:stmtStart(orig.Stmt[cur])])
+		case prev != nil:
+			buf.Write(stmtSeparator(f.File.Type, prev, stmt))
+		}
+		if copied {
+			buf.Write(f.Content[stmtStart(orig.Stmt[cur]):stmtEnd(orig.Stmt[cur])])
+			buf.WriteByte('\n')
+		} else {
+			buf.Write(text)
+		}
+		prev, prevOrig, prevCopied = stmt, cur, copied
+	}
+
+	if prevCopied && prevOrig == len(orig.Stmt)-1 {
+		if tail := f.Content[stmtEnd(orig.Stmt[prevOrig]):]; bytes.HasPrefix(tail, []byte("\n")) {
+			buf.Write(tail[1:])
+		}
+	} else if after := f.File.Comment().After; len(after) > 0 {
+		buf.Write(bzl.Format(&bzl.File{Type: f.File.Type, Comments: bzl.Comments{After: after}}))
+	}
+	return buf.Bytes()
+}
+
+// parseLike parses data as the same type of file as f.
+func parseLike(f *bzl.File, data []byte) (*bzl.File, error) {
+	switch f.Type {
+	case bzl.TypeWorkspace:
+		return bzl.ParseWorkspace(f.Path, data)
+	case bzl.TypeModule:
+		return bzl.ParseModule(f.Path, data)
+	case bzl.TypeBzl:
+		return bzl.ParseBzl(f.Path, data)
+	case bzl.TypeDefault:
+		return bzl.ParseDefault(f.Path, data)
+	default:
+		return bzl.ParseBuild(f.Path, data)
+	}
+}
+
+// formatStmt formats a top-level statement with its comments.
+func formatStmt(fileType bzl.FileType, stmt bzl.Expr) []byte {
+	return bzl.Format(&bzl.File{Type: fileType, Stmt: []bzl.Expr{stmt}})
+}
+
+// stmtSeparator returns the text bzl.Format writes between the statements s1
+// and s2, after the newline that ends s1.
+func stmtSeparator(fileType bzl.FileType, s1, s2 bzl.Expr) []byte {
+	both := bzl.Format(&bzl.File{Type: fileType, Stmt: []bzl.Expr{s1, s2}})
+	n := len(both) - len(formatStmt(fileType, s1)) - len(formatStmt(fileType, s2))
+	return bytes.Repeat([]byte("\n"), n)
+}
+
+// stmtStart returns the byte offset where stmt begins in the file it was
+// parsed from, including comments before it.
+func stmtStart(stmt bzl.Expr) int {
+	start, _ := stmt.Span()
+	offset := start.Byte
+	for _, c := range stmt.Comment().Before {
+		if c.Start.Byte < offset {
+			offset = c.Start.Byte
+		}
+	}
+	return offset
+}
+
+// stmtEnd returns the byte offset where stmt ends in the file it was parsed
+// from, including comments after it.
+func stmtEnd(stmt bzl.Expr) int {
+	_, end := stmt.Span()
+	offset := end.Byte
+	for _, comments := range [][]bzl.Comment{stmt.Comment().Suffix, stmt.Comment().After} {
+		for _, c := range comments {
+			if e := c.Start.Byte + len(c.Token); e > offset {
+				offset = e
+			}
+		}
+	}
+	return offset
+}
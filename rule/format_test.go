@@ -0,0 +1,117 @@
+/* Copyright 2026 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rule
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPreserveFormatting(t *testing.T) {
+	old := `# Hand-written.
+load("a.bzl", "x_library", "y_library")
+load("b.bzl",   "z_library")
+x_library(name="keep", srcs=[ "b.x",
+    "a.x" ])  # trailing
+
+
+# Changed below.
+y_library(name="change", srcs=["a.y"])
+y_library(name = "delete")
+z_library(
+  name="untouched_too",
+)
+# End of file.
+`
+	for _, tc := range []struct {
+		desc string
+		edit func(f *File)
+		want string
+	}{
+		{
+			desc: "unchanged",
+			edit: func(f *File) {
+				// Setting an attribute to its current value isn't a change.
+				f.Rules[3].SetAttr("name", "untouched_too")
+			},
+			want: old,
+		}, {
+			desc: "changed",
+			edit: func(f *File) {
+				f.Rules[1].SetAttr("srcs", []string{"a.y", "b.y"})
+				f.Rules[2].Delete()
+				r := NewRule("x_library", "new")
+				r.Insert(f)
+			},
+			want: `# Hand-written.
+load("a.bzl", "x_library", "y_library")
+load("b.bzl",   "z_library")
+x_library(name="keep", srcs=[ "b.x",
+    "a.x" ])  # trailing
+
+
+# Changed below.
+y_library(
+    name = "change",
+    srcs = [
+        "a.y",
+        "b.y",
+    ],
+)
+
+z_library(
+  name="untouched_too",
+)
+# End of file.
+
+x_library(name = "new")
+`,
+		}, {
+			desc: "load",
+			edit: func(f *File) {
+				f.Loads[1].Add("w_library")
+			},
+			want: `# Hand-written.
+load("a.bzl", "x_library", "y_library")
+load("b.bzl", "w_library", "z_library")
+x_library(name="keep", srcs=[ "b.x",
+    "a.x" ])  # trailing
+
+
+# Changed below.
+y_library(name="change", srcs=["a.y"])
+y_library(name = "delete")
+z_library(
+  name="untouched_too",
+)
+# End of file.
+`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			f, err := LoadData("BUILD.bazel", "", []byte(old))
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.PreserveFormatting = true
+			tc.edit(f)
+			if diff := cmp.Diff(tc.want, string(f.Format())); diff != "" {
+				t.Errorf("(-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
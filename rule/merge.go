@@ -45,13 +45,14 @@ func MergeRules(src, dst *Rule, mergeable map[string]bool, filename string) {
 	if dst.ShouldKeep() {
 		return
 	}
+	tagConds, _ := src.PrivateAttr(BuildTagConditionsKey).(map[string]bool)
 
 	// Process attributes that are in dst but not in src.
 	for key, dstAttr := range dst.attrs {
 		if _, ok := src.attrs[key]; ok || !mergeable[key] || ShouldKeep(dstAttr.expr) {
 			continue
 		}
-		if mergedValue, err := mergeAttrValues(nil, &dstAttr); err != nil {
+		if mergedValue, err := mergeAttrValues(nil, &dstAttr, tagConds); err != nil {
 			start, end := dstAttr.expr.RHS.Span()
 			log.Printf("%s:%d.%d-%d.%d: could not merge expression", filename, start.Line, start.LineRune, end.Line, end.LineRune)
 		} else if mergedValue == nil {
@@ -65,14 +66,16 @@ func MergeRules(src, dst *Rule, mergeable map[string]bool, filename string) {
 	for key, srcAttr := range src.attrs {
 		if dstAttr, ok := dst.attrs[key]; !ok {
 			dst.SetAttr(key, srcAttr.expr.RHS)
+			mergeAttrComments(srcAttr.expr.Comment(), dst.attrs[key].expr.Comment())
 		} else if mergeable[key] && !ShouldKeep(dstAttr.expr) {
-			if mergedValue, err := mergeAttrValues(&srcAttr, &dstAttr); err != nil {
+			if mergedValue, err := mergeAttrValues(&srcAttr, &dstAttr, tagConds); err != nil {
 				start, end := dstAttr.expr.RHS.Span()
 				log.Printf("%s:%d.%d-%d.%d: could not merge expression", filename, start.Line, start.LineRune, end.Line, end.LineRune)
 			} else if mergedValue == nil {
 				dst.DelAttr(key)
 			} else {
 				dst.SetAttr(key, mergedValue)
+				mergeAttrComments(srcAttr.expr.Comment(), dstAttr.expr.Comment())
 			}
 		}
 	}
@@ -80,6 +83,19 @@ func MergeRules(src, dst *Rule, mergeable map[string]bool, filename string) {
 	dst.private = src.private
 }
 
+// mergeAttrComments replaces the comments attached to a dst attribute with
+// the comments attached to the corresponding src attribute, at each position
+// where src has comments. Comments at other positions are preserved, so
+// comments written by hand are kept unless the generated rule replaces them.
+func mergeAttrComments(src, dst *bzl.Comments) {
+	if len(src.Before) > 0 {
+		dst.Before = append([]bzl.Comment(nil), src.Before...)
+	}
+	if len(src.Suffix) > 0 {
+		dst.Suffix = append([]bzl.Comment(nil), src.Suffix...)
+	}
+}
+
 // mergeAttrValues combines information from src and dst and returns a merged
 // expression. dst may be modified during this process. The returned expression
 // may be different from dst when a structural change is needed.
@@ -95,9 +111,12 @@ func MergeRules(src, dst *Rule, mergeable map[string]bool, filename string) {
 //     be the left operand.
 //   * an attr value that implements the Merger interface.
 //
+// Selects with a single condition other than the default are also
+// recognized if the condition is in tagConds.
+//
 // An error is returned if the expressions can't be merged, for example
 // because they are not in one of the above formats.
-func mergeAttrValues(srcAttr, dstAttr *attrValue) (bzl.Expr, error) {
+func mergeAttrValues(srcAttr, dstAttr *attrValue, tagConds map[string]bool) (bzl.Expr, error) {
 	if ShouldKeep(dstAttr.expr.RHS) {
 		return nil, nil
 	}
@@ -121,13 +140,13 @@ func mergeAttrValues(srcAttr, dstAttr *attrValue) (bzl.Expr, error) {
 	var srcExprs platformStringsExprs
 	var err error
 	if srcAttr != nil {
-		srcExprs, err = extractPlatformStringsExprs(srcAttr.expr.RHS)
+		srcExprs, err = extractPlatformStringsExprs(srcAttr.expr.RHS, tagConds)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	dstExprs, err := extractPlatformStringsExprs(dst)
+	dstExprs, err := extractPlatformStringsExprs(dst, tagConds)
 	if err != nil {
 		return nil, err
 	}
@@ -151,9 +170,49 @@ func mergePlatformStringsExprs(src, dst platformStringsExprs) (platformStringsEx
 	if ps.platform, err = MergeDict(src.platform, dst.platform); err != nil {
 		return platformStringsExprs{}, err
 	}
+	if ps.tags, err = mergeTagDicts(src.tags, dst.tags, MergeDict); err != nil {
+		return platformStringsExprs{}, err
+	}
 	return ps, nil
 }
 
+// mergeTagDicts combines selects for custom build tags in src and dst with
+// the same condition using merge. Selects only in src or only in dst are
+// passed to merge with a nil counterpart. Empty results are dropped.
+func mergeTagDicts(src, dst []*bzl.DictExpr, merge func(src, dst bzl.Expr) (*bzl.DictExpr, error)) ([]*bzl.DictExpr, error) {
+	dstByCond := make(map[string]*bzl.DictExpr)
+	for _, d := range dst {
+		dstByCond[tagCondition(d)] = d
+	}
+	var merged []*bzl.DictExpr
+	add := func(s, d *bzl.DictExpr) error {
+		m, err := merge(s, d)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			merged = append(merged, m)
+		}
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, s := range src {
+		cond := tagCondition(s)
+		seen[cond] = true
+		if err := add(s, dstByCond[cond]); err != nil {
+			return nil, err
+		}
+	}
+	for _, d := range dst {
+		if !seen[tagCondition(d)] {
+			if err := add(nil, d); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return merged, nil
+}
+
 // MergeList merges two bzl.ListExpr of strings. The lists are merged in the
 // following way:
 //
@@ -183,10 +242,10 @@ func MergeList(srcExpr, dstExpr bzl.Expr) *bzl.ListExpr {
 	// Build a list of strings from the src list and keep matching strings
 	// in the dst list. This preserves comments. Also keep anything with
 	// a "# keep" comment, whether or not it's in the src list.
-	srcSet := make(map[string]bool)
+	srcSet := make(map[string]bzl.Expr)
 	for _, v := range src.List {
 		if s := stringValue(v); s != "" {
-			srcSet[s] = true
+			srcSet[s] = v
 		}
 	}
 
@@ -195,8 +254,20 @@ func MergeList(srcExpr, dstExpr bzl.Expr) *bzl.ListExpr {
 	keepComment := false
 	for _, v := range dst.List {
 		s := stringValue(v)
-		if keep := ShouldKeep(v); keep || srcSet[s] {
+		srcValue := srcSet[s]
+		if keep := ShouldKeep(v); keep || srcValue != nil {
 			keepComment = keepComment || keep
+			if !keep && srcValue != nil {
+				// Import comments describe how the value was generated, so
+				// they're replaced, or dropped if src doesn't have them.
+				// Other suffix comments take precedence, since only one
+				// fits on a line.
+				srcComments := importComments(srcValue.Comment().Suffix)
+				c := v.Comment()
+				if c.Suffix = filterImportComments(c.Suffix); len(c.Suffix) == 0 {
+					c.Suffix = srcComments
+				}
+			}
 			merged = append(merged, v)
 			if s != "" {
 				kept[s] = true
@@ -288,11 +359,11 @@ func MergeDict(srcExpr, dstExpr bzl.Expr) (*bzl.DictExpr, error) {
 	if len(keys) == 0 && (!haveDefault || len(entryMap["//conditions:default"].mergedValue.List) == 0) {
 		return nil, nil
 	}
-	sort.Strings(keys)
-	// Always put the default case last.
 	if haveDefault {
 		keys = append(keys, "//conditions:default")
 	}
+	// The default case always comes last.
+	sort.Slice(keys, func(i, j int) bool { return selectConditionLess(keys[i], keys[j]) })
 
 	mergedEntries := make([]*bzl.KeyValueExpr, len(keys))
 	for i, k := range keys {
@@ -315,11 +386,20 @@ type dictEntry struct {
 // information in dst. SquashRules detects duplicate elements in lists and
 // dictionaries, but it doesn't sort elements after squashing. If squashing
 // fails because the expression is not understood, an error is returned,
-// and neither rule is modified.
+// and neither rule is modified. Selects on the conditions in the
+// BuildTagConditionsKey private attribute of either rule are squashed as
+// selects for custom build tags.
 func SquashRules(src, dst *Rule, filename string) error {
 	if dst.ShouldKeep() {
 		return nil
 	}
+	tagConds := make(map[string]bool)
+	for _, r := range []*Rule{src, dst} {
+		conds, _ := r.PrivateAttr(BuildTagConditionsKey).(map[string]bool)
+		for cond := range conds {
+			tagConds[cond] = true
+		}
+	}
 
 	for key, srcAttr := range src.attrs {
 		srcValue := srcAttr.expr.RHS
@@ -327,7 +407,7 @@ func SquashRules(src, dst *Rule, filename string) error {
 			dst.SetAttr(key, srcValue)
 		} else if !ShouldKeep(dstAttr.expr) {
 			dstValue := dstAttr.expr.RHS
-			if squashedValue, err := squashExprs(srcValue, dstValue); err != nil {
+			if squashedValue, err := squashExprs(srcValue, dstValue, tagConds); err != nil {
 				start, end := dstValue.Span()
 				return fmt.Errorf("%s:%d.%d-%d.%d: could not squash expression", filename, start.Line, start.LineRune, end.Line, end.LineRune)
 			} else {
@@ -341,7 +421,7 @@ func SquashRules(src, dst *Rule, filename string) error {
 	return nil
 }
 
-func squashExprs(src, dst bzl.Expr) (bzl.Expr, error) {
+func squashExprs(src, dst bzl.Expr, tagConds map[string]bool) (bzl.Expr, error) {
 	if ShouldKeep(dst) {
 		return dst, nil
 	}
@@ -349,11 +429,11 @@ func squashExprs(src, dst bzl.Expr) (bzl.Expr, error) {
 		// may lose src, but they should always be the same.
 		return dst, nil
 	}
-	srcExprs, err := extractPlatformStringsExprs(src)
+	srcExprs, err := extractPlatformStringsExprs(src, tagConds)
 	if err != nil {
 		return nil, err
 	}
-	dstExprs, err := extractPlatformStringsExprs(dst)
+	dstExprs, err := extractPlatformStringsExprs(dst, tagConds)
 	if err != nil {
 		return nil, err
 	}
@@ -379,6 +459,14 @@ func squashPlatformStringsExprs(x, y platformStringsExprs) (platformStringsExprs
 	if ps.platform, err = squashDict(x.platform, y.platform); err != nil {
 		return platformStringsExprs{}, err
 	}
+	squash := func(x, y bzl.Expr) (*bzl.DictExpr, error) {
+		xd, _ := x.(*bzl.DictExpr)
+		yd, _ := y.(*bzl.DictExpr)
+		return squashDict(xd, yd)
+	}
+	if ps.tags, err = mergeTagDicts(x.tags, y.tags, squash); err != nil {
+		return platformStringsExprs{}, err
+	}
 	return ps, nil
 }
 
@@ -16,6 +16,7 @@ limitations under the License.
 package rule_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/bazelbuild/bazel-gazelle/rule"
@@ -147,3 +148,288 @@ func TestMergeRules_WithUnsortedStringAttr(t *testing.T) {
 		}
 	})
 }
+
+func TestMergeRules_AttrComments(t *testing.T) {
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+go_library(
+    name = "lib",
+    # generated from old.go
+    srcs = ["old.go"],
+    importpath = "example.com/lib",  # set by hand
+    deps = ["//dep"],  # hand-written suffix
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := f.Rules[0]
+
+	src := rule.NewRule("go_library", "lib")
+	src.SetAttr("srcs", []string{"new.go"})
+	src.SetAttrComment("srcs", rule.CommentBefore, "# generated from new.go")
+	src.SetAttr("importpath", "example.com/lib")
+	src.SetAttrComment("importpath", rule.CommentSuffix, "# generated")
+	src.SetAttr("deps", []string{"//dep"})
+	src.SetAttr("embed", []string{":embed"})
+	src.SetAttrComment("embed", rule.CommentSuffix, "# generated from embed.go")
+	src.SetAttrComment("missing", rule.CommentBefore, "# ignored")
+	rule.MergeRules(src, dst, map[string]bool{"srcs": true, "deps": true, "embed": true}, "")
+
+	got := string(f.Format())
+	want := `go_library(
+    name = "lib",
+    # generated from new.go
+    srcs = ["new.go"],
+    embed = [":embed"],  # generated from embed.go
+    importpath = "example.com/lib",  # set by hand
+    deps = ["//dep"],  # hand-written suffix
+)
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	dst.SetAttrComment("srcs", rule.CommentBefore)
+	if c := dst.AttrComments("srcs"); len(c.Before) != 0 {
+		t.Errorf("got comments %v before srcs after clearing them; want none", c.Before)
+	}
+}
+
+func TestMergeRules_ImportComments(t *testing.T) {
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+go_library(
+    name = "lib",
+    deps = [
+        "//a",  # import "example.com/old"
+        "//b",  # set by hand
+        "//c",  # import "example.com/c"
+        "//d",  # import side effects, see b/123
+    ],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := f.Rules[0]
+
+	src := rule.NewRule("go_library", "lib")
+	src.SetAttr("deps", []string{"//a", "//b", "//c", "//d"})
+	src.SetImportComments("deps", map[string][]string{
+		"//a": {"example.com/a/y", "example.com/a/x", "example.com/a/x"},
+		"//b": {"example.com/b"},
+	})
+	rule.MergeRules(src, dst, map[string]bool{"deps": true}, "")
+
+	got := string(f.Format())
+	want := `go_library(
+    name = "lib",
+    deps = [
+        "//a",  # import "example.com/a/x", "example.com/a/y"
+        "//b",  # set by hand
+        "//c",
+        "//d",  # import side effects, see b/123
+    ],
+)
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMergeRules_AttrGroups(t *testing.T) {
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+go_library(
+    name = "lib",
+    deps = [
+        # set by hand
+        "//a",
+        # group: external
+        "//b",
+        "@c",  # keep
+    ],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := f.Rules[0]
+
+	src := rule.NewRule("go_library", "lib")
+	src.SetAttr("deps", []string{"@d", "//b", "//a"})
+	src.SetAttrGroups("deps", func(s string) rule.StringGroup {
+		if strings.HasPrefix(s, "@") {
+			return rule.StringGroup{Order: 1, Name: "external"}
+		}
+		return rule.StringGroup{Order: 0, Name: "internal"}
+	})
+	rule.MergeRules(src, dst, map[string]bool{"deps": true}, "")
+
+	got := string(f.Format())
+	want := `go_library(
+    name = "lib",
+    deps = [
+        # set by hand
+        # group: internal
+        "//a",
+        "//b",
+        # group: external
+        "@c",  # keep
+        "@d",
+    ],
+)
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMergeRules_TagSelects(t *testing.T) {
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`go_library(
+    name = "go_default_library",
+    deps = select({
+        "//build:a": ["//old"],
+        "//conditions:default": [],
+    }) + select({
+        "//build:b": ["//gone"],
+        "//conditions:default": [],
+    }),
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := rule.NewRule("go_library", "go_default_library")
+	src.SetAttr("deps", rule.PlatformStrings{
+		Generic: []string{"//common"},
+		Tags: map[string][]string{
+			"//build:a":  {"//new"},
+			"!//build:a": {"//fallback"},
+		},
+	})
+	src.SetPrivateAttr(rule.BuildTagConditionsKey, map[string]bool{"//build:a": true, "//build:b": true})
+	rule.MergeRules(src, f.Rules[0], map[string]bool{"deps": true}, "")
+
+	want := `go_library(
+    name = "go_default_library",
+    deps = [
+        "//common",
+    ] + select({
+        "//build:a": [
+            "//new",
+        ],
+        "//conditions:default": [
+            "//fallback",
+        ],
+    }),
+)
+`
+	if got := string(f.Format()); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMergeRules_UnconfiguredSelectPreserved(t *testing.T) {
+	input := `go_library(
+    name = "go_default_library",
+    deps = [
+        "//a",
+    ] + select({
+        "//build:custom": ["//x"],
+        "//conditions:default": [],
+    }),
+)
+`
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := rule.NewRule("go_library", "go_default_library")
+	src.SetAttr("deps", []string{"//b"})
+	rule.MergeRules(src, f.Rules[0], map[string]bool{"deps": true}, "")
+
+	if got := string(f.Format()); got != input {
+		t.Errorf("got:\n%s\nwant:\n%s", got, input)
+	}
+}
+
+func TestSquashRules_BuildTagSelect(t *testing.T) {
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`go_test(
+    name = "go_default_test",
+    srcs = ["a_test.go"] + select({
+        "//build:a": ["a_tag_test.go"],
+        "//conditions:default": [],
+    }),
+)
+
+go_test(
+    name = "go_default_xtest",
+    srcs = ["b_test.go"] + select({
+        "//build:a": ["b_tag_test.go"],
+        "//conditions:default": [],
+    }),
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	itest, xtest := f.Rules[0], f.Rules[1]
+	xtest.SetPrivateAttr(rule.BuildTagConditionsKey, map[string]bool{"//build:a": true})
+	if err := rule.SquashRules(xtest, itest, f.Path); err != nil {
+		t.Fatal(err)
+	}
+	xtest.Delete()
+
+	want := `go_test(
+    name = "go_default_test",
+    srcs = [
+        "a_test.go",
+        "b_test.go",
+    ] + select({
+        "//build:a": [
+            "a_tag_test.go",
+            "b_tag_test.go",
+        ],
+        "//conditions:default": [],
+    }),
+)
+`
+	if got := string(f.Format()); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMergeRules_GroupCommentsWithoutGroups(t *testing.T) {
+	f, err := rule.LoadData("BUILD.bazel", "", []byte(`
+go_library(
+    name = "lib",
+    deps = [
+        # group: written by hand
+        "//a",
+        "//b",
+    ],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := f.Rules[0]
+
+	src := rule.NewRule("go_library", "lib")
+	src.SetAttr("deps", []string{"//a", "//b", "//c"})
+	rule.MergeRules(src, dst, map[string]bool{"deps": true}, "")
+
+	got := string(f.Format())
+	want := `go_library(
+    name = "lib",
+    deps = [
+        # group: written by hand
+        "//a",
+        "//b",
+        "//c",
+    ],
+)
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -105,8 +105,12 @@ var KnownPlatforms = []Platform{
 	{"windows", "arm64"},
 }
 
+// OSAliases maps operating systems to other operating systems whose build
+// tags and file name suffixes they also match. Since Go 1.16, for example,
+// files named *_darwin.go are built for ios. This matches go/build.
 var OSAliases = map[string][]string{
 	"android": {"linux"},
+	"illumos": {"solaris"},
 	"ios":     {"darwin"},
 }
 
@@ -66,6 +66,12 @@ type PlatformStrings struct {
 	// Platform is a map from platform constraints to OS and
 	// architecture-specific strings.
 	Platform map[PlatformConstraint][]string
+
+	// Tags is a map from config_setting labels for custom build tags to
+	// strings that are only needed when the tag is set. Keys prefixed with
+	// "!" hold strings that are only needed when the tag is not set. Each
+	// label is written as a separate select expression.
+	Tags map[string][]string
 }
 
 // HasExt returns whether this set contains a file with the given extension.
@@ -74,7 +80,7 @@ func (ps *PlatformStrings) HasExt(ext string) bool {
 }
 
 func (ps *PlatformStrings) IsEmpty() bool {
-	return len(ps.Generic) == 0 && len(ps.OS) == 0 && len(ps.Arch) == 0 && len(ps.Platform) == 0
+	return len(ps.Generic) == 0 && len(ps.OS) == 0 && len(ps.Arch) == 0 && len(ps.Platform) == 0 && len(ps.Tags) == 0
 }
 
 // Flat returns all the strings in the set, sorted and de-duplicated.
@@ -98,6 +104,11 @@ func (ps *PlatformStrings) Flat() []string {
 			unique[s] = struct{}{}
 		}
 	}
+	for _, ss := range ps.Tags {
+		for _, s := range ss {
+			unique[s] = struct{}{}
+		}
+	}
 	flat := make([]string, 0, len(unique))
 	for s := range unique {
 		flat = append(flat, s)
@@ -133,6 +144,13 @@ func (ps *PlatformStrings) firstExtFile(ext string) string {
 			}
 		}
 	}
+	for _, fs := range ps.Tags {
+		for _, f := range fs {
+			if strings.HasSuffix(f, ext) {
+				return f
+			}
+		}
+	}
 	return ""
 }
 
@@ -209,6 +227,7 @@ func (ps *PlatformStrings) MapSlice(f func([]string) ([]string, error)) (Platfor
 		OS:       mapStringMap(ps.OS),
 		Arch:     mapStringMap(ps.Arch),
 		Platform: mapPlatformMap(ps.Platform),
+		Tags:     mapStringMap(ps.Tags),
 	}
 	return result, errors
 }
@@ -227,6 +246,9 @@ func (ps PlatformStrings) BzlExpr() bzl.Expr {
 	if len(ps.Platform) > 0 {
 		pieces = append(pieces, platformStringsPlatformDictExpr(ps.Platform))
 	}
+	if len(ps.Tags) > 0 {
+		pieces = append(pieces, platformStringsTagsExprs(ps.Tags)...)
+	}
 	if len(pieces) == 0 {
 		return &bzl.ListExpr{}
 	} else if len(pieces) == 1 {
@@ -260,3 +282,34 @@ func platformStringsPlatformDictExpr(m map[PlatformConstraint][]string) bzl.Expr
 	s["//conditions:default"] = nil
 	return s.BzlExpr()
 }
+
+// platformStringsTagsExprs returns a select expression for each custom build
+// tag in m, sorted by label. The strings needed when the tag is not set are
+// in the default case.
+func platformStringsTagsExprs(m map[string][]string) []bzl.Expr {
+	labels := make(map[string]bool)
+	for key := range m {
+		labels[strings.TrimPrefix(key, "!")] = true
+	}
+	sorted := make([]string, 0, len(labels))
+	for l := range labels {
+		sorted = append(sorted, l)
+	}
+	sort.Strings(sorted)
+	exprs := make([]bzl.Expr, 0, len(sorted))
+	for _, l := range sorted {
+		sel := SelectStringListValue{
+			l:                      m[l],
+			"//conditions:default": m["!"+l],
+		}.BzlExpr()
+		// Unlike platform selects, the default case may have strings, which
+		// are formatted like the other case.
+		for _, kv := range sel.(*bzl.CallExpr).List[0].(*bzl.DictExpr).List {
+			if list, ok := kv.Value.(*bzl.ListExpr); ok && len(list.List) > 0 {
+				list.ForceMultiLine = true
+			}
+		}
+		exprs = append(exprs, sel)
+	}
+	return exprs
+}
@@ -31,6 +31,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	bzl "github.com/bazelbuild/buildtools/build"
@@ -77,6 +78,13 @@ type File struct {
 	// is modified outside of Rule methods, Content must be manually updated in
 	// order to keep it in sync.
 	Content []byte
+
+	// PreserveFormatting, when true, makes Format and Save copy top-level
+	// statements that weren't changed from Content as they are, instead of
+	// formatting the whole file. Inserted and changed statements are still
+	// formatted. This avoids unrelated changes in files that aren't
+	// formatted with buildifier.
+	PreserveFormatting bool
 }
 
 // EmptyFile creates a File wrapped around an empty syntax tree.
@@ -400,9 +408,13 @@ func updateStmt(oldStmt *[]bzl.Expr, inserts, deletes, stmts []*stmt) {
 }
 
 // Format formats the build file in a form that can be written to disk.
-// This method calls Sync internally.
+// This method calls Sync internally. If PreserveFormatting is set, only
+// statements that changed are formatted.
 func (f *File) Format() []byte {
 	f.Sync()
+	if f.PreserveFormatting {
+		return f.formatPreserving()
+	}
 	return bzl.Format(f.File)
 }
 
@@ -422,8 +434,7 @@ func (f *File) SortMacro() {
 
 // Save writes the build file to disk. This method calls Sync internally.
 func (f *File) Save(path string) error {
-	f.Sync()
-	f.Content = bzl.Format(f.File)
+	f.Content = f.Format()
 	return os.WriteFile(path, f.Content, 0o666)
 }
 
@@ -864,6 +875,20 @@ func (r *Rule) ShouldKeep() bool {
 	return ShouldKeep(r.expr)
 }
 
+// ShouldResolve returns whether Gazelle should resolve the dependencies of
+// the rule. It returns false if the rule is marked with a
+// "# gazelle:no_resolve" comment in the block of comments above it, for
+// example, because a macro computes its dependencies. Other attributes of
+// such rules are still merged.
+func (r *Rule) ShouldResolve() bool {
+	for _, c := range r.expr.Comment().Before {
+		if match := directiveRe.FindStringSubmatch(c.Token); match != nil && match[1] == "no_resolve" {
+			return false
+		}
+	}
+	return true
+}
+
 // Kind returns the kind of rule this is (for example, "go_library").
 func (r *Rule) Kind() string {
 	return r.kind
@@ -983,6 +1008,201 @@ func (r *Rule) AttrComments(key string) *bzl.Comments {
 	return attr.expr.Comment()
 }
 
+// CommentPosition indicates where a comment attached to an attribute is
+// printed.
+type CommentPosition int
+
+const (
+	// CommentBefore comments are printed on lines above the attribute.
+	CommentBefore CommentPosition = iota
+
+	// CommentSuffix comments are printed at the end of the attribute's last
+	// line.
+	CommentSuffix
+)
+
+// SetAttrComment replaces the comments at position pos attached to the named
+// attribute. Each comment must start with "#". Passing no comments removes
+// the comments at that position. If the attribute is not set, SetAttrComment
+// does nothing.
+//
+// When a generated rule is merged into an existing rule, comments attached
+// to a generated attribute replace the existing attribute's comments at the
+// same position, whenever the generated value is used. This lets extensions
+// record provenance, for example "# generated from foo.go".
+func (r *Rule) SetAttrComment(key string, pos CommentPosition, comments ...string) {
+	attr, ok := r.attrs[key]
+	if !ok {
+		return
+	}
+	var coms []bzl.Comment
+	for _, token := range comments {
+		if !strings.HasPrefix(token, "#") {
+			panic(fmt.Sprintf("comment must start with '#': got %q", token))
+		}
+		coms = append(coms, bzl.Comment{Token: token})
+	}
+	c := attr.expr.Comment()
+	switch pos {
+	case CommentBefore:
+		c.Before = coms
+	case CommentSuffix:
+		c.Suffix = coms
+	default:
+		panic(fmt.Sprintf("unknown comment position %d", pos))
+	}
+	r.updated = true
+}
+
+// attrGroupsKey is the private attribute where SetAttrGroups records
+// grouping functions, keyed by attribute name. Private attributes are copied
+// when rules are merged, so the grouping applies to the merged rule.
+const attrGroupsKey = "_gazelle_attr_groups"
+
+// StringGroup identifies a group of strings in a list attribute. Groups are
+// ordered by Order, then strings are sorted within each group.
+type StringGroup struct {
+	Order int
+
+	// Name is written in a comment before the first string in the group,
+	// for example, # group: external.
+	Name string
+}
+
+// SetAttrGroups arranges the strings in lists in the value of the attribute
+// key into groups when the rule is formatted. groupOf returns the group of
+// each string. When a list has strings from more than one group, each group
+// is preceded by a comment naming it. These comments are replaced when rules
+// are merged, so groups are kept up to date on later runs.
+func (r *Rule) SetAttrGroups(key string, groupOf func(string) StringGroup) {
+	groups := make(map[string]func(string) StringGroup)
+	if old, ok := r.private[attrGroupsKey].(map[string]func(string) StringGroup); ok {
+		for k, f := range old {
+			groups[k] = f
+		}
+	}
+	groups[key] = groupOf
+	r.private[attrGroupsKey] = groups
+	r.updated = true
+}
+
+// importCommentPrefix begins comments added by SetImportComments. Comments
+// with this prefix followed by a list of quoted imports are replaced when
+// rules are merged.
+const importCommentPrefix = "# import "
+
+// isImportComment returns whether token has the form of comments added by
+// SetImportComments, for example, # import "example.com/a", "example.com/b".
+// Other comments that start with importCommentPrefix were written by hand.
+func isImportComment(token string) bool {
+	rest, ok := strings.CutPrefix(token, importCommentPrefix)
+	if !ok {
+		return false
+	}
+	for {
+		imp, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return false
+		}
+		if rest = rest[len(imp):]; rest == "" {
+			return true
+		}
+		if rest, ok = strings.CutPrefix(rest, ", "); !ok {
+			return false
+		}
+	}
+}
+
+// SetImportComments attaches a suffix comment to each string in the value of
+// the attribute key that's a key in imports, listing the imports it was
+// resolved from, for example, # import "example.com/foo". Strings in select
+// expressions are annotated, too. Comments previously added this way are
+// replaced. Strings that already have other suffix comments are left alone,
+// since only one comment fits on a line. Languages call this after resolving
+// dependencies when Config.AnnotateDeps is set.
+func (r *Rule) SetImportComments(key string, imports map[string][]string) {
+	attr, ok := r.attrs[key]
+	if !ok {
+		return
+	}
+	bzl.Walk(attr.expr.RHS, func(e bzl.Expr, _ []bzl.Expr) {
+		s, ok := e.(*bzl.StringExpr)
+		if !ok || len(imports[s.Value]) == 0 {
+			return
+		}
+		imps := make([]string, 0, len(imports[s.Value]))
+		seen := make(map[string]bool)
+		for _, imp := range imports[s.Value] {
+			if !seen[imp] {
+				seen[imp] = true
+				imps = append(imps, strconv.Quote(imp))
+			}
+		}
+		sort.Strings(imps)
+		c := s.Comment()
+		if c.Suffix = filterImportComments(c.Suffix); len(c.Suffix) == 0 {
+			c.Suffix = []bzl.Comment{{Token: importCommentPrefix + strings.Join(imps, ", ")}}
+		}
+	})
+	r.updated = true
+}
+
+// filterImportComments returns comments without those added by
+// SetImportComments.
+func filterImportComments(comments []bzl.Comment) []bzl.Comment {
+	var filtered []bzl.Comment
+	for _, c := range comments {
+		if !isImportComment(c.Token) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// importComments returns the comments added by SetImportComments.
+func importComments(comments []bzl.Comment) []bzl.Comment {
+	var filtered []bzl.Comment
+	for _, c := range comments {
+		if isImportComment(c.Token) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// provenanceKey is the private attribute where AddProvenance records
+// reasons, keyed by attribute name, then by value.
+const provenanceKey = "_gazelle_provenance"
+
+// AddProvenance records reason as one of the reasons why value, a string in
+// the attribute key, is in the rule. Values are strings like source file
+// names or dependency labels. Languages call this while generating and
+// resolving rules when Config.RecordProvenance is set, and the explain
+// command prints the reasons.
+func (r *Rule) AddProvenance(key, value, reason string) {
+	prov, ok := r.private[provenanceKey].(map[string]map[string][]string)
+	if !ok {
+		prov = make(map[string]map[string][]string)
+		r.private[provenanceKey] = prov
+	}
+	if prov[key] == nil {
+		prov[key] = make(map[string][]string)
+	}
+	for _, old := range prov[key][value] {
+		if old == reason {
+			return
+		}
+	}
+	prov[key][value] = append(prov[key][value], reason)
+}
+
+// Provenance returns the reasons recorded with AddProvenance for value in
+// the attribute key, in the order they were recorded.
+func (r *Rule) Provenance(key, value string) []string {
+	prov, _ := r.private[provenanceKey].(map[string]map[string][]string)
+	return prov[key][value]
+}
+
 // PrivateAttrKeys returns a sorted list of private attribute names.
 func (r *Rule) PrivateAttrKeys() []string {
 	keys := make([]string, 0, len(r.private))
@@ -1005,6 +1225,13 @@ func (r *Rule) SetPrivateAttr(key string, value interface{}) {
 	r.private[key] = value
 }
 
+// BuildTagConditionsKey is the private attribute where languages record the
+// config_setting labels of custom build tags, as a map[string]bool. When
+// merging or squashing, a select with one of these conditions and a default
+// is treated as a select for a build tag. Other selects that aren't keyed by platforms
+// can't be merged.
+const BuildTagConditionsKey = "_gazelle_build_tag_conditions"
+
 // Args returns positional arguments passed to a rule.
 func (r *Rule) Args() []bzl.Expr {
 	return r.args
@@ -1080,18 +1307,36 @@ func (r *Rule) sync() {
 	}
 	r.updated = false
 
+	groups, _ := r.private[attrGroupsKey].(map[string]func(string) StringGroup)
 	for _, k := range r.sortedAttrs {
 		attr, ok := r.attrs[k]
 		_, isUnsorted := attr.val.(UnsortedStrings)
-		if ok && !isUnsorted {
+		if ok && !isUnsorted && groups[k] == nil {
 			bzl.Walk(attr.expr.RHS, sortExprLabels)
 		}
 	}
+	for k, groupOf := range groups {
+		attr, ok := r.attrs[k]
+		_, isUnsorted := attr.val.(UnsortedStrings)
+		if ok && !isUnsorted {
+			bzl.Walk(attr.expr.RHS, func(e bzl.Expr, _ []bzl.Expr) {
+				groupExprLabels(e, groupOf)
+			})
+		}
+	}
+	// Unlike lists, select arms are sorted in every attribute, since their
+	// order never matters.
+	for _, attr := range r.attrs {
+		bzl.Walk(attr.expr.RHS, sortExprSelectArms)
+	}
 
 	call := r.expr.(*bzl.CallExpr)
 
-	// update `call.X` (e.g.: "# gazelle:map_kind")
-	call.X = createDotExpr(r.Kind())
+	// update `call.X` (e.g.: "# gazelle:map_kind"). It's only replaced if the
+	// kind changed, so the call keeps its position in the original file.
+	if x := createDotExpr(r.Kind()); bzl.FormatString(call.X) != bzl.FormatString(x) {
+		call.X = x
+	}
 
 	if len(r.attrs) > 1 {
 		call.ForceMultiLine = true
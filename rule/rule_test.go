@@ -712,6 +712,48 @@ a_rule(
 	}
 }
 
+func TestSelectArmSorting(t *testing.T) {
+	f, err := LoadData("BUILD.bazel", "", []byte(`
+go_library(
+    name = "a",
+    deps = select({
+        "//conditions:default": [],
+        "@io_bazel_rules_go//go/platform:linux": [":linux"],
+        "//config:fast": [":fast"],
+        ":local": [":local"],
+    }) + select({
+        KEY: [":x"],
+        "//b": [":b"],
+    }),
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := f.Rules[0]
+	r.SetAttr("name", "a")
+	f.Sync()
+
+	got := strings.TrimSpace(string(bzl.FormatWithoutRewriting(f.File)))
+	want := strings.TrimSpace(`
+go_library(
+    name = "a",
+    deps = select({
+        "//config:fast": [":fast"],
+        ":local": [":local"],
+        "@io_bazel_rules_go//go/platform:linux": [":linux"],
+        "//conditions:default": [],
+    }) + select({
+        KEY: [":x"],
+        "//b": [":b"],
+    }),
+)
+`)
+	if got != want {
+		t.Errorf("got:%s\nwant:%s", got, want)
+	}
+}
+
 func TestAttributeValueSortingOverride(t *testing.T) {
 	f := EmptyFile("foo", "bar")
 
@@ -753,3 +795,17 @@ a_rule(
 		t.Errorf("Unexpected r.SortedAttrs(): %v", r.SortedAttrs())
 	}
 }
+
+func TestProvenance(t *testing.T) {
+	r := NewRule("go_library", "a")
+	r.AddProvenance("deps", "//b", `import "example.com/b" in a.go`)
+	r.AddProvenance("deps", "//b", `import "example.com/b/v2" in a.go`)
+	r.AddProvenance("deps", "//b", `import "example.com/b" in a.go`)
+	want := []string{`import "example.com/b" in a.go`, `import "example.com/b/v2" in a.go`}
+	if got := r.Provenance("deps", "//b"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if got := r.Provenance("srcs", "a.go"); got != nil {
+		t.Errorf("got %q for value without provenance; want nil", got)
+	}
+}
@@ -49,6 +49,120 @@ func sortExprLabels(e bzl.Expr, _ []bzl.Expr) {
 	}
 }
 
+// groupCommentPrefix begins comments added before each group of strings by
+// groupExprLabels. Comments with this prefix are replaced when the list is
+// grouped again. In attributes without groups, they're left alone, since
+// they may have been written by hand.
+const groupCommentPrefix = "# group: "
+
+// groupExprLabels sorts a list of strings like sortExprLabels, but first
+// orders the strings by the groups groupOf puts them in. If there's more than
+// one group, a comment naming each group is added before its first string.
+// Comments added previously are removed.
+func groupExprLabels(e bzl.Expr, groupOf func(string) StringGroup) {
+	list, ok := e.(*bzl.ListExpr)
+	if !ok || len(list.List) == 0 {
+		return
+	}
+
+	keys := make([]stringSortKey, len(list.List))
+	groups := make([]StringGroup, len(list.List))
+	for i, elem := range list.List {
+		s, ok := elem.(*bzl.StringExpr)
+		if !ok {
+			return // don't sort lists unless all elements are strings
+		}
+		keys[i] = makeSortKey(i, s)
+		groups[i] = groupOf(s.Value)
+		c := s.Comment()
+		c.Before = filterGroupComments(c.Before)
+	}
+
+	before := keys[0].x.Comment().Before
+	keys[0].x.Comment().Before = nil
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		gi, gj := groups[order[i]], groups[order[j]]
+		if gi.Order != gj.Order {
+			return gi.Order < gj.Order
+		}
+		return byStringExpr(keys).Less(order[i], order[j])
+	})
+
+	multiple := false
+	for _, g := range groups {
+		if g != groups[0] {
+			multiple = true
+			break
+		}
+	}
+	for i, k := range order {
+		x := keys[k].x
+		if multiple && (i == 0 || groups[k] != groups[order[i-1]]) {
+			header := bzl.Comment{Token: groupCommentPrefix + groups[k].Name}
+			x.Comment().Before = append(x.Comment().Before, header)
+		}
+		list.List[i] = x
+	}
+	keys[order[0]].x.Comment().Before = append(before, keys[order[0]].x.Comment().Before...)
+	if multiple {
+		list.ForceMultiLine = true
+	}
+}
+
+// filterGroupComments returns comments without those added by
+// groupExprLabels.
+func filterGroupComments(comments []bzl.Comment) []bzl.Comment {
+	var filtered []bzl.Comment
+	for _, c := range comments {
+		if !strings.HasPrefix(c.Token, groupCommentPrefix) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// sortExprSelectArms sorts the arms of calls to select in canonical order:
+// conditions are compared as strings, and "//conditions:default" comes
+// last. This applies to all conditions, including config_setting labels
+// written by users, so the order doesn't depend on how the arms were
+// merged. Dicts with keys that aren't string literals are not sorted.
+// This function is intended to be used with bzl.Walk.
+func sortExprSelectArms(e bzl.Expr, _ []bzl.Expr) {
+	call, ok := e.(*bzl.CallExpr)
+	if !ok || len(call.List) != 1 {
+		return
+	}
+	if x, ok := call.X.(*bzl.Ident); !ok || x.Name != "select" {
+		return
+	}
+	dict, ok := call.List[0].(*bzl.DictExpr)
+	if !ok {
+		return
+	}
+	for _, kv := range dict.List {
+		if _, ok := kv.Key.(*bzl.StringExpr); !ok {
+			return
+		}
+	}
+	sort.SliceStable(dict.List, func(i, j int) bool {
+		return selectConditionLess(dict.List[i].Key.(*bzl.StringExpr).Value, dict.List[j].Key.(*bzl.StringExpr).Value)
+	})
+}
+
+// selectConditionLess reports whether the select arm with condition a
+// comes before the arm with condition b in canonical order.
+func selectConditionLess(a, b string) bool {
+	const defaultCondition = "//conditions:default"
+	if a == defaultCondition || b == defaultCondition {
+		return b == defaultCondition && a != defaultCondition
+	}
+	return a < b
+}
+
 // Code below this point is adapted from
 // github.com/bazelbuild/buildtools/build/rewrite.go
 
@@ -53,4 +53,44 @@ type KindInfo struct {
 	// ResolveAttrs is a set of attributes that should be merged after
 	// dependency resolution. See rule.Merge.
 	ResolveAttrs map[string]bool
+
+	// KnownAttrs is the set of all attributes accepted by rules of this kind,
+	// not including attributes in CommonAttrs. If set, "gazelle fix
+	// -prune_unknown_attrs" deletes attributes not in either set. Leave this
+	// nil if the attributes of the kind are not known, for example, when the
+	// kind is a macro.
+	KnownAttrs map[string]bool
+}
+
+// CommonAttrs is the set of attributes accepted by all rules, including
+// attributes common to all test and binary rules.
+var CommonAttrs = map[string]bool{
+	"applicable_licenses":        true,
+	"args":                       true,
+	"aspect_hints":               true,
+	"compatible_with":            true,
+	"deprecation":                true,
+	"distribs":                   true,
+	"env":                        true,
+	"env_inherit":                true,
+	"exec_compatible_with":       true,
+	"exec_group_compatible_with": true,
+	"exec_properties":            true,
+	"features":                   true,
+	"flaky":                      true,
+	"licenses":                   true,
+	"local":                      true,
+	"name":                       true,
+	"output_licenses":            true,
+	"package_metadata":           true,
+	"restricted_to":              true,
+	"shard_count":                true,
+	"size":                       true,
+	"tags":                       true,
+	"target_compatible_with":     true,
+	"testonly":                   true,
+	"timeout":                    true,
+	"toolchains":                 true,
+	"transitive_configs":         true,
+	"visibility":                 true,
 }
@@ -107,18 +107,10 @@ type SelectStringListValue map[string][]string
 func (s SelectStringListValue) BzlExpr() bzl.Expr {
 	defaultKey := "//conditions:default"
 	keys := make([]string, 0, len(s))
-	haveDefaultKey := false
 	for key := range s {
-		if key == defaultKey {
-			haveDefaultKey = true
-		} else {
-			keys = append(keys, key)
-		}
-	}
-	sort.Strings(keys)
-	if haveDefaultKey {
-		keys = append(keys, defaultKey)
+		keys = append(keys, key)
 	}
+	sort.Slice(keys, func(i, j int) bool { return selectConditionLess(keys[i], keys[j]) })
 
 	args := make([]*bzl.KeyValueExpr, 0, len(s))
 	for _, key := range keys {
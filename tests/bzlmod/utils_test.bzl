@@ -1,5 +1,5 @@
 load("@bazel_skylib//lib:unittest.bzl", "asserts", "unittest")
-load("//internal/bzlmod:utils.bzl", "with_replaced_or_new_fields")
+load("//internal/bzlmod:utils.bzl", "expects_use_repo", "remove_excluded_modules", "resolve_case_collisions", "use_repo_deps", "with_replaced_or_new_fields")
 
 _BEFORE_STRUCT = struct(
     direct = True,
@@ -25,8 +25,120 @@ def _with_replaced_or_new_fields_test_impl(ctx):
 
 with_replaced_or_new_fields_test = unittest.make(_with_replaced_or_new_fields_test_impl)
 
+_CASE_COLLISION_REPO_NAMES = {
+    "github.com/Selvatico/go-mocket": "com_github_selvatico_go_mocket",
+    "github.com/selvatico/go-mocket": "com_github_selvatico_go_mocket",
+    "github.com/SELVATICO/go-mocket": "com_github_selvatico_go_mocket",
+    "github.com/a-b/c": "com_github_a_b_c",
+    "github.com/a_b/c": "com_github_a_b_c",
+}
+
+def _resolve_case_collisions_test_impl(ctx):
+    env = unittest.begin(ctx)
+    asserts.equals(env, _CASE_COLLISION_REPO_NAMES, resolve_case_collisions(_CASE_COLLISION_REPO_NAMES, "error"))
+    asserts.equals(env, {
+        "github.com/selvatico/go-mocket": "com_github_selvatico_go_mocket",
+        "github.com/Selvatico/go-mocket": "com_github_selvatico_go_mocket_2",
+        "github.com/SELVATICO/go-mocket": "com_github_selvatico_go_mocket_3",
+        "github.com/a-b/c": "com_github_a_b_c",
+        "github.com/a_b/c": "com_github_a_b_c",
+    }, resolve_case_collisions(_CASE_COLLISION_REPO_NAMES, "suffix"))
+    asserts.equals(env, {
+        "github.com/selvatico/go-mocket": "com_github_selvatico_go_mocket",
+        "github.com/a-b/c": "com_github_a_b_c",
+        "github.com/a_b/c": "com_github_a_b_c",
+    }, resolve_case_collisions(_CASE_COLLISION_REPO_NAMES, "lowercase_wins"))
+    return unittest.end(env)
+
+resolve_case_collisions_test = unittest.make(_resolve_case_collisions_test_impl)
+
+def _default_repo_name(path):
+    return path.lower().replace(".", "_").replace("/", "_").replace("-", "_")
+
+def _remove_excluded_modules_test_impl(ctx):
+    env = unittest.begin(ctx)
+    module_resolutions = {
+        "github.com/Selvatico/go-mocket": struct(repo_name = "github_com_selvatico_go_mocket"),
+        "github.com/selvatico/go-mocket": struct(repo_name = "github_com_selvatico_go_mocket"),
+        "example.com/dev": struct(repo_name = "example_com_dev"),
+        "example.com/from_bazel_dep": struct(module_name = "from_bazel_dep", repo_name = "@from_bazel_dep"),
+        "example.com/kept": struct(repo_name = "example_com_kept"),
+    }
+    root_versions = {
+        "github.com/Selvatico/go-mocket": "1.0.0",
+        "example.com/from_bazel_dep": "1.0.0",
+        "example.com/kept": "1.0.0",
+    }
+    root_module_direct_deps = {
+        "github_com_selvatico_go_mocket": None,
+        "example_com_from_bazel_dep": None,
+        "@from_bazel_dep": None,
+        "example_com_kept": None,
+    }
+    root_module_direct_dev_deps = {
+        "example_com_dev": None,
+    }
+    remove_excluded_modules(
+        ["github.com/Selvatico/go-mocket", "example.com/dev", "example.com/from_bazel_dep"],
+        module_resolutions,
+        root_versions,
+        root_module_direct_deps,
+        root_module_direct_dev_deps,
+        _default_repo_name,
+    )
+    asserts.equals(env, ["github.com/selvatico/go-mocket", "example.com/kept"], module_resolutions.keys())
+    asserts.equals(env, {"example.com/kept": "1.0.0"}, root_versions)
+
+    # The other module with the same repository name is still a direct dependency.
+    asserts.equals(env, ["github_com_selvatico_go_mocket", "example_com_kept"], root_module_direct_deps.keys())
+    asserts.equals(env, {}, root_module_direct_dev_deps)
+    return unittest.end(env)
+
+remove_excluded_modules_test = unittest.make(_remove_excluded_modules_test_impl)
+
+def _expects_use_repo_test_impl(ctx):
+    env = unittest.begin(ctx)
+    direct = struct(indirect = False)
+    indirect = struct(indirect = True)
+    asserts.true(env, expects_use_repo(direct, "direct"))
+    asserts.false(env, expects_use_repo(indirect, "direct"))
+    asserts.true(env, expects_use_repo(direct, "all"))
+    asserts.true(env, expects_use_repo(indirect, "all"))
+    asserts.false(env, expects_use_repo(direct, "off"))
+    asserts.false(env, expects_use_repo(indirect, "off"))
+    return unittest.end(env)
+
+expects_use_repo_test = unittest.make(_expects_use_repo_test_impl)
+
+def _use_repo_deps_test_impl(ctx):
+    env = unittest.begin(ctx)
+    root_module_direct_deps = {
+        "com_example_both": None,
+        "com_example_direct": None,
+    }
+    root_module_direct_dev_deps = {
+        "com_example_both": None,
+        "com_example_dev": None,
+    }
+    for use_repo_check in ["direct", "all"]:
+        asserts.equals(
+            env,
+            (["com_example_both", "com_example_direct"], ["com_example_dev"]),
+            use_repo_deps(use_repo_check, root_module_direct_deps, root_module_direct_dev_deps),
+        )
+
+    # Bazel doesn't check use_repo if no lists are given.
+    asserts.equals(env, (None, None), use_repo_deps("off", root_module_direct_deps, root_module_direct_dev_deps))
+    return unittest.end(env)
+
+use_repo_deps_test = unittest.make(_use_repo_deps_test_impl)
+
 def utils_test_suite(name):
     unittest.suite(
         name,
         with_replaced_or_new_fields_test,
+        resolve_case_collisions_test,
+        remove_excluded_modules_test,
+        expects_use_repo_test,
+        use_repo_deps_test,
     )
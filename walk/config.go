@@ -41,23 +41,119 @@ type walkConfig struct {
 	excludes []string
 	ignore   bool
 	follow   []string
+
+	// bazelIgnore is whether directories listed in .bazelignore are skipped.
+	bazelIgnore bool
+
+	// followSymlinks is the -follow_symlinks mode, which determines which
+	// symlinks are followed.
+	followSymlinks string
 }
 
+const (
+	// followDirective follows symlinks matched by # gazelle:follow
+	// directives, and symlinks in vendor directories with targets outside
+	// the repository.
+	followDirective = "directive"
+
+	// followAll follows all symlinks, except the convenience symlinks Bazel
+	// creates in the repository root, like bazel-bin and bazel-out.
+	followAll = "all"
+
+	// followNone doesn't follow any symlinks, even those matched by
+	// # gazelle:follow directives.
+	followNone = "none"
+)
+
+var validFollowSymlinks = []string{followDirective, followAll, followNone}
+
 const walkName = "_walk"
 
 func getWalkConfig(c *config.Config) *walkConfig {
 	return c.Exts[walkName].(*walkConfig)
 }
 
+// IsExcluded returns whether the file at the slash-separated path rel,
+// relative to the repository root, is excluded by the exclude directives and
+// flags in effect in c, so Walk wouldn't list it. This is the case if the
+// file or its directory is excluded, or if a directory containing it is
+// excluded and no negated pattern includes paths within it again.
+// Extensions may use it to skip files they find without walking, for
+// example, files found by resolving imports.
+func IsExcluded(c *config.Config, rel string) bool {
+	wc, ok := c.Exts[walkName].(*walkConfig)
+	if !ok {
+		return false
+	}
+	dir := path.Dir(rel)
+	if dir == "." {
+		dir = ""
+	}
+	for p := dir; p != ""; {
+		if wc.isSkipped(p) {
+			return true
+		}
+		if p = path.Dir(p); p == "." {
+			p = ""
+		}
+	}
+	return wc.isExcluded(rel) || wc.isExcluded(dir)
+}
+
+// isExcluded returns whether p is excluded. Patterns are checked in order,
+// and the last one that matches p decides: p is excluded unless that pattern
+// is negated with "!".
 func (wc *walkConfig) isExcluded(p string) bool {
-	return matchAnyGlob(wc.excludes, p)
+	excluded := false
+	for _, x := range wc.excludes {
+		negated := strings.HasPrefix(x, "!")
+		if matchGlob(strings.TrimPrefix(x, "!"), p) {
+			excluded = !negated
+		}
+	}
+	return excluded
+}
+
+// isSkipped returns whether Walk skips the path p and everything within it:
+// p is excluded, and no negated pattern may include a path within it again.
+func (wc *walkConfig) isSkipped(p string) bool {
+	return wc.isExcluded(p) && !wc.mayIncludeWithin(p)
+}
+
+// mayIncludeWithin returns whether a negated exclude pattern may match a path
+// within the excluded directory dir, so dir must be visited to find it.
+func (wc *walkConfig) mayIncludeWithin(dir string) bool {
+	for _, x := range wc.excludes {
+		if strings.HasPrefix(x, "!") && mayMatchWithin(x[1:], dir) {
+			return true
+		}
+	}
+	return false
 }
 
+// shouldFollow returns whether the symlink at p should be followed, given
+// the -follow_symlinks mode and # gazelle:follow directives. p is relative to
+// the repository root.
 func (wc *walkConfig) shouldFollow(p string) bool {
-	return matchAnyGlob(wc.follow, p)
+	switch wc.followSymlinks {
+	case followNone:
+		return false
+	case followAll:
+		return !isBazelConvenienceLink(p)
+	default:
+		return matchAnyGlob(wc.follow, p)
+	}
 }
 
-var _ config.Configurer = (*Configurer)(nil)
+// isBazelConvenienceLink returns whether p is one of the symlinks Bazel
+// creates in the repository root, like bazel-bin. Their targets are in the
+// output base, and following them would visit build outputs and external
+// repositories.
+func isBazelConvenienceLink(p string) bool {
+	return !strings.Contains(p, "/") && strings.HasPrefix(p, "bazel-")
+}
+
+var _ config.DirectiveDeclarer = (*Configurer)(nil)
 
 type Configurer struct{}
 
@@ -65,12 +161,26 @@ func (*Configurer) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config)
 	wc := &walkConfig{}
 	c.Exts[walkName] = wc
 	fs.Var(&gzflag.MultiFlag{Values: &wc.excludes}, "exclude", "pattern that should be ignored (may be repeated)")
+	fs.BoolVar(&wc.bazelIgnore, "bazelignore", true, "when true, paths listed in the repository's .bazelignore file are skipped")
+	wc.followSymlinks = followDirective
+	fs.Var(&gzflag.AllowedStringFlag{Value: &wc.followSymlinks, Allowed: validFollowSymlinks}, "follow_symlinks", "which symlinks are followed: directive (those matched by # gazelle:follow), all (all but Bazel's convenience symlinks), or none")
 }
 
 func (*Configurer) CheckFlags(fs *flag.FlagSet, c *config.Config) error { return nil }
 
+var walkDirectives = []config.DirectiveInfo{
+	{Name: "exclude", Type: config.StringDirective},
+	{Name: "follow", Type: config.StringDirective},
+	{Name: "ignore", Type: config.StringDirective, AllowEmpty: true},
+	{Name: "reset", Type: config.ListDirective},
+}
+
+func (*Configurer) Directives() []config.DirectiveInfo {
+	return walkDirectives
+}
+
 func (*Configurer) KnownDirectives() []string {
-	return []string{"exclude", "follow", "ignore"}
+	return config.DeclaredDirectiveNames(walkDirectives)
 }
 
 func (cr *Configurer) Configure(c *config.Config, rel string, f *rule.File) {
@@ -79,27 +189,29 @@ func (cr *Configurer) Configure(c *config.Config, rel string, f *rule.File) {
 	*wcCopy = *wc
 	wcCopy.ignore = false
 
-	if f != nil {
-		for _, d := range f.Directives {
-			switch d.Key {
-			case "exclude":
-				if err := checkPathMatchPattern(path.Join(rel, d.Value)); err != nil {
-					log.Printf("the exclusion pattern is not valid %q: %s", path.Join(rel, d.Value), err)
-					continue
-				}
-				wcCopy.excludes = append(wcCopy.excludes, path.Join(rel, d.Value))
-			case "follow":
-				if err := checkPathMatchPattern(path.Join(rel, d.Value)); err != nil {
-					log.Printf("the follow pattern is not valid %q: %s", path.Join(rel, d.Value), err)
-					continue
-				}
-				wcCopy.follow = append(wcCopy.follow, path.Join(rel, d.Value))
-			case "ignore":
-				if d.Value != "" {
-					log.Printf("the ignore directive does not take any arguments. Did you mean to use gazelle:exclude instead? in //%s '# gazelle:ignore %s'", f.Pkg, d.Value)
-				}
-				wcCopy.ignore = true
+	for _, d := range config.ParseDirectives(walkDirectives, rel, f) {
+		switch d.Name {
+		case "exclude":
+			negation, pattern := "", d.Raw
+			if strings.HasPrefix(pattern, "!") {
+				negation, pattern = "!", pattern[1:]
+			}
+			if err := checkPathMatchPattern(path.Join(rel, pattern)); err != nil {
+				log.Printf("the exclusion pattern is not valid %q: %s", path.Join(rel, pattern), err)
+				continue
+			}
+			wcCopy.excludes = append(wcCopy.excludes, negation+path.Join(rel, pattern))
+		case "follow":
+			if err := checkPathMatchPattern(path.Join(rel, d.Raw)); err != nil {
+				log.Printf("the follow pattern is not valid %q: %s", path.Join(rel, d.Raw), err)
+				continue
+			}
+			wcCopy.follow = append(wcCopy.follow, path.Join(rel, d.Raw))
+		case "ignore":
+			if d.Raw != "" {
+				log.Printf("the ignore directive does not take any arguments. Did you mean to use gazelle:exclude instead? in //%s '# gazelle:ignore %s'", f.Pkg, d.Raw)
 			}
+			wcCopy.ignore = true
 		}
 	}
 
@@ -158,17 +270,45 @@ func checkPathMatchPattern(pattern string) error {
 
 func matchAnyGlob(patterns []string, path string) bool {
 	for _, x := range patterns {
-		matched, err := doublestar.Match(x, path)
-		if err != nil {
-			// doublestar.Match returns only one possible error, and only if the
-			// pattern is not valid. During the configuration of the walker (see
-			// Configure below), we discard any invalid pattern and thus an error
-			// here should not be possible.
-			log.Panicf("error during doublestar.Match. This should not happen, please file an issue https://github.com/bazelbuild/bazel-gazelle/issues/new: %s", err)
-		}
-		if matched {
+		if matchGlob(x, path) {
 			return true
 		}
 	}
 	return false
 }
+
+func matchGlob(pattern, path string) bool {
+	matched, err := doublestar.Match(pattern, path)
+	if err != nil {
+		// doublestar.Match returns only one possible error, and only if the
+		// pattern is not valid. During the configuration of the walker (see
+		// Configure below), we discard any invalid pattern and thus an error
+		// here should not be possible.
+		log.Panicf("error during doublestar.Match. This should not happen, please file an issue https://github.com/bazelbuild/bazel-gazelle/issues/new: %s", err)
+	}
+	return matched
+}
+
+// mayMatchWithin returns whether pattern may match a path within the
+// directory dir. Pattern elements with braces may contain slashes, so they're
+// assumed to match.
+func mayMatchWithin(pattern, dir string) bool {
+	if dir == "" {
+		return pattern != ""
+	}
+	return mayMatchElemsWithin(strings.Split(pattern, "/"), strings.Split(dir, "/"))
+}
+
+func mayMatchElemsWithin(pattern, dir []string) bool {
+	switch {
+	case len(dir) == 0:
+		return len(pattern) > 0
+	case len(pattern) == 0:
+		return false
+	case pattern[0] == "**":
+		return mayMatchElemsWithin(pattern[1:], dir) || mayMatchElemsWithin(pattern, dir[1:])
+	case strings.ContainsAny(pattern[0], "{}"):
+		return true
+	}
+	return matchGlob(pattern[0], dir[0]) && mayMatchElemsWithin(pattern[1:], dir[1:])
+}
@@ -18,6 +18,7 @@ limitations under the License.
 package walk
 
 import (
+	"fmt"
 	"io/fs"
 	"log"
 	"os"
@@ -111,17 +112,29 @@ type WalkFunc func(dir, rel string, c *config.Config, update bool, f *rule.File,
 // wf is a function that may be called in each directory.
 func Walk(c *config.Config, cexts []config.Configurer, dirs []string, mode Mode, wf WalkFunc) {
 	knownDirectives := make(map[string]bool)
+	declaredDirectives := make(map[string]config.DirectiveInfo)
 	for _, cext := range cexts {
 		for _, d := range cext.KnownDirectives() {
 			knownDirectives[d] = true
 		}
+		if dd, ok := cext.(config.DirectiveDeclarer); ok {
+			for _, info := range dd.Directives() {
+				knownDirectives[info.Name] = true
+				declaredDirectives[info.Name] = info
+			}
+		}
 	}
+	dc := directiveChecker{known: knownDirectives, declared: declaredDirectives}
 
 	updateRels := NewUpdateFilter(c.RepoRoot, dirs, mode)
 
-	isBazelIgnored, err := loadBazelIgnore(c.RepoRoot)
-	if err != nil {
-		log.Printf("error loading .bazelignore: %v", err)
+	isBazelIgnored := nothingIgnored
+	if getWalkConfig(c).bazelIgnore {
+		var err error
+		isBazelIgnored, err = loadBazelIgnore(c.RepoRoot)
+		if err != nil {
+			log.Printf("error loading .bazelignore: %v", err)
+		}
 	}
 
 	trie, err := buildTrie(c, isBazelIgnored)
@@ -129,10 +142,63 @@ func Walk(c *config.Config, cexts []config.Configurer, dirs []string, mode Mode,
 		log.Fatalf("error walking the file system: %v\n", err)
 	}
 
-	visit(c, cexts, knownDirectives, updateRels, trie, wf, "", false)
+	// Keep a copy of the configuration before any build file is applied, so
+	// it can be rebuilt without inherited directives named by gazelle:reset.
+	base := c.Clone()
+	links := &followedLinks{root: c.RepoRoot, isIgnored: isBazelIgnored, targets: make(map[string]string)}
+	visit(c, cexts, dc, updateRels, trie, links, wf, "", false, base, nil)
+}
+
+// ConfigNode is the effective configuration of a directory, as computed by
+// ConfigureTree.
+type ConfigNode struct {
+	// Rel is the slash-separated path to the directory from the repository
+	// root. It is "" for the repository root directory itself.
+	Rel string
+
+	// Config is the configuration for the directory, including changes made
+	// by directives in the directory's build file and its parents' build files.
+	Config *config.Config
+
+	// File is the existing build file in the directory, or nil if there was
+	// no file.
+	File *rule.File
+
+	// Children are the nodes for subdirectories, sorted by base name.
+	// Excluded directories are not included.
+	Children []*ConfigNode
 }
 
-func visit(c *config.Config, cexts []config.Configurer, knownDirectives map[string]bool, updateRels *UpdateFilter, trie *pathTrie, wf WalkFunc, rel string, updateParent bool) {
+// ConfigureTree traverses the directory tree rooted at c.RepoRoot and applies
+// cexts in each directory, the same way Walk does, but without calling a
+// WalkFunc. It returns the effective configuration of every visited
+// directory as a tree rooted at the repository root.
+//
+// This is useful for tools that check directive usage across a repository
+// without generating rules.
+func ConfigureTree(c *config.Config, cexts []config.Configurer) *ConfigNode {
+	nodes := make(map[string]*ConfigNode)
+	Walk(c, cexts, []string{c.RepoRoot}, VisitAllUpdateSubdirsMode, func(_, rel string, c *config.Config, _ bool, f *rule.File, subdirs, _, _ []string) {
+		n := &ConfigNode{Rel: rel, Config: c, File: f}
+		for _, sub := range subdirs {
+			if child := nodes[path.Join(rel, sub)]; child != nil {
+				n.Children = append(n.Children, child)
+			}
+		}
+		nodes[rel] = n
+	})
+	return nodes[""]
+}
+
+// configLayer is a build file applied to the configuration of a directory
+// and its subdirectories, along with the configuration it produced.
+type configLayer struct {
+	rel string
+	f   *rule.File
+	c   *config.Config
+}
+
+func visit(c *config.Config, cexts []config.Configurer, dc directiveChecker, updateRels *UpdateFilter, trie *pathTrie, links *followedLinks, wf WalkFunc, rel string, updateParent bool, base *config.Config, layers []configLayer) {
 	haveError := false
 
 	ents := make([]fs.DirEntry, 0, len(trie.children))
@@ -147,51 +213,80 @@ func visit(c *config.Config, cexts []config.Configurer, knownDirectives map[stri
 	// Absolute path to the directory being visited
 	dir := filepath.Join(c.RepoRoot, rel)
 
-	f, err := loadBuildFile(c, rel, dir, ents)
-	if err != nil {
-		log.Print(err)
-		if c.Strict {
-			// TODO(https://github.com/bazelbuild/bazel-gazelle/issues/1029):
-			// Refactor to accumulate and propagate errors to main.
-			log.Fatal("Exit as strict mode is on")
+	// A directory excluded by its parent's configuration is only visited to
+	// find paths within it that are included again by negated exclude
+	// patterns. Its build file isn't read.
+	var f *rule.File
+	if !getWalkConfig(c).isExcluded(rel) {
+		var err error
+		f, err = loadBuildFile(c, rel, dir, ents)
+		if err != nil {
+			log.Print(err)
+			if c.Strict {
+				// TODO(https://github.com/bazelbuild/bazel-gazelle/issues/1029):
+				// Refactor to accumulate and propagate errors to main.
+				log.Fatal("Exit as strict mode is on")
+			}
+			haveError = true
 		}
-		haveError = true
 	}
 
-	c = configure(cexts, knownDirectives, c, rel, f)
+	if reset := resetDirectives(dc, rel, f); len(reset) > 0 {
+		layers = reconfigure(cexts, base, layers, reset)
+		if len(layers) > 0 {
+			c = layers[len(layers)-1].c
+		}
+	}
+	c = configure(cexts, dc, c, rel, f)
+	layers = append(layers[:len(layers):len(layers)], configLayer{rel: rel, f: f, c: c})
 	wc := getWalkConfig(c)
 
-	if wc.isExcluded(rel) {
+	if wc.isSkipped(rel) {
 		return
 	}
+	excluded := wc.isExcluded(rel)
 
-	var subdirs, regularFiles []string
+	// visitDirs lists subdirectories to visit. It includes subdirs and
+	// excluded directories that may contain paths that aren't excluded.
+	var subdirs, visitDirs, regularFiles []string
 	for _, ent := range ents {
 		base := ent.Name()
 		entRel := path.Join(rel, base)
-		if wc.isExcluded(entRel) {
+		if wc.isSkipped(entRel) {
 			continue
 		}
-		ent := resolveFileInfo(wc, dir, entRel, ent)
+		entExcluded := wc.isExcluded(entRel)
+		ent := links.resolve(wc, dir, entRel, ent)
 		switch {
 		case ent == nil:
 			continue
 		case ent.IsDir():
-			subdirs = append(subdirs, base)
-		default:
+			if !entExcluded && !excluded {
+				subdirs = append(subdirs, base)
+			}
+			visitDirs = append(visitDirs, base)
+		case !entExcluded && !excluded:
 			regularFiles = append(regularFiles, base)
 		}
 	}
 
 	shouldUpdate := updateRels.shouldUpdate(rel, updateParent)
-	for _, sub := range subdirs {
+	for _, sub := range visitDirs {
 		if subRel := path.Join(rel, sub); updateRels.shouldVisit(subRel, shouldUpdate) {
-			visit(c, cexts, knownDirectives, updateRels, trie.children[sub], wf, subRel, shouldUpdate)
+			child := trie.children[sub]
+			if child.children == nil {
+				// A followed symlink. Its target is listed when it's first visited.
+				if err := links.list(subRel, child); err != nil {
+					log.Print(err)
+					continue
+				}
+			}
+			visit(c, cexts, dc, updateRels, child, links, wf, subRel, shouldUpdate, base, layers)
 		}
 	}
 
 	update := !haveError && !wc.ignore && shouldUpdate
-	if updateRels.shouldCall(rel, updateParent) {
+	if !excluded && updateRels.shouldCall(rel, updateParent) {
 		genFiles := findGenFiles(wc, f)
 		wf(dir, rel, c, update, f, subdirs, regularFiles, genFiles)
 	}
@@ -297,14 +392,27 @@ func loadBuildFile(c *config.Config, pkg, dir string, ents []fs.DirEntry) (*rule
 	return rule.LoadFile(path, pkg)
 }
 
-func configure(cexts []config.Configurer, knownDirectives map[string]bool, c *config.Config, rel string, f *rule.File) *config.Config {
+// directiveChecker reports directives that no Configurer knows about, and
+// declared directives that are invalid.
+type directiveChecker struct {
+	known    map[string]bool
+	declared map[string]config.DirectiveInfo
+}
+
+func configure(cexts []config.Configurer, dc directiveChecker, c *config.Config, rel string, f *rule.File) *config.Config {
 	if rel != "" {
 		c = c.Clone()
 	}
 	if f != nil {
 		for _, d := range f.Directives {
-			if !knownDirectives[d.Key] {
-				log.Printf("%s: unknown directive: gazelle:%s", f.Path, d.Key)
+			var err error
+			if !dc.known[d.Key] {
+				err = fmt.Errorf("unknown directive: gazelle:%s", d.Key)
+			} else if info, ok := dc.declared[d.Key]; ok {
+				_, err = config.ParseDirective(info, rel, d)
+			}
+			if err != nil {
+				log.Printf("%s: %v", f.Path, err)
 				if c.Strict {
 					// TODO(https://github.com/bazelbuild/bazel-gazelle/issues/1029):
 					// Refactor to accumulate and propagate errors to main.
@@ -319,6 +427,72 @@ func configure(cexts []config.Configurer, knownDirectives map[string]bool, c *co
 	return c
 }
 
+// resetDirectives returns the names of directives listed in gazelle:reset
+// directives in f. Unknown names are reported.
+func resetDirectives(dc directiveChecker, rel string, f *rule.File) map[string]bool {
+	var reset map[string]bool
+	for _, d := range config.ParseDirectives(walkDirectives, rel, f) {
+		if d.Name != "reset" {
+			continue
+		}
+		for _, key := range d.List {
+			if !dc.known[key] {
+				log.Printf("%s: gazelle:reset: unknown directive: gazelle:%s", f.Path, key)
+				continue
+			}
+			if reset == nil {
+				reset = make(map[string]bool)
+			}
+			reset[key] = true
+		}
+	}
+	return reset
+}
+
+// reconfigure returns a copy of layers with the directives named in reset
+// removed from each file and the configurations rebuilt to match. Layers
+// before the first one with a removed directive are unaffected and kept as
+// they are; later layers are configured again by applying cexts, starting
+// from the configuration of the layer before them, or from base. The files
+// themselves aren't modified, and directives were already checked when the
+// layers were first visited, so they aren't checked again.
+func reconfigure(cexts []config.Configurer, base *config.Config, layers []configLayer, reset map[string]bool) []configLayer {
+	rebuilt := make([]configLayer, len(layers))
+	copy(rebuilt, layers)
+	c := base
+	changed := false
+	for i, l := range layers {
+		if l.f != nil && !changed {
+			for _, d := range l.f.Directives {
+				if reset[d.Key] {
+					changed = true
+					break
+				}
+			}
+		}
+		if !changed {
+			c = l.c
+			continue
+		}
+		if l.f != nil {
+			fCopy := *l.f
+			fCopy.Directives = nil
+			for _, d := range l.f.Directives {
+				if !reset[d.Key] {
+					fCopy.Directives = append(fCopy.Directives, d)
+				}
+			}
+			rebuilt[i].f = &fCopy
+		}
+		c = c.Clone()
+		for _, cext := range cexts {
+			cext.Configure(c, l.rel, rebuilt[i].f)
+		}
+		rebuilt[i].c = c
+	}
+	return rebuilt
+}
+
 func findGenFiles(wc *walkConfig, f *rule.File) []string {
 	if f == nil {
 		return nil
@@ -343,23 +517,92 @@ func findGenFiles(wc *walkConfig, f *rule.File) []string {
 	return genFiles
 }
 
-func resolveFileInfo(wc *walkConfig, dir, rel string, ent fs.DirEntry) fs.DirEntry {
+// followedLinks tracks the symlinks to directories that Walk follows. Their
+// targets aren't listed when the trie is built, since links aren't known to
+// be followed until directives are read.
+type followedLinks struct {
+	root      string
+	isIgnored isIgnoredFunc
+
+	// targets maps the resolved path of each followed directory link to the
+	// slash-separated path of the link, relative to the repository root.
+	targets map[string]string
+}
+
+// resolve returns the entry ent refers to, following it if it's a symlink
+// that should be followed. nil is returned for symlinks that aren't
+// followed.
+//
+// Symlinks matched by # gazelle:follow are followed. Symlinks in vendor
+// directories (or vendor directories that are themselves symlinks) are
+// followed if their targets are outside the repository, as when vendored
+// modules are linked from a shared module cache. The -follow_symlinks flag
+// may follow all symlinks or none instead.
+//
+// Each target directory is only followed once, through the first link to
+// it, so rules aren't generated for the same directory twice. Links to
+// directories that contain them aren't followed, since they'd form a cycle.
+func (fl *followedLinks) resolve(wc *walkConfig, dir, rel string, ent fs.DirEntry) fs.DirEntry {
 	if ent.Type()&os.ModeSymlink == 0 {
 		// Not a symlink, use the original FileInfo.
 		return ent
 	}
-	if !wc.shouldFollow(rel) {
+	linkPath := filepath.Join(dir, ent.Name())
+	target, err := filepath.EvalSymlinks(linkPath)
+	if err != nil {
+		// A symlink, but not one we could resolve.
+		return nil
+	}
+	if !wc.shouldFollow(rel) && !(wc.followSymlinks == followDirective && isVendorPath(rel) && !isWithinDir(target, fl.root)) {
 		// A symlink, but not one we should follow.
 		return nil
 	}
-	fi, err := os.Stat(path.Join(dir, ent.Name()))
+	fi, err := os.Stat(linkPath)
 	if err != nil {
-		// A symlink, but not one we could resolve.
 		return nil
 	}
+	if fi.IsDir() {
+		if realDir, err := filepath.EvalSymlinks(dir); err == nil && isWithinDir(realDir, target) {
+			log.Printf("%s: not following symlink to %s, which contains the symlink and would create a cycle", rel, target)
+			return nil
+		}
+		if prev, ok := fl.targets[target]; ok {
+			log.Printf("%s: not following symlink to %s, which was already visited through %s", rel, target, prev)
+			return nil
+		}
+		fl.targets[target] = rel
+	}
 	return fs.FileInfoToDirEntry(fi)
 }
 
+// list fills in the children of node, the trie node for the followed
+// directory link at rel.
+func (fl *followedLinks) list(rel string, node *pathTrie) error {
+	node.children = map[string]*pathTrie{}
+	limitCh := make(chan struct{}, 100)
+	eg := errgroup.Group{}
+	eg.Go(func() error {
+		return walkDir(fl.root, rel, &eg, limitCh, fl.isIgnored, node)
+	})
+	return eg.Wait()
+}
+
+// isVendorPath returns whether rel is a vendor directory or is within one.
+func isVendorPath(rel string) bool {
+	for _, elem := range strings.Split(rel, "/") {
+		if elem == "vendor" {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithinDir returns whether the file system path p is dir or is within it.
+func isWithinDir(p, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 type pathTrie struct {
 	children map[string]*pathTrie
 	entry    *fs.DirEntry
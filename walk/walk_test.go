@@ -17,8 +17,10 @@ package walk
 
 import (
 	"flag"
+	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"testing"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
@@ -253,6 +255,118 @@ a.file
 	}
 }
 
+func TestBazelIgnoreDisabled(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: ".bazelignore", Content: "ignored\n"},
+		{Path: "ignored/a.go"},
+		{Path: "kept/b.go"},
+	})
+	defer cleanup()
+
+	for _, tc := range []struct {
+		desc string
+		args []string
+		want []string
+	}{
+		{
+			desc: "default",
+			want: []string{"kept/b.go", ".bazelignore"},
+		}, {
+			desc: "disabled",
+			args: []string{"-bazelignore=false"},
+			want: []string{"ignored/a.go", "kept/b.go", ".bazelignore"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			cexts := []config.Configurer{&config.CommonConfigurer{}, &Configurer{}}
+			c := testtools.NewTestConfig(t, cexts, nil, append([]string{"-repo_root", dir}, tc.args...))
+			var files []string
+			Walk(c, cexts, []string{dir}, VisitAllUpdateSubdirsMode, func(_ string, rel string, _ *config.Config, _ bool, _ *rule.File, _, regularFiles, _ []string) {
+				for _, f := range regularFiles {
+					files = append(files, path.Join(rel, f))
+				}
+			})
+			if diff := cmp.Diff(tc.want, files); diff != "" {
+				t.Errorf("Walk files (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExcludeNegation(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+			Content: `
+# gazelle:exclude **/testdata/**
+# gazelle:exclude !**/testdata/keepme/**
+`,
+		},
+		{Path: "a/a.go"},
+		{Path: "a/testdata/BUILD.bazel"},              // excluded by '**/testdata/**'
+		{Path: "a/testdata/x.go"},                     // excluded by '**/testdata/**'
+		{Path: "a/testdata/keepme/keep.go"},           // included by '!**/testdata/keepme/**'
+		{Path: "a/testdata/keepme/sub/keep.go"},       // included by '!**/testdata/keepme/**'
+		{Path: "a/testdata/other/x.go"},               // excluded by '**/testdata/**'
+		{Path: "b/testdata/keepme/keep.txt"},          // excluded by '**/*.txt' in b
+		{Path: "b/testdata/keepme/keep.go"},           // included by '!**/testdata/keepme/**'
+		{Path: "b/testdata/keepme/again/BUILD.bazel"}, // excluded by '**/again' in b
+		{
+			Path: "b/BUILD.bazel",
+			Content: `
+# gazelle:exclude **/*.txt
+# gazelle:exclude **/again
+`,
+		},
+	})
+	defer cleanup()
+
+	c, cexts := testConfig(t, dir)
+	var files, rels []string
+	configs := make(map[string]*config.Config)
+	Walk(c, cexts, []string{dir}, VisitAllUpdateSubdirsMode, func(_ string, rel string, c *config.Config, _ bool, _ *rule.File, _, regularFiles, _ []string) {
+		rels = append(rels, rel)
+		configs[rel] = c
+		for _, f := range regularFiles {
+			files = append(files, path.Join(rel, f))
+		}
+	})
+	wantFiles := []string{
+		"a/testdata/keepme/sub/keep.go",
+		"a/testdata/keepme/keep.go",
+		"a/a.go",
+		"b/testdata/keepme/keep.go",
+		"b/BUILD.bazel",
+		"BUILD.bazel",
+	}
+	if diff := cmp.Diff(wantFiles, files); diff != "" {
+		t.Errorf("Walk files (-want +got):\n%s", diff)
+	}
+	wantRels := []string{"a/testdata/keepme/sub", "a/testdata/keepme", "a", "b/testdata/keepme", "b", ""}
+	if diff := cmp.Diff(wantRels, rels); diff != "" {
+		t.Errorf("Walk relative paths (-want +got):\n%s", diff)
+	}
+
+	// IsExcluded agrees with the files Walk lists.
+	for _, tc := range []struct {
+		configRel, rel string
+		want           bool
+	}{
+		{configRel: "", rel: "a/a.go", want: false},
+		{configRel: "", rel: "a/testdata/x.go", want: true},
+		{configRel: "", rel: "a/testdata/keepme/keep.go", want: false},
+		{configRel: "", rel: "a/testdata/keepme/sub/keep.go", want: false},
+		{configRel: "", rel: "a/testdata/other/x.go", want: true},
+		{configRel: "b", rel: "b/testdata/keepme/keep.txt", want: true},
+		{configRel: "b", rel: "b/testdata/keepme/keep.go", want: false},
+		{configRel: "b", rel: "b/testdata/keepme/again/BUILD.bazel", want: true},
+	} {
+		if got := IsExcluded(configs[tc.configRel], tc.rel); got != tc.want {
+			t.Errorf("IsExcluded(%q) = %v; want %v", tc.rel, got, tc.want)
+		}
+	}
+}
+
 func TestExcludeSelf(t *testing.T) {
 	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
 		{
@@ -278,6 +392,123 @@ func TestExcludeSelf(t *testing.T) {
 	}
 }
 
+func TestConfigureTree(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+		}, {
+			Path: "a/BUILD.bazel",
+			Content: `
+# gazelle:build_file_name BUILD.test
+# gazelle:exclude skip
+`,
+		}, {
+			Path: "a/b/",
+		}, {
+			Path: "a/skip/BUILD.bazel",
+		}, {
+			Path: "c/",
+		},
+	})
+	defer cleanup()
+
+	c, cexts := testConfig(t, dir)
+	root := ConfigureTree(c, cexts)
+
+	type node struct {
+		Rel       string
+		HasFile   bool
+		FileNames []string
+		Children  []node
+	}
+	var convert func(*ConfigNode) node
+	convert = func(n *ConfigNode) node {
+		got := node{Rel: n.Rel, HasFile: n.File != nil, FileNames: n.Config.ValidBuildFileNames}
+		for _, child := range n.Children {
+			got.Children = append(got.Children, convert(child))
+		}
+		return got
+	}
+	defaultNames := config.DefaultValidBuildFileNames
+	want := node{
+		Rel:       "",
+		HasFile:   true,
+		FileNames: defaultNames,
+		Children: []node{
+			{
+				Rel:       "a",
+				HasFile:   true,
+				FileNames: []string{"BUILD.test"},
+				Children: []node{
+					{Rel: "a/b", FileNames: []string{"BUILD.test"}},
+				},
+			},
+			{Rel: "c", FileNames: defaultNames},
+		},
+	}
+	if diff := cmp.Diff(want, convert(root)); diff != "" {
+		t.Errorf("ConfigureTree (-want +got):\n%s", diff)
+	}
+}
+
+func TestResetDirective(t *testing.T) {
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{
+			Path: "BUILD.bazel",
+			Content: `
+# gazelle:map_kind go_library my_library //:my.bzl
+# gazelle:map_kind go_test my_test //:my.bzl
+`,
+		}, {
+			Path: "a/BUILD.bazel",
+			Content: `
+# gazelle:build_file_name BUILD.test
+`,
+		}, {
+			Path: "a/b/BUILD.test",
+			Content: `
+# gazelle:reset map_kind
+# gazelle:map_kind go_binary my_binary //:my.bzl
+`,
+		}, {
+			Path: "a/b/c/BUILD.test",
+		}, {
+			Path: "d/BUILD.bazel",
+			Content: `
+# gazelle:reset build_file_name, map_kind
+`,
+		},
+	})
+	defer cleanup()
+
+	c, cexts := testConfig(t, dir)
+	type result struct {
+		FileNames []string
+		Kinds     []string
+	}
+	got := make(map[string]result)
+	Walk(c, cexts, []string{dir}, VisitAllUpdateSubdirsMode, func(_, rel string, c *config.Config, _ bool, _ *rule.File, _, _, _ []string) {
+		var kinds []string
+		for kind := range c.KindMap {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		got[rel] = result{FileNames: c.ValidBuildFileNames, Kinds: kinds}
+	})
+
+	defaultNames := config.DefaultValidBuildFileNames
+	want := map[string]result{
+		"":      {FileNames: defaultNames, Kinds: []string{"go_library", "go_test"}},
+		"a":     {FileNames: []string{"BUILD.test"}, Kinds: []string{"go_library", "go_test"}},
+		"a/b":   {FileNames: []string{"BUILD.test"}, Kinds: []string{"go_binary"}},
+		"a/b/c": {FileNames: []string{"BUILD.test"}, Kinds: []string{"go_binary"}},
+		"d":     {FileNames: defaultNames},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("configurations (-want +got):\n%s", diff)
+	}
+}
+
 func TestGeneratedFiles(t *testing.T) {
 	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
 		{
@@ -322,6 +553,107 @@ unknown_rule(
 	}
 }
 
+func TestFollowSymlinks(t *testing.T) {
+	outside, cleanupOutside := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "mod/mod.go"},
+		{Path: "mod/sub/sub.go"},
+	})
+	defer cleanupOutside()
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "BUILD.bazel", Content: "# gazelle:follow followed"},
+		{Path: "inside/inside.go"},
+		{Path: "vendor/"},
+	})
+	defer cleanup()
+	for link, target := range map[string]string{
+		"followed":        filepath.Join(dir, "inside"),
+		"not_followed":    filepath.Join(outside, "mod"),
+		"vendor/mod":      filepath.Join(outside, "mod"),
+		"vendor/mod_copy": filepath.Join(outside, "mod"),
+		"vendor/inside":   filepath.Join(dir, "inside"),
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, filepath.FromSlash(link))); err != nil {
+			t.Skipf("can't create symlinks: %v", err)
+		}
+	}
+
+	c, cexts := testConfig(t, dir)
+	var files []string
+	Walk(c, cexts, []string{dir}, VisitAllUpdateSubdirsMode, func(_ string, rel string, _ *config.Config, _ bool, _ *rule.File, _, reg, _ []string) {
+		for _, f := range reg {
+			files = append(files, path.Join(rel, f))
+		}
+	})
+	sort.Strings(files)
+	want := []string{
+		"BUILD.bazel",
+		"followed/inside.go",
+		"inside/inside.go",
+		"vendor/mod/mod.go",
+		"vendor/mod/sub/sub.go",
+	}
+	if diff := cmp.Diff(want, files); diff != "" {
+		t.Errorf("Walk files (-want +got):\n%s", diff)
+	}
+}
+
+func TestFollowSymlinksMode(t *testing.T) {
+	outside, cleanupOutside := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "shared/shared.go"},
+		{Path: "out/gen.go"},
+	})
+	defer cleanupOutside()
+	dir, cleanup := testtools.CreateFiles(t, []testtools.FileSpec{
+		{Path: "BUILD.bazel", Content: "# gazelle:follow third_party"},
+		{Path: "a/a.go"},
+	})
+	defer cleanup()
+	for link, target := range map[string]string{
+		"third_party": filepath.Join(outside, "shared"),
+		"other":       filepath.Join(outside, "shared"),
+		"bazel-out":   filepath.Join(outside, "out"),
+		"a/loop":      filepath.Join(dir, "a"),
+		"a/root":      dir,
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, filepath.FromSlash(link))); err != nil {
+			t.Skipf("can't create symlinks: %v", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		mode string
+		want []string
+	}{
+		{
+			mode: "directive",
+			want: []string{"BUILD.bazel", "a/a.go", "third_party/shared.go"},
+		}, {
+			mode: "all",
+			// other and third_party have the same target, so only the first is
+			// followed. Links to a and the root would form cycles.
+			want: []string{"BUILD.bazel", "a/a.go", "other/shared.go"},
+		}, {
+			mode: "none",
+			want: []string{"BUILD.bazel", "a/a.go"},
+		},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			cexts := []config.Configurer{&config.CommonConfigurer{}, &Configurer{}}
+			c := testtools.NewTestConfig(t, cexts, nil, []string{"-repo_root", dir, "-follow_symlinks", tc.mode})
+			var files []string
+			Walk(c, cexts, []string{dir}, VisitAllUpdateSubdirsMode, func(_ string, rel string, _ *config.Config, _ bool, _ *rule.File, _, reg, _ []string) {
+				for _, f := range reg {
+					files = append(files, path.Join(rel, f))
+				}
+			})
+			sort.Strings(files)
+			if diff := cmp.Diff(tc.want, files); diff != "" {
+				t.Errorf("Walk files (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func testConfig(t *testing.T, dir string) (*config.Config, []config.Configurer) {
 	args := []string{"-repo_root", dir}
 	cexts := []config.Configurer{&config.CommonConfigurer{}, &Configurer{}}